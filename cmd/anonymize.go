@@ -0,0 +1,64 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/logging"
+	"hpc-toolkit/pkg/support"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	anonymizeCmd.Flags().StringVarP(&anonymizeFlags.out, "out", "o", "",
+		"Path of the file to write. Defaults to standard output.")
+	rootCmd.AddCommand(anonymizeCmd)
+}
+
+var (
+	anonymizeFlags = struct {
+		out string
+	}{}
+
+	anonymizeCmd = &cobra.Command{
+		Use:   "anonymize BLUEPRINT_FILE",
+		Short: "Replace project IDs, bucket names, domains and secrets of a blueprint with placeholders.",
+		Long: "Rewrite project IDs, bucket names, domains and email addresses of a blueprint into placeholders and " +
+			"redact secrets, keeping its structure and comments, so that it can be shared publicly, e.g. in an " +
+			"issue. The same value is replaced by the same placeholder. The blueprint does not have to be valid.",
+		Args:              cobra.MatchAll(cobra.ExactArgs(1), checkExists),
+		ValidArgsFunction: filterYaml,
+		Run:               runAnonymizeCmd,
+		SilenceUsage:      true,
+	}
+)
+
+func runAnonymizeCmd(cmd *cobra.Command, args []string) {
+	data, err := os.ReadFile(args[0])
+	checkErr(err, nil)
+	out, err := support.AnonymizeYaml(data)
+	if err != nil {
+		checkErr(fmt.Errorf("failed to parse %s: %w", args[0], err), nil)
+	}
+	if anonymizeFlags.out == "" {
+		_, err = os.Stdout.Write(out)
+	} else {
+		err = os.WriteFile(anonymizeFlags.out, out, 0644)
+	}
+	checkErr(err, nil)
+	logging.Error("Anonymization is best-effort, review the blueprint before sharing it.")
+}
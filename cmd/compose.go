@@ -0,0 +1,143 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmd defines command line utilities for ghpc
+package cmd
+
+import (
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/logging"
+	"hpc-toolkit/pkg/modulereader"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
+)
+
+func init() {
+	composeCmd.Flags().StringVarP(&composeFlags.outputPath, "out", "o", "blueprint.yaml",
+		"Output file for the composed blueprint.")
+	rootCmd.AddCommand(composeCmd)
+}
+
+var (
+	composeFlags = struct {
+		outputPath string
+	}{}
+
+	composeCmd = &cobra.Command{
+		Use:   "compose BASE_BLUEPRINT OVERLAY_BLUEPRINT...",
+		Short: "Merge overlay blueprints into a base blueprint.",
+		Long: "Merge overlay blueprints, in order, into a base blueprint. Deployment variables and " +
+			"modules with the same ID are overridden, new modules and groups are appended.",
+		Args:              cobra.MinimumNArgs(2),
+		ValidArgsFunction: filterYaml,
+		Run:               runComposeCmd,
+		SilenceUsage:      true,
+	}
+)
+
+func runComposeCmd(cmd *cobra.Command, args []string) {
+	bp, ctx, err := config.NewBlueprint(args[0])
+	checkErr(err, ctx)
+	for _, path := range args[1:] {
+		o, ctx, err := config.NewBlueprint(path)
+		checkErr(err, ctx)
+		overlayBlueprint(&bp, o, *ctx)
+	}
+	checkErr(bp.Export(composeFlags.outputPath), nil)
+	logging.Info(boldGreen("Composed blueprint saved as %s."), composeFlags.outputPath)
+}
+
+// overlayBlueprint merges overlay into the blueprint:
+// * top-level fields are overridden if set in overlay, validation_level is looked up in ctx;
+// * deployment variables are overridden by name;
+// * validators are overridden by name, new validators are appended;
+// * modules are overridden by ID, see overlayModule;
+// * new modules are appended to the group of the same name, new groups are appended.
+func overlayBlueprint(bp *config.Blueprint, o config.Blueprint, ctx config.YamlCtx) {
+	if o.BlueprintName != "" {
+		bp.BlueprintName = o.BlueprintName
+	}
+	if o.GhpcVersion != "" {
+		bp.GhpcVersion = o.GhpcVersion
+	}
+	if _, set := ctx.Pos(config.Root.ValidationLevel); set { // ERROR is the zero value
+		bp.ValidationLevel = o.ValidationLevel
+	}
+	if o.TerraformBackendDefaults.Type != "" {
+		bp.TerraformBackendDefaults = o.TerraformBackendDefaults
+	}
+	if len(o.LabelPolicy.ExcludeModules)+len(o.LabelPolicy.ExcludeKeys)+len(o.LabelPolicy.RequiredKeys) > 0 {
+		bp.LabelPolicy = o.LabelPolicy
+	}
+
+	for k, v := range o.Vars.Items() {
+		bp.Vars = bp.Vars.With(k, v)
+	}
+
+	for _, ov := range o.Validators {
+		i := slices.IndexFunc(bp.Validators, func(v config.Validator) bool { return v.Validator == ov.Validator })
+		if i < 0 {
+			bp.Validators = append(bp.Validators, ov)
+		} else {
+			bp.Validators[i] = ov
+		}
+	}
+
+	for _, og := range o.Groups {
+		ig := slices.IndexFunc(bp.Groups, func(g config.Group) bool { return g.Name == og.Name })
+		if ig < 0 {
+			bp.Groups = append(bp.Groups, config.Group{Name: og.Name})
+			ig = len(bp.Groups) - 1
+		}
+		if og.TerraformBackend.Type != "" {
+			bp.Groups[ig].TerraformBackend = og.TerraformBackend
+		}
+
+		for _, om := range og.Modules {
+			if m, err := bp.Module(om.ID); err == nil {
+				overlayModule(m, om) // override in place, regardless of the group
+			} else {
+				bp.Groups[ig].Modules = append(bp.Groups[ig].Modules, om)
+			}
+		}
+	}
+}
+
+// overlayModule merges overlay module into the module:
+// source, kind, use and skipped validators are overridden if set, outputs are appended and
+// settings are overridden by name.
+func overlayModule(m *config.Module, o config.Module) {
+	if o.Source != "" {
+		m.Source = o.Source
+	}
+	if o.Kind != config.UnknownKind {
+		m.Kind = o.Kind
+	}
+	if len(o.Use) > 0 {
+		m.Use = o.Use
+	}
+	if len(o.SkipValidators) > 0 {
+		m.SkipValidators = o.SkipValidators
+		m.SkipJustification = o.SkipJustification
+	}
+	for _, out := range o.Outputs {
+		if !slices.ContainsFunc(m.Outputs, func(mo modulereader.OutputInfo) bool { return mo.Name == out.Name }) {
+			m.Outputs = append(m.Outputs, out)
+		}
+	}
+	for k, v := range o.Settings.Items() {
+		m.Settings = m.Settings.With(k, v)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"hpc-toolkit/pkg/config"
+
+	"github.com/zclconf/go-cty/cty"
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v3"
+)
+
+func (s *MySuite) TestOverlayBlueprint(c *C) {
+	bp := config.Blueprint{
+		BlueprintName: "base",
+		Vars: config.NewDict(map[string]cty.Value{
+			"project_id": cty.StringVal("pink"),
+			"zone":       cty.StringVal("us-central1-a"),
+		}),
+		Groups: []config.Group{{Name: "primary", Modules: []config.Module{
+			{ID: "network", Source: "modules/network/vpc"},
+			{ID: "homefs", Source: "modules/file-system/filestore", Use: config.ModuleIDs{"network"},
+				Settings: config.NewDict(map[string]cty.Value{
+					"local_mount": cty.StringVal("/home"),
+					"size_gb":     cty.NumberIntVal(1024),
+				})},
+		}}},
+		Validators: []config.Validator{{Validator: "test_project_exists"}},
+	}
+
+	o := config.Blueprint{
+		Vars: config.NewDict(map[string]cty.Value{
+			"zone":   cty.StringVal("europe-west4-a"),
+			"region": cty.StringVal("europe-west4"),
+		}),
+		Groups: []config.Group{{Name: "site", Modules: []config.Module{
+			{ID: "homefs", Settings: config.NewDict(map[string]cty.Value{
+				"local_mount": cty.StringVal("/home2"),
+			})},
+			{ID: "vm", Source: "modules/compute/vm-instance"},
+		}}, {Name: "primary", Modules: []config.Module{
+			{ID: "script", Source: "modules/scripts/startup-script"},
+		}}},
+		Validators: []config.Validator{
+			{Validator: "test_project_exists", Skip: true},
+			{Validator: "test_apis_enabled", Skip: true}},
+	}
+
+	overlayBlueprint(&bp, o, config.YamlCtx{})
+
+	c.Check(bp.BlueprintName, Equals, "base")
+	c.Check(bp.Vars.Items(), DeepEquals, map[string]cty.Value{
+		"project_id": cty.StringVal("pink"),
+		"zone":       cty.StringVal("europe-west4-a"),
+		"region":     cty.StringVal("europe-west4"),
+	})
+	c.Check(bp.Validators, DeepEquals, []config.Validator{
+		{Validator: "test_project_exists", Skip: true},
+		{Validator: "test_apis_enabled", Skip: true}})
+
+	c.Assert(bp.Groups, HasLen, 2)
+	c.Check(bp.Groups[0].Name, Equals, config.GroupName("primary"))
+	c.Check(bp.Groups[1].Name, Equals, config.GroupName("site"))
+
+	primary := bp.Groups[0].Modules
+	c.Assert(primary, HasLen, 3)
+	c.Check(primary[2].ID, Equals, config.ModuleID("script"))
+
+	homefs := primary[1] // overridden in place
+	c.Check(homefs.Source, Equals, "modules/file-system/filestore")
+	c.Check(homefs.Use, DeepEquals, config.ModuleIDs{"network"})
+	c.Check(homefs.Settings.Items(), DeepEquals, map[string]cty.Value{
+		"local_mount": cty.StringVal("/home2"),
+		"size_gb":     cty.NumberIntVal(1024),
+	})
+
+	c.Check(bp.Groups[1].Modules, DeepEquals, []config.Module{{ID: "vm", Source: "modules/compute/vm-instance"}})
+}
+
+func (s *MySuite) TestOverlayValidationLevel(c *C) {
+	overlay := func(base int, yml string) int {
+		bp := config.Blueprint{ValidationLevel: base}
+		ctx, err := config.NewYamlCtx([]byte(yml))
+		c.Assert(err, IsNil)
+		o := config.Blueprint{}
+		c.Assert(yaml.Unmarshal([]byte(yml), &o), IsNil)
+		overlayBlueprint(&bp, o, ctx)
+		return bp.ValidationLevel
+	}
+
+	c.Check(overlay(config.ValidationWarning, "blueprint_name: o\n"), Equals, config.ValidationWarning)
+	c.Check(overlay(config.ValidationError, "validation_level: 2\n"), Equals, config.ValidationIgnore)
+	// ERROR is the zero value, but still overrides when set
+	c.Check(overlay(config.ValidationWarning, "validation_level: 0\n"), Equals, config.ValidationError)
+}
@@ -18,18 +18,21 @@ limitations under the License.
 package cmd
 
 import (
-	"errors"
+	"bufio"
 	"fmt"
 	"hpc-toolkit/pkg/config"
 	"hpc-toolkit/pkg/logging"
 	"hpc-toolkit/pkg/modulewriter"
+	"hpc-toolkit/pkg/profile"
 	"hpc-toolkit/pkg/validators"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/slices"
 	"gopkg.in/yaml.v3"
 )
 
@@ -45,7 +48,16 @@ func addCreateFlags(c *cobra.Command) *cobra.Command {
 		"Forces overwrite of existing deployment directory. \n"+
 			"If set, --overwrite-deployment is implied. \n"+
 			"No validation is performed on the existing deployment directory.")
-	return addExpandFlags(c, false /*addOutFlag to avoid clash with "create" `out` flag*/)
+	c.Flags().BoolVar(&createFlags.resume, "resume", false,
+		"Completes writing of the deployment directory that was interrupted, instead of writing it anew.")
+	c.Flags().StringSliceVar(&createFlags.protected, "destroy-protected", nil,
+		"Comma-separated list of IDs of removed modules with destroy protection, confirms their destruction without prompting.")
+	c.Flags().StringVar(&modulewriter.DevModulesDir, "dev-modules", "",
+		"Symlink modules located in this directory into the deployment instead of copying them. \n"+
+			"If it is a checkout of the toolkit, embedded modules are symlinked to it as well. \n"+
+			"Note: the deployment directory is not self-contained, use for module development only.")
+	return addGroupFilterFlags(
+		addExpandFlags(c, false /*addOutFlag to avoid clash with "create" `out` flag*/))
 }
 
 func init() {
@@ -57,6 +69,8 @@ var (
 		outputDir           string
 		overwriteDeployment bool
 		forceOverwrite      bool
+		resume              bool
+		protected           []string
 	}{}
 
 	createCmd = addCreateFlags(&cobra.Command{
@@ -79,14 +93,57 @@ func runCreateCmd(cmd *cobra.Command, args []string) {
 }
 
 func doCreate(path string) string {
-	bp, ctx := expandOrDie(path)
+	return doCreateWithVars(path, config.Dict{})
+}
+
+// doCreateWithVars creates the deployment, vars override variables of the blueprint,
+// but are overridden by the deployment file, environment and `--vars`
+func doCreateWithVars(path string, vars config.Dict) string {
+	bp, ctx := expandWithVarsOrDie(path, vars)
 	deplDir := filepath.Join(createFlags.outputDir, bp.DeploymentName())
+	if createFlags.resume {
+		resumed, err := modulewriter.ResumeWrite(deplDir)
+		checkErr(err, ctx)
+		if resumed {
+			logging.Info("Completed interrupted writing of deployment folder %q", deplDir)
+			return deplDir
+		}
+		logging.Info("No interrupted writing of deployment folder %q to resume", deplDir)
+	}
 	logging.Info("Creating deployment folder %q ...", deplDir)
 	checkErr(checkOverwriteAllowed(deplDir, bp, createFlags.overwriteDeployment, createFlags.forceOverwrite), ctx)
-	checkErr(modulewriter.WriteDeployment(bp, deplDir), ctx)
+	keep, err := keptGroups(deplDir, bp)
+	checkErr(err, ctx)
+	checkErr(confirmProtectedRemoval(bufio.NewReader(os.Stdin), os.Stdout, deplDir, bp, keep), ctx)
+	stopWriting := profile.Start(profile.Writing, deplDir)
+	checkErr(modulewriter.WriteDeploymentKeepingGroups(bp, deplDir, keep), ctx)
+	stopWriting()
 	return deplDir
 }
 
+// keptGroups returns groups of the existing deployment that are not selected
+// by --only or --skip flags and should not be re-written
+func keptGroups(deplDir string, bp config.Blueprint) ([]config.GroupName, error) {
+	selected, err := selectGroups(bp.Groups)
+	if err != nil {
+		return nil, err
+	}
+	keep := []config.GroupName{}
+	for _, g := range bp.Groups {
+		if !selected[g.Name] {
+			keep = append(keep, g.Name)
+		}
+	}
+	if len(keep) == 0 {
+		return nil, nil
+	}
+	if _, err := os.Stat(modulewriter.HiddenGhpcDir(deplDir)); err != nil {
+		return nil, fmt.Errorf("--only and --skip can only be used to update an existing deployment, %q is not found", deplDir)
+	}
+	logging.Info("Deployment groups left untouched: %s", joinGroupNames(keep))
+	return keep, nil
+}
+
 func printAdvancedInstructionsMessage(deplDir string) {
 	logging.Info("Find instructions for cleanly destroying infrastructure and advanced manual")
 	logging.Info("deployment instructions at:")
@@ -96,8 +153,21 @@ func printAdvancedInstructionsMessage(deplDir string) {
 
 // TODO: move to expand.go
 func expandOrDie(path string) (config.Blueprint, *config.YamlCtx) {
+	return expandWithVarsOrDie(path, config.Dict{})
+}
+
+// TODO: move to expand.go
+func expandWithVarsOrDie(path string, vars config.Dict) (config.Blueprint, *config.YamlCtx) {
+	startProfiling()
+	stopParsing := profile.Start(profile.Parsing, path)
 	bp, ctx, err := config.NewBlueprint(path)
-	checkErr(err, ctx)
+	stopParsing()
+	if err != nil {
+		writeSarifMaybe(path, err, nil, *ctx)
+		checkErr(err, ctx)
+	}
+	warnDeprecations(path, bp, *ctx)
+	mergeDeploymentSettings(&bp, config.DeploymentSettings{Vars: vars})
 
 	var ds config.DeploymentSettings
 	var dCtx config.YamlCtx
@@ -105,6 +175,9 @@ func expandOrDie(path string) (config.Blueprint, *config.YamlCtx) {
 		ds, dCtx, err = config.NewDeploymentSettings(expandFlags.deploymentFile)
 		checkErr(err, &dCtx)
 	}
+	if err := setEnvVariables(&ds, os.Environ()); err != nil {
+		logging.Fatal("Failed to set the variables from environment: %v", err)
+	}
 	if err := setCLIVariables(&ds, expandFlags.cliVariables); err != nil {
 		logging.Fatal("Failed to set the variables at CLI: %v", err)
 	}
@@ -113,24 +186,46 @@ func expandOrDie(path string) (config.Blueprint, *config.YamlCtx) {
 	}
 
 	mergeDeploymentSettings(&bp, ds)
+	if !expandFlags.noGcloudDefaults {
+		inheritGcloudDefaults(&bp, readGcloudConfig(os.Getenv))
+	}
+	if expandFlags.prompt {
+		promptUnsetValues(bp, &ds)
+		mergeDeploymentSettings(&bp, ds)
+	}
 
 	checkErr(setValidationLevel(&bp, expandFlags.validationLevel), ctx)
 	skipValidators(&bp)
 
-	if bp.GhpcVersion != "" {
+	if bp.GhpcVersion != "" && !config.IsVersionConstraint(bp.GhpcVersion) {
 		logging.Info("ghpc_version setting is ignored.")
 	}
 	bp.GhpcVersion = GitCommitInfo
 
 	// Expand the blueprint
-	checkErr(bp.Expand(), ctx)
-	validateMaybeDie(bp, *ctx)
+	stopExpansion := profile.Start(profile.Expansion, "")
+	err = bp.Expand()
+	stopExpansion()
+	if err != nil {
+		writeSarifMaybe(path, err, nil, *ctx)
+		checkErr(err, ctx)
+	}
+	validateMaybeDie(path, bp, *ctx)
+	checkErr(bp.SplitPackerGroups(), ctx)
 	return bp, ctx
 }
 
 // TODO: move to expand.go
-func validateMaybeDie(bp config.Blueprint, ctx config.YamlCtx) {
-	err := validators.Execute(bp)
+func validateMaybeDie(path string, bp config.Blueprint, ctx config.YamlCtx) {
+	err, warnings := validators.SplitWarnings(validators.Execute(bp), bp.ValidationLevel)
+	writeSarifMaybe(path, err, warnings, ctx)
+	writeQuotaRequestsMaybe(err, warnings)
+	recordFailedValidators(err)
+	recordFailedValidators(warnings)
+	if warnings != nil {
+		warnFindings(warnings, ctx)
+		logging.Error(boldYellow("Validation failures were treated as warnings, continuing to create blueprint."))
+	}
 	if err == nil {
 		return
 	}
@@ -147,19 +242,18 @@ func validateMaybeDie(bp config.Blueprint, ctx config.YamlCtx) {
 	logging.Error("")
 	logging.Error("- https://goo.gle/hpc-toolkit-validation-levels")
 	logging.Error("")
+	logging.Fatal(boldRed("validation failed due to the issues listed above"))
+}
 
-	switch bp.ValidationLevel {
-	case config.ValidationWarning:
-		{
-			logging.Error(boldYellow("Validation failures were treated as a warning, continuing to create blueprint."))
-			logging.Error("")
-		}
-	case config.ValidationError:
-		{
-			logging.Fatal(boldRed("validation failed due to the issues listed above"))
+// warnFindings records findings of validation, that are treated as warnings
+func warnFindings(err error, ctx config.YamlCtx) {
+	for _, f := range collectFindings(err, ctx) {
+		w := logging.Warning{Source: f.rule, Code: string(f.code), Message: f.msg, Hint: f.hint}
+		if f.pos != nil {
+			w.Location = fmt.Sprintf("line %d", f.pos.Line)
 		}
+		logging.Warn(w)
 	}
-
 }
 
 // TODO: move to expand.go
@@ -170,17 +264,47 @@ func setCLIVariables(ds *config.DeploymentSettings, s []string) error {
 		if len(arr) != 2 {
 			return fmt.Errorf("invalid format: '%s' should follow the 'name=value' format", cliVar)
 		}
-		// Convert the variable's string literal to its equivalent default type.
-		key := arr[0]
-		var v config.YamlValue
-		if err := yaml.Unmarshal([]byte(arr[1]), &v); err != nil {
-			return fmt.Errorf("invalid input: unable to convert '%s' value '%s' to known type", key, arr[1])
+		v, err := parseVarValue(arr[0], arr[1])
+		if err != nil {
+			return err
 		}
-		ds.Vars = ds.Vars.With(key, v.Unwrap())
+		ds.Vars = ds.Vars.With(arr[0], v)
 	}
 	return nil
 }
 
+// envVarPrefix is a prefix of environment variables that set deployment variables
+const envVarPrefix = "GHPC_VAR_"
+
+// setEnvVariables sets deployment variables from `GHPC_VAR_<name>=value` environment variables.
+// Takes precedence over the deployment file, but is overridden by `--vars`.
+func setEnvVariables(ds *config.DeploymentSettings, environ []string) error {
+	for _, kv := range environ {
+		if !strings.HasPrefix(kv, envVarPrefix) {
+			continue
+		}
+		arr := strings.SplitN(strings.TrimPrefix(kv, envVarPrefix), "=", 2)
+		if len(arr) != 2 || arr[0] == "" {
+			return fmt.Errorf("invalid format: environment variable '%s' should follow the '%s<name>=value' format", kv, envVarPrefix)
+		}
+		v, err := parseVarValue(arr[0], arr[1])
+		if err != nil {
+			return err
+		}
+		ds.Vars = ds.Vars.With(arr[0], v)
+	}
+	return nil
+}
+
+// parseVarValue converts the variable's string literal to its equivalent default type.
+func parseVarValue(key string, s string) (cty.Value, error) {
+	var v config.YamlValue
+	if err := yaml.Unmarshal([]byte(s), &v); err != nil {
+		return cty.NilVal, fmt.Errorf("invalid input: unable to convert '%s' value '%s' to known type", key, s)
+	}
+	return v.Unwrap(), nil
+}
+
 // TODO: move to expand.go
 func setBackendConfig(ds *config.DeploymentSettings, s []string) error {
 	if len(s) == 0 {
@@ -219,16 +343,11 @@ func mergeDeploymentSettings(bp *config.Blueprint, ds config.DeploymentSettings)
 // SetValidationLevel allows command-line tools to set the validation level
 // TODO: move to expand.go
 func setValidationLevel(bp *config.Blueprint, s string) error {
-	switch s {
-	case "ERROR":
-		bp.ValidationLevel = config.ValidationError
-	case "WARNING":
-		bp.ValidationLevel = config.ValidationWarning
-	case "IGNORE":
-		bp.ValidationLevel = config.ValidationIgnore
-	default:
-		return errors.New("invalid validation level (\"ERROR\", \"WARNING\", \"IGNORE\")")
+	l, err := config.ParseValidationLevel(s)
+	if err != nil {
+		return err
 	}
+	bp.ValidationLevel = l
 	return nil
 }
 
@@ -276,6 +395,14 @@ func checkOverwriteAllowed(depDir string, bp config.Blueprint, overwriteFlag boo
 		return fmt.Errorf("deployment folder %q already exists, use -w to overwrite", depDir)
 	}
 
+	if err := checkGroupsNotRemoved(prev, bp); err != nil {
+		return forceErr(err)
+	}
+	return nil
+}
+
+// checkGroupsNotRemoved errors if any group of the previous deployment is missing in the new one
+func checkGroupsNotRemoved(prev config.Blueprint, bp config.Blueprint) error {
 	newGroups := map[config.GroupName]bool{}
 	for _, g := range bp.Groups {
 		newGroups[g.Name] = true
@@ -283,19 +410,56 @@ func checkOverwriteAllowed(depDir string, bp config.Blueprint, overwriteFlag boo
 
 	for _, g := range prev.Groups {
 		if !newGroups[g.Name] {
-			return forceErr(fmt.Errorf("you are attempting to remove a deployment group %q, which is not supported", g.Name))
+			return fmt.Errorf("you are attempting to remove a deployment group %q, which is not supported", g.Name)
 		}
 	}
+	return nil
+}
 
+// confirmProtectedRemoval asks to confirm destruction of modules with destroy protection
+// in the previous deployment that are missing in the blueprint. Their guard resources
+// are removed along with the modules, so the next apply would destroy them unprotected.
+func confirmProtectedRemoval(in *bufio.Reader, out io.Writer, deplDir string, bp config.Blueprint, keep []config.GroupName) error {
+	expPath := filepath.Join(modulewriter.ArtifactsDir(deplDir), modulewriter.ExpandedBlueprintName)
+	if _, err := os.Stat(expPath); err != nil {
+		return nil // no previous deployment
+	}
+	prev, _, err := config.NewBlueprint(expPath)
+	if err != nil {
+		return nil // previous deployment is overwritten with --force
+	}
+	for _, g := range prev.Groups {
+		if slices.Contains(keep, g.Name) {
+			continue // not re-written
+		}
+		removed, unconfirmed := []config.ModuleID{}, []string{}
+		for _, id := range protectedModules(g) {
+			if _, err := bp.Module(id); err != nil {
+				removed = append(removed, id)
+				if !slices.Contains(createFlags.protected, string(id)) {
+					unconfirmed = append(unconfirmed, string(id))
+				}
+			}
+		}
+		if len(unconfirmed) > 0 {
+			fmt.Fprintf(out, "Modules %s with destroy protection were removed from the blueprint, the next deploy destroys them.\n",
+				strings.Join(unconfirmed, ", "))
+		}
+		if err := confirmDestroyProtected(in, out, g.Name, removed, createFlags.protected); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 // Reads an expanded blueprint from the artifacts directory
 // IMPORTANT: returned blueprint is "materialized", see config.Blueprint.Materialize
 func artifactBlueprintOrDie(artDir string) (config.Blueprint, *config.YamlCtx) {
+	checkErr(modulewriter.CheckWriteCompleted(artDir), nil)
 	path := filepath.Join(artDir, modulewriter.ExpandedBlueprintName)
 	bp, ctx, err := config.NewBlueprint(path)
 	checkErr(err, ctx)
+	checkErr(modulewriter.DecryptBlueprintVars(&bp, artDir), ctx)
 	checkErr(bp.Materialize(), ctx)
 	return bp, ctx
 }
@@ -15,10 +15,13 @@
 package cmd
 
 import (
+	"bufio"
+	"bytes"
 	"hpc-toolkit/pkg/config"
 	"hpc-toolkit/pkg/modulewriter"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/zclconf/go-cty/cty"
 	. "gopkg.in/check.v1"
@@ -83,6 +86,44 @@ func (s *MySuite) TestSetCLIVariables(c *C) {
 	c.Check(setCLIVariables(&ds, inv), ErrorMatches, ".*unable to convert.*pyrite.*gold.*")
 }
 
+func (s *MySuite) TestSetEnvVariables(c *C) {
+	ds := config.DeploymentSettings{
+		Vars: config.NewDict(map[string]cty.Value{
+			"zone":   cty.StringVal("file_zone"),
+			"region": cty.StringVal("file_region")})}
+	env := []string{
+		"HOME=/root",
+		"GHPC_VAR_zone=env_zone",
+		"GHPC_VAR_machine_count=3",
+		"GHPC_VAR_labels={team: hpc, tier: 1}",
+		"GHPC_VAR_subnets=[a, b]",
+		"GHPC_VAR_kv=key=val",
+		"ghpc_var_ignored=lowercase",
+	}
+	c.Assert(setEnvVariables(&ds, env), IsNil)
+	c.Check(ds.Vars.Items(), DeepEquals, map[string]cty.Value{
+		"zone":          cty.StringVal("env_zone"),
+		"region":        cty.StringVal("file_region"),
+		"machine_count": cty.NumberIntVal(3),
+		"labels": cty.ObjectVal(map[string]cty.Value{
+			"team": cty.StringVal("hpc"),
+			"tier": cty.NumberIntVal(1)}),
+		"subnets": cty.TupleVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}),
+		"kv":      cty.StringVal("key=val"),
+	})
+
+	// --vars take precedence over environment
+	c.Assert(setCLIVariables(&ds, []string{"zone=cli_zone"}), IsNil)
+	c.Check(ds.Vars.Get("zone"), DeepEquals, cty.StringVal("cli_zone"))
+
+	// Failure: no name
+	c.Check(setEnvVariables(&config.DeploymentSettings{}, []string{"GHPC_VAR_=green"}), ErrorMatches, "invalid format: .*")
+
+	// Failure: Unmarshalable value
+	c.Check(setEnvVariables(&config.DeploymentSettings{}, []string{"GHPC_VAR_pyrite={gold"}),
+		ErrorMatches, ".*unable to convert.*pyrite.*gold.*")
+}
+
 func (s *MySuite) TestSetBackendConfig(c *C) {
 	// Success
 	vars := []string{
@@ -206,7 +247,7 @@ func (s *MySuite) TestValidateMaybeDie(c *C) {
 		ValidationLevel: config.ValidationWarning,
 	}
 	ctx, _ := config.NewYamlCtx([]byte{})
-	validateMaybeDie(bp, ctx) // smoke test
+	validateMaybeDie("bp.yaml", bp, ctx) // smoke test
 }
 
 func (s *MySuite) TestIsOverwriteAllowed_Absent(c *C) {
@@ -309,3 +350,58 @@ func (s *MySuite) TestIsOverwriteAllowed_Present(c *C) {
 		c.Check(checkOverwriteAllowed(p, bp, noW, yesForce), IsNil)
 	}
 }
+
+func (s *MySuite) TestConfirmProtectedRemoval(c *C) {
+	p := c.MkDir()
+	artDir := modulewriter.ArtifactsDir(p)
+	c.Assert(os.MkdirAll(artDir, 0755), IsNil)
+
+	mod := func(id config.ModuleID, protected bool) config.Module {
+		return config.Module{ID: id, Source: "modules/file-system/filestore", Kind: config.TerraformKind, DestroyProtection: protected}
+	}
+	bp := func(mods ...config.Module) config.Blueprint {
+		return config.Blueprint{Groups: []config.Group{{Name: "primary", Modules: mods}}}
+	}
+	confirm := func(input string, next config.Blueprint, keep []config.GroupName) (string, error) {
+		var out bytes.Buffer
+		err := confirmProtectedRemoval(bufio.NewReader(strings.NewReader(input)), &out, p, next, keep)
+		return out.String(), err
+	}
+
+	{ // no previous deployment
+		_, err := confirm("", bp(), nil)
+		c.Check(err, IsNil)
+	}
+
+	c.Assert(bp(mod("homefs", true), mod("scratch", false)).Export(filepath.Join(artDir, "expanded_blueprint.yaml")), IsNil)
+
+	{ // protected module is kept, unprotected one is removed
+		out, err := confirm("", bp(mod("homefs", true)), nil)
+		c.Check(err, IsNil)
+		c.Check(out, Equals, "")
+	}
+
+	{ // removal of protected module is not confirmed
+		out, err := confirm("\n", bp(mod("scratch", false)), nil)
+		c.Check(err, ErrorMatches, `.*modules homefs with destroy protection was not confirmed.*`)
+		c.Check(out, Matches, `(?s)Modules homefs with destroy protection were removed from the blueprint.*`)
+	}
+
+	{ // removal is confirmed by typing
+		_, err := confirm("homefs\n", bp(), nil)
+		c.Check(err, IsNil)
+	}
+
+	{ // removal is confirmed by flag
+		createFlags.protected = []string{"homefs"}
+		defer func() { createFlags.protected = nil }()
+		out, err := confirm("", bp(), nil)
+		c.Check(err, IsNil)
+		c.Check(out, Equals, "")
+	}
+
+	{ // group is not re-written
+		_, err := confirm("", bp(), []config.GroupName{"primary"})
+		c.Check(err, IsNil)
+	}
+}
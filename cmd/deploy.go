@@ -16,18 +16,42 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"hpc-toolkit/pkg/config"
 	"hpc-toolkit/pkg/logging"
+	"hpc-toolkit/pkg/modulereader"
 	"hpc-toolkit/pkg/modulewriter"
 	"hpc-toolkit/pkg/shell"
+	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/gocty"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 )
 
 func addDeployFlags(c *cobra.Command) *cobra.Command {
+	c.Flags().BoolVar(&deployFlags.waitForStartup, "wait-for-startup", false,
+		"Wait for startup scripts of scheduler and login instances to finish before reporting success.")
+	c.Flags().DurationVar(&deployFlags.startupTimeout, "startup-timeout", 30*time.Minute,
+		"Maximum time to wait for startup scripts to finish, used with --wait-for-startup.")
+	c.Flags().BoolVar(&deployFlags.applyKueue, "apply-kueue", false,
+		"Apply Kueue manifests generated from GKE node pools to the cluster of the current kubectl context after deployment.")
+	c.Flags().BoolVar(&deployFlags.rebuildImages, "rebuild-images", false,
+		"Build images of Packer groups even if the latest image of the family was built from identical inputs.")
+	c.Flags().StringSliceVar(&deployFlags.planPolicy, "plan-policy", nil,
+		fmt.Sprintf("Comma-separated list of rules that plans of Terraform groups must satisfy before they are applied, any of: %s.",
+			strings.Join(shell.PlanPolicyRules(), ", ")))
+	c.Flags().StringArrayVar(&deployFlags.schedule, "schedule", nil,
+		"Defer deployment of a group to a recurring time window, as GROUP=[DAYS ]HH:MM-HH:MM in local time, "+
+			"e.g. \"gpu=Sat,Sun 01:00-05:00\". Can be used multiple times, requires --auto-approve.")
 	return addAutoApproveFlag(
 		addArtifactsDirFlag(
 			addCreateFlags(c)))
@@ -38,6 +62,15 @@ func init() {
 }
 
 var (
+	deployFlags = struct {
+		waitForStartup bool
+		startupTimeout time.Duration
+		applyKueue     bool
+		rebuildImages  bool
+		planPolicy     []string
+		schedule       []string
+	}{}
+
 	deployCmd = addDeployFlags(&cobra.Command{
 		Use:               "deploy (<DEPLOYMENT_DIRECTORY> | <BLUEPRINT_FILE>)",
 		Short:             "deploy all resources in a Toolkit deployment directory.",
@@ -58,7 +91,7 @@ func runDeployCmd(cmd *cobra.Command, args []string) {
 		deplRoot = args[0]
 		// check that no "create" flags were specified
 		cmd.Flags().VisitAll(func(f *pflag.Flag) {
-			if f.Changed && createCmd.Flag(f.Name) != nil {
+			if f.Changed && createCmd.Flag(f.Name) != nil && !isGroupFilterFlag(f.Name) {
 				checkErr(fmt.Errorf("cannot specify flag %q with DEPLOYMENT_DIRECTORY provided", f.Name), nil)
 			}
 		})
@@ -69,41 +102,162 @@ func runDeployCmd(cmd *cobra.Command, args []string) {
 func doDeploy(deplRoot string) {
 	artDir := getArtifactsDir(deplRoot)
 	checkErr(shell.CheckWritableDir(artDir), nil)
+	policy, err := shell.ParsePlanPolicy(deployFlags.planPolicy)
+	checkErr(err, nil)
 	bp, ctx := artifactBlueprintOrDie(artDir)
 	groups := bp.Groups
-	checkErr(validateRuntimeDependencies(deplRoot, groups), ctx)
+	selected, err := selectGroups(groups)
+	checkErr(err, ctx)
+	sched, err := deploySchedule(artDir, groups, selected)
+	checkErr(err, ctx)
+	if len(sched.Groups) > 0 { // deploy groups pending in the schedule
+		selected = map[config.GroupName]bool{}
+		for _, g := range sched.Groups {
+			selected[g.Group] = true
+		}
+	}
+	upstream, err := skippedUpstreamGroups(bp, selected)
+	checkErr(err, ctx)
+	used := []config.Group{}
+	for _, g := range groups {
+		if selected[g.Name] || upstream[g.Name] {
+			used = append(used, g)
+		}
+	}
+	checkErr(validateRuntimeDependencies(deplRoot, used), ctx)
+	if deployFlags.applyKueue {
+		checkErr(checkKueueManifests(deplRoot), ctx)
+	}
 	checkErr(shell.ValidateDeploymentDirectory(groups, deplRoot), ctx)
 
 	for ig, group := range groups {
 		groupDir := filepath.Join(deplRoot, string(group.Name))
-		checkErr(shell.ImportInputs(groupDir, artDir, bp), ctx)
-
-		switch group.Kind() {
-		case config.PackerKind:
-			// Packer groups are enforced to have length 1
-			subPath, e := modulewriter.DeploymentSource(group.Modules[0])
-			checkErr(e, ctx)
-			moduleDir := filepath.Join(groupDir, subPath)
-			checkErr(deployPackerGroup(moduleDir, getApplyBehavior()), ctx)
-		case config.TerraformKind:
-			checkErr(deployTerraformGroup(groupDir, artDir, getApplyBehavior()), ctx)
-		default:
-			checkErr(
-				config.BpError{
-					Err:  fmt.Errorf("group %q is an unsupported kind %q", groupDir, group.Kind()),
-					Path: config.Root.Groups.At(ig).Name}, ctx)
+		if !selected[group.Name] {
+			if upstream[group.Name] { // outputs are needed by selected groups
+				logging.Info("Exporting outputs of skipped deployment group %s", group.Name)
+				checkErr(deployTerraformGroup(groupDir, artDir, shell.NeverApply, policy), ctx)
+			}
+			continue
+		}
+		if len(sched.Groups) == 0 {
+			checkErr(deployGroup(deplRoot, artDir, bp, ig, policy), ctx)
 		}
 	}
+	if len(sched.Groups) > 0 {
+		checkErr(runDeploySchedule(artDir, bp, sched, func(ig int) error {
+			return deployGroup(deplRoot, artDir, bp, ig, policy)
+		}), ctx)
+	}
+	if deployFlags.waitForStartup {
+		checkErr(waitForStartup(bp), ctx)
+	}
+	if deployFlags.applyKueue {
+		checkErr(applyKueueManifests(deplRoot, getApplyBehavior()), ctx)
+	}
 	logging.Info("\n###############################")
 	printAdvancedInstructionsMessage(deplRoot)
 }
 
+func deployGroup(deplRoot string, artDir string, bp config.Blueprint, ig int, policy shell.PlanPolicy) error {
+	group := bp.Groups[ig]
+	groupDir := filepath.Join(deplRoot, string(group.Name))
+	if err := shell.ImportInputs(groupDir, artDir, bp); err != nil {
+		return err
+	}
+
+	switch group.Kind() {
+	case config.PackerKind:
+		// Packer groups are enforced to have length 1
+		subPath, err := modulewriter.DeploymentSource(group.Modules[0])
+		if err != nil {
+			return err
+		}
+		moduleDir := filepath.Join(groupDir, subPath)
+		return deployPackerGroup(moduleDir, packerImageCacheOf(bp, group.Modules[0], moduleDir), getApplyBehavior())
+	case config.AnsibleKind:
+		// Ansible groups are enforced to have length 1
+		mod := group.Modules[0]
+		subPath, err := modulewriter.DeploymentSource(mod)
+		if err != nil {
+			return err
+		}
+		moduleDir := filepath.Join(groupDir, subPath)
+		return deployAnsibleGroup(moduleDir, mod.ID, getApplyBehavior())
+	case config.TerraformKind:
+		return deployTerraformGroup(groupDir, artDir, getApplyBehavior(), policy)
+	default:
+		return config.BpError{
+			Err:  fmt.Errorf("group %q is an unsupported kind %q", groupDir, group.Kind()),
+			Path: config.Root.Groups.At(ig).Name}
+	}
+}
+
+// skippedUpstreamGroups returns Terraform groups that are not selected, but
+// have outputs used by selected groups
+func skippedUpstreamGroups(bp config.Blueprint, selected map[config.GroupName]bool) (map[config.GroupName]bool, error) {
+	upstream := map[config.GroupName]bool{}
+	for _, g := range bp.Groups {
+		if !selected[g.Name] {
+			continue
+		}
+		outputs, err := config.OutputNamesByGroup(g, bp)
+		if err != nil {
+			return nil, err
+		}
+		for pg, names := range outputs {
+			if len(names) == 0 || selected[pg] {
+				continue
+			}
+			if g, err := bp.Group(pg); err == nil && g.Kind() == config.TerraformKind {
+				upstream[pg] = true
+			}
+		}
+	}
+	return upstream, nil
+}
+
+func waitForStartup(bp config.Blueprint) error {
+	pid, err := deploymentProjectID(bp)
+	if err != nil {
+		return fmt.Errorf("--wait-for-startup: %w", err)
+	}
+	logging.Info("Waiting for startup scripts of %s instances to finish", strings.Join(shell.StartupRoles, ", "))
+	return shell.WaitForStartup(pid, bp.DeploymentName(), shell.StartupRoles, deployFlags.startupTimeout)
+}
+
+// checkKueueManifests errors if --apply-kueue can not be done, before anything is deployed
+func checkKueueManifests(deplRoot string) error {
+	if _, err := os.Stat(modulewriter.KueueManifestsPath(deplRoot)); err != nil {
+		return fmt.Errorf("--apply-kueue: deployment has no Kueue manifests, blueprint must have gke-node-pool modules: %w", err)
+	}
+	return shell.ConfigureKubectl()
+}
+
+func applyKueueManifests(deplRoot string, applyBehavior shell.ApplyBehavior) error {
+	path := modulewriter.KueueManifestsPath(deplRoot)
+	kctx, err := shell.KubectlContext()
+	if err != nil {
+		return err
+	}
+	c := shell.ProposedChanges{
+		Summary: fmt.Sprintf("Proposed change: use kubectl to apply %s to cluster of context %s", path, kctx),
+		Full:    fmt.Sprintf("Proposed change: use kubectl to apply %s to cluster of context %s", path, kctx),
+	}
+	if applyBehavior == shell.AutomaticApply || shell.ApplyChangesChoice(c) {
+		logging.Info("applying Kueue manifests %s to cluster of context %s", path, kctx)
+		return shell.ApplyKubernetesManifests(path)
+	}
+	return nil
+}
+
 func validateRuntimeDependencies(deplDir string, groups []config.Group) error {
 	for ig, group := range groups {
 		var err error
 		switch group.Kind() {
 		case config.PackerKind:
 			err = shell.ConfigurePacker()
+		case config.AnsibleKind:
+			err = shell.ConfigureAnsible()
 		case config.TerraformKind:
 			groupDir := filepath.Join(deplDir, string(group.Name))
 			_, err = shell.ConfigureTerraform(groupDir)
@@ -119,10 +273,150 @@ func validateRuntimeDependencies(deplDir string, groups []config.Group) error {
 	return nil
 }
 
-func deployPackerGroup(moduleDir string, applyBehavior shell.ApplyBehavior) error {
+// packerImageCache describes images built by a Packer module that can be reused
+// instead of building an image from identical inputs
+type packerImageCache struct {
+	project string
+	family  string
+	labels  map[string]string
+	refs    []string // strings of settings, that may refer to local files
+	// family of the source image and projects to look it up in, the image it
+	// resolves to at build time is an input of the build
+	sourceFamily   string
+	sourceProjects []string
+}
+
+// packerImageCacheOf returns nil if images of the module can not be reused, i.e. the
+// module does not label images or its settings are not known before deployment
+func packerImageCacheOf(bp config.Blueprint, mod config.Module, moduleDir string) *packerImageCache {
+	if deployFlags.rebuildImages {
+		return nil
+	}
+	mi, err := modulereader.Factory(config.PackerKind.String()).GetInfo(moduleDir)
+	if err != nil {
+		return nil
+	}
+	for _, in := range []string{"project_id", "image_family", "labels"} {
+		if !slices.ContainsFunc(mi.Inputs, func(v modulereader.VarInfo) bool { return v.Name == in }) {
+			return nil
+		}
+	}
+
+	cache := packerImageCache{family: bp.DeploymentName(), labels: map[string]string{}}
+	keys := mod.Settings.Keys()
+	slices.Sort(keys)
+	for _, k := range keys {
+		v, err := bp.Eval(mod.Settings.Get(k))
+		if err != nil || !v.IsWhollyKnown() {
+			return nil // refers to outputs of other groups
+		}
+		cty.Walk(v, func(_ cty.Path, v cty.Value) (bool, error) {
+			if !v.IsNull() && v.Type() == cty.String {
+				cache.refs = append(cache.refs, v.AsString())
+			}
+			return true, nil
+		})
+		switch {
+		case v.IsNull():
+		case k == "project_id":
+			err = gocty.FromCtyValue(v, &cache.project)
+		case k == "image_family":
+			err = gocty.FromCtyValue(v, &cache.family)
+		case k == "labels":
+			if v, err = convert.Convert(v, cty.Map(cty.String)); err == nil {
+				err = gocty.FromCtyValue(v, &cache.labels)
+			}
+		}
+		if err != nil {
+			return nil
+		}
+	}
+	if cache.project == "" {
+		return nil
+	}
+	if err := setSourceFamily(&cache, bp, mod, mi); err != nil {
+		return nil
+	}
+	return &cache
+}
+
+// setSourceFamily sets the source image family of the cache, unless the module
+// builds from a fixed `source_image`. Without `source_image_project_id` the family
+// is looked up in the project of the build.
+func setSourceFamily(cache *packerImageCache, bp config.Blueprint, mod config.Module, mi modulereader.ModuleInfo) error {
+	idx := slices.IndexFunc(mi.Inputs, func(v modulereader.VarInfo) bool { return v.Name == "source_image_family" })
+	if idx < 0 {
+		return nil
+	}
+	if mod.Settings.Has("source_image") {
+		if v, err := bp.Eval(mod.Settings.Get("source_image")); err != nil || !v.IsNull() {
+			return err // fixed image is hashed as a setting
+		}
+	}
+	if mod.Settings.Has("source_image_family") {
+		v, err := bp.Eval(mod.Settings.Get("source_image_family"))
+		if err == nil && !v.IsNull() {
+			err = gocty.FromCtyValue(v, &cache.sourceFamily)
+		}
+		if err != nil {
+			return err
+		}
+	} else if def, ok := mi.Inputs[idx].Default.(string); ok {
+		cache.sourceFamily = def
+	}
+	cache.sourceProjects = []string{cache.project}
+	if mod.Settings.Has("source_image_project_id") {
+		v, err := bp.Eval(mod.Settings.Get("source_image_project_id"))
+		if err != nil {
+			return err
+		}
+		if !v.IsNull() {
+			if v, err = convert.Convert(v, cty.List(cty.String)); err != nil {
+				return err
+			}
+			if err := gocty.FromCtyValue(v, &cache.sourceProjects); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func deployPackerGroup(moduleDir string, cache *packerImageCache, applyBehavior shell.ApplyBehavior) error {
 	if err := shell.ConfigurePacker(); err != nil {
 		return err
 	}
+	buildArgs := []string{"build"}
+	source := ""
+	if cache != nil && cache.sourceFamily != "" {
+		var err error
+		if source, err = shell.ResolveImageFamily(cache.sourceProjects, cache.sourceFamily); err != nil {
+			// e.g. public images that Packer finds without source_image_project_id
+			logging.Error("failed to resolve source image family, building a new image: %v", err)
+			cache = nil
+		}
+	}
+	if cache != nil {
+		hash, err := shell.PackerInputsHash(moduleDir, cache.refs, source)
+		if err != nil {
+			return err
+		}
+		img, err := shell.FindCachedImage(cache.project, cache.family, hash)
+		if err != nil {
+			logging.Error("failed to look up image built from identical inputs, building a new image: %v", err)
+		} else if img != "" {
+			logging.Info("skipping build of image in %s, image %s of family %s was built from identical inputs", moduleDir, img, cache.family)
+			return nil
+		}
+		labels := maps.Clone(cache.labels)
+		labels[shell.PackerImageHashLabel] = hash
+		js, err := json.Marshal(labels)
+		if err != nil {
+			return err
+		}
+		buildArgs = append(buildArgs, "-var", "labels="+string(js))
+	}
+
 	c := shell.ProposedChanges{
 		Summary: fmt.Sprintf("Proposed change: use packer to build image in %s", moduleDir),
 		Full:    fmt.Sprintf("Proposed change: use packer to build image in %s", moduleDir),
@@ -138,17 +432,32 @@ func deployPackerGroup(moduleDir string, applyBehavior shell.ApplyBehavior) erro
 			return err
 		}
 		logging.Info("building image using packer module at %s", moduleDir)
-		if err := shell.ExecPackerCmd(moduleDir, true, "build", "."); err != nil {
+		if err := shell.ExecPackerCmd(moduleDir, true, append(buildArgs, ".")...); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func deployTerraformGroup(groupDir string, artifactsDir string, applyBehavior shell.ApplyBehavior) error {
+func deployAnsibleGroup(moduleDir string, id config.ModuleID, applyBehavior shell.ApplyBehavior) error {
+	if err := shell.ConfigureAnsible(); err != nil {
+		return err
+	}
+	c := shell.ProposedChanges{
+		Summary: fmt.Sprintf("Proposed change: use ansible to run playbook in %s", moduleDir),
+		Full:    fmt.Sprintf("Proposed change: use ansible to run playbook in %s", moduleDir),
+	}
+	if applyBehavior == shell.AutomaticApply || shell.ApplyChangesChoice(c) {
+		logging.Info("running ansible playbook at %s", moduleDir)
+		return shell.ExecAnsiblePlaybook(moduleDir, modulewriter.AnsiblePlaybookArgs(id, moduleDir)...)
+	}
+	return nil
+}
+
+func deployTerraformGroup(groupDir string, artifactsDir string, applyBehavior shell.ApplyBehavior, policy shell.PlanPolicy) error {
 	tf, err := shell.ConfigureTerraform(groupDir)
 	if err != nil {
 		return err
 	}
-	return shell.ExportOutputs(tf, artifactsDir, applyBehavior)
+	return shell.ExportOutputs(tf, artifactsDir, applyBehavior, policy)
 }
@@ -17,9 +17,13 @@ limitations under the License.
 package cmd
 
 import (
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/modulereader"
 	"hpc-toolkit/pkg/shell"
 	"os"
+	"path/filepath"
 
+	"github.com/zclconf/go-cty/cty"
 	. "gopkg.in/check.v1"
 )
 
@@ -28,11 +32,173 @@ func (s *MySuite) TestDeployGroups(c *C) {
 	pathEnv := os.Getenv("PATH")
 	os.Setenv("PATH", "")
 
-	err = deployTerraformGroup(".", getArtifactsDir("."), shell.NeverApply)
+	err = deployTerraformGroup(".", getArtifactsDir("."), shell.NeverApply, shell.PlanPolicy{})
 	c.Check(err, NotNil)
 
-	err = deployPackerGroup(".", shell.NeverApply)
+	err = deployPackerGroup(".", nil, shell.NeverApply)
 	c.Check(err, NotNil)
 
 	os.Setenv("PATH", pathEnv)
 }
+
+func (s *MySuite) TestSelectGroups(c *C) {
+	defer func() { flagOnlyGroups, flagSkipGroups = nil, nil }()
+	groups := []config.Group{{Name: "net"}, {Name: "image"}, {Name: "compute"}}
+
+	{ // all groups by default
+		got, err := selectGroups(groups)
+		c.Check(err, IsNil)
+		c.Check(got, DeepEquals, map[config.GroupName]bool{"net": true, "image": true, "compute": true})
+	}
+
+	{ // --only
+		flagOnlyGroups, flagSkipGroups = []string{"compute"}, nil
+		got, err := selectGroups(groups)
+		c.Check(err, IsNil)
+		c.Check(got, DeepEquals, map[config.GroupName]bool{"net": false, "image": false, "compute": true})
+	}
+
+	{ // --skip
+		flagOnlyGroups, flagSkipGroups = nil, []string{"net", "image"}
+		got, err := selectGroups(groups)
+		c.Check(err, IsNil)
+		c.Check(got, DeepEquals, map[config.GroupName]bool{"net": false, "image": false, "compute": true})
+	}
+
+	{ // unknown group
+		flagOnlyGroups, flagSkipGroups = []string{"storage"}, nil
+		_, err := selectGroups(groups)
+		c.Check(err, ErrorMatches, `deployment group "storage" is not found.*net, image, compute.*`)
+	}
+}
+
+func (s *MySuite) TestSkippedUpstreamGroups(c *C) {
+	tf := func(id config.ModuleID, outputs ...string) config.Module {
+		m := config.Module{ID: id, Kind: config.TerraformKind}
+		for _, o := range outputs {
+			m.Outputs = append(m.Outputs, modulereader.OutputInfo{Name: o})
+		}
+		return m
+	}
+	compute := tf("nodes")
+	compute.Settings = config.NewDict(map[string]cty.Value{
+		"network": config.ModuleRef("vpc", "network_id").AsValue()})
+	bp := config.Blueprint{Groups: []config.Group{
+		{Name: "net", Modules: []config.Module{tf("vpc", "network_id")}},
+		{Name: "fs", Modules: []config.Module{tf("nfs", "mount")}},
+		{Name: "compute", Modules: []config.Module{compute}},
+	}}
+
+	{ // outputs of skipped "net" are used by "compute"
+		got, err := skippedUpstreamGroups(bp, map[config.GroupName]bool{"compute": true})
+		c.Check(err, IsNil)
+		c.Check(got, DeepEquals, map[config.GroupName]bool{"net": true})
+	}
+
+	{ // "net" is deployed itself
+		got, err := skippedUpstreamGroups(bp, map[config.GroupName]bool{"net": true, "compute": true})
+		c.Check(err, IsNil)
+		c.Check(got, DeepEquals, map[config.GroupName]bool{})
+	}
+}
+
+func (s *MySuite) TestPackerImageCacheOf(c *C) {
+	dir := c.MkDir()
+	vars := `
+variable "project_id" { type = string }
+variable "image_family" {
+  type    = string
+  default = null
+}
+variable "labels" { type = map(string) }
+`
+	c.Assert(os.WriteFile(filepath.Join(dir, "variables.pkr.hcl"), []byte(vars), 0644), IsNil)
+	srcDir := c.MkDir()
+	c.Assert(os.WriteFile(filepath.Join(srcDir, "variables.pkr.hcl"), []byte(vars+`
+variable "source_image" {
+  type    = string
+  default = null
+}
+variable "source_image_family" {
+  type    = string
+  default = "hpc-centos-7"
+}
+variable "source_image_project_id" {
+  type    = list(string)
+  default = null
+}
+`), 0644), IsNil)
+	bp := config.Blueprint{Vars: config.NewDict(map[string]cty.Value{
+		"deployment_name": cty.StringVal("golf"),
+		"project_id":      cty.StringVal("test-project")})}
+	mod := func(settings map[string]cty.Value) config.Module {
+		return config.Module{ID: "image", Kind: config.PackerKind, Settings: config.NewDict(settings)}
+	}
+
+	{ // family defaults to deployment name
+		got := packerImageCacheOf(bp, mod(map[string]cty.Value{
+			"project_id":    config.GlobalRef("project_id").AsValue(),
+			"labels":        cty.ObjectVal(map[string]cty.Value{"ghpc_deployment": cty.StringVal("golf")}),
+			"shell_scripts": cty.TupleVal([]cty.Value{cty.StringVal("install.sh")})}), dir)
+		c.Check(got, DeepEquals, &packerImageCache{
+			project: "test-project",
+			family:  "golf",
+			labels:  map[string]string{"ghpc_deployment": "golf"},
+			refs:    []string{"golf", "test-project", "install.sh"}})
+	}
+
+	{ // explicit family
+		got := packerImageCacheOf(bp, mod(map[string]cty.Value{
+			"project_id":   cty.StringVal("test-project"),
+			"image_family": cty.StringVal("rocky")}), dir)
+		c.Assert(got, NotNil)
+		c.Check(got.family, Equals, "rocky")
+	}
+
+	{ // source image family and projects
+		got := packerImageCacheOf(bp, mod(map[string]cty.Value{
+			"project_id":              cty.StringVal("test-project"),
+			"source_image_family":     cty.StringVal("hpc-rocky-linux-8"),
+			"source_image_project_id": cty.TupleVal([]cty.Value{cty.StringVal("cloud-hpc-image-public")})}), srcDir)
+		c.Assert(got, NotNil)
+		c.Check(got.sourceFamily, Equals, "hpc-rocky-linux-8")
+		c.Check(got.sourceProjects, DeepEquals, []string{"cloud-hpc-image-public"})
+	}
+
+	{ // default source image family is looked up in the project of the build
+		got := packerImageCacheOf(bp, mod(map[string]cty.Value{
+			"project_id": cty.StringVal("test-project")}), srcDir)
+		c.Assert(got, NotNil)
+		c.Check(got.sourceFamily, Equals, "hpc-centos-7")
+		c.Check(got.sourceProjects, DeepEquals, []string{"test-project"})
+	}
+
+	{ // fixed source image is not resolved
+		got := packerImageCacheOf(bp, mod(map[string]cty.Value{
+			"project_id":   cty.StringVal("test-project"),
+			"source_image": cty.StringVal("hpc-rocky-linux-8-v20240126")}), srcDir)
+		c.Assert(got, NotNil)
+		c.Check(got.sourceFamily, Equals, "")
+	}
+
+	{ // settings refer to other groups
+		got := packerImageCacheOf(bp, mod(map[string]cty.Value{
+			"project_id": cty.StringVal("test-project"),
+			"subnetwork": config.ModuleRef("network", "subnetwork_name").AsValue()}), dir)
+		c.Check(got, IsNil)
+	}
+
+	{ // module does not label images
+		got := packerImageCacheOf(bp, mod(map[string]cty.Value{
+			"project_id": cty.StringVal("test-project")}), c.MkDir())
+		c.Check(got, IsNil)
+	}
+
+	{ // --rebuild-images
+		deployFlags.rebuildImages = true
+		defer func() { deployFlags.rebuildImages = false }()
+		got := packerImageCacheOf(bp, mod(map[string]cty.Value{
+			"project_id": cty.StringVal("test-project")}), dir)
+		c.Check(got, IsNil)
+	}
+}
@@ -16,23 +16,34 @@
 package cmd
 
 import (
+	"bufio"
 	"fmt"
 	"hpc-toolkit/pkg/config"
 	"hpc-toolkit/pkg/modulewriter"
 	"hpc-toolkit/pkg/shell"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
 )
 
 func init() {
+	destroyCmd.Flags().StringSliceVar(&destroyFlags.protected, "destroy-protected", nil,
+		"Comma-separated list of IDs of modules with destroy protection to destroy, confirms their destruction without prompting.")
 	rootCmd.AddCommand(
 		addAutoApproveFlag(
-			addArtifactsDirFlag(destroyCmd)))
+			addArtifactsDirFlag(
+				addGroupFilterFlags(destroyCmd))))
 }
 
 var (
+	destroyFlags = struct {
+		protected []string
+	}{}
+
 	destroyCmd = &cobra.Command{
 		Use:               "destroy DEPLOYMENT_DIRECTORY",
 		Short:             "destroy all resources in a Toolkit deployment directory.",
@@ -55,11 +66,16 @@ func runDestroyCmd(cmd *cobra.Command, args []string) {
 	bp, ctx := artifactBlueprintOrDie(artifactsDir)
 
 	checkErr(shell.ValidateDeploymentDirectory(bp.Groups, deplRoot), ctx)
+	selected, err := selectGroups(bp.Groups)
+	checkErr(err, ctx)
 
 	// destroy in reverse order of creation!
 	packerManifests := []string{}
 	for i := len(bp.Groups) - 1; i >= 0; i-- {
 		group := bp.Groups[i]
+		if !selected[group.Name] {
+			continue
+		}
 		groupDir := filepath.Join(deplRoot, string(group.Name))
 
 		var err error
@@ -69,8 +85,10 @@ func runDestroyCmd(cmd *cobra.Command, args []string) {
 			// TODO: destroyPackerGroup(moduleDir)
 			moduleDir := filepath.Join(groupDir, string(group.Modules[0].ID))
 			packerManifests = append(packerManifests, filepath.Join(moduleDir, "packer-manifest.json"))
+		case config.AnsibleKind:
+			// playbooks do not create infrastructure managed by the toolkit
 		case config.TerraformKind:
-			err = destroyTerraformGroup(groupDir)
+			err = destroyTerraformGroup(groupDir, group)
 		default:
 			err = fmt.Errorf("group %s is an unsupported kind %s", groupDir, group.Kind().String())
 		}
@@ -80,11 +98,69 @@ func runDestroyCmd(cmd *cobra.Command, args []string) {
 	modulewriter.WritePackerDestroyInstructions(os.Stdout, packerManifests)
 }
 
-func destroyTerraformGroup(groupDir string) error {
+func destroyTerraformGroup(groupDir string, g config.Group) error {
 	tf, err := shell.ConfigureTerraform(groupDir)
 	if err != nil {
 		return err
 	}
 
+	if ids := protectedModules(g); len(ids) > 0 {
+		if err := confirmDestroyProtected(bufio.NewReader(os.Stdin), os.Stdout, g.Name, ids, destroyFlags.protected); err != nil {
+			return err
+		}
+		addrs := []string{}
+		for _, id := range ids {
+			addrs = append(addrs, modulewriter.DestroyProtectionAddress(id))
+		}
+		// guards are recreated by the next apply if destruction is not approved
+		if err := shell.RemoveFromState(tf, addrs); err != nil {
+			return err
+		}
+	}
+
 	return shell.Destroy(tf, getApplyBehavior())
 }
+
+// protectedModules returns IDs of modules of the group with destroy protection
+func protectedModules(g config.Group) []config.ModuleID {
+	ids := []config.ModuleID{}
+	for _, m := range g.Modules {
+		if m.DestroyProtection {
+			ids = append(ids, m.ID)
+		}
+	}
+	return ids
+}
+
+// confirmDestroyProtected asks to type IDs of modules with destroy protection to confirm
+// their destruction, modules listed in confirmed do not need to be typed
+func confirmDestroyProtected(in *bufio.Reader, out io.Writer, group config.GroupName, ids []config.ModuleID, confirmed []string) error {
+	pending := []string{}
+	for _, id := range ids {
+		if !slices.Contains(confirmed, string(id)) {
+			pending = append(pending, string(id))
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(out, "Deployment group %s has modules with destroy protection: %s\n", group, strings.Join(pending, ", "))
+	fmt.Fprint(out, "Type their IDs, separated by commas, to confirm destruction: ")
+	s, _ := in.ReadString('\n') // read errors leave destruction unconfirmed
+	typed := []string{}
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			typed = append(typed, t)
+		}
+	}
+	slices.Sort(typed)
+	want := slices.Clone(pending)
+	slices.Sort(want)
+	if !slices.Equal(slices.Compact(typed), want) {
+		return config.HintError{
+			Hint: "type IDs of all protected modules, or list them with --destroy-protected",
+			Err:  fmt.Errorf("destruction of modules %s with destroy protection was not confirmed", strings.Join(pending, ", "))}
+	}
+	return nil
+}
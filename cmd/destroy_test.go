@@ -0,0 +1,68 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"hpc-toolkit/pkg/config"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestProtectedModules(c *C) {
+	g := config.Group{Name: "primary", Modules: []config.Module{
+		{ID: "network1"}, {ID: "homefs", DestroyProtection: true}, {ID: "db", DestroyProtection: true}}}
+	c.Check(protectedModules(g), DeepEquals, []config.ModuleID{"homefs", "db"})
+	c.Check(protectedModules(config.Group{Modules: []config.Module{{ID: "network1"}}}), DeepEquals, []config.ModuleID{})
+}
+
+func (s *MySuite) TestConfirmDestroyProtected(c *C) {
+	ids := []config.ModuleID{"homefs", "db"}
+	confirm := func(input string, confirmed []string) (string, error) {
+		var out bytes.Buffer
+		err := confirmDestroyProtected(bufio.NewReader(strings.NewReader(input)), &out, "primary", ids, confirmed)
+		return out.String(), err
+	}
+
+	{ // typed IDs in any order
+		out, err := confirm("db, homefs\n", nil)
+		c.Check(err, IsNil)
+		c.Check(out, Matches, `(?s)Deployment group primary has modules with destroy protection: homefs, db\n.*`)
+	}
+
+	{ // confirmed by flag, no prompt
+		out, err := confirm("", []string{"homefs", "db"})
+		c.Check(err, IsNil)
+		c.Check(out, Equals, "")
+	}
+
+	{ // only modules not confirmed by flag are prompted
+		out, err := confirm("db", []string{"homefs"})
+		c.Check(err, IsNil)
+		c.Check(out, Matches, `(?s).*destroy protection: db\n.*`)
+	}
+
+	{ // missing module
+		_, err := confirm("homefs\n", nil)
+		c.Check(err, ErrorMatches, `(?s).*destruction of modules homefs, db with destroy protection was not confirmed.*`)
+	}
+
+	{ // no input
+		_, err := confirm("", nil)
+		c.Check(err, NotNil)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmd defines command line utilities for ghpc
+package cmd
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/maps"
+)
+
+func init() {
+	rootCmd.AddCommand(diffBlueprintsCmd)
+}
+
+var diffBlueprintsCmd = &cobra.Command{
+	Use:   "diff-blueprints BLUEPRINT_A BLUEPRINT_B",
+	Short: "Compare two blueprints after expansion.",
+	Long: "Expand two blueprints and report differences in deployment variables, modules, " +
+		"module settings and validators.",
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: filterYaml,
+	Run:               runDiffBlueprintsCmd,
+	SilenceUsage:      true,
+}
+
+func runDiffBlueprintsCmd(cmd *cobra.Command, args []string) {
+	a, _ := expandWithoutValidationOrDie(args[0])
+	b, _ := expandWithoutValidationOrDie(args[1])
+	diff := diffBlueprints(a, b)
+	if len(diff) == 0 {
+		fmt.Println("No differences.")
+		return
+	}
+	fmt.Println(strings.Join(diff, "\n"))
+}
+
+func renderValue(v cty.Value) string {
+	return strings.TrimSpace(string(config.TokensForValue(v).Bytes()))
+}
+
+// diffDicts returns added (+), removed (-) and changed (~) entries of dictionaries
+func diffDicts(a config.Dict, b config.Dict, indent string) []string {
+	res := []string{}
+	am, bm := a.Items(), b.Items()
+	keys := append(maps.Keys(am), maps.Keys(bm)...)
+	sort.Strings(keys)
+	for i, k := range keys {
+		if i > 0 && keys[i-1] == k {
+			continue // deduplicate
+		}
+		av, inA := am[k]
+		bv, inB := bm[k]
+		switch {
+		case !inA:
+			res = append(res, fmt.Sprintf("%s+ %s = %s", indent, k, renderValue(bv)))
+		case !inB:
+			res = append(res, fmt.Sprintf("%s- %s = %s", indent, k, renderValue(av)))
+		case renderValue(av) != renderValue(bv):
+			res = append(res, fmt.Sprintf("%s~ %s: %s -> %s", indent, k, renderValue(av), renderValue(bv)))
+		}
+	}
+	return res
+}
+
+type moduleInGroup struct {
+	group config.GroupName
+	mod   config.Module
+}
+
+func modulesByID(bp config.Blueprint) map[config.ModuleID]moduleInGroup {
+	res := map[config.ModuleID]moduleInGroup{}
+	for _, g := range bp.Groups {
+		for _, m := range g.Modules {
+			res[m.ID] = moduleInGroup{g.Name, m}
+		}
+	}
+	return res
+}
+
+func diffModule(a moduleInGroup, b moduleInGroup) []string {
+	res := []string{}
+	change := func(what string, av string, bv string) {
+		if av != bv {
+			res = append(res, fmt.Sprintf("    ~ %s: %s -> %s", what, av, bv))
+		}
+	}
+	change("group", string(a.group), string(b.group))
+	change("source", a.mod.Source, b.mod.Source)
+	change("kind", a.mod.Kind.String(), b.mod.Kind.String())
+	return append(res, diffDicts(a.mod.Settings, b.mod.Settings, "    ")...)
+}
+
+func diffModules(a config.Blueprint, b config.Blueprint) []string {
+	res := []string{}
+	am, bm := modulesByID(a), modulesByID(b)
+	ids := append(maps.Keys(am), maps.Keys(bm)...)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for i, id := range ids {
+		if i > 0 && ids[i-1] == id {
+			continue // deduplicate
+		}
+		ma, inA := am[id]
+		mb, inB := bm[id]
+		switch {
+		case !inA:
+			res = append(res, fmt.Sprintf("  + %s (group %s, source %s)", id, mb.group, mb.mod.Source))
+		case !inB:
+			res = append(res, fmt.Sprintf("  - %s (group %s, source %s)", id, ma.group, ma.mod.Source))
+		default:
+			if d := diffModule(ma, mb); len(d) > 0 {
+				res = append(res, fmt.Sprintf("  ~ %s", id))
+				res = append(res, d...)
+			}
+		}
+	}
+	return res
+}
+
+func renderValidator(v config.Validator) string {
+	s := v.Validator
+	if !v.Inputs.IsZero() {
+		s += " " + renderValue(v.Inputs.AsObject())
+	}
+	if v.Skip {
+		s += " (skipped)"
+	}
+	return s
+}
+
+func diffValidators(a config.Blueprint, b config.Blueprint) []string {
+	count := map[string]int{}
+	for _, v := range a.Validators {
+		count[renderValidator(v)]--
+	}
+	for _, v := range b.Validators {
+		count[renderValidator(v)]++
+	}
+	keys := maps.Keys(count)
+	sort.Strings(keys)
+	res := []string{}
+	for _, k := range keys {
+		for ; count[k] > 0; count[k]-- {
+			res = append(res, "  + "+k)
+		}
+		for ; count[k] < 0; count[k]++ {
+			res = append(res, "  - "+k)
+		}
+	}
+	return res
+}
+
+// diffBlueprints returns human-readable differences between two expanded blueprints
+func diffBlueprints(a config.Blueprint, b config.Blueprint) []string {
+	res := []string{}
+	section := func(title string, lines []string) {
+		if len(lines) > 0 {
+			res = append(res, title+":")
+			res = append(res, lines...)
+		}
+	}
+	section("vars", diffDicts(a.Vars, b.Vars, "  "))
+	section("modules", diffModules(a, b))
+	section("validators", diffValidators(a, b))
+	return res
+}
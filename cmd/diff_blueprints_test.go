@@ -0,0 +1,73 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"hpc-toolkit/pkg/config"
+
+	"github.com/zclconf/go-cty/cty"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestDiffBlueprints(c *C) {
+	a := config.Blueprint{
+		Vars: config.NewDict(map[string]cty.Value{
+			"project_id": cty.StringVal("pink"),
+			"zone":       cty.StringVal("us-central1-a"),
+		}),
+		Groups: []config.Group{{Name: "primary", Modules: []config.Module{
+			{ID: "network", Source: "modules/network/vpc"},
+			{ID: "homefs", Source: "modules/file-system/filestore", Settings: config.NewDict(map[string]cty.Value{
+				"local_mount": cty.StringVal("/home"),
+				"zone":        config.GlobalRef("zone").AsValue(),
+			})},
+		}}},
+		Validators: []config.Validator{{Validator: "test_project_exists"}},
+	}
+
+	{ // no differences
+		c.Check(diffBlueprints(a, a), HasLen, 0)
+	}
+
+	{ // differences
+		b := a
+		b.Vars = b.Vars.With("zone", cty.StringVal("us-east4-a")).With("region", cty.StringVal("us-east4"))
+		b.Groups = []config.Group{{Name: "primary", Modules: []config.Module{
+			{ID: "homefs", Source: "modules/file-system/filestore", Settings: config.NewDict(map[string]cty.Value{
+				"local_mount": cty.StringVal("/home2"),
+				"size_gb":     cty.NumberIntVal(2048),
+			})},
+		}}, {Name: "compute", Modules: []config.Module{
+			{ID: "vm", Source: "modules/compute/vm-instance"},
+		}}}
+		b.Validators = []config.Validator{{Validator: "test_project_exists", Skip: true}}
+
+		c.Check(diffBlueprints(a, b), DeepEquals, []string{
+			"vars:",
+			`  + region = "us-east4"`,
+			`  ~ zone: "us-central1-a" -> "us-east4-a"`,
+			"modules:",
+			"  ~ homefs",
+			`    ~ local_mount: "/home" -> "/home2"`,
+			"    + size_gb = 2048",
+			"    - zone = var.zone",
+			"  - network (group primary, source modules/network/vpc)",
+			"  + vm (group compute, source modules/compute/vm-instance)",
+			"validators:",
+			"  - test_project_exists",
+			"  + test_project_exists (skipped)",
+		})
+	}
+}
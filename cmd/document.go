@@ -0,0 +1,75 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"hpc-toolkit/pkg/catalog"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	documentCmd.Flags().StringVar(&documentFlags.format, "format", "markdown",
+		"Output format, one of \"markdown\" or \"json\".")
+	documentCmd.Flags().StringVarP(&documentFlags.out, "out", "o", "",
+		"Path of the file to write. Defaults to standard output.")
+	rootCmd.AddCommand(documentCmd)
+}
+
+var (
+	documentFlags = struct {
+		format string
+		out    string
+	}{}
+
+	documentCmd = &cobra.Command{
+		Use:   "document BLUEPRINT_FILE",
+		Short: "Generate user-facing documentation of a blueprint.",
+		Long: "Expand the blueprint and document its deployment variables with types, defaults and descriptions, " +
+			"services and permissions required to deploy it, outputs of its modules and an estimated range of " +
+			"its monthly cost, in Markdown or JSON, e.g. for publishing the blueprint in a service catalog.",
+		Args:              cobra.MatchAll(cobra.ExactArgs(1), checkExists),
+		ValidArgsFunction: filterYaml,
+		Run:               runDocumentCmd,
+		SilenceUsage:      true,
+	}
+)
+
+func runDocumentCmd(cmd *cobra.Command, args []string) {
+	bp, ctx, required := expandWithPlaceholdersOrDie(args[0])
+	out, err := renderDocument(catalog.New(bp, required), documentFlags.format)
+	checkErr(err, ctx)
+	if documentFlags.out == "" {
+		_, err = os.Stdout.Write(out)
+	} else {
+		err = os.WriteFile(documentFlags.out, out, 0644)
+	}
+	checkErr(err, ctx)
+}
+
+func renderDocument(doc catalog.Document, format string) ([]byte, error) {
+	switch format {
+	case "markdown":
+		return []byte(doc.Markdown()), nil
+	case "json":
+		b, err := json.MarshalIndent(doc, "", "  ")
+		return append(b, '\n'), err
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected one of markdown, json", format)
+	}
+}
@@ -16,15 +16,20 @@
 package cmd
 
 import (
+	"hpc-toolkit/pkg/config"
 	"hpc-toolkit/pkg/logging"
+	"hpc-toolkit/pkg/validators"
 
 	"github.com/spf13/cobra"
+	"github.com/zclconf/go-cty/cty"
 )
 
 func addExpandFlags(c *cobra.Command, addOutFlag bool) *cobra.Command {
 	if addOutFlag {
 		c.Flags().StringVarP(&expandFlags.outputPath, "out", "o", "expanded.yaml",
 			"Output file for the expanded HPC Environment Definition.")
+		c.Flags().BoolVar(&expandFlags.resolveDefaults, "resolve-defaults", false,
+			"Set module inputs that are not set to defaults of the modules, marked with a comment.")
 	}
 
 	c.Flags().StringVarP(&expandFlags.deploymentFile, "deployment-file", "d", "",
@@ -32,11 +37,33 @@ func addExpandFlags(c *cobra.Command, addOutFlag bool) *cobra.Command {
 
 	c.Flags().StringSliceVar(&expandFlags.cliVariables, "vars", nil,
 		"Comma-separated list of name=value variables to override YAML configuration. Can be used multiple times.")
+	c.Flags().BoolVar(&expandFlags.noGcloudDefaults, "no-gcloud-defaults", false,
+		"Do not set project_id, region and zone that have no value to properties of the active gcloud configuration.")
+	c.Flags().BoolVar(&expandFlags.prompt, "prompt", false,
+		"Interactively ask for values of deployment variables and required module inputs that are not set.")
 	c.Flags().StringSliceVar(&expandFlags.cliBEConfigVars, "backend-config", nil,
 		"Comma-separated list of name=value variables to set Terraform backend configuration. Can be used multiple times.")
 	c.Flags().StringVarP(&expandFlags.validationLevel, "validation-level", "l", "ERROR",
 		"Set validation level to one of (\"ERROR\", \"WARNING\", \"IGNORE\")")
 	c.Flags().StringSliceVar(&expandFlags.validatorsToSkip, "skip-validators", nil, "Validators to skip")
+	c.Flags().BoolVar(&validators.NoCache, "no-cache", false,
+		"Do not use results of project, region, zone and machine type lookups of validators cached in ~/.ghpc/cache.")
+	c.Flags().BoolVar(&validators.Offline, "offline", false,
+		"Skip validators that call Google Cloud APIs, other validators still run.")
+	c.Flags().BoolVar(&validators.AllowCustom, "allow-custom-validators", false,
+		"Run executables of custom validators of the blueprint, they are skipped otherwise.")
+	c.Flags().DurationVar(&validators.DefaultTimeout, "validator-timeout", validators.DefaultTimeout,
+		"Time limit of each validator that does not set a timeout, 0 for no limit.")
+	c.Flags().StringVar(&expandFlags.sarifPath, "sarif", "",
+		"Write blueprint and validator findings to this file in SARIF format.")
+	c.Flags().StringVar(&quotaRequestsPath, "quota-requests", "",
+		"Write increases of quotas that the deployment would exceed to this file as a JSON array.")
+	c.Flags().BoolVar(&expandFlags.profile, "profile", false,
+		"Report time spent in parsing, module info retrieval, expansion, validation and writing.")
+	c.Flags().StringVar(&expandFlags.cpuProfile, "cpu-profile", "",
+		"Write pprof CPU profile to this file.")
+	c.Flags().StringVar(&metricsPath, "metrics-file", "",
+		"Write metrics of the run to this file in the Prometheus text format, e.g. for the textfile collector of node exporter.")
 	return c
 }
 
@@ -47,11 +74,17 @@ func init() {
 var (
 	expandFlags = struct {
 		outputPath       string
+		resolveDefaults  bool
 		deploymentFile   string
 		cliVariables     []string
+		noGcloudDefaults bool
+		prompt           bool
 		cliBEConfigVars  []string
 		validationLevel  string
 		validatorsToSkip []string
+		sarifPath        string
+		profile          bool
+		cpuProfile       string
 	}{}
 
 	expandCmd = addExpandFlags(&cobra.Command{
@@ -66,6 +99,41 @@ var (
 
 func runExpandCmd(cmd *cobra.Command, args []string) {
 	bp, ctx := expandOrDie(args[0])
-	checkErr(bp.Export(expandFlags.outputPath), ctx)
+	if expandFlags.resolveDefaults {
+		added, err := bp.ResolveDefaults()
+		checkErr(err, ctx)
+		comments := map[string]string{}
+		for _, p := range added {
+			comments[p.String()] = config.ModuleDefaultComment
+		}
+		checkErr(bp.ExportWithComments(expandFlags.outputPath, comments), ctx)
+	} else {
+		checkErr(bp.Export(expandFlags.outputPath), ctx)
+	}
 	logging.Info(boldGreen("Expanded Environment Definition created successfully, saved as %s."), expandFlags.outputPath)
 }
+
+// expandWithoutValidationOrDie expands the blueprint without running validators
+func expandWithoutValidationOrDie(path string) (config.Blueprint, *config.YamlCtx) {
+	bp, ctx, err := config.NewBlueprint(path)
+	checkErr(err, ctx)
+	checkErr(bp.Expand(), ctx)
+	return bp, ctx
+}
+
+// expandWithPlaceholdersOrDie expands the blueprint without running validators,
+// deployment variables without value are set to empty strings. Returns names of
+// these variables, which must be set on deployment.
+func expandWithPlaceholdersOrDie(path string) (config.Blueprint, *config.YamlCtx, []string) {
+	bp, ctx, err := config.NewBlueprint(path)
+	checkErr(err, ctx)
+	unset := []string{}
+	for _, k := range bp.Vars.Keys() {
+		if bp.Vars.Get(k).IsNull() {
+			unset = append(unset, k)
+			bp.Vars = bp.Vars.With(k, cty.StringVal(""))
+		}
+	}
+	checkErr(bp.Expand(), ctx)
+	return bp, ctx, unset
+}
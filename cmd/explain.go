@@ -0,0 +1,97 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmd defines command line utilities for ghpc
+package cmd
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/validators"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	explainCmd.Flags().BoolVar(&explainFlags.markdown, "markdown", false,
+		"Print reference of all error codes in Markdown format.")
+	rootCmd.AddCommand(explainCmd)
+}
+
+var (
+	explainFlags = struct {
+		markdown bool
+	}{}
+
+	explainCmd = &cobra.Command{
+		Use:   "explain [ERROR_CODE]",
+		Short: "Explain an error code, e.g. GHPC1007.",
+		Long: "Explain an error code reported by ghpc, e.g. GHPC1007. " +
+			"Use --markdown to print reference of all error codes.",
+		Args:         cobra.MaximumNArgs(1),
+		Run:          runExplainCmd,
+		SilenceUsage: true,
+	}
+)
+
+const errorCodesDoc = "https://github.com/GoogleCloudPlatform/hpc-toolkit/blob/main/docs/error-codes.md"
+
+func runExplainCmd(cmd *cobra.Command, args []string) {
+	if explainFlags.markdown {
+		fmt.Print(errorCodesMarkdown())
+		return
+	}
+	if len(args) == 0 {
+		checkErr(fmt.Errorf("error code is required, e.g. `ghpc explain GHPC1007`"), nil)
+	}
+	code := config.ErrorCode(strings.ToUpper(strings.TrimSpace(args[0])))
+	info, ok := errorCodeInfo(code)
+	if !ok {
+		checkErr(fmt.Errorf("unknown error code %q, see %s", args[0], errorCodesDoc), nil)
+	}
+	fmt.Printf("%s: %s\n\n%s\n\nSee %s\n", boldRed(string(info.Code)), info.Title, info.Explanation, errorCodeURL(code))
+}
+
+// errorCodes returns documentation of all known error codes
+func errorCodes() []config.ErrorCodeInfo {
+	return append(config.ErrorCodes(), validators.ErrorCodes()...)
+}
+
+func errorCodeInfo(code config.ErrorCode) (config.ErrorCodeInfo, bool) {
+	for _, info := range errorCodes() {
+		if info.Code == code {
+			return info, true
+		}
+	}
+	return config.ErrorCodeInfo{}, false
+}
+
+func errorCodeURL(code config.ErrorCode) string {
+	return fmt.Sprintf("%s#%s", errorCodesDoc, strings.ToLower(string(code)))
+}
+
+// errorCodesMarkdown renders reference of all error codes, see docs/error-codes.md
+func errorCodesMarkdown() string {
+	sb := strings.Builder{}
+	sb.WriteString("<!-- Generated by `ghpc explain --markdown`, do not edit. -->\n")
+	sb.WriteString("# Error codes\n\n")
+	sb.WriteString("Errors reported by `ghpc` are identified by stable codes, e.g. `GHPC1007`.\n")
+	sb.WriteString("Codes `GHPC1xxx` are blueprint errors, codes `GHPC2xxx` are validator failures.\n")
+	sb.WriteString("Run `ghpc explain CODE` to print the explanation of a code.\n")
+	for _, info := range errorCodes() {
+		fmt.Fprintf(&sb, "\n## %s\n\n**%s**\n\n%s\n", info.Code, info.Title, info.Explanation)
+	}
+	return sb.String()
+}
@@ -0,0 +1,52 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"hpc-toolkit/pkg/config"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+// resolved before tests change working directory
+var errorCodesDocPath, _ = filepath.Abs("../docs/error-codes.md")
+
+func (s *MySuite) TestErrorCodesAreUnique(c *C) {
+	seen := map[config.ErrorCode]bool{}
+	for _, info := range errorCodes() {
+		c.Check(seen[info.Code], Equals, false, Commentf("duplicate code %s", info.Code))
+		c.Check(info.Title, Not(Equals), "")
+		c.Check(info.Explanation, Not(Equals), "")
+		seen[info.Code] = true
+	}
+}
+
+func (s *MySuite) TestErrorCodeInfo(c *C) {
+	info, ok := errorCodeInfo(config.CodeUnknownSetting)
+	c.Check(ok, Equals, true)
+	c.Check(info.Title, Equals, "Unknown module setting")
+
+	_, ok = errorCodeInfo("GHPC0000")
+	c.Check(ok, Equals, false)
+}
+
+func (s *MySuite) TestErrorCodesDocIsUpToDate(c *C) {
+	doc, err := os.ReadFile(errorCodesDocPath)
+	c.Assert(err, IsNil)
+	c.Check(string(doc), Equals, errorCodesMarkdown(),
+		Commentf("regenerate with `ghpc explain --markdown > docs/error-codes.md`"))
+}
@@ -0,0 +1,139 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/logging"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
+)
+
+func init() {
+	fixCmd.Flags().BoolVar(&fixFlags.apply, "apply", false,
+		"Rewrite the blueprint file in place instead of only listing deprecated names.")
+	rootCmd.AddCommand(fixCmd)
+}
+
+var (
+	fixFlags = struct {
+		apply bool
+	}{}
+
+	fixCmd = &cobra.Command{
+		Use:   "fix BLUEPRINT_FILE",
+		Short: "Replace deprecated validators, modules and settings in a blueprint.",
+		Long: "List uses of renamed validators, moved modules and renamed module settings that have direct " +
+			"replacements. With --apply, rewrite the blueprint file in place, keeping its formatting and comments.",
+		Args:              cobra.MatchAll(cobra.ExactArgs(1), checkExists),
+		ValidArgsFunction: filterYaml,
+		Run:               runFixCmd,
+		SilenceUsage:      true,
+	}
+)
+
+func runFixCmd(cmd *cobra.Command, args []string) {
+	path := args[0]
+	bp, ctx, err := config.NewBlueprint(path)
+	checkErr(err, ctx)
+	ds := bp.Deprecations()
+	if len(ds) == 0 {
+		logging.Info("No deprecated names found in %s.", path)
+		return
+	}
+	writeDeprecations(os.Stdout, ds, *ctx)
+	if !fixFlags.apply {
+		logging.Info("Run `ghpc fix --apply %s` to rewrite the blueprint.", path)
+		return
+	}
+
+	lines, unfixed := fixDeprecations(*ctx, ds)
+	checkErr(os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644), ctx)
+	logging.Info("Fixed %d of %d deprecated names in %s.", len(ds)-len(unfixed), len(ds), path)
+	for _, d := range unfixed {
+		logging.Warn(logging.Warning{Source: "deprecation", Location: deprecationLocation(d, *ctx),
+			Message: d.String(), Hint: "fix it manually"})
+	}
+}
+
+// warnDeprecations prints warnings for deprecated names used in the blueprint
+func warnDeprecations(path string, bp config.Blueprint, ctx config.YamlCtx) {
+	for _, d := range bp.Deprecations() {
+		logging.Warn(logging.Warning{Source: "deprecation", Location: deprecationLocation(d, ctx),
+			Message: d.String(), Hint: fmt.Sprintf("run `ghpc fix --apply %s` to update deprecated names", path)})
+	}
+}
+
+// deprecationLocation returns the line of the deprecated name, empty if it is not known
+func deprecationLocation(d config.Deprecation, ctx config.YamlCtx) string {
+	if pos, ok := ctx.Pos(d.Path); ok {
+		return fmt.Sprintf("line %d", pos.Line)
+	}
+	return ""
+}
+
+func writeDeprecations(w io.Writer, ds []config.Deprecation, ctx config.YamlCtx) {
+	for _, d := range ds {
+		if pos, ok := ctx.Pos(d.Path); ok {
+			fmt.Fprintf(w, "%d: %s\n", pos.Line, d)
+		} else {
+			fmt.Fprintf(w, "%s: %s\n", d.Path, d)
+		}
+	}
+}
+
+// fixDeprecations returns lines of the blueprint with deprecated names replaced,
+// and deprecations that could not be fixed. Names are replaced in place, at or
+// after the position of their path, so formatting and comments are kept.
+func fixDeprecations(ctx config.YamlCtx, ds []config.Deprecation) ([]string, []config.Deprecation) {
+	type located struct {
+		d   config.Deprecation
+		pos config.Pos
+	}
+	lines := slices.Clone(ctx.Lines)
+	unfixed := []config.Deprecation{}
+	todo := []located{}
+	for _, d := range ds {
+		pos, ok := ctx.Pos(d.Path)
+		if d.Conflict || !ok || pos.Line < 1 || pos.Line > len(lines) {
+			unfixed = append(unfixed, d)
+			continue
+		}
+		todo = append(todo, located{d, pos})
+	}
+	// replace from the end, so positions of other names on the same line stay valid
+	slices.SortStableFunc(todo, func(a, b located) int {
+		if a.pos.Line != b.pos.Line {
+			return b.pos.Line - a.pos.Line
+		}
+		return b.pos.Column - a.pos.Column
+	})
+	for _, l := range todo {
+		line := lines[l.pos.Line-1]
+		col := min(max(l.pos.Column-1, 0), len(line))
+		i := strings.Index(line[col:], l.d.Old)
+		if i < 0 { // e.g. value on the next line
+			unfixed = append(unfixed, l.d)
+			continue
+		}
+		lines[l.pos.Line-1] = line[:col+i] + l.d.New + line[col+i+len(l.d.Old):]
+	}
+	return lines, unfixed
+}
@@ -0,0 +1,73 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"hpc-toolkit/pkg/config"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestFixDeprecations(c *C) {
+	bp := `blueprint_name: bp
+validators:
+- validator: test_old_name # keep comment
+deployment_groups:
+- group: g
+  modules:
+  - id: job
+    source: ./community/modules/scheduler/cloud-batch-job
+  - id: pool
+    source: community/modules/compute/gke-node-pool
+    skip_validators: [test_old_name, test_old_name]
+    settings:
+      total_min_nodes: 1   # min
+      total_max_nodes: 10
+      autoscaling_total_max_nodes: 10`
+	ctx, err := config.NewYamlCtx([]byte(bp))
+	c.Assert(err, IsNil)
+	g := config.Root.Groups.At(0)
+	skip := g.Modules.At(1).SkipValidators
+	ds := []config.Deprecation{
+		{Kind: config.DeprecatedValidator, Path: config.Root.Validators.At(0).Validator, Old: "test_old_name", New: "test_new_name"},
+		{Kind: config.DeprecatedModule, Path: g.Modules.At(0).Source,
+			Old: "community/modules/scheduler/cloud-batch-job", New: "modules/scheduler/batch-job-template"},
+		{Kind: config.DeprecatedValidator, Path: skip.At(0), Old: "test_old_name", New: "test_new_name"},
+		{Kind: config.DeprecatedValidator, Path: skip.At(1), Old: "test_old_name", New: "test_new_name"},
+		{Kind: config.DeprecatedSetting, Path: g.Modules.At(1).Settings.Dot("total_min_nodes"),
+			Old: "total_min_nodes", New: "autoscaling_total_min_nodes"},
+		{Kind: config.DeprecatedSetting, Path: g.Modules.At(1).Settings.Dot("total_max_nodes"),
+			Old: "total_max_nodes", New: "autoscaling_total_max_nodes", Conflict: true},
+	}
+
+	lines, unfixed := fixDeprecations(ctx, ds)
+	c.Check(strings.Join(lines, "\n"), Equals, `blueprint_name: bp
+validators:
+- validator: test_new_name # keep comment
+deployment_groups:
+- group: g
+  modules:
+  - id: job
+    source: ./modules/scheduler/batch-job-template
+  - id: pool
+    source: community/modules/compute/gke-node-pool
+    skip_validators: [test_new_name, test_new_name]
+    settings:
+      autoscaling_total_min_nodes: 1   # min
+      total_max_nodes: 10
+      autoscaling_total_max_nodes: 10`)
+	c.Check(unfixed, DeepEquals, ds[5:])
+}
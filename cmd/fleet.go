@@ -0,0 +1,271 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/modulewriter"
+	"hpc-toolkit/pkg/shell"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
+)
+
+func init() {
+	fleetCmd.PersistentFlags().IntVar(&fleetFlags.parallelism, "parallelism", 8,
+		"Maximum number of deployments processed at the same time.")
+	fleetCmd.AddCommand(fleetStatusCmd, fleetPlanCmd)
+	rootCmd.AddCommand(fleetCmd)
+}
+
+var (
+	fleetFlags = struct {
+		parallelism int
+	}{}
+
+	fleetCmd = &cobra.Command{
+		Use:   "fleet",
+		Short: "Report status and drift of many deployments at once.",
+		Long: "Operate on a set of deployment directories, given as paths or glob patterns, e.g. \"clusters/*\". " +
+			"Deployments are processed concurrently and reported in a single table.",
+	}
+
+	fleetStatusCmd = &cobra.Command{
+		Use:   "status DEPLOYMENT_DIRECTORY_OR_GLOB...",
+		Short: "Report deployment name, Toolkit version and deployed groups of every deployment.",
+		Long: "Read artifacts of every deployment and report its deployment name, the Toolkit version it was " +
+			"created with and how many of its deployment groups have been deployed. Cloud APIs are not called.",
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: matchDirs,
+		Run:               runFleetStatusCmd,
+		SilenceUsage:      true,
+	}
+
+	fleetPlanCmd = &cobra.Command{
+		Use:   "plan DEPLOYMENT_DIRECTORY_OR_GLOB...",
+		Short: "Plan every Terraform group of every deployment and report drift.",
+		Long: "Plan changes of Terraform deployment groups of every deployment without applying them. Changes " +
+			"planned for a deployed cluster are drift between the cluster and its deployment directory. " +
+			"Exits with an error if any deployment has changes or fails to plan.",
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: matchDirs,
+		Run:               runFleetPlanCmd,
+		SilenceUsage:      true,
+	}
+)
+
+// fleetEntry is the outcome of an operation on a deployment of the fleet
+type fleetEntry struct {
+	dir        string
+	deployment string
+	version    string
+	groups     int
+	deployed   int
+	// Terraform groups with planned changes
+	changed []config.GroupName
+	err     error
+}
+
+// fleetDirs expands paths and glob patterns into deployment directories, that is
+// directories with Toolkit artifacts, sorted and without duplicates
+func fleetDirs(patterns []string) ([]string, error) {
+	dirs := []string{}
+	for _, p := range patterns {
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, fmt.Errorf("malformed pattern %q: %w", p, err)
+		}
+		for _, m := range matches {
+			if isDir, _ := shell.DirInfo(modulewriter.ArtifactsDir(m)); isDir {
+				dirs = append(dirs, filepath.Clean(m))
+			}
+		}
+	}
+	slices.Sort(dirs)
+	dirs = slices.Compact(dirs)
+	if len(dirs) == 0 {
+		return nil, fmt.Errorf("no deployment directories match %s", strings.Join(patterns, ", "))
+	}
+	return dirs, nil
+}
+
+// forEachDeployment runs f for every directory, at most parallelism at the same
+// time, and returns the entries in order of directories
+func forEachDeployment(dirs []string, parallelism int, f func(dir string) fleetEntry) []fleetEntry {
+	entries := make([]fleetEntry, len(dirs))
+	sem := make(chan struct{}, max(parallelism, 1))
+	var wg sync.WaitGroup
+	for i, d := range dirs {
+		wg.Add(1)
+		go func(i int, d string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			entries[i] = f(d)
+		}(i, d)
+	}
+	wg.Wait()
+	return entries
+}
+
+// fleetDeployment reads the expanded blueprint of the deployment and counts its
+// deployed groups, groups with exported outputs
+func fleetDeployment(dir string) (fleetEntry, config.Blueprint) {
+	e := fleetEntry{dir: dir}
+	artDir := modulewriter.ArtifactsDir(dir)
+	if e.err = modulewriter.CheckWriteCompleted(artDir); e.err != nil {
+		return e, config.Blueprint{}
+	}
+	bp, _, err := config.NewBlueprint(filepath.Join(artDir, modulewriter.ExpandedBlueprintName))
+	if err == nil {
+		err = modulewriter.DecryptBlueprintVars(&bp, artDir)
+	}
+	if err == nil {
+		err = bp.Materialize()
+	}
+	if err != nil {
+		e.err = err
+		return e, config.Blueprint{}
+	}
+	e.deployment, e.version, e.groups = bp.DeploymentName(), bp.GhpcVersion, len(bp.Groups)
+	for _, g := range bp.Groups {
+		if _, err := shell.ReadOutputs(artDir, g.Name); err == nil {
+			e.deployed++
+		}
+	}
+	return e, bp
+}
+
+func fleetStatus(dir string) fleetEntry {
+	e, _ := fleetDeployment(dir)
+	return e
+}
+
+func fleetPlan(dir string) fleetEntry {
+	e, bp := fleetDeployment(dir)
+	if e.err != nil {
+		return e
+	}
+	artDir := modulewriter.ArtifactsDir(dir)
+	for _, g := range bp.Groups {
+		if g.Kind() != config.TerraformKind {
+			continue
+		}
+		groupDir := filepath.Join(dir, string(g.Name))
+		if err := shell.ImportInputs(groupDir, artDir, bp); err != nil {
+			e.err = fmt.Errorf("group %s: %w", g.Name, err)
+			return e
+		}
+		tf, err := shell.ConfigureTerraform(groupDir)
+		if err != nil {
+			e.err = err
+			return e
+		}
+		_, changes, err := shell.PlanChanges(tf)
+		if err != nil {
+			e.err = fmt.Errorf("group %s: %w", g.Name, err)
+			return e
+		}
+		if changes {
+			e.changed = append(e.changed, g.Name)
+		}
+	}
+	return e
+}
+
+func fleetDirsOrDie(args []string) []string {
+	dirs, err := fleetDirs(args)
+	checkErr(err, nil)
+	return dirs
+}
+
+func runFleetStatusCmd(cmd *cobra.Command, args []string) {
+	entries := forEachDeployment(fleetDirsOrDie(args), fleetFlags.parallelism, fleetStatus)
+	writeFleetStatus(os.Stdout, entries)
+	checkErr(fleetErrors(entries), nil)
+}
+
+func runFleetPlanCmd(cmd *cobra.Command, args []string) {
+	entries := forEachDeployment(fleetDirsOrDie(args), fleetFlags.parallelism, fleetPlan)
+	writeFleetPlan(os.Stdout, entries)
+	checkErr(fleetErrors(entries), nil)
+	drifted := 0
+	for _, e := range entries {
+		if len(e.changed) > 0 {
+			drifted++
+		}
+	}
+	if drifted > 0 {
+		checkErr(fmt.Errorf("%d of %d deployments have planned changes", drifted, len(entries)), nil)
+	}
+}
+
+// fleetErrors joins errors of deployments that failed
+func fleetErrors(entries []fleetEntry) error {
+	errs := []error{}
+	for _, e := range entries {
+		if e.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", e.dir, e.err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func writeFleetStatus(w io.Writer, entries []fleetEntry) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DIRECTORY\tDEPLOYMENT\tVERSION\tDEPLOYED GROUPS")
+	for _, e := range entries {
+		if e.err != nil {
+			fmt.Fprintf(tw, "%s\t-\t-\tfailed, see below\n", e.dir)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d/%d\n", e.dir, e.deployment, e.version, e.deployed, e.groups)
+	}
+	tw.Flush()
+}
+
+func writeFleetPlan(w io.Writer, entries []fleetEntry) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DIRECTORY\tDEPLOYMENT\tPLANNED CHANGES")
+	for _, e := range entries {
+		var changes string
+		switch {
+		case e.err != nil:
+			changes = "plan failed, see below"
+		case len(e.changed) == 0:
+			changes = "none"
+		default:
+			groups := []string{}
+			for _, g := range e.changed {
+				groups = append(groups, string(g))
+			}
+			changes = "groups " + strings.Join(groups, ", ")
+		}
+		deployment := e.deployment
+		if deployment == "" {
+			deployment = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", e.dir, deployment, changes)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,84 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/modulewriter"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestFleetDirs(c *C) {
+	root := c.MkDir()
+	for _, d := range []string{"a", "b", "c"} {
+		c.Assert(os.MkdirAll(modulewriter.ArtifactsDir(filepath.Join(root, d)), 0755), IsNil)
+	}
+	c.Assert(os.Mkdir(filepath.Join(root, "not-a-deployment"), 0755), IsNil)
+
+	dirs, err := fleetDirs([]string{filepath.Join(root, "*"), filepath.Join(root, "b"), filepath.Join(root, "a") + "/"})
+	c.Assert(err, IsNil)
+	c.Check(dirs, DeepEquals, []string{filepath.Join(root, "a"), filepath.Join(root, "b"), filepath.Join(root, "c")})
+
+	_, err = fleetDirs([]string{filepath.Join(root, "not-*")})
+	c.Check(err, NotNil)
+
+	_, err = fleetDirs([]string{"["})
+	c.Check(err, ErrorMatches, "malformed pattern.*")
+}
+
+func (s *MySuite) TestForEachDeployment(c *C) {
+	dirs := []string{"d0", "d1", "d2", "d3", "d4"}
+	entries := forEachDeployment(dirs, 2, func(dir string) fleetEntry {
+		return fleetEntry{dir: dir, deployment: "dep-" + dir}
+	})
+	c.Assert(entries, HasLen, len(dirs))
+	for i, e := range entries {
+		c.Check(e.dir, Equals, dirs[i])
+		c.Check(e.deployment, Equals, "dep-"+dirs[i])
+	}
+}
+
+func (s *MySuite) TestWriteFleet(c *C) {
+	entries := []fleetEntry{
+		{dir: "clusters/a", deployment: "a", version: "v1.30.0", groups: 2, deployed: 2},
+		{dir: "clusters/b", deployment: "b", version: "v1.29.0", groups: 3, deployed: 1,
+			changed: []config.GroupName{"primary", "compute"}},
+		{dir: "clusters/c", err: errors.New("broken")},
+	}
+
+	var status bytes.Buffer
+	writeFleetStatus(&status, entries)
+	c.Check(status.String(), Equals, `DIRECTORY   DEPLOYMENT  VERSION  DEPLOYED GROUPS
+clusters/a  a           v1.30.0  2/2
+clusters/b  b           v1.29.0  1/3
+clusters/c  -           -        failed, see below
+`)
+
+	var plan bytes.Buffer
+	writeFleetPlan(&plan, entries)
+	c.Check(plan.String(), Equals, `DIRECTORY   DEPLOYMENT  PLANNED CHANGES
+clusters/a  a           none
+clusters/b  b           groups primary, compute
+clusters/c  -           plan failed, see below
+`)
+
+	c.Check(fleetErrors(entries), ErrorMatches, "clusters/c: broken")
+	c.Check(fleetErrors(entries[:2]), IsNil)
+}
@@ -0,0 +1,117 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/logging"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// gcloudVarProperties are gcloud properties that provide defaults of deployment variables
+var gcloudVarProperties = map[string]string{
+	"project_id": "core/project",
+	"region":     "compute/region",
+	"zone":       "compute/zone",
+}
+
+// gcloudConfig is the active gcloud configuration
+type gcloudConfig struct {
+	name  string
+	props map[string]string // by "section/name"
+}
+
+// gcloudConfigDir returns the directory of gcloud configurations, see `gcloud topic configurations`
+func gcloudConfigDir(getenv func(string) string) string {
+	if d := getenv("CLOUDSDK_CONFIG"); d != "" {
+		return d
+	}
+	if d := getenv("APPDATA"); d != "" {
+		return filepath.Join(d, "gcloud")
+	}
+	return filepath.Join(getenv("HOME"), ".config", "gcloud")
+}
+
+// parseGcloudProperties parses a gcloud configuration file in INI format
+func parseGcloudProperties(content string) map[string]string {
+	props := map[string]string{}
+	section := ""
+	sc := bufio.NewScanner(strings.NewReader(content))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			section = strings.TrimSpace(line[1 : len(line)-1])
+		default:
+			k, v, ok := strings.Cut(line, "=")
+			if ok && section != "" {
+				props[section+"/"+strings.TrimSpace(k)] = strings.TrimSpace(v)
+			}
+		}
+	}
+	return props
+}
+
+// readGcloudConfig reads the active gcloud configuration, properties set by
+// `CLOUDSDK_<SECTION>_<NAME>` environment variables take precedence
+func readGcloudConfig(getenv func(string) string) gcloudConfig {
+	dir := gcloudConfigDir(getenv)
+	name := getenv("CLOUDSDK_ACTIVE_CONFIG_NAME")
+	if name == "" {
+		if b, err := os.ReadFile(filepath.Join(dir, "active_config")); err == nil {
+			name = strings.TrimSpace(string(b))
+		}
+	}
+	if name == "" {
+		name = "default"
+	}
+	props := map[string]string{}
+	if b, err := os.ReadFile(filepath.Join(dir, "configurations", "config_"+name)); err == nil {
+		props = parseGcloudProperties(string(b))
+	}
+	for _, p := range gcloudVarProperties {
+		if v := getenv("CLOUDSDK_" + strings.ToUpper(strings.ReplaceAll(p, "/", "_"))); v != "" {
+			props[p] = v
+		}
+	}
+	return gcloudConfig{name: name, props: props}
+}
+
+// inheritGcloudDefaults sets deployment variables that are declared without value
+// to properties of the gcloud configuration. Values of the blueprint, deployment
+// file, environment and `--vars` take precedence. Returns names of set variables.
+func inheritGcloudDefaults(bp *config.Blueprint, gc gcloudConfig) []string {
+	names := maps.Keys(gcloudVarProperties)
+	slices.Sort(names)
+	inherited := []string{}
+	for _, n := range names {
+		v, ok := gc.props[gcloudVarProperties[n]]
+		if !ok || v == "" || !bp.Vars.Has(n) || !bp.Vars.Get(n).IsNull() {
+			continue
+		}
+		bp.Vars = bp.Vars.With(n, cty.StringVal(v))
+		inherited = append(inherited, n)
+		logging.Info("Deployment variable %s = %q is inherited from gcloud configuration %q (%s)", n, v, gc.name, gcloudVarProperties[n])
+	}
+	return inherited
+}
@@ -0,0 +1,77 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"hpc-toolkit/pkg/config"
+	"os"
+	"path/filepath"
+
+	"github.com/zclconf/go-cty/cty"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestParseGcloudProperties(c *C) {
+	c.Check(parseGcloudProperties(`
+# comment
+[core]
+account = me@example.com
+project = my-project
+
+[compute]
+zone=us-central1-a
+ignored
+`), DeepEquals, map[string]string{
+		"core/account": "me@example.com",
+		"core/project": "my-project",
+		"compute/zone": "us-central1-a",
+	})
+}
+
+func (s *MySuite) TestReadGcloudConfig(c *C) {
+	dir := c.MkDir()
+	c.Assert(os.MkdirAll(filepath.Join(dir, "configurations"), 0755), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(dir, "active_config"), []byte("hpc\n"), 0644), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(dir, "configurations", "config_hpc"),
+		[]byte("[core]\nproject = hpc-project\n[compute]\nregion = us-east4\n"), 0644), IsNil)
+
+	env := map[string]string{"CLOUDSDK_CONFIG": dir}
+	getenv := func(k string) string { return env[k] }
+
+	c.Check(readGcloudConfig(getenv), DeepEquals, gcloudConfig{name: "hpc", props: map[string]string{
+		"core/project": "hpc-project", "compute/region": "us-east4"}})
+
+	env["CLOUDSDK_COMPUTE_REGION"] = "europe-west4"
+	env["CLOUDSDK_ACTIVE_CONFIG_NAME"] = "missing"
+	c.Check(readGcloudConfig(getenv), DeepEquals, gcloudConfig{name: "missing", props: map[string]string{
+		"compute/region": "europe-west4"}})
+}
+
+func (s *MySuite) TestInheritGcloudDefaults(c *C) {
+	bp := config.Blueprint{Vars: config.NewDict(map[string]cty.Value{
+		"project_id": cty.NullVal(cty.DynamicPseudoType),
+		"region":     cty.StringVal("us-central1"),
+	})}
+	gc := gcloudConfig{name: "default", props: map[string]string{
+		"core/project":   "gcloud-project",
+		"compute/region": "us-east4",
+		"compute/zone":   "us-east4-a",
+	}}
+
+	c.Check(inheritGcloudDefaults(&bp, gc), DeepEquals, []string{"project_id"})
+	c.Check(bp.Vars.Get("project_id"), DeepEquals, cty.StringVal("gcloud-project"))
+	c.Check(bp.Vars.Get("region"), DeepEquals, cty.StringVal("us-central1")) // blueprint takes precedence
+	c.Check(bp.Vars.Has("zone"), Equals, false)                              // not declared by blueprint
+}
@@ -0,0 +1,206 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmd defines command line utilities for ghpc
+package cmd
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/maps"
+)
+
+func init() {
+	graphCmd.Flags().StringVarP(&graphFlags.outputPath, "out", "o", "",
+		"Output file for the graph in DOT format (defaults to stdout).")
+	rootCmd.AddCommand(graphCmd)
+}
+
+var (
+	graphFlags = struct {
+		outputPath string
+	}{}
+
+	graphCmd = &cobra.Command{
+		Use:   "graph BLUEPRINT_FILE",
+		Short: "Render dependencies between deployment variables and modules.",
+		Long: "Expand the blueprint and render, in Graphviz DOT format, which deployment variables feed " +
+			"which module settings and which module outputs feed which module inputs. " +
+			"Edges are labeled with the origin of the setting value. " +
+			"Unused variables and module outputs not consumed by other modules are highlighted.",
+		Args:              cobra.MatchAll(cobra.ExactArgs(1), checkExists),
+		ValidArgsFunction: filterYaml,
+		Run:               runGraphCmd,
+		SilenceUsage:      true,
+	}
+)
+
+func runGraphCmd(cmd *cobra.Command, args []string) {
+	bp, ctx := expandWithoutValidationOrDie(args[0])
+	w := os.Stdout
+	if graphFlags.outputPath != "" {
+		f, err := os.Create(graphFlags.outputPath)
+		checkErr(err, nil)
+		defer f.Close()
+		w = f
+	}
+	writeGraph(w, buildGraph(bp, *ctx, args[0]))
+}
+
+// graphEdge is a dependency of a module setting on a variable or a module output
+type graphEdge struct {
+	from    string // "var.NAME" or module ID
+	to      config.ModuleID
+	output  string // empty for variables
+	setting string
+	origin  string // where the setting value came from, see settingOrigin
+}
+
+type depGraph struct {
+	name       string
+	groups     []config.Group
+	vars       []string
+	unusedVars []string
+	edges      []graphEdge
+	// outputs of modules that are not consumed by any module
+	deadOutputs map[config.ModuleID][]string
+}
+
+// settingOrigin describes where the value of module setting came from:
+// position in the blueprint file, or origin of the value added by expansion.
+func settingOrigin(v cty.Value, p config.Path, ctx config.YamlCtx, bpPath string) string {
+	if pv, ok := config.ProvenanceOf(v); ok {
+		return string(pv.Origin)
+	}
+	if pos, ok := findPos(p, ctx); ok && bpPath != "" {
+		return fmt.Sprintf("%s:%d", filepath.Base(bpPath), pos.Line)
+	}
+	return string(config.OriginBlueprint)
+}
+
+func buildGraph(bp config.Blueprint, ctx config.YamlCtx, bpPath string) depGraph {
+	g := depGraph{name: bp.BlueprintName, groups: bp.Groups, deadOutputs: map[config.ModuleID][]string{}}
+	usedVars := map[string]bool{}
+	usedOutputs := map[config.Reference]bool{}
+
+	use := func(r config.Reference) {
+		if r.GlobalVar {
+			usedVars[r.Name] = true
+		} else {
+			usedOutputs[r] = true
+		}
+	}
+
+	for _, v := range bp.Vars.Items() {
+		for r := range config.ValueReferences(v) {
+			use(r)
+		}
+	}
+	for _, v := range bp.Validators {
+		for r := range config.ValueReferences(v.Inputs.AsObject()) {
+			use(r)
+		}
+	}
+	bp.WalkModulesSafe(func(mp config.ModulePath, m *config.Module) {
+		settings := m.Settings.Items()
+		for _, s := range m.Settings.Keys() {
+			origin := settingOrigin(settings[s], mp.Settings.Dot(s), ctx, bpPath)
+			for r := range config.ValueReferences(settings[s]) {
+				use(r)
+				if r.GlobalVar {
+					g.edges = append(g.edges, graphEdge{from: "var." + r.Name, to: m.ID, setting: s, origin: origin})
+				} else {
+					g.edges = append(g.edges, graphEdge{from: string(r.Module), to: m.ID, output: r.Name, setting: s, origin: origin})
+				}
+			}
+		}
+	})
+	sort.Slice(g.edges, func(i, j int) bool {
+		key := func(e graphEdge) string {
+			return strings.Join([]string{string(e.to), e.setting, e.from, e.output}, "\x00")
+		}
+		return key(g.edges[i]) < key(g.edges[j])
+	})
+
+	g.vars = bp.Vars.Keys()
+	sort.Strings(g.vars)
+	for _, v := range g.vars {
+		if !usedVars[v] {
+			g.unusedVars = append(g.unusedVars, v)
+		}
+	}
+
+	bp.WalkModulesSafe(func(_ config.ModulePath, m *config.Module) {
+		for _, o := range m.Outputs {
+			if !usedOutputs[config.ModuleRef(m.ID, o.Name)] {
+				g.deadOutputs[m.ID] = append(g.deadOutputs[m.ID], o.Name)
+			}
+		}
+	})
+	return g
+}
+
+func writeGraph(w io.Writer, g depGraph) {
+	unused := map[string]bool{}
+	for _, v := range g.unusedVars {
+		unused[v] = true
+	}
+
+	fmt.Fprintf(w, "digraph %q {\n", g.name)
+	fmt.Fprintln(w, "  rankdir=LR;")
+	fmt.Fprintln(w, "  node [shape=box];")
+	for _, v := range g.vars {
+		attrs := "shape=ellipse"
+		if unused[v] {
+			attrs += `, style=dashed, color=red, xlabel="unused"`
+		}
+		fmt.Fprintf(w, "  %q [%s];\n", "var."+v, attrs)
+	}
+	for _, grp := range g.groups {
+		fmt.Fprintf(w, "  subgraph %q {\n", "cluster_"+string(grp.Name))
+		fmt.Fprintf(w, "    label=%q;\n", grp.Name)
+		for _, m := range grp.Modules {
+			fmt.Fprintf(w, "    %q;\n", m.ID)
+		}
+		fmt.Fprintln(w, "  }")
+	}
+	for _, e := range g.edges {
+		label := e.setting
+		if e.output != "" {
+			label = fmt.Sprintf("%s -> %s", e.output, e.setting)
+		}
+		if e.origin != "" {
+			label = fmt.Sprintf("%s (%s)", label, e.origin)
+		}
+		fmt.Fprintf(w, "  %q -> %q [label=%q];\n", e.from, e.to, label)
+	}
+	ids := maps.Keys(g.deadOutputs)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		for _, o := range g.deadOutputs[id] {
+			node := fmt.Sprintf("%s.%s", id, o)
+			fmt.Fprintf(w, "  %q [shape=note, style=dashed, color=red, label=%q];\n", node, o)
+			fmt.Fprintf(w, "  %q -> %q [style=dashed, color=red];\n", id, node)
+		}
+	}
+	fmt.Fprintln(w, "}")
+}
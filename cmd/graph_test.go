@@ -0,0 +1,78 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/modulereader"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestBuildGraph(c *C) {
+	bp := config.Blueprint{
+		BlueprintName: "graphy",
+		Vars: config.NewDict(map[string]cty.Value{
+			"project_id": cty.StringVal("pink"),
+			"zone":       cty.StringVal("us-central1-a"),
+			"forgotten":  cty.StringVal("green"),
+		}),
+		Groups: []config.Group{{Name: "primary", Modules: []config.Module{
+			{ID: "network", Outputs: []modulereader.OutputInfo{{Name: "network_id"}, {Name: "subnetwork_name"}}},
+			{ID: "vm", Settings: config.NewDict(map[string]cty.Value{
+				"project": config.GlobalRef("project_id").AsValue(),
+				"zone": config.WithProvenance(config.GlobalRef("zone").AsValue(),
+					config.Provenance{Origin: config.OriginVar, Source: "zone"}),
+				"network_id": config.AsProductOfModuleUse(config.ModuleRef("network", "network_id").AsValue(), "network"),
+			})},
+		}}},
+		Validators: []config.Validator{{
+			Validator: "test_project_exists",
+			Inputs:    config.NewDict(map[string]cty.Value{"project_id": config.GlobalRef("project_id").AsValue()}),
+		}},
+	}
+	ctx, err := config.NewYamlCtx([]byte(`
+deployment_groups:
+- group: primary
+  modules:
+  - id: network
+  - id: vm
+    use: [network]
+    settings:
+      project: $(vars.project_id)
+`))
+	c.Assert(err, IsNil)
+
+	g := buildGraph(bp, ctx, "bp/graphy.yaml")
+	c.Check(g.unusedVars, DeepEquals, []string{"forgotten"})
+	c.Check(g.deadOutputs, DeepEquals, map[config.ModuleID][]string{"network": {"subnetwork_name"}})
+	c.Check(g.edges, DeepEquals, []graphEdge{
+		{from: "network", to: "vm", output: "network_id", setting: "network_id", origin: "use"},
+		{from: "var.project_id", to: "vm", setting: "project", origin: "graphy.yaml:9"},
+		{from: "var.zone", to: "vm", setting: "zone", origin: "var"},
+	})
+
+	var b bytes.Buffer
+	writeGraph(&b, g)
+	out := b.String()
+	c.Check(strings.HasPrefix(out, `digraph "graphy" {`), Equals, true)
+	c.Check(out, Matches, `(?s).*"var.forgotten" \[shape=ellipse, style=dashed, color=red, xlabel="unused"\];.*`)
+	c.Check(out, Matches, `(?s).*"network" -> "vm" \[label="network_id -> network_id \(use\)"\];.*`)
+	c.Check(out, Matches, `(?s).*"var.project_id" -> "vm" \[label="project \(graphy.yaml:9\)"\];.*`)
+	c.Check(out, Matches, `(?s).*"network.subnetwork_name" \[shape=note.*`)
+}
@@ -0,0 +1,78 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmd defines command line utilities for ghpc
+package cmd
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/cluster"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	idleReportCmd.Flags().DurationVar(&idleReportFlags.Window, "window", cluster.DefaultIdleCriteria.Window,
+		"Period of time over which resource usage is inspected.")
+	idleReportCmd.Flags().Float64Var(&idleReportFlags.CPUThreshold, "cpu-threshold", cluster.DefaultIdleCriteria.CPUThreshold,
+		"Mean CPU utilization (0..1) below which an instance is considered idle.")
+	idleReportCmd.Flags().Float64Var(&idleReportFlags.FilestoreThreshold, "filestore-threshold", cluster.DefaultIdleCriteria.FilestoreThreshold,
+		"Percent of used capacity below which a Filestore share is considered empty.")
+	rootCmd.AddCommand(addArtifactsDirFlag(idleReportCmd))
+}
+
+var (
+	idleReportFlags = cluster.DefaultIdleCriteria
+
+	idleReportCmd = &cobra.Command{
+		Use:   "idle-report DEPLOYMENT_DIRECTORY",
+		Short: "Report idle resources of a deployed cluster.",
+		Long: "Inspect resources of a deployed cluster for idle login nodes, long-idle static compute nodes " +
+			"and empty Filestore shares, and report them grouped by blueprint module.",
+		Args:              cobra.MatchAll(cobra.ExactArgs(1), checkDir),
+		ValidArgsFunction: matchDirs,
+		Run:               runIdleReportCmd,
+		SilenceUsage:      true,
+	}
+)
+
+func runIdleReportCmd(cmd *cobra.Command, args []string) {
+	bp, ctx := artifactBlueprintOrDie(getArtifactsDir(args[0]))
+	pid, err := deploymentProjectID(bp)
+	checkErr(err, ctx)
+
+	findings, err := cluster.IdleReport(bp, pid, idleReportFlags)
+	checkErr(err, ctx)
+	writeIdleReport(os.Stdout, findings)
+}
+
+func writeIdleReport(w io.Writer, findings []cluster.Finding) {
+	if len(findings) == 0 {
+		fmt.Fprintln(w, "No idle resources found.")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MODULE\tRESOURCE\tLOCATION\tTYPE\tREASON")
+	for _, f := range findings {
+		mod := string(f.Module)
+		if mod == "" {
+			mod = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s/%s\t%s\t%s\t%s\n", mod, f.Resource.Kind, f.Resource.Name, f.Resource.Location, f.Resource.Type, f.Reason)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,42 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"hpc-toolkit/pkg/cluster"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestWriteIdleReport(c *C) {
+	{ // no findings
+		var b bytes.Buffer
+		writeIdleReport(&b, nil)
+		c.Check(b.String(), Equals, "No idle resources found.\n")
+	}
+
+	{ // findings
+		var b bytes.Buffer
+		writeIdleReport(&b, []cluster.Finding{
+			{Module: "login", Resource: cluster.Resource{Kind: "instance", Name: "login-0", Location: "us-central1-a", Type: "n2-standard-4"}, Reason: "idle"},
+			{Resource: cluster.Resource{Kind: "filestore", Name: "fs", Location: "us-central1-a", Type: "BASIC_HDD"}, Reason: "empty"},
+		})
+		c.Check(b.String(), Equals, ""+
+			"MODULE  RESOURCE          LOCATION       TYPE           REASON\n"+
+			"login   instance/login-0  us-central1-a  n2-standard-4  idle\n"+
+			"-       filestore/fs      us-central1-a  BASIC_HDD      empty\n")
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmd defines command line utilities for ghpc
+package cmd
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/logging"
+	"hpc-toolkit/pkg/tfimport"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	importTfCmd.Flags().StringVarP(&importTfFlags.outputPath, "out", "o", "blueprint.yaml",
+		"Output file for the imported blueprint.")
+	rootCmd.AddCommand(importTfCmd)
+}
+
+var (
+	importTfFlags = struct {
+		outputPath string
+	}{}
+
+	importTfCmd = &cobra.Command{
+		Use:   "import-tf TERRAFORM_DIRECTORY",
+		Short: "(Experimental) Convert a Terraform root module into a blueprint.",
+		Long: "(Experimental) Parse a Terraform root module and produce a best-effort blueprint " +
+			"with its modules and variables. Constructs that can not be converted are reported.",
+		Args:              cobra.MatchAll(cobra.ExactArgs(1), checkDir),
+		ValidArgsFunction: matchDirs,
+		Run:               runImportTfCmd,
+		SilenceUsage:      true,
+	}
+)
+
+func runImportTfCmd(cmd *cobra.Command, args []string) {
+	bp, issues, err := tfimport.Import(args[0])
+	checkErr(err, nil)
+	checkErr(bp.Export(importTfFlags.outputPath), nil)
+
+	for _, i := range issues {
+		logging.Warn(logging.Warning{Source: "import-tf",
+			Location: fmt.Sprintf("%s:%d", i.Range.Filename, i.Range.Start.Line), Message: i.Msg})
+	}
+	if len(issues) > 0 {
+		logging.Error("%d construct(s) were not fully converted, review the blueprint before use.", len(issues))
+	}
+	logging.Info(boldGreen("Blueprint imported from %s, saved as %s."), args[0], importTfFlags.outputPath)
+}
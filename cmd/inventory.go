@@ -0,0 +1,111 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"hpc-toolkit/pkg/cluster"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
+)
+
+func init() {
+	inventoryCmd.Flags().StringVar(&inventoryFlags.format, "format", "ini",
+		"Output format, one of \"ini\" (Ansible INI inventory), \"json\" (Ansible dynamic inventory) or \"ssh-config\".")
+	inventoryCmd.Flags().StringVarP(&inventoryFlags.out, "out", "o", "",
+		"Path of the file to write, it is replaced atomically. Defaults to standard output.")
+	rootCmd.AddCommand(addArtifactsDirFlag(inventoryCmd))
+}
+
+var (
+	inventoryFlags = struct {
+		format string
+		out    string
+	}{}
+
+	inventoryCmd = &cobra.Command{
+		Use:   "inventory DEPLOYMENT_DIRECTORY",
+		Short: "Generate Ansible inventory or SSH configuration of a deployed cluster.",
+		Long: "List running instances of a deployed cluster and write an Ansible inventory grouped by role " +
+			"(controller, login, compute, storage) and by blueprint module, or an SSH client configuration. " +
+			"Run it again, or use the JSON format as a dynamic inventory, to follow clusters that autoscale.",
+		Args:              cobra.MatchAll(cobra.ExactArgs(1), checkDir),
+		ValidArgsFunction: matchDirs,
+		Run:               runInventoryCmd,
+		SilenceUsage:      true,
+	}
+)
+
+var inventoryFormats = []string{"ini", "json", "ssh-config"}
+
+func runInventoryCmd(cmd *cobra.Command, args []string) {
+	bp, ctx := artifactBlueprintOrDie(getArtifactsDir(args[0]))
+	if !slices.Contains(inventoryFormats, inventoryFlags.format) {
+		checkErr(fmt.Errorf("unknown format %q, expected one of %s", inventoryFlags.format, strings.Join(inventoryFormats, ", ")), ctx)
+	}
+	pid, err := deploymentProjectID(bp)
+	checkErr(err, ctx)
+
+	resources, err := cluster.ListInstances(pid, bp.DeploymentName())
+	checkErr(err, ctx)
+	inv := cluster.NewInventory(bp, resources)
+
+	var buf bytes.Buffer
+	checkErr(writeInventory(&buf, inv, inventoryFlags.format, pid), ctx)
+	if inventoryFlags.out == "" {
+		_, err = os.Stdout.Write(buf.Bytes())
+	} else {
+		err = writeFileAtomically(inventoryFlags.out, buf.Bytes())
+	}
+	checkErr(err, ctx)
+}
+
+func writeInventory(buf *bytes.Buffer, inv cluster.Inventory, format string, projectID string) error {
+	switch format {
+	case "ini":
+		return inv.WriteIni(buf)
+	case "json":
+		return inv.WriteJSON(buf)
+	case "ssh-config":
+		return inv.WriteSSHConfig(buf, projectID)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// writeFileAtomically replaces the file, so that readers, such as Ansible runs,
+// never observe a partially written file
+func writeFileAtomically(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // no-op after successful rename
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
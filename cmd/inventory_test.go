@@ -0,0 +1,37 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestWriteFileAtomically(c *C) {
+	dir := c.MkDir()
+	p := filepath.Join(dir, "hosts.ini")
+	c.Assert(os.WriteFile(p, []byte("old"), 0644), IsNil)
+
+	c.Assert(writeFileAtomically(p, []byte("new")), IsNil)
+	b, err := os.ReadFile(p)
+	c.Assert(err, IsNil)
+	c.Check(string(b), Equals, "new")
+
+	entries, err := os.ReadDir(dir)
+	c.Assert(err, IsNil)
+	c.Check(entries, HasLen, 1) // no temporary files left
+}
@@ -0,0 +1,139 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"hpc-toolkit/pkg/apiclient"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/profile"
+	"hpc-toolkit/pkg/validators"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/maps"
+)
+
+var (
+	// metricsPath is set by `--metrics-file` flag
+	metricsPath string
+	// failedValidators are names of validators that failed in the run
+	failedValidators = map[string]bool{}
+)
+
+// recordFailedValidators remembers validators failing with the error returned by validators.Execute
+func recordFailedValidators(err error) {
+	var multi config.Errors
+	if errors.As(err, &multi) {
+		for _, e := range multi.Errors {
+			recordFailedValidators(e)
+		}
+		return
+	}
+	var ve validators.ValidatorError
+	if errors.As(err, &ve) {
+		failedValidators[ve.Validator] = true
+	}
+}
+
+type metric struct {
+	labels string
+	value  float64
+}
+
+// writeMetrics writes metrics of the run in the Prometheus text format
+func writeMetrics(w io.Writer, end time.Time, steps []profile.Step, failed map[string]bool, api map[string]int) {
+	family := func(name string, typ string, help string, ms ...metric) {
+		if len(ms) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+		for _, m := range ms {
+			fmt.Fprintf(w, "%s%s %g\n", name, m.labels, m.value)
+		}
+	}
+
+	phases := map[string]float64{}
+	vals := map[string]float64{}
+	for _, s := range steps {
+		phases[s.Phase] += s.Duration.Seconds()
+		if s.Phase == profile.Validation {
+			vals[s.Name] += s.Duration.Seconds()
+		}
+	}
+	byLabel := func(label string, m map[string]float64) []metric {
+		keys := maps.Keys(m)
+		sort.Strings(keys)
+		res := []metric{}
+		for _, k := range keys {
+			res = append(res, metric{fmt.Sprintf("{%s=%q}", label, k), m[k]})
+		}
+		return res
+	}
+	results := map[string]float64{}
+	for v := range vals {
+		results[v] = 0
+		if failed[v] {
+			results[v] = 1
+		}
+	}
+	requests := map[string]float64{}
+	for code, n := range api {
+		requests[code] = float64(n)
+	}
+
+	family("ghpc_run_end_timestamp_seconds", "gauge", "Time the run of ghpc ended.",
+		metric{"", float64(end.UnixMilli()) / 1000})
+	family("ghpc_phase_duration_seconds", "gauge", "Time spent in phases of the run: parsing, module info, expansion, validation and writing.",
+		byLabel("phase", phases)...)
+	family("ghpc_validator_duration_seconds", "gauge", "Time spent in each validator that ran.",
+		byLabel("validator", vals)...)
+	family("ghpc_validator_failed", "gauge", "Whether the validator failed (1) or passed (0).",
+		byLabel("validator", results)...)
+	family("ghpc_api_requests_total", "counter", "Requests to Google Cloud APIs by HTTP status code, retries included; \"error\" if no response was received.",
+		byLabel("code", requests)...)
+}
+
+// writeMetricsMaybe writes metrics of the run to the file specified by `--metrics-file`
+// flag, if any. The file is replaced atomically, so that the textfile collector of
+// node exporter never reads it partially written.
+func writeMetricsMaybe() {
+	if metricsPath == "" {
+		return
+	}
+	var b strings.Builder
+	writeMetrics(&b, time.Now(), profile.Steps(), failedValidators, apiclient.Stats())
+	f, err := os.CreateTemp(filepath.Dir(metricsPath), ".ghpc-metrics-")
+	checkErr(err, nil)
+	_, err = f.WriteString(b.String())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), metricsPath)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	checkErr(err, nil)
+}
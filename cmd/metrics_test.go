@@ -0,0 +1,78 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/profile"
+	"hpc-toolkit/pkg/validators"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestWriteMetrics(c *C) {
+	steps := []profile.Step{
+		{Phase: profile.Parsing, Name: "bp.yaml", Duration: 20 * time.Millisecond},
+		{Phase: profile.Validation, Name: "test_zone_exists", Duration: time.Second},
+		{Phase: profile.Validation, Name: "test_apis_enabled", Duration: 500 * time.Millisecond},
+	}
+	var b strings.Builder
+	writeMetrics(&b, time.UnixMilli(1700000000500), steps,
+		map[string]bool{"test_zone_exists": true}, map[string]int{"200": 3, "429": 1})
+	c.Check(b.String(), Equals, ""+
+		"# HELP ghpc_run_end_timestamp_seconds Time the run of ghpc ended.\n"+
+		"# TYPE ghpc_run_end_timestamp_seconds gauge\n"+
+		"ghpc_run_end_timestamp_seconds 1.7000000005e+09\n"+
+		"# HELP ghpc_phase_duration_seconds Time spent in phases of the run: parsing, module info, expansion, validation and writing.\n"+
+		"# TYPE ghpc_phase_duration_seconds gauge\n"+
+		"ghpc_phase_duration_seconds{phase=\"parsing\"} 0.02\n"+
+		"ghpc_phase_duration_seconds{phase=\"validation\"} 1.5\n"+
+		"# HELP ghpc_validator_duration_seconds Time spent in each validator that ran.\n"+
+		"# TYPE ghpc_validator_duration_seconds gauge\n"+
+		"ghpc_validator_duration_seconds{validator=\"test_apis_enabled\"} 0.5\n"+
+		"ghpc_validator_duration_seconds{validator=\"test_zone_exists\"} 1\n"+
+		"# HELP ghpc_validator_failed Whether the validator failed (1) or passed (0).\n"+
+		"# TYPE ghpc_validator_failed gauge\n"+
+		"ghpc_validator_failed{validator=\"test_apis_enabled\"} 0\n"+
+		"ghpc_validator_failed{validator=\"test_zone_exists\"} 1\n"+
+		"# HELP ghpc_api_requests_total Requests to Google Cloud APIs by HTTP status code, retries included; \"error\" if no response was received.\n"+
+		"# TYPE ghpc_api_requests_total counter\n"+
+		"ghpc_api_requests_total{code=\"200\"} 3\n"+
+		"ghpc_api_requests_total{code=\"429\"} 1\n")
+}
+
+func (s *MySuite) TestWriteMetricsMaybe(c *C) {
+	defer func(p string, f map[string]bool) { metricsPath, failedValidators = p, f }(metricsPath, failedValidators)
+	metricsPath = filepath.Join(c.MkDir(), "ghpc.prom")
+	failedValidators = map[string]bool{}
+
+	errs := config.Errors{}
+	errs.Add(validators.ValidatorError{Validator: "test_zone_exists", Err: errors.New("no such zone")})
+	errs.Add(errors.New("malformed"))
+	recordFailedValidators(errs)
+	c.Check(failedValidators, DeepEquals, map[string]bool{"test_zone_exists": true})
+
+	writeMetricsMaybe()
+	b, err := os.ReadFile(metricsPath)
+	c.Assert(err, IsNil)
+	c.Check(string(b), Matches, `(?s)# HELP ghpc_run_end_timestamp_seconds .*`)
+	tmp, _ := filepath.Glob(filepath.Join(filepath.Dir(metricsPath), ".ghpc-metrics-*"))
+	c.Check(tmp, HasLen, 0)
+}
@@ -0,0 +1,246 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/logging"
+	"hpc-toolkit/pkg/modulewriter"
+	"hpc-toolkit/pkg/shell"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/spf13/cobra"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func init() {
+	migrateBackendCmd.Flags().BoolVar(&migrateBackendFlags.execute, "execute", false,
+		"Execute the migration instead of printing the steps to perform it manually.")
+	rootCmd.AddCommand(
+		addAutoApproveFlag(
+			addExpandFlags(migrateBackendCmd, false /*addOutFlag*/)))
+}
+
+var (
+	migrateBackendFlags = struct {
+		execute bool
+	}{}
+
+	migrateBackendCmd = &cobra.Command{
+		Use:   "migrate-backend <DEPLOYMENT_DIRECTORY> <BLUEPRINT_FILE>",
+		Short: "Migrate Terraform state of deployment groups whose backend has changed.",
+		Long: "Compare Terraform backends of the deployment with backends configured by the blueprint " +
+			"and print the steps migrating state of every changed deployment group: backup of the state, " +
+			"re-writing of the deployment directory and `terraform init -migrate-state`. " +
+			"With --execute the steps are performed, and the number of resources in the migrated state is verified.",
+		Args:         cobra.MatchAll(cobra.ExactArgs(2), checkDir, checkBlueprintExists),
+		Run:          runMigrateBackendCmd,
+		SilenceUsage: true,
+	}
+)
+
+// backendChange is a change of Terraform backend of a deployment group
+type backendChange struct {
+	group config.GroupName
+	from  config.TerraformBackend
+	to    config.TerraformBackend
+}
+
+func runMigrateBackendCmd(cmd *cobra.Command, args []string) {
+	deplDir, bpPath := args[0], args[1]
+	artDir := modulewriter.ArtifactsDir(deplDir)
+	checkErr(shell.CheckWritableDir(artDir), nil)
+	prev, _ := artifactBlueprintOrDie(artDir)
+
+	bp, ctx := expandOrDie(bpPath)
+	checkErr(checkSameDeployment(prev, bp), ctx)
+	changes, err := changedBackends(prev, bp)
+	checkErr(err, ctx)
+	if len(changes) == 0 {
+		logging.Info("Terraform backends of deployment %q are unchanged, there is nothing to migrate.", deplDir)
+		return
+	}
+
+	now := time.Now()
+	archive := modulewriter.ArchiveDir(deplDir, now)
+	if !migrateBackendFlags.execute {
+		writeMigrationSteps(os.Stdout, deplDir, bpPath, archive, changes)
+		logging.Info("")
+		logging.Info("Run with --execute to perform these steps.")
+		return
+	}
+
+	summary := fmt.Sprintf("migrate state of %d deployment group(s) to new backends", len(changes))
+	var full strings.Builder
+	writeMigrationSteps(&full, deplDir, bpPath, archive, changes)
+	if !flagAutoApprove && !shell.ApplyChangesChoice(shell.ProposedChanges{Summary: summary, Full: full.String()}) {
+		logging.Info("State of deployment %q was not migrated.", deplDir)
+		return
+	}
+	checkErr(migrateBackends(deplDir, bp, now, changes), ctx)
+	logging.Info(boldGreen("State of %d deployment group(s) was migrated, backups are saved in %s"), len(changes), archive)
+}
+
+// checkSameDeployment verifies that the blueprint describes the deployment and can be
+// written over it
+func checkSameDeployment(prev config.Blueprint, bp config.Blueprint) error {
+	if prev.DeploymentName() != bp.DeploymentName() {
+		return fmt.Errorf("deployment_name has changed from %q to %q, create a new deployment instead of upgrading",
+			prev.DeploymentName(), bp.DeploymentName())
+	}
+	return checkGroupsNotRemoved(prev, bp)
+}
+
+// changedBackends returns Terraform groups of the previous (materialized) deployment
+// which backend is changed by the new blueprint
+func changedBackends(prev config.Blueprint, bp config.Blueprint) ([]backendChange, error) {
+	next := bp.Clone()
+	if err := next.Materialize(); err != nil {
+		return nil, err
+	}
+	changes := []backendChange{}
+	for _, g := range next.Groups {
+		pg, err := prev.Group(g.Name)
+		if err != nil || g.Kind() != config.TerraformKind {
+			continue // new group or has no Terraform state
+		}
+		if !sameBackend(pg.TerraformBackend, g.TerraformBackend) {
+			changes = append(changes, backendChange{group: g.Name, from: pg.TerraformBackend, to: g.TerraformBackend})
+		}
+	}
+	return changes, nil
+}
+
+func sameBackend(a config.TerraformBackend, b config.TerraformBackend) bool {
+	return backendType(a) == backendType(b) && a.Configuration.AsObject().RawEquals(b.Configuration.AsObject())
+}
+
+// backendType returns type of the backend, Terraform uses "local" backend if none is configured
+func backendType(be config.TerraformBackend) string {
+	if be.Type == "" {
+		return "local"
+	}
+	return be.Type
+}
+
+func describeBackend(be config.TerraformBackend) string {
+	keys := be.Configuration.Keys()
+	if len(keys) == 0 {
+		return backendType(be)
+	}
+	sort.Strings(keys)
+	kv := make([]string, len(keys))
+	for i, k := range keys {
+		v := be.Configuration.Get(k)
+		if v.Type() == cty.String && v.IsKnown() && !v.IsNull() {
+			kv[i] = fmt.Sprintf("%s=%s", k, v.AsString())
+		} else {
+			kv[i] = fmt.Sprintf("%s=%s", k, hclwrite.TokensForValue(v).Bytes())
+		}
+	}
+	return fmt.Sprintf("%s (%s)", backendType(be), strings.Join(kv, ", "))
+}
+
+// writeMigrationSteps writes shell commands performing the migration,
+// mirroring what migrateBackends does
+func writeMigrationSteps(w io.Writer, deplDir string, bpPath string, archive string, changes []backendChange) {
+	fmt.Fprintln(w, "# Back up state of deployment groups with changed backends")
+	fmt.Fprintf(w, "mkdir -p %s\n", archive)
+	for _, ch := range changes {
+		fmt.Fprintf(w, "terraform -chdir=%s state pull > %s\n",
+			filepath.Join(deplDir, string(ch.group)), filepath.Join(archive, string(ch.group)+".tfstate"))
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "# Re-write the deployment directory with new backends, use the same flags as for this command")
+	fmt.Fprintf(w, "%s create %s --out %s -w\n", execPath(), bpPath, filepath.Dir(filepath.Clean(deplDir)))
+
+	for _, ch := range changes {
+		groupDir := filepath.Join(deplDir, string(ch.group))
+		initFile := filepath.Join(modulewriter.PreviousGroupDir(deplDir, ch.group), modulewriter.BackendInitFile)
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "# Migrate state of deployment group %q: %s -> %s\n", ch.group, describeBackend(ch.from), describeBackend(ch.to))
+		fmt.Fprintf(w, "[ -f %s ] && mkdir -p %s && cp %s %s\n",
+			initFile, filepath.Join(groupDir, ".terraform"), initFile, filepath.Join(groupDir, modulewriter.BackendInitFile))
+		fmt.Fprintf(w, "terraform -chdir=%s init -migrate-state -force-copy\n", groupDir)
+		fmt.Fprintf(w, "terraform -chdir=%s state list\n", groupDir)
+	}
+}
+
+// migrateBackends backs up state of changed groups, re-writes the deployment
+// and migrates the state to new backends
+func migrateBackends(deplDir string, bp config.Blueprint, now time.Time, changes []backendChange) error {
+	archive := modulewriter.ArchiveDir(deplDir, now)
+	if err := os.MkdirAll(archive, 0700); err != nil {
+		return err
+	}
+
+	counts := map[config.GroupName]int{}
+	for _, ch := range changes {
+		tf, err := shell.ConfigureTerraform(filepath.Join(deplDir, string(ch.group)))
+		if err != nil {
+			return err
+		}
+		state, n, err := shell.PullState(tf)
+		if err != nil {
+			return err
+		}
+		backup := filepath.Join(archive, string(ch.group)+".tfstate")
+		logging.Info("Saving state of deployment group %s with %d resource(s) to %s", ch.group, n, backup)
+		if err := os.WriteFile(backup, []byte(state), 0600); err != nil {
+			return err
+		}
+		counts[ch.group] = n
+	}
+
+	if _, err := modulewriter.ArchiveArtifacts(deplDir, modulewriter.ArtifactsDir(deplDir), now); err != nil {
+		return err
+	}
+	logging.Info("Re-writing deployment folder %q with new backends ...", deplDir)
+	if err := modulewriter.WriteDeployment(bp, deplDir); err != nil {
+		return err
+	}
+
+	for _, ch := range changes {
+		if err := modulewriter.RestoreBackendInit(deplDir, ch.group); err != nil {
+			return err
+		}
+		tf, err := shell.ConfigureTerraform(filepath.Join(deplDir, string(ch.group)))
+		if err != nil {
+			return err
+		}
+		if err := shell.MigrateState(tf); err != nil {
+			return err
+		}
+		_, n, err := shell.PullState(tf)
+		if err != nil {
+			return err
+		}
+		if n != counts[ch.group] {
+			return config.HintError{
+				Err: fmt.Errorf("state of deployment group %q has %d resource(s) after migration, expected %d",
+					ch.group, n, counts[ch.group]),
+				Hint: fmt.Sprintf("the state before migration is saved in %s", filepath.Join(archive, string(ch.group)+".tfstate"))}
+		}
+	}
+	return nil
+}
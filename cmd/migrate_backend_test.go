@@ -0,0 +1,86 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"hpc-toolkit/pkg/config"
+
+	"github.com/zclconf/go-cty/cty"
+	. "gopkg.in/check.v1"
+)
+
+func gcsBackend(bucket string) config.TerraformBackend {
+	return config.TerraformBackend{
+		Type:          "gcs",
+		Configuration: config.NewDict(map[string]cty.Value{"bucket": cty.StringVal(bucket), "prefix": cty.StringVal("lime")})}
+}
+
+func (s *MySuite) TestChangedBackends(c *C) {
+	tf := []config.Module{{ID: "net", Kind: config.TerraformKind}}
+	pkr := []config.Module{{ID: "img", Kind: config.PackerKind}}
+	prev := config.Blueprint{Groups: []config.Group{
+		{Name: "green", Modules: tf},
+		{Name: "yellow", TerraformBackend: gcsBackend("sour"), Modules: tf},
+		{Name: "image", Modules: pkr},
+	}}
+
+	{ // unchanged, explicit local backend is the same as unset
+		bp := config.Blueprint{Groups: []config.Group{
+			{Name: "green", TerraformBackend: config.TerraformBackend{Type: "local"}, Modules: tf},
+			{Name: "yellow", TerraformBackend: gcsBackend("sour"), Modules: tf},
+			{Name: "image", TerraformBackend: gcsBackend("sour"), Modules: pkr}, // not terraform
+			{Name: "red", TerraformBackend: gcsBackend("sour"), Modules: tf},    // new group
+		}}
+		got, err := changedBackends(prev, bp)
+		c.Assert(err, IsNil)
+		c.Check(got, HasLen, 0)
+	}
+
+	{ // local -> gcs, bucket rename
+		bp := config.Blueprint{Groups: []config.Group{
+			{Name: "green", TerraformBackend: gcsBackend("sour"), Modules: tf},
+			{Name: "yellow", TerraformBackend: gcsBackend("sweet"), Modules: tf},
+			{Name: "image", Modules: pkr},
+		}}
+		got, err := changedBackends(prev, bp)
+		c.Assert(err, IsNil)
+		c.Assert(got, HasLen, 2)
+		c.Check(got[0].group, Equals, config.GroupName("green"))
+		c.Check(describeBackend(got[0].from), Equals, "local")
+		c.Check(describeBackend(got[0].to), Equals, "gcs (bucket=sour, prefix=lime)")
+		c.Check(got[1].group, Equals, config.GroupName("yellow"))
+		c.Check(describeBackend(got[1].to), Equals, "gcs (bucket=sweet, prefix=lime)")
+	}
+}
+
+func (s *MySuite) TestWriteMigrationSteps(c *C) {
+	var b bytes.Buffer
+	writeMigrationSteps(&b, "out/lime", "lime.yaml", "out/lime/.ghpc/history/20240314T150926Z", []backendChange{
+		{group: "green", to: gcsBackend("sour")},
+	})
+	c.Check(b.String(), Matches, `(?s)# Back up state .*
+mkdir -p out/lime/.ghpc/history/20240314T150926Z
+terraform -chdir=out/lime/green state pull > out/lime/.ghpc/history/20240314T150926Z/green.tfstate
+
+# Re-write the deployment directory .*
+.* create lime.yaml --out out -w
+
+# Migrate state of deployment group "green": local -> gcs \(bucket=sour, prefix=lime\)
+\[ -f out/lime/.ghpc/previous_deployment_groups/green/.terraform/terraform.tfstate \] && .*
+terraform -chdir=out/lime/green init -migrate-state -force-copy
+terraform -chdir=out/lime/green state list
+`)
+}
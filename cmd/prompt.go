@@ -0,0 +1,153 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/logging"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultDeploymentFile is suggested to save answers to if no deployment file is used
+const defaultDeploymentFile = "deployment.yaml"
+
+// promptUnsetValues asks the user for values of deployment variables and required
+// module inputs that are not set, and adds answers to deployment variables.
+// Offers to save answers to the deployment file.
+func promptUnsetValues(bp config.Blueprint, ds *config.DeploymentSettings) {
+	in := bufio.NewReader(os.Stdin)
+	answers := config.Dict{}
+	for _, u := range bp.UnsetValues() {
+		v, ok, err := promptValue(in, os.Stdout, u)
+		if err != nil {
+			logging.Fatal("failed to read value of %q: %v", u.Name, err)
+		}
+		if ok {
+			answers = answers.With(u.Name, v)
+		}
+	}
+	if answers.IsZero() {
+		return
+	}
+	for k, v := range answers.Items() {
+		ds.Vars = ds.Vars.With(k, v)
+	}
+
+	dst := expandFlags.deploymentFile
+	if dst == "" {
+		dst = defaultDeploymentFile
+	}
+	save, err := promptYesNo(in, os.Stdout, fmt.Sprintf("Save answers to deployment file %s?", dst))
+	if err != nil {
+		logging.Fatal("%v", err)
+	}
+	if save {
+		checkErr(saveDeploymentVars(dst, answers), nil)
+		logging.Info("Answers saved, use `--deployment-file %s` to reuse them.", dst)
+	}
+}
+
+// promptValue asks for the value until it can be parsed as a value of the expected type.
+// Returns false if the answer is empty and there is no default value.
+func promptValue(in *bufio.Reader, out io.Writer, u config.UnsetValue) (cty.Value, bool, error) {
+	fmt.Fprintln(out)
+	if u.Description != "" {
+		fmt.Fprintf(out, "%s\n", u.Description)
+	}
+	if len(u.Modules) > 0 {
+		ids := []string{}
+		for _, id := range u.Modules {
+			ids = append(ids, string(id))
+		}
+		fmt.Fprintf(out, "Required by modules: %s\n", strings.Join(ids, ", "))
+	}
+	prompt := u.Name
+	if u.Type != cty.NilType && u.Type != cty.DynamicPseudoType {
+		prompt += fmt.Sprintf(" (%s)", u.Type.FriendlyName())
+	}
+	if u.Default != cty.NilVal {
+		prompt += fmt.Sprintf(" [%s]", strings.TrimSpace(string(config.TokensForValue(u.Default).Bytes())))
+	}
+
+	for {
+		fmt.Fprintf(out, "%s: ", prompt)
+		s, err := in.ReadString('\n')
+		if err != nil && (err != io.EOF || s == "") {
+			return cty.NilVal, false, err
+		}
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return u.Default, u.Default != cty.NilVal, nil
+		}
+		v, err := parsePromptAnswer(s, u.Type)
+		if err == nil {
+			return v, true, nil
+		}
+		fmt.Fprintf(out, "Invalid value: %v\n", err)
+	}
+}
+
+// parsePromptAnswer parses the answer as a value of type t.
+// Strings are taken verbatim, other values are parsed as YAML, same as `--vars`.
+func parsePromptAnswer(s string, t cty.Type) (cty.Value, error) {
+	if t == cty.String {
+		return cty.StringVal(s), nil
+	}
+	var y config.YamlValue
+	if err := yaml.Unmarshal([]byte(s), &y); err != nil {
+		return cty.NilVal, fmt.Errorf("unable to convert %q to known type", s)
+	}
+	v := y.Unwrap()
+	if t == cty.NilType || t == cty.DynamicPseudoType {
+		return v, nil
+	}
+	return convert.Convert(v, t)
+}
+
+func promptYesNo(in *bufio.Reader, out io.Writer, question string) (bool, error) {
+	fmt.Fprintf(out, "%s [y/N]: ", question)
+	s, err := in.ReadString('\n')
+	if err != nil && (err != io.EOF || s == "") {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
+// saveDeploymentVars adds deployment variables to the deployment file,
+// preserving its other content.
+func saveDeploymentVars(path string, vars config.Dict) error {
+	saved := config.DeploymentSettings{}
+	if _, err := os.Stat(path); err == nil {
+		if saved, _, err = config.NewDeploymentSettings(path); err != nil {
+			return err
+		}
+	}
+	for k, v := range vars.Items() {
+		saved.Vars = saved.Vars.With(k, v)
+	}
+	return saved.Export(path)
+}
@@ -0,0 +1,120 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"hpc-toolkit/pkg/config"
+	"path/filepath"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestParsePromptAnswer(c *C) {
+	type test struct {
+		in   string
+		ty   cty.Type
+		want cty.Value
+		err  bool
+	}
+	for _, t := range []test{
+		{"007", cty.String, cty.StringVal("007"), false},
+		{"true", cty.String, cty.StringVal("true"), false},
+		{"7", cty.Number, cty.NumberIntVal(7), false},
+		{"seven", cty.Number, cty.NilVal, true},
+		{"yes", cty.Bool, cty.NilVal, true},
+		{"true", cty.Bool, cty.True, false},
+		{"[a, b]", cty.List(cty.String), cty.ListVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}), false},
+		{"{a: 1}", cty.Map(cty.Number), cty.MapVal(map[string]cty.Value{"a": cty.NumberIntVal(1)}), false},
+		{"7", cty.NilType, cty.NumberIntVal(7), false},
+		{"green", cty.DynamicPseudoType, cty.StringVal("green"), false},
+	} {
+		got, err := parsePromptAnswer(t.in, t.ty)
+		if t.err {
+			c.Check(err, NotNil, Commentf("%q", t.in))
+			continue
+		}
+		c.Assert(err, IsNil, Commentf("%q", t.in))
+		c.Check(got.Equals(t.want), Equals, cty.True, Commentf("%q", t.in))
+	}
+}
+
+func (s *MySuite) TestPromptValue(c *C) {
+	h := func(input string, u config.UnsetValue) (cty.Value, bool, string) {
+		var out bytes.Buffer
+		v, ok, err := promptValue(bufio.NewReader(strings.NewReader(input)), &out, u)
+		c.Assert(err, IsNil)
+		return v, ok, out.String()
+	}
+	size := config.UnsetValue{
+		Name: "size", Type: cty.Number, Description: "size in GB", Modules: []config.ModuleID{"a", "b"}}
+
+	{ // retries until value is valid
+		v, ok, out := h("big\n10\n", size)
+		c.Check(ok, Equals, true)
+		c.Check(v.Equals(cty.NumberIntVal(10)), Equals, cty.True)
+		c.Check(out, Matches, "(?s).*size in GB\nRequired by modules: a, b\nsize \\(number\\): Invalid value.*")
+	}
+
+	{ // empty answer without default
+		_, ok, _ := h("\n", size)
+		c.Check(ok, Equals, false)
+	}
+
+	{ // empty answer with default
+		size.Default = cty.NumberIntVal(50)
+		v, ok, out := h("\n", size)
+		c.Check(ok, Equals, true)
+		c.Check(v.Equals(cty.NumberIntVal(50)), Equals, cty.True)
+		c.Check(out, Matches, "(?s).*size \\(number\\) \\[50\\]: $")
+	}
+
+	{ // no trailing new line
+		v, ok, _ := h("20", size)
+		c.Check(ok, Equals, true)
+		c.Check(v.Equals(cty.NumberIntVal(20)), Equals, cty.True)
+	}
+
+	{ // EOF
+		var out bytes.Buffer
+		_, _, err := promptValue(bufio.NewReader(strings.NewReader("")), &out, size)
+		c.Check(err, NotNil)
+	}
+}
+
+func (s *MySuite) TestSaveDeploymentVars(c *C) {
+	path := filepath.Join(c.MkDir(), "deployment.yaml")
+	c.Assert(config.DeploymentSettings{
+		Vars: config.NewDict(map[string]cty.Value{
+			"project_id": cty.StringVal("pink"),
+			"zone":       cty.StringVal("us-central1-a")}),
+		TerraformBackendDefaults: config.TerraformBackend{Type: "gcs"},
+	}.Export(path), IsNil)
+
+	c.Assert(saveDeploymentVars(path, config.NewDict(map[string]cty.Value{
+		"zone": cty.StringVal("europe-west4-a"),
+		"size": cty.NumberIntVal(10)})), IsNil)
+
+	got, _, err := config.NewDeploymentSettings(path)
+	c.Assert(err, IsNil)
+	c.Check(got.TerraformBackendDefaults.Type, Equals, "gcs")
+	c.Check(got.Vars.Items(), DeepEquals, map[string]cty.Value{
+		"project_id": cty.StringVal("pink"),
+		"zone":       cty.StringVal("europe-west4-a"),
+		"size":       cty.NumberIntVal(10)})
+}
@@ -0,0 +1,40 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"hpc-toolkit/pkg/validators"
+	"os"
+)
+
+// quotaRequestsPath is set by `--quota-requests` flag
+var quotaRequestsPath string
+
+// writeQuotaRequestsMaybe writes quota increases needed by the deployment, as found
+// by validators, to the file specified by `--quota-requests` flag, if any.
+// The file holds an empty array if no quota is exceeded.
+func writeQuotaRequestsMaybe(errs ...error) {
+	if quotaRequestsPath == "" {
+		return
+	}
+	reqs := []validators.QuotaIncreaseRequest{}
+	for _, err := range errs {
+		reqs = append(reqs, validators.QuotaIncreaseRequests(err)...)
+	}
+	b, err := json.MarshalIndent(reqs, "", "  ")
+	checkErr(err, nil)
+	checkErr(os.WriteFile(quotaRequestsPath, append(b, '\n'), 0644), nil)
+}
@@ -0,0 +1,45 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"hpc-toolkit/pkg/validators"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestWriteQuotaRequests(c *C) {
+	defer func(p string) { quotaRequestsPath = p }(quotaRequestsPath)
+	quotaRequestsPath = filepath.Join(c.MkDir(), "quota.json")
+	req := validators.QuotaIncreaseRequest{Project: "p", Region: "r", Metric: "CPUS",
+		CurrentLimit: 24, CurrentUsage: 8, Required: 32, RequiredLimit: 40, Modules: []string{"vm"}}
+	found := validators.ValidatorError{Validator: "quota", Err: validators.QuotaError{Request: req}}
+
+	writeQuotaRequestsMaybe(errors.New("other"), found)
+	b, err := os.ReadFile(quotaRequestsPath)
+	c.Assert(err, IsNil)
+	var got []validators.QuotaIncreaseRequest
+	c.Assert(json.Unmarshal(b, &got), IsNil)
+	c.Check(got, DeepEquals, []validators.QuotaIncreaseRequest{req})
+
+	writeQuotaRequestsMaybe(nil)
+	b, err = os.ReadFile(quotaRequestsPath)
+	c.Assert(err, IsNil)
+	c.Check(string(b), Equals, "[]\n")
+}
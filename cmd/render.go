@@ -42,9 +42,50 @@ func renderError(err error, ctx config.YamlCtx) string {
 		return renderBpError(te, ctx)
 	case config.PosError:
 		return renderPosError(te, ctx)
+	case config.CodedError:
+		switch te.Err.(type) {
+		case config.Errors, config.HintError, config.BpError, config.PosError:
+			return renderError(pushCode(te.Code, te.Err), ctx)
+		}
+		return renderCodedError(te.Code, te.Err)
 	default:
+		return renderCodedError(config.ErrorCodeOf(err), err)
+	}
+}
+
+func renderCodedError(code config.ErrorCode, err error) string {
+	if code == "" {
 		return fmt.Sprintf("%s: %s", boldRed("Error"), err)
 	}
+	return fmt.Sprintf("%s %s: %s", boldRed("Error"), boldRed("["+string(code)+"]"), err)
+}
+
+// pushCode moves the code to the innermost error, so it is rendered next to the message
+func pushCode(code config.ErrorCode, err error) error {
+	switch te := err.(type) {
+	case config.Errors:
+		errs := config.Errors{}
+		for _, e := range te.Errors {
+			errs.Add(pushCode(code, e))
+		}
+		return errs
+	case config.HintError:
+		te.Err = pushCode(code, te.Err)
+		return te
+	case config.BpError:
+		te.Err = pushCode(code, te.Err)
+		return te
+	case config.PosError:
+		te.Err = pushCode(code, te.Err)
+		return te
+	case config.CodedError:
+		return te
+	default:
+		if config.ErrorCodeOf(err) != "" {
+			return err
+		}
+		return config.CodedError{Code: code, Err: err}
+	}
 }
 
 func renderMultiError(errs config.Errors, ctx config.YamlCtx) string {
@@ -57,7 +98,7 @@ func renderMultiError(errs config.Errors, ctx config.YamlCtx) string {
 }
 
 func renderValidatorError(err validators.ValidatorError, ctx config.YamlCtx) string {
-	title := boldRed(fmt.Sprintf("validator %q failed:", err.Validator))
+	title := boldRed(fmt.Sprintf("validator %q failed [%s]:", err.Validator, err.Code()))
 	return fmt.Sprintf("%s\n%v\n", title, renderError(err.Err, ctx))
 }
 
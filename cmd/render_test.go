@@ -68,6 +68,21 @@ vars:
 Hint: did you mean 'kale'?
 3:   kale: dos
      ^`},
+		{ // coded error
+			err:  config.CodedError{Code: "GHPC0042", Err: errors.New("arbuz")},
+			ctx:  makeCtx("", t),
+			want: "Error [GHPC0042]: arbuz"},
+		{ // coded sentinel error
+			err:  config.BpError{Path: config.Root.Vars.Dot("kale"), Err: config.EmptyModuleID},
+			ctx:  makeCtx("", t),
+			want: "Error [GHPC1005]: a module id cannot be empty"},
+		{ // code is rendered next to the message
+			err: config.CodedError{Code: "GHPC0042", Err: config.HintError{
+				Hint: "did you mean 'kale'?",
+				Err:  errors.New("arbuz")}},
+			ctx: makeCtx("", t),
+			want: `Error [GHPC0042]: arbuz
+Hint: did you mean 'kale'?`},
 	}
 	for _, tc := range tests {
 		t.Run(tc.want, func(t *testing.T) {
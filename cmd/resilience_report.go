@@ -0,0 +1,83 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"hpc-toolkit/pkg/resilience"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	resilienceReportCmd.Flags().StringVar(&resilienceReportFlags.format, "format", "text",
+		"Output format, one of \"text\" or \"json\".")
+	rootCmd.AddCommand(resilienceReportCmd)
+}
+
+var (
+	resilienceReportFlags = struct {
+		format string
+	}{}
+
+	resilienceReportCmd = &cobra.Command{
+		Use:   "resilience-report BLUEPRINT_FILE",
+		Short: "Report how a cluster created from the blueprint tolerates failures.",
+		Long: "Expand the blueprint and report its resilience characteristics: single-zone single points of failure, " +
+			"such as controllers and zonal Filestore instances, behavior of instances under host maintenance, and " +
+			"exposure of partitions to Spot VM preemption, with recommendations.",
+		Args:              cobra.MatchAll(cobra.ExactArgs(1), checkExists),
+		ValidArgsFunction: filterYaml,
+		Run:               runResilienceReportCmd,
+		SilenceUsage:      true,
+	}
+)
+
+func runResilienceReportCmd(cmd *cobra.Command, args []string) {
+	bp, ctx, _ := expandWithPlaceholdersOrDie(args[0])
+	_, err := bp.ResolveDefaults()
+	checkErr(err, ctx)
+
+	report := resilience.Analyze(bp)
+	switch resilienceReportFlags.format {
+	case "text":
+		writeResilienceReport(os.Stdout, report)
+	case "json":
+		b, err := json.MarshalIndent(report, "", "  ")
+		checkErr(err, ctx)
+		fmt.Println(string(b))
+	default:
+		checkErr(fmt.Errorf("unknown format %q, expected one of text, json", resilienceReportFlags.format), ctx)
+	}
+}
+
+func writeResilienceReport(w io.Writer, r resilience.Report) {
+	if len(r.Findings) == 0 {
+		fmt.Fprintln(w, "No resilience findings.")
+		return
+	}
+	for i, f := range r.Findings {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s [%s] %s\n", strings.ToUpper(string(f.Severity)), f.Category, f.Module)
+		fmt.Fprintf(w, "  %s\n", f.Description)
+		fmt.Fprintf(w, "  Recommendation: %s\n", f.Recommendation)
+	}
+}
@@ -20,8 +20,11 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"hpc-toolkit/pkg/apiclient"
 	"hpc-toolkit/pkg/config"
 	"hpc-toolkit/pkg/logging"
+	"hpc-toolkit/pkg/profile"
+	"hpc-toolkit/pkg/sourcereader"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -57,10 +60,58 @@ HPC deployments on the Google Cloud Platform.`,
 	}
 )
 
+var apiLimits = apiclient.DefaultLimits
+
 func init() {
+	config.ToolkitVersion = rootCmd.Version
 	addColorFlag(rootCmd.PersistentFlags())
+	rootCmd.PersistentFlags().IntVar(&apiLimits.MaxConcurrency, "max-api-concurrency", apiclient.DefaultLimits.MaxConcurrency,
+		"Maximum number of concurrent requests to Google Cloud APIs.")
+	rootCmd.PersistentFlags().Float64Var(&apiLimits.QPS, "api-qps", apiclient.DefaultLimits.QPS,
+		"Maximum number of requests per second to Google Cloud APIs.")
+	rootCmd.PersistentFlags().IntVar(&apiLimits.MaxRetries, "api-max-retries", apiclient.DefaultLimits.MaxRetries,
+		"Maximum number of retries of requests to Google Cloud APIs rejected due to rate limits or transient errors.")
+	rootCmd.PersistentFlags().StringVar(&logging.WarningsFile, "warnings-json", "",
+		"Write warnings of the run to this file as a JSON array, also if the run fails.")
 	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
 		initColor()
+		apiclient.Configure(apiLimits)
+	}
+	rootCmd.PersistentPostRun = func(cmd *cobra.Command, args []string) {
+		stopProfiling()
+		logging.FlushWarnings()
+	}
+	logging.OnFatal(stopProfiling) // failed runs end in logging.Fatal, skipping PersistentPostRun
+}
+
+var stopCPUProfile func() error
+
+// startProfiling enables collection of timings and CPU profile if requested by flags
+func startProfiling() {
+	if expandFlags.profile || metricsPath != "" {
+		profile.Enable()
+	}
+	if expandFlags.cpuProfile != "" && stopCPUProfile == nil {
+		stop, err := profile.StartCPUProfile(expandFlags.cpuProfile)
+		checkErr(err, nil)
+		stopCPUProfile = stop
+	}
+}
+
+// stopProfiling reports collected timings and metrics, and finalizes CPU profile
+func stopProfiling() {
+	if stop := stopCPUProfile; stop != nil {
+		stopCPUProfile = nil
+		checkErr(stop(), nil)
+		logging.Info("CPU profile written to %s", expandFlags.cpuProfile)
+	}
+	writeMetricsMaybe()
+	if profile.Enabled() {
+		if expandFlags.profile {
+			logging.Info("")
+			profile.Report(os.Stdout)
+		}
+		profile.Reset()
 	}
 }
 
@@ -68,10 +119,22 @@ func init() {
 func Execute() error {
 	mismatch, branch, hash, dir := checkGitHashMismatch()
 	if mismatch {
-		logging.Error("WARNING: ghpc binary was built from a different commit (%s/%s) than the current git branch in %s (%s/%s). You can rebuild the binary by running 'make'",
-			GitBranch, GitCommitHash[0:7], dir, branch, hash[0:7])
+		logging.Warn(logging.Warning{Source: "ghpc",
+			Message: fmt.Sprintf("ghpc binary was built from a different commit (%s/%s) than the current git branch in %s (%s/%s)",
+				GitBranch, GitCommitHash[0:7], dir, branch, hash[0:7]),
+			Hint: "rebuild the binary by running 'make'"})
 	}
 
+	if err := sourcereader.VerifyEmbeddedModules(); err != nil {
+		logging.Warn(logging.Warning{Source: "ghpc",
+			Message: fmt.Sprintf("%v. Deployments can not be created with this binary", err),
+			Hint:    "reinstall or rebuild the binary by running 'make'"})
+	}
+
+	cobra.AddTemplateFunc("modulesDigest", modulesDigest)
+	rootCmd.SetVersionTemplate(`ghpc version {{.Version}}
+Modules digest: {{modulesDigest}}
+`)
 	if len(GitCommitInfo) > 0 {
 		if len(GitTagVersion) == 0 {
 			GitTagVersion = "- not built from official release"
@@ -85,12 +148,22 @@ func Execute() error {
 		rootCmd.SetVersionTemplate(`ghpc version {{index .Annotations "version"}}
 Built from '{{index .Annotations "branch"}}' branch.
 Commit info: {{index .Annotations "commitInfo"}}
+Modules digest: {{modulesDigest}}
 `)
 	}
 
 	return rootCmd.Execute()
 }
 
+// modulesDigest returns digest of the embedded module library, for supply-chain attestations
+func modulesDigest() string {
+	m, err := sourcereader.EmbeddedManifest()
+	if err != nil {
+		return "unknown (" + err.Error() + ")"
+	}
+	return "sha256:" + m.Digest()
+}
+
 // checkGitHashMismatch will compare the hash of the git repository vs the git
 // hash the ghpc binary was compiled against, if the git repository if found and
 // a mismatch is identified, then the function returns a positive bool along with
@@ -0,0 +1,235 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/validators"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/exp/maps"
+)
+
+// SARIF 2.1.0 subset, see https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+	// sarifBlueprintRule is a rule ID of findings that are not produced by validators
+	sarifBlueprintRule = "blueprint"
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	Name             string       `json:"name,omitempty"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+	HelpURI          string       `json:"helpUri,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// finding is a single, flattened, error with its location and hint
+type finding struct {
+	rule string
+	code config.ErrorCode
+	msg  string
+	hint string
+	pos  *config.Pos
+	// level overrides the level of the log, e.g. for failures of validators with severity WARNING
+	level string
+}
+
+// collectFindings flattens the error tree into list of findings
+func collectFindings(err error, ctx config.YamlCtx) []finding {
+	var walk func(err error, f finding) []finding
+	walk = func(err error, f finding) []finding {
+		switch te := err.(type) {
+		case nil:
+			return nil
+		case config.Errors:
+			res := []finding{}
+			for _, e := range te.Errors {
+				res = append(res, walk(e, f)...)
+			}
+			return res
+		case validators.ValidatorError:
+			f.rule, f.code = te.Validator, te.Code()
+			return walk(te.Err, f)
+		case config.CodedError: // the innermost code is the most specific one
+			f.code = te.Code
+			return walk(te.Err, f)
+		case config.HintError:
+			f.hint = te.Hint
+			return walk(te.Err, f)
+		case config.BpError:
+			if pos, ok := findPos(te.Path, ctx); ok {
+				f.pos = &pos
+			}
+			return walk(te.Err, f)
+		case config.PosError:
+			pos := te.Pos
+			f.pos = &pos
+			return walk(te.Err, f)
+		default:
+			if code := config.ErrorCodeOf(err); code != "" {
+				f.code = code
+			}
+			f.msg = err.Error()
+			return []finding{f}
+		}
+	}
+	return walk(err, finding{rule: sarifBlueprintRule})
+}
+
+// newSarifLog builds SARIF log of findings of blueprint located at bpPath
+func newSarifLog(bpPath string, findings []finding, level string) sarifLog {
+	uri := filepath.ToSlash(bpPath)
+	rules := map[string]sarifRule{}
+	results := []sarifResult{}
+	for _, f := range findings {
+		rule := newSarifRule(f)
+		rules[rule.ID] = rule
+		r := sarifResult{
+			RuleID:  rule.ID,
+			Level:   level,
+			Message: sarifMessage{Text: f.msg},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: uri}}}},
+		}
+		if f.level != "" {
+			r.Level = f.level
+		}
+		if f.pos != nil {
+			region := &sarifRegion{StartLine: f.pos.Line, StartColumn: f.pos.Column}
+			r.Locations[0].PhysicalLocation.Region = region
+		}
+		if f.hint != "" {
+			// Hints are free-form suggestions, not machine-applicable fixes
+			r.Message.Text = fmt.Sprintf("%s\nHint: %s", f.msg, f.hint)
+		}
+		results = append(results, r)
+	}
+
+	ruleIDs := maps.Keys(rules)
+	sort.Strings(ruleIDs)
+	sRules := []sarifRule{}
+	for _, id := range ruleIDs {
+		sRules = append(sRules, rules[id])
+	}
+
+	return sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "ghpc",
+				Version:        GitTagVersion,
+				InformationURI: "https://github.com/GoogleCloudPlatform/hpc-toolkit",
+				Rules:          sRules,
+			}},
+			Results: results,
+		}},
+	}
+}
+
+// newSarifRule returns a rule of the finding, identified by the error code if one is known
+func newSarifRule(f finding) sarifRule {
+	if info, ok := errorCodeInfo(f.code); ok {
+		return sarifRule{
+			ID:               string(f.code),
+			Name:             f.rule,
+			ShortDescription: sarifMessage{Text: info.Title},
+			HelpURI:          errorCodeURL(f.code),
+		}
+	}
+	desc := fmt.Sprintf("validator %q", f.rule)
+	if f.rule == sarifBlueprintRule {
+		desc = "blueprint is malformed or can not be expanded"
+	}
+	return sarifRule{
+		ID:               f.rule,
+		ShortDescription: sarifMessage{Text: desc},
+		HelpURI:          "https://goo.gle/hpc-toolkit-validation",
+	}
+}
+
+// writeSarifMaybe writes findings to the file specified by `--sarif` flag, if any,
+// failures of validators treated as warnings are passed separately from errors
+func writeSarifMaybe(bpPath string, err error, warnings error, ctx config.YamlCtx) {
+	if expandFlags.sarifPath == "" {
+		return
+	}
+	findings := collectFindings(err, ctx)
+	for _, f := range collectFindings(warnings, ctx) {
+		f.level = "warning"
+		findings = append(findings, f)
+	}
+	log := newSarifLog(bpPath, findings, "error")
+	b, jErr := json.MarshalIndent(log, "", "  ")
+	checkErr(jErr, nil)
+	checkErr(os.WriteFile(expandFlags.sarifPath, b, 0644), nil)
+}
@@ -0,0 +1,138 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/logging"
+	"hpc-toolkit/pkg/validators"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestCollectFindings(c *C) {
+	ctx, _ := config.NewYamlCtx([]byte(`
+vars:
+  project_id: pink
+`))
+	pid := config.Root.Vars.Dot("project_id")
+
+	c.Check(collectFindings(nil, ctx), HasLen, 0)
+
+	errs := config.Errors{}
+	errs.
+		Add(validators.ValidatorError{
+			Validator: "test_project_exists",
+			Err:       config.HintError{Hint: "check the ID", Err: config.BpError{Path: pid, Err: errors.New("no such project")}}}).
+		Add(config.PosError{Pos: config.Pos{Line: 7, Column: 3}, Err: errors.New("bad yaml")}).
+		Add(errors.New("unlocated"))
+
+	got := collectFindings(errs, ctx)
+	c.Assert(got, HasLen, 3)
+
+	c.Check(got[0].rule, Equals, "test_project_exists")
+	c.Check(got[0].msg, Equals, "no such project")
+	c.Check(got[0].hint, Equals, "check the ID")
+	c.Check(*got[0].pos, DeepEquals, config.Pos{Line: 3, Column: 3})
+
+	c.Check(got[1].rule, Equals, sarifBlueprintRule)
+	c.Check(*got[1].pos, DeepEquals, config.Pos{Line: 7, Column: 3})
+
+	c.Check(got[2].msg, Equals, "unlocated")
+	c.Check(got[2].pos, IsNil)
+}
+
+func (s *MySuite) TestNewSarifLog(c *C) {
+	log := newSarifLog("bp.yaml", []finding{
+		{rule: "test_b", msg: "oops", hint: "fix it", pos: &config.Pos{Line: 2, Column: 5}},
+		{rule: "test_a", msg: "whoops"},
+		{rule: "test_b", msg: "again"},
+	}, "warning")
+
+	c.Check(log.Version, Equals, "2.1.0")
+	c.Assert(log.Runs, HasLen, 1)
+	run := log.Runs[0]
+
+	ids := []string{}
+	for _, r := range run.Tool.Driver.Rules {
+		ids = append(ids, r.ID)
+	}
+	c.Check(ids, DeepEquals, []string{"test_a", "test_b"})
+
+	c.Assert(run.Results, HasLen, 3)
+	r := run.Results[0]
+	c.Check(r.RuleID, Equals, "test_b")
+	c.Check(r.Level, Equals, "warning")
+	c.Check(r.Message.Text, Equals, "oops\nHint: fix it")
+	c.Check(r.Locations[0].PhysicalLocation.ArtifactLocation.URI, Equals, "bp.yaml")
+	c.Check(*r.Locations[0].PhysicalLocation.Region, DeepEquals, sarifRegion{StartLine: 2, StartColumn: 5})
+	c.Check(run.Results[1].Locations[0].PhysicalLocation.Region, IsNil)
+}
+
+func (s *MySuite) TestSarifErrorCodes(c *C) {
+	errs := config.Errors{}
+	errs.
+		Add(validators.ValidatorError{Validator: "test_project_exists", Err: errors.New("no such project")}).
+		Add(config.CodedError{Code: config.CodeUnknownVariable, Err: errors.New("no var")})
+
+	got := collectFindings(errs, config.YamlCtx{})
+	c.Assert(got, HasLen, 2)
+	c.Check(got[0].code, Equals, config.ErrorCode("GHPC2002"))
+	c.Check(got[1].code, Equals, config.CodeUnknownVariable)
+
+	run := newSarifLog("bp.yaml", got, "error").Runs[0]
+	c.Assert(run.Tool.Driver.Rules, HasLen, 2)
+	c.Check(run.Tool.Driver.Rules[0], DeepEquals, sarifRule{
+		ID:               "GHPC1010",
+		Name:             sarifBlueprintRule,
+		ShortDescription: sarifMessage{Text: "Unknown deployment variable"},
+		HelpURI:          errorCodeURL(config.CodeUnknownVariable),
+	})
+	c.Check(run.Tool.Driver.Rules[1].Name, Equals, "test_project_exists")
+	c.Check(run.Results[0].RuleID, Equals, "GHPC2002")
+}
+
+func (s *MySuite) TestWarnFindings(c *C) {
+	logging.ResetWarnings()
+	defer logging.ResetWarnings()
+	ctx, _ := config.NewYamlCtx([]byte(`
+vars:
+  project_id: pink
+`))
+	pid := config.Root.Vars.Dot("project_id")
+	warnFindings(validators.ValidatorError{
+		Validator: "test_project_exists",
+		Err:       config.HintError{Hint: "check the ID", Err: config.BpError{Path: pid, Err: errors.New("no such project")}}}, ctx)
+	warnFindings(errors.New("unlocated"), ctx)
+
+	got := logging.Warnings()
+	c.Assert(got, HasLen, 2)
+	c.Check(got[0].Source, Equals, "test_project_exists")
+	c.Check(got[0].Code, Not(Equals), "")
+	c.Check(got[0].Location, Equals, "line 3")
+	c.Check(got[0].Message, Equals, "no such project")
+	c.Check(got[0].Hint, Equals, "check the ID")
+	c.Check(got[1], DeepEquals, logging.Warning{Source: sarifBlueprintRule, Message: "unlocated"})
+}
+
+func (s *MySuite) TestNewSarifLogWarnings(c *C) {
+	run := newSarifLog("bp.yaml", []finding{
+		{rule: "test_quota_sufficient", msg: "not enough quota", level: "warning"},
+		{rule: "test_project_exists", msg: "no such project"},
+	}, "error").Runs[0]
+	c.Check(run.Results[0].Level, Equals, "warning")
+	c.Check(run.Results[1].Level, Equals, "error")
+}
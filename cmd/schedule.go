@@ -0,0 +1,245 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/logging"
+	"hpc-toolkit/pkg/shell"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
+)
+
+const scheduleTimeFormat = "Mon, 02 Jan 2006 15:04 MST"
+
+func init() {
+	scheduleCmd.AddCommand(
+		addArtifactsDirFlag(scheduleStatusCmd),
+		addArtifactsDirFlag(scheduleCancelCmd))
+	rootCmd.AddCommand(scheduleCmd)
+}
+
+var (
+	scheduleCmd = &cobra.Command{
+		Use:   "schedule",
+		Short: "Inspect deployments that defer deployment groups to time windows.",
+	}
+
+	scheduleStatusCmd = &cobra.Command{
+		Use:   "status DEPLOYMENT_DIRECTORY",
+		Short: "List deployment groups pending in a scheduled deployment.",
+		Long: "List deployment groups that a deployment started with `ghpc deploy --schedule` has not deployed yet, " +
+			"with their time window, when the window opens next and the pending groups whose outputs they use.",
+		Args:              cobra.MatchAll(cobra.ExactArgs(1), checkDir),
+		ValidArgsFunction: matchDirs,
+		Run:               runScheduleStatusCmd,
+		SilenceUsage:      true,
+	}
+
+	scheduleCancelCmd = &cobra.Command{
+		Use:   "cancel DEPLOYMENT_DIRECTORY",
+		Short: "Discard pending deployment groups of a scheduled deployment.",
+		Long: "Discard the schedule of a deployment started with `ghpc deploy --schedule`, so that the next " +
+			"`ghpc deploy` does not resume it. Stop a running `ghpc deploy` waiting for a time window first.",
+		Args:              cobra.MatchAll(cobra.ExactArgs(1), checkDir),
+		ValidArgsFunction: matchDirs,
+		Run:               runScheduleCancelCmd,
+		SilenceUsage:      true,
+	}
+)
+
+// groupUpstreams returns names of groups whose outputs are used by every group
+func groupUpstreams(bp config.Blueprint) (map[config.GroupName][]config.GroupName, error) {
+	res := map[config.GroupName][]config.GroupName{}
+	for _, g := range bp.Groups {
+		outputs, err := config.OutputNamesByGroup(g, bp)
+		if err != nil {
+			return nil, err
+		}
+		for pg, names := range outputs {
+			if len(names) > 0 {
+				res[g.Name] = append(res[g.Name], pg)
+			}
+		}
+		slices.Sort(res[g.Name])
+	}
+	return res, nil
+}
+
+func groupNames(s shell.DeploySchedule) string {
+	names := make([]string, len(s.Groups))
+	for i, g := range s.Groups {
+		names[i] = string(g.Group)
+	}
+	return strings.Join(names, ", ")
+}
+
+// deploySchedule returns a new schedule of selected groups if --schedule is used,
+// otherwise the persisted schedule of a deployment to resume, if any
+func deploySchedule(artDir string, groups []config.Group, selected map[config.GroupName]bool) (shell.DeploySchedule, error) {
+	known := map[config.GroupName]bool{}
+	for _, g := range groups {
+		known[g.Name] = true
+	}
+
+	if len(deployFlags.schedule) == 0 {
+		s, err := shell.ReadDeploySchedule(artDir)
+		if err != nil || len(s.Groups) == 0 {
+			return s, err
+		}
+		hint := "run `ghpc schedule status` to list pending groups, or `ghpc schedule cancel` to discard them"
+		if len(flagOnlyGroups)+len(flagSkipGroups) > 0 {
+			return s, config.HintError{Hint: hint,
+				Err: fmt.Errorf("--only and --skip can not be used to resume scheduled deployment of groups %s", groupNames(s))}
+		}
+		for _, g := range s.Groups {
+			if !known[g.Group] {
+				return s, config.HintError{Hint: hint,
+					Err: fmt.Errorf("scheduled deployment group %q is not found in the deployment", g.Group)}
+			}
+		}
+		if !flagAutoApprove {
+			return s, config.HintError{Hint: hint,
+				Err: fmt.Errorf("--auto-approve is required to resume scheduled deployment of groups %s", groupNames(s))}
+		}
+		logging.Info("Resuming scheduled deployment of groups %s", groupNames(s))
+		return s, nil
+	}
+
+	if !flagAutoApprove {
+		return shell.DeploySchedule{}, fmt.Errorf("--schedule requires --auto-approve, deferred groups are deployed unattended")
+	}
+	windows := map[config.GroupName]string{}
+	for _, f := range deployFlags.schedule {
+		name, spec, ok := strings.Cut(f, "=")
+		g := config.GroupName(strings.TrimSpace(name))
+		switch {
+		case !ok:
+			return shell.DeploySchedule{}, fmt.Errorf("--schedule %q: must be GROUP=[DAYS ]HH:MM-HH:MM", f)
+		case !known[g]:
+			return shell.DeploySchedule{}, fmt.Errorf("--schedule %q: deployment group %q is not found", f, g)
+		case !selected[g]:
+			return shell.DeploySchedule{}, fmt.Errorf("--schedule %q: deployment group %q is not selected", f, g)
+		}
+		if _, err := shell.ParseWindow(spec); err != nil {
+			return shell.DeploySchedule{}, fmt.Errorf("--schedule %q: %w", f, err)
+		}
+		windows[g] = strings.TrimSpace(spec)
+	}
+	s := shell.DeploySchedule{Created: time.Now()}
+	for _, g := range groups {
+		if selected[g.Name] {
+			s.Groups = append(s.Groups, shell.ScheduledGroup{Group: g.Name, Window: windows[g.Name]})
+		}
+	}
+	return s, nil
+}
+
+// runDeploySchedule deploys groups of the schedule as their windows open,
+// persisting groups that are pending so that the deployment can be resumed
+func runDeploySchedule(artDir string, bp config.Blueprint, s shell.DeploySchedule, deploy func(ig int) error) error {
+	upstream, err := groupUpstreams(bp)
+	if err != nil {
+		return err
+	}
+	for len(s.Groups) > 0 {
+		if err := shell.WriteDeploySchedule(artDir, s); err != nil {
+			return err
+		}
+		i, at, err := s.Next(time.Now(), upstream)
+		if err != nil {
+			return err
+		}
+		if i < 0 {
+			logging.Info("Waiting until %s to deploy groups %s", at.Format(scheduleTimeFormat), groupNames(s))
+			time.Sleep(time.Until(at))
+			continue
+		}
+		name := s.Groups[i].Group
+		ig := slices.IndexFunc(bp.Groups, func(g config.Group) bool { return g.Name == name })
+		if err := deploy(ig); err != nil {
+			return err
+		}
+		s.Groups = slices.Delete(s.Groups, i, i+1)
+	}
+	return shell.WriteDeploySchedule(artDir, s)
+}
+
+func runScheduleStatusCmd(cmd *cobra.Command, args []string) {
+	artDir := getArtifactsDir(args[0])
+	s, err := shell.ReadDeploySchedule(artDir)
+	checkErr(err, nil)
+	bp, ctx := artifactBlueprintOrDie(artDir)
+	upstream, err := groupUpstreams(bp)
+	checkErr(err, ctx)
+	checkErr(writeScheduleStatus(os.Stdout, s, upstream, time.Now()), nil)
+}
+
+func writeScheduleStatus(w io.Writer, s shell.DeploySchedule, upstream map[config.GroupName][]config.GroupName, now time.Time) error {
+	if len(s.Groups) == 0 {
+		fmt.Fprintln(w, "No deployment groups are scheduled.")
+		return nil
+	}
+	fmt.Fprintf(w, "Scheduled deployment created %s, pending groups:\n", s.Created.Format(scheduleTimeFormat))
+	pending := map[config.GroupName]bool{}
+	for _, g := range s.Groups {
+		pending[g.Group] = true
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "GROUP\tWINDOW\tWINDOW OPENS\tWAITING FOR")
+	for _, g := range s.Groups {
+		window, opens := "-", "-"
+		if g.Window != "" {
+			win, err := shell.ParseWindow(g.Window)
+			if err != nil {
+				return fmt.Errorf("deployment group %s: %w", g.Group, err)
+			}
+			window, opens = g.Window, "open"
+			if at := win.Next(now); at.After(now) {
+				opens = at.Format(scheduleTimeFormat)
+			}
+		}
+		waiting := []string{}
+		for _, u := range upstream[g.Group] {
+			if pending[u] {
+				waiting = append(waiting, string(u))
+			}
+		}
+		if len(waiting) == 0 {
+			waiting = []string{"-"}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", g.Group, window, opens, strings.Join(waiting, ", "))
+	}
+	return tw.Flush()
+}
+
+func runScheduleCancelCmd(cmd *cobra.Command, args []string) {
+	artDir := getArtifactsDir(args[0])
+	s, err := shell.ReadDeploySchedule(artDir)
+	checkErr(err, nil)
+	if len(s.Groups) == 0 {
+		logging.Info("No deployment groups are scheduled.")
+		return
+	}
+	checkErr(shell.WriteDeploySchedule(artDir, shell.DeploySchedule{}), nil)
+	logging.Info("Discarded scheduled deployment of groups %s", groupNames(s))
+}
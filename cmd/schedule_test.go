@@ -0,0 +1,92 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/shell"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestDeploySchedule(c *C) {
+	defer func() { deployFlags.schedule, flagAutoApprove = nil, false }()
+	dir := c.MkDir()
+	groups := []config.Group{{Name: "net"}, {Name: "gpu"}, {Name: "login"}}
+	all := map[config.GroupName]bool{"net": true, "gpu": true, "login": true}
+
+	{ // no schedule
+		got, err := deploySchedule(dir, groups, all)
+		c.Check(err, IsNil)
+		c.Check(got.Groups, HasLen, 0)
+	}
+
+	deployFlags.schedule = []string{"gpu=Sat,Sun 01:00-05:00"}
+	{ // requires --auto-approve
+		_, err := deploySchedule(dir, groups, all)
+		c.Check(err, ErrorMatches, `--schedule requires --auto-approve.*`)
+	}
+
+	flagAutoApprove = true
+	{ // selected groups in order
+		got, err := deploySchedule(dir, groups, map[config.GroupName]bool{"gpu": true, "login": true})
+		c.Check(err, IsNil)
+		c.Check(got.Groups, DeepEquals, []shell.ScheduledGroup{{Group: "gpu", Window: "Sat,Sun 01:00-05:00"}, {Group: "login"}})
+		c.Assert(shell.WriteDeploySchedule(dir, got), IsNil)
+	}
+
+	for _, bad := range []string{"gpu", "gpu=never", "tpu=01:00-02:00"} {
+		deployFlags.schedule = []string{bad}
+		_, err := deploySchedule(dir, groups, all)
+		c.Check(err, ErrorMatches, `--schedule .*`)
+	}
+	deployFlags.schedule = []string{"net=01:00-02:00"}
+	_, err := deploySchedule(dir, groups, map[config.GroupName]bool{"gpu": true})
+	c.Check(err, ErrorMatches, `.*"net" is not selected`)
+
+	deployFlags.schedule = nil
+	{ // resume persisted schedule
+		got, err := deploySchedule(dir, groups, all)
+		c.Check(err, IsNil)
+		c.Check(got.Groups, HasLen, 2)
+
+		_, err = deploySchedule(dir, groups[:1], all)
+		c.Check(err, ErrorMatches, `scheduled deployment group "gpu" is not found.*`)
+	}
+}
+
+func (s *MySuite) TestWriteScheduleStatus(c *C) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	c.Check(writeScheduleStatus(&buf, shell.DeploySchedule{}, nil, now), IsNil)
+	c.Check(buf.String(), Equals, "No deployment groups are scheduled.\n")
+
+	buf.Reset()
+	sched := shell.DeploySchedule{Created: now, Groups: []shell.ScheduledGroup{
+		{Group: "gpu", Window: "01:00-05:00"},
+		{Group: "cpu", Window: "11:00-13:00"},
+		{Group: "login"},
+	}}
+	upstream := map[config.GroupName][]config.GroupName{"login": {"cpu", "gpu", "net"}}
+	c.Check(writeScheduleStatus(&buf, sched, upstream, now), IsNil)
+	c.Check(buf.String(), Equals,
+		"Scheduled deployment created "+now.Format(scheduleTimeFormat)+", pending groups:\n"+
+			"GROUP  WINDOW       WINDOW OPENS                WAITING FOR\n"+
+			"gpu    01:00-05:00  "+now.Add(13*time.Hour).Format(scheduleTimeFormat)+"  -\n"+
+			"cpu    11:00-13:00  open                        -\n"+
+			"login  -            -                           cpu, gpu\n")
+}
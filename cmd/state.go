@@ -0,0 +1,213 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/logging"
+	"hpc-toolkit/pkg/shell"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
+)
+
+func init() {
+	stateListCmd.Flags().StringSliceVar(&stateFlags.modules, "module", nil,
+		"Comma-separated list of module IDs, only resources of these modules are listed")
+	stateCmd.AddCommand(
+		addGroupFilterFlags(
+			addArtifactsDirFlag(stateListCmd)),
+		addGroupFilterFlags(
+			addArtifactsDirFlag(stateCheckCmd)))
+	rootCmd.AddCommand(stateCmd)
+}
+
+var (
+	stateFlags = struct {
+		modules []string
+	}{}
+
+	stateCmd = &cobra.Command{
+		Use:   "state",
+		Short: "Inspect Terraform state of a deployment.",
+	}
+
+	stateListCmd = &cobra.Command{
+		Use:   "list DEPLOYMENT_DIRECTORY",
+		Short: "List resources in Terraform state of every deployment group.",
+		Long: "List managed resources in Terraform state of Terraform deployment groups, with their " +
+			"module path, type, name and creation time (if recorded by the provider). " +
+			"State is read from the configured backend, deployment groups are initialized if needed.",
+		Args:              cobra.MatchAll(cobra.ExactArgs(1), checkDir),
+		ValidArgsFunction: matchDirs,
+		Run:               runStateListCmd,
+		SilenceUsage:      true,
+	}
+
+	stateCheckCmd = &cobra.Command{
+		Use:   "check DEPLOYMENT_DIRECTORY",
+		Short: "Check that Terraform state of every deployment group has no modules removed from the blueprint.",
+		Long: "Compare modules of Terraform deployment groups with modules in their Terraform state. " +
+			"Modules that were removed from a group but still have resources in its state are reported, " +
+			"as the next apply of the group would destroy these resources, e.g. file systems with data. " +
+			"Run it after \"ghpc create -w\" and before \"ghpc deploy\".",
+		Args:              cobra.MatchAll(cobra.ExactArgs(1), checkDir),
+		ValidArgsFunction: matchDirs,
+		Run:               runStateCheckCmd,
+		SilenceUsage:      true,
+	}
+)
+
+// groupResource is a resource in state of a deployment group
+type groupResource struct {
+	group config.GroupName
+	shell.StateResource
+}
+
+func runStateListCmd(cmd *cobra.Command, args []string) {
+	deplDir := args[0]
+	bp, ctx := artifactBlueprintOrDie(getArtifactsDir(deplDir))
+	checkErr(shell.ValidateDeploymentDirectory(bp.Groups, deplDir), ctx)
+	selected, err := selectGroups(bp.Groups)
+	checkErr(err, ctx)
+	checkErr(checkModulesExist(bp, stateFlags.modules), ctx)
+
+	res := []groupResource{}
+	for _, g := range bp.Groups {
+		if !selected[g.Name] || g.Kind() != config.TerraformKind {
+			continue
+		}
+		tf, err := shell.ConfigureTerraform(filepath.Join(deplDir, string(g.Name)))
+		checkErr(err, ctx)
+		logging.Info("Reading state of deployment group %s", g.Name)
+		rs, err := shell.ListStateResources(tf)
+		checkErr(err, ctx)
+		res = append(res, filterStateResources(g.Name, rs, stateFlags.modules)...)
+	}
+	writeStateResources(os.Stdout, res)
+}
+
+func checkModulesExist(bp config.Blueprint, ids []string) error {
+	for _, id := range ids {
+		if _, err := bp.Module(config.ModuleID(id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// filterStateResources returns resources of the given modules, all resources if no modules are given
+func filterStateResources(group config.GroupName, rs []shell.StateResource, modules []string) []groupResource {
+	res := []groupResource{}
+	for _, r := range rs {
+		if len(modules) == 0 || slices.Contains(modules, string(r.ModuleID)) {
+			res = append(res, groupResource{group: group, StateResource: r})
+		}
+	}
+	return res
+}
+
+func writeStateResources(w io.Writer, res []groupResource) {
+	if len(res) == 0 {
+		fmt.Fprintln(w, "No resources found in Terraform state.")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "GROUP\tMODULE\tTYPE\tNAME\tCREATED")
+	for _, r := range res {
+		module, created := r.Module, r.Created
+		if module == "" {
+			module = "-"
+		}
+		if created == "" {
+			created = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.group, module, r.Type, r.Name, created)
+	}
+	tw.Flush()
+}
+
+// removedModule is a module that is not in the deployment group, but has
+// resources in Terraform state of the group
+type removedModule struct {
+	group     config.GroupName
+	id        config.ModuleID
+	resources []string
+}
+
+func runStateCheckCmd(cmd *cobra.Command, args []string) {
+	deplDir := args[0]
+	bp, ctx := artifactBlueprintOrDie(getArtifactsDir(deplDir))
+	checkErr(shell.ValidateDeploymentDirectory(bp.Groups, deplDir), ctx)
+	selected, err := selectGroups(bp.Groups)
+	checkErr(err, ctx)
+
+	removed := []removedModule{}
+	for _, g := range bp.Groups {
+		if !selected[g.Name] || g.Kind() != config.TerraformKind {
+			continue
+		}
+		tf, err := shell.ConfigureTerraform(filepath.Join(deplDir, string(g.Name)))
+		checkErr(err, ctx)
+		logging.Info("Reading state of deployment group %s", g.Name)
+		rs, err := shell.ListStateResources(tf)
+		checkErr(err, ctx)
+		removed = append(removed, removedModules(g, rs)...)
+	}
+	writeRemovedModules(os.Stdout, removed)
+	if len(removed) > 0 {
+		checkErr(config.HintError{
+			Hint: "restore the modules in the blueprint, or remove the resources from state with \"terraform state rm\" to keep them",
+			Err:  fmt.Errorf("%d modules removed from the blueprint have resources in Terraform state, they will be destroyed by the next apply", len(removed))}, ctx)
+	}
+}
+
+// removedModules returns modules in state of the group that are not in the group, in order of appearance
+func removedModules(g config.Group, rs []shell.StateResource) []removedModule {
+	res := []removedModule{}
+	idx := map[config.ModuleID]int{}
+	for _, r := range rs {
+		if r.ModuleID == "" || slices.ContainsFunc(g.Modules, func(m config.Module) bool { return m.ID == r.ModuleID }) {
+			continue
+		}
+		i, ok := idx[r.ModuleID]
+		if !ok {
+			i = len(res)
+			idx[r.ModuleID] = i
+			res = append(res, removedModule{group: g.Name, id: r.ModuleID})
+		}
+		res[i].resources = append(res[i].resources, r.Address())
+	}
+	return res
+}
+
+func writeRemovedModules(w io.Writer, removed []removedModule) {
+	if len(removed) == 0 {
+		fmt.Fprintln(w, "Terraform state of deployment groups has no modules removed from the blueprint.")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "GROUP\tREMOVED MODULE\tRESOURCES PENDING DESTROY")
+	for _, m := range removed {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", m.group, m.id, strings.Join(m.resources, ", "))
+	}
+	tw.Flush()
+}
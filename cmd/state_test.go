@@ -0,0 +1,92 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/shell"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestFilterStateResources(c *C) {
+	net := shell.StateResource{Module: "module.network1.module.vpc", ModuleID: "network1", Type: "google_compute_network", Name: "network"}
+	fs := shell.StateResource{Module: "module.homefs", ModuleID: "homefs", Type: "google_filestore_instance", Name: "filestore"}
+	rs := []shell.StateResource{net, fs}
+
+	c.Check(filterStateResources("primary", rs, nil), DeepEquals, []groupResource{
+		{group: "primary", StateResource: net}, {group: "primary", StateResource: fs}})
+	c.Check(filterStateResources("primary", rs, []string{"homefs"}), DeepEquals, []groupResource{
+		{group: "primary", StateResource: fs}})
+	c.Check(filterStateResources("primary", rs, []string{"other"}), DeepEquals, []groupResource{})
+}
+
+func (s *MySuite) TestCheckModulesExist(c *C) {
+	bp := config.Blueprint{Groups: []config.Group{{Name: "primary", Modules: []config.Module{{ID: "homefs"}}}}}
+	c.Check(checkModulesExist(bp, []string{"homefs"}), IsNil)
+	c.Check(checkModulesExist(bp, []string{"homefs", "scratch"}), NotNil)
+}
+
+func (s *MySuite) TestWriteStateResources(c *C) {
+	{
+		var b bytes.Buffer
+		writeStateResources(&b, []groupResource{})
+		c.Check(b.String(), Equals, "No resources found in Terraform state.\n")
+	}
+	{
+		var b bytes.Buffer
+		writeStateResources(&b, []groupResource{
+			{group: "primary", StateResource: shell.StateResource{
+				Module: "module.homefs", ModuleID: "homefs", Type: "google_filestore_instance", Name: "filestore",
+				Created: "2024-03-14T22:10:00Z"}},
+			{group: "cluster", StateResource: shell.StateResource{Type: "terraform_data", Name: "x"}},
+		})
+		c.Check(b.String(), Matches, `(?s)GROUP +MODULE +TYPE +NAME +CREATED\n`+
+			`primary +module.homefs +google_filestore_instance +filestore +2024-03-14T22:10:00Z\n`+
+			`cluster +- +terraform_data +x +-\n`)
+	}
+}
+
+func (s *MySuite) TestRemovedModules(c *C) {
+	g := config.Group{Name: "primary", Modules: []config.Module{{ID: "network1"}, {ID: "cluster"}}}
+	net := shell.StateResource{Module: "module.network1.module.vpc", ModuleID: "network1", Type: "google_compute_network", Name: "network"}
+	fs := shell.StateResource{Module: "module.homefs", ModuleID: "homefs", Type: "google_filestore_instance", Name: "filestore"}
+	bucket := shell.StateResource{Module: "module.bucket", ModuleID: "bucket", Type: "google_storage_bucket", Name: "bucket"}
+	ip := shell.StateResource{Module: "module.homefs", ModuleID: "homefs", Type: "google_compute_address", Name: "ip[0]"}
+	root := shell.StateResource{Type: "terraform_data", Name: "x"}
+
+	c.Check(removedModules(g, []shell.StateResource{net, root}), DeepEquals, []removedModule{})
+	c.Check(removedModules(g, []shell.StateResource{net, fs, bucket, ip}), DeepEquals, []removedModule{
+		{group: "primary", id: "homefs", resources: []string{
+			"module.homefs.google_filestore_instance.filestore", "module.homefs.google_compute_address.ip[0]"}},
+		{group: "primary", id: "bucket", resources: []string{"module.bucket.google_storage_bucket.bucket"}},
+	})
+}
+
+func (s *MySuite) TestWriteRemovedModules(c *C) {
+	{
+		var b bytes.Buffer
+		writeRemovedModules(&b, []removedModule{})
+		c.Check(b.String(), Equals, "Terraform state of deployment groups has no modules removed from the blueprint.\n")
+	}
+	{
+		var b bytes.Buffer
+		writeRemovedModules(&b, []removedModule{
+			{group: "primary", id: "homefs", resources: []string{"module.homefs.google_filestore_instance.filestore"}}})
+		c.Check(b.String(), Matches, `(?s)GROUP +REMOVED MODULE +RESOURCES PENDING DESTROY\n`+
+			`primary +homefs +module.homefs.google_filestore_instance.filestore\n`)
+	}
+}
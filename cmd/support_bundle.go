@@ -0,0 +1,248 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/logging"
+	"hpc-toolkit/pkg/modulewriter"
+	"hpc-toolkit/pkg/shell"
+	"hpc-toolkit/pkg/support"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// maxLogSize is the size of the tail of every log file included into the support bundle
+const maxLogSize = 1 << 20
+
+func init() {
+	supportBundleCmd.Flags().StringVarP(&supportBundleFlags.out, "out", "o", "",
+		"Path of the support bundle, defaults to <deployment_name>-support-<time>.tar.gz in the current directory.")
+	supportBundleCmd.Flags().StringVar(&supportBundleFlags.blueprint, "blueprint", "",
+		"Include the (redacted) blueprint the deployment was created from.")
+	supportBundleCmd.Flags().BoolVar(&supportBundleFlags.plan, "plan", false,
+		"Include summaries of Terraform plans of deployment groups, requires access to the cloud project.")
+	rootCmd.AddCommand(addArtifactsDirFlag(supportBundleCmd))
+}
+
+var (
+	supportBundleFlags = struct {
+		out       string
+		blueprint string
+		plan      bool
+	}{}
+
+	supportBundleCmd = &cobra.Command{
+		Use:   "support-bundle DEPLOYMENT_DIRECTORY",
+		Short: "Collect information about a deployment for a bug report.",
+		Long: "Collect the expanded blueprint, artifacts manifests, versions of the Toolkit, Terraform and Packer, " +
+			"and recent logs of the deployment into a tarball for attaching to bug reports. " +
+			"Settings and variables that may hold secrets, such as passwords and tokens, are redacted.",
+		Args:              cobra.MatchAll(cobra.ExactArgs(1), checkDir),
+		ValidArgsFunction: matchDirs,
+		Run:               runSupportBundleCmd,
+		SilenceUsage:      true,
+	}
+)
+
+func runSupportBundleCmd(cmd *cobra.Command, args []string) {
+	deplDir := args[0]
+	artDir := getArtifactsDir(deplDir)
+	bp, ctx := artifactBlueprintOrDie(artDir)
+	now := time.Now()
+
+	files, err := collectDeploymentFiles(deplDir, artDir, supportBundleFlags.blueprint)
+	checkErr(err, ctx)
+	files = append(files, support.File{Name: "versions.txt", Content: []byte(versionsReport(deplDir, bp))})
+	if supportBundleFlags.plan {
+		files = append(files, planSummaries(deplDir, bp)...)
+	}
+
+	root := fmt.Sprintf("%s-support-%s", bp.DeploymentName(), now.UTC().Format("20060102T150405Z"))
+	out := supportBundleFlags.out
+	if out == "" {
+		out = root + ".tar.gz"
+	}
+	f, err := os.Create(out)
+	checkErr(err, ctx)
+	defer f.Close()
+	checkErr(support.WriteBundle(f, root, files, now), ctx)
+
+	names := []string{}
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	logging.Info("Support bundle written to %s, it contains:\n  %s", out, strings.Join(names, "\n  "))
+	logging.Info("Secrets were redacted on a best-effort basis, please review the bundle before sharing it.")
+}
+
+// collectDeploymentFiles reads redacted artifacts and logs of the deployment
+func collectDeploymentFiles(deplDir string, artDir string, blueprint string) ([]support.File, error) {
+	files := []support.File{}
+	addYaml := func(name string, p string) error {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if b, err = support.RedactYaml(b); err != nil {
+			return fmt.Errorf("failed to redact %s: %w", p, err)
+		}
+		files = append(files, support.File{Name: name, Content: b})
+		return nil
+	}
+
+	if blueprint != "" {
+		if err := addYaml("blueprint.yaml", blueprint); err != nil {
+			return nil, err
+		}
+	}
+	if err := addYaml(modulewriter.ExpandedBlueprintName, filepath.Join(artDir, modulewriter.ExpandedBlueprintName)); err != nil {
+		return nil, err
+	}
+
+	for name, p := range map[string]string{
+		modulewriter.ArtifactsManifestName: modulewriter.ArtifactsManifestPath(deplDir),
+		modulewriter.VendoredManifestName:  filepath.Join(artDir, modulewriter.VendoredManifestName),
+	} {
+		b, err := os.ReadFile(p)
+		if errors.Is(err, os.ErrNotExist) {
+			continue // older deployments may lack some of artifacts
+		}
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, support.File{Name: name, Content: b})
+	}
+
+	logs, err := deploymentLogs(deplDir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return append(files, logs...), nil
+}
+
+// deploymentLogs returns redacted tails of log files of the deployment, such as
+// Terraform crash logs and logs of Packer and Ansible
+func deploymentLogs(deplDir string) ([]support.File, error) {
+	logs := []support.File{}
+	err := filepath.WalkDir(deplDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".terraform" {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || filepath.Ext(p) != ".log" {
+			return nil
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(deplDir, p)
+		if err != nil {
+			return err
+		}
+		content := support.RedactText(string(support.Tail(b, maxLogSize)))
+		logs = append(logs, support.File{Name: path.Join("logs", filepath.ToSlash(rel)), Content: []byte(content)})
+		return nil
+	})
+	return logs, err // WalkDir visits files in lexical order
+}
+
+// versionsReport describes versions of the Toolkit and of tools used by the deployment
+func versionsReport(deplDir string, bp config.Blueprint) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "ghpc version %s\n", rootCmd.Version)
+	for _, k := range []string{"version", "branch", "commitInfo"} {
+		if v, ok := annotation[k]; ok {
+			fmt.Fprintf(&sb, "ghpc %s: %s\n", k, v)
+		}
+	}
+	fmt.Fprintf(&sb, "Modules digest: %s\n", modulesDigest())
+	if bp.GhpcVersion != "" {
+		fmt.Fprintf(&sb, "Deployment created by ghpc version %s\n", bp.GhpcVersion)
+	}
+	fmt.Fprintf(&sb, "Platform: %s/%s\n\n", runtime.GOOS, runtime.GOARCH)
+
+	for _, g := range bp.Groups {
+		if g.Kind() != config.TerraformKind {
+			continue
+		}
+		// versions of providers are known in initialized groups only
+		fmt.Fprintf(&sb, "Deployment group %s:\n", g.Name)
+		tf, err := shell.ConfigureTerraform(filepath.Join(deplDir, string(g.Name)))
+		if err != nil {
+			fmt.Fprintf(&sb, "  %v\n", err)
+			continue
+		}
+		v, providers, err := tf.Version(context.Background(), true)
+		if err != nil {
+			fmt.Fprintf(&sb, "  terraform version failed: %v\n", err)
+			continue
+		}
+		fmt.Fprintf(&sb, "  terraform %s\n", v)
+		names := []string{}
+		for p := range providers {
+			names = append(names, p)
+		}
+		sort.Strings(names)
+		for _, p := range names {
+			fmt.Fprintf(&sb, "  provider %s %s\n", p, providers[p])
+		}
+	}
+
+	if out, err := exec.Command("packer", "version").Output(); err == nil {
+		fmt.Fprintf(&sb, "\n%s", out)
+	}
+	return sb.String()
+}
+
+// planSummaries returns summaries of Terraform plans of deployment groups
+func planSummaries(deplDir string, bp config.Blueprint) []support.File {
+	files := []support.File{}
+	artDir := getArtifactsDir(deplDir)
+	for _, g := range bp.Groups {
+		if g.Kind() != config.TerraformKind {
+			continue
+		}
+		logging.Info("Planning deployment group %s", g.Name)
+		groupDir := filepath.Join(deplDir, string(g.Name))
+		var summary string
+		if c, err := planTerraformGroup(groupDir, artDir, bp); err != nil {
+			summary = fmt.Sprintf("plan failed: %v\n", err)
+		} else {
+			summary = c.Summary
+		}
+		files = append(files, support.File{
+			Name:    path.Join("plans", string(g.Name)+".txt"),
+			Content: []byte(support.RedactText(summary)),
+		})
+	}
+	return files
+}
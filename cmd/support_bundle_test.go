@@ -0,0 +1,49 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"hpc-toolkit/pkg/modulewriter"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestCollectDeploymentFiles(c *C) {
+	deplDir := c.MkDir()
+	artDir := modulewriter.ArtifactsDir(deplDir)
+	write := func(p string, content string) {
+		c.Assert(os.MkdirAll(filepath.Dir(p), 0755), IsNil)
+		c.Assert(os.WriteFile(p, []byte(content), 0644), IsNil)
+	}
+	write(filepath.Join(artDir, modulewriter.ExpandedBlueprintName), "vars:\n  db_password: hunter2\n")
+	write(filepath.Join(deplDir, "primary", "crash.log"), "token: abc\n")
+	write(filepath.Join(deplDir, "primary", ".terraform", "x.log"), "ignored")
+	bpFile := filepath.Join(c.MkDir(), "bp.yaml")
+	write(bpFile, "vars:\n  api_key: xyz\n")
+
+	files, err := collectDeploymentFiles(deplDir, artDir, bpFile)
+	c.Assert(err, IsNil)
+	got := map[string]string{}
+	for _, f := range files {
+		got[f.Name] = string(f.Content)
+	}
+	c.Check(got, DeepEquals, map[string]string{
+		"blueprint.yaml":          "vars:\n  api_key: REDACTED\n",
+		"expanded_blueprint.yaml": "vars:\n  db_password: REDACTED\n",
+		"logs/primary/crash.log":  "token: REDACTED\n",
+	})
+}
@@ -0,0 +1,238 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/logging"
+	"hpc-toolkit/pkg/modulewriter"
+	"hpc-toolkit/pkg/shell"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/otiai10/copy"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(
+		addAutoApproveFlag(
+			addExpandFlags(upgradeDeploymentCmd, false /*addOutFlag*/)))
+}
+
+var upgradeDeploymentCmd = &cobra.Command{
+	Use:   "upgrade-deployment <DEPLOYMENT_DIRECTORY> <BLUEPRINT_FILE>",
+	Short: "Upgrade a live deployment to a new blueprint or version of the Toolkit.",
+	Long: "Re-expand the blueprint with the current version of the Toolkit, preview changes " +
+		"of Terraform plans of every deployment group and, after confirmation, rewrite " +
+		"the deployment directory and deploy it. Terraform state and backends are preserved, " +
+		"artifacts of the previous deployment are archived in .ghpc/history.",
+	Args:         cobra.MatchAll(cobra.ExactArgs(2), checkDir, checkBlueprintExists),
+	Run:          runUpgradeDeploymentCmd,
+	SilenceUsage: true,
+}
+
+func checkBlueprintExists(cmd *cobra.Command, args []string) error {
+	return checkExists(cmd, args[1:])
+}
+
+// groupPreview is the outcome of planning changes of a deployment group
+type groupPreview struct {
+	group   config.GroupName
+	changes shell.ProposedChanges
+	err     error
+}
+
+func runUpgradeDeploymentCmd(cmd *cobra.Command, args []string) {
+	deplDir := args[0]
+	artDir := modulewriter.ArtifactsDir(deplDir)
+	checkErr(shell.CheckWritableDir(artDir), nil)
+	prev, _ := artifactBlueprintOrDie(artDir)
+
+	bp, ctx := expandOrDie(args[1])
+	checkErr(checkUpgradeAllowed(prev, bp), ctx)
+	checkErr(validateRuntimeDependencies(deplDir, bp.Groups), ctx)
+
+	if prev.GhpcVersion != bp.GhpcVersion {
+		logging.Info("Toolkit version changes from %q to %q", prev.GhpcVersion, bp.GhpcVersion)
+	}
+	logging.Info("Planning upgrade of deployment %q ...", deplDir)
+	previews, err := previewUpgrade(deplDir, bp.Clone()) // WriteDeployment materializes groups in place
+	checkErr(err, ctx)
+	writeUpgradePreview(os.Stdout, previews)
+
+	if !confirmUpgrade(previews) {
+		logging.Info("Upgrade of deployment %q was not applied.", deplDir)
+		return
+	}
+
+	archive, err := modulewriter.ArchiveArtifacts(deplDir, artDir, time.Now())
+	checkErr(err, ctx)
+	logging.Info("Artifacts of the previous deployment are archived in %s", archive)
+
+	logging.Info("Upgrading deployment folder %q ...", deplDir)
+	checkErr(modulewriter.WriteDeployment(bp, deplDir), ctx)
+	doDeploy(deplDir)
+}
+
+// checkUpgradeAllowed verifies that the new blueprint can replace the deployed one
+// without loss of Terraform state
+func checkUpgradeAllowed(prev config.Blueprint, bp config.Blueprint) error {
+	if err := checkSameDeployment(prev, bp); err != nil {
+		return err
+	}
+	changes, err := changedBackends(prev, bp)
+	if err != nil {
+		return err
+	}
+	if len(changes) > 0 {
+		return config.HintError{
+			Err:  fmt.Errorf("terraform backend of deployment group %q has changed", changes[0].group),
+			Hint: "upgrade preserves Terraform state in place, migrate the state with `ghpc migrate-backend` first"}
+	}
+	return nil
+}
+
+// previewUpgrade writes the upgraded deployment into a temporary copy of the deployment
+// directory and plans changes of every Terraform group against the live state
+func previewUpgrade(deplDir string, bp config.Blueprint) ([]groupPreview, error) {
+	tmp, err := os.MkdirTemp("", "ghpc-upgrade-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	stage := filepath.Join(tmp, filepath.Base(filepath.Clean(deplDir)))
+	// copy local Terraform state, but not providers and modules downloaded by `terraform init`
+	skipInitDir := func(fi os.FileInfo, src string, dst string) (bool, error) {
+		return fi.IsDir() && fi.Name() == ".terraform", nil
+	}
+	if err := copy.Copy(deplDir, stage, copy.Options{Skip: skipInitDir}); err != nil {
+		return nil, fmt.Errorf("failed to copy deployment folder: %w", err)
+	}
+	if err := modulewriter.WriteDeployment(bp, stage); err != nil {
+		return nil, err
+	}
+
+	// outputs of deployed groups are needed to plan groups that depend on them
+	stageArtDir := modulewriter.ArtifactsDir(stage)
+	outputs, err := filepath.Glob(filepath.Join(modulewriter.ArtifactsDir(deplDir), "*_outputs.tfvars"))
+	if err != nil {
+		return nil, err
+	}
+	for _, src := range outputs {
+		if err := copy.Copy(src, filepath.Join(stageArtDir, filepath.Base(src))); err != nil {
+			return nil, err
+		}
+	}
+
+	staged, _, err := config.NewBlueprint(filepath.Join(stageArtDir, modulewriter.ExpandedBlueprintName))
+	if err != nil {
+		return nil, err
+	}
+	if err := modulewriter.DecryptBlueprintVars(&staged, stageArtDir); err != nil {
+		return nil, err
+	}
+	if err := staged.Materialize(); err != nil {
+		return nil, err
+	}
+
+	return previewGroups(stage, stageArtDir, staged), nil
+}
+
+// previewGroups plans changes of every Terraform group of the deployment, upstream
+// outputs are imported from artDir
+func previewGroups(deplDir string, artDir string, bp config.Blueprint) []groupPreview {
+	previews := []groupPreview{}
+	for _, g := range bp.Groups {
+		p := groupPreview{group: g.Name}
+		groupDir := filepath.Join(deplDir, string(g.Name))
+		switch g.Kind() {
+		case config.TerraformKind:
+			p.changes, p.err = planTerraformGroup(groupDir, artDir, bp)
+		case config.PackerKind:
+			p.changes.Summary = "Not previewed, image build with packer will be proposed on deploy."
+		case config.AnsibleKind:
+			p.changes.Summary = "Not previewed, run of ansible playbook will be proposed on deploy."
+		default:
+			p.err = fmt.Errorf("group %s is an unsupported kind %q", g.Name, g.Kind())
+		}
+		previews = append(previews, p)
+	}
+	return previews
+}
+
+func planTerraformGroup(groupDir string, artDir string, bp config.Blueprint) (shell.ProposedChanges, error) {
+	if err := shell.ImportInputs(groupDir, artDir, bp); err != nil {
+		return shell.ProposedChanges{}, err
+	}
+	tf, err := shell.ConfigureTerraform(groupDir)
+	if err != nil {
+		return shell.ProposedChanges{}, err
+	}
+	c, _, err := shell.PlanChanges(tf)
+	return c, err
+}
+
+func writeUpgradePreview(w io.Writer, previews []groupPreview) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "GROUP\tPLANNED CHANGES")
+	for _, p := range previews {
+		summary := strings.TrimSpace(p.changes.Summary)
+		if p.err != nil {
+			summary = "plan failed, see below"
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", p.group, summary)
+	}
+	tw.Flush()
+
+	for _, p := range previews {
+		if p.err != nil {
+			fmt.Fprintf(w, "\nPlan of deployment group %s failed:\n%v\n", p.group, p.err)
+		}
+	}
+}
+
+// confirmUpgrade asks the user to approve the upgrade, it is approved automatically
+// with --auto-approve unless some of plans failed
+func confirmUpgrade(previews []groupPreview) bool {
+	failed, full := []string{}, []string{}
+	for _, p := range previews {
+		if p.err != nil {
+			failed = append(failed, string(p.group))
+		}
+		if p.changes.Full != "" {
+			full = append(full, fmt.Sprintf("Deployment group %s:\n%s", p.group, p.changes.Full))
+		}
+	}
+	if len(failed) > 0 && flagAutoApprove {
+		logging.Error("Plans of deployment groups %s failed, upgrade requires manual approval.", strings.Join(failed, ", "))
+		return false
+	}
+	if flagAutoApprove {
+		return true
+	}
+
+	summary := fmt.Sprintf("upgrade %d deployment group(s), see planned changes above", len(previews))
+	if len(full) == 0 {
+		full = append(full, "No changes to Terraform managed infrastructure.")
+	}
+	return shell.ApplyChangesChoice(shell.ProposedChanges{Summary: summary, Full: strings.Join(full, "\n")})
+}
@@ -0,0 +1,87 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/shell"
+
+	"github.com/zclconf/go-cty/cty"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestCheckUpgradeAllowed(c *C) {
+	gcs := func(bucket string) config.TerraformBackend {
+		return config.TerraformBackend{
+			Type:          "gcs",
+			Configuration: config.NewDict(map[string]cty.Value{"bucket": cty.StringVal(bucket)})}
+	}
+	mk := func(name string, groups ...config.Group) config.Blueprint {
+		return config.Blueprint{
+			Vars:   config.NewDict(map[string]cty.Value{"deployment_name": cty.StringVal(name)}),
+			Groups: groups}
+	}
+	tfMods := []config.Module{{ID: "net", Kind: config.TerraformKind}}
+	prev := mk("lime", config.Group{Name: "green", TerraformBackend: gcs("sour"), Modules: tfMods})
+
+	// same backend, new group
+	c.Check(checkUpgradeAllowed(prev, mk("lime",
+		config.Group{Name: "green", TerraformBackend: gcs("sour"), Modules: tfMods},
+		config.Group{Name: "yellow"})), IsNil)
+
+	c.Check(checkUpgradeAllowed(prev, mk("lemon",
+		config.Group{Name: "green", TerraformBackend: gcs("sour"), Modules: tfMods})),
+		ErrorMatches, `deployment_name has changed from "lime" to "lemon".*`)
+
+	c.Check(checkUpgradeAllowed(prev, mk("lime", config.Group{Name: "yellow"})),
+		ErrorMatches, `.*remove a deployment group "green".*`)
+
+	c.Check(checkUpgradeAllowed(prev, mk("lime",
+		config.Group{Name: "green", TerraformBackend: gcs("sweet"), Modules: tfMods})),
+		ErrorMatches, `terraform backend of deployment group "green" has changed.*`)
+
+	c.Check(checkUpgradeAllowed(prev, mk("lime", config.Group{Name: "green", Modules: tfMods})),
+		ErrorMatches, `terraform backend of deployment group "green" has changed.*`)
+}
+
+func (s *MySuite) TestWriteUpgradePreview(c *C) {
+	var b bytes.Buffer
+	writeUpgradePreview(&b, []groupPreview{
+		{group: "green", changes: shell.ProposedChanges{Summary: "Plan: 1 to add, 2 to change, 0 to destroy.\n"}},
+		{group: "yellow", changes: shell.ProposedChanges{Summary: "No changes."}},
+		{group: "red", err: errors.New("no juice")},
+	})
+	c.Check(b.String(), Equals, `GROUP   PLANNED CHANGES
+green   Plan: 1 to add, 2 to change, 0 to destroy.
+yellow  No changes.
+red     plan failed, see below
+
+Plan of deployment group red failed:
+no juice
+`)
+}
+
+func (s *MySuite) TestConfirmUpgrade_AutoApprove(c *C) {
+	defer func() { flagAutoApprove = false }()
+	flagAutoApprove = true
+
+	ok := []groupPreview{{group: "green", changes: shell.ProposedChanges{Summary: "No changes."}}}
+	c.Check(confirmUpgrade(ok), Equals, true)
+
+	failed := append(ok, groupPreview{group: "red", err: errors.New("no juice")})
+	c.Check(confirmUpgrade(failed), Equals, false)
+}
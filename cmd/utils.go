@@ -15,12 +15,17 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"hpc-toolkit/pkg/config"
 	"hpc-toolkit/pkg/modulewriter"
 	"hpc-toolkit/pkg/shell"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/slices"
 )
 
 var flagArtifactsDir string
@@ -52,6 +57,56 @@ func addAutoApproveFlag(c *cobra.Command) *cobra.Command {
 	return c
 }
 
+var flagOnlyGroups, flagSkipGroups []string
+
+func addGroupFilterFlags(c *cobra.Command) *cobra.Command {
+	c.Flags().StringSliceVar(&flagOnlyGroups, "only", nil,
+		"Comma-separated list of deployment groups to act on, other groups are left untouched")
+	c.Flags().StringSliceVar(&flagSkipGroups, "skip", nil,
+		"Comma-separated list of deployment groups to leave untouched")
+	c.MarkFlagsMutuallyExclusive("only", "skip")
+	return c
+}
+
+func isGroupFilterFlag(name string) bool {
+	return name == "only" || name == "skip"
+}
+
+// selectGroups returns names of groups selected by --only or --skip flags,
+// all groups are selected if neither flag is used
+func selectGroups(groups []config.Group) (map[config.GroupName]bool, error) {
+	known := map[config.GroupName]bool{}
+	names := []string{}
+	for _, g := range groups {
+		known[g.Name] = true
+		names = append(names, string(g.Name))
+	}
+	for _, n := range append(append([]string{}, flagOnlyGroups...), flagSkipGroups...) {
+		if !known[config.GroupName(n)] {
+			return nil, config.HintError{
+				Err:  fmt.Errorf("deployment group %q is not found", n),
+				Hint: fmt.Sprintf("deployment groups are: %s", strings.Join(names, ", "))}
+		}
+	}
+
+	selected := map[config.GroupName]bool{}
+	for _, g := range groups {
+		selected[g.Name] = len(flagOnlyGroups) == 0 || slices.Contains(flagOnlyGroups, string(g.Name))
+		if slices.Contains(flagSkipGroups, string(g.Name)) {
+			selected[g.Name] = false
+		}
+	}
+	return selected, nil
+}
+
+func joinGroupNames(groups []config.GroupName) string {
+	names := make([]string, len(groups))
+	for i, g := range groups {
+		names[i] = string(g)
+	}
+	return strings.Join(names, ", ")
+}
+
 func checkExists(cmd *cobra.Command, args []string) error {
 	path := args[0]
 	if _, err := os.Lstat(path); err != nil {
@@ -78,3 +133,12 @@ func filterYaml(cmd *cobra.Command, args []string, toComplete string) ([]string,
 	}
 	return []string{"yaml", "yml"}, cobra.ShellCompDirectiveFilterFileExt
 }
+
+// deploymentProjectID returns value of `project_id` deployment variable
+func deploymentProjectID(bp config.Blueprint) (string, error) {
+	pid := bp.Vars.Get("project_id")
+	if !bp.Vars.Has("project_id") || pid.IsNull() || pid.Type() != cty.String {
+		return "", errors.New("project_id deployment variable is not set")
+	}
+	return pid.AsString(), nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/validators"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(validatorsCmd)
+}
+
+var validatorsCmd = &cobra.Command{
+	Use:   "validators",
+	Short: "List validators that blueprints can use.",
+	Long: "List built-in validators and validators registered by the program embedding the toolkit, " +
+		"with validators that must succeed for them to run and required inputs of registered validators.",
+	Args:         cobra.NoArgs,
+	Run:          runValidatorsCmd,
+	SilenceUsage: true,
+}
+
+func runValidatorsCmd(cmd *cobra.Command, args []string) {
+	writeValidators(os.Stdout, validators.Available())
+}
+
+func orDash(s []string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	return strings.Join(s, ", ")
+}
+
+func writeValidators(w io.Writer, vs []validators.ValidatorInfo) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VALIDATOR\tSOURCE\tDEPENDS ON\tREQUIRED INPUTS")
+	for _, v := range vs {
+		source := "built-in"
+		if v.Registered {
+			source = "registered"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", v.Name, source, orDash(v.Dependencies), orDash(v.RequiredInputs))
+	}
+	tw.Flush()
+}
@@ -0,0 +1,34 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"hpc-toolkit/pkg/validators"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestWriteValidators(c *C) {
+	var buf bytes.Buffer
+	writeValidators(&buf, []validators.ValidatorInfo{
+		{Name: "test_org_naming", Registered: true, RequiredInputs: []string{"prefix", "suffix"}},
+		{Name: "test_zone_exists", Dependencies: []string{"test_project_exists"}},
+	})
+	c.Check(buf.String(), Equals,
+		"VALIDATOR         SOURCE      DEPENDS ON           REQUIRED INPUTS\n"+
+			"test_org_naming   registered  -                    prefix, suffix\n"+
+			"test_zone_exists  built-in    test_project_exists  -\n")
+}
@@ -0,0 +1,122 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmd defines command line utilities for ghpc
+package cmd
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/modulewriter"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	vendorCmd.AddCommand(addArtifactsDirFlag(vendorDiffCmd))
+	rootCmd.AddCommand(vendorCmd)
+}
+
+var (
+	vendorCmd = &cobra.Command{
+		Use:   "vendor",
+		Short: "Inspect module code copied into deployment folders.",
+	}
+
+	vendorDiffCmd = &cobra.Command{
+		Use:   "diff DEPLOYMENT_DIRECTORY",
+		Short: "Report modules in the deployment folder that are outdated or locally modified.",
+		Long: "Compare module code copied into the deployment folder with the current module sources " +
+			"(embedded in ghpc or local directories) and with checksums recorded when the deployment was created. " +
+			"Modules with remote sources are not compared.",
+		Args:              cobra.MatchAll(cobra.ExactArgs(1), checkDir),
+		ValidArgsFunction: matchDirs,
+		Run:               runVendorDiffCmd,
+		SilenceUsage:      true,
+	}
+)
+
+func runVendorDiffCmd(cmd *cobra.Command, args []string) {
+	artDir := getArtifactsDir(args[0])
+	bp, ctx := artifactBlueprintOrDie(artDir)
+	diffs, err := modulewriter.DiffVendoredModules(args[0], artDir, bp)
+	checkErr(err, ctx)
+	writeVendorDiff(os.Stdout, diffs)
+}
+
+func vendorStatus(d modulewriter.VendorDiff) string {
+	if d.Err != nil {
+		return "source not available"
+	}
+	st := []string{}
+	if len(d.Outdated) > 0 {
+		if d.Recorded {
+			st = append(st, "outdated")
+		} else {
+			st = append(st, "differs from source")
+		}
+	}
+	if len(d.Modified) > 0 {
+		st = append(st, "locally modified")
+	}
+	if len(st) == 0 {
+		return "up to date"
+	}
+	return strings.Join(st, ", ")
+}
+
+func writeVendorDiff(w io.Writer, diffs []modulewriter.VendorDiff) {
+	if len(diffs) == 0 {
+		fmt.Fprintln(w, "No modules are copied into the deployment folder.")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MODULE\tSOURCE\tSTATUS")
+	for _, d := range diffs {
+		fmt.Fprintf(tw, "%s/%s\t%s\t%s\n", d.Module.Group, d.Module.ID, d.Module.Source, vendorStatus(d))
+	}
+	tw.Flush()
+
+	unrecorded := false
+	details := []string{}
+	for _, d := range diffs {
+		id := fmt.Sprintf("%s/%s", d.Module.Group, d.Module.ID)
+		unrecorded = unrecorded || !d.Recorded
+		if d.Err != nil {
+			details = append(details, fmt.Sprintf("%s: %v", id, d.Err))
+		}
+		for _, f := range d.Modified {
+			details = append(details, fmt.Sprintf("%s: modified in deployment: %s", id, f))
+		}
+		for _, f := range d.Outdated {
+			if d.Recorded {
+				details = append(details, fmt.Sprintf("%s: changed in source: %s", id, f))
+			} else {
+				details = append(details, fmt.Sprintf("%s: differs from source: %s", id, f))
+			}
+		}
+	}
+	if len(details) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, strings.Join(details, "\n"))
+	}
+	if unrecorded {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Checksums were not recorded when the deployment was created, local modifications "+
+			"can not be told from changes of the source. Re-create the deployment to record them.")
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/modulewriter"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestWriteVendorDiff(c *C) {
+	mod := func(id string) modulewriter.VendoredModule {
+		return modulewriter.VendoredModule{Group: "green", ID: config.ModuleID(id), Source: "modules/" + id}
+	}
+	{ // recorded
+		var b bytes.Buffer
+		writeVendorDiff(&b, []modulewriter.VendorDiff{
+			{Module: mod("a"), Recorded: true},
+			{Module: mod("b"), Recorded: true, Outdated: []string{"main.tf"}, Modified: []string{"outputs.tf"}},
+			{Module: mod("c"), Recorded: true, Err: errors.New("gone")},
+		})
+		out := b.String()
+		c.Check(out, Matches, `(?s)MODULE +SOURCE +STATUS\n.*modules/a +up to date\n.*modules/b +outdated, locally modified\n.*modules/c +source not available\n.*`)
+		c.Check(out, Matches, `(?s).*green/b: modified in deployment: outputs.tf\ngreen/b: changed in source: main.tf\n.*`)
+		c.Check(out, Not(Matches), `(?s).*Checksums were not recorded.*`)
+	}
+
+	{ // not recorded
+		var b bytes.Buffer
+		writeVendorDiff(&b, []modulewriter.VendorDiff{{Module: mod("a"), Outdated: []string{"main.tf"}}})
+		out := b.String()
+		c.Check(out, Matches, `(?s).*modules/a +differs from source\n.*green/a: differs from source: main.tf\n.*Checksums were not recorded.*`)
+	}
+
+	{ // nothing to compare
+		var b bytes.Buffer
+		writeVendorDiff(&b, nil)
+		c.Check(b.String(), Equals, "No modules are copied into the deployment folder.\n")
+	}
+}
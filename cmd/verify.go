@@ -0,0 +1,71 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/modulewriter"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify DEPLOYMENT_DIRECTORY",
+	Short: "Check that files of the deployment folder were not changed since it was created.",
+	Long: "Compare files of the deployment folder, including module code copied into it, with checksums " +
+		"recorded in " + modulewriter.ArtifactsManifestName + " by `ghpc create`, and report modified, missing " +
+		"and added files. Files written by deploying the groups, such as Terraform state, lock files and " +
+		"imported inputs, are not compared. Fails if any file was changed.",
+	Args:              cobra.MatchAll(cobra.ExactArgs(1), checkDir),
+	ValidArgsFunction: matchDirs,
+	Run:               runVerifyCmd,
+	SilenceUsage:      true,
+}
+
+func runVerifyCmd(cmd *cobra.Command, args []string) {
+	changes, err := modulewriter.VerifyDeployment(args[0])
+	checkErr(err, nil)
+	writeFileChanges(os.Stdout, changes)
+	if len(changes) > 0 {
+		checkErr(config.HintError{
+			Hint: "review the changes, and re-create the deployment folder with `ghpc create` to discard them",
+			Err:  fmt.Errorf("%d files of deployment folder %s were changed since it was created", len(changes), args[0])}, nil)
+	}
+}
+
+func writeFileChanges(w io.Writer, changes []modulewriter.FileChange) {
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "Files of the deployment folder match checksums recorded when it was created.")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tGROUP\tCHANGE")
+	for _, ch := range changes {
+		group := string(ch.Group)
+		if group == "" {
+			group = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", ch.Path, group, ch.Change)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,40 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"hpc-toolkit/pkg/modulewriter"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestWriteFileChanges(c *C) {
+	{ // no changes
+		var b bytes.Buffer
+		writeFileChanges(&b, []modulewriter.FileChange{})
+		c.Check(b.String(), Matches, "Files of the deployment folder match.*\n")
+	}
+	{
+		var b bytes.Buffer
+		writeFileChanges(&b, []modulewriter.FileChange{
+			{Path: "instructions.txt", Change: modulewriter.FileModified},
+			{Path: "green/extra.tf", Group: "green", Change: modulewriter.FileAdded},
+		})
+		c.Check(b.String(), Equals, "FILE              GROUP  CHANGE\n"+
+			"instructions.txt  -      modified\n"+
+			"green/extra.tf    green  added\n")
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/logging"
+	"hpc-toolkit/pkg/shell"
+	"os"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+func init() {
+	workspaceCmd.AddCommand(workspacePlanCmd, workspaceDeployCmd)
+	rootCmd.AddCommand(workspaceCmd)
+}
+
+var (
+	workspaceCmd = &cobra.Command{
+		Use:   "workspace",
+		Short: "Plan and deploy multiple related blueprints listed in a workspace file.",
+		Long: "A workspace file lists related blueprints, e.g. network, storage and clusters of several teams, " +
+			"with shared deployment variables. Blueprints are deployed in order, variables of a blueprint " +
+			"can import outputs of deployment groups of blueprints deployed before it.",
+	}
+
+	workspacePlanCmd = addCreateFlags(&cobra.Command{
+		Use:   "plan <WORKSPACE_FILE>",
+		Short: "Create deployments of all blueprints of the workspace and preview their changes.",
+		Long: "Create deployment directories of all blueprints of the workspace and plan changes of their " +
+			"Terraform deployment groups without applying them. Outputs of blueprints that are not " +
+			"deployed yet are not known, blueprints that import them keep their own values of the variables.",
+		Args:              cobra.MatchAll(cobra.ExactArgs(1), checkExists),
+		ValidArgsFunction: filterYaml,
+		Run:               runWorkspacePlanCmd,
+		SilenceUsage:      true,
+	})
+
+	workspaceDeployCmd = addDeployFlags(&cobra.Command{
+		Use:   "deploy <WORKSPACE_FILE>",
+		Short: "Create and deploy all blueprints of the workspace in order.",
+		Long: "Create and deploy all blueprints of the workspace, every blueprint is deployed after blueprints " +
+			"it imports outputs from. Flags apply to every blueprint of the workspace.",
+		Args:              cobra.MatchAll(cobra.ExactArgs(1), checkExists),
+		ValidArgsFunction: filterYaml,
+		Run:               runWorkspaceDeployCmd,
+		SilenceUsage:      true,
+	})
+)
+
+func orderedWorkspaceOrDie(path string) (config.Workspace, []config.WorkspaceBlueprint) {
+	ws, ctx, err := config.NewWorkspace(path)
+	checkErr(err, &ctx)
+	order, err := ws.Ordered()
+	checkErr(err, &ctx)
+	return ws, order
+}
+
+func runWorkspacePlanCmd(cmd *cobra.Command, args []string) {
+	ws, order := orderedWorkspaceOrDie(args[0])
+	deployments := map[string]string{} // blueprint name -> deployment directory
+	for _, b := range order {
+		logging.Info(boldGreen("Planning blueprint %q of the workspace"), b.Name)
+		vars, err := workspaceVars(ws, b, deployments, false /*requireOutputs*/)
+		checkErr(err, nil)
+		deplDir := doCreateWithVars(b.Path, vars)
+		deployments[b.Name] = deplDir
+
+		bp, ctx := artifactBlueprintOrDie(getArtifactsDir(deplDir))
+		checkErr(bp.Materialize(), ctx)
+		writeUpgradePreview(os.Stdout, previewGroups(deplDir, getArtifactsDir(deplDir), bp))
+	}
+}
+
+func runWorkspaceDeployCmd(cmd *cobra.Command, args []string) {
+	ws, order := orderedWorkspaceOrDie(args[0])
+	deployments := map[string]string{} // blueprint name -> deployment directory
+	for _, b := range order {
+		logging.Info(boldGreen("Deploying blueprint %q of the workspace"), b.Name)
+		vars, err := workspaceVars(ws, b, deployments, true /*requireOutputs*/)
+		checkErr(err, nil)
+		deplDir := doCreateWithVars(b.Path, vars)
+		doDeploy(deplDir)
+		deployments[b.Name] = deplDir
+	}
+	logging.Info(boldGreen("All %d blueprints of the workspace are deployed."), len(order))
+}
+
+// workspaceVars returns deployment variables of the workspace blueprint: shared variables
+// of the workspace, variables of the blueprint and imported outputs of upstream blueprints.
+// Outputs are read from artifacts of upstream deployments, if requireOutputs is false
+// outputs that are not exported yet are skipped.
+func workspaceVars(ws config.Workspace, b config.WorkspaceBlueprint, deployments map[string]string, requireOutputs bool) (config.Dict, error) {
+	vars := config.NewDict(ws.Vars.Items())
+	for k, v := range b.Vars.Items() {
+		vars = vars.With(k, v)
+	}
+	for _, name := range sortedImports(b) {
+		o, err := config.ParseWorkspaceOutput(b.Imports[name])
+		if err != nil {
+			return config.Dict{}, err
+		}
+		deplDir, ok := deployments[o.Blueprint]
+		if !ok {
+			return config.Dict{}, fmt.Errorf("blueprint %q must be deployed before blueprint %q", o.Blueprint, b.Name)
+		}
+		outputs, err := shell.ReadOutputs(getArtifactsDir(deplDir), o.Group)
+		if err != nil && !requireOutputs {
+			logging.Info("output %s is not known until blueprint %q is deployed, variable %q of blueprint %q is not imported", o, o.Blueprint, name, b.Name)
+			continue
+		}
+		if err != nil {
+			return config.Dict{}, config.HintError{
+				Hint: fmt.Sprintf("deploy the group with \"ghpc deploy %s --only %s\"", deplDir, o.Group),
+				Err:  fmt.Errorf("outputs of deployment group %q of blueprint %q are not exported: %w", o.Group, o.Blueprint, err)}
+		}
+		v, ok := outputs[o.Name]
+		if !ok {
+			return config.Dict{}, fmt.Errorf("deployment group %q of blueprint %q has no output %q, imported by variable %q of blueprint %q",
+				o.Group, o.Blueprint, o.Name, name, b.Name)
+		}
+		vars = vars.With(name, v)
+	}
+	return vars, nil
+}
+
+func sortedImports(b config.WorkspaceBlueprint) []string {
+	names := maps.Keys(b.Imports)
+	slices.Sort(names)
+	return names
+}
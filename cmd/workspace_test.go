@@ -0,0 +1,78 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/modulewriter"
+	"os"
+	"path/filepath"
+
+	"github.com/zclconf/go-cty/cty"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestWorkspaceVars(c *C) {
+	deplDir := c.MkDir()
+	artDir := modulewriter.ArtifactsDir(deplDir)
+	c.Assert(os.MkdirAll(artDir, 0755), IsNil)
+	c.Assert(modulewriter.WriteHclAttributes(map[string]cty.Value{
+		"network_name_network1": cty.StringVal("hpc-net"),
+	}, filepath.Join(artDir, "primary_outputs.tfvars")), IsNil)
+
+	ws := config.Workspace{Vars: config.NewDict(map[string]cty.Value{
+		"project_id": cty.StringVal("shared"),
+		"region":     cty.StringVal("us-central1"),
+	})}
+	b := config.WorkspaceBlueprint{
+		Name:    "cluster",
+		Vars:    config.NewDict(map[string]cty.Value{"region": cty.StringVal("europe-west4")}),
+		Imports: map[string]string{"network_name": "network.primary.network_name_network1"},
+	}
+	deployments := map[string]string{"network": deplDir}
+
+	{ // OK: blueprint vars override shared vars, outputs are imported
+		vars, err := workspaceVars(ws, b, deployments, true)
+		c.Assert(err, IsNil)
+		c.Check(vars.Items(), DeepEquals, map[string]cty.Value{
+			"project_id":   cty.StringVal("shared"),
+			"region":       cty.StringVal("europe-west4"),
+			"network_name": cty.StringVal("hpc-net"),
+		})
+	}
+
+	{ // FAIL: output does not exist
+		b := b
+		b.Imports = map[string]string{"network_name": "network.primary.nope"}
+		_, err := workspaceVars(ws, b, deployments, true)
+		c.Check(err, ErrorMatches, `.*has no output "nope".*`)
+	}
+
+	{ // group is not deployed: error on deploy, skipped on plan
+		b := b
+		b.Imports = map[string]string{"network_name": "network.secondary.network_name"}
+		_, err := workspaceVars(ws, b, deployments, true)
+		c.Check(err, ErrorMatches, `.*outputs of deployment group "secondary" of blueprint "network" are not exported.*`)
+
+		vars, err := workspaceVars(ws, b, deployments, false)
+		c.Assert(err, IsNil)
+		c.Check(vars.Has("network_name"), Equals, false)
+	}
+
+	{ // FAIL: upstream blueprint is not created
+		_, err := workspaceVars(ws, b, map[string]string{}, false)
+		c.Check(err, ErrorMatches, `blueprint "network" must be deployed before blueprint "cluster"`)
+	}
+}
@@ -0,0 +1,107 @@
+/**
+ * Copyright 2024 Google LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+*/
+
+locals {
+  # This label allows for billing report tracking based on module.
+  labels = merge(var.labels, { ghpc_module = "login-load-balancer", ghpc_role = "network" })
+
+  name = "${var.deployment_name}-${var.name_prefix}"
+  # Google Cloud health check probes originate from these ranges
+  health_check_ranges = ["35.191.0.0/16", "130.211.0.0/22"]
+}
+
+data "google_compute_subnetwork" "subnetwork" {
+  self_link = var.subnetwork_self_link
+}
+
+resource "google_compute_instance_group" "login" {
+  project   = var.project_id
+  name      = local.name
+  zone      = var.zone
+  network   = data.google_compute_subnetwork.subnetwork.network
+  instances = var.instance_self_links
+
+  named_port {
+    name = "ssh"
+    port = var.port
+  }
+}
+
+resource "google_compute_region_health_check" "login" {
+  project             = var.project_id
+  name                = local.name
+  region              = var.region
+  check_interval_sec  = var.health_check.check_interval_sec
+  timeout_sec         = var.health_check.timeout_sec
+  healthy_threshold   = var.health_check.healthy_threshold
+  unhealthy_threshold = var.health_check.unhealthy_threshold
+
+  tcp_health_check {
+    port = var.port
+  }
+}
+
+resource "google_compute_region_backend_service" "login" {
+  project               = var.project_id
+  name                  = local.name
+  region                = var.region
+  protocol              = "TCP"
+  load_balancing_scheme = "INTERNAL"
+  # keep connections of a client on the same login node, e.g. for tmux sessions
+  session_affinity = "CLIENT_IP"
+  health_checks    = [google_compute_region_health_check.login.id]
+
+  backend {
+    group          = google_compute_instance_group.login.id
+    balancing_mode = "CONNECTION"
+  }
+}
+
+resource "google_compute_forwarding_rule" "login" {
+  project               = var.project_id
+  name                  = local.name
+  region                = var.region
+  load_balancing_scheme = "INTERNAL"
+  ip_protocol           = "TCP"
+  ports                 = [var.port]
+  subnetwork            = var.subnetwork_self_link
+  backend_service       = google_compute_region_backend_service.login.id
+  labels                = local.labels
+}
+
+resource "google_compute_firewall" "health_check" {
+  project       = data.google_compute_subnetwork.subnetwork.project
+  name          = "${local.name}-health-check"
+  network       = data.google_compute_subnetwork.subnetwork.network
+  direction     = "INGRESS"
+  source_ranges = local.health_check_ranges
+  target_tags   = length(var.target_tags) > 0 ? var.target_tags : null
+
+  allow {
+    protocol = "tcp"
+    ports    = [var.port]
+  }
+}
+
+resource "google_dns_record_set" "login" {
+  count        = var.dns_zone_name == null ? 0 : 1
+  project      = coalesce(var.dns_project_id, var.project_id)
+  managed_zone = var.dns_zone_name
+  name         = var.dns_record_name
+  type         = "A"
+  ttl          = 300
+  rrdatas      = [google_compute_forwarding_rule.login.ip_address]
+}
@@ -0,0 +1,34 @@
+/**
+ * Copyright 2024 Google LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+*/
+
+output "ip_address" {
+  description = "Internal IP address of the load balancer of the login nodes."
+  value       = google_compute_forwarding_rule.login.ip_address
+}
+
+output "dns_name" {
+  description = "Name of the DNS record of the load balancer, null if no record is created."
+  value       = one(google_dns_record_set.login[*].name)
+}
+
+output "instructions" {
+  description = "Instructions on how to SSH into a login node through the load balancer."
+  value       = <<-EOT
+    Connect to a login node through the load balancer from a host of the VPC network:
+      ssh ${coalesce(one(google_dns_record_set.login[*].name), google_compute_forwarding_rule.login.ip_address)}
+    Connections of a client are kept on the same login node while it is healthy.
+  EOT
+}
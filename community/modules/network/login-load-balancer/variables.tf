@@ -0,0 +1,98 @@
+/**
+ * Copyright 2024 Google LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+*/
+
+variable "project_id" {
+  description = "Project in which the load balancer is created."
+  type        = string
+}
+
+variable "deployment_name" {
+  description = "Name of the deployment, used to name resources of the load balancer."
+  type        = string
+}
+
+variable "name_prefix" {
+  description = "Appended to the deployment name to name resources of the load balancer."
+  type        = string
+  default     = "login"
+}
+
+variable "region" {
+  description = "Region of the load balancer, must be the region of the login nodes."
+  type        = string
+}
+
+variable "zone" {
+  description = "Zone of the login nodes."
+  type        = string
+}
+
+variable "labels" {
+  description = "Labels to add to the forwarding rule. Key-value pairs."
+  type        = map(string)
+}
+
+variable "subnetwork_self_link" {
+  description = "Self link of the subnetwork of the login nodes, the address of the load balancer is allocated in it."
+  type        = string
+}
+
+variable "instance_self_links" {
+  description = "Self links of the login nodes, e.g. the `self_link` output of a vm-instance module."
+  type        = list(string)
+}
+
+variable "port" {
+  description = "TCP port of SSH on the login nodes, used for load balancing and health checks."
+  type        = number
+  default     = 22
+}
+
+variable "health_check" {
+  description = "Timing of the TCP health check of the login nodes."
+  type = object({
+    check_interval_sec  = optional(number, 5)
+    timeout_sec         = optional(number, 5)
+    healthy_threshold   = optional(number, 2)
+    unhealthy_threshold = optional(number, 2)
+  })
+  default  = {}
+  nullable = false
+}
+
+variable "target_tags" {
+  description = "Network tags of the login nodes. Health check probes are allowed to all instances of the network if empty."
+  type        = list(string)
+  default     = []
+}
+
+variable "dns_zone_name" {
+  description = "Name of a Cloud DNS managed zone in which an A record of the load balancer is created. No record is created if null."
+  type        = string
+  default     = null
+}
+
+variable "dns_project_id" {
+  description = "Project of the Cloud DNS managed zone, defaults to `project_id`."
+  type        = string
+  default     = null
+}
+
+variable "dns_record_name" {
+  description = "Fully qualified name of the A record of the load balancer, e.g. `login.hpc.internal.`; required with `dns_zone_name`."
+  type        = string
+  default     = null
+}
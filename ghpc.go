@@ -32,8 +32,12 @@ var gitCommitInfo string
 var gitCommitHash string
 var gitInitialHash string
 
+// Digest of the embedded module library, see Makefile
+var modulesDigest string
+
 func main() {
 	sourcereader.ModuleFS = moduleFS
+	sourcereader.ModulesDigest = modulesDigest
 	cmd.GitTagVersion = gitTagVersion
 	cmd.GitBranch = gitBranch
 	cmd.GitCommitInfo = gitCommitInfo
@@ -0,0 +1,271 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package apiclient configures clients of Google Cloud APIs to share
+// limits on request rate and concurrency, and to back off on quota and
+// transient server errors.
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+)
+
+const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// Limits of API requests shared by all clients
+type Limits struct {
+	MaxConcurrency int     // maximum number of requests in flight
+	QPS            float64 // maximum number of requests per second
+	MaxRetries     int     // maximum number of retries of rate-limited requests and transient errors
+}
+
+// DefaultLimits are used unless configured otherwise
+var DefaultLimits = Limits{MaxConcurrency: 8, QPS: 20, MaxRetries: 5}
+
+var (
+	mu     sync.Mutex
+	shared *limitedTransport
+)
+
+// Configure sets limits for clients created after this call
+func Configure(l Limits) {
+	mu.Lock()
+	defer mu.Unlock()
+	shared = newLimitedTransport(http.DefaultTransport, l)
+}
+
+func transport() *limitedTransport {
+	mu.Lock()
+	defer mu.Unlock()
+	if shared == nil {
+		shared = newLimitedTransport(http.DefaultTransport, DefaultLimits)
+	}
+	return shared
+}
+
+// Options returns client options to be passed to constructors of API services, e.g.:
+//
+//	opts, err := apiclient.Options(ctx)
+//	s, err := compute.NewService(ctx, opts...)
+//
+// Extra options (e.g. quota project) are applied to the authenticated transport.
+// Requests of the clients are cancelled when ctx is done, even if calls do not set
+// their own context.
+func Options(ctx context.Context, extra ...option.ClientOption) ([]option.ClientOption, error) {
+	opts := append([]option.ClientOption{option.WithScopes(cloudPlatformScope)}, extra...)
+	var t http.RoundTripper
+	t, err := htransport.NewTransport(ctx, transport(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	if ctx.Done() != nil {
+		t = boundTransport{ctx: ctx, base: t}
+	}
+	return []option.ClientOption{option.WithHTTPClient(&http.Client{Transport: t})}, nil
+}
+
+// New creates API service using the shared limits, e.g.:
+//
+//	s, err := apiclient.New(ctx, compute.NewService)
+func New[S any](ctx context.Context, newService func(context.Context, ...option.ClientOption) (S, error), extra ...option.ClientOption) (S, error) {
+	opts, err := Options(ctx, extra...)
+	if err != nil {
+		var zero S
+		return zero, err
+	}
+	return newService(ctx, opts...)
+}
+
+// boundTransport cancels requests when ctx is done
+type boundTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t boundTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rctx, cancel := context.WithCancel(req.Context())
+	stop := context.AfterFunc(t.ctx, cancel)
+	release := func() {
+		stop()
+		cancel()
+	}
+	resp, err := t.base.RoundTrip(req.WithContext(rctx))
+	if err != nil {
+		release()
+		return nil, err
+	}
+	// the body is read after RoundTrip returns, keep the request alive until it is closed
+	resp.Body = releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b releasingBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
+
+// limitedTransport limits rate and concurrency of requests,
+// and retries requests rejected due to rate limits
+type limitedTransport struct {
+	base       http.RoundTripper
+	sem        chan struct{}
+	limiter    *rate.Limiter
+	maxRetries int
+	// backoff returns delay before the retry attempt (starting with 0)
+	backoff func(attempt int) time.Duration
+}
+
+func newLimitedTransport(base http.RoundTripper, l Limits) *limitedTransport {
+	conc := l.MaxConcurrency
+	if conc < 1 {
+		conc = 1
+	}
+	lim := rate.NewLimiter(rate.Inf, 0)
+	if l.QPS > 0 {
+		lim = rate.NewLimiter(rate.Limit(l.QPS), conc)
+	}
+	return &limitedTransport{
+		base:       base,
+		sem:        make(chan struct{}, conc),
+		limiter:    lim,
+		maxRetries: l.MaxRetries,
+		backoff:    exponentialBackoff,
+	}
+}
+
+func exponentialBackoff(attempt int) time.Duration {
+	d := time.Second << attempt
+	if d > 30*time.Second || d <= 0 {
+		d = 30 * time.Second
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2))) // add jitter
+}
+
+// isRateLimited returns true if response indicates that request was rejected due to rate limits
+// or exhausted quota that is expected to be replenished
+func isRateLimited(resp *http.Response, body []byte) bool {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusForbidden:
+		b := string(body)
+		return strings.Contains(b, "rateLimitExceeded") || strings.Contains(b, "RATE_LIMIT_EXCEEDED")
+	}
+	return false
+}
+
+// isTransient returns true if response indicates a server error that may not recur,
+// only requests that do not change resources are retried on such errors
+func isTransient(req *http.Request, resp *http.Response) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	switch resp.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	s, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || s < 0 {
+		return 0, false
+	}
+	return time.Duration(s) * time.Second, true
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	select {
+	case t.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-t.sem }()
+
+	for attempt := 0; ; attempt++ {
+		if err := t.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+		r := req
+		if attempt > 0 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = req.Clone(ctx)
+			r.Body = body
+		}
+
+		resp, err := t.base.RoundTrip(r)
+		record(resp, err)
+		canRetry := attempt < t.maxRetries && (req.Body == nil || req.GetBody != nil)
+		if err != nil || !canRetry {
+			return resp, err
+		}
+		transient := isTransient(req, resp)
+		if !transient && resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusForbidden {
+			return resp, nil
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if !transient && !isRateLimited(resp, body) {
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+			return resp, nil
+		}
+
+		d, ok := retryAfter(resp)
+		if !ok {
+			d = t.backoff(attempt)
+		}
+		if err := sleep(ctx, d); err != nil {
+			return nil, err
+		}
+	}
+}
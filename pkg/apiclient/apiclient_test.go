@@ -0,0 +1,198 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apiclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type MySuite struct{}
+
+var _ = Suite(&MySuite{})
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+func testTransport(l Limits) *limitedTransport {
+	t := newLimitedTransport(http.DefaultTransport, l)
+	t.backoff = func(int) time.Duration { return time.Millisecond }
+	return t
+}
+
+func (s *MySuite) TestRetryRateLimited(c *C) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, `{"error": {"errors": [{"reason": "rateLimitExceeded"}]}}`)
+		default:
+			io.WriteString(w, "ok")
+		}
+	}))
+	defer srv.Close()
+
+	ResetStats()
+	defer ResetStats()
+	client := &http.Client{Transport: testTransport(Limits{MaxConcurrency: 1, MaxRetries: 5})}
+	resp, err := client.Get(srv.URL)
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	c.Check(resp.StatusCode, Equals, http.StatusOK)
+	c.Check(string(body), Equals, "ok")
+	c.Check(calls.Load(), Equals, int32(3))
+	c.Check(Stats(), DeepEquals, map[string]int{"429": 1, "403": 1, "200": 1})
+}
+
+func (s *MySuite) TestNoRetryOnPermissionDenied(c *C) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `{"error": {"errors": [{"reason": "forbidden"}]}}`)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: testTransport(Limits{MaxConcurrency: 1, MaxRetries: 5})}
+	resp, err := client.Post(srv.URL, "text/plain", strings.NewReader("payload"))
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	c.Check(resp.StatusCode, Equals, http.StatusForbidden)
+	c.Check(string(body), Matches, ".*forbidden.*") // body is preserved
+	c.Check(calls.Load(), Equals, int32(1))
+}
+
+func (s *MySuite) TestGiveUpAfterMaxRetries(c *C) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: testTransport(Limits{MaxConcurrency: 1, MaxRetries: 2})}
+	resp, err := client.Get(srv.URL)
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	c.Check(resp.StatusCode, Equals, http.StatusTooManyRequests)
+	c.Check(calls.Load(), Equals, int32(3))
+}
+
+func (s *MySuite) TestMaxConcurrency(c *C) {
+	var inFlight, peak atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		inFlight.Add(-1)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: testTransport(Limits{MaxConcurrency: 2})}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if resp, err := client.Get(srv.URL); err == nil {
+				resp.Body.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	c.Check(peak.Load() <= 2, Equals, true)
+}
+
+func (s *MySuite) TestRetryServerErrors(c *C) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: testTransport(Limits{MaxConcurrency: 1, MaxRetries: 5})}
+
+	{ // reads are retried
+		resp, err := client.Get(srv.URL)
+		c.Assert(err, IsNil)
+		resp.Body.Close()
+		c.Check(resp.StatusCode, Equals, http.StatusOK)
+		c.Check(calls.Load(), Equals, int32(3))
+	}
+
+	{ // other requests are not
+		calls.Store(0)
+		resp, err := client.Post(srv.URL, "text/plain", strings.NewReader("payload"))
+		c.Assert(err, IsNil)
+		resp.Body.Close()
+		c.Check(resp.StatusCode, Equals, http.StatusServiceUnavailable)
+		c.Check(calls.Load(), Equals, int32(1))
+	}
+}
+
+func (s *MySuite) TestBoundTransportCancelled(c *C) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	client := &http.Client{Transport: boundTransport{ctx: ctx, base: testTransport(Limits{MaxConcurrency: 1})}}
+	start := time.Now()
+	_, err := client.Get(srv.URL) // the request itself has no deadline
+	c.Check(err, ErrorMatches, ".*context canceled.*")
+	c.Check(time.Since(start) < 5*time.Second, Equals, true)
+}
+
+func (s *MySuite) TestBoundTransportReadsBody(c *C) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := &http.Client{Transport: boundTransport{ctx: ctx, base: testTransport(Limits{MaxConcurrency: 1})}}
+	resp, err := client.Get(srv.URL)
+	c.Assert(err, IsNil)
+	body, err := io.ReadAll(resp.Body)
+	c.Check(err, IsNil)
+	c.Check(string(body), Equals, "ok")
+	c.Check(resp.Body.Close(), IsNil)
+}
@@ -0,0 +1,55 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apiclient
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+
+	"golang.org/x/exp/maps"
+)
+
+var (
+	statsMu sync.Mutex
+	stats   = map[string]int{}
+)
+
+// record counts the attempt of a request by HTTP status code, or as "error" if
+// no response was received
+func record(resp *http.Response, err error) {
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	stats[code]++
+}
+
+// Stats returns numbers of attempted requests of all clients by HTTP status
+// code, retries included. Requests that failed without response count as "error".
+func Stats() map[string]int {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	return maps.Clone(stats)
+}
+
+// ResetStats discards counts of requests
+func ResetStats() {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	stats = map[string]int{}
+}
@@ -0,0 +1,216 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package catalog generates user-facing documentation of blueprints, e.g. for
+// publishing blueprints in a service catalog
+package catalog
+
+import (
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/modulereader"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/gocty"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// Variable is a deployment variable of the blueprint
+type Variable struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Default is the value set in the blueprint, in HCL syntax
+	Default     string `json:"default,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Required variables have no value in the blueprint and must be set on deployment
+	Required bool `json:"required"`
+}
+
+// Output is an output of a module exported by the blueprint
+type Output struct {
+	Module      config.ModuleID `json:"module"`
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Sensitive   bool            `json:"sensitive,omitempty"`
+}
+
+// Credentials lists what the credentials deploying the blueprint require
+type Credentials struct {
+	// Services are APIs that must be enabled in the project
+	Services []string `json:"services"`
+	// Permissions are IAM permissions of the deploying credentials
+	Permissions []string `json:"permissions"`
+}
+
+// Document is the documentation of a blueprint
+type Document struct {
+	Blueprint   string      `json:"blueprint"`
+	Variables   []Variable  `json:"variables"`
+	Credentials Credentials `json:"credentials"`
+	Outputs     []Output    `json:"outputs"`
+	Cost        Cost        `json:"cost"`
+}
+
+// New documents the expanded blueprint, required are deployment variables that
+// have no value in the blueprint
+func New(bp config.Blueprint, required []string) Document {
+	return Document{
+		Blueprint:   bp.BlueprintName,
+		Variables:   variables(bp, required),
+		Credentials: credentials(bp),
+		Outputs:     outputs(bp),
+		Cost:        EstimateCost(bp),
+	}
+}
+
+// moduleInputs returns inputs of the module, modules without info have no inputs
+func moduleInputs(m config.Module) []modulereader.VarInfo {
+	info, err := modulereader.GetModuleInfo(m.Source, m.Kind.String())
+	if err != nil {
+		return nil
+	}
+	return info.Inputs
+}
+
+// varInput returns the first module input that is set to the deployment variable,
+// its description and type document the variable
+func varInput(bp config.Blueprint, name string) (modulereader.VarInfo, bool) {
+	ref := config.GlobalRef(name)
+	var found modulereader.VarInfo
+	ok := false
+	bp.WalkModulesSafe(func(_ config.ModulePath, m *config.Module) {
+		if ok {
+			return
+		}
+		for _, in := range moduleInputs(*m) {
+			if !m.Settings.Has(in.Name) {
+				continue
+			}
+			refs := config.ValueReferences(m.Settings.Get(in.Name))
+			if _, is := refs[ref]; is && len(refs) == 1 {
+				found, ok = in, true
+				return
+			}
+		}
+	})
+	return found, ok
+}
+
+func variables(bp config.Blueprint, required []string) []Variable {
+	names := maps.Keys(bp.Vars.Items())
+	slices.Sort(names)
+	res := []Variable{}
+	for _, n := range names {
+		v := bp.Vars.Get(n)
+		doc := Variable{Name: n, Type: "any", Required: v.IsNull() || slices.Contains(required, n)}
+		if !doc.Required {
+			doc.Type = typeexpr.TypeString(v.Type())
+			doc.Default = strings.TrimSpace(string(config.TokensForValue(v).Bytes()))
+		}
+		if in, ok := varInput(bp, n); ok {
+			doc.Description = in.Description
+			if in.Type != cty.NilType && in.Type != cty.DynamicPseudoType {
+				doc.Type = typeexpr.TypeString(in.Type)
+			}
+		}
+		res = append(res, doc)
+	}
+	return res
+}
+
+func credentials(bp config.Blueprint) Credentials {
+	res := Credentials{Services: []string{}, Permissions: []string{}}
+	bp.WalkModulesSafe(func(_ config.ModulePath, m *config.Module) {
+		info, err := modulereader.GetModuleInfo(m.Source, m.Kind.String())
+		if err != nil {
+			return
+		}
+		for _, s := range info.Metadata.Spec.Requirements.Services {
+			if !slices.Contains(res.Services, s) {
+				res.Services = append(res.Services, s)
+			}
+		}
+		for _, p := range info.Metadata.Ghpc.Permissions {
+			if !slices.Contains(res.Permissions, p) {
+				res.Permissions = append(res.Permissions, p)
+			}
+		}
+	})
+	slices.Sort(res.Services)
+	slices.Sort(res.Permissions)
+	return res
+}
+
+func outputs(bp config.Blueprint) []Output {
+	res := []Output{}
+	bp.WalkModulesSafe(func(_ config.ModulePath, m *config.Module) {
+		descs := map[string]string{}
+		if info, err := modulereader.GetModuleInfo(m.Source, m.Kind.String()); err == nil {
+			for _, o := range info.Outputs {
+				descs[o.Name] = o.Description
+			}
+		}
+		for _, o := range m.Outputs {
+			d := o.Description
+			if d == "" {
+				d = descs[o.Name]
+			}
+			res = append(res, Output{Module: m.ID, Name: o.Name, Description: d, Sensitive: o.Sensitive})
+		}
+	})
+	return res
+}
+
+// setting returns the value of the module setting, or the default of the module
+// input if it is not set; returns false if the value is not known before deployment
+func setting(bp config.Blueprint, m config.Module, name string) (cty.Value, bool) {
+	if m.Settings.Has(name) {
+		v, err := bp.Eval(m.Settings.Get(name))
+		if err != nil || !v.IsWhollyKnown() || v.IsNull() {
+			return cty.NilVal, false
+		}
+		return v, true
+	}
+	for _, in := range moduleInputs(m) {
+		if in.Name != name || in.Default == nil {
+			continue
+		}
+		ty, err := gocty.ImpliedType(in.Default)
+		if err != nil {
+			return cty.NilVal, false
+		}
+		v, err := gocty.ToCtyValue(in.Default, ty)
+		return v, err == nil
+	}
+	return cty.NilVal, false
+}
+
+func stringSetting(bp config.Blueprint, m config.Module, name string) (string, bool) {
+	v, ok := setting(bp, m, name)
+	if !ok || v.Type() != cty.String {
+		return "", false
+	}
+	return v.AsString(), true
+}
+
+func numberSetting(bp config.Blueprint, m config.Module, name string) (float64, bool) {
+	v, ok := setting(bp, m, name)
+	if !ok || v.Type() != cty.Number {
+		return 0, false
+	}
+	f, _ := v.AsBigFloat().Float64()
+	return f, true
+}
@@ -0,0 +1,158 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catalog
+
+import (
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/modulereader"
+	"strings"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+	. "gopkg.in/check.v1"
+)
+
+type MySuite struct{}
+
+var _ = Suite(&MySuite{})
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+func testBlueprint(mods ...config.Module) config.Blueprint {
+	return config.Blueprint{
+		BlueprintName: "test-bp",
+		Vars: config.NewDict(map[string]cty.Value{
+			"project_id": cty.StringVal(""),
+			"region":     cty.StringVal("us-central1"),
+		}),
+		Groups: []config.Group{{Name: "primary", Modules: mods}},
+	}
+}
+
+func testModule(id string, source string, info modulereader.ModuleInfo, settings map[string]cty.Value) config.Module {
+	modulereader.SetModuleInfo(source, config.TerraformKind.String(), info)
+	return config.Module{
+		ID:       config.ModuleID(id),
+		Source:   source,
+		Kind:     config.TerraformKind,
+		Settings: config.NewDict(settings),
+	}
+}
+
+func (s *MySuite) TestMachineShape(c *C) {
+	type test struct {
+		mt     string
+		family string
+		vcpus  float64
+		memGB  float64
+		gpus   float64
+		ok     bool
+	}
+	a2vcpus := 24.0
+	for _, t := range []test{
+		{"n2-standard-4", "n2", 4, 16, 0, true},
+		{"c2-standard-60", "c2", 60, 240, 0, true},
+		{"n1-highcpu-8", "n1", 8, 7.2, 0, true},
+		{"a2-highgpu-2g", "a2", a2vcpus, a2vcpus * 7.1, 2, true},
+		{"g2-standard-24", "g2", 24, 96, 2, true},
+		{"n2-custom-4-8192", "", 0, 0, 0, false},
+		{"x9-standard-4", "", 0, 0, 0, false},
+		{"e2-micro", "", 0, 0, 0, false},
+	} {
+		family, vcpus, memGB, gpus, ok := machineShape(t.mt)
+		c.Check(ok, Equals, t.ok, Commentf("%s", t.mt))
+		c.Check(family, Equals, t.family, Commentf("%s", t.mt))
+		c.Check(vcpus, Equals, t.vcpus, Commentf("%s", t.mt))
+		c.Check(memGB, Equals, t.memGB, Commentf("%s", t.mt))
+		c.Check(gpus, Equals, t.gpus, Commentf("%s", t.mt))
+	}
+}
+
+func (s *MySuite) TestEstimateCost(c *C) {
+	fs := testModule("homefs", "./catalog/fs", modulereader.ModuleInfo{
+		Inputs: []modulereader.VarInfo{{Name: "filestore_tier", Type: cty.String}, {Name: "size_gb", Type: cty.Number}},
+	}, map[string]cty.Value{
+		"filestore_tier": cty.StringVal("BASIC_HDD"),
+		"size_gb":        cty.NumberIntVal(1024),
+	})
+	nodes := testModule("nodes", "./catalog/nodes", modulereader.ModuleInfo{
+		Inputs: []modulereader.VarInfo{
+			{Name: "machine_type", Type: cty.String},
+			{Name: "node_count_static", Type: cty.Number, Default: 1},
+			{Name: "node_count_dynamic_max", Type: cty.Number, Default: 10},
+			{Name: "disk_size_gb", Type: cty.Number, Default: 50},
+			{Name: "disk_type", Type: cty.String, Default: "pd-standard"},
+		},
+	}, map[string]cty.Value{
+		"machine_type":           cty.StringVal("n2-standard-4"),
+		"node_count_dynamic_max": cty.NumberIntVal(4),
+	})
+	custom := testModule("custom", "./catalog/custom", modulereader.ModuleInfo{}, map[string]cty.Value{
+		"machine_type": cty.StringVal("n2-custom-4-8192"),
+	})
+
+	cost := EstimateCost(testBlueprint(fs, nodes, custom))
+	c.Assert(cost.Items, HasLen, 2)
+
+	c.Check(cost.Items[0].Resource, Equals, "Filestore BASIC_HDD 1024 GB")
+	c.Check(cost.Items[0].MinMonthly, Equals, 1024*0.16)
+
+	n := cost.Items[1]
+	c.Check(n.Resource, Equals, "n2-standard-4, 50 GB pd-standard")
+	c.Check([]float64{n.MinInstances, n.MaxInstances}, DeepEquals, []float64{1, 5})
+	monthly := (4*0.031611+16*0.004237)*hoursPerMonth + 50*0.04
+	c.Check(n.MinMonthly, Equals, monthly)
+	c.Check(n.MaxMonthly, Equals, 5*monthly)
+
+	c.Check(cost.MinMonthly, Equals, 1024*0.16+monthly)
+	c.Check(cost.MaxMonthly, Equals, 1024*0.16+5*monthly)
+	c.Check(cost.NotEstimated, DeepEquals, []string{`n2-custom-4-8192 of module "custom"`})
+}
+
+func (s *MySuite) TestDocument(c *C) {
+	vm := testModule("vm", "./catalog/vm", modulereader.ModuleInfo{
+		Inputs: []modulereader.VarInfo{
+			{Name: "project_id", Type: cty.String, Description: "Project to deploy to"},
+			{Name: "region", Type: cty.String, Description: "Region of | the VM"},
+		},
+		Outputs: []modulereader.OutputInfo{{Name: "ip", Description: "IP of the VM"}},
+		Metadata: modulereader.Metadata{
+			Spec: modulereader.MetadataSpec{Requirements: modulereader.MetadataRequirements{
+				Services: []string{"compute.googleapis.com"}}},
+		},
+	}, map[string]cty.Value{
+		"project_id": config.GlobalRef("project_id").AsValue(),
+		"region":     config.GlobalRef("region").AsValue(),
+	})
+	vm.Outputs = []modulereader.OutputInfo{{Name: "ip"}}
+
+	doc := New(testBlueprint(vm), []string{"project_id"})
+	c.Check(doc.Variables, DeepEquals, []Variable{
+		{Name: "project_id", Type: "string", Description: "Project to deploy to", Required: true},
+		{Name: "region", Type: "string", Default: `"us-central1"`, Description: "Region of | the VM"},
+	})
+	c.Check(doc.Credentials, DeepEquals, Credentials{
+		Services: []string{"compute.googleapis.com"}, Permissions: []string{}})
+	c.Check(doc.Outputs, DeepEquals, []Output{{Module: "vm", Name: "ip", Description: "IP of the VM"}})
+
+	md := doc.Markdown()
+	c.Check(strings.HasPrefix(md, "# test-bp\n"), Equals, true)
+	c.Check(md, Matches, "(?s).*\\| `project_id` \\| `string` \\|  \\| yes \\| Project to deploy to \\|.*")
+	c.Check(md, Matches, "(?s).*Region of \\\\\\| the VM.*")
+	c.Check(md, Matches, "(?s).*\\* `compute.googleapis.com`.*")
+	c.Check(md, Matches, "(?s).*\\| `vm` \\| `ip` \\| IP of the VM \\|.*")
+}
@@ -0,0 +1,265 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catalog
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// hoursPerMonth is the number of hours used to estimate monthly costs
+const hoursPerMonth = 730
+
+// Prices below are approximate on-demand list prices in USD of us-central1. They are
+// only meant to give an order of magnitude of the cost of a blueprint, actual prices
+// depend on the region, discounts and usage.
+
+// familyPrice is the hourly price of a vCPU and of a GB of memory of a machine family
+type familyPrice struct{ vcpu, memGB float64 }
+
+var familyPrices = map[string]familyPrice{
+	"e2":  {0.021811, 0.002923},
+	"n1":  {0.031611, 0.004237},
+	"n2":  {0.031611, 0.004237},
+	"n2d": {0.027502, 0.003686},
+	"t2d": {0.027502, 0.003686},
+	"t2a": {0.0308, 0.0037},
+	"c2":  {0.03398, 0.00455},
+	"c2d": {0.029563, 0.003959},
+	"c3":  {0.03465, 0.003938},
+	"c3d": {0.029563, 0.003959},
+	"h3":  {0.04411, 0.0059},
+	"a2":  {0.031611, 0.004237},
+	"a3":  {0.031611, 0.004237},
+	"g2":  {0.024988, 0.002927},
+}
+
+// memPerVcpu is memory in GB per vCPU of machine type classes
+var memPerVcpu = map[string]float64{
+	"standard": 4, "highmem": 8, "highcpu": 1, "megamem": 14.9, "ultramem": 24,
+	"highgpu": 7.1, "ultragpu": 14.2, "megagpu": 7.1,
+}
+
+// gpuPrices are hourly prices of a GPU by accelerator type
+var gpuPrices = map[string]float64{
+	"nvidia-tesla-t4":   0.35,
+	"nvidia-tesla-v100": 2.48,
+	"nvidia-tesla-p100": 1.46,
+	"nvidia-tesla-a100": 2.93,
+	"nvidia-a100-80gb":  3.93,
+	"nvidia-h100-80gb":  11.06,
+	"nvidia-l4":         0.56,
+}
+
+// diskPrices are monthly prices of a GB of persistent disk and Filestore capacity
+var diskPrices = map[string]float64{
+	"pd-standard":    0.04,
+	"pd-balanced":    0.10,
+	"pd-ssd":         0.17,
+	"pd-extreme":     0.125,
+	"BASIC_HDD":      0.16,
+	"BASIC_SSD":      0.30,
+	"ZONAL":          0.25,
+	"HIGH_SCALE_SSD": 0.30,
+	"ENTERPRISE":     0.60,
+}
+
+// instanceCountSettings are settings of minimal and maximal number of instances
+// created by a module, the first entry with a known setting or module default is used.
+// Dynamic nodes of Slurm are created in addition to static nodes.
+var instanceCountSettings = []struct {
+	min, max string
+	additive bool
+}{
+	{"instance_count", "instance_count", false},
+	{"node_count_static", "node_count_dynamic_max", true},
+	{"static_node_count", "static_node_count", false},
+	{"num_instances", "num_instances", false},
+	{"autoscaling_total_min_nodes", "autoscaling_total_max_nodes", false},
+	{"total_min_nodes", "total_max_nodes", false},
+}
+
+// CostItem is the estimated monthly cost of resources of a module
+type CostItem struct {
+	Module       config.ModuleID `json:"module"`
+	Resource     string          `json:"resource"`
+	MinInstances float64         `json:"min_instances"`
+	MaxInstances float64         `json:"max_instances"`
+	MinMonthly   float64         `json:"min_monthly"`
+	MaxMonthly   float64         `json:"max_monthly"`
+}
+
+// Cost is the estimated range of monthly cost of a blueprint in USD
+type Cost struct {
+	Items      []CostItem `json:"items"`
+	MinMonthly float64    `json:"min_monthly"`
+	MaxMonthly float64    `json:"max_monthly"`
+	// NotEstimated lists resources which price is not known
+	NotEstimated []string `json:"not_estimated,omitempty"`
+}
+
+// machineShape returns vCPUs, memory in GB and number of attached GPUs of the machine
+// type, derived from its name; returns false for unknown or custom machine types
+func machineShape(machineType string) (family string, vcpus float64, memGB float64, gpus float64, ok bool) {
+	parts := strings.Split(machineType, "-")
+	if len(parts) != 3 {
+		return "", 0, 0, 0, false
+	}
+	family, class, size := parts[0], parts[1], parts[2]
+	perVcpu, ok := memPerVcpu[class]
+	if _, known := familyPrices[family]; !ok || !known {
+		return "", 0, 0, 0, false
+	}
+	if strings.HasSuffix(size, "g") { // accelerator-optimized, e.g. a2-highgpu-4g
+		n, err := strconv.ParseFloat(strings.TrimSuffix(size, "g"), 64)
+		if err != nil {
+			return "", 0, 0, 0, false
+		}
+		vcpus := 12 * n
+		if family == "a3" {
+			vcpus = 26 * n
+		}
+		return family, vcpus, vcpus * perVcpu, n, true
+	}
+	n, err := strconv.ParseFloat(size, 64)
+	if err != nil {
+		return "", 0, 0, 0, false
+	}
+	if family == "g2" { // G2 attaches one L4 GPU per 12 vCPUs, at least one
+		gpus = math.Max(1, math.Floor(n/12))
+	}
+	if family == "n1" && class == "highcpu" {
+		perVcpu = 0.9
+	}
+	return family, n, n * perVcpu, gpus, true
+}
+
+// bundledGpu is the accelerator type attached by accelerator-optimized families
+var bundledGpu = map[string]string{
+	"a2": "nvidia-tesla-a100", "a3": "nvidia-h100-80gb", "g2": "nvidia-l4",
+}
+
+// instancePrice returns hourly price of an instance of the module and its description
+func instancePrice(bp config.Blueprint, m config.Module, machineType string) (float64, string, bool) {
+	family, vcpus, memGB, gpus, ok := machineShape(machineType)
+	if !ok {
+		return 0, machineType, false
+	}
+	fp := familyPrices[family]
+	price := vcpus*fp.vcpu + memGB*fp.memGB
+	if gpus > 0 {
+		gpu := bundledGpu[family]
+		if family == "a2" && strings.Contains(machineType, "ultragpu") {
+			gpu = "nvidia-a100-80gb"
+		}
+		price += gpus * gpuPrices[gpu]
+	}
+	desc := machineType
+	if v, ok := setting(bp, m, "guest_accelerator"); ok && v.CanIterateElements() {
+		for it := v.ElementIterator(); it.Next(); {
+			_, ga := it.Element()
+			if ga.IsNull() || !ga.Type().IsObjectType() || !ga.Type().HasAttribute("type") || !ga.Type().HasAttribute("count") {
+				continue
+			}
+			t, c := ga.GetAttr("type"), ga.GetAttr("count")
+			if t.IsNull() || t.Type() != cty.String || c.IsNull() || c.Type() != cty.Number {
+				continue
+			}
+			p, known := gpuPrices[t.AsString()]
+			if !known {
+				return 0, fmt.Sprintf("%s with %s", machineType, t.AsString()), false
+			}
+			n, _ := c.AsBigFloat().Float64()
+			price += n * p
+			desc = fmt.Sprintf("%s with %g x %s", desc, n, t.AsString())
+		}
+	}
+	return price, desc, true
+}
+
+func instanceCounts(bp config.Blueprint, m config.Module) (float64, float64) {
+	for _, cs := range instanceCountSettings {
+		lo, okLo := numberSetting(bp, m, cs.min)
+		hi, okHi := numberSetting(bp, m, cs.max)
+		if !okLo && !okHi {
+			continue
+		}
+		if cs.additive {
+			hi += lo
+		}
+		return lo, math.Max(lo, hi)
+	}
+	return 1, 1
+}
+
+// EstimateCost estimates the range of monthly cost of instances, disks and Filestore
+// instances of the blueprint. The minimum counts static instances, the maximum counts
+// all instances that autoscaling modules may create. Settings that are not known
+// before deployment are not counted.
+func EstimateCost(bp config.Blueprint) Cost {
+	cost := Cost{Items: []CostItem{}}
+	add := func(item CostItem) {
+		cost.Items = append(cost.Items, item)
+		cost.MinMonthly += item.MinMonthly
+		cost.MaxMonthly += item.MaxMonthly
+	}
+	bp.WalkModulesSafe(func(_ config.ModulePath, m *config.Module) {
+		if m.Kind == config.PackerKind {
+			return // build VMs are temporary
+		}
+		if tier, ok := stringSetting(bp, *m, "filestore_tier"); ok {
+			size, _ := numberSetting(bp, *m, "size_gb")
+			if p, known := diskPrices[tier]; known {
+				add(CostItem{Module: m.ID, Resource: fmt.Sprintf("Filestore %s %g GB", tier, size),
+					MinInstances: 1, MaxInstances: 1, MinMonthly: size * p, MaxMonthly: size * p})
+			} else {
+				cost.NotEstimated = append(cost.NotEstimated, fmt.Sprintf("Filestore %s of module %q", tier, m.ID))
+			}
+			return
+		}
+
+		mt, ok := stringSetting(bp, *m, "machine_type")
+		if !ok || mt == "" {
+			return
+		}
+		lo, hi := instanceCounts(bp, *m)
+		price, desc, ok := instancePrice(bp, *m, mt)
+		if !ok {
+			cost.NotEstimated = append(cost.NotEstimated, fmt.Sprintf("%s of module %q", desc, m.ID))
+			return
+		}
+		monthly := price * hoursPerMonth
+		for _, s := range []string{"disk_size_gb", "disk_size"} {
+			size, ok := numberSetting(bp, *m, s)
+			if !ok {
+				continue
+			}
+			dt, _ := stringSetting(bp, *m, "disk_type")
+			if p, known := diskPrices[dt]; known {
+				monthly += size * p
+				desc = fmt.Sprintf("%s, %g GB %s", desc, size, dt)
+			}
+			break
+		}
+		add(CostItem{Module: m.ID, Resource: desc, MinInstances: lo, MaxInstances: hi,
+			MinMonthly: lo * monthly, MaxMonthly: hi * monthly})
+	})
+	return cost
+}
@@ -0,0 +1,114 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catalog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// cell escapes the text for a cell of a Markdown table
+func cell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func code(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "`" + strings.ReplaceAll(s, "`", "'") + "`"
+}
+
+// Markdown renders the documentation as a Markdown page
+func (d Document) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", d.Blueprint)
+
+	b.WriteString("\n## Deployment variables\n\n")
+	if len(d.Variables) == 0 {
+		b.WriteString("The blueprint has no deployment variables.\n")
+	} else {
+		b.WriteString("| Name | Type | Default | Required | Description |\n")
+		b.WriteString("|------|------|---------|:--------:|-------------|\n")
+		for _, v := range d.Variables {
+			req := "no"
+			if v.Required {
+				req = "yes"
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s | %s | %s |\n", code(v.Name), code(cell(v.Type)), code(cell(v.Default)), req, cell(v.Description))
+		}
+	}
+
+	b.WriteString("\n## Required credentials\n\n")
+	if len(d.Credentials.Services) == 0 && len(d.Credentials.Permissions) == 0 {
+		b.WriteString("Modules of the blueprint do not declare required services or permissions.\n")
+	}
+	if len(d.Credentials.Services) > 0 {
+		b.WriteString("Services that must be enabled in the project:\n\n")
+		for _, s := range d.Credentials.Services {
+			fmt.Fprintf(&b, "* %s\n", code(s))
+		}
+	}
+	if len(d.Credentials.Permissions) > 0 {
+		if len(d.Credentials.Services) > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("IAM permissions of the credentials deploying the blueprint:\n\n")
+		for _, p := range d.Credentials.Permissions {
+			fmt.Fprintf(&b, "* %s\n", code(p))
+		}
+	}
+
+	b.WriteString("\n## Outputs\n\n")
+	if len(d.Outputs) == 0 {
+		b.WriteString("The blueprint has no outputs.\n")
+	} else {
+		b.WriteString("| Module | Name | Description |\n")
+		b.WriteString("|--------|------|-------------|\n")
+		for _, o := range d.Outputs {
+			desc := o.Description
+			if o.Sensitive {
+				desc = strings.TrimSpace(desc + " (sensitive)")
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s |\n", code(string(o.Module)), code(o.Name), cell(desc))
+		}
+	}
+
+	b.WriteString("\n## Estimated cost\n\n")
+	c := d.Cost
+	fmt.Fprintf(&b, "Approximately $%.0f to $%.0f per month at on-demand list prices of us-central1. "+
+		"The minimum counts static instances, the maximum all instances autoscaling may create.\n", c.MinMonthly, c.MaxMonthly)
+	if len(c.Items) > 0 {
+		b.WriteString("\n| Module | Resource | Instances | Monthly cost |\n")
+		b.WriteString("|--------|----------|-----------|--------------|\n")
+		for _, i := range c.Items {
+			inst := fmt.Sprintf("%g", i.MinInstances)
+			price := fmt.Sprintf("$%.0f", i.MinMonthly)
+			if i.MaxInstances != i.MinInstances {
+				inst = fmt.Sprintf("%g - %g", i.MinInstances, i.MaxInstances)
+				price = fmt.Sprintf("$%.0f - $%.0f", i.MinMonthly, i.MaxMonthly)
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", code(string(i.Module)), cell(i.Resource), inst, price)
+		}
+	}
+	if len(c.NotEstimated) > 0 {
+		b.WriteString("\nNot included in the estimate:\n\n")
+		for _, n := range c.NotEstimated {
+			fmt.Fprintf(&b, "* %s\n", n)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,133 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cluster inspects cloud resources of deployed clusters
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"hpc-toolkit/pkg/apiclient"
+	"hpc-toolkit/pkg/config"
+	"path"
+	"path/filepath"
+
+	compute "google.golang.org/api/compute/v1"
+	file "google.golang.org/api/file/v1"
+)
+
+// Resource is a cloud resource that belongs to a deployment
+type Resource struct {
+	Kind     string // "instance" or "filestore"
+	Name     string
+	Location string // zone or region
+	Type     string // machine type or filestore tier
+	Labels   map[string]string
+	Status   string // e.g. "RUNNING", instances only
+	// Addresses of the first network interface, instances only
+	InternalIP string
+	ExternalIP string
+}
+
+// deploymentFilter returns a filter expression that matches resources labeled with deployment name
+func deploymentFilter(deploymentName string) string {
+	return fmt.Sprintf("labels.ghpc_deployment = %q", deploymentName)
+}
+
+// ListInstances returns VM instances labeled with the deployment name
+func ListInstances(projectID string, deploymentName string) ([]Resource, error) {
+	ctx := context.Background()
+	s, err := apiclient.New(ctx, compute.NewService)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []Resource{}
+	err = s.Instances.AggregatedList(projectID).Filter(deploymentFilter(deploymentName)).Pages(ctx, func(l *compute.InstanceAggregatedList) error {
+		for _, scoped := range l.Items {
+			for _, i := range scoped.Instances {
+				r := Resource{
+					Kind:     "instance",
+					Name:     i.Name,
+					Location: path.Base(i.Zone),
+					Type:     path.Base(i.MachineType),
+					Labels:   i.Labels,
+					Status:   i.Status,
+				}
+				if len(i.NetworkInterfaces) > 0 {
+					nic := i.NetworkInterfaces[0]
+					r.InternalIP = nic.NetworkIP
+					if len(nic.AccessConfigs) > 0 {
+						r.ExternalIP = nic.AccessConfigs[0].NatIP
+					}
+				}
+				res = append(res, r)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list instances of deployment %q: %w", deploymentName, err)
+	}
+	return res, nil
+}
+
+// ListFilestores returns Filestore instances labeled with the deployment name
+func ListFilestores(projectID string, deploymentName string) ([]Resource, error) {
+	ctx := context.Background()
+	s, err := apiclient.New(ctx, file.NewService)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []Resource{}
+	parent := fmt.Sprintf("projects/%s/locations/-", projectID)
+	err = s.Projects.Locations.Instances.List(parent).Filter(deploymentFilter(deploymentName)).Pages(ctx, func(l *file.ListInstancesResponse) error {
+		for _, i := range l.Instances {
+			// name is projects/{project}/locations/{location}/instances/{instance}
+			res = append(res, Resource{
+				Kind:     "filestore",
+				Name:     path.Base(i.Name),
+				Location: path.Base(path.Dir(path.Dir(i.Name))),
+				Type:     i.Tier,
+				Labels:   i.Labels,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list filestore instances of deployment %q: %w", deploymentName, err)
+	}
+	return res, nil
+}
+
+// ModuleOf returns ID of the blueprint module that most likely created the resource.
+// Modules label resources with `ghpc_module`, which is the last element of the module source.
+// Returns empty ModuleID if no module matches.
+func ModuleOf(bp config.Blueprint, r Resource) config.ModuleID {
+	name, ok := r.Labels["ghpc_module"]
+	if !ok {
+		return ""
+	}
+	found := []config.ModuleID{}
+	bp.WalkModulesSafe(func(_ config.ModulePath, m *config.Module) {
+		if filepath.Base(m.Source) == name {
+			found = append(found, m.ID)
+		}
+	})
+	if len(found) != 1 {
+		return "" // ambiguous or unknown
+	}
+	return found[0]
+}
@@ -0,0 +1,143 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"hpc-toolkit/pkg/config"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+type MySuite struct{}
+
+var _ = Suite(&MySuite{})
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+func (s *MySuite) TestModuleOf(c *C) {
+	bp := config.Blueprint{Groups: []config.Group{{Modules: []config.Module{
+		{ID: "login", Source: "modules/compute/vm-instance"},
+		{ID: "homefs", Source: "community/modules/file-system/filestore"},
+		{ID: "scratch", Source: "community/modules/file-system/filestore"},
+	}}}}
+	res := func(l map[string]string) Resource { return Resource{Labels: l} }
+
+	c.Check(ModuleOf(bp, res(map[string]string{"ghpc_module": "vm-instance"})), Equals, config.ModuleID("login"))
+	c.Check(ModuleOf(bp, res(map[string]string{"ghpc_module": "filestore"})), Equals, config.ModuleID("")) // ambiguous
+	c.Check(ModuleOf(bp, res(map[string]string{"ghpc_module": "vpc"})), Equals, config.ModuleID(""))
+	c.Check(ModuleOf(bp, res(nil)), Equals, config.ModuleID(""))
+}
+
+func (s *MySuite) TestFindIdle(c *C) {
+	// labels set by modules of the toolkit
+	inst := func(name string, module string, role string) Resource {
+		return Resource{Kind: "instance", Name: name, Labels: map[string]string{"ghpc_module": module, "ghpc_role": role}}
+	}
+	resources := []Resource{
+		inst("login-0", "schedmd-slurm-gcp-v6-login", "scheduler"),
+		inst("login-1", "schedmd-slurm-gcp-v6-login", "scheduler"),
+		inst("batch-login", "batch-login-node", "scheduler"),
+		inst("node-0", "schedmd-slurm-gcp-v6-nodeset", "compute"),
+		inst("ctrl", "schedmd-slurm-gcp-v6-controller", "scheduler"),
+		inst("node-unknown", "schedmd-slurm-gcp-v6-nodeset", "compute"),
+		{Kind: "filestore", Name: "homefs"},
+		{Kind: "filestore", Name: "scratch"},
+	}
+	usage := map[string]float64{
+		"login-0":     0.01,
+		"login-1":     0.5,
+		"batch-login": 0.02,
+		"node-0":      0.001,
+		"ctrl":        0.0, // schedulers are never reported
+		"homefs":      0.2,
+		"scratch":     42,
+	}
+
+	got := []string{}
+	for _, f := range findIdle(resources, usage, DefaultIdleCriteria) {
+		got = append(got, f.Resource.Name)
+	}
+	c.Check(got, DeepEquals, []string{"batch-login", "homefs", "login-0", "node-0"})
+}
+
+func (s *MySuite) TestInventory(c *C) {
+	bp := config.Blueprint{Groups: []config.Group{{Modules: []config.Module{
+		{ID: "slurm-controller", Source: "community/modules/scheduler/schedmd-slurm-gcp-v6-controller"},
+		{ID: "nodeset", Source: "community/modules/compute/schedmd-slurm-gcp-v6-nodeset"},
+	}}}}
+	inst := func(name string, module string, role string, status string) Resource {
+		return Resource{Kind: "instance", Name: name, Location: "us-central1-a", Type: "n2-standard-2", Status: status,
+			InternalIP: "10.0.0." + name[len(name)-1:], Labels: map[string]string{"ghpc_module": module, "ghpc_role": role}}
+	}
+	ctrl := inst("ctrl-1", "schedmd-slurm-gcp-v6-controller", "scheduler", "RUNNING")
+	ctrl.ExternalIP = "34.1.1.1"
+	inv := NewInventory(bp, []Resource{
+		ctrl,
+		inst("login-2", "schedmd-slurm-gcp-v6-login", "scheduler", "RUNNING"),
+		inst("node-4", "schedmd-slurm-gcp-v6-nodeset", "compute", "RUNNING"),
+		inst("node-3", "schedmd-slurm-gcp-v6-nodeset", "compute", "RUNNING"),
+		inst("node-5", "schedmd-slurm-gcp-v6-nodeset", "compute", "STOPPING"), // scaled down
+		inst("nfs-6", "nfs-server", "file-system", "RUNNING"),
+		{Kind: "filestore", Name: "homefs"},
+	})
+
+	c.Check(inv.Groups, DeepEquals, map[string][]string{
+		"controller":              {"ctrl-1"},
+		"login":                   {"login-2"},
+		"compute":                 {"node-3", "node-4"},
+		"storage":                 {"nfs-6"},
+		"module_slurm_controller": {"ctrl-1"},
+		"module_nodeset":          {"node-3", "node-4"},
+	})
+
+	{ // INI
+		var b bytes.Buffer
+		c.Assert(NewInventory(bp, []Resource{ctrl}).WriteIni(&b), IsNil)
+		c.Check(b.String(), Equals, ""+
+			"[controller]\n"+
+			"ctrl-1 ansible_host=10.0.0.1 gcp_external_ip=34.1.1.1 gcp_machine_type=n2-standard-2 gcp_zone=us-central1-a ghpc_module_id=slurm-controller\n"+
+			"\n"+
+			"[module_slurm_controller]\n"+
+			"ctrl-1 ansible_host=10.0.0.1 gcp_external_ip=34.1.1.1 gcp_machine_type=n2-standard-2 gcp_zone=us-central1-a ghpc_module_id=slurm-controller\n")
+	}
+
+	{ // JSON
+		var b bytes.Buffer
+		c.Assert(inv.WriteJSON(&b), IsNil)
+		var got map[string]interface{}
+		c.Assert(json.Unmarshal(b.Bytes(), &got), IsNil)
+		c.Check(got["compute"], DeepEquals, map[string]interface{}{"hosts": []interface{}{"node-3", "node-4"}})
+		c.Check(got["_meta"].(map[string]interface{})["hostvars"].(map[string]interface{})["nfs-6"].(map[string]interface{})["ansible_host"],
+			Equals, "10.0.0.6")
+	}
+
+	{ // SSH config
+		var b bytes.Buffer
+		c.Assert(NewInventory(bp, []Resource{ctrl, inst("node-3", "", "compute", "RUNNING")}).WriteSSHConfig(&b, "p"), IsNil)
+		c.Check(b.String(), Equals, ""+
+			"Host ctrl-1\n"+
+			"  HostName 34.1.1.1\n"+
+			"\n"+
+			"Host node-3\n"+
+			"  HostName node-3\n"+
+			"  ProxyCommand gcloud compute start-iap-tunnel %h %p --listen-on-stdin --project p --zone us-central1-a\n"+
+			"\n")
+	}
+}
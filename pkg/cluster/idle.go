@@ -0,0 +1,151 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"hpc-toolkit/pkg/apiclient"
+	"hpc-toolkit/pkg/config"
+	"sort"
+	"time"
+
+	monitoring "google.golang.org/api/monitoring/v3"
+)
+
+const (
+	cpuUtilizationMetric = "compute.googleapis.com/instance/cpu/utilization"
+	filestoreUsageMetric = "file.googleapis.com/nfs/server/used_bytes_percent"
+)
+
+// IdleCriteria defines when a resource is considered idle
+type IdleCriteria struct {
+	Window time.Duration
+	// CPUThreshold is a mean CPU utilization (0..1) of an instance below which it is idle
+	CPUThreshold float64
+	// FilestoreThreshold is a percent of used capacity (0..100) of a share below which it is empty
+	FilestoreThreshold float64
+}
+
+// DefaultIdleCriteria is used unless overridden by user
+var DefaultIdleCriteria = IdleCriteria{
+	Window:             7 * 24 * time.Hour,
+	CPUThreshold:       0.05,
+	FilestoreThreshold: 1,
+}
+
+// Finding is an idle resource
+type Finding struct {
+	Module   config.ModuleID // empty if resource can not be attributed to a blueprint module
+	Resource Resource
+	Reason   string
+}
+
+// loginModules are modules creating login nodes, identified by the `ghpc_module`
+// label, as they label nodes with `ghpc_role` of the scheduler
+var loginModules = map[string]bool{
+	"schedmd-slurm-gcp-v5-login": true,
+	"schedmd-slurm-gcp-v6-login": true,
+	"batch-login-node":           true,
+}
+
+// findIdle classifies resources given their mean usage over the window.
+// Resources without usage data are not reported.
+func findIdle(resources []Resource, usage map[string]float64, c IdleCriteria) []Finding {
+	res := []Finding{}
+	for _, r := range resources {
+		u, ok := usage[r.Name]
+		if !ok {
+			continue
+		}
+		switch {
+		case r.Kind == "instance" && loginModules[r.Labels["ghpc_module"]] && u < c.CPUThreshold:
+			res = append(res, Finding{Resource: r,
+				Reason: fmt.Sprintf("login node mean CPU utilization is %.1f%% over last %s", u*100, c.Window)})
+		case r.Kind == "instance" && r.Labels["ghpc_role"] == "compute" && u < c.CPUThreshold:
+			res = append(res, Finding{Resource: r,
+				Reason: fmt.Sprintf("static compute node mean CPU utilization is %.1f%% over last %s", u*100, c.Window)})
+		case r.Kind == "filestore" && u < c.FilestoreThreshold:
+			res = append(res, Finding{Resource: r,
+				Reason: fmt.Sprintf("filestore share uses %.1f%% of its capacity", u)})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Resource.Name < res[j].Resource.Name })
+	return res
+}
+
+// meanUsage queries Cloud Monitoring for mean value of the metric over the window,
+// keyed by value of the given label of time series.
+func meanUsage(s *monitoring.Service, projectID string, metric string, label string, window time.Duration) (map[string]float64, error) {
+	end := time.Now()
+	start := end.Add(-window)
+	res := map[string]float64{}
+	err := s.Projects.TimeSeries.List("projects/"+projectID).
+		Filter(fmt.Sprintf("metric.type = %q", metric)).
+		IntervalStartTime(start.Format(time.RFC3339)).
+		IntervalEndTime(end.Format(time.RFC3339)).
+		AggregationAlignmentPeriod(fmt.Sprintf("%ds", int64(window.Seconds()))).
+		AggregationPerSeriesAligner("ALIGN_MEAN").
+		Pages(context.Background(), func(l *monitoring.ListTimeSeriesResponse) error {
+			for _, ts := range l.TimeSeries {
+				name := ts.Metric.Labels[label]
+				if name == "" && ts.Resource != nil {
+					name = ts.Resource.Labels[label]
+				}
+				if name == "" || len(ts.Points) == 0 || ts.Points[0].Value.DoubleValue == nil {
+					continue
+				}
+				res[name] = *ts.Points[0].Value.DoubleValue
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query metric %s: %w", metric, err)
+	}
+	return res, nil
+}
+
+// IdleReport inspects resources of the deployment for idleness
+// and attributes them to modules of the blueprint
+func IdleReport(bp config.Blueprint, projectID string, c IdleCriteria) ([]Finding, error) {
+	deploymentName := bp.DeploymentName()
+	instances, err := ListInstances(projectID, deploymentName)
+	if err != nil {
+		return nil, err
+	}
+	filestores, err := ListFilestores(projectID, deploymentName)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := apiclient.New(context.Background(), monitoring.NewService)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := meanUsage(s, projectID, cpuUtilizationMetric, "instance_name", c.Window)
+	if err != nil {
+		return nil, err
+	}
+	fsUsage, err := meanUsage(s, projectID, filestoreUsageMetric, "instance_name", c.Window)
+	if err != nil {
+		return nil, err
+	}
+
+	findings := append(findIdle(instances, usage, c), findIdle(filestores, fsUsage, c)...)
+	for i := range findings {
+		findings[i].Module = ModuleOf(bp, findings[i].Resource)
+	}
+	return findings, nil
+}
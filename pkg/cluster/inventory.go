@@ -0,0 +1,171 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/exp/maps"
+)
+
+// Roles are inventory groups hosts are classified into
+const (
+	ControllerRole = "controller"
+	LoginRole      = "login"
+	ComputeRole    = "compute"
+	StorageRole    = "storage"
+	OtherRole      = "other"
+)
+
+var notGroupNameRe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// Inventory lists running instances of a deployment grouped by role and by blueprint module
+type Inventory struct {
+	// Groups maps group name to sorted names of its hosts
+	Groups map[string][]string
+	// HostVars maps host name to its variables, such as `ansible_host`
+	HostVars map[string]map[string]string
+}
+
+// hostRole classifies instance by `ghpc_module` and `ghpc_role` labels
+func hostRole(r Resource) string {
+	mod, role := r.Labels["ghpc_module"], r.Labels["ghpc_role"]
+	switch {
+	case strings.Contains(mod, "controller"):
+		return ControllerRole
+	case strings.Contains(mod, "login") || role == "login":
+		return LoginRole
+	case role == "compute":
+		return ComputeRole
+	case role == "file-system":
+		return StorageRole
+	}
+	return OtherRole
+}
+
+// moduleGroup returns name of inventory group of hosts created by the module,
+// it is prefixed to avoid collisions with role groups
+func moduleGroup(id config.ModuleID) string {
+	return "module_" + notGroupNameRe.ReplaceAllString(string(id), "_")
+}
+
+// NewInventory builds an inventory of running instances of the deployment.
+// Instances that are being created or deleted by autoscaling are left out.
+func NewInventory(bp config.Blueprint, resources []Resource) Inventory {
+	inv := Inventory{Groups: map[string][]string{}, HostVars: map[string]map[string]string{}}
+	for _, r := range resources {
+		if r.Kind != "instance" || r.Status != "RUNNING" {
+			continue
+		}
+		vars := map[string]string{
+			"ansible_host":     r.InternalIP,
+			"gcp_zone":         r.Location,
+			"gcp_machine_type": r.Type,
+		}
+		if r.ExternalIP != "" {
+			vars["gcp_external_ip"] = r.ExternalIP
+		}
+		role := hostRole(r)
+		inv.Groups[role] = append(inv.Groups[role], r.Name)
+		if m := ModuleOf(bp, r); m != "" {
+			vars["ghpc_module_id"] = string(m)
+			g := moduleGroup(m)
+			inv.Groups[g] = append(inv.Groups[g], r.Name)
+		}
+		inv.HostVars[r.Name] = vars
+	}
+	for _, hosts := range inv.Groups {
+		sort.Strings(hosts)
+	}
+	return inv
+}
+
+func (inv Inventory) groupNames() []string {
+	names := maps.Keys(inv.Groups)
+	sort.Strings(names)
+	return names
+}
+
+// WriteIni writes the inventory in Ansible INI format
+func (inv Inventory) WriteIni(w io.Writer) error {
+	for i, g := range inv.groupNames() {
+		if i > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "[%s]\n", g); err != nil {
+			return err
+		}
+		for _, h := range inv.Groups[g] {
+			vars := inv.HostVars[h]
+			keys := maps.Keys(vars)
+			sort.Strings(keys)
+			line := h
+			for _, k := range keys {
+				line += fmt.Sprintf(" %s=%s", k, vars[k])
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the inventory in the format of Ansible dynamic inventory scripts,
+// see https://docs.ansible.com/ansible/latest/dev_guide/developing_inventory.html
+func (inv Inventory) WriteJSON(w io.Writer) error {
+	type group struct {
+		Hosts []string `json:"hosts"`
+	}
+	doc := map[string]interface{}{
+		"_meta": map[string]interface{}{"hostvars": inv.HostVars},
+	}
+	for g, hosts := range inv.Groups {
+		doc[g] = group{Hosts: hosts}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// WriteSSHConfig writes an OpenSSH client configuration with a `Host` entry per instance.
+// Instances without external IP are reached through IAP TCP forwarding.
+func (inv Inventory) WriteSSHConfig(w io.Writer, projectID string) error {
+	hosts := maps.Keys(inv.HostVars)
+	sort.Strings(hosts)
+	for _, h := range hosts {
+		vars := inv.HostVars[h]
+		entry := fmt.Sprintf("Host %s\n", h)
+		if ip := vars["gcp_external_ip"]; ip != "" {
+			entry += fmt.Sprintf("  HostName %s\n", ip)
+		} else {
+			entry += fmt.Sprintf("  HostName %s\n", h)
+			entry += fmt.Sprintf("  ProxyCommand gcloud compute start-iap-tunnel %%h %%p --listen-on-stdin --project %s --zone %s\n",
+				projectID, vars["gcp_zone"])
+		}
+		if _, err := fmt.Fprintln(w, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
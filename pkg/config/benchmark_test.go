@@ -0,0 +1,114 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"hpc-toolkit/pkg/modulereader"
+
+	"github.com/zclconf/go-cty/cty"
+	. "gopkg.in/check.v1"
+)
+
+// Benchmarks of hot paths of parsing and expansion of large blueprints, run with
+// go test ./pkg/config -run NONE -bench .
+
+const benchModules = 500
+
+// largeBlueprint returns a blueprint with n modules using a shared network module
+func largeBlueprint(n int) Blueprint {
+	net := tMod("network").outputs("network_self_link").build()
+	mods := []Module{net}
+	for i := 0; i < n; i++ {
+		mods = append(mods, tMod(ModuleID(fmt.Sprintf("fs%d", i))).
+			inputs("network_self_link", "name", "deployment_name",
+				modulereader.VarInfo{Name: "labels", Type: cty.Map(cty.String)}).
+			uses("network").
+			set("name", fmt.Sprintf("fs%d", i)).
+			set("labels", MustParseExpression(`{a = var.deployment_name}`)).
+			build())
+	}
+	return Blueprint{
+		BlueprintName: "large",
+		Vars:          NewDict(map[string]cty.Value{"deployment_name": cty.StringVal("large")}),
+		Groups:        []Group{{Name: "primary", Modules: mods}},
+	}
+}
+
+func (s *zeroSuite) TestLargeBlueprintWork(c *C) {
+	expandAllocs := func(n int) float64 {
+		bp := largeBlueprint(n)
+		return testing.AllocsPerRun(1, func() {
+			e := bp.Clone()
+			c.Assert(e.Expand(), IsNil)
+		})
+	}
+
+	{ // lookup of a module does not allocate per visited module
+		bp := largeBlueprint(benchModules)
+		id := ModuleID(fmt.Sprintf("fs%d", benchModules-1))
+		c.Check(testing.AllocsPerRun(10, func() { bp.Module(id) }), Equals, 0.0)
+	}
+
+	{ // expansion work grows linearly with the number of modules,
+		// quadratic growth would be 16x
+		small, large := expandAllocs(100), expandAllocs(400)
+		c.Check(large < 5*small, Equals, true, Commentf("allocations: %v for 100 modules, %v for 400 modules", small, large))
+		c.Check(large/400 < 2000, Equals, true, Commentf("allocations per module: %v", large/400))
+	}
+}
+
+func BenchmarkExpand(b *testing.B) {
+	bp := largeBlueprint(benchModules)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c := bp.Clone()
+		if err := c.Expand(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkNewBlueprint(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "large.yaml")
+	if err := largeBlueprint(benchModules).Export(path); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := NewBlueprint(path); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkModulePath(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		_ = Root.Groups.At(i % 10).Modules.At(i % benchModules).Settings.Dot("name")
+	}
+}
+
+func BenchmarkModule(b *testing.B) {
+	bp := largeBlueprint(benchModules)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := bp.Module(ModuleID(fmt.Sprintf("fs%d", i%benchModules))); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"github.com/pkg/errors"
+)
+
+// ErrorCode is a stable identifier of a class of errors.
+// Codes must never be renumbered or reused, see docs/error-codes.md
+type ErrorCode string
+
+// Codes of blueprint errors
+const (
+	CodeMalformedYaml          ErrorCode = "GHPC1001"
+	CodeUnsupportedVersion     ErrorCode = "GHPC1002"
+	CodeInvalidValue           ErrorCode = "GHPC1003"
+	CodeInvalidGroup           ErrorCode = "GHPC1004"
+	CodeInvalidModuleID        ErrorCode = "GHPC1005"
+	CodeInvalidModuleSource    ErrorCode = "GHPC1006"
+	CodeUnknownSetting         ErrorCode = "GHPC1007"
+	CodeMissingSetting         ErrorCode = "GHPC1008"
+	CodeUnsuitableSetting      ErrorCode = "GHPC1009"
+	CodeUnknownVariable        ErrorCode = "GHPC1010"
+	CodeUnknownModule          ErrorCode = "GHPC1011"
+	CodeUnknownOutput          ErrorCode = "GHPC1012"
+	CodeInvalidGroupOrder      ErrorCode = "GHPC1013"
+	CodeMalformedExpression    ErrorCode = "GHPC1014"
+	CodeModuleNotUsed          ErrorCode = "GHPC1015"
+	CodeInvalidLabels          ErrorCode = "GHPC1016"
+	CodeVariableNotSet         ErrorCode = "GHPC1017"
+	CodeInvalidVariableRef     ErrorCode = "GHPC1018"
+	CodeInvalidBackend         ErrorCode = "GHPC1019"
+	CodeInvalidModuleValidator ErrorCode = "GHPC1020"
+	CodeUnjustifiedSkip        ErrorCode = "GHPC1021"
+	CodeInvalidEncryption      ErrorCode = "GHPC1022"
+	CodeInvalidProtection      ErrorCode = "GHPC1023"
+	CodeServiceAccountKey      ErrorCode = "GHPC1024"
+	CodeInvalidExternal        ErrorCode = "GHPC1025"
+	CodeInvalidLoginPool       ErrorCode = "GHPC1026"
+	CodeInvalidValidatorModule ErrorCode = "GHPC1027"
+)
+
+// ErrorCodeInfo documents a class of errors
+type ErrorCodeInfo struct {
+	Code        ErrorCode
+	Title       string
+	Explanation string
+}
+
+// CodedError is an error wrapper to augment stable ErrorCode.
+// It does not change the error message, codes are added when errors are rendered.
+type CodedError struct {
+	Code ErrorCode
+	Err  error
+}
+
+func (e CodedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e CodedError) Unwrap() error {
+	return e.Err
+}
+
+var sentinelCodes = []struct {
+	err  error
+	code ErrorCode
+}{
+	{EmptyModuleID, CodeInvalidModuleID},
+	{EmptyModuleSource, CodeInvalidModuleSource},
+	{InvalidModuleKind, CodeInvalidModuleSource},
+	{UnknownModuleSetting, CodeUnknownSetting},
+	{ModuleSettingWithPeriod, CodeUnknownSetting},
+	{ModuleSettingInvalidChar, CodeUnknownSetting},
+	{EmptyGroupName, CodeInvalidGroup},
+}
+
+// ErrorCodeOf returns the code of the innermost coded error, or an empty string
+// if the class of the error is not known.
+func ErrorCodeOf(err error) ErrorCode {
+	var ce CodedError
+	if errors.As(err, &ce) {
+		return ce.Code
+	}
+	for _, s := range sentinelCodes {
+		if errors.Is(err, s.err) {
+			return s.code
+		}
+	}
+	var ive InputValueError
+	if errors.As(err, &ive) {
+		return CodeInvalidValue
+	}
+	var ume UnknownModuleError
+	if errors.As(err, &ume) {
+		return CodeUnknownModule
+	}
+	return ""
+}
+
+// ErrorCodes returns documentation of codes of blueprint errors
+func ErrorCodes() []ErrorCodeInfo {
+	return []ErrorCodeInfo{
+		{CodeMalformedYaml, "Malformed blueprint",
+			"The blueprint is not a valid YAML document, uses a field that is not supported " +
+				"or a value of a wrong type. Check the blueprint against the schema in examples/README.md."},
+		{CodeUnsupportedVersion, "Unsupported toolkit version",
+			"The `ghpc_version` constraint of the blueprint is malformed or is not satisfied by " +
+				"the version of `ghpc`. Upgrade the toolkit or relax the constraint."},
+		{CodeInvalidValue, "Invalid value",
+			"A value, such as `blueprint_name` or `deployment_name`, does not satisfy requirements. " +
+				"Names are used as label values, so must be at most 63 characters long and " +
+				"can only contain lowercase letters, numeric characters, underscores and dashes."},
+		{CodeInvalidGroup, "Invalid deployment group",
+			"A deployment group has no name, an invalid or duplicate name, or no modules."},
+		{CodeInvalidModuleID, "Invalid module ID",
+			"A module has no ID, an ID that is used by another module, or the reserved ID `vars`."},
+		{CodeInvalidModuleSource, "Invalid module source or kind",
+			"The module `source` is empty, can not be read, or the `kind` is not one of " +
+				"`terraform`, `packer`, `ansible`, `helm` or `script`."},
+		{CodeUnknownSetting, "Unknown module setting",
+			"A setting is not an input variable of the module, or its name is malformed. " +
+				"Settings must match module inputs, check the module documentation for spelling."},
+		{CodeMissingSetting, "Missing required setting",
+			"A module input without a default value is not set, either explicitly, by a " +
+				"deployment variable of the same name or by a module in `use`."},
+		{CodeUnsuitableSetting, "Unsuitable setting value",
+			"The value of a setting can not be converted to the type of the module input."},
+		{CodeUnknownVariable, "Unknown deployment variable",
+			"A deployment variable is referenced, e.g. `$(vars.NAME)`, but is not defined in `vars`."},
+		{CodeUnknownModule, "Unknown module",
+			"A module that does not exist is referenced, either in `use` or in an expression, " +
+				"e.g. `$(ID.OUTPUT)`."},
+		{CodeUnknownOutput, "Unknown module output",
+			"An output that the module does not have is referenced or requested in `outputs`."},
+		{CodeInvalidGroupOrder, "Invalid reference between groups",
+			"A module refers to a module of a later deployment group, refers to a packer or ansible module, " +
+				"or a group mixing such modules with terraform modules can not be split. " +
+				"Modules can only use outputs of modules of the same or earlier groups."},
+		{CodeMalformedExpression, "Malformed expression",
+			"An expression can not be parsed or refers to something other than deployment " +
+				"variables and module outputs, or uses an unsupported function."},
+		{CodeModuleNotUsed, "Module is not used",
+			"A module that has to be used by other modules (`has_to_be_used` in metadata) " +
+				"is not used by any module."},
+		{CodeInvalidLabels, "Invalid labels",
+			"`vars.labels` is not a map of strings, has an invalid or too many labels, " +
+				"or `label_policy` is not satisfied."},
+		{CodeVariableNotSet, "Deployment variable is not set",
+			"A deployment variable has a null value. Set it in the blueprint, " +
+				"a deployment file or with the `--vars` flag."},
+		{CodeInvalidVariableRef, "Invalid reference between deployment variables",
+			"A deployment variable refers to something other than deployment variables, " +
+				"or deployment variables refer to each other in a cycle."},
+		{CodeInvalidBackend, "Invalid Terraform backend",
+			"The Terraform backend configuration is invalid, e.g. its type is an expression."},
+		{CodeInvalidModuleValidator, "Invalid validator declared by module",
+			"The module metadata declares a validator whose inputs can not be decoded, or an unknown " +
+				"requirement. " +
+				"Report the issue to the module authors."},
+		{CodeUnjustifiedSkip, "Validators skipped without justification",
+			"A module lists validators in `skip_validators`, but does not explain why in " +
+				"`skip_justification`. The justification is recorded in the expanded blueprint " +
+				"of the deployment for auditing."},
+		{CodeInvalidEncryption, "Invalid tfvars encryption",
+			"`tfvars_encryption.kms_key` is not a Cloud KMS key name, or `tfvars_encryption.keys` " +
+				"lists a variable that is not a deployment variable."},
+		{CodeInvalidProtection, "Invalid destroy protection",
+			"`destroy_protection` is set for a module that is not deployed by Terraform, " +
+				"e.g. a Packer or Ansible module."},
+		{CodeServiceAccountKey, "Service account key is forbidden",
+			"`credentials_policy.forbid_service_account_keys` is set, but a module setting or deployment " +
+				"variable passes a service account key, or `impersonate_service_account` is not a service " +
+				"account email. Use impersonation or Workload Identity Federation instead of keys."},
+		{CodeInvalidExternal, "Invalid external resource",
+			"An entry of `external_resources` has no or a duplicate ID, an unknown type, misses a required " +
+				"setting or sets an unknown one, or its ID is already used by a module or deployment variable."},
+		{CodeInvalidLoginPool, "Invalid login pool",
+			"`login_pool` has a count below 1, refers to a deployment group that does not exist, sets settings " +
+				"that are derived from the pool, or its ID or the ID of its load balancer is already used by a module."},
+		{CodeInvalidValidatorModule, "Invalid module of a validator",
+			"A validator in the blueprint sets `module` to a module that does not exist, or that neither " +
+				"declares nor requires the validator. `module` is set by the Toolkit for validators derived " +
+				"from module metadata, remove it from validators added by hand."},
+	}
+}
@@ -40,6 +40,7 @@ const (
 	expectedModFormat        string = "$(module_id) or $(group_id.module_id)"
 	unexpectedConnectionKind string = "connectionKind must be useConnection or deploymentConnection"
 	maxHintDist              int    = 3 // Maximum Levenshtein distance where we suggest a hint
+	maxHintWords             int    = 3 // Maximum number of words suggested in a hint
 )
 
 // map[moved module path]replacing module path
@@ -50,6 +51,8 @@ var movedModules = map[string]string{
 	"community/modules/scripts/spack-install":            "community/modules/scripts/spack-setup",
 }
 
+var groupNameRe = regexp.MustCompile(`^\w(-*\w)*$`)
+
 // GroupName is the name of a deployment group
 type GroupName string
 
@@ -59,9 +62,9 @@ func (n GroupName) Validate() error {
 		return EmptyGroupName
 	}
 
-	if !regexp.MustCompile(`^\w(-*\w)*$`).MatchString(string(n)) {
-		return fmt.Errorf("invalid character(s) found in group name %q.\n"+
-			"Allowed : alphanumeric, '_', and '-'; can not start/end with '-'", n)
+	if !groupNameRe.MatchString(string(n)) {
+		return CodedError{CodeInvalidGroup, fmt.Errorf("invalid character(s) found in group name %q.\n"+
+			"Allowed : alphanumeric, '_', and '-'; can not start/end with '-'", n)}
 	}
 	return nil
 }
@@ -85,15 +88,16 @@ func (g *Group) Clone() Group {
 	return c
 }
 
-// Kind returns the kind of all the modules in the group.
+// Kind returns the kind of all the modules in the group, helm and script
+// modules are deployed by Terraform and count as terraform modules.
 // If the group contains modules of different kinds, it returns UnknownKind
 func (g Group) Kind() ModuleKind {
 	if len(g.Modules) == 0 {
 		return UnknownKind
 	}
-	k := g.Modules[0].Kind
+	k := g.Modules[0].Kind.deployedAs()
 	for _, m := range g.Modules {
-		if m.Kind != k {
+		if m.Kind.deployedAs() != k {
 			return UnknownKind
 		}
 	}
@@ -102,31 +106,65 @@ func (g Group) Kind() ModuleKind {
 
 // Module return the module with the given ID
 func (bp *Blueprint) Module(id ModuleID) (*Module, error) {
-	var mod *Module
-	bp.WalkModulesSafe(func(_ ModulePath, m *Module) {
-		if m.ID == id {
-			mod = m
+	// don't use WalkModules, construction of paths is costly for large blueprints
+	for ig := range bp.Groups {
+		for im := range bp.Groups[ig].Modules {
+			if m := &bp.Groups[ig].Modules[im]; m.ID == id {
+				return m, nil
+			}
 		}
-	})
-	if mod == nil {
-		return nil, UnknownModuleError{id}
 	}
-	return mod, nil
+	return nil, UnknownModuleError{id}
 }
 
 func hintSpelling(s string, dict []string, err error) error {
-	best, minDist := "", maxHintDist+1
+	if best := closestWords(s, dict, 1); len(best) > 0 {
+		return HintError{fmt.Sprintf("did you mean %q?", best[0]), err}
+	}
+	return err
+}
+
+// hintSpellingMany is similar to hintSpelling but suggests up to maxHintWords closest words
+func hintSpellingMany(s string, dict []string, err error) error {
+	best := closestWords(s, dict, maxHintWords)
+	switch len(best) {
+	case 0:
+		return err
+	case 1:
+		return HintError{fmt.Sprintf("did you mean %q?", best[0]), err}
+	default:
+		q := make([]string, len(best))
+		for i, w := range best {
+			q[i] = fmt.Sprintf("%q", w)
+		}
+		return HintError{fmt.Sprintf("did you mean one of %s?", strings.Join(q, ", ")), err}
+	}
+}
+
+// closestWords returns up to n words from dict within maxHintDist from s,
+// ordered by distance and then alphabetically
+func closestWords(s string, dict []string, n int) []string {
+	type cand struct {
+		w string
+		d int
+	}
+	cands := []cand{}
 	for _, w := range dict {
-		d := levenshtein.Distance(s, w, nil)
-		if d < minDist {
-			best, minDist = w, d
+		if d := levenshtein.Distance(s, w, nil); d <= maxHintDist {
+			cands = append(cands, cand{w, d})
 		}
 	}
-	if minDist <= maxHintDist {
-		return HintError{fmt.Sprintf("did you mean %q?", best), err}
+	sort.Slice(cands, func(i, j int) bool {
+		if cands[i].d != cands[j].d {
+			return cands[i].d < cands[j].d
+		}
+		return cands[i].w < cands[j].w
+	})
+	res := []string{}
+	for i := 0; i < len(cands) && i < n; i++ {
+		res = append(res, cands[i].w)
 	}
-	return err
-
+	return res
 }
 
 // ModuleGroup returns the group containing the module
@@ -176,7 +214,7 @@ type TerraformBackend struct {
 	Configuration Dict
 }
 
-// ModuleKind abstracts Toolkit module kinds (presently: packer/terraform)
+// ModuleKind abstracts Toolkit module kinds (presently: packer/terraform/ansible/helm/script)
 type ModuleKind struct {
 	kind string
 }
@@ -190,10 +228,37 @@ var TerraformKind = ModuleKind{kind: "terraform"}
 // PackerKind is the kind for Packer modules (should be treated as const)
 var PackerKind = ModuleKind{kind: "packer"}
 
+// AnsibleKind is the kind for Ansible playbook modules (should be treated as const)
+var AnsibleKind = ModuleKind{kind: "ansible"}
+
+// HelmKind is the kind for Helm chart modules (should be treated as const)
+var HelmKind = ModuleKind{kind: "helm"}
+
+// ScriptKind is the kind for script modules (should be treated as const)
+var ScriptKind = ModuleKind{kind: "script"}
+
 // IsValidModuleKind ensures that the user has specified a supported kind
 func IsValidModuleKind(kind string) bool {
 	return kind == TerraformKind.String() || kind == PackerKind.String() ||
-		kind == UnknownKind.String()
+		kind == AnsibleKind.String() || kind == HelmKind.String() ||
+		kind == ScriptKind.String() || kind == UnknownKind.String()
+}
+
+// deployedAs returns the kind of the tool that deploys modules of the kind
+func (mk ModuleKind) deployedAs() ModuleKind {
+	switch mk {
+	case HelmKind: // charts are released by Terraform helm provider
+		return TerraformKind
+	case ScriptKind: // runners are rendered by generated Terraform module
+		return TerraformKind
+	}
+	return mk
+}
+
+// IsStandalone tests whether modules of the kind are executed on their own,
+// such modules require a dedicated deployment group and can not be used by other modules.
+func (mk ModuleKind) IsStandalone() bool {
+	return mk == PackerKind || mk == AnsibleKind
 }
 
 func (mk ModuleKind) String() string {
@@ -208,11 +273,78 @@ const (
 	ValidationIgnore
 )
 
+// ParseValidationLevel returns the validation level named "ERROR", "WARNING" or "IGNORE"
+func ParseValidationLevel(s string) (int, error) {
+	switch s {
+	case "ERROR":
+		return ValidationError, nil
+	case "WARNING":
+		return ValidationWarning, nil
+	case "IGNORE":
+		return ValidationIgnore, nil
+	default:
+		return 0, fmt.Errorf("invalid validation level %q (\"ERROR\", \"WARNING\", \"IGNORE\")", s)
+	}
+}
+
 // Validator defines a validation step to be run on a blueprint
 type Validator struct {
 	Validator string
 	Inputs    Dict `yaml:"inputs,omitempty"`
 	Skip      bool `yaml:"skip,omitempty"`
+	// Command is the executable and arguments of a custom validator, empty for built-in validators
+	Command []string `yaml:"command,omitempty"`
+	// Severity overrides the validation level of the blueprint for this validator
+	Severity string `yaml:"severity,omitempty"`
+	// Timeout limits run time of the validator, a duration such as "30s"
+	Timeout string `yaml:"timeout,omitempty"`
+	// Retries is the number of times the validator is run again after timing out
+	// or failing with a transient API error
+	Retries int `yaml:"retries,omitempty"`
+	// Module is set for validators declared by or derived from the module metadata,
+	// it is kept in the expanded blueprint so that such validators keep their origin
+	Module ModuleID `yaml:"module,omitempty"`
+}
+
+// LabelPolicy controls how deployment labels are propagated to modules
+type LabelPolicy struct {
+	// modules that will not receive deployment labels
+	ExcludeModules ModuleIDs `yaml:"exclude_modules,omitempty"`
+	// label keys that will not be propagated to modules
+	ExcludeKeys []string `yaml:"exclude_keys,omitempty"`
+	// label keys that every labeled module must have
+	RequiredKeys []string `yaml:"required_keys,omitempty"`
+}
+
+// ExcludesModule returns true if module should not receive deployment labels
+func (lp LabelPolicy) ExcludesModule(id ModuleID) bool {
+	return slices.Contains(lp.ExcludeModules, id)
+}
+
+// TfvarsEncryption controls encryption of variables written to terraform.tfvars
+type TfvarsEncryption struct {
+	// Cloud KMS key encrypting variables, projects/*/locations/*/keyRings/*/cryptoKeys/*
+	KmsKey string `yaml:"kms_key,omitempty"`
+	// deployment variables to encrypt, all variables are encrypted if empty
+	Keys []string `yaml:"keys,omitempty"`
+}
+
+// Enabled returns true if variables should be encrypted
+func (e TfvarsEncryption) Enabled() bool {
+	return e.KmsKey != ""
+}
+
+// Encrypts returns true if the deployment variable should be encrypted
+func (e TfvarsEncryption) Encrypts(name string) bool {
+	return e.Enabled() && (len(e.Keys) == 0 || slices.Contains(e.Keys, name))
+}
+
+// CredentialsPolicy controls how generated deployments authenticate to Google Cloud
+type CredentialsPolicy struct {
+	// reject module settings and variables that pass service account keys
+	ForbidServiceAccountKeys bool `yaml:"forbid_service_account_keys,omitempty"`
+	// service account impersonated by Terraform providers of the deployment
+	ImpersonateServiceAccount string `yaml:"impersonate_service_account,omitempty"`
 }
 
 // ModuleID is a unique identifier for a module in a blueprint
@@ -229,6 +361,12 @@ type Module struct {
 	Use      ModuleIDs                 `yaml:"use,omitempty"`
 	Outputs  []modulereader.OutputInfo `yaml:"outputs,omitempty"`
 	Settings Dict                      `yaml:"settings,omitempty"`
+	// validators that do not report findings for this module, see SkipsValidator
+	SkipValidators []string `yaml:"skip_validators,omitempty"`
+	// required reason of skipping validators, recorded in the expanded blueprint
+	SkipJustification string `yaml:"skip_justification,omitempty"`
+	// resources of the module are guarded against destruction, see modulewriter
+	DestroyProtection bool `yaml:"destroy_protection,omitempty"`
 	// DEPRECATED fields, keep in the struct for backwards compatibility
 	RequiredApis     interface{} `yaml:"required_apis,omitempty"`
 	WrapSettingsWith interface{} `yaml:"wrapsettingswith,omitempty"`
@@ -239,9 +377,15 @@ func (m *Module) Clone() Module {
 	// copy slices
 	c.Use = slices.Clone(m.Use)
 	c.Outputs = slices.Clone(m.Outputs)
+	c.SkipValidators = slices.Clone(m.SkipValidators)
 	return c
 }
 
+// SkipsValidator tests whether findings of the validator are skipped for the module
+func (m Module) SkipsValidator(name string) bool {
+	return slices.Contains(m.SkipValidators, name)
+}
+
 // InfoOrDie returns the ModuleInfo for the module or panics
 func (m Module) InfoOrDie() modulereader.ModuleInfo {
 	mi, err := modulereader.GetModuleInfo(m.Source, m.Kind.String())
@@ -261,8 +405,13 @@ type Blueprint struct {
 	Validators               []Validator `yaml:"validators,omitempty"`
 	ValidationLevel          int         `yaml:"validation_level,omitempty"`
 	Vars                     Dict
-	Groups                   []Group          `yaml:"deployment_groups"`
-	TerraformBackendDefaults TerraformBackend `yaml:"terraform_backend_defaults,omitempty"`
+	Groups                   []Group            `yaml:"deployment_groups"`
+	TerraformBackendDefaults TerraformBackend   `yaml:"terraform_backend_defaults,omitempty"`
+	LabelPolicy              LabelPolicy        `yaml:"label_policy,omitempty"`
+	TfvarsEncryption         TfvarsEncryption   `yaml:"tfvars_encryption,omitempty"`
+	CredentialsPolicy        CredentialsPolicy  `yaml:"credentials_policy,omitempty"`
+	ExternalResources        []ExternalResource `yaml:"external_resources,omitempty"`
+	LoginPool                *LoginPool         `yaml:"login_pool,omitempty"`
 
 	// internal & non-serializable fields
 
@@ -272,11 +421,27 @@ type Blueprint struct {
 	stagedFiles map[string]string
 }
 
+// Clone returns a deep copy of the blueprint. The copy is a snapshot that can be
+// read, e.g. by validators, concurrently with modifications of the original.
 func (bp *Blueprint) Clone() Blueprint {
 	c := *bp // copy immutable fields
 	// copy slices & maps of immutable types
 	c.Validators = slices.Clone(bp.Validators)
+	c.LabelPolicy = LabelPolicy{
+		ExcludeModules: slices.Clone(bp.LabelPolicy.ExcludeModules),
+		ExcludeKeys:    slices.Clone(bp.LabelPolicy.ExcludeKeys),
+		RequiredKeys:   slices.Clone(bp.LabelPolicy.RequiredKeys),
+	}
+	c.TfvarsEncryption.Keys = slices.Clone(bp.TfvarsEncryption.Keys)
+	c.ExternalResources = slices.Clone(bp.ExternalResources)
+	if bp.LoginPool != nil {
+		lp := *bp.LoginPool
+		lp.Use = slices.Clone(lp.Use)
+		c.LoginPool = &lp
+	}
+	stagedFilesMu.Lock()
 	c.stagedFiles = maps.Clone(bp.stagedFiles)
+	stagedFilesMu.Unlock()
 	// groups require deep copy
 	c.Groups = make([]Group, len(bp.Groups))
 	for i, g := range bp.Groups {
@@ -294,13 +459,19 @@ type DeploymentSettings struct {
 // Expand expands the config in place
 func (bp *Blueprint) Expand() error {
 	// expand the blueprint in dependency order:
-	// BlueprintName -> DefaultBackend -> Vars -> Groups
+	// BlueprintName -> DefaultBackend -> ExternalResources -> LoginPool -> Vars -> Groups
 	if err := bp.checkBlueprintName(); err != nil {
 		return err
 	}
 	if err := checkBackend(Root.Backend, bp.TerraformBackendDefaults); err != nil {
 		return err
 	}
+	if err := bp.expandExternalResources(); err != nil {
+		return err
+	}
+	if err := bp.expandLoginPool(); err != nil {
+		return err
+	}
 	if err := bp.expandVars(); err != nil {
 		return err
 	}
@@ -331,7 +502,7 @@ func (m Module) ListUnusedModules() ModuleIDs {
 // GetUsedDeploymentVars returns a list of deployment vars used in the given value
 func GetUsedDeploymentVars(val cty.Value) []string {
 	res := []string{}
-	for ref := range valueReferences(val) {
+	for ref := range ValueReferences(val) {
 		if ref.GlobalVar {
 			res = append(res, ref.Name)
 		}
@@ -387,7 +558,15 @@ func NewBlueprint(path string) (Blueprint, *YamlCtx, error) {
 	if err != nil {
 		return Blueprint{}, &YamlCtx{}, err
 	}
-	bp, ctx, err := parseYamlFile[Blueprint](absPath)
+	y, err := os.ReadFile(absPath)
+	if err != nil {
+		return Blueprint{}, &YamlCtx{}, fmt.Errorf("failed to read the input yaml, filename=%s: %v", absPath, err)
+	}
+	bp, ctx, err := parseYaml[Blueprint](y)
+	// check version first, blueprint may fail to parse due to newer features
+	if verr := checkGhpcVersion(y); verr != nil {
+		return Blueprint{}, &ctx, verr
+	}
 	if err != nil {
 		return Blueprint{}, &ctx, err
 	}
@@ -399,14 +578,42 @@ func NewDeploymentSettings(deploymentFilename string) (DeploymentSettings, YamlC
 	return parseYamlFile[DeploymentSettings](deploymentFilename)
 }
 
+// Export writes deployment settings to a deployment file
+func (ds DeploymentSettings) Export(outputFilename string) error {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	err := encoder.Encode(&ds)
+	encoder.Close()
+	if err != nil {
+		return fmt.Errorf("failed to export deployment settings: %w", err)
+	}
+	if err := os.WriteFile(outputFilename, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write the deployment file %s: %w", outputFilename, err)
+	}
+	return nil
+}
+
 // Export exports the internal representation of a blueprint config
 func (bp Blueprint) Export(outputFilename string) error {
+	return bp.ExportWithComments(outputFilename, nil)
+}
+
+// ExportWithComments exports the blueprint, adding comments to values of given paths,
+// comments are keyed by path strings, e.g. "deployment_groups[0].modules[1].settings.zone".
+func (bp Blueprint) ExportWithComments(outputFilename string, comments map[string]string) error {
+	var n yaml.Node
+	if err := n.Encode(&bp); err != nil {
+		return fmt.Errorf("failed to export the configuration to a blueprint yaml file: %w", err)
+	}
+	addYamlComments(&n, "", comments)
+
 	var buf bytes.Buffer
 	buf.WriteString(YamlLicense)
 	buf.WriteString("\n")
 	encoder := yaml.NewEncoder(&buf)
 	encoder.SetIndent(2)
-	err := encoder.Encode(&bp)
+	err := encoder.Encode(&n)
 	encoder.Close()
 	d := buf.Bytes()
 
@@ -440,24 +647,18 @@ func checkModulesAndGroups(bp Blueprint) error {
 		errs.At(pg.Name, grp.Name.Validate())
 
 		if seenGrp[grp.Name] {
-			errs.At(pg.Name, fmt.Errorf("group names must be unique, %q used more than once", grp.Name))
+			errs.At(pg.Name, CodedError{CodeInvalidGroup, fmt.Errorf("group names must be unique, %q used more than once", grp.Name)})
 		}
 		seenGrp[grp.Name] = true
 
 		if len(grp.Modules) == 0 {
-			errs.At(pg.Modules, errors.New("deployment group must have at least one module"))
-		} else if grp.Kind() == UnknownKind {
-			errs.At(pg.Modules, errors.New("mixing modules of differing kinds in a deployment group is not supported"))
-		} else if grp.Kind() == PackerKind && len(grp.Modules) > 1 {
-			errs.At(pg, HintError{
-				Err:  fmt.Errorf("packer group %q has more than 1 module", grp.Name),
-				Hint: "separate each packer module into its own deployment group"})
+			errs.At(pg.Modules, CodedError{CodeInvalidGroup, errors.New("deployment group must have at least one module")})
 		}
 
 		for im, mod := range grp.Modules {
 			pm := pg.Modules.At(im)
 			if seenMod[mod.ID] {
-				errs.At(pm.ID, fmt.Errorf("module IDs must be unique, %q used more than once", mod.ID))
+				errs.At(pm.ID, CodedError{CodeInvalidModuleID, fmt.Errorf("module IDs must be unique, %q used more than once", mod.ID)})
 			}
 			seenMod[mod.ID] = true
 			errs.Add(validateModule(pm, mod, bp))
@@ -465,7 +666,8 @@ func checkModulesAndGroups(bp Blueprint) error {
 
 		errs.Add(checkBackend(pg.Backend, grp.TerraformBackend))
 	}
-	return errs.OrNil()
+	// groups mixing packer modules with other modules are split after expansion
+	return errs.Add(checkSplittable(bp)).OrNil()
 }
 
 // validateModuleUseReferences verifies that any used modules exist and
@@ -481,7 +683,7 @@ func validateModuleUseReferences(p ModulePath, mod Module, bp Blueprint) error {
 func checkBackend(bep backendPath, be TerraformBackend) error {
 	val, perr := parseYamlString(be.Type)
 	if _, is := IsExpressionValue(val); is || perr != nil {
-		return BpError{bep.Type, errors.New("can not use expression as a terraform_backend type")}
+		return BpError{bep.Type, CodedError{CodeInvalidBackend, errors.New("can not use expression as a terraform_backend type")}}
 	}
 	return nil
 }
@@ -517,17 +719,17 @@ func (err InputValueError) Error() string {
 var matchLabelNameExp *regexp.Regexp = regexp.MustCompile(`^[\p{Ll}\p{Lo}][\p{Ll}\p{Lo}\p{N}_-]{0,62}$`)
 var matchLabelValueExp *regexp.Regexp = regexp.MustCompile(`^[\p{Ll}\p{Lo}\p{N}_-]{0,63}$`)
 
-// isValidLabelName checks if a string is a valid name for a GCP label.
+// IsValidLabelName checks if a string is a valid name for a GCP label.
 // For more information on valid label names, see the docs at:
 // https://cloud.google.com/resource-manager/docs/creating-managing-labels#requirements
-func isValidLabelName(name string) bool {
+func IsValidLabelName(name string) bool {
 	return matchLabelNameExp.MatchString(name)
 }
 
-// isValidLabelValue checks if a string is a valid value for a GCP label.
+// IsValidLabelValue checks if a string is a valid value for a GCP label.
 // For more information on valid label values, see the docs at:
 // https://cloud.google.com/resource-manager/docs/creating-managing-labels#requirements
-func isValidLabelValue(value string) bool {
+func IsValidLabelValue(value string) bool {
 	return matchLabelValueExp.MatchString(value)
 }
 
@@ -566,7 +768,7 @@ func validateDeploymentName(bp Blueprint) error {
 	}
 
 	// Check that deployment_name is a valid label
-	if !isValidLabelValue(s) {
+	if !IsValidLabelValue(s) {
 		return BpError{path, InputValueError{
 			inputKey: "deployment_name",
 			cause:    errMsgLabelValueReqs,
@@ -585,7 +787,7 @@ func (bp *Blueprint) checkBlueprintName() error {
 		}}
 	}
 
-	if !isValidLabelValue(bp.BlueprintName) {
+	if !IsValidLabelValue(bp.BlueprintName) {
 		return BpError{Root.BlueprintName, InputValueError{
 			inputKey: "blueprint_name",
 			cause:    errMsgLabelValueReqs,
@@ -652,7 +854,7 @@ func (bp *Blueprint) WalkModulesSafe(walker func(ModulePath, *Module)) {
 func validateModuleSettingReferences(p ModulePath, m Module, bp Blueprint) error {
 	errs := Errors{}
 	for k, v := range m.Settings.Items() {
-		for r, rp := range valueReferences(v) {
+		for r, rp := range ValueReferences(v) {
 			errs.At(
 				p.Settings.Dot(k).Cty(rp),
 				validateModuleSettingReference(bp, m, r))
@@ -671,15 +873,15 @@ func varsTopologicalOrder(vars Dict) ([]string, error) {
 	dfs = func(n string) error {
 		used[n] = 1 // put on stack
 		v := vars.Get(n)
-		for ref, rp := range valueReferences(v) {
+		for ref, rp := range ValueReferences(v) {
 			p := Root.Vars.Dot(n).Cty(rp)
 
 			if !ref.GlobalVar {
-				return BpError{p, fmt.Errorf("non-global variable %q referenced in expression", ref)}
+				return BpError{p, CodedError{CodeInvalidVariableRef, fmt.Errorf("non-global variable %q referenced in expression", ref)}}
 			}
 
 			if used[ref.Name] == 1 {
-				return BpError{p, fmt.Errorf("cyclic dependency detected: %q -> %q", v, ref)}
+				return BpError{p, CodedError{CodeInvalidVariableRef, fmt.Errorf("cyclic dependency detected: %q -> %q", v, ref)}}
 			}
 
 			if used[ref.Name] == 0 {
@@ -21,6 +21,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sync"
 	"testing"
 
 	"hpc-toolkit/pkg/modulereader"
@@ -28,6 +29,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/zclconf/go-cty/cty"
 	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v3"
 )
 
 // Suite that does not use any setup
@@ -99,6 +101,20 @@ func (b *modBuilder) inputs(i ...interface{}) *modBuilder {
 	return b
 }
 
+func (b *modBuilder) validator(name string, inputs string) *modBuilder {
+	mv := modulereader.MetadataValidator{Validator: name}
+	if err := yaml.Unmarshal([]byte(inputs), &mv.Inputs); err != nil {
+		panic(err)
+	}
+	b.i.Metadata.Ghpc.Validators = append(b.i.Metadata.Ghpc.Validators, mv)
+	return b
+}
+
+func (b *modBuilder) requires(reqs ...string) *modBuilder {
+	b.i.Metadata.Ghpc.Requirements = append(b.i.Metadata.Ghpc.Requirements, reqs...)
+	return b
+}
+
 func (b *modBuilder) packer() *modBuilder {
 	b.m.Kind = PackerKind
 	return b
@@ -152,7 +168,13 @@ func (s *zeroSuite) TestCheckModulesAndGroups(c *C) {
 	{ // Mixing module kinds
 		g := Group{Name: "ice", Modules: []Module{pony, zebra}}
 		err := checkModulesAndGroups(Blueprint{Groups: []Group{g}})
-		c.Check(err, NotNil)
+		c.Check(err, IsNil)
+	}
+	{ // Mixing module kinds, can not be split
+		bison := tMod("bison").set("x", ModuleRef("pony", "y")).build()
+		g := Group{Name: "ice", Modules: []Module{bison, zebra, pony}}
+		err := checkModulesAndGroups(Blueprint{Groups: []Group{g}})
+		c.Check(err, ErrorMatches, `(?s).*module "bison" uses module "pony", which is declared after packer module "zebra".*`)
 	}
 	{ // Empty group
 		g := Group{Name: "ice"}
@@ -227,6 +249,19 @@ func (s *zeroSuite) TestAddKindToModules(c *C) {
 	c.Check(mod.Kind, Equals, ModuleKind{"red"})
 }
 
+func (s *zeroSuite) TestGroupKind(c *C) {
+	tf := Module{ID: "tf", Kind: TerraformKind}
+	helm := Module{ID: "helm", Kind: HelmKind}
+	pkr := Module{ID: "pkr", Kind: PackerKind}
+
+	c.Check(Group{}.Kind(), Equals, UnknownKind)
+	c.Check(Group{Modules: []Module{pkr}}.Kind(), Equals, PackerKind)
+	c.Check(Group{Modules: []Module{tf, helm}}.Kind(), Equals, TerraformKind)
+	c.Check(Group{Modules: []Module{helm}}.Kind(), Equals, TerraformKind)
+	c.Check(Group{Modules: []Module{{ID: "script", Kind: ScriptKind}, tf}}.Kind(), Equals, TerraformKind)
+	c.Check(Group{Modules: []Module{tf, pkr}}.Kind(), Equals, UnknownKind)
+}
+
 func (s *zeroSuite) TestGetModule(c *C) {
 	bp := Blueprint{
 		Groups: []Group{{
@@ -377,6 +412,59 @@ not_a_field: not_a_value
 	}
 }
 
+func (s *zeroSuite) TestConcurrentUse(c *C) {
+	// run with `go test -race` to detect data races
+	bp := Blueprint{
+		BlueprintName: "race",
+		Vars: NewDict(map[string]cty.Value{
+			"deployment_name": cty.StringVal("green"),
+			"zone":            cty.StringVal("us-central1-a")}),
+		Groups: []Group{{Name: "g", Modules: []Module{
+			tMod("a").inputs("zone").outputs("o").build(),
+			tMod("b").inputs("zone", "o").uses("a").build(),
+		}}},
+	}
+	c.Assert(bp.Expand(), IsNil)
+	_, err := bp.Eval(MustParseExpression(`ghpc_stage("seed")`).AsValue())
+	c.Assert(err, IsNil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int, bp Blueprint) { // copies share staged files, same as validators
+			defer wg.Done()
+			snap := bp.Clone()
+			snap.Vars = snap.Vars.With("zone", cty.StringVal(fmt.Sprintf("zone-%d", i)))
+			snap.WalkModulesSafe(func(_ ModulePath, m *Module) {
+				m.Settings = m.Settings.With("zone", GlobalRef("zone").AsValue())
+				m.InfoOrDie()
+			})
+			stage := MustParseExpression(fmt.Sprintf(`ghpc_stage("file-%d")`, i)).AsValue()
+			_, err := bp.Eval(stage)
+			c.Check(err, IsNil)
+			z, err := snap.Eval(GlobalRef("zone").AsValue())
+			c.Check(err, IsNil)
+			c.Check(z, DeepEquals, cty.StringVal(fmt.Sprintf("zone-%d", i)))
+		}(i, bp)
+	}
+	wg.Wait()
+	c.Check(bp.Vars.Get("zone"), DeepEquals, cty.StringVal("us-central1-a"))
+}
+
+func (s *zeroSuite) TestDeploymentSettingsExport(c *C) {
+	path := filepath.Join(c.MkDir(), "deployment.yaml")
+	ds := DeploymentSettings{
+		Vars: NewDict(map[string]cty.Value{
+			"project_id": cty.StringVal("ds-project"),
+			"size":       cty.NumberIntVal(10)}),
+	}
+	c.Assert(ds.Export(path), IsNil)
+
+	got, _, err := NewDeploymentSettings(path)
+	c.Assert(err, IsNil)
+	c.Check(got, DeepEquals, ds)
+}
+
 func (s *zeroSuite) TestValidateGlobalLabels(c *C) {
 
 	labelName := "my_test_label_name"
@@ -444,7 +532,7 @@ func (s *zeroSuite) TestValidateGlobalLabels(c *C) {
 
 	{ // Too many labels
 		tooManyLabelsMap := map[string]cty.Value{}
-		for i := 0; i < maxLabels+1; i++ {
+		for i := 0; i < MaxLabels+1; i++ {
 			tooManyLabelsMap[labelName+"_"+fmt.Sprint(i)] = labelValue
 		}
 		c.Check(h(cty.MapVal(tooManyLabelsMap)), NotNil)
@@ -614,6 +702,13 @@ func (s *zeroSuite) TestModuleGroup(c *C) {
 	}
 }
 
+func (s *zeroSuite) TestClosestWords(c *C) {
+	dict := []string{"zone", "zones", "region", "bone", "machine_type"}
+	c.Check(closestWords("zon", dict, 3), DeepEquals, []string{"zone", "bone", "zones"})
+	c.Check(closestWords("zon", dict, 1), DeepEquals, []string{"zone"})
+	c.Check(closestWords("deployment_name", dict, 3), HasLen, 0)
+}
+
 func (s *zeroSuite) TestValidateModuleSettingReference(c *C) {
 	mod11 := tMod("mod11").outputs("out11").build()
 	mod21 := tMod("mod21").outputs("out21").build()
@@ -638,6 +733,14 @@ func (s *zeroSuite) TestValidateModuleSettingReference(c *C) {
 	// FAIL. deployment var doesn't exist
 	c.Check(vld(bp, mod11, GlobalRef("var2")), NotNil)
 
+	// FAIL. deployment var doesn't exist, list known vars
+	{
+		err := vld(bp, mod11, GlobalRef("pomegranate"))
+		var h HintError
+		c.Assert(errors.As(err, &h), Equals, true)
+		c.Check(h.Hint, Equals, "defined deployment variables are: var1")
+	}
+
 	// FAIL. wrong module
 	c.Check(vld(bp, mod11, ModuleRef("jack", "kale")), NotNil)
 
@@ -674,6 +777,11 @@ func (s *zeroSuite) TestValidateModuleSettingReference(c *C) {
 	unkModErr = UnknownModuleError{mod}
 	c.Check(errors.Is(vld(bp, mod11, ModuleRef(mod, "kale")), HintError{fmt.Sprintf("did you mean %q?", string(pkr.ID)), unkModErr}), Equals, false)
 	c.Check(errors.Is(vld(bp, mod11, ModuleRef(mod, "kale")), unkModErr), Equals, true)
+	{
+		var h HintError
+		c.Assert(errors.As(vld(bp, mod11, ModuleRef(mod, "kale")), &h), Equals, true)
+		c.Check(h.Hint, Matches, "only deployment variables and module outputs can be referenced.*")
+	}
 }
 
 func (s *zeroSuite) TestValidateModuleSettingReferences(c *C) {
@@ -784,3 +892,70 @@ func (s *zeroSuite) TestEvalVars(c *C) {
 		}
 	}
 }
+
+func (s *zeroSuite) TestUnsetValues(c *C) {
+	size := modulereader.VarInfo{Name: "size", Type: cty.Number, Description: "size in GB", Required: true}
+	req := func(n string) modulereader.VarInfo {
+		return modulereader.VarInfo{Name: n, Type: cty.String, Required: true}
+	}
+	bp := Blueprint{
+		Vars: NewDict(map[string]cty.Value{
+			"zone":       cty.NullVal(cty.DynamicPseudoType),
+			"project_id": cty.NullVal(cty.DynamicPseudoType),
+			"region":     cty.StringVal("us-central1")}),
+		Groups: []Group{{Modules: []Module{
+			tMod("net").outputs("network").build(),
+			tMod("a").inputs(size, req("name"), req("region"), req("network"), req("zone")).
+				uses("net").set("name", "green").build(),
+			tMod("b").inputs(size, req("network")).build(),
+			tMod("c").inputs(modulereader.VarInfo{Name: "size", Type: cty.Number, Default: 50}).build(),
+		}}},
+	}
+
+	got := bp.UnsetValues()
+	c.Assert(got, HasLen, 4)
+	c.Check(got[2].Default.Equals(cty.NumberIntVal(50)), Equals, cty.True)
+	got[2].Default = cty.NilVal
+	c.Check(got, DeepEquals, []UnsetValue{
+		{Name: "project_id", Type: cty.NilType},
+		{Name: "zone", Type: cty.NilType},
+		{Name: "size", Type: cty.Number, Description: "size in GB", Modules: []ModuleID{"a", "b"}},
+		{Name: "network", Type: cty.String, Modules: []ModuleID{"b"}},
+	})
+}
+
+func (s *zeroSuite) TestResolveDefaults(c *C) {
+	m := tMod("lime").
+		inputs(
+			modulereader.VarInfo{Name: "zone", Type: cty.String, Required: true},
+			modulereader.VarInfo{Name: "size", Type: cty.Number, Default: 10},
+			modulereader.VarInfo{Name: "tags", Type: cty.List(cty.String), Default: []interface{}{}},
+			modulereader.VarInfo{Name: "color", Type: cty.String, Default: "green"},
+			modulereader.VarInfo{Name: "network", Type: cty.String}).
+		set("color", "red").
+		build()
+	bp := Blueprint{
+		BlueprintName: "resolved",
+		Groups:        []Group{{Name: "green", Modules: []Module{m}}}}
+
+	added, err := bp.ResolveDefaults()
+	c.Assert(err, IsNil)
+	sp := Root.Groups.At(0).Modules.At(0).Settings
+	c.Check(added, DeepEquals, []Path{sp.Dot("size"), sp.Dot("tags"), sp.Dot("network")})
+	got := bp.Groups[0].Modules[0].Settings
+	c.Check(got.Get("color"), DeepEquals, cty.StringVal("red"))
+	c.Check(got.Get("size").Equals(cty.NumberIntVal(10)), Equals, cty.True)
+	c.Check(got.Get("tags"), DeepEquals, cty.ListValEmpty(cty.String))
+	c.Check(got.Get("network"), DeepEquals, cty.NullVal(cty.String))
+
+	path := filepath.Join(c.MkDir(), "expanded.yaml")
+	c.Assert(bp.ExportWithComments(path, map[string]string{
+		sp.Dot("size").String(): ModuleDefaultComment,
+		sp.Dot("tags").String(): ModuleDefaultComment,
+	}), IsNil)
+	b, err := os.ReadFile(path)
+	c.Assert(err, IsNil)
+	c.Check(string(b), Matches, "(?s).*\n +size: 10 # module default\n.*")
+	c.Check(string(b), Matches, "(?s).*\n +# module default\n +tags: \\[\\]\n.*")
+	c.Check(string(b), Matches, "(?s).*\n +color: red\n.*")
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// ModuleDefaultComment is used to mark settings added by ResolveDefaults in the exported blueprint
+const ModuleDefaultComment = "module default"
+
+// ResolveDefaults sets every input of every module that is not set to the default
+// value of the module input, so the blueprint shows the complete configuration
+// that modules will receive. Inputs without default are set to null.
+// Should be called on the expanded blueprint, returns paths of added settings.
+func (bp *Blueprint) ResolveDefaults() ([]Path, error) {
+	added := []Path{}
+	errs := Errors{}
+	bp.WalkModulesSafe(func(mp ModulePath, m *Module) {
+		for _, in := range m.InfoOrDie().Inputs {
+			if m.Settings.Has(in.Name) || in.Required {
+				continue
+			}
+			v, err := inputDefault(in.Default, in.Type)
+			if err != nil {
+				errs.At(mp.Settings.Dot(in.Name), fmt.Errorf("unable to resolve default of %q of module %q: %w", in.Name, m.ID, err))
+				continue
+			}
+			m.Settings = m.Settings.With(in.Name, v)
+			added = append(added, mp.Settings.Dot(in.Name))
+		}
+	})
+	return added, errs.OrNil()
+}
+
+// inputDefault converts default value of module input to the type of the input, if it is known
+func inputDefault(def interface{}, ty cty.Type) (cty.Value, error) {
+	if ty == cty.NilType {
+		ty = cty.DynamicPseudoType
+	}
+	if def == nil {
+		return cty.NullVal(ty), nil
+	}
+	v, err := goToCty(def)
+	if err != nil || ty == cty.DynamicPseudoType {
+		return v, err
+	}
+	if cv, err := convert.Convert(v, ty); err == nil {
+		return cv, nil
+	}
+	return v, nil // keep as is, the module will report type mismatch
+}
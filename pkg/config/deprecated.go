@@ -0,0 +1,95 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// map[renamed validator]replacing validator
+var renamedValidators = map[string]string{}
+
+// map[module source]map[renamed setting]replacing setting, only settings
+// with a direct replacement of the same type are listed
+var renamedSettings = map[string]map[string]string{
+	"community/modules/compute/gke-node-pool": {
+		"total_min_nodes": "autoscaling_total_min_nodes",
+		"total_max_nodes": "autoscaling_total_max_nodes",
+	},
+}
+
+// DeprecationKind is the kind of a deprecated name
+type DeprecationKind string
+
+// Kinds of deprecated names
+const (
+	DeprecatedValidator DeprecationKind = "validator"
+	DeprecatedModule    DeprecationKind = "module"
+	DeprecatedSetting   DeprecationKind = "setting"
+)
+
+// Deprecation is a use of a renamed validator, module source or setting in the
+// blueprint. Old is replaced with New at Path to fix it.
+type Deprecation struct {
+	Kind DeprecationKind
+	Path Path
+	Old  string
+	New  string
+	// set if the replacement is already used, the deprecation can not be fixed automatically
+	Conflict bool
+}
+
+func (d Deprecation) String() string {
+	s := fmt.Sprintf("%s %q is deprecated, use %q instead", d.Kind, d.Old, d.New)
+	if d.Conflict {
+		s += fmt.Sprintf(", remove it as %q is already set", d.New)
+	}
+	return s
+}
+
+// RenamedValidator returns the replacement of a renamed validator
+func RenamedValidator(name string) (string, bool) {
+	r, ok := renamedValidators[name]
+	return r, ok
+}
+
+// Deprecations returns uses of renamed validators, moved modules and renamed
+// settings of modules in the blueprint, in order of appearance
+func (bp Blueprint) Deprecations() []Deprecation {
+	res := []Deprecation{}
+	for i, v := range bp.Validators {
+		if r, ok := renamedValidators[v.Validator]; ok {
+			res = append(res, Deprecation{Kind: DeprecatedValidator, Path: Root.Validators.At(i).Validator, Old: v.Validator, New: r})
+		}
+	}
+	bp.WalkModulesSafe(func(p ModulePath, m *Module) {
+		for is, name := range m.SkipValidators {
+			if r, ok := renamedValidators[name]; ok {
+				res = append(res, Deprecation{Kind: DeprecatedValidator, Path: p.SkipValidators.At(is), Old: name, New: r})
+			}
+		}
+		source := strings.Trim(m.Source, "./")
+		if r, ok := movedModules[source]; ok {
+			res = append(res, Deprecation{Kind: DeprecatedModule, Path: p.Source, Old: source, New: r})
+		}
+		for _, k := range sortedKeys(m.Settings.Items()) {
+			if r, ok := renamedSettings[source][k]; ok {
+				res = append(res, Deprecation{Kind: DeprecatedSetting, Path: p.Settings.Dot(k), Old: k, New: r, Conflict: m.Settings.Has(r)})
+			}
+		}
+	})
+	return res
+}
@@ -21,6 +21,8 @@ import (
 
 // Dict maps string key to cty.Value.
 // Zero Dict value is initialized (as opposed to nil map).
+// Dict is immutable, methods never modify the underlying map, see With,
+// so Dict can be shared between copies of Blueprint and used concurrently.
 type Dict struct {
 	m map[string]cty.Value
 }
@@ -47,6 +49,7 @@ func (d *Dict) Has(k string) bool {
 	return ok
 }
 
+// With returns a copy of Dict with the key set to the value.
 func (d Dict) With(k string, v cty.Value) Dict {
 	m := d.Items()
 	m[k] = v
@@ -17,6 +17,7 @@ package config
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"hpc-toolkit/pkg/modulereader"
 
@@ -39,7 +40,7 @@ func validateModuleInputs(mp ModulePath, m Module, bp Blueprint) error {
 
 		if !m.Settings.Has(input.Name) {
 			if input.Required {
-				errs.At(ip, fmt.Errorf("a required setting %q is missing from a module %q", input.Name, m.ID))
+				errs.At(ip, CodedError{CodeMissingSetting, fmt.Errorf("a required setting %q is missing from a module %q", input.Name, m.ID)})
 			}
 			continue
 		}
@@ -71,7 +72,7 @@ func checkInputValueMatchesType(val cty.Value, input modulereader.VarInfo, bp Bl
 	defer func() { recover() }()
 	// TODO: consider returning error (not panic) or logging warning
 	if _, err := convert.Convert(v, input.Type); err != nil {
-		return fmt.Errorf("unsuitable value for %q: %w", input.Name, err)
+		return CodedError{CodeUnsuitableSetting, fmt.Errorf("unsuitable value for %q%s: %w", input.Name, describeProvenance(val), err)}
 	}
 	return nil
 }
@@ -79,7 +80,7 @@ func checkInputValueMatchesType(val cty.Value, input modulereader.VarInfo, bp Bl
 func validateModulesAreUsed(bp Blueprint) error {
 	used := map[ModuleID]bool{}
 	bp.WalkModulesSafe(func(_ ModulePath, m *Module) {
-		for ref := range valueReferences(m.Settings.AsObject()) {
+		for ref := range ValueReferences(m.Settings.AsObject()) {
 			used[ref.Module] = true
 		}
 	})
@@ -89,7 +90,7 @@ func validateModulesAreUsed(bp Blueprint) error {
 		if m.InfoOrDie().Metadata.Ghpc.HasToBeUsed && !used[m.ID] {
 			errs.At(p.ID, HintError{
 				"you need to add it to the `use`-block of downstream modules",
-				fmt.Errorf("module %q was not used", m.ID)})
+				CodedError{CodeModuleNotUsed, fmt.Errorf("module %q was not used", m.ID)}})
 		}
 	})
 	return errs.OrNil()
@@ -124,8 +125,172 @@ func (bp *Blueprint) expandGroups() error {
 	if err := validateModulesAreUsed(*bp); err != nil {
 		return err
 	}
+	if err := validateLabelPolicy(*bp); err != nil {
+		return err
+	}
+	if err := validateTfvarsEncryption(*bp); err != nil {
+		return err
+	}
+	if err := validateCredentialsPolicy(*bp); err != nil {
+		return err
+	}
 	bp.populateOutputs()
-	return nil
+	return bp.addModuleValidators()
+}
+
+// selfModule is a pseudo-module ID to reference settings of the module in validators declared by it
+const selfModule ModuleID = "self"
+
+// addModuleValidators adds validators declared in metadata of modules used in the blueprint,
+// and validators checking requirements declared by them
+func (bp *Blueprint) addModuleValidators() error {
+	if err := validateValidatorModules(*bp); err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	key := func(v Validator) string {
+		return v.Validator + string(TokensForValue(v.Inputs.AsObject()).Bytes())
+	}
+	for _, v := range bp.Validators {
+		seen[key(v)] = true
+		if allModulesValidator(v.Validator) { // already checks all modules, or skipped
+			seen[v.Validator] = true
+		}
+	}
+
+	errs := Errors{}
+	added := []Validator{}
+	add := func(v Validator, k string) {
+		if !seen[k] {
+			seen[k] = true
+			added = append(added, v)
+		}
+	}
+	bp.WalkModulesSafe(func(p ModulePath, m *Module) {
+		ghpc := m.InfoOrDie().Metadata.Ghpc
+		for _, mv := range ghpc.Validators {
+			v, ok, err := moduleValidator(*m, mv)
+			if err != nil {
+				errs.At(p.Source, CodedError{CodeInvalidModuleValidator,
+					fmt.Errorf("validator %q declared by module %q: %w", mv.Validator, m.ID, err)})
+				continue
+			}
+			if ok {
+				add(v, key(v))
+			}
+		}
+		for _, req := range ghpc.Requirements {
+			vs, err := bp.requirementValidators(*m, req)
+			if err != nil {
+				errs.At(p.Source, CodedError{CodeInvalidModuleValidator,
+					fmt.Errorf("module %q: %w", m.ID, err)})
+				continue
+			}
+			for _, v := range vs {
+				if allModulesValidator(v.Validator) { // one is enough
+					add(v, v.Validator)
+				} else {
+					add(v, key(v))
+				}
+			}
+		}
+	})
+	bp.Validators = append(bp.Validators, added...)
+	return errs.OrNil()
+}
+
+// validateValidatorModules checks that validators attributed to a module, e.g. read
+// from an expanded blueprint, are declared or required by that module.
+// Otherwise the attribution would exempt them from replacing the defaults.
+func validateValidatorModules(bp Blueprint) error {
+	errs := Errors{}
+	for i, v := range bp.Validators {
+		if v.Module == "" {
+			continue
+		}
+		p := Root.Validators.At(i).Module
+		m, err := bp.Module(v.Module)
+		if err != nil {
+			errs.At(p, CodedError{CodeInvalidValidatorModule, err})
+			continue
+		}
+		if !declaresValidator(*m, v.Validator) {
+			errs.At(p, CodedError{CodeInvalidValidatorModule,
+				fmt.Errorf("module %q neither declares nor requires validator %q", m.ID, v.Validator)})
+		}
+	}
+	return errs.OrNil()
+}
+
+// declaresValidator returns true if the validator is declared by the module
+// metadata or checks one of the module requirements
+func declaresValidator(m Module, name string) bool {
+	ghpc := m.InfoOrDie().Metadata.Ghpc
+	for _, mv := range ghpc.Validators {
+		if mv.Validator == name {
+			return true
+		}
+	}
+	for _, req := range ghpc.Requirements {
+		for _, rv := range requirements[req] {
+			if rv.validator == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// moduleValidator builds validator declared by the module, replacing references to `self`
+// with module settings. Returns false if validator references a setting that is not set.
+func moduleValidator(m Module, mv modulereader.MetadataValidator) (Validator, bool, error) {
+	var inputs Dict
+	if !mv.Inputs.IsZero() {
+		if err := mv.Inputs.Decode(&inputs); err != nil {
+			return Validator{}, false, err
+		}
+	}
+
+	set := true
+	resolved := Dict{}
+	for k, v := range inputs.Items() {
+		nv, err := cty.Transform(v, func(_ cty.Path, v cty.Value) (cty.Value, error) {
+			e, is := IsExpressionValue(v)
+			if !is {
+				return v, nil
+			}
+			for _, r := range e.References() {
+				if r.GlobalVar || r.Module != selfModule {
+					continue
+				}
+				if !m.Settings.Has(r.Name) {
+					set = false
+					return v, nil
+				}
+				sv := m.Settings.Get(r.Name)
+				if string(e.Tokenize().Bytes()) == string(r.AsExpression().Tokenize().Bytes()) {
+					return sv, nil // whole expression is a reference to the setting
+				}
+				se, is := IsExpressionValue(sv)
+				if !is {
+					var err error
+					if se, err = ParseExpression(string(TokensForValue(sv).Bytes())); err != nil {
+						return v, err
+					}
+				}
+				var err error
+				if e, err = ReplaceSubExpressions(e, r.AsExpression(), se); err != nil {
+					return v, err
+				}
+			}
+			return e.AsValue(), nil
+		})
+		if err != nil {
+			return Validator{}, false, err
+		}
+		resolved = resolved.With(k, nv)
+	}
+	return Validator{Validator: mv.Validator, Inputs: resolved, Module: m.ID}, set, nil
 }
 
 func (bp Blueprint) expandGroup(gp groupPath, g *Group) error {
@@ -160,12 +325,21 @@ func (bp Blueprint) expandBackend(grp *Group) {
 	}
 
 	if be.Type == "gcs" && !be.Configuration.Has("prefix") {
-		prefix := MustParseExpression(
-			fmt.Sprintf(`"%s/${var.deployment_name}/%s"`, bp.BlueprintName, grp.Name))
-		be.Configuration = be.Configuration.With("prefix", prefix.AsValue())
+		be.Configuration = be.Configuration.With("prefix", bp.defaultGcsPrefix(grp.Name).AsValue())
 	}
 }
 
+// defaultGcsPrefix returns a prefix of GCS backend for a group without explicitly set one
+func (bp Blueprint) defaultGcsPrefix(g GroupName) Expression {
+	return MustParseExpression(fmt.Sprintf(`"%s/${var.deployment_name}/%s"`, bp.BlueprintName, g))
+}
+
+// isDefaultGcsPrefix tests whether GCS backend of the group uses an automatically generated prefix
+func (bp Blueprint) isDefaultGcsPrefix(g Group) bool {
+	e, is := IsExpressionValue(g.TerraformBackend.Configuration.Get("prefix"))
+	return is && string(e.Tokenize().Bytes()) == string(bp.defaultGcsPrefix(g.Name).Tokenize().Bytes())
+}
+
 func getModuleInputMap(inputs []modulereader.VarInfo) map[string]cty.Type {
 	modInputs := make(map[string]cty.Type)
 	for _, input := range inputs {
@@ -267,24 +441,44 @@ func (bp *Blueprint) expandGlobalLabels() {
 	bp.Vars = bp.Vars.With(labels, gl)
 }
 
-func combineModuleLabels(mod Module) cty.Value {
-	ref := GlobalRef("labels").AsValue()
+// globalLabelsRef returns a reference to the deployment labels with
+// keys excluded by the label policy filtered out.
+func (bp Blueprint) globalLabelsRef() cty.Value {
+	ref := GlobalRef("labels")
+	if len(bp.LabelPolicy.ExcludeKeys) == 0 {
+		return ref.AsValue()
+	}
+	conds := make([]string, len(bp.LabelPolicy.ExcludeKeys))
+	for i, k := range bp.LabelPolicy.ExcludeKeys {
+		conds[i] = fmt.Sprintf("k != %q", k)
+	}
+	return MustParseExpression(fmt.Sprintf(
+		"{ for k, v in %s : k => v if %s }", ref, strings.Join(conds, " && "))).AsValue()
+}
+
+func (bp Blueprint) combineModuleLabels(mod Module) cty.Value {
+	ref := bp.globalLabelsRef()
 	set := mod.Settings.Get("labels")
 
 	if !set.IsNull() {
 		// = merge(vars.labels, {...labels_from_settings...})
-		return FunctionCallExpression("merge", ref, set).AsValue()
+		return WithProvenance(FunctionCallExpression("merge", ref, set).AsValue(), Provenance{Origin: OriginDefault})
 
 	}
-	return ref // = vars.labels
+	return WithProvenance(ref, Provenance{Origin: OriginVar, Source: "labels"}) // = vars.labels
 }
 
 func (bp Blueprint) applyGlobalVarsInModule(mod *Module) {
 	mi := mod.InfoOrDie()
 	for _, input := range mi.Inputs {
-		if input.Name == "labels" && bp.Vars.Has("labels") {
-			// labels are special case, always make use of global labels
-			mod.Settings = mod.Settings.With("labels", combineModuleLabels(*mod))
+		if input.Name == "labels" {
+			if bp.LabelPolicy.ExcludesModule(mod.ID) {
+				continue // leave labels setting as is
+			}
+			if bp.Vars.Has("labels") {
+				// labels are special case, always make use of global labels
+				mod.Settings = mod.Settings.With("labels", bp.combineModuleLabels(*mod))
+			}
 		}
 
 		// Module setting exists? Nothing more needs to be done.
@@ -294,7 +488,8 @@ func (bp Blueprint) applyGlobalVarsInModule(mod *Module) {
 
 		// If it's not set, is there a global we can use?
 		if bp.Vars.Has(input.Name) {
-			mod.Settings = mod.Settings.With(input.Name, GlobalRef(input.Name).AsValue())
+			ref := WithProvenance(GlobalRef(input.Name).AsValue(), Provenance{Origin: OriginVar, Source: input.Name})
+			mod.Settings = mod.Settings.With(input.Name, ref)
 			continue
 		}
 
@@ -311,7 +506,7 @@ func AutomaticOutputName(outputName string, moduleID ModuleID) string {
 
 // Checks validity of reference to a module:
 // * module exists;
-// * module is not a Packer module;
+// * module is not a standalone (e.g. Packer) module;
 // * module is not in a later deployment group.
 func validateModuleReference(bp Blueprint, from Module, toID ModuleID) error {
 	to, err := bp.Module(toID)
@@ -323,8 +518,8 @@ func validateModuleReference(bp Blueprint, from Module, toID ModuleID) error {
 		return hintSpelling(string(toID), mods, err)
 	}
 
-	if to.Kind == PackerKind {
-		return fmt.Errorf("packer modules cannot be used by other modules: %s", to.ID)
+	if to.Kind.IsStandalone() {
+		return CodedError{CodeInvalidGroupOrder, fmt.Errorf("%s modules cannot be used by other modules: %s", to.Kind, to.ID)}
 	}
 
 	fg := bp.ModuleGroupOrDie(from.ID)
@@ -332,7 +527,7 @@ func validateModuleReference(bp Blueprint, from Module, toID ModuleID) error {
 	fgi := slices.IndexFunc(bp.Groups, func(g Group) bool { return g.Name == fg.Name })
 	tgi := slices.IndexFunc(bp.Groups, func(g Group) bool { return g.Name == tg.Name })
 	if tgi > fgi {
-		return fmt.Errorf("%s: %s is in a later group", errMsgIntergroupOrder, to.ID)
+		return CodedError{CodeInvalidGroupOrder, fmt.Errorf("%s: %s is in a later group", errMsgIntergroupOrder, to.ID)}
 	}
 	return nil
 }
@@ -345,8 +540,13 @@ func validateModuleSettingReference(bp Blueprint, mod Module, r Reference) error
 	// simplest case to evaluate is a deployment variable's existence
 	if r.GlobalVar {
 		if !bp.Vars.Has(r.Name) {
-			err := fmt.Errorf("module %q references unknown global variable %q", mod.ID, r.Name)
-			return hintSpelling(r.Name, bp.Vars.Keys(), err)
+			err := CodedError{CodeUnknownVariable, fmt.Errorf("module %q references unknown global variable %q", mod.ID, r.Name)}
+			if h := hintSpelling(r.Name, bp.Vars.Keys(), err); h != error(err) {
+				return h
+			}
+			known := bp.Vars.Keys()
+			slices.Sort(known)
+			return HintError{Hint: fmt.Sprintf("defined deployment variables are: %s", strings.Join(known, ", ")), Err: err}
 		}
 		return nil
 	}
@@ -358,7 +558,12 @@ func validateModuleSettingReference(bp Blueprint, mod Module, r Reference) error
 			bp.WalkModulesSafe(func(_ ModulePath, m *Module) {
 				hints = append(hints, string(m.ID))
 			})
-			return hintSpelling(string(unkModErr.ID), hints, unkModErr)
+			if h := hintSpelling(string(unkModErr.ID), hints, unkModErr); h != error(unkModErr) {
+				return h
+			}
+			return HintError{
+				Hint: fmt.Sprintf("only deployment variables and module outputs can be referenced: %s", expectedVarFormat),
+				Err:  unkModErr}
 		}
 		return err
 	}
@@ -374,7 +579,7 @@ func validateModuleSettingReference(bp Blueprint, mod Module, r Reference) error
 	}
 
 	if !slices.Contains(outputs, r.Name) {
-		err := fmt.Errorf("module %q does not have output %q", tm.ID, r.Name)
+		err := CodedError{CodeUnknownOutput, fmt.Errorf("module %q does not have output %q", tm.ID, r.Name)}
 		return hintSpelling(r.Name, outputs, err)
 	}
 	return nil
@@ -395,7 +600,7 @@ func (g Group) FindAllIntergroupReferences(bp Blueprint) []Reference {
 func FindIntergroupReferences(v cty.Value, mod Module, bp Blueprint) []Reference {
 	g := bp.ModuleGroupOrDie(mod.ID)
 	res := []Reference{}
-	for r := range valueReferences(v) {
+	for r := range ValueReferences(v) {
 		if !r.GlobalVar && bp.ModuleGroupOrDie(r.Module).Name != g.Name {
 			res = append(res, r)
 		}
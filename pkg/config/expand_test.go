@@ -15,10 +15,14 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"hpc-toolkit/pkg/modulereader"
+	"os"
+	"path/filepath"
 
 	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/slices"
 	. "gopkg.in/check.v1"
 )
 
@@ -215,8 +219,8 @@ func (s *zeroSuite) TestExpandModule(c *C) {
 		"rose": AsProductOfModuleUse(MustParseExpression(
 			`flatten([module.potato.rose])`).AsValue(), u.ID),
 
-		"labels": GlobalRef("labels").AsValue(),
-		"buki":   GlobalRef("buki").AsValue(),
+		"labels": WithProvenance(GlobalRef("labels").AsValue(), Provenance{Origin: OriginVar, Source: "labels"}),
+		"buki":   WithProvenance(GlobalRef("buki").AsValue(), Provenance{Origin: OriginVar, Source: "buki"}),
 	})
 }
 
@@ -243,7 +247,154 @@ func (s *zeroSuite) TestApplyGlobalVarsInModule(c *C) {
 	c.Check(mod.Settings.Items(), DeepEquals, map[string]cty.Value{
 		"silver": cty.StringVal("glagol"),
 		"helium": cty.StringVal("carrot"),
-		"pyrite": GlobalRef("pyrite").AsValue()})
+		"pyrite": WithProvenance(GlobalRef("pyrite").AsValue(), Provenance{Origin: OriginVar, Source: "pyrite"})})
+}
+
+func (s *zeroSuite) TestApplyGlobalLabelsWithPolicy(c *C) {
+	vars := NewDict(map[string]cty.Value{
+		"labels": cty.ObjectVal(map[string]cty.Value{
+			"color": cty.StringVal("red")})})
+
+	{ // excluded module keeps its own labels
+		mod := tMod("lemon").inputs("labels").set("labels", cty.EmptyObjectVal).build()
+		bp := Blueprint{Vars: vars, LabelPolicy: LabelPolicy{ExcludeModules: ModuleIDs{"lemon"}}}
+		bp.applyGlobalVarsInModule(&mod)
+		c.Check(mod.Settings.Items(), DeepEquals, map[string]cty.Value{
+			"labels": cty.EmptyObjectVal})
+	}
+
+	{ // excluded keys are filtered out
+		mod := tMod("lime").inputs("labels").build()
+		bp := Blueprint{Vars: vars, LabelPolicy: LabelPolicy{ExcludeKeys: []string{"color", "size"}}}
+		bp.applyGlobalVarsInModule(&mod)
+		c.Check(mod.Settings.Items(), DeepEquals, map[string]cty.Value{
+			"labels": WithProvenance(MustParseExpression(
+				`{ for k, v in var.labels : k => v if k != "color" && k != "size" }`).AsValue(),
+				Provenance{Origin: OriginVar, Source: "labels"})})
+
+		got, err := bp.Eval(mod.Settings.Get("labels"))
+		c.Assert(err, IsNil)
+		c.Check(got, DeepEquals, cty.EmptyObjectVal)
+	}
+}
+
+func (s *zeroSuite) TestValidateLabelPolicy(c *C) {
+	mod := tMod("kiwi").inputs("labels").build()
+	bp := Blueprint{
+		Vars: NewDict(map[string]cty.Value{
+			"labels": cty.ObjectVal(map[string]cty.Value{
+				"team": cty.StringVal("hpc")})}),
+		Groups: []Group{{Name: "g", Modules: []Module{mod}}}}
+	bp.applyGlobalVarsInModule(&bp.Groups[0].Modules[0])
+
+	{ // OK: no policy
+		c.Check(validateLabelPolicy(bp), IsNil)
+	}
+
+	{ // OK: required key is present
+		bp := bp
+		bp.LabelPolicy = LabelPolicy{RequiredKeys: []string{"team"}}
+		c.Check(validateLabelPolicy(bp), IsNil)
+	}
+
+	{ // FAIL: required key is missing
+		bp := bp
+		bp.LabelPolicy = LabelPolicy{RequiredKeys: []string{"cost_center"}}
+		c.Check(validateLabelPolicy(bp), ErrorMatches, `.*missing required label "cost_center".*`)
+	}
+
+	{ // OK: module is excluded
+		bp := bp
+		bp.LabelPolicy = LabelPolicy{
+			RequiredKeys:   []string{"cost_center"},
+			ExcludeModules: ModuleIDs{"kiwi"}}
+		c.Check(validateLabelPolicy(bp), IsNil)
+	}
+
+	{ // FAIL: unknown module is excluded
+		bp := bp
+		bp.LabelPolicy = LabelPolicy{ExcludeModules: ModuleIDs{"kiwu"}}
+		c.Check(validateLabelPolicy(bp), NotNil)
+	}
+
+	{ // FAIL: key is both required and excluded
+		bp := bp
+		bp.LabelPolicy = LabelPolicy{
+			RequiredKeys: []string{"team"},
+			ExcludeKeys:  []string{"team"}}
+		c.Check(validateLabelPolicy(bp), NotNil)
+	}
+}
+
+func (s *zeroSuite) TestValidateTfvarsEncryption(c *C) {
+	key := "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+	bp := Blueprint{Vars: NewDict(map[string]cty.Value{"db_password": cty.StringVal("hunter2")})}
+
+	{ // OK: no encryption
+		c.Check(validateTfvarsEncryption(bp), IsNil)
+	}
+
+	{ // OK: all or selected variables are encrypted
+		bp := bp
+		bp.TfvarsEncryption = TfvarsEncryption{KmsKey: key}
+		c.Check(validateTfvarsEncryption(bp), IsNil)
+		bp.TfvarsEncryption.Keys = []string{"db_password"}
+		c.Check(validateTfvarsEncryption(bp), IsNil)
+	}
+
+	{ // FAIL: malformed key
+		bp := bp
+		bp.TfvarsEncryption = TfvarsEncryption{KmsKey: "keyRings/r/cryptoKeys/k"}
+		c.Check(validateTfvarsEncryption(bp), ErrorMatches, `.*invalid Cloud KMS key name "keyRings/r/cryptoKeys/k".*`)
+	}
+
+	{ // FAIL: unknown variable, keys without key
+		bp := bp
+		bp.TfvarsEncryption = TfvarsEncryption{KmsKey: key, Keys: []string{"db_pasword"}}
+		c.Check(validateTfvarsEncryption(bp), ErrorMatches, `.*"db_pasword" is not a deployment variable.*`)
+		bp.TfvarsEncryption = TfvarsEncryption{Keys: []string{"db_password"}}
+		c.Check(validateTfvarsEncryption(bp), ErrorMatches, `.*kms_key must be set.*`)
+	}
+}
+
+func (s *zeroSuite) TestValidateCredentialsPolicy(c *C) {
+	dir := c.MkDir()
+	keyFile, wifFile := filepath.Join(dir, "key.json"), filepath.Join(dir, "wif.json")
+	c.Assert(os.WriteFile(keyFile, []byte(`{"type": "service_account", "private_key": "..."}`), 0600), IsNil)
+	c.Assert(os.WriteFile(wifFile, []byte(`{"type": "external_account", "audience": "..."}`), 0600), IsNil)
+
+	mod := func(k string, v cty.Value) Module {
+		return Module{ID: "hybrid", Settings: NewDict(map[string]cty.Value{k: v})}
+	}
+	bp := func(p CredentialsPolicy, m Module) Blueprint {
+		return Blueprint{
+			CredentialsPolicy: p,
+			Vars:              NewDict(map[string]cty.Value{"project_id": cty.StringVal("prj")}),
+			Groups:            []Group{{Name: "g", Modules: []Module{m}}}}
+	}
+	forbid := CredentialsPolicy{ForbidServiceAccountKeys: true}
+
+	{ // OK: keys are allowed, keyless credentials
+		c.Check(validateCredentialsPolicy(bp(CredentialsPolicy{}, mod("google_app_cred_path", cty.StringVal(keyFile)))), IsNil)
+		c.Check(validateCredentialsPolicy(bp(forbid, mod("google_app_cred_path", cty.StringVal(wifFile)))), IsNil)
+		c.Check(validateCredentialsPolicy(bp(forbid, mod("google_app_cred_path", cty.NullVal(cty.String)))), IsNil)
+		c.Check(validateCredentialsPolicy(bp(forbid, mod("labels", cty.MapVal(map[string]cty.Value{"a": cty.StringVal("b")})))), IsNil)
+		c.Check(validateCredentialsPolicy(bp(CredentialsPolicy{ImpersonateServiceAccount: "tf@prj.iam.gserviceaccount.com"}, Module{ID: "a"})), IsNil)
+	}
+
+	{ // FAIL: key file, unverifiable file, key content
+		c.Check(validateCredentialsPolicy(bp(forbid, mod("google_app_cred_path", cty.StringVal(keyFile)))),
+			ErrorMatches, `.*setting "google_app_cred_path" of module "hybrid" expects a service account key file.*`)
+		c.Check(validateCredentialsPolicy(bp(forbid, mod("account_file", cty.StringVal("/etc/missing.json")))),
+			ErrorMatches, `.*setting "account_file" of module "hybrid" expects a service account key file.*`)
+		c.Check(validateCredentialsPolicy(bp(forbid, mod("startup_script", cty.StringVal(`echo '{"type": "service_account"}' > key.json`)))),
+			ErrorMatches, `.*setting "startup_script" of module "hybrid" contains a service account key.*`)
+	}
+
+	{ // FAIL: malformed service account email
+		c.Check(validateCredentialsPolicy(bp(CredentialsPolicy{ImpersonateServiceAccount: "terraform"}, Module{ID: "a"})),
+			ErrorMatches, `.*invalid service account email "terraform".*`)
+	}
 }
 
 func (s *zeroSuite) TestValidateModuleReference(c *C) {
@@ -334,3 +485,391 @@ func (s *zeroSuite) TestOutputNamesByGroup(c *C) {
 		})
 	}
 }
+
+func (s *zeroSuite) TestAddModuleValidators(c *C) {
+	fs := tMod("fs").
+		inputs("tier", "zone", "size").
+		set("tier", "HIGH_SCALE_SSD").
+		set("zone", GlobalRef("zone")).
+		validator("test_apis_enabled", "{}").
+		validator("test_tier_in_zone", `{tier: $(self.tier), zone: $(self.zone), msg: "tier $(self.tier)"}`).
+		validator("test_size", "{size: $(self.size)}"). // size is not set
+		build()
+	bp := Blueprint{
+		Vars: NewDict(map[string]cty.Value{"zone": cty.StringVal("danube")}),
+		Validators: []Validator{
+			{Validator: "test_apis_enabled", Inputs: Dict{}}},
+		Groups: []Group{{Name: "g", Modules: []Module{fs}}}}
+
+	c.Assert(bp.addModuleValidators(), IsNil)
+	c.Assert(bp.Validators, HasLen, 2) // duplicate and incomplete validators are not added
+
+	v := bp.Validators[1]
+	c.Check(v.Validator, Equals, "test_tier_in_zone")
+	c.Check(v.Module, Equals, ModuleID("fs"))
+	c.Check(v.Inputs.Get("tier"), DeepEquals, cty.StringVal("HIGH_SCALE_SSD"))
+	c.Check(v.Inputs.Get("zone"), DeepEquals, GlobalRef("zone").AsValue())
+	c.Check(v.Inputs.Get("msg"), DeepEquals, MustParseExpression(`"tier ${"HIGH_SCALE_SSD"}"`).AsValue())
+}
+
+func (s *zeroSuite) TestAddRequirementValidators(c *C) {
+	gpu := tMod("gpu").
+		inputs("zone", "guest_accelerator").
+		set("zone", "tisza").
+		requires("gpu_zone", "quota").
+		build()
+	vm := tMod("vm").
+		inputs("zone").
+		set("zone", GlobalRef("zone")).
+		requires("zone", "machine_type").
+		build()
+	bp := Blueprint{
+		Vars:   NewDict(map[string]cty.Value{"project_id": cty.StringVal("prj"), "zone": cty.StringVal("danube")}),
+		Groups: []Group{{Name: "g", Modules: []Module{gpu, vm}}}}
+
+	inputs := func(zone string) Dict {
+		return NewDict(map[string]cty.Value{
+			"project_id": GlobalRef("project_id").AsValue(),
+			"zone":       cty.StringVal(zone)})
+	}
+
+	{ // validators not run by default are added once with deployment variables, quota lacks region
+		bp := bp
+		c.Assert(bp.addModuleValidators(), IsNil)
+		vars := NewDict(map[string]cty.Value{
+			"project_id": GlobalRef("project_id").AsValue(),
+			"zone":       GlobalRef("zone").AsValue()})
+		c.Check(bp.Validators, DeepEquals, []Validator{
+			{Validator: "test_zone_exists", Inputs: inputs("tisza"), Module: "gpu"},
+			{Validator: "test_gpu_available", Inputs: vars, Module: "gpu"},
+			{Validator: "test_machine_type_exists", Inputs: vars, Module: "vm"}})
+	}
+
+	{ // validators declared or skipped by the blueprint are not added
+		bp := bp
+		bp.Validators = []Validator{
+			{Validator: "test_gpu_available", Skip: true},
+			{Validator: "test_machine_type_exists", Inputs: inputs("sava")}}
+		c.Assert(bp.addModuleValidators(), IsNil)
+		c.Check(bp.Validators, DeepEquals, []Validator{
+			{Validator: "test_gpu_available", Skip: true},
+			{Validator: "test_machine_type_exists", Inputs: inputs("sava")},
+			{Validator: "test_zone_exists", Inputs: inputs("tisza"), Module: "gpu"}})
+	}
+
+	{ // quota is checked by default validators
+		bp := bp
+		bp.Vars = bp.Vars.With("region", cty.StringVal("pannonia"))
+		c.Assert(bp.addModuleValidators(), IsNil)
+		c.Check(slices.ContainsFunc(bp.Validators, func(v Validator) bool { return v.Validator == "test_quota_sufficient" }), Equals, false)
+	}
+
+	{ // without deployment zone, validators checking all modules are added once
+		bp := bp
+		bp.Vars = NewDict(map[string]cty.Value{"project_id": cty.StringVal("prj")})
+		other := tMod("other").inputs("zone").set("zone", "drava").requires("gpu_zone").build()
+		bp.Groups = []Group{{Name: "g", Modules: []Module{gpu, other}}}
+		c.Assert(bp.addModuleValidators(), IsNil)
+		c.Check(bp.Validators, DeepEquals, []Validator{
+			{Validator: "test_zone_exists", Inputs: inputs("tisza"), Module: "gpu"},
+			{Validator: "test_gpu_available", Inputs: inputs("tisza"), Module: "gpu"},
+			{Validator: "test_zone_exists", Inputs: inputs("drava"), Module: "other"}})
+
+		// attributed to a module that does not skip it
+		bp.Validators = nil
+		bp.Groups[0].Modules[0].SkipValidators = []string{"test_gpu_available"}
+		c.Assert(bp.addModuleValidators(), IsNil)
+		c.Check(bp.Validators, DeepEquals, []Validator{
+			{Validator: "test_zone_exists", Inputs: inputs("tisza"), Module: "gpu"},
+			{Validator: "test_zone_exists", Inputs: inputs("drava"), Module: "other"},
+			{Validator: "test_gpu_available", Inputs: inputs("drava"), Module: "other"}})
+	}
+
+	{ // unknown requirement
+		bad := tMod("bad").requires("fast_network").build()
+		bp := Blueprint{Groups: []Group{{Name: "g", Modules: []Module{bad}}}}
+		err := bp.addModuleValidators()
+		c.Check(err, ErrorMatches, `.*module "bad": unknown requirement "fast_network", expected one of \[disk_types gpu_zone .*`)
+		var ce CodedError
+		c.Check(errors.As(err, &ce), Equals, true)
+		c.Check(ce.Code, Equals, CodeInvalidModuleValidator)
+	}
+}
+
+func (s *zeroSuite) TestModuleValidatorsRoundTrip(c *C) {
+	vm := tMod("vm").
+		inputs("zone").
+		set("zone", "tisza").
+		requires("zone").
+		build()
+	bp := Blueprint{
+		BlueprintName: "trip",
+		Vars: NewDict(map[string]cty.Value{
+			"deployment_name": cty.StringVal("trip"),
+			"project_id":      cty.StringVal("prj"),
+			"zone":            cty.StringVal("danube")}),
+		Groups: []Group{{Name: "g", Modules: []Module{vm}}}}
+	c.Assert(bp.Expand(), IsNil)
+	c.Assert(bp.Validators, HasLen, 1)
+	c.Check(bp.Validators[0].Module, Equals, ModuleID("vm"))
+
+	// expanded blueprint is read again, e.g. by `ghpc create expanded.yaml`
+	path := filepath.Join(c.MkDir(), "expanded.yaml")
+	c.Assert(bp.Export(path), IsNil)
+	read, _, err := NewBlueprint(path)
+	c.Assert(err, IsNil)
+	c.Check(read.Validators, HasLen, 1)
+	c.Check(read.Validators[0].Module, Equals, ModuleID("vm"))
+
+	c.Assert(read.Expand(), IsNil)
+	c.Check(read.Validators, HasLen, 1) // not added again
+	c.Check(read.Validators[0].Module, Equals, ModuleID("vm"))
+}
+
+func (s *zeroSuite) TestValidatorModules(c *C) {
+	vm := tMod("vm").
+		inputs("zone").
+		requires("zone").
+		validator("test_apis_enabled", "{}").
+		build()
+	bp := Blueprint{Groups: []Group{{Name: "g", Modules: []Module{vm}}}}
+
+	{ // declared or required by the module
+		bp := bp
+		bp.Validators = []Validator{
+			{Validator: "test_apis_enabled", Module: "vm"},
+			{Validator: "test_zone_exists", Module: "vm"},
+			{Validator: "test_zone_in_region"}}
+		c.Check(validateValidatorModules(bp), IsNil)
+	}
+
+	{ // module does not exist
+		bp := bp
+		bp.Validators = []Validator{{Validator: "test_apis_enabled", Module: "ghost"}}
+		err := validateValidatorModules(bp)
+		c.Check(err, ErrorMatches, `.*unknown module id: "ghost"`)
+		var ce CodedError
+		c.Check(errors.As(err, &ce), Equals, true)
+		c.Check(ce.Code, Equals, CodeInvalidValidatorModule)
+	}
+
+	{ // attribution to a module that does not declare the validator is rejected
+		bp := bp
+		bp.Validators = []Validator{
+			{Validator: "test_apis_enabled", Module: "vm"},
+			{Validator: "test_project_exists", Module: "vm"}}
+		err := bp.addModuleValidators()
+		c.Check(err, ErrorMatches, `.*module "vm" neither declares nor requires validator "test_project_exists"`)
+		var be BpError
+		c.Assert(errors.As(err, &be), Equals, true)
+		c.Check(be.Path.String(), Equals, "validators[1].module")
+	}
+}
+
+func (s *zeroSuite) TestProvenance(c *C) {
+	{ // blueprint values are not marked
+		_, ok := ProvenanceOf(cty.StringVal("pink"))
+		c.Check(ok, Equals, false)
+		c.Check(describeProvenance(cty.StringVal("pink")), Equals, "")
+	}
+
+	{ // deployment variable
+		v := WithProvenance(GlobalRef("zone").AsValue(), Provenance{Origin: OriginVar, Source: "zone"})
+		p, ok := ProvenanceOf(v)
+		c.Check(ok, Equals, true)
+		c.Check(p, DeepEquals, Provenance{Origin: OriginVar, Source: "zone"})
+		c.Check(describeProvenance(v), Equals, ` (set by deployment variable "zone")`)
+
+		e, is := IsExpressionValue(v) // still an expression
+		c.Check(is, Equals, true)
+		c.Check(e, DeepEquals, GlobalRef("zone").AsExpression())
+	}
+
+	{ // use
+		v := AsProductOfModuleUse(ModuleRef("net", "id").AsValue(), "net", "fs")
+		p, ok := ProvenanceOf(v)
+		c.Check(ok, Equals, true)
+		c.Check(p, DeepEquals, Provenance{Origin: OriginUse, Source: "fs,net"})
+		c.Check(p.String(), Equals, "use of modules fs, net")
+	}
+
+	{ // error message names the origin
+		bp := Blueprint{Vars: NewDict(map[string]cty.Value{"size": cty.StringVal("big")})}
+		v := WithProvenance(GlobalRef("size").AsValue(), Provenance{Origin: OriginVar, Source: "size"})
+		err := checkInputValueMatchesType(v, modulereader.VarInfo{Name: "size", Type: cty.Number}, bp)
+		c.Check(err, ErrorMatches, `unsuitable value for "size" \(set by deployment variable "size"\): .*`)
+	}
+}
+
+func (s *zeroSuite) TestExpandExternalResources(c *C) {
+	str := cty.StringVal
+	ext := func(id ModuleID, t string, settings map[string]cty.Value) ExternalResource {
+		return ExternalResource{ID: id, Type: t, Settings: NewDict(settings)}
+	}
+	vpc := ext("net", ExternalVpc, map[string]cty.Value{"network_name": str("shared"), "project_id": str("host")})
+	fs := ext("homefs", ExternalFilestore, map[string]cty.Value{
+		"name": str("home"), "location": str("us-central1-a"), "server_ip": str("10.0.0.2"),
+		"remote_mount": str("/nfsshare"), "local_mount": str("/home")})
+	sa := ext("compute_sa", ExternalServiceAccount, map[string]cty.Value{"email": str("compute@prj.iam.gserviceaccount.com")})
+	mk := func(rs ...ExternalResource) Blueprint {
+		return Blueprint{
+			ExternalResources: rs,
+			Vars:              NewDict(map[string]cty.Value{"project_id": str("prj")}),
+			Groups:            []Group{{Name: "g", Modules: []Module{{ID: "vm", Source: "modules/compute/vm-instance"}}}}}
+	}
+
+	{ // OK: modules and variable are added, expansion is idempotent
+		bp := mk(vpc, fs, sa)
+		c.Assert(bp.expandExternalResources(), IsNil)
+		c.Assert(bp.expandExternalResources(), IsNil)
+		c.Check(bp.Vars.Get("compute_sa"), DeepEquals, str("compute@prj.iam.gserviceaccount.com"))
+		mods := bp.Groups[0].Modules
+		c.Assert(mods, HasLen, 3)
+		c.Check(mods[0].ID, Equals, ModuleID("vm"))
+		c.Check(mods[1], DeepEquals, Module{ID: "net", Source: "modules/network/pre-existing-vpc", Kind: TerraformKind,
+			Settings: NewDict(map[string]cty.Value{"network_name": str("shared"), "project_id": str("host")})})
+		c.Check(mods[2], DeepEquals, Module{ID: "homefs", Source: "modules/file-system/pre-existing-network-storage", Kind: TerraformKind,
+			Settings: NewDict(map[string]cty.Value{"server_ip": str("10.0.0.2"), "remote_mount": str("/nfsshare"),
+				"local_mount": str("/home"), "fs_type": str("nfs")})})
+	}
+
+	{ // OK: modules are added to the first group without packer modules
+		bp := mk(vpc)
+		img := Group{Name: "img", Modules: []Module{{ID: "image", Source: "./packer/image", Kind: PackerKind}}}
+		bp.Groups = append([]Group{img}, bp.Groups...)
+		c.Assert(bp.expandExternalResources(), IsNil)
+		c.Check(bp.Groups[0].Modules, HasLen, 1)
+		c.Check(bp.Groups[1].Modules[1].ID, Equals, ModuleID("net"))
+
+		// no group is split, so the lookup precedes modules of the group in deployment
+		c.Assert(bp.SplitPackerGroups(), IsNil)
+		c.Check(bp.Groups, HasLen, 2)
+	}
+
+	{ // FAIL: unknown type, missing and unknown settings, malformed email
+		bp := mk(ext("x", "bucket", nil))
+		c.Check(bp.expandExternalResources(), ErrorMatches, `(?s).*unknown type "bucket" of external resource "x".*`)
+		bp = mk(ext("net", ExternalVpc, map[string]cty.Value{"network": str("shared")}))
+		err := bp.expandExternalResources()
+		c.Check(err, ErrorMatches, `(?s).*requires setting "network_name".*`)
+		c.Check(err, ErrorMatches, `(?s).*unknown setting "network" of external resource "net".*`)
+		bp = mk(ext("sa", ExternalServiceAccount, map[string]cty.Value{"email": str("compute")}))
+		c.Check(bp.expandExternalResources(), ErrorMatches, `(?s).*invalid service account email "compute".*`)
+	}
+
+	{ // FAIL: duplicate IDs, IDs used by module and variable
+		bp := mk(vpc, vpc)
+		c.Check(bp.expandExternalResources(), ErrorMatches, `(?s).*"net" used more than once.*`)
+		bp = mk(ext("vm", ExternalVpc, map[string]cty.Value{"network_name": str("n")}))
+		c.Check(bp.expandExternalResources(), ErrorMatches, `(?s).*module "vm" is already defined.*`)
+		bp = mk(ext("project_id", ExternalServiceAccount, sa.Settings.Items()))
+		c.Check(bp.expandExternalResources(), ErrorMatches, `(?s).*deployment variable "project_id" is already defined.*`)
+	}
+}
+
+func (s *zeroSuite) TestExpandLoginPool(c *C) {
+	str := cty.StringVal
+	modulereader.SetModuleInfo("./login/net", TerraformKind.String(), modulereader.ModuleInfo{
+		Outputs: []modulereader.OutputInfo{{Name: "subnetwork_self_link"}}})
+	modulereader.SetModuleInfo("./login/fs", TerraformKind.String(), modulereader.ModuleInfo{
+		Outputs: []modulereader.OutputInfo{{Name: "network_storage"}}})
+	mk := func(lp LoginPool) Blueprint {
+		return Blueprint{
+			LoginPool: &lp,
+			Groups: []Group{
+				{Name: "net", Modules: []Module{{ID: "net", Source: "./login/net"}}},
+				{Name: "g", Modules: []Module{{ID: "fs", Source: "./login/fs"}}}}}
+	}
+
+	{ // OK: modules are appended to the group, expansion is idempotent
+		bp := mk(LoginPool{
+			Group:        "g",
+			Count:        3,
+			Use:          ModuleIDs{"net", "fs"},
+			Settings:     NewDict(map[string]cty.Value{"zone": str("us-central1-b"), "tags": cty.TupleVal([]cty.Value{str("login")})}),
+			LoadBalancer: NewDict(map[string]cty.Value{"dns_zone_name": str("hpc"), "dns_record_name": str("login.hpc.internal.")}),
+		})
+		c.Assert(bp.expandLoginPool(), IsNil)
+		c.Assert(bp.expandLoginPool(), IsNil)
+		c.Check(bp.Groups[0].Modules, HasLen, 1)
+		mods := bp.Groups[1].Modules
+		c.Assert(mods, HasLen, 3)
+		c.Check(mods[1], DeepEquals, Module{ID: "login", Source: "modules/compute/vm-instance", Kind: TerraformKind,
+			Use: ModuleIDs{"net", "fs"},
+			Settings: NewDict(map[string]cty.Value{
+				"zone":           str("us-central1-b"),
+				"tags":           cty.TupleVal([]cty.Value{str("login")}),
+				"instance_count": cty.NumberIntVal(3)})})
+		c.Check(mods[2], DeepEquals, Module{ID: "login_lb", Source: "community/modules/network/login-load-balancer", Kind: TerraformKind,
+			Use: ModuleIDs{"net"},
+			Settings: NewDict(map[string]cty.Value{
+				"dns_zone_name":       str("hpc"),
+				"dns_record_name":     str("login.hpc.internal."),
+				"instance_self_links": ModuleRef("login", "self_link").AsValue(),
+				"zone":                str("us-central1-b"),
+				"target_tags":         cty.TupleVal([]cty.Value{str("login")}),
+				"name_prefix":         str("login")})})
+	}
+
+	{ // OK: no login pool, first group by default
+		bp := mk(LoginPool{})
+		bp.LoginPool = nil
+		c.Check(bp.expandLoginPool(), IsNil)
+		c.Check(bp.Groups[0].Modules, HasLen, 1)
+
+		bp = mk(LoginPool{ID: "ssh", Count: 2})
+		c.Assert(bp.expandLoginPool(), IsNil)
+		c.Check(bp.Groups[0].Modules, HasLen, 3)
+		c.Check(bp.Groups[0].Modules[2].ID, Equals, ModuleID("ssh_lb"))
+	}
+
+	{ // FAIL: count, group, derived settings, DNS record, IDs in use
+		bp := mk(LoginPool{Group: "nope", Settings: NewDict(map[string]cty.Value{"instance_count": cty.NumberIntVal(2)})})
+		err := bp.expandLoginPool()
+		c.Check(err, ErrorMatches, `(?s).*count of at least 1, got 0.*`)
+		c.Check(err, ErrorMatches, `(?s).*deployment group "nope" that does not exist.*`)
+		c.Check(err, ErrorMatches, `(?s).*instance_count can not be set.*`)
+
+		bp = mk(LoginPool{Count: 2, LoadBalancer: NewDict(map[string]cty.Value{
+			"dns_zone_name": str("hpc"), "subnetwork_self_link": str("s")})})
+		err = bp.expandLoginPool()
+		c.Check(err, ErrorMatches, `(?s).*requires dns_record_name.*`)
+		c.Check(err, ErrorMatches, `(?s).*"subnetwork_self_link" of the load balancer is set by login_pool.*`)
+
+		bp = mk(LoginPool{ID: "fs", Count: 2})
+		c.Check(bp.expandLoginPool(), ErrorMatches, `(?s).*module "fs" is already defined.*`)
+	}
+
+	{ // OK: used modules with invalid sources are left to validation of groups
+		bp := mk(LoginPool{Count: 1, Use: ModuleIDs{"net", "vpc"}})
+		bp.Groups[0].Modules = append(bp.Groups[0].Modules, Module{ID: "vpc", Source: "./login/vcp"})
+		c.Assert(bp.expandLoginPool(), IsNil)
+		c.Check(bp.Groups[0].Modules[3].Use, DeepEquals, ModuleIDs{"net"})
+	}
+}
+
+func (s *zeroSuite) TestDeprecations(c *C) {
+	renamedValidators["test_old_name"] = "test_new_name"
+	defer delete(renamedValidators, "test_old_name")
+
+	bp := Blueprint{
+		Validators: []Validator{{Validator: "test_old_name"}, {Validator: "test_new_name"}},
+		Groups: []Group{{Name: "g", Modules: []Module{
+			{ID: "job", Source: "./community/modules/scheduler/cloud-batch-job", SkipValidators: []string{"test_old_name"}},
+			{ID: "pool", Source: "community/modules/compute/gke-node-pool", Settings: NewDict(map[string]cty.Value{
+				"total_min_nodes": cty.NumberIntVal(1), "total_max_nodes": cty.NumberIntVal(10),
+				"autoscaling_total_max_nodes": cty.NumberIntVal(10)})},
+		}}}}
+	g := Root.Groups.At(0)
+	c.Check(bp.Deprecations(), DeepEquals, []Deprecation{
+		{Kind: DeprecatedValidator, Path: Root.Validators.At(0).Validator, Old: "test_old_name", New: "test_new_name"},
+		{Kind: DeprecatedValidator, Path: g.Modules.At(0).SkipValidators.At(0), Old: "test_old_name", New: "test_new_name"},
+		{Kind: DeprecatedModule, Path: g.Modules.At(0).Source,
+			Old: "community/modules/scheduler/cloud-batch-job", New: "modules/scheduler/batch-job-template"},
+		{Kind: DeprecatedSetting, Path: g.Modules.At(1).Settings.Dot("total_max_nodes"),
+			Old: "total_max_nodes", New: "autoscaling_total_max_nodes", Conflict: true},
+		{Kind: DeprecatedSetting, Path: g.Modules.At(1).Settings.Dot("total_min_nodes"),
+			Old: "total_min_nodes", New: "autoscaling_total_min_nodes"},
+	})
+	c.Check(Blueprint{}.Deprecations(), HasLen, 0)
+}
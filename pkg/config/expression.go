@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
@@ -69,11 +70,11 @@ func (r Reference) String() string {
 // and transforms it to "terraform namespace" (e.g. `var.zone` or `module.homefs.mount`).
 func bpTraversalToTerraform(t hcl.Traversal) (hcl.Traversal, error) {
 	if len(t) < 2 {
-		return nil, fmt.Errorf(expectedVarFormat)
+		return nil, fmt.Errorf("incomplete reference %q, expected %s", t.RootName(), expectedVarFormat)
 	}
 	_, ok := t[1].(hcl.TraverseAttr)
 	if !ok {
-		return nil, fmt.Errorf(expectedVarFormat)
+		return nil, fmt.Errorf("malformed reference to %q, expected %s", t.RootName(), expectedVarFormat)
 	}
 
 	if t.RootName() == "vars" {
@@ -139,11 +140,17 @@ func TraversalToReference(t hcl.Traversal) (Reference, error) {
 		}
 		n, err := getAttrName(2)
 		if err != nil {
-			return Reference{}, fmt.Errorf("expected third component of module var reference to be a variable name, got %w", err)
+			return Reference{}, HintError{
+				Hint: fmt.Sprintf("reference a module output as module.%s.OUTPUT", m),
+				Err:  fmt.Errorf("expected third component of module var reference to be an output name, got %w", err)}
 		}
 		return ModuleRef(ModuleID(m), n), nil
 	default:
-		return Reference{}, fmt.Errorf("unexpected first component of reference: %#v", root)
+		err := fmt.Errorf("unexpected first component of reference: %#v", root)
+		if h := hintSpelling(root, []string{"var", "module"}, err); h != err {
+			return Reference{}, h
+		}
+		return Reference{}, HintError{Hint: "only deployment variables (var.NAME) and module outputs (module.ID.OUTPUT) can be referenced", Err: err}
 	}
 }
 
@@ -217,15 +224,17 @@ type BaseExpression struct {
 	rs   []Reference
 }
 
+var unknownFunctionRe = regexp.MustCompile(`There is no function named "(\w+)"`)
+
 func handleEvalErr(diag hcl.Diagnostics) error {
 	if !diag.HasErrors() {
 		return nil
 	}
 	err := diag.Errs()[0]
-	if match := regexp.MustCompile(`There is no function named "(\w+)"`).FindStringSubmatch(err.Error()); match != nil {
+	if match := unknownFunctionRe.FindStringSubmatch(err.Error()); match != nil {
 		sf := strings.Join(maps.Keys(availableFunctions), ", ")
 		return HintError{
-			Err:  fmt.Errorf("unsupported function %q", match[1]),
+			Err:  CodedError{CodeMalformedExpression, fmt.Errorf("unsupported function %q", match[1])},
 			Hint: fmt.Sprintf("this context only supports following functions: %v", sf)}
 	}
 	return err
@@ -270,7 +279,9 @@ func (e BaseExpression) key() expressionKey {
 func (e BaseExpression) AsValue() cty.Value {
 	k := e.key()
 	// we don't care if it overrides as expressions are identical
+	globalExpressionsMu.Lock()
 	globalExpressions[k] = e
+	globalExpressionsMu.Unlock()
 	return cty.DynamicVal.Mark(k)
 }
 
@@ -288,7 +299,10 @@ type expressionKey struct {
 	k string
 }
 
-var globalExpressions = map[expressionKey]Expression{}
+var (
+	globalExpressions   = map[expressionKey]Expression{}
+	globalExpressionsMu sync.RWMutex // expressions are created and evaluated concurrently
+)
 
 // IsExpressionValue checks if the value is result of `Expression.AsValue()`.
 // Returns original expression and result of check.
@@ -298,7 +312,9 @@ func IsExpressionValue(v cty.Value) (Expression, bool) {
 	if !ok {
 		return nil, false
 	}
+	globalExpressionsMu.RLock()
 	expr, stored := globalExpressions[key]
+	globalExpressionsMu.RUnlock()
 	if !stored { // shouldn't happen
 		panic(fmt.Errorf("Expression isn't present in global state, while being referenced by value %#v", v))
 	}
@@ -387,7 +403,8 @@ func (bp *Blueprint) functions() map[string]function.Function {
 	}
 }
 
-func valueReferences(v cty.Value) map[Reference]cty.Path {
+// ValueReferences returns references used in expressions within the value, mapped to their paths
+func ValueReferences(v cty.Value) map[Reference]cty.Path {
 	r := map[Reference]cty.Path{}
 	cty.Walk(v, func(p cty.Path, v cty.Value) (bool, error) {
 		if e, is := IsExpressionValue(v); is {
@@ -410,6 +427,8 @@ func (bp *Blueprint) evalCtx() (*hcl.EvalContext, error) {
 		Functions: bp.functions()}, nil
 }
 
+// Eval evaluates expressions in the value. It is safe to call concurrently on copies
+// of the blueprint, evaluation of `ghpc_stage` records staged files shared by copies.
 func (bp *Blueprint) Eval(v cty.Value) (cty.Value, error) {
 	ctx, err := bp.evalCtx()
 	if err != nil {
@@ -435,6 +454,11 @@ func eval(v cty.Value, ctx *hcl.EvalContext) (cty.Value, error) {
 	})
 }
 
+var (
+	trailingBackslashesRe = regexp.MustCompile(`\\*$`) // to count number of backslashes at the end
+	newLineRe             = regexp.MustCompile("\r?\n")
+)
+
 type pToken struct {
 	s string
 	e Expression
@@ -445,7 +469,6 @@ func tokenizeBpLine(s string) ([]pToken, error) {
 	toks := []pToken{}
 	var found string
 	var err error
-	bsRe := regexp.MustCompile(`\\*$`) // to count number of backslashes at the end
 
 	for len(s) > 0 {
 		i := strings.Index(s, "$(")
@@ -454,10 +477,10 @@ func tokenizeBpLine(s string) ([]pToken, error) {
 			break                                    // and terminate
 		}
 		p := s[:i]
-		s = s[i+2:]                       // split as `p$(s`
-		bs := len(bsRe.FindString(p))     // get number of trailing backslashes
-		p = p[:len(p)-bs+bs/2]            // keep (smaller) half of backslashes
-		toks = append(toks, pToken{s: p}) // add tokens up to "$("
+		s = s[i+2:]                                    // split as `p$(s`
+		bs := len(trailingBackslashesRe.FindString(p)) // get number of trailing backslashes
+		p = p[:len(p)-bs+bs/2]                         // keep (smaller) half of backslashes
+		toks = append(toks, pToken{s: p})              // add tokens up to "$("
 
 		if bs%2 == 1 { // escaped $(
 			toks = append(toks, pToken{s: "$("}) // add "$("
@@ -482,6 +505,9 @@ func tokenizeBpLine(s string) ([]pToken, error) {
 // therefore start position of the string in YAML document and indentation.
 // Render error in a scope of a single line of the string instead.
 func prepareParseHclErr(err error, line string, offset int) error {
+	if h, is := err.(HintError); is { // render hint after the pointed line
+		return fmt.Errorf("%s\n  Hint: %s", prepareParseHclErr(h.Err, line, offset), h.Hint)
+	}
 	var col int
 	if diag, is := err.(hcl.Diagnostics); is {
 		derr, _ := diag.Errs()[0].(*hcl.Diagnostic)
@@ -497,7 +523,7 @@ func tokenizeBpString(s string) ([]pToken, error) {
 	toks := []pToken{}
 
 	// can't use `bufio.NewScanner` as it doesn't preserve trailing empty lines
-	lines := regexp.MustCompile("\r?\n").Split(s, -1)
+	lines := newLineRe.Split(s, -1)
 	for _, line := range lines {
 		if len(toks) > 0 {
 			toks = append(toks, pToken{s: "\n"})
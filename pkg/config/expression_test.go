@@ -72,6 +72,45 @@ func TestTraversalToReference(t *testing.T) {
 	}
 }
 
+func TestTraversalToReferenceHint(t *testing.T) {
+	type test struct {
+		expr string
+		hint string
+	}
+	tests := []test{
+		{"vars.green", `did you mean "var"?`},
+		{"modul.pink.lime", `did you mean "module"?`},
+		{"local.place", "only deployment variables (var.NAME) and module outputs (module.ID.OUTPUT) can be referenced"},
+		{"module.pink", "reference a module output as module.pink.OUTPUT"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.expr, func(t *testing.T) {
+			e, diag := hclsyntax.ParseExpression([]byte(tc.expr), "", hcl.Pos{})
+			if diag.HasErrors() {
+				t.Fatal(diag)
+			}
+			_, err := TraversalToReference(e.(*hclsyntax.ScopeTraversalExpr).AsTraversal())
+			h, ok := err.(HintError)
+			if !ok {
+				t.Fatalf("expected HintError, got %#v", err)
+			}
+			if h.Hint != tc.hint {
+				t.Errorf("got hint %q, want %q", h.Hint, tc.hint)
+			}
+		})
+	}
+}
+
+func TestParseYamlStringHclError(t *testing.T) {
+	_, err := parseYamlString("((var.green +))")
+	want := "Missing expression; Expected the start of an expression, but found the end of the file.\n" +
+		"  ((var.green +))\n" +
+		"               ^"
+	if err == nil || err.Error() != want {
+		t.Errorf("got error %q, want %q", err, want)
+	}
+}
+
 func TestParseBpLit(t *testing.T) {
 	type test struct {
 		input string
@@ -0,0 +1,185 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// ExternalResource is a pre-existing resource used by the deployment. It is looked
+// up rather than created: expansion turns it into a module that reads the resource,
+// or into a deployment variable, and validators check that the resource exists.
+type ExternalResource struct {
+	ID       ModuleID
+	Type     string
+	Settings Dict `yaml:"settings,omitempty"`
+}
+
+// externalType describes how resources of a type are expanded
+type externalType struct {
+	// module looking up the resource, empty if the resource is a deployment variable
+	source   string
+	required []string
+	optional []string
+	// settings only used to validate the resource, not passed to the module
+	lookupOnly []string
+}
+
+// Types of external resources
+const (
+	ExternalVpc            = "vpc"
+	ExternalFilestore      = "filestore"
+	ExternalServiceAccount = "service_account"
+)
+
+var externalTypes = map[string]externalType{
+	ExternalVpc: {
+		source:   "modules/network/pre-existing-vpc",
+		required: []string{"network_name"},
+		optional: []string{"subnetwork_name", "project_id", "region"},
+	},
+	ExternalFilestore: {
+		source:     "modules/file-system/pre-existing-network-storage",
+		required:   []string{"name", "location", "server_ip", "remote_mount", "local_mount"},
+		optional:   []string{"project_id", "mount_options"},
+		lookupOnly: []string{"name", "location", "project_id"},
+	},
+	ExternalServiceAccount: {
+		required: []string{"email"},
+		optional: []string{"project_id"},
+	},
+}
+
+func externalError(err error) error {
+	return CodedError{CodeInvalidExternal, err}
+}
+
+// checkExternalResource checks type and settings of the external resource
+func checkExternalResource(p externalPath, r ExternalResource) error {
+	errs := Errors{}
+	if r.ID == "" {
+		errs.At(p.ID, externalError(errors.New("an external resource id cannot be empty")))
+	}
+	t, ok := externalTypes[r.Type]
+	if !ok {
+		types := maps.Keys(externalTypes)
+		slices.Sort(types)
+		return errs.At(p.Type, HintError{
+			Hint: fmt.Sprintf("use one of: %s", strings.Join(types, ", ")),
+			Err:  externalError(fmt.Errorf("unknown type %q of external resource %q", r.Type, r.ID))}).OrNil()
+	}
+	for _, k := range t.required {
+		if !r.Settings.Has(k) {
+			errs.At(p.Settings, externalError(fmt.Errorf("external resource %q of type %s requires setting %q", r.ID, r.Type, k)))
+		}
+	}
+	for _, k := range sortedKeys(r.Settings.Items()) {
+		if !slices.Contains(t.required, k) && !slices.Contains(t.optional, k) {
+			errs.At(p.Settings.Dot(k), HintError{
+				Hint: fmt.Sprintf("settings of type %s are: %s", r.Type, strings.Join(append(slices.Clone(t.required), t.optional...), ", ")),
+				Err:  externalError(fmt.Errorf("unknown setting %q of external resource %q", k, r.ID))})
+		}
+	}
+	if r.Type == ExternalServiceAccount && r.Settings.Has("email") {
+		email := r.Settings.Get("email")
+		if !email.IsNull() && email.Type() == cty.String && !serviceAccountEmailRe.MatchString(email.AsString()) {
+			errs.At(p.Settings.Dot("email"), externalError(fmt.Errorf("invalid service account email %q", email.AsString())))
+		}
+	}
+	return errs.OrNil()
+}
+
+// externalModule returns the module looking up the external resource
+func externalModule(r ExternalResource) Module {
+	t := externalTypes[r.Type]
+	settings := Dict{}
+	for k, v := range r.Settings.Items() {
+		if !slices.Contains(t.lookupOnly, k) {
+			settings = settings.With(k, v)
+		}
+	}
+	if r.Type == ExternalFilestore {
+		settings = settings.With("fs_type", cty.StringVal("nfs"))
+	}
+	return Module{ID: r.ID, Source: t.source, Kind: TerraformKind, Settings: settings}
+}
+
+// externalGroup returns index of the deployment group that modules looking up external
+// resources are added to: the first group without standalone (e.g. packer) modules, so
+// that splitting of groups does not place the lookups after them, or the first group
+// if there is no such group.
+func (bp Blueprint) externalGroup() int {
+	gi := slices.IndexFunc(bp.Groups, func(g Group) bool {
+		return !slices.ContainsFunc(g.Modules, func(m Module) bool { return m.Kind.IsStandalone() })
+	})
+	return max(gi, 0)
+}
+
+// expandExternalResources appends modules looking up external resources to a Terraform
+// deployment group and sets deployment variables of external service accounts.
+// Expansion is idempotent, resources that are already expanded are skipped.
+func (bp *Blueprint) expandExternalResources() error {
+	errs := Errors{}
+	seen := map[ModuleID]bool{}
+	for i, r := range bp.ExternalResources {
+		p := Root.External.At(i)
+		if seen[r.ID] {
+			errs.At(p.ID, externalError(fmt.Errorf("external resource IDs must be unique, %q used more than once", r.ID)))
+		}
+		seen[r.ID] = true
+		errs.Add(checkExternalResource(p, r))
+	}
+	if errs.Any() {
+		return errs
+	}
+
+	added := []Module{}
+	for i, r := range bp.ExternalResources {
+		p := Root.External.At(i)
+		t := externalTypes[r.Type]
+		if t.source == "" { // deployment variable
+			v := r.Settings.Get("email")
+			if bp.Vars.Has(string(r.ID)) && !bp.Vars.Get(string(r.ID)).RawEquals(v) {
+				errs.At(p.ID, externalError(fmt.Errorf("deployment variable %q is already defined, use a different ID of the external resource", r.ID)))
+				continue
+			}
+			bp.Vars = bp.Vars.With(string(r.ID), v)
+			continue
+		}
+
+		if m, err := bp.Module(r.ID); err == nil {
+			if m.Source != t.source {
+				errs.At(p.ID, externalError(fmt.Errorf("module %q is already defined, use a different ID of the external resource", r.ID)))
+			}
+			continue // already expanded
+		}
+		added = append(added, externalModule(r))
+	}
+	if errs.Any() {
+		return errs
+	}
+	if len(added) > 0 && len(bp.Groups) > 0 {
+		// append rather than prepend to keep paths of modules of the blueprint intact
+		gi := bp.externalGroup()
+		bp.Groups[gi].Modules = append(bp.Groups[gi].Modules, added...)
+	}
+	return nil
+}
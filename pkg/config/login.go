@@ -0,0 +1,180 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"hpc-toolkit/pkg/modulereader"
+
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	loginPoolInstanceSource = "modules/compute/vm-instance"
+	loginPoolBalancerSource = "community/modules/network/login-load-balancer"
+	defaultLoginPoolID      = ModuleID("login")
+)
+
+// LoginPool is a pool of login nodes behind an internal TCP load balancer. It is
+// expanded into a vm-instance module creating the nodes and a login-load-balancer
+// module creating the instance group, health check and forwarding rule.
+type LoginPool struct {
+	// ID of the module creating the nodes, the load balancer module is "<ID>_lb"
+	ID    ModuleID  `yaml:"id,omitempty"`
+	Group GroupName `yaml:"group,omitempty"`
+	Count int       `yaml:"count"`
+	Use   ModuleIDs `yaml:"use,omitempty"`
+	// settings of the vm-instance module
+	Settings Dict `yaml:"settings,omitempty"`
+	// settings of the login-load-balancer module
+	LoadBalancer Dict `yaml:"load_balancer,omitempty"`
+}
+
+func loginPoolError(err error) error {
+	return CodedError{CodeInvalidLoginPool, err}
+}
+
+// balancerID returns ID of the load balancer module of the pool
+func (lp LoginPool) balancerID() ModuleID {
+	return lp.ID + "_lb"
+}
+
+// checkLoginPool checks the login pool against modules and groups of the blueprint
+func (bp Blueprint) checkLoginPool(lp LoginPool) error {
+	p := Root.LoginPool
+	errs := Errors{}
+	if lp.Count < 1 {
+		errs.At(p.Count, loginPoolError(fmt.Errorf("login_pool requires a count of at least 1, got %d", lp.Count)))
+	}
+	if lp.Group != "" && !slices.ContainsFunc(bp.Groups, func(g Group) bool { return g.Name == lp.Group }) {
+		errs.At(p.Group, loginPoolError(fmt.Errorf("login_pool refers to deployment group %q that does not exist", lp.Group)))
+	}
+	if lp.Settings.Has("instance_count") {
+		errs.At(p.Settings.Dot("instance_count"), HintError{
+			Hint: "set `count` of login_pool instead",
+			Err:  loginPoolError(errors.New("login_pool sets the number of login nodes, instance_count can not be set"))})
+	}
+	for _, k := range []string{"instance_self_links", "subnetwork_self_link"} {
+		if lp.LoadBalancer.Has(k) {
+			errs.At(p.LoadBalancer.Dot(k), loginPoolError(fmt.Errorf("%q of the load balancer is set by login_pool", k)))
+		}
+	}
+	if lp.LoadBalancer.Has("dns_zone_name") && !lp.LoadBalancer.Has("dns_record_name") {
+		errs.At(p.LoadBalancer, HintError{
+			Hint: "set `dns_record_name` to the fully qualified name of the record, e.g. `login.hpc.internal.`",
+			Err:  loginPoolError(errors.New("login_pool with dns_zone_name requires dns_record_name"))})
+	}
+	for _, id := range []ModuleID{lp.ID, lp.balancerID()} {
+		if m, err := bp.Module(id); err == nil && m.Source != loginPoolInstanceSource && m.Source != loginPoolBalancerSource {
+			errs.At(p.ID, HintError{
+				Hint: "set `id` of login_pool to an ID that is not used by a module",
+				Err:  loginPoolError(fmt.Errorf("module %q is already defined", id))})
+		}
+	}
+	return errs.OrNil()
+}
+
+// subnetworkModules returns modules of ids that output subnetwork_self_link
+func (bp Blueprint) subnetworkModules(ids ModuleIDs) ModuleIDs {
+	res := ModuleIDs{}
+	for _, id := range ids {
+		m, err := bp.Module(id)
+		if err != nil { // reported as unknown module used by the login nodes
+			continue
+		}
+		kind := m.Kind
+		if kind == UnknownKind { // kinds are not set before expansion of groups
+			kind = TerraformKind
+		}
+		// sources are not validated yet, invalid ones are reported with expansion of groups
+		info, err := modulereader.GetModuleInfo(m.Source, kind.String())
+		if err != nil {
+			continue
+		}
+		if slices.ContainsFunc(info.Outputs, func(o modulereader.OutputInfo) bool { return o.Name == "subnetwork_self_link" }) {
+			res = append(res, id)
+		}
+	}
+	return res
+}
+
+// loginPoolModules returns the module creating the login nodes and the module
+// balancing SSH connections between them
+func (bp Blueprint) loginPoolModules(lp LoginPool) (Module, Module) {
+	nodes := Module{
+		ID:       lp.ID,
+		Source:   loginPoolInstanceSource,
+		Kind:     TerraformKind,
+		Use:      slices.Clone(lp.Use),
+		Settings: lp.Settings.With("instance_count", cty.NumberIntVal(int64(lp.Count))),
+	}
+
+	lb := lp.LoadBalancer.With("instance_self_links", ModuleRef(lp.ID, "self_link").AsValue())
+	// the load balancer must be in the zone and region of the nodes
+	for _, k := range []string{"zone", "region"} {
+		if lp.Settings.Has(k) && !lb.Has(k) {
+			lb = lb.With(k, lp.Settings.Get(k))
+		}
+	}
+	// only allow health checks to the login nodes if they are tagged
+	if lp.Settings.Has("tags") && !lb.Has("target_tags") {
+		lb = lb.With("target_tags", lp.Settings.Get("tags"))
+	}
+	if !lb.Has("name_prefix") {
+		lb = lb.With("name_prefix", cty.StringVal(string(lp.ID)))
+	}
+	balancer := Module{
+		ID:     lp.balancerID(),
+		Source: loginPoolBalancerSource,
+		Kind:   TerraformKind,
+		// the load balancer only takes subnetwork_self_link of network modules
+		Use:      bp.subnetworkModules(lp.Use),
+		Settings: lb,
+	}
+	return nodes, balancer
+}
+
+// expandLoginPool appends modules of the login pool to its deployment group, the
+// first group by default. Expansion is idempotent, modules that are already
+// expanded are kept.
+func (bp *Blueprint) expandLoginPool() error {
+	if bp.LoginPool == nil {
+		return nil
+	}
+	lp := *bp.LoginPool
+	if lp.ID == "" {
+		lp.ID = defaultLoginPoolID
+	}
+	if err := bp.checkLoginPool(lp); err != nil {
+		return err
+	}
+	if _, err := bp.Module(lp.ID); err == nil {
+		return nil // already expanded
+	}
+	if len(bp.Groups) == 0 {
+		return nil
+	}
+
+	gi := 0
+	if lp.Group != "" {
+		gi = slices.IndexFunc(bp.Groups, func(g Group) bool { return g.Name == lp.Group })
+	}
+	nodes, balancer := bp.loginPoolModules(lp)
+	// append rather than prepend to keep paths of modules of the blueprint intact
+	bp.Groups[gi].Modules = append(bp.Groups[gi].Modules, nodes, balancer)
+	return nil
+}
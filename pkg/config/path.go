@@ -17,6 +17,7 @@ package config
 import (
 	"fmt"
 	"reflect"
+	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/zclconf/go-cty/cty"
@@ -99,30 +100,54 @@ func ctyStepToString(s cty.PathStep) (string, error) {
 	}
 }
 
+// pathFields are fields of a path type, cached by initPath to avoid costly
+// reflection on every path construction
+type pathFields struct {
+	piece    []int // index of basePath.InternalPiece
+	prev     []int // index of basePath.InternalPrev
+	children []int // indices of fields tagged with `path`
+	tags     []string
+}
+
+var pathFieldsCache sync.Map // reflect.Type -> pathFields
+
+func getPathFields(ty reflect.Type) pathFields {
+	if pf, ok := pathFieldsCache.Load(ty); ok {
+		return pf.(pathFields)
+	}
+	piece, okPiece := ty.FieldByName("InternalPiece")
+	prev, okPrev := ty.FieldByName("InternalPrev")
+	if !okPiece || !okPrev {
+		panic(fmt.Sprintf("%s does not embed basePath", ty.Name()))
+	}
+	pf := pathFields{piece: piece.Index, prev: prev.Index}
+	for i := 0; i < ty.NumField(); i++ {
+		if tag, ok := ty.Field(i).Tag.Lookup("path"); ok {
+			pf.children = append(pf.children, i)
+			pf.tags = append(pf.tags, tag)
+		}
+	}
+	pathFieldsCache.Store(ty, pf)
+	return pf
+}
+
 // initPath walks through all child paths of p and initializes them. E.g.
 // initPath(&Root, nil, "") will trigger
 // -> initPath(&Root.BlueprintName, &Root, "blueprint_name")
 func initPath(p any, prev any, piece string) {
 	r := reflect.Indirect(reflect.ValueOf(p))
-	ty := reflect.TypeOf(p).Elem()
-	if !r.FieldByName("InternalPiece").IsValid() || !r.FieldByName("InternalPrev").IsValid() {
-		panic(fmt.Sprintf("%s does not embed basePath", ty.Name()))
-	}
+	pf := getPathFields(reflect.TypeOf(p).Elem())
 	if _, ok := prev.(Path); prev != nil && !ok {
 		panic(fmt.Sprintf("prev is not a Path: %#v", p))
 	}
 
-	r.FieldByName("InternalPiece").SetString(piece)
+	r.FieldByIndex(pf.piece).SetString(piece)
 	if prev != nil {
-		r.FieldByName("InternalPrev").Set(reflect.ValueOf(prev))
+		r.FieldByIndex(pf.prev).Set(reflect.ValueOf(prev))
 	}
 
-	for i := 0; i < ty.NumField(); i++ {
-		tag, ok := ty.Field(i).Tag.Lookup("path")
-		if !ok {
-			continue
-		}
-		initPath(r.Field(i).Addr().Interface(), p, tag)
+	for i, f := range pf.children {
+		initPath(r.Field(f).Addr().Interface(), p, pf.tags[i])
 	}
 }
 
@@ -135,6 +160,47 @@ type rootPath struct {
 	Vars            dictPath                    `path:"vars"`
 	Groups          arrayPath[groupPath]        `path:"deployment_groups"`
 	Backend         backendPath                 `path:"terraform_backend_defaults"`
+	LabelPolicy     labelPolicyPath             `path:"label_policy"`
+	Encryption      tfvarsEncryptionPath        `path:"tfvars_encryption"`
+	Credentials     credentialsPolicyPath       `path:"credentials_policy"`
+	External        arrayPath[externalPath]     `path:"external_resources"`
+	LoginPool       loginPoolPath               `path:"login_pool"`
+}
+
+type loginPoolPath struct {
+	basePath
+	ID           basePath            `path:".id"`
+	Group        basePath            `path:".group"`
+	Count        basePath            `path:".count"`
+	Use          arrayPath[basePath] `path:".use"`
+	Settings     dictPath            `path:".settings"`
+	LoadBalancer dictPath            `path:".load_balancer"`
+}
+
+type externalPath struct {
+	basePath
+	ID       basePath `path:".id"`
+	Type     basePath `path:".type"`
+	Settings dictPath `path:".settings"`
+}
+
+type labelPolicyPath struct {
+	basePath
+	ExcludeModules arrayPath[basePath] `path:".exclude_modules"`
+	ExcludeKeys    arrayPath[basePath] `path:".exclude_keys"`
+	RequiredKeys   arrayPath[basePath] `path:".required_keys"`
+}
+
+type tfvarsEncryptionPath struct {
+	basePath
+	KmsKey basePath            `path:".kms_key"`
+	Keys   arrayPath[basePath] `path:".keys"`
+}
+
+type credentialsPolicyPath struct {
+	basePath
+	ForbidKeys  basePath `path:".forbid_service_account_keys"`
+	Impersonate basePath `path:".impersonate_service_account"`
 }
 
 type validatorCfgPath struct {
@@ -142,6 +208,11 @@ type validatorCfgPath struct {
 	Validator basePath `path:".validator"`
 	Inputs    dictPath `path:".inputs"`
 	Skip      basePath `path:".skip"`
+	Command   basePath `path:".command"`
+	Severity  basePath `path:".severity"`
+	Timeout   basePath `path:".timeout"`
+	Retries   basePath `path:".retries"`
+	Module    basePath `path:".module"`
 }
 
 type dictPath struct{ mapPath[ctyPath] }
@@ -167,6 +238,10 @@ type ModulePath struct {
 	Use      arrayPath[basePath]   `path:".use"`
 	Outputs  arrayPath[outputPath] `path:".outputs"`
 	Settings dictPath              `path:".settings"`
+
+	SkipValidators    arrayPath[basePath] `path:".skip_validators"`
+	SkipJustification basePath            `path:".skip_justification"`
+	DestroyProtection basePath            `path:".destroy_protection"`
 }
 
 type outputPath struct {
@@ -72,6 +72,11 @@ func TestPath(t *testing.T) {
 		{r.Backend.Type, "terraform_backend_defaults.type"},
 		{r.Backend.Configuration, "terraform_backend_defaults.configuration"},
 		{r.Backend.Configuration.Dot("goo"), "terraform_backend_defaults.configuration.goo"},
+
+		{r.LabelPolicy, "label_policy"},
+		{r.LabelPolicy.ExcludeModules.At(1), "label_policy.exclude_modules[1]"},
+		{r.LabelPolicy.ExcludeKeys.At(0), "label_policy.exclude_keys[0]"},
+		{r.LabelPolicy.RequiredKeys.At(3), "label_policy.required_keys[3]"},
 	}
 	for _, tc := range tests {
 		t.Run(tc.want, func(t *testing.T) {
@@ -0,0 +1,90 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Origin describes how a module setting got its value.
+type Origin string
+
+const (
+	// OriginBlueprint is a value set explicitly in the blueprint
+	OriginBlueprint Origin = "blueprint"
+	// OriginVar is a reference to a deployment variable of the same name, added by expansion
+	OriginVar Origin = "var"
+	// OriginDefault is a value computed by expansion, e.g. merged labels or injected module ID
+	OriginDefault Origin = "default"
+	// OriginUse is a reference to outputs of modules listed in `use`
+	OriginUse Origin = "use"
+)
+
+// Provenance is a "mark" applied to values added to module settings during expansion,
+// it records where the value came from.
+// Only expression values are marked, literal values set by the blueprint stay unmarked,
+// as marked values can't be used by most of cty operations without unmarking.
+type Provenance struct {
+	Origin Origin
+	// Source is the name of deployment variable for OriginVar
+	// or comma-separated IDs of used modules for OriginUse
+	Source string
+}
+
+// WithProvenance marks the value with its provenance.
+func WithProvenance(v cty.Value, p Provenance) cty.Value {
+	return v.Mark(p)
+}
+
+// ProvenanceOf returns provenance of the value, returns false if the value
+// was not added by expansion, e.g. it is set in the blueprint or by the module default.
+func ProvenanceOf(v cty.Value) (Provenance, bool) {
+	if mods := IsProductOfModuleUse(v); len(mods) > 0 {
+		s := make([]string, len(mods))
+		for i, m := range mods {
+			s[i] = string(m)
+		}
+		return Provenance{Origin: OriginUse, Source: strings.Join(s, ",")}, true
+	}
+	return HasMark[Provenance](v)
+}
+
+func (p Provenance) String() string {
+	switch p.Origin {
+	case OriginVar:
+		return fmt.Sprintf("deployment variable %q", p.Source)
+	case OriginUse:
+		if strings.Contains(p.Source, ",") {
+			return fmt.Sprintf("use of modules %s", strings.ReplaceAll(p.Source, ",", ", "))
+		}
+		return fmt.Sprintf("use of module %q", p.Source)
+	case OriginDefault:
+		return "toolkit default"
+	}
+	return string(p.Origin)
+}
+
+// describeProvenance returns suffix for error messages about the value,
+// it is empty if the value was not added by expansion.
+func describeProvenance(v cty.Value) string {
+	p, ok := ProvenanceOf(v)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf(" (set by %s)", p)
+}
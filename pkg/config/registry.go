@@ -0,0 +1,73 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// ValidatorFunc checks the blueprint, inputs of the validator have references resolved
+type ValidatorFunc func(bp Blueprint, inputs Dict) error
+
+// RegisteredValidator is a validator added by a program embedding the toolkit
+type RegisteredValidator struct {
+	Func ValidatorFunc
+	// RequiredInputs are checked before the validator runs, other inputs are rejected
+	RequiredInputs []string
+}
+
+var (
+	registryMu           sync.Mutex
+	registeredValidators = map[string]RegisteredValidator{}
+)
+
+// RegisterValidator adds a validator that blueprints can use by name, like a built-in
+// validator. It is meant to be called by programs embedding the toolkit, before
+// blueprints are validated, e.g. in `init` functions. Names of built-in validators can
+// not be registered, validation fails if they are.
+func RegisterValidator(name string, fn ValidatorFunc, requiredInputs []string) error {
+	if name == "" {
+		return errors.New("name of a validator can not be empty")
+	}
+	if fn == nil {
+		return fmt.Errorf("function of validator %q can not be nil", name)
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registeredValidators[name]; ok {
+		return fmt.Errorf("validator %q is already registered", name)
+	}
+	registeredValidators[name] = RegisteredValidator{Func: fn, RequiredInputs: slices.Clone(requiredInputs)}
+	return nil
+}
+
+// RegisteredValidators returns validators added with RegisterValidator by name
+func RegisteredValidators() map[string]RegisteredValidator {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	return maps.Clone(registeredValidators)
+}
+
+// UnregisterValidator removes a validator added with RegisterValidator
+func UnregisterValidator(name string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	delete(registeredValidators, name)
+}
@@ -0,0 +1,36 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *zeroSuite) TestRegisterValidator(c *C) {
+	defer UnregisterValidator("test_org_naming")
+	fn := func(Blueprint, Dict) error { return nil }
+
+	c.Check(RegisterValidator("test_org_naming", fn, []string{"prefix"}), IsNil)
+	c.Check(RegisterValidator("test_org_naming", fn, nil), ErrorMatches, `.*already registered`)
+	c.Check(RegisterValidator("", fn, nil), NotNil)
+	c.Check(RegisterValidator("test_nil", nil, nil), NotNil)
+
+	got := RegisteredValidators()
+	c.Check(got, HasLen, 1)
+	c.Check(got["test_org_naming"].RequiredInputs, DeepEquals, []string{"prefix"})
+
+	UnregisterValidator("test_org_naming")
+	c.Check(RegisteredValidators(), HasLen, 0)
+}
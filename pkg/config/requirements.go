@@ -0,0 +1,132 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// requirementValidator is a validator that checks a requirement declared by modules.
+// Each input is set to the module setting of the same name or, if the module does
+// not set it, to the deployment variable.
+type requirementValidator struct {
+	validator string
+	inputs    []string
+	// allModules is set for validators that check every module in its own zone,
+	// using inputs only for modules that do not set them
+	allModules bool
+	// byDefault is set for validators that run by default with deployment variables
+	// as inputs, others only run if some module requires them
+	byDefault bool
+}
+
+// requirements maps requirements that modules can declare in their metadata to
+// validators that check them
+var requirements = map[string][]requirementValidator{
+	"project":      {{"test_project_exists", []string{"project_id"}, false, true}},
+	"region":       {{"test_region_exists", []string{"project_id", "region"}, false, true}},
+	"zone":         {{"test_zone_exists", []string{"project_id", "zone"}, false, true}},
+	"machine_type": {{"test_machine_type_exists", []string{"project_id", "zone"}, true, false}},
+	"gpu_zone": {
+		{"test_zone_exists", []string{"project_id", "zone"}, false, true},
+		{"test_gpu_available", []string{"project_id", "zone"}, true, false}},
+	"disk_types":  {{"test_disk_types_available", []string{"project_id", "zone"}, true, false}},
+	"reservation": {{"test_reservation_exists", []string{"project_id", "zone"}, true, false}},
+	"spot":        {{"test_spot_availability", []string{"project_id", "zone"}, true, false}},
+	"quota":       {{"test_quota_sufficient", []string{"project_id", "region", "zone"}, true, true}},
+	"image": {
+		{"test_image_exists", []string{"project_id"}, true, false},
+		{"test_image_fresh", []string{"project_id"}, true, false}},
+	"network": {
+		{"test_network_exists", []string{"project_id"}, true, false},
+		{"test_subnetwork_exists", []string{"project_id"}, true, false},
+		{"test_private_google_access", []string{"project_id"}, true, false}},
+	"org_policies": {{"test_org_policies", []string{"project_id"}, true, false}},
+	"ssh_keys":     {{"test_ssh_keys", []string{"project_id"}, true, false}},
+	"packer":       {{"test_packer_build", []string{"project_id"}, true, false}},
+}
+
+// Requirements returns names of requirements that modules can declare, sorted
+func Requirements() []string {
+	names := maps.Keys(requirements)
+	slices.Sort(names)
+	return names
+}
+
+// allModulesValidator returns true if the validator checks all modules, so that one
+// instance of it checks requirements of all modules
+func allModulesValidator(name string) bool {
+	for _, rvs := range requirements {
+		for _, rv := range rvs {
+			if rv.validator == name {
+				return rv.allModules
+			}
+		}
+	}
+	return false
+}
+
+// requirementValidators builds validators checking the requirement declared by the module.
+// Validators are omitted if they are run by default with the same inputs, or if their
+// inputs are set neither by the module nor by deployment variables.
+// Validators that check all modules are omitted if the module skips them, so that
+// they are attributed to a module that does not skip them. Unless run by default,
+// they use deployment variables as inputs where available.
+func (bp Blueprint) requirementValidators(m Module, req string) ([]Validator, error) {
+	rvs, ok := requirements[req]
+	if !ok {
+		return nil, fmt.Errorf("unknown requirement %q, expected one of %v", req, Requirements())
+	}
+	vs := []Validator{}
+	for _, rv := range rvs {
+		inputs, set, byVars, hasVars := Dict{}, true, true, true
+		for _, name := range rv.inputs {
+			hasVars = hasVars && bp.Vars.Has(name)
+			preferVars := rv.allModules && !rv.byDefault && bp.Vars.Has(name)
+			switch {
+			case m.Settings.Has(name) && !preferVars:
+				v := m.Settings.Get(name)
+				byVars = byVars && isGlobalRef(v, name)
+				inputs = inputs.With(name, v)
+			case bp.Vars.Has(name):
+				inputs = inputs.With(name, GlobalRef(name).AsValue())
+			default:
+				set = false
+			}
+		}
+		switch {
+		case !set:
+			continue // not checkable
+		case rv.allModules && m.SkipsValidator(rv.validator):
+			continue // attributed to another module
+		case rv.byDefault && (byVars || (rv.allModules && hasVars)):
+			continue // checked by default validators
+		default:
+			vs = append(vs, Validator{Validator: rv.validator, Inputs: inputs, Module: m.ID})
+		}
+	}
+	return vs, nil
+}
+
+// isGlobalRef returns true if the value is a reference to the deployment variable
+func isGlobalRef(v cty.Value, name string) bool {
+	e, is := IsExpressionValue(v)
+	return is && string(e.Tokenize().Bytes()) == string(GlobalRef(name).AsExpression().Tokenize().Bytes())
+}
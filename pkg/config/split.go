@@ -0,0 +1,150 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"slices"
+)
+
+// needsSplit tests whether group mixes standalone (e.g. packer) modules with other modules
+func (g Group) needsSplit() bool {
+	return len(g.Modules) > 1 && slices.ContainsFunc(g.Modules, func(m Module) bool { return m.Kind.IsStandalone() })
+}
+
+// splitGroup partitions modules of the group, preserving their order, into
+// groups of consecutive Terraform modules and groups of a single standalone module.
+// The first part keeps the name of the group, following parts are named
+// after the group and their first module.
+// Returns an error if module refers to a module that would be placed in a later part.
+func splitGroup(gp groupPath, g Group) ([]Group, error) {
+	parts := []Group{}
+	partOf := map[ModuleID]int{}
+	for _, m := range g.Modules {
+		last := len(parts) - 1
+		if last < 0 || m.Kind.IsStandalone() || parts[last].Modules[0].Kind.IsStandalone() {
+			name := g.Name
+			if last >= 0 {
+				name = GroupName(fmt.Sprintf("%s-%s", g.Name, m.ID))
+			}
+			parts = append(parts, Group{Name: name})
+			last++
+		}
+		parts[last].Modules = append(parts[last].Modules, m)
+		partOf[m.ID] = last
+	}
+
+	errs := Errors{}
+	for ip, part := range parts {
+		if ip > 0 {
+			if err := part.Name.Validate(); err != nil {
+				errs.At(gp.Name, fmt.Errorf("can not split group %q with standalone modules: %w", g.Name, err))
+			}
+		}
+	}
+	for im, m := range g.Modules {
+		mp := gp.Modules.At(im)
+		used := map[ModuleID]bool{}
+		for _, u := range m.Use {
+			used[u] = true
+		}
+		for r := range ValueReferences(m.Settings.AsObject()) {
+			if !r.GlobalVar {
+				used[r.Module] = true
+			}
+		}
+		for u := range used {
+			iu, ok := partOf[u]
+			if !ok || iu <= partOf[m.ID] {
+				continue
+			}
+			// find the first standalone module that separates modules
+			ip := slices.IndexFunc(parts[partOf[m.ID]:iu+1], func(p Group) bool { return p.Modules[0].Kind.IsStandalone() })
+			sep := parts[partOf[m.ID]+ip].Modules[0]
+			err := fmt.Errorf("module %q uses module %q, which is declared after %s module %q in group %q",
+				m.ID, u, sep.Kind, sep.ID, g.Name)
+			if sep.ID == m.ID {
+				err = fmt.Errorf("%s module %q uses module %q, which is declared after it in group %q", m.Kind, m.ID, u, g.Name)
+			}
+			errs.At(mp, HintError{
+				Err:  err,
+				Hint: fmt.Sprintf("declare %q before %q or move it to an earlier deployment group", u, sep.ID)})
+		}
+	}
+	return parts, errs.OrNil()
+}
+
+// checkSplittable verifies that all groups mixing standalone modules with other modules
+// can be split and names of resulting groups do not collide with other groups.
+func checkSplittable(bp Blueprint) error {
+	names := map[GroupName]bool{}
+	for _, g := range bp.Groups {
+		names[g.Name] = true
+	}
+
+	errs := Errors{}
+	for ig, g := range bp.Groups {
+		if !g.needsSplit() {
+			continue
+		}
+		gp := Root.Groups.At(ig)
+		parts, err := splitGroup(gp, g)
+		if err != nil {
+			errs.Add(err)
+			continue
+		}
+		for _, part := range parts[1:] {
+			if names[part.Name] {
+				errs.At(gp.Name, HintError{
+					Err:  fmt.Errorf("can not split group %q with standalone modules, group %q already exists", g.Name, part.Name),
+					Hint: "rename the group or move packer and ansible modules to their own deployment groups"})
+			}
+			names[part.Name] = true
+		}
+	}
+	return errs.OrNil()
+}
+
+// SplitPackerGroups splits every group that mixes standalone (packer or ansible) modules with other modules
+// into groups that can be deployed in order, see splitGroup.
+// Should be performed on expanded and validated blueprint, as paths of split modules change.
+func (bp *Blueprint) SplitPackerGroups() error {
+	groups := []Group{}
+	for ig, g := range bp.Groups {
+		if !g.needsSplit() {
+			groups = append(groups, g)
+			continue
+		}
+		parts, err := splitGroup(Root.Groups.At(ig), g)
+		if err != nil {
+			return err
+		}
+		for ip := range parts {
+			p := &parts[ip]
+			if p.Kind().IsStandalone() {
+				continue // standalone groups have no Terraform state
+			}
+			p.TerraformBackend = g.TerraformBackend
+			if ip > 0 && p.TerraformBackend.Type == "gcs" && bp.isDefaultGcsPrefix(g) {
+				p.TerraformBackend.Configuration = p.TerraformBackend.Configuration.With(
+					"prefix", bp.defaultGcsPrefix(p.Name).AsValue())
+			}
+		}
+		groups = append(groups, parts...)
+	}
+	bp.Groups = groups
+	bp.populateOutputs()
+	return nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"github.com/zclconf/go-cty/cty"
+	. "gopkg.in/check.v1"
+)
+
+func (s *zeroSuite) TestSplitPackerGroups(c *C) {
+	net := tMod("net").outputs("subnet").build()
+	img := tMod("img").packer().inputs("subnet").set("subnet", ModuleRef("net", "subnet")).build()
+	vm := tMod("vm").build()
+	bp := Blueprint{
+		BlueprintName: "zoo",
+		TerraformBackendDefaults: TerraformBackend{Type: "gcs", Configuration: NewDict(map[string]cty.Value{
+			"bucket": cty.StringVal("bkt")})},
+		Groups: []Group{
+			{Name: "pre", Modules: []Module{tMod("pre").build()}},
+			{Name: "main", Modules: []Module{net, img, vm}}}}
+	bp.expandBackend(&bp.Groups[1])
+	c.Assert(bp.SplitPackerGroups(), IsNil)
+
+	names := []GroupName{}
+	for _, g := range bp.Groups {
+		names = append(names, g.Name)
+	}
+	c.Check(names, DeepEquals, []GroupName{"pre", "main", "main-img", "main-vm"})
+
+	c.Check(bp.Groups[1].TerraformBackend.Configuration.Get("prefix"), DeepEquals, bp.defaultGcsPrefix("main").AsValue())
+	c.Check(bp.Groups[2].TerraformBackend, DeepEquals, TerraformBackend{})
+	c.Check(bp.Groups[3].TerraformBackend.Configuration.Get("prefix"), DeepEquals, bp.defaultGcsPrefix("main-vm").AsValue())
+	c.Check(bp.Groups[3].TerraformBackend.Configuration.Get("bucket"), DeepEquals, cty.StringVal("bkt"))
+
+	// output of net is exported for img in the later group
+	c.Check(bp.Groups[1].Modules[0].Outputs[0].Name, Equals, "subnet")
+	c.Check(bp.Groups[1].Modules[0].Outputs[0].Sensitive, Equals, true)
+}
+
+func (s *zeroSuite) TestCheckSplittable(c *C) {
+	img := tMod("img").packer().build()
+	{ // name collision
+		bp := Blueprint{Groups: []Group{
+			{Name: "main", Modules: []Module{tMod("vm").build(), img}},
+			{Name: "main-img", Modules: []Module{tMod("other").build()}}}}
+		c.Check(checkSplittable(bp), ErrorMatches, `.*group "main-img" already exists.*`)
+	}
+	{ // packer module uses a later module
+		pkr := tMod("pkr").packer().set("x", ModuleRef("net", "y")).build()
+		bp := Blueprint{Groups: []Group{
+			{Name: "main", Modules: []Module{pkr, tMod("net").build()}}}}
+		c.Check(checkSplittable(bp), ErrorMatches, `.*packer module "pkr" uses module "net", which is declared after it.*`)
+	}
+	{ // two packer modules
+		bp := Blueprint{Groups: []Group{
+			{Name: "main", Modules: []Module{img, tMod("img2").packer().build()}}}}
+		c.Check(checkSplittable(bp), IsNil)
+	}
+	{ // module uses a module declared after ansible module
+		pb := tMod("pb").build()
+		pb.Kind = AnsibleKind
+		vm := tMod("vm").set("x", ModuleRef("net", "y")).build()
+		bp := Blueprint{Groups: []Group{
+			{Name: "main", Modules: []Module{vm, pb, tMod("net").build()}}}}
+		c.Check(checkSplittable(bp), ErrorMatches, `.*module "vm" uses module "net", which is declared after ansible module "pb".*`)
+	}
+}
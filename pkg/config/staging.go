@@ -18,6 +18,7 @@ import (
 	"crypto/md5"
 	"fmt"
 	"path/filepath"
+	"sync"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
@@ -30,12 +31,18 @@ import (
 // Relative path from deployment group to the staging directory
 const StagingDir = "../.ghpc/staged"
 
+// stagedFilesMu guards stagedFiles of all blueprints, copies of the blueprint
+// share stagedFiles and `ghpc_stage` records files during evaluation.
+var stagedFilesMu sync.Mutex
+
 type StagedFile struct {
 	AbsSrc string // absolute path
 	RelDst string // relative (to deployment group folder) path
 }
 
 func (bp Blueprint) StagedFiles() []StagedFile {
+	stagedFilesMu.Lock()
+	defer stagedFilesMu.Unlock()
 	if len(bp.stagedFiles) == 0 {
 		return nil
 	}
@@ -66,6 +73,8 @@ func (bp *Blueprint) makeGhpcStageImpl() func(src string) string {
 		}
 		dst := filepath.Join(StagingDir, fmt.Sprintf("%s_%s", name, hash))
 
+		stagedFilesMu.Lock()
+		defer stagedFilesMu.Unlock()
 		if bp.stagedFiles == nil {
 			bp.stagedFiles = map[string]string{}
 		}
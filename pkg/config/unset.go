@@ -0,0 +1,125 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+
+	"hpc-toolkit/pkg/modulereader"
+
+	"github.com/zclconf/go-cty/cty"
+	ctyJson "github.com/zclconf/go-cty/cty/json"
+	"golang.org/x/exp/slices"
+)
+
+// UnsetValue is a deployment variable with null value or a required module input
+// that is not set. Both can be set with a deployment variable of the same name.
+type UnsetValue struct {
+	Name        string
+	Type        cty.Type  // cty.NilType if type is not known
+	Description string    // empty if not known
+	Default     cty.Value // cty.NilVal if there is no suggested value
+	Modules     []ModuleID
+}
+
+// UnsetValues returns deployment variables with null values and required inputs
+// of modules that are not set explicitly, by a deployment variable of the same name
+// or by a module in `use`. Should be called on a blueprint before Expand.
+// Variables are sorted by name, module inputs follow the order of modules.
+func (bp Blueprint) UnsetValues() []UnsetValue {
+	res := []UnsetValue{}
+	keys := bp.Vars.Keys()
+	slices.Sort(keys)
+	for _, k := range keys {
+		if bp.Vars.Get(k).IsNull() {
+			res = append(res, UnsetValue{Name: k, Type: cty.NilType})
+		}
+	}
+
+	infos := map[ModuleID]modulereader.ModuleInfo{}
+	bp.WalkModulesSafe(func(_ ModulePath, m *Module) {
+		kind := m.Kind
+		if kind == UnknownKind {
+			kind = TerraformKind // see addKindToModules
+		}
+		// modules that can not be read are reported by Expand, skip them
+		if mi, err := modulereader.GetModuleInfo(m.Source, kind.String()); err == nil {
+			infos[m.ID] = mi
+		}
+	})
+
+	// suggest default of the same input of the first module that has one
+	defaults := map[string]cty.Value{}
+	bp.WalkModulesSafe(func(_ ModulePath, m *Module) {
+		for _, in := range infos[m.ID].Inputs {
+			if _, ok := defaults[in.Name]; in.Required || in.Default == nil || ok {
+				continue
+			}
+			if v, err := goToCty(in.Default); err == nil {
+				defaults[in.Name] = v
+			}
+		}
+	})
+
+	bp.WalkModulesSafe(func(_ ModulePath, m *Module) {
+		mi, ok := infos[m.ID]
+		if !ok {
+			return
+		}
+		for _, in := range mi.Inputs {
+			if !in.Required || m.Settings.Has(in.Name) || bp.Vars.Has(in.Name) ||
+				in.Name == mi.Metadata.Ghpc.InjectModuleId || usedOutput(m.Use, in.Name, infos) {
+				continue
+			}
+			i := slices.IndexFunc(res, func(u UnsetValue) bool { return u.Name == in.Name })
+			if i < 0 {
+				def := cty.NilVal
+				if d, ok := defaults[in.Name]; ok {
+					def = d
+				}
+				res = append(res, UnsetValue{Name: in.Name, Type: in.Type, Description: in.Description, Default: def})
+				i = len(res) - 1
+			}
+			res[i].Modules = append(res[i].Modules, m.ID)
+		}
+	})
+	return res
+}
+
+// usedOutput tests whether any of used modules has an output that would set the input, see useModule
+func usedOutput(use ModuleIDs, input string, infos map[ModuleID]modulereader.ModuleInfo) bool {
+	if input == "labels" {
+		return false
+	}
+	for _, u := range use {
+		if slices.ContainsFunc(infos[u].Outputs, func(o modulereader.OutputInfo) bool { return o.Name == input }) {
+			return true
+		}
+	}
+	return false
+}
+
+// goToCty converts default value of module input, as read by modulereader, to cty.Value
+func goToCty(v interface{}) (cty.Value, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	ty, err := ctyJson.ImpliedType(b)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	return ctyJson.Unmarshal(b, ty)
+}
@@ -17,8 +17,11 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 	"regexp"
+	"slices"
 	"strings"
 
 	"hpc-toolkit/pkg/modulereader"
@@ -28,7 +31,8 @@ import (
 	"golang.org/x/exp/maps"
 )
 
-const maxLabels = 64
+// MaxLabels is the maximal number of labels of a GCP resource
+const MaxLabels = 64
 
 func validateGlobalLabels(bp Blueprint) error {
 	if !bp.Vars.Has("labels") {
@@ -44,22 +48,22 @@ func validateGlobalLabels(bp Blueprint) error {
 
 	if !ty.IsObjectType() && !ty.IsMapType() {
 		return BpError{
-			p, errors.New("vars.labels must be a map of strings")} // skip further validation
+			p, CodedError{CodeInvalidLabels, errors.New("vars.labels must be a map of strings")}} // skip further validation
 	}
 	errs := Errors{}
-	if labels.LengthInt() > maxLabels {
+	if labels.LengthInt() > MaxLabels {
 		// GCP resources cannot have more than 64 labels, so enforce this upper bound here
 		// to do some early validation. Modules may add more labels, leading to potential
 		// deployment failures.
-		errs.At(p, errors.New("vars.labels cannot have more than 64 labels"))
+		errs.At(p, CodedError{CodeInvalidLabels, errors.New("vars.labels cannot have more than 64 labels")})
 	}
 
 	for k, v := range labels.AsValueMap() {
 		vp := p.Cty(cty.Path{}.IndexString(k))
 		// Check that label names are valid
-		if !isValidLabelName(k) {
+		if !IsValidLabelName(k) {
 			errs.At(vp, HintError{
-				Err:  fmt.Errorf("invalid label name %q", k),
+				Err:  CodedError{CodeInvalidLabels, fmt.Errorf("invalid label name %q", k)},
 				Hint: "name must begin with a lowercase letter, can only contain lowercase letters, numeric characters, underscores and dashes, and must be between 1 and 63 characters long"})
 		}
 
@@ -68,19 +72,179 @@ func validateGlobalLabels(bp Blueprint) error {
 		}
 
 		if v.Type() != cty.String {
-			errs.At(vp, errors.New("vars.labels must be a map of strings"))
+			errs.At(vp, CodedError{CodeInvalidLabels, errors.New("vars.labels must be a map of strings")})
 			continue
 		}
 		s := v.AsString()
 
 		// Check that label values are valid
-		if !isValidLabelValue(s) {
-			errs.At(vp, errors.Errorf("%s: '%s: %s'", errMsgLabelValueReqs, k, s))
+		if !IsValidLabelValue(s) {
+			errs.At(vp, CodedError{CodeInvalidLabels, errors.Errorf("%s: '%s: %s'", errMsgLabelValueReqs, k, s)})
 		}
 	}
 	return errs.OrNil()
 }
 
+// kmsKeyRe matches resource names of Cloud KMS keys
+var kmsKeyRe = regexp.MustCompile(`^projects/[^/]+/locations/[^/]+/keyRings/[^/]+/cryptoKeys/[^/]+$`)
+
+// validateTfvarsEncryption checks that the KMS key is well formed and that
+// encrypted keys are deployment variables
+func validateTfvarsEncryption(bp Blueprint) error {
+	enc := bp.TfvarsEncryption
+	ep := Root.Encryption
+	errs := Errors{}
+	if !enc.Enabled() {
+		if len(enc.Keys) > 0 {
+			errs.At(ep.KmsKey, CodedError{CodeInvalidEncryption, errors.New("kms_key must be set to encrypt variables")})
+		}
+		return errs.OrNil()
+	}
+	if !kmsKeyRe.MatchString(enc.KmsKey) {
+		errs.At(ep.KmsKey, HintError{
+			Hint: "use a key name of form projects/PROJECT/locations/LOCATION/keyRings/RING/cryptoKeys/KEY",
+			Err:  CodedError{CodeInvalidEncryption, fmt.Errorf("invalid Cloud KMS key name %q", enc.KmsKey)}})
+	}
+	for i, k := range enc.Keys {
+		if !bp.Vars.Has(k) {
+			errs.At(ep.Keys.At(i), CodedError{CodeInvalidEncryption, fmt.Errorf("%q is not a deployment variable", k)})
+		}
+	}
+	return errs.OrNil()
+}
+
+// serviceAccountKeySettings are settings of modules that pass credentials of a
+// service account to tools, e.g. `google_app_cred_path` of hybrid Slurm
+var serviceAccountKeySettings = []string{
+	"account_file", "credentials", "credentials_file", "google_app_cred_path",
+	"service_account_key", "service_account_key_file"}
+
+// keylessCredentialTypes are types of credential files that do not contain keys
+var keylessCredentialTypes = []string{"external_account", "impersonated_service_account"}
+
+var serviceAccountKeyRe = regexp.MustCompile(`"type"\s*:\s*"service_account"`)
+
+var serviceAccountEmailRe = regexp.MustCompile(`^[a-z][a-z0-9-]*@[a-z0-9.-]+\.gserviceaccount\.com$`)
+
+const keylessHint = "use `credentials_policy.impersonate_service_account`, the service account attached to the VM, " +
+	"or a Workload Identity Federation configuration created with `gcloud iam workload-identity-pools create-cred-config`"
+
+// isKeylessCredentialFile returns true if the file is a credential configuration without keys
+func isKeylessCredentialFile(path string) bool {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	var cred struct {
+		Type string `json:"type"`
+	}
+	return json.Unmarshal(b, &cred) == nil && slices.Contains(keylessCredentialTypes, cred.Type)
+}
+
+// checkServiceAccountKey returns an error if the value of the setting or variable passes a
+// service account key: its name expects a key file and it is not a keyless credential
+// configuration, or it contains a key itself
+func checkServiceAccountKey(bp Blueprint, name string, val cty.Value, what string) error {
+	v, ok := attemptEvalModuleInput(val, bp)
+	if !ok || v.IsNull() || !v.IsWhollyKnown() {
+		return nil
+	}
+	if slices.Contains(serviceAccountKeySettings, name) {
+		if v.Type() != cty.String || v.AsString() == "" || isKeylessCredentialFile(v.AsString()) {
+			return nil
+		}
+		return HintError{
+			Hint: keylessHint,
+			Err:  CodedError{CodeServiceAccountKey, fmt.Errorf("%s expects a service account key file, keys are forbidden by credentials_policy", what)}}
+	}
+	found := false
+	cty.Walk(v, func(_ cty.Path, e cty.Value) (bool, error) {
+		if !e.IsNull() && e.Type() == cty.String && serviceAccountKeyRe.MatchString(e.AsString()) {
+			found = true
+		}
+		return !found, nil
+	})
+	if !found {
+		return nil
+	}
+	return HintError{
+		Hint: keylessHint,
+		Err:  CodedError{CodeServiceAccountKey, fmt.Errorf("%s contains a service account key, keys are forbidden by credentials_policy", what)}}
+}
+
+// validateCredentialsPolicy checks the impersonated service account and, if service
+// account keys are forbidden, that no module setting or deployment variable passes a key
+func validateCredentialsPolicy(bp Blueprint) error {
+	cp := bp.CredentialsPolicy
+	pp := Root.Credentials
+	errs := Errors{}
+	if sa := cp.ImpersonateServiceAccount; sa != "" && !serviceAccountEmailRe.MatchString(sa) {
+		errs.At(pp.Impersonate, HintError{
+			Hint: "use an email of form NAME@PROJECT.iam.gserviceaccount.com",
+			Err:  CodedError{CodeServiceAccountKey, fmt.Errorf("invalid service account email %q", sa)}})
+	}
+	if !cp.ForbidServiceAccountKeys {
+		return errs.OrNil()
+	}
+	for _, k := range sortedKeys(bp.Vars.Items()) {
+		errs.At(Root.Vars.Dot(k), checkServiceAccountKey(bp, k, bp.Vars.Get(k), fmt.Sprintf("deployment variable %q", k)))
+	}
+	bp.WalkModulesSafe(func(p ModulePath, m *Module) {
+		for _, k := range sortedKeys(m.Settings.Items()) {
+			errs.At(p.Settings.Dot(k), checkServiceAccountKey(bp, k, m.Settings.Get(k), fmt.Sprintf("setting %q of module %q", k, m.ID)))
+		}
+	})
+	return errs.OrNil()
+}
+
+// validateLabelPolicy checks that label policy refers to existing modules and
+// that every labeled module carries all required label keys.
+func validateLabelPolicy(bp Blueprint) error {
+	lp := bp.LabelPolicy
+	pp := Root.LabelPolicy
+	errs := Errors{}
+	for i, id := range lp.ExcludeModules {
+		if _, err := bp.Module(id); err != nil {
+			errs.At(pp.ExcludeModules.At(i), err)
+		}
+	}
+	for i, k := range lp.ExcludeKeys {
+		if !IsValidLabelName(k) {
+			errs.At(pp.ExcludeKeys.At(i), CodedError{CodeInvalidLabels, fmt.Errorf("invalid label name %q", k)})
+		}
+	}
+	for i, k := range lp.RequiredKeys {
+		if slices.Contains(lp.ExcludeKeys, k) {
+			errs.At(pp.RequiredKeys.At(i), CodedError{CodeInvalidLabels, fmt.Errorf("label %q can not be both required and excluded", k)})
+		}
+	}
+	if errs.Any() || len(lp.RequiredKeys) == 0 {
+		return errs.OrNil()
+	}
+
+	bp.WalkModulesSafe(func(p ModulePath, m *Module) {
+		if lp.ExcludesModule(m.ID) || !m.Settings.Has("labels") {
+			return
+		}
+		v, ok := attemptEvalModuleInput(m.Settings.Get("labels"), bp)
+		if !ok || !v.IsWhollyKnown() || v.IsNull() {
+			return // can not inspect labels
+		}
+		if ty := v.Type(); !ty.IsObjectType() && !ty.IsMapType() {
+			return
+		}
+		labels := v.AsValueMap()
+		for _, k := range lp.RequiredKeys {
+			if _, ok := labels[k]; !ok {
+				errs.At(p.Settings.Dot("labels"), HintError{
+					Hint: "add it to vars.labels or to the module labels setting",
+					Err:  CodedError{CodeInvalidLabels, fmt.Errorf("module %q is missing required label %q", m.ID, k)}})
+			}
+		}
+	})
+	return errs.OrNil()
+}
+
 // validateVars checks the global variables for viable types
 func validateVars(bp Blueprint) error {
 	if _, err := varsTopologicalOrder(bp.Vars); err != nil {
@@ -94,7 +258,7 @@ func validateVars(bp Blueprint) error {
 	// Iterator over non evaluated variables, it's Ok if evaluated value is null
 	for key, val := range bp.Vars.Items() {
 		if val.IsNull() {
-			errs.At(Root.Vars.Dot(key), fmt.Errorf("deployment variable %q was not set", key))
+			errs.At(Root.Vars.Dot(key), CodedError{CodeVariableNotSet, fmt.Errorf("deployment variable %q was not set", key)})
 		}
 	}
 	return errs.OrNil()
@@ -113,7 +277,7 @@ func validateModule(p ModulePath, m Module, bp Blueprint) error {
 	}
 	info, err := modulereader.GetModuleInfo(m.Source, m.Kind.kind)
 	if err != nil {
-		return BpError{p.Source, err}
+		return BpError{p.Source, CodedError{CodeInvalidModuleSource, err}}
 	}
 
 	errs := Errors{}
@@ -121,7 +285,16 @@ func validateModule(p ModulePath, m Module, bp Blueprint) error {
 		errs.At(p.ID, EmptyModuleID)
 	}
 	if m.ID == "vars" { // invalid module ID
-		errs.At(p.ID, errors.New("module id cannot be 'vars'"))
+		errs.At(p.ID, CodedError{CodeInvalidModuleID, errors.New("module id cannot be 'vars'")})
+	}
+	if len(m.SkipValidators) > 0 && strings.TrimSpace(m.SkipJustification) == "" {
+		errs.At(p.SkipValidators, HintError{
+			Hint: "explain why validators do not apply to the module in `skip_justification`",
+			Err:  CodedError{CodeUnjustifiedSkip, fmt.Errorf("module %q skips validators without justification", m.ID)}})
+	}
+	if m.DestroyProtection && m.Kind != TerraformKind && m.Kind != HelmKind {
+		errs.At(p.DestroyProtection, CodedError{CodeInvalidProtection,
+			fmt.Errorf("destroy protection is only supported for Terraform and Helm modules, module %q is of kind %q", m.ID, m.Kind)})
 	}
 	return errs.
 		Add(validateSettings(p, m, info)).
@@ -138,7 +311,7 @@ func validateOutputs(p ModulePath, mod Module, info modulereader.ModuleInfo) err
 	// Ensure output exists in the underlying modules
 	for io, output := range mod.Outputs {
 		if _, ok := outputs[output.Name]; !ok {
-			err := fmt.Errorf("requested output %q was not found in the module %q", output.Name, mod.ID)
+			err := CodedError{CodeUnknownOutput, fmt.Errorf("requested output %q was not found in the module %q", output.Name, mod.ID)}
 			errs.At(p.Outputs.At(io), err)
 		}
 	}
@@ -150,6 +323,8 @@ type moduleVariables struct {
 	Outputs map[string]bool
 }
 
+var settingNameRe = regexp.MustCompile(`^[a-zA-Z-_][a-zA-Z0-9-_]*$`)
+
 func validateSettings(
 	p ModulePath,
 	mod Module,
@@ -175,13 +350,13 @@ func validateSettings(
 			continue // do not perform other validations
 		}
 		// Setting includes invalid characters
-		if !regexp.MustCompile(`^[a-zA-Z-_][a-zA-Z0-9-_]*$`).MatchString(k) {
+		if !settingNameRe.MatchString(k) {
 			errs.At(sp, ModuleSettingInvalidChar)
 			continue // do not perform other validations
 		}
 		// Setting not found
 		if _, ok := cVars.Inputs[k]; !ok {
-			err := hintSpelling(k, maps.Keys(cVars.Inputs), UnknownModuleSetting)
+			err := hintSpellingMany(k, maps.Keys(cVars.Inputs), UnknownModuleSetting)
 			errs.At(sp, err)
 			continue // do not perform other validations
 		}
@@ -94,6 +94,18 @@ func (s *zeroSuite) TestValidateSettings(c *C) {
 		c.Assert(err, IsNil)
 	}
 
+	{ // Fails: misspelled setting, suggest closest inputs
+		info.Inputs = []modulereader.VarInfo{{Name: "machine_type"}, {Name: "machine_types"}, {Name: "zone"}}
+		mod.Settings = NewDict(map[string]cty.Value{"machine_typ": testSettingValue})
+		err = validateSettings(path, mod, info)
+		c.Check(err, ErrorMatches, `.*did you mean one of "machine_type", "machine_types"\?`)
+	}
+
+	{ // Fails: misspelled setting, single suggestion
+		mod.Settings = NewDict(map[string]cty.Value{"zome": testSettingValue})
+		err = validateSettings(path, mod, info)
+		c.Check(err, ErrorMatches, `.*did you mean "zone"\?`)
+	}
 }
 
 func (s *zeroSuite) TestValidateModule(c *C) {
@@ -137,6 +149,23 @@ func (s *zeroSuite) TestValidateModule(c *C) {
 		modulereader.SetModuleInfo(mod.Source, mod.Kind.String(), modulereader.ModuleInfo{})
 		err := validateModule(p, mod, dummyBp)
 		c.Check(err, IsNil)
+
+		mod.SkipValidators = []string{"test_zone_in_region"}
+		err = validateModule(p, mod, dummyBp)
+		c.Check(ErrorCodeOf(err), Equals, CodeUnjustifiedSkip)
+
+		mod.SkipJustification = "zone of reservation is pinned"
+		c.Check(validateModule(p, mod, dummyBp), IsNil)
+
+		mod.DestroyProtection = true
+		c.Check(validateModule(p, mod, dummyBp), IsNil)
+	}
+
+	{ // Destroy protection of Packer module
+		mod := Module{ID: "image", Source: "green", Kind: PackerKind, DestroyProtection: true}
+		modulereader.SetModuleInfo(mod.Source, mod.Kind.String(), modulereader.ModuleInfo{})
+		err := validateModule(p, mod, dummyBp)
+		c.Check(ErrorCodeOf(err), Equals, CodeInvalidProtection)
 	}
 }
 
@@ -0,0 +1,68 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/hashicorp/go-version"
+	"gopkg.in/yaml.v3"
+)
+
+// ToolkitVersion is a version of the toolkit binary, it is compared against
+// `ghpc_version` constraint of the blueprint. The check is skipped if unset.
+var ToolkitVersion string
+
+var versionConstraintRe = regexp.MustCompile(`^\s*(>=|<=|!=|~>|>|<|=)`)
+
+// IsVersionConstraint tests whether `ghpc_version` value is a version constraint
+// (e.g. ">= 1.25"), as opposed to a version recorded in the expanded blueprint.
+func IsVersionConstraint(s string) bool {
+	return versionConstraintRe.MatchString(s)
+}
+
+// checkGhpcVersion returns an error if `ghpc_version` of the blueprint
+// is a constraint that is not satisfied by ToolkitVersion.
+// Only `ghpc_version` is decoded, so the check succeeds even if
+// the rest of blueprint uses features unknown to this version.
+func checkGhpcVersion(y []byte) error {
+	var bp struct {
+		GhpcVersion string `yaml:"ghpc_version"`
+	}
+	if err := yaml.Unmarshal(y, &bp); err != nil {
+		return nil // will be reported by the blueprint parser
+	}
+	if ToolkitVersion == "" || !IsVersionConstraint(bp.GhpcVersion) {
+		return nil
+	}
+
+	cs, err := version.NewConstraint(bp.GhpcVersion)
+	if err != nil {
+		return BpError{Root.GhpcVersion, CodedError{CodeUnsupportedVersion,
+			fmt.Errorf("invalid version constraint %q: %w", bp.GhpcVersion, err)}}
+	}
+	tv, err := version.NewVersion(ToolkitVersion)
+	if err != nil {
+		return fmt.Errorf("invalid toolkit version %q: %w", ToolkitVersion, err)
+	}
+	if !cs.Check(tv) {
+		return BpError{Root.GhpcVersion, HintError{
+			Hint: "upgrade the toolkit, see https://github.com/GoogleCloudPlatform/hpc-toolkit/releases",
+			Err: CodedError{CodeUnsupportedVersion,
+				fmt.Errorf("blueprint requires toolkit version %q, this is version %s", bp.GhpcVersion, ToolkitVersion)}}}
+	}
+	return nil
+}
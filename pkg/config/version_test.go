@@ -0,0 +1,70 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *zeroSuite) TestIsVersionConstraint(c *C) {
+	c.Check(IsVersionConstraint(">= 1.25"), Equals, true)
+	c.Check(IsVersionConstraint("~> 1.30"), Equals, true)
+	c.Check(IsVersionConstraint("= v1.32.1"), Equals, true)
+	c.Check(IsVersionConstraint(""), Equals, false)
+	c.Check(IsVersionConstraint("golden"), Equals, false)
+	c.Check(IsVersionConstraint("v1.32.1-5-g1234abc-dirty"), Equals, false)
+}
+
+func (s *zeroSuite) TestCheckGhpcVersion(c *C) {
+	defer func(v string) { ToolkitVersion = v }(ToolkitVersion)
+	ToolkitVersion = "v1.30.0"
+
+	c.Check(checkGhpcVersion([]byte("blueprint_name: x")), IsNil)
+	c.Check(checkGhpcVersion([]byte("ghpc_version: v1.99.0-2-gabcdef")), IsNil) // recorded version
+	c.Check(checkGhpcVersion([]byte(`ghpc_version: ">= 1.25"`)), IsNil)
+	c.Check(checkGhpcVersion([]byte(`ghpc_version: ">= 1.25, < 2"`)), IsNil)
+
+	c.Check(checkGhpcVersion([]byte(`ghpc_version: ">= 1.31"`)), ErrorMatches, `.*requires toolkit version ">= 1.31", this is version v1.30.0.*`)
+	c.Check(checkGhpcVersion([]byte(`ghpc_version: ">= one"`)), ErrorMatches, `.*invalid version constraint.*`)
+
+	ToolkitVersion = ""
+	c.Check(checkGhpcVersion([]byte(`ghpc_version: ">= 1.31"`)), IsNil)
+}
+
+func (s *zeroSuite) TestNewBlueprintChecksVersionFirst(c *C) {
+	defer func(v string) { ToolkitVersion = v }(ToolkitVersion)
+	ToolkitVersion = "v1.30.0"
+
+	path := filepath.Join(c.MkDir(), "bp.yaml")
+	y := `
+blueprint_name: future
+ghpc_version: ">= 1.40"
+feature_from_future: true
+`
+	c.Assert(os.WriteFile(path, []byte(y), 0644), IsNil)
+
+	_, ctx, err := NewBlueprint(path)
+	c.Check(err, ErrorMatches, `.*requires toolkit version ">= 1.40".*`)
+
+	var be BpError
+	c.Assert(errors.As(err, &be), Equals, true)
+	pos, ok := ctx.Pos(be.Path)
+	c.Check(ok, Equals, true)
+	c.Check(pos.Line, Equals, 3)
+}
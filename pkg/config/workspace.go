@@ -0,0 +1,164 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// Workspace is a set of related blueprints, e.g. network, storage and clusters
+// of several teams, that share deployment variables and are deployed together
+type Workspace struct {
+	Vars       Dict                 `yaml:"vars,omitempty"`
+	Blueprints []WorkspaceBlueprint `yaml:"blueprints"`
+}
+
+// WorkspaceBlueprint is a blueprint of the workspace
+type WorkspaceBlueprint struct {
+	Name string `yaml:"name"`
+	Path string `yaml:"path"`
+	// Vars override shared variables of the workspace
+	Vars Dict `yaml:"vars,omitempty"`
+	// Imports set deployment variables to outputs of deployment groups of other
+	// blueprints of the workspace, in format "BLUEPRINT.GROUP.OUTPUT"
+	Imports map[string]string `yaml:"imports,omitempty"`
+}
+
+// WorkspaceOutput is an output of a deployment group of a workspace blueprint
+type WorkspaceOutput struct {
+	Blueprint string
+	Group     GroupName
+	Name      string
+}
+
+func (o WorkspaceOutput) String() string {
+	return fmt.Sprintf("%s.%s.%s", o.Blueprint, o.Group, o.Name)
+}
+
+// ParseWorkspaceOutput parses output reference in format "BLUEPRINT.GROUP.OUTPUT"
+func ParseWorkspaceOutput(s string) (WorkspaceOutput, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 || slices.Contains(parts, "") {
+		return WorkspaceOutput{}, fmt.Errorf("invalid output reference %q, expected format BLUEPRINT.GROUP.OUTPUT", s)
+	}
+	return WorkspaceOutput{Blueprint: parts[0], Group: GroupName(parts[1]), Name: parts[2]}, nil
+}
+
+// NewWorkspace reads the workspace file, paths of blueprints are relative to
+// the directory of the workspace file
+func NewWorkspace(path string) (Workspace, YamlCtx, error) {
+	ws, ctx, err := parseYamlFile[Workspace](path)
+	if err != nil {
+		return ws, ctx, err
+	}
+	for i, b := range ws.Blueprints {
+		if b.Path != "" && !filepath.IsAbs(b.Path) {
+			ws.Blueprints[i].Path = filepath.Join(filepath.Dir(path), b.Path)
+		}
+	}
+	return ws, ctx, ws.validate()
+}
+
+func (ws Workspace) validate() error {
+	errs := Errors{}
+	if len(ws.Blueprints) == 0 {
+		errs.Add(errors.New("workspace must have at least one blueprint"))
+	}
+	names := map[string]bool{}
+	for _, b := range ws.Blueprints {
+		switch {
+		case b.Name == "":
+			errs.Add(errors.New("blueprint of the workspace must have a name"))
+		case names[b.Name]:
+			errs.Add(fmt.Errorf("blueprint name %q is used more than once in the workspace", b.Name))
+		}
+		names[b.Name] = true
+		if b.Path == "" {
+			errs.Add(fmt.Errorf("blueprint %q of the workspace must have a path", b.Name))
+		}
+	}
+	for _, b := range ws.Blueprints {
+		for _, v := range sortedKeys(b.Imports) {
+			o, err := ParseWorkspaceOutput(b.Imports[v])
+			switch {
+			case err != nil:
+				errs.Add(fmt.Errorf("import of variable %q of blueprint %q: %w", v, b.Name, err))
+			case o.Blueprint == b.Name:
+				errs.Add(fmt.Errorf("blueprint %q can not import its own output %q, use a module output reference instead", b.Name, o))
+			case !names[o.Blueprint]:
+				errs.Add(fmt.Errorf("variable %q of blueprint %q imports output of unknown blueprint %q", v, b.Name, o.Blueprint))
+			}
+		}
+	}
+	return errs.OrNil()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := maps.Keys(m)
+	slices.Sort(keys)
+	return keys
+}
+
+// Upstream returns names of blueprints which outputs are imported by the blueprint
+func (b WorkspaceBlueprint) Upstream() []string {
+	res := []string{}
+	for _, v := range sortedKeys(b.Imports) {
+		if o, err := ParseWorkspaceOutput(b.Imports[v]); err == nil && !slices.Contains(res, o.Blueprint) {
+			res = append(res, o.Blueprint)
+		}
+	}
+	return res
+}
+
+// Ordered returns blueprints of the workspace in the order of deployment: every
+// blueprint comes after blueprints it imports outputs from, otherwise the order
+// of the workspace file is kept
+func (ws Workspace) Ordered() ([]WorkspaceBlueprint, error) {
+	done := map[string]bool{}
+	res := []WorkspaceBlueprint{}
+	for len(res) < len(ws.Blueprints) {
+		found := false
+		for _, b := range ws.Blueprints {
+			if done[b.Name] {
+				continue
+			}
+			ready := true
+			for _, u := range b.Upstream() {
+				ready = ready && done[u]
+			}
+			if ready {
+				done[b.Name], found = true, true
+				res = append(res, b)
+				break
+			}
+		}
+		if !found {
+			left := []string{}
+			for _, b := range ws.Blueprints {
+				if !done[b.Name] {
+					left = append(left, b.Name)
+				}
+			}
+			return nil, fmt.Errorf("blueprints %s of the workspace import outputs of each other in a cycle", strings.Join(left, ", "))
+		}
+	}
+	return res, nil
+}
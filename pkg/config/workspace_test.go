@@ -0,0 +1,121 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *zeroSuite) TestParseWorkspaceOutput(c *C) {
+	o, err := ParseWorkspaceOutput("network.primary.network_self_link_network1")
+	c.Check(err, IsNil)
+	c.Check(o, DeepEquals, WorkspaceOutput{Blueprint: "network", Group: "primary", Name: "network_self_link_network1"})
+	c.Check(o.String(), Equals, "network.primary.network_self_link_network1")
+
+	for _, s := range []string{"network", "network.primary", "network..out", "a.b.c.d"} {
+		_, err := ParseWorkspaceOutput(s)
+		c.Check(err, NotNil, Commentf("%q", s))
+	}
+}
+
+func (s *zeroSuite) TestNewWorkspace(c *C) {
+	dir := c.MkDir()
+	path := filepath.Join(dir, "workspace.yaml")
+	write := func(y string) {
+		c.Assert(os.WriteFile(path, []byte(y), 0644), IsNil)
+	}
+
+	{ // OK
+		write(`
+vars:
+  project_id: my-project
+blueprints:
+- name: network
+  path: network.yaml
+- name: cluster
+  path: /abs/cluster.yaml
+  vars:
+    deployment_name: team-a
+  imports:
+    network_self_link: network.primary.network_self_link_network1
+`)
+		ws, _, err := NewWorkspace(path)
+		c.Assert(err, IsNil)
+		c.Check(ws.Vars.Get("project_id").AsString(), Equals, "my-project")
+		c.Check(ws.Blueprints[0].Path, Equals, filepath.Join(dir, "network.yaml"))
+		c.Check(ws.Blueprints[1].Path, Equals, "/abs/cluster.yaml")
+		c.Check(ws.Blueprints[1].Upstream(), DeepEquals, []string{"network"})
+	}
+
+	{ // FAIL: duplicate name, unknown and own blueprints
+		write(`
+blueprints:
+- name: network
+  path: network.yaml
+- name: network
+  path: other.yaml
+  imports:
+    a: storage.primary.x
+    b: network.primary.y
+`)
+		_, _, err := NewWorkspace(path)
+		c.Check(err, ErrorMatches, `(?s).*used more than once.*unknown blueprint "storage".*own output.*`)
+	}
+
+	{ // FAIL: no blueprints
+		write("vars: {}\n")
+		_, _, err := NewWorkspace(path)
+		c.Check(err, NotNil)
+	}
+}
+
+func (s *zeroSuite) TestWorkspaceOrdered(c *C) {
+	bp := func(name string, imports ...string) WorkspaceBlueprint {
+		m := map[string]string{}
+		for i, o := range imports {
+			m[string(rune('a'+i))] = o
+		}
+		return WorkspaceBlueprint{Name: name, Path: name + ".yaml", Imports: m}
+	}
+	names := func(bs []WorkspaceBlueprint) []string {
+		res := []string{}
+		for _, b := range bs {
+			res = append(res, b.Name)
+		}
+		return res
+	}
+
+	{ // upstream blueprints first, file order otherwise
+		ws := Workspace{Blueprints: []WorkspaceBlueprint{
+			bp("team_a", "network.primary.net", "storage.primary.fs"),
+			bp("storage", "network.primary.net"),
+			bp("team_b", "network.primary.net"),
+			bp("network"),
+		}}
+		got, err := ws.Ordered()
+		c.Assert(err, IsNil)
+		c.Check(names(got), DeepEquals, []string{"network", "storage", "team_a", "team_b"})
+	}
+
+	{ // cycle
+		ws := Workspace{Blueprints: []WorkspaceBlueprint{
+			bp("network"), bp("a", "b.g.o"), bp("b", "a.g.o")}}
+		_, err := ws.Ordered()
+		c.Check(err, ErrorMatches, ".*a, b .*cycle")
+	}
+}
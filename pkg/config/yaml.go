@@ -113,6 +113,8 @@ func syntheticOutputsNode(name string, ln int, col int) *yaml.Node {
 	}
 }
 
+var moduleOutputPathRe = regexp.MustCompile(`^deployment_groups\[\d+\]\.modules\[\d+\]\.outputs\[\d+\]$`)
+
 // normalizeNode is treating variadic YAML syntax, ensuring that
 // there is only one (canonical) way to refer to a piece of blueprint.
 // Handled cases:
@@ -124,7 +126,7 @@ func syntheticOutputsNode(name string, ln int, col int) *yaml.Node {
 // ```
 func normalizeYamlNode(p yPath, n *yaml.Node) *yaml.Node {
 	switch {
-	case n.Kind == yaml.ScalarNode && regexp.MustCompile(`^deployment_groups\[\d+\]\.modules\[\d+\]\.outputs\[\d+\]$`).MatchString(string(p)):
+	case n.Kind == yaml.ScalarNode && moduleOutputPathRe.MatchString(string(p)):
 		return syntheticOutputsNode(n.Value, n.Line, n.Column)
 	default:
 		return n
@@ -174,6 +176,39 @@ func NewYamlCtx(data []byte) (YamlCtx, error) {
 	return YamlCtx{m, lines}, nil
 }
 
+// addYamlComments sets line comments of mapping keys and sequence items,
+// paths are built the same way as in NewYamlCtx.
+func addYamlComments(n *yaml.Node, p yPath, comments map[string]string) {
+	if len(comments) == 0 {
+		return
+	}
+	switch n.Kind {
+	case yaml.DocumentNode:
+		for _, c := range n.Content {
+			addYamlComments(c, p, comments)
+		}
+	case yaml.MappingNode:
+		for i := 0; i < len(n.Content); i += 2 {
+			cp := p.Dot(n.Content[i].Value)
+			if c, ok := comments[string(cp)]; ok {
+				if n.Content[i+1].Kind == yaml.ScalarNode {
+					n.Content[i].LineComment = c
+				} else { // line comments of collections are misplaced by yaml.v3
+					n.Content[i].HeadComment = c
+				}
+			}
+			addYamlComments(n.Content[i+1], cp, comments)
+		}
+	case yaml.SequenceNode:
+		for i, c := range n.Content {
+			if cm, ok := comments[string(p.At(i))]; ok {
+				c.HeadComment = cm
+			}
+			addYamlComments(c, p.At(i), comments)
+		}
+	}
+}
+
 type nodeCapturer struct{ n *yaml.Node }
 
 func nodeToPosErr(n *yaml.Node, err error) PosError {
@@ -193,7 +228,7 @@ func (mk *ModuleKind) UnmarshalYAML(n *yaml.Node) error {
 		mk.kind = kind
 		return nil
 	}
-	return nodeToPosErr(n, errors.New(`kind must be "packer" or "terraform" or removed from YAML`))
+	return nodeToPosErr(n, CodedError{CodeInvalidModuleSource, errors.New(`kind must be "packer", "terraform", "ansible", "helm", "script" or removed from YAML`)})
 }
 
 // MarshalYAML implements a custom marshaler from ModuleKind to YAML string
@@ -262,7 +297,7 @@ func (y *YamlValue) unmarshalScalar(n *yaml.Node) error {
 
 	if v.Type() == cty.String {
 		if v, err = parseYamlString(v.AsString()); err != nil {
-			return fmt.Errorf("line %d: %w", n.Line, err)
+			return fmt.Errorf("line %d: %w", n.Line, CodedError{CodeMalformedExpression, err})
 		}
 	}
 	y.Wrap(v)
@@ -276,7 +311,7 @@ func isHCLLiteral(s string) bool {
 func parseYamlString(s string) (cty.Value, error) {
 	if isHCLLiteral(s) {
 		if e, err := ParseExpression(s[2 : len(s)-2]); err != nil {
-			return cty.NilVal, err
+			return cty.NilVal, prepareParseHclErr(err, s, 2)
 		} else {
 			return e.AsValue(), nil
 		}
@@ -324,12 +359,12 @@ func (d *Dict) UnmarshalYAML(n *yaml.Node) error {
 		return nodeToPosErr(n, fmt.Errorf("must be a mapping, got %s", ty.FriendlyName()))
 	}
 
+	// do not modify the map in place, it can be shared with other Dicts
+	m := d.Items()
 	for k, w := range v.Unwrap().AsValueMap() {
-		if d.m == nil {
-			d.m = map[string]cty.Value{}
-		}
-		d.m[k] = w
+		m[k] = w
 	}
+	d.m = m
 	return nil
 }
 
@@ -378,30 +413,43 @@ func parseYamlV3Error(err error) error {
 	switch err := err.(type) {
 	case *yaml.TypeError:
 		for _, s := range err.Errors {
-			errs.Add(parseYamlV3ErrorString(s))
+			errs.Add(parseYamlV3ErrorString(s, CodeMalformedYaml))
 		}
 	case PosError:
+		if ErrorCodeOf(err) == "" {
+			err.Err = CodedError{CodeMalformedYaml, err.Err}
+		}
 		errs.Add(err)
 	default:
-		errs.Add(parseYamlV3ErrorString(err.Error()))
+		errs.Add(parseYamlV3ErrorString(err.Error(), yamlErrorCode(err)))
 	}
 
 	if !errs.Any() { // should never happen
-		errs.Add(parseYamlV3ErrorString(err.Error()))
+		errs.Add(parseYamlV3ErrorString(err.Error(), yamlErrorCode(err)))
 	}
 	return errs
 }
 
+var yamlV3ErrorRe = regexp.MustCompile(`^(yaml: )?(line (\d+): )?((.|\n)*)$`)
+
 // parseYamlV3Error attempts to extract position and nice error message from yaml.v3 error message.
 // yaml.v3 errors are unstructured, use string parsing to extract information.
 // If no position can be extracted, returns error without position.
 // Else returns PosError{Pos{Line: line_number}, error_message}.
-func parseYamlV3ErrorString(s string) error {
-	match := regexp.MustCompile(`^(yaml: )?(line (\d+): )?((.|\n)*)$`).FindStringSubmatch(s)
+func parseYamlV3ErrorString(s string, code ErrorCode) error {
+	match := yamlV3ErrorRe.FindStringSubmatch(s)
 	if match == nil {
-		return errors.New(s)
+		return CodedError{code, errors.New(s)}
 	}
 	lns, errMsg := match[3], match[4]
 	ln, _ := strconv.Atoi(lns) // Atoi returns 0 on error, which is fine here
-	return PosError{Pos{Line: ln}, errors.New(errMsg)}
+	return PosError{Pos{Line: ln}, CodedError{code, errors.New(errMsg)}}
+}
+
+// yamlErrorCode returns code of error returned by custom unmarshaler, if any
+func yamlErrorCode(err error) ErrorCode {
+	if c := ErrorCodeOf(err); c != "" {
+		return c
+	}
+	return CodeMalformedYaml
 }
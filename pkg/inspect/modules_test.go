@@ -207,6 +207,18 @@ func TestMetadataInjectModuleId(t *testing.T) {
 	}
 }
 
+func TestMetadataNamingInputs(t *testing.T) {
+	for _, mod := range notEmpty(query(all()), t) {
+		t.Run(mod.Source, func(t *testing.T) {
+			for _, n := range mod.Metadata.Ghpc.NamingInputs {
+				if _, ok := mod.Input(n); !ok {
+					t.Errorf("has no input %q", n)
+				}
+			}
+		})
+	}
+}
+
 func TestOutputForbiddenNames(t *testing.T) {
 	nowhere := []string{}
 	allowed := map[string][]string{
@@ -24,6 +24,8 @@ var (
 	infolog  *log.Logger
 	errorlog *log.Logger
 	fatallog *log.Logger
+
+	fatalHooks []func()
 )
 
 func init() {
@@ -44,8 +46,26 @@ func Error(f string, a ...any) {
 	errorlog.Println(msg)
 }
 
+// OnFatal registers a function to run before Fatal ends the program,
+// e.g. to finalize files that would otherwise be left incomplete
+func OnFatal(f func()) {
+	fatalHooks = append(fatalHooks, f)
+}
+
+// runFatalHooks runs and discards registered hooks, so that hooks calling Fatal
+// do not run again
+func runFatalHooks() {
+	hooks := fatalHooks
+	fatalHooks = nil
+	for _, f := range hooks {
+		f()
+	}
+}
+
 // Fatal prints info to stderr and ends the program
 func Fatal(f string, a ...any) {
+	runFatalHooks()
+	FlushWarnings()
 	msg := fmt.Sprintf(f, a...)
 	fatallog.Println(msg)
 	os.Exit(1)
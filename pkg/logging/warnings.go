@@ -0,0 +1,126 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Warning is a finding that does not fail the run. Warnings are collected during
+// the run and reported together at its end, separately from errors.
+type Warning struct {
+	Source   string `json:"source"`             // what found it, e.g. name of a validator
+	Code     string `json:"code,omitempty"`     // error code, if the finding has one
+	Location string `json:"location,omitempty"` // e.g. line of the blueprint or module ID
+	Message  string `json:"message"`
+	Hint     string `json:"hint,omitempty"`
+}
+
+func (w Warning) String() string {
+	parts := []string{"[" + w.Source + "]"}
+	if w.Code != "" {
+		parts = append(parts, "["+w.Code+"]")
+	}
+	msg := w.Message
+	if w.Location != "" {
+		msg = w.Location + ": " + msg
+	}
+	s := strings.Join(append(parts, msg), " ")
+	if w.Hint != "" {
+		s += "\n  Hint: " + w.Hint
+	}
+	return s
+}
+
+// WarningsFile is the path of the file warnings are written to as a JSON array,
+// warnings are not written to a file if it is empty
+var WarningsFile string
+
+var (
+	warningsMu sync.Mutex
+	warnings   []Warning
+)
+
+// Warn records a warning to be reported at the end of the run
+func Warn(w Warning) {
+	warningsMu.Lock()
+	defer warningsMu.Unlock()
+	warnings = append(warnings, w)
+}
+
+// Warnf records a warning with formatted message
+func Warnf(source string, f string, a ...any) {
+	Warn(Warning{Source: source, Message: fmt.Sprintf(f, a...)})
+}
+
+// Warnings returns warnings recorded so far
+func Warnings() []Warning {
+	warningsMu.Lock()
+	defer warningsMu.Unlock()
+	return append([]Warning{}, warnings...)
+}
+
+// ResetWarnings discards recorded warnings
+func ResetWarnings() {
+	warningsMu.Lock()
+	defer warningsMu.Unlock()
+	warnings = nil
+}
+
+// ReportWarnings writes the section listing warnings, nothing if there are none
+func ReportWarnings(w io.Writer, ws []Warning) {
+	if len(ws) == 0 {
+		return
+	}
+	noun := "warnings"
+	if len(ws) == 1 {
+		noun = "warning"
+	}
+	fmt.Fprintf(w, "\n%d %s:\n", len(ws), noun)
+	for _, wr := range ws {
+		fmt.Fprintf(w, "- %s\n", wr)
+	}
+}
+
+// WriteWarningsJSON writes warnings to the file as a JSON array
+func WriteWarningsJSON(path string, ws []Warning) error {
+	if ws == nil {
+		ws = []Warning{} // empty array rather than null
+	}
+	b, err := json.MarshalIndent(ws, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// FlushWarnings reports recorded warnings to standard error and to WarningsFile,
+// if set, and discards them. It is called at the end of the run, including when
+// the run fails.
+func FlushWarnings() {
+	ws := Warnings()
+	ResetWarnings()
+	ReportWarnings(errorlog.Writer(), ws)
+	if WarningsFile != "" {
+		if err := WriteWarningsJSON(WarningsFile, ws); err != nil {
+			errorlog.Printf("failed to write warnings to %s: %v", WarningsFile, err)
+		}
+	}
+}
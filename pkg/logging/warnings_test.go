@@ -0,0 +1,86 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+type MySuite struct{}
+
+var _ = Suite(&MySuite{})
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+func (s *MySuite) TestWarnings(c *C) {
+	ResetWarnings()
+	defer ResetWarnings()
+	Warnf("test_ssh_keys", "keys of %s are ignored", "login")
+	Warn(Warning{Source: "deprecation", Location: "line 7", Message: "old name", Hint: "run ghpc fix"})
+	c.Check(Warnings(), DeepEquals, []Warning{
+		{Source: "test_ssh_keys", Message: "keys of login are ignored"},
+		{Source: "deprecation", Location: "line 7", Message: "old name", Hint: "run ghpc fix"},
+	})
+
+	var buf bytes.Buffer
+	ReportWarnings(&buf, Warnings())
+	c.Check(buf.String(), Equals, "\n2 warnings:\n"+
+		"- [test_ssh_keys] keys of login are ignored\n"+
+		"- [deprecation] line 7: old name\n  Hint: run ghpc fix\n")
+
+	buf.Reset()
+	ReportWarnings(&buf, nil)
+	c.Check(buf.String(), Equals, "")
+
+	c.Check(Warning{Source: "test_image_fresh", Code: "GHPC2025", Message: "old"}.String(), Equals,
+		"[test_image_fresh] [GHPC2025] old")
+}
+
+func (s *MySuite) TestWriteWarningsJSON(c *C) {
+	path := filepath.Join(c.MkDir(), "warnings.json")
+	c.Assert(WriteWarningsJSON(path, nil), IsNil)
+	b, err := os.ReadFile(path)
+	c.Assert(err, IsNil)
+	c.Check(string(b), Equals, "[]\n")
+
+	ws := []Warning{{Source: "kueue", Location: "module pool", Message: "no flavor"}}
+	c.Assert(WriteWarningsJSON(path, ws), IsNil)
+	b, err = os.ReadFile(path)
+	c.Assert(err, IsNil)
+	var got []map[string]string
+	c.Assert(json.Unmarshal(b, &got), IsNil)
+	c.Check(got, DeepEquals, []map[string]string{{"source": "kueue", "location": "module pool", "message": "no flavor"}})
+}
+
+func (s *MySuite) TestFatalHooks(c *C) {
+	defer func() { fatalHooks = nil }()
+	calls := []string{}
+	OnFatal(func() { calls = append(calls, "profile") })
+	OnFatal(func() {
+		calls = append(calls, "nested")
+		runFatalHooks() // e.g. hook failing with Fatal
+	})
+	runFatalHooks()
+	runFatalHooks()
+	c.Check(calls, DeepEquals, []string{"profile", "nested"})
+}
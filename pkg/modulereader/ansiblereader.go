@@ -0,0 +1,83 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modulereader
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/sourcereader"
+	"os"
+	"path"
+
+	"github.com/zclconf/go-cty/cty"
+	"gopkg.in/yaml.v3"
+)
+
+// AnsiblePlaybookFile is the entry point of Ansible modules
+const AnsiblePlaybookFile = "playbook.yml"
+
+// AnsibleReader implements ModReader for Ansible playbook modules
+type AnsibleReader struct{}
+
+// NewAnsibleReader is a constructor for AnsibleReader
+func NewAnsibleReader() AnsibleReader {
+	return AnsibleReader{}
+}
+
+type ansiblePlay struct {
+	Vars yaml.Node `yaml:"vars"`
+}
+
+// GetInfo reads the ModuleInfo for an Ansible module.
+// Inputs of the module are variables declared in `vars` of the plays,
+// all inputs are optional and of any type, there are no outputs.
+func (r AnsibleReader) GetInfo(source string) (ModuleInfo, error) {
+	var data []byte
+	var err error
+	playbook := path.Join(source, AnsiblePlaybookFile)
+	if sourcereader.IsEmbeddedPath(source) {
+		data, err = sourcereader.ModuleFS.ReadFile(playbook)
+	} else {
+		data, err = os.ReadFile(playbook)
+	}
+	if err != nil {
+		return ModuleInfo{}, fmt.Errorf("source is not an ansible module, %s can not be read: %w", AnsiblePlaybookFile, err)
+	}
+
+	plays := []ansiblePlay{}
+	if err := yaml.Unmarshal(data, &plays); err != nil {
+		return ModuleInfo{}, fmt.Errorf("failed to parse ansible playbook %s: %w", playbook, err)
+	}
+
+	ret := ModuleInfo{}
+	seen := map[string]bool{}
+	for _, play := range plays {
+		if play.Vars.Kind != yaml.MappingNode {
+			continue // `vars` is not set or refers to a file
+		}
+		for i := 0; i+1 < len(play.Vars.Content); i += 2 {
+			name := play.Vars.Content[i].Value
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			var def interface{}
+			if err := play.Vars.Content[i+1].Decode(&def); err != nil {
+				return ModuleInfo{}, fmt.Errorf("failed to parse default of variable %q: %w", name, err)
+			}
+			ret.Inputs = append(ret.Inputs, VarInfo{Name: name, Type: cty.DynamicPseudoType, Default: def})
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modulereader
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/sourcereader"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-getter"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// HelmReader implements ModReader for Helm chart modules
+type HelmReader struct{}
+
+// NewHelmReader is a constructor for HelmReader
+func NewHelmReader() HelmReader {
+	return HelmReader{}
+}
+
+// HelmChart returns chart and repository of the Helm chart module source:
+//   - local chart directory => <source>, ""
+//   - OCI reference, e.g. oci://registry.k8s.io/kueue/charts/kueue => <source>, ""
+//   - chart in repository, e.g. https://nvidia.github.io/dcgm-exporter/helm-charts//dcgm-exporter
+//     => dcgm-exporter, https://nvidia.github.io/dcgm-exporter/helm-charts
+func HelmChart(source string) (string, string, error) {
+	if sourcereader.IsLocalPath(source) || strings.HasPrefix(source, "oci://") {
+		return source, "", nil
+	}
+	if strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://") {
+		repo, chart := getter.SourceDirSubdir(source)
+		if chart != "" && !strings.Contains(chart, "/") {
+			return chart, repo, nil
+		}
+	}
+	return "", "", fmt.Errorf("helm chart source must be a local directory, an oci:// reference or "+
+		"a repository URL followed by // and the chart name, got %q", source)
+}
+
+// GetInfo reads the ModuleInfo for a Helm chart module.
+// Inputs of all Helm modules are the same, chart values are passed as `values`.
+func (r HelmReader) GetInfo(source string) (ModuleInfo, error) {
+	if _, _, err := HelmChart(source); err != nil {
+		return ModuleInfo{}, err
+	}
+	if sourcereader.IsLocalPath(source) {
+		if _, err := os.Stat(filepath.Join(source, "Chart.yaml")); err != nil {
+			return ModuleInfo{}, fmt.Errorf("source is not a helm chart, Chart.yaml can not be read: %w", err)
+		}
+	}
+	return ModuleInfo{Inputs: []VarInfo{
+		{Name: "cluster_id", Type: cty.String, Required: true,
+			Description: "ID of the GKE cluster to release the chart to, in the format projects/<project_id>/locations/<location>/clusters/<name>"},
+		{Name: "release_name", Type: cty.String,
+			Description: "Name of the release, defaults to the module ID"},
+		{Name: "namespace", Type: cty.String, Default: "default",
+			Description: "Kubernetes namespace to release the chart to"},
+		{Name: "create_namespace", Type: cty.Bool, Default: false,
+			Description: "Create the namespace if it does not exist"},
+		{Name: "chart_version", Type: cty.String,
+			Description: "Version of the chart, defaults to the latest version"},
+		{Name: "values", Type: cty.DynamicPseudoType, Default: map[string]interface{}{},
+			Description: "Values of the chart"},
+	}}, nil
+}
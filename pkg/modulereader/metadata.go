@@ -49,6 +49,23 @@ type MetadataGhpc struct {
 	InjectModuleId string `yaml:"inject_module_id"`
 	// If set to true, the creation will fail if the module is not used.
 	HasToBeUsed bool `yaml:"has_to_be_used"`
+	// Optional, names of module variables that determine names of created resources.
+	// Modules of the same source with equal values of these variables will collide.
+	NamingInputs []string `yaml:"naming_inputs"`
+	// Optional, IAM permissions in the project required to create resources of the module.
+	Permissions []string `yaml:"permissions"`
+	// Optional, validators added to the blueprint for every use of the module.
+	Validators []MetadataValidator `yaml:"validators"`
+	// Optional, requirements of the module (e.g. `gpu_zone`), checked by validators
+	// added to the blueprint for every use of the module.
+	Requirements []string `yaml:"requirements"`
+}
+
+// MetadataValidator is a validator declared by a module
+type MetadataValidator struct {
+	Validator string `yaml:"validator"`
+	// Inputs may use blueprint expressions, `$(self.NAME)` refers to the module setting NAME.
+	Inputs yaml.Node `yaml:"inputs"`
 }
 
 // GetMetadata reads and parses `metadata.yaml` from module root.
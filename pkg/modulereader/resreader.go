@@ -20,9 +20,11 @@ package modulereader
 import (
 	"fmt"
 	"hpc-toolkit/pkg/logging"
+	"hpc-toolkit/pkg/profile"
 	"hpc-toolkit/pkg/sourcereader"
 	"os"
 	"path"
+	"sync"
 
 	"github.com/hashicorp/go-getter"
 	"github.com/zclconf/go-cty/cty"
@@ -118,7 +120,10 @@ type sourceAndKind struct {
 	kind   string
 }
 
-var modInfoCache = map[sourceAndKind]ModuleInfo{}
+var (
+	modInfoCache   = map[sourceAndKind]ModuleInfo{}
+	modInfoCacheMu sync.RWMutex // modules are read concurrently, e.g. by validators
+)
 
 // GetModuleInfo gathers information about a module at a given source using the
 // tfconfig package. It will add details about required APIs to be
@@ -126,12 +131,18 @@ var modInfoCache = map[sourceAndKind]ModuleInfo{}
 // There is a cache to avoid re-reading the module info for the same source and kind.
 func GetModuleInfo(source string, kind string) (ModuleInfo, error) {
 	key := sourceAndKind{source, kind}
-	if mi, ok := modInfoCache[key]; ok {
+	modInfoCacheMu.RLock()
+	mi, ok := modInfoCache[key]
+	modInfoCacheMu.RUnlock()
+	if ok {
 		return mi, nil
 	}
+	defer profile.Start(profile.ModuleInfo, source)()
 
 	var modPath string
 	switch {
+	case kind == "helm": // charts are fetched by Helm
+		modPath = source
 	case sourcereader.IsEmbeddedPath(source) || sourcereader.IsLocalPath(source):
 		modPath = source
 	default:
@@ -144,7 +155,7 @@ func GetModuleInfo(source string, kind string) (ModuleInfo, error) {
 		modPath = path.Join(pkgPath, subDir)
 		sourceReader := sourcereader.Factory(pkgAddr)
 		if err = sourceReader.GetModule(pkgAddr, pkgPath); err != nil {
-			if subDir != "" && kind == "packer" {
+			if subDir != "" && kind != "terraform" {
 				err = fmt.Errorf("module source %s included \"//\" package syntax; "+
 					"the \"//\" should typically be placed at the root of the repository:\n%w", source, err)
 			}
@@ -158,13 +169,17 @@ func GetModuleInfo(source string, kind string) (ModuleInfo, error) {
 		return ModuleInfo{}, err
 	}
 	mi.Metadata = GetMetadataSafe(modPath)
+	modInfoCacheMu.Lock()
 	modInfoCache[key] = mi
+	modInfoCacheMu.Unlock()
 	return mi, nil
 }
 
 // SetModuleInfo sets the ModuleInfo for a given source and kind
 // NOTE: This is only used for testing
 func SetModuleInfo(source string, kind string, info ModuleInfo) {
+	modInfoCacheMu.Lock()
+	defer modInfoCacheMu.Unlock()
 	modInfoCache[sourceAndKind{source, kind}] = info
 }
 
@@ -176,6 +191,9 @@ type ModReader interface {
 var kinds = map[string]ModReader{
 	"terraform": NewTFReader(),
 	"packer":    NewPackerReader(),
+	"ansible":   NewAnsibleReader(),
+	"helm":      NewHelmReader(),
+	"script":    NewScriptReader(),
 }
 
 // Factory returns a ModReader of type 'kind'
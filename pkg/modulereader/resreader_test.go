@@ -80,6 +80,7 @@ func (s *zeroSuite) TestGetOutputsAsMap(c *C) {
 func (s *zeroSuite) TestFactory(c *C) {
 	c.Check(Factory(pkrKindString), FitsTypeOf, PackerReader{})
 	c.Check(Factory(tfKindString), FitsTypeOf, TFReader{})
+	c.Check(Factory("ansible"), FitsTypeOf, AnsibleReader{})
 }
 
 func (s *MySuite) TestGetModuleInfo_Embedded(c *C) {
@@ -219,6 +220,100 @@ func (s *MySuite) TestGetInfo_PackerReader(c *C) {
 	}
 }
 
+func (s *zeroSuite) TestGetInfo_AnsibleReader(c *C) {
+	reader := NewAnsibleReader()
+	{ // embedded
+		info, err := reader.GetInfo("modules/imaginarium/giraffe")
+		c.Assert(err, IsNil)
+		c.Check(info, DeepEquals, ModuleInfo{
+			Inputs: []VarInfo{
+				{Name: "neck_length", Type: cty.DynamicPseudoType, Default: 3},
+				{Name: "spots", Type: cty.DynamicPseudoType, Default: []interface{}{"brown", "orange"}},
+				{Name: "keeper", Type: cty.DynamicPseudoType},
+			}})
+	}
+
+	{ // not an ansible module
+		_, err := reader.GetInfo("modules/test_role/test_module")
+		c.Check(err, ErrorMatches, "source is not an ansible module.*")
+	}
+}
+
+func (s *zeroSuite) TestHelmChart(c *C) {
+	type test struct {
+		source string
+		chart  string
+		repo   string
+		err    bool
+	}
+	for _, t := range []test{
+		{"./charts/mine", "./charts/mine", "", false},
+		{"oci://registry.k8s.io/kueue/charts/kueue", "oci://registry.k8s.io/kueue/charts/kueue", "", false},
+		{"https://nvidia.github.io/dcgm-exporter/helm-charts//dcgm-exporter", "dcgm-exporter", "https://nvidia.github.io/dcgm-exporter/helm-charts", false},
+		{"https://nvidia.github.io/dcgm-exporter/helm-charts", "", "", true},
+		{"modules/scheduler/gke-cluster", "", "", true},
+	} {
+		chart, repo, err := HelmChart(t.source)
+		c.Check(err != nil, Equals, t.err, Commentf("%q", t.source))
+		c.Check(chart, Equals, t.chart)
+		c.Check(repo, Equals, t.repo)
+	}
+}
+
+func (s *MySuite) TestGetInfo_HelmReader(c *C) {
+	reader := NewHelmReader()
+	{ // remote chart
+		info, err := reader.GetInfo("oci://registry.k8s.io/kueue/charts/kueue")
+		c.Assert(err, IsNil)
+		c.Check(info.Inputs[0].Name, Equals, "cluster_id")
+		c.Check(info.Inputs[0].Required, Equals, true)
+		c.Check(info.Outputs, HasLen, 0)
+	}
+
+	{ // local directory is not a chart
+		_, err := reader.GetInfo(s.terraformDir)
+		c.Check(err, ErrorMatches, "source is not a helm chart.*")
+	}
+}
+
+func (s *MySuite) TestGetInfo_ScriptReader(c *C) {
+	reader := NewScriptReader()
+	{ // embedded
+		info, err := reader.GetInfo("modules/imaginarium/scripts/feed.sh")
+		c.Assert(err, IsNil)
+		c.Check(info, DeepEquals, ModuleInfo{
+			Inputs: []VarInfo{
+				{Name: "animal", Type: cty.String, Description: "Script variable animal", Required: true},
+				{Name: "portions", Type: cty.Number, Description: "Script variable portions", Default: 2},
+				{Name: "menu", Type: cty.Map(cty.List(cty.String)), Description: "Script variable menu",
+					Default: map[string]interface{}{"hay": []interface{}{"dry", "fresh"}}},
+			},
+			Outputs: []OutputInfo{{Name: "runners", Description: "List with a single startup-script runner of the script"}},
+		})
+	}
+
+	{ // PowerShell
+		info, err := reader.GetInfo("modules/imaginarium/scripts/feed.ps1")
+		c.Assert(err, IsNil)
+		c.Check(info, DeepEquals, ModuleInfo{
+			Inputs:  []VarInfo{{Name: "animal", Type: cty.String, Description: "Script variable animal", Required: true}},
+			Outputs: []OutputInfo{{Name: "windows_startup_ps1", Description: "List with a single Windows startup script of the script"}},
+		})
+	}
+
+	{ // unsupported language
+		_, err := reader.GetInfo("modules/imaginarium/scripts/feed.rb")
+		c.Check(err, ErrorMatches, "source of script module must be a .sh, .py or .ps1 file.*")
+	}
+
+	{ // malformed declaration
+		bad := filepath.Join(c.MkDir(), "bad.py")
+		c.Assert(os.WriteFile(bad, []byte("# ghpc-variable: 1st string\n"), 0644), IsNil)
+		_, err := reader.GetInfo(bad)
+		c.Check(err, ErrorMatches, `.*bad.py:1: invalid variable name "1st"`)
+	}
+}
+
 func (s *zeroSuite) TestGetInfo_MetaReader(c *C) {
 	// Not implemented, expect that error
 	reader := MetaReader{}
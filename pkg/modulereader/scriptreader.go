@@ -0,0 +1,120 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modulereader
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/sourcereader"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ScriptRunnersOutput is the only output of shell and Python script modules, a list with a single startup-script runner
+const ScriptRunnersOutput = "runners"
+
+// ScriptWindowsStartupOutput is the only output of PowerShell script modules, a list with a single
+// Windows startup script, as accepted by `windows_startup_ps1` settings of modules
+const ScriptWindowsStartupOutput = "windows_startup_ps1"
+
+// ScriptReader implements ModReader for script modules
+type ScriptReader struct{}
+
+// NewScriptReader is a constructor for ScriptReader
+func NewScriptReader() ScriptReader {
+	return ScriptReader{}
+}
+
+// Variables of scripts are declared by comments of format:
+// # ghpc-variable: <name> <type> [= <default>]
+// where type is a Terraform type constraint and default is a YAML flow value.
+var scriptVariableRe = regexp.MustCompile(`^\s*#\s*ghpc-variable:\s*(\S+)\s+(.+?)(?:\s+=\s+(.+?))?\s*$`)
+
+var scriptVariableNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ScriptLanguage returns the language of the script module source, based on extension
+func ScriptLanguage(source string) (string, error) {
+	switch filepath.Ext(source) {
+	case ".sh":
+		return "shell", nil
+	case ".py":
+		return "python", nil
+	case ".ps1":
+		return "powershell", nil
+	}
+	return "", fmt.Errorf("source of script module must be a .sh, .py or .ps1 file, got %q", source)
+}
+
+// scriptOutput returns the only output of the script module
+func scriptOutput(lang string) OutputInfo {
+	if lang == "powershell" {
+		return OutputInfo{
+			Name:        ScriptWindowsStartupOutput,
+			Description: "List with a single Windows startup script of the script",
+		}
+	}
+	return OutputInfo{
+		Name:        ScriptRunnersOutput,
+		Description: "List with a single startup-script runner of the script",
+	}
+}
+
+// ReadScript reads the source of the script module
+func ReadScript(source string) ([]byte, error) {
+	if sourcereader.IsEmbeddedPath(source) {
+		return sourcereader.ModuleFS.ReadFile(source)
+	}
+	return os.ReadFile(source)
+}
+
+// GetInfo reads the ModuleInfo for a script module.
+// Inputs of the module are declared variables, variables without default are required.
+func (r ScriptReader) GetInfo(source string) (ModuleInfo, error) {
+	lang, err := ScriptLanguage(source)
+	if err != nil {
+		return ModuleInfo{}, err
+	}
+	data, err := ReadScript(source)
+	if err != nil {
+		return ModuleInfo{}, fmt.Errorf("failed to read script %s: %w", source, err)
+	}
+
+	ret := ModuleInfo{Outputs: []OutputInfo{scriptOutput(lang)}}
+	for i, line := range strings.Split(string(data), "\n") {
+		m := scriptVariableRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		name, typ, def := m[1], m[2], m[3]
+		if !scriptVariableNameRe.MatchString(name) {
+			return ModuleInfo{}, fmt.Errorf("%s:%d: invalid variable name %q", source, i+1, name)
+		}
+		ty, err := GetCtyType(typ)
+		if err != nil {
+			return ModuleInfo{}, fmt.Errorf("%s:%d: failed to parse type of variable %q: %w", source, i+1, name, err)
+		}
+		vi := VarInfo{Name: name, Type: ty, Description: fmt.Sprintf("Script variable %s", name), Required: def == ""}
+		if def != "" {
+			if err := yaml.Unmarshal([]byte(def), &vi.Default); err != nil {
+				return ModuleInfo{}, fmt.Errorf("%s:%d: failed to parse default of variable %q: %w", source, i+1, name, err)
+			}
+		}
+		ret.Inputs = append(ret.Inputs, vi)
+	}
+	return ret, nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modulewriter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	ctyJson "github.com/zclconf/go-cty/cty/json"
+	"gopkg.in/yaml.v3"
+
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/modulereader"
+)
+
+const (
+	ansibleExtraVarsFilename = "defaults.extra-vars.json"
+	// AnsibleInventoryFilename is the name of inventory file of Ansible modules
+	AnsibleInventoryFilename = "inventory.yaml"
+	// AnsibleInventorySetting is the setting of Ansible modules that is used
+	// as inventory instead of being passed to the playbook as extra-var
+	AnsibleInventorySetting = "inventory"
+)
+
+// AnsibleWriter writes Ansible playbook modules to the deployment folder
+type AnsibleWriter struct{}
+
+// AnsibleInputsFilename returns name of the file with extra-vars imported from other groups
+func AnsibleInputsFilename(id config.ModuleID) string {
+	return fmt.Sprintf("%s_inputs.extra-vars.json", id)
+}
+
+// AnsiblePlaybookArgs returns arguments of `ansible-playbook` to run the module
+// written to modPath, extra-vars imported from other groups are used if present.
+func AnsiblePlaybookArgs(id config.ModuleID, modPath string) []string {
+	_, err := os.Stat(filepath.Join(modPath, AnsibleInputsFilename(id)))
+	return ansiblePlaybookArgs(id, err == nil)
+}
+
+func ansiblePlaybookArgs(id config.ModuleID, withInputs bool) []string {
+	args := []string{"-i", AnsibleInventoryFilename, "-e", "@" + ansibleExtraVarsFilename}
+	if withInputs {
+		args = append(args, "-e", "@"+AnsibleInputsFilename(id))
+	}
+	return append(args, modulereader.AnsiblePlaybookFile)
+}
+
+func printAnsibleInstructions(w io.Writer, groupPath string, subPath string, id config.ModuleID, printImportInputs bool) {
+	args := ansiblePlaybookArgs(id, printImportInputs)
+
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Ansible group was successfully created in directory %s\n", groupPath)
+	fmt.Fprintln(w, "To deploy, run the following commands:")
+	fmt.Fprintln(w)
+	if printImportInputs {
+		fmt.Fprintf(w, "ghpc import-inputs %s\n", groupPath)
+	}
+	fmt.Fprintf(w, "cd %s\n", filepath.Join(groupPath, subPath))
+	fmt.Fprintf(w, "ansible-playbook %s\n", strings.Join(args, " "))
+	fmt.Fprintln(w, "cd -")
+}
+
+// ansibleInventory converts the value of inventory setting, either a list of
+// hosts or a map of Ansible group names to lists of hosts, to YAML inventory
+func ansibleInventory(v cty.Value) (map[string]interface{}, error) {
+	hostsOf := func(l cty.Value) map[string]interface{} {
+		hosts := map[string]interface{}{}
+		for _, h := range l.AsValueSlice() {
+			hosts[h.AsString()] = nil
+		}
+		return hosts
+	}
+
+	if l, err := convert.Convert(v, cty.List(cty.String)); err == nil && l.IsWhollyKnown() && !l.IsNull() {
+		return map[string]interface{}{"all": map[string]interface{}{"hosts": hostsOf(l)}}, nil
+	}
+	if m, err := convert.Convert(v, cty.Map(cty.List(cty.String))); err == nil && m.IsWhollyKnown() && !m.IsNull() {
+		children := map[string]interface{}{}
+		for g, l := range m.AsValueMap() {
+			children[g] = map[string]interface{}{"hosts": hostsOf(l)}
+		}
+		return map[string]interface{}{"all": map[string]interface{}{"children": children}}, nil
+	}
+	return nil, fmt.Errorf("%q setting of ansible module must be a list of hosts or a map of group names to lists of hosts, got %s",
+		AnsibleInventorySetting, v.Type().FriendlyName())
+}
+
+func writeAnsibleInventory(inv map[string]interface{}, dst string) error {
+	data, err := yaml.Marshal(inv)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0644)
+}
+
+// WriteAnsibleVars writes evaluated settings of Ansible module to modPath:
+// the inventory setting is written as inventory file, other settings are
+// written as extra-vars JSON file with a given name.
+func WriteAnsibleVars(vars map[string]cty.Value, modPath string, filename string) error {
+	if inv, ok := vars[AnsibleInventorySetting]; ok {
+		delete(vars, AnsibleInventorySetting)
+		yInv, err := ansibleInventory(inv)
+		if err != nil {
+			return err
+		}
+		if err := writeAnsibleInventory(yInv, filepath.Join(modPath, AnsibleInventoryFilename)); err != nil {
+			return err
+		}
+	}
+
+	obj := cty.ObjectVal(vars)
+	data, err := ctyJson.Marshal(obj, obj.Type())
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(modPath, filename), buf.Bytes(), 0644)
+}
+
+// writeGroup writes inventory and extra-vars of the module
+func (w AnsibleWriter) writeGroup(
+	bp config.Blueprint,
+	grpIdx int,
+	groupPath string,
+) error {
+	mod := bp.Groups[grpIdx].Modules[0] // ansible groups only have one module
+
+	av, err := evalSettingsWithoutIgc(bp, mod)
+	if err != nil {
+		return err
+	}
+
+	ds, err := DeploymentSource(mod)
+	if err != nil {
+		return err
+	}
+	modPath := filepath.Join(groupPath, ds)
+	if !mod.Settings.Has(AnsibleInventorySetting) { // run playbook on the machine running ghpc
+		local := map[string]interface{}{"all": map[string]interface{}{
+			"hosts": map[string]interface{}{"localhost": map[string]interface{}{"ansible_connection": "local"}}}}
+		if err := writeAnsibleInventory(local, filepath.Join(modPath, AnsibleInventoryFilename)); err != nil {
+			return err
+		}
+	}
+	return WriteAnsibleVars(av.Items(), modPath, ansibleExtraVarsFilename)
+}
+
+func (w AnsibleWriter) restoreState(deploymentDir string) error {
+	return nil // playbooks have no state
+}
+
+func (w AnsibleWriter) kind() config.ModuleKind {
+	return config.AnsibleKind
+}
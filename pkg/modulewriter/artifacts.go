@@ -0,0 +1,232 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modulewriter
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ArtifactsManifestName is the name of the machine-readable counterpart of
+// instructions.txt, written to the root of the deployment folder.
+const ArtifactsManifestName = "artifacts.json"
+
+// artifactsManifestVersion is incremented on incompatible changes of the manifest format
+const artifactsManifestVersion = 1
+
+// ArtifactsManifest enumerates files written by `ghpc create` and commands
+// deploying every group. All paths are relative to the deployment folder and slash-separated.
+type ArtifactsManifest struct {
+	Version        int              `json:"version"`
+	DeploymentName string           `json:"deployment_name"`
+	GhpcVersion    string           `json:"ghpc_version,omitempty"`
+	Groups         []GroupArtifacts `json:"groups"`
+	Files          []ArtifactFile   `json:"files"`
+}
+
+// GroupArtifacts describes how to deploy a deployment group, groups are listed in order of deployment.
+type GroupArtifacts struct {
+	Name     config.GroupName  `json:"name"`
+	Kind     string            `json:"kind"`
+	Dir      string            `json:"dir"`
+	Commands []ArtifactCommand `json:"commands"`
+}
+
+// ArtifactCommand is a command to run in the directory, Args[0] is the executable.
+type ArtifactCommand struct {
+	Dir  string   `json:"dir"`
+	Args []string `json:"args"`
+}
+
+// ArtifactFile is a file of the deployment folder. Group is empty for files
+// shared by all groups. Modules symlinked with --dev-modules have Link set instead of SHA256.
+type ArtifactFile struct {
+	Path   string           `json:"path"`
+	Group  config.GroupName `json:"group,omitempty"`
+	SHA256 string           `json:"sha256,omitempty"`
+	Link   string           `json:"link,omitempty"`
+}
+
+// ArtifactsManifestPath returns the path to the artifacts manifest of a deployment
+func ArtifactsManifestPath(deploymentDir string) string {
+	return filepath.Join(deploymentDir, ArtifactsManifestName)
+}
+
+// hasIntergroupSettings tests whether some of module settings are imported from other groups
+func hasIntergroupSettings(bp config.Blueprint, mod config.Module) bool {
+	for _, v := range mod.Settings.Items() {
+		if len(config.FindIntergroupReferences(v, mod, bp)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// groupCommands returns commands to deploy the group, mirroring instructions.txt
+func groupCommands(bp config.Blueprint, gIdx int) ([]ArtifactCommand, error) {
+	g := bp.Groups[gIdx]
+	gDir := string(g.Name)
+	importInputs := ArtifactCommand{Dir: ".", Args: []string{"ghpc", "import-inputs", gDir}}
+	multiGroup := len(bp.Groups) > 1
+
+	switch g.Kind() {
+	case config.TerraformKind:
+		cmds := []ArtifactCommand{}
+		if multiGroup && gIdx > 0 {
+			cmds = append(cmds, importInputs)
+		}
+		tf := "terraform"
+		if bp.TfvarsEncryption.Enabled() { // variables are decrypted by the wrapper
+			tf = "./" + TerraformWrapperName
+		}
+		for _, c := range []string{"init", "validate", "apply"} {
+			cmds = append(cmds, ArtifactCommand{Dir: gDir, Args: []string{tf, c}})
+		}
+		if multiGroup && gIdx < len(bp.Groups)-1 {
+			cmds = append(cmds, ArtifactCommand{Dir: ".", Args: []string{"ghpc", "export-outputs", gDir}})
+		}
+		return cmds, nil
+	case config.PackerKind, config.AnsibleKind:
+		mod := g.Modules[0] // packer and ansible groups only have one module
+		ds, err := DeploymentSource(mod)
+		if err != nil {
+			return nil, err
+		}
+		modDir := path.Join(gDir, filepath.ToSlash(ds))
+		hasIgc := hasIntergroupSettings(bp, mod)
+		cmds := []ArtifactCommand{}
+		if hasIgc {
+			cmds = append(cmds, importInputs)
+		}
+		if g.Kind() == config.AnsibleKind {
+			args := append([]string{"ansible-playbook"}, ansiblePlaybookArgs(mod.ID, hasIgc)...)
+			return append(cmds, ArtifactCommand{Dir: modDir, Args: args}), nil
+		}
+		for _, c := range []string{"init", "validate", "build"} {
+			cmds = append(cmds, ArtifactCommand{Dir: modDir, Args: []string{"packer", c, "."}})
+		}
+		return cmds, nil
+	default:
+		return nil, fmt.Errorf("invalid kind in deployment group %q, got %q", g.Name, g.Kind())
+	}
+}
+
+// isArtifactFile tests whether the file or directory of the deployment folder is
+// written by `ghpc create`, rather than by deployment or kept from previous versions.
+func isArtifactFile(rel string) bool {
+	base := path.Base(rel)
+	switch {
+	case rel == ArtifactsManifestName || base == ".terraform":
+		return false
+	case rel == path.Join(HiddenGhpcDirName, prevGroupDirName) || rel == path.Join(HiddenGhpcDirName, historyDirName):
+		return false
+	case rel == path.Join(HiddenGhpcDirName, ArtifactsDirName, writeInProgressMarker):
+		return false
+	case strings.HasSuffix(base, ".tfstate") || strings.Contains(base, ".tfstate."):
+		return false
+	}
+	return true
+}
+
+// artifactFiles lists files of the deployment folder with their checksums, sorted by path
+func artifactFiles(deplDir string, groupNames []config.GroupName) ([]ArtifactFile, error) {
+	groups := map[string]config.GroupName{}
+	for _, g := range groupNames {
+		groups[string(g)] = g
+	}
+
+	files := []ArtifactFile{}
+	err := filepath.WalkDir(deplDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		r, err := filepath.Rel(deplDir, p)
+		if err != nil || r == "." {
+			return err
+		}
+		rel := filepath.ToSlash(r)
+		if !isArtifactFile(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		top, _, _ := strings.Cut(rel, "/")
+		f := ArtifactFile{Path: rel, Group: groups[top]}
+		if d.Type()&fs.ModeSymlink != 0 {
+			if f.Link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		} else {
+			content, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			f.SHA256 = fmt.Sprintf("%x", sha256.Sum256(content))
+		}
+		files = append(files, f)
+		return nil
+	})
+	return files, err // WalkDir visits files in lexical order
+}
+
+// NewArtifactsManifest describes the deployment folder written for the materialized blueprint
+func NewArtifactsManifest(deplDir string, bp config.Blueprint) (ArtifactsManifest, error) {
+	m := ArtifactsManifest{
+		Version:        artifactsManifestVersion,
+		DeploymentName: bp.DeploymentName(),
+		GhpcVersion:    bp.GhpcVersion,
+		Groups:         []GroupArtifacts{},
+	}
+	names := []config.GroupName{}
+	for ig, g := range bp.Groups {
+		cmds, err := groupCommands(bp, ig)
+		if err != nil {
+			return ArtifactsManifest{}, err
+		}
+		m.Groups = append(m.Groups, GroupArtifacts{Name: g.Name, Kind: g.Kind().String(), Dir: string(g.Name), Commands: cmds})
+		names = append(names, g.Name)
+	}
+
+	files, err := artifactFiles(deplDir, names)
+	if err != nil {
+		return ArtifactsManifest{}, err
+	}
+	m.Files = files
+	return m, nil
+}
+
+func writeArtifactsManifest(deplDir string, bp config.Blueprint) error {
+	m, err := NewArtifactsManifest(deplDir, bp)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(ArtifactsManifestPath(deplDir), append(data, '\n'), 0644)
+}
@@ -0,0 +1,90 @@
+/**
+* Copyright 2024 Google LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package modulewriter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DevModulesDir is set by `ghpc create --dev-modules`. Local modules located in this
+// directory are symlinked into the deployment folder instead of being copied, so
+// changes to modules take effect without re-running create. If the directory is
+// a checkout of the toolkit, embedded modules are symlinked to it as well.
+var DevModulesDir string
+
+const devModulesBanner string = `# WARNING: this deployment was created with --dev-modules %s
+# Modules from this directory are symlinked rather than copied, the deployment
+# folder is not self-contained. Do not use it in production.
+`
+
+// devModulesWarning returns a banner for generated files, empty if dev mode is off
+func devModulesWarning() string {
+	if DevModulesDir == "" {
+		return ""
+	}
+	return fmt.Sprintf(devModulesBanner, DevModulesDir)
+}
+
+// devModuleSource returns absolute path of the local module source if it should be symlinked
+func devModuleSource(source string) (string, bool, error) {
+	if DevModulesDir == "" {
+		return "", false, nil
+	}
+	dev, err := filepath.Abs(DevModulesDir)
+	if err != nil {
+		return "", false, err
+	}
+	abs, err := filepath.Abs(source)
+	if err != nil {
+		return "", false, err
+	}
+	rel, err := filepath.Rel(dev, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false, nil
+	}
+	return abs, true, nil
+}
+
+// devEmbeddedSource returns path of embedded modules directory (e.g. "community/modules")
+// in DevModulesDir if it exists there
+func devEmbeddedSource(src string) (string, bool, error) {
+	if DevModulesDir == "" {
+		return "", false, nil
+	}
+	abs, err := filepath.Abs(filepath.Join(DevModulesDir, filepath.FromSlash(src)))
+	if err != nil {
+		return "", false, err
+	}
+	if fi, err := os.Stat(abs); err != nil || !fi.IsDir() {
+		return "", false, nil
+	}
+	return abs, true, nil
+}
+
+// linkModule creates a symlink to the module source
+func linkModule(src string, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.Symlink(src, dst); err != nil {
+		return fmt.Errorf("failed to link module %s to %s: %w", src, dst, err)
+	}
+	return nil
+}
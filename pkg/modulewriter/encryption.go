@@ -0,0 +1,204 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modulewriter
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hpc-toolkit/pkg/apiclient"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/deploymentio"
+	"hpc-toolkit/pkg/modulereader"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	cloudkms "google.golang.org/api/cloudkms/v1"
+)
+
+// Files of Terraform groups of deployments with `tfvars_encryption`, variables
+// selected for encryption are written to EncryptedTfvarsName instead of terraform.tfvars
+const (
+	// EncryptedTfvarsName is the Cloud KMS ciphertext of encrypted variables
+	EncryptedTfvarsName = "terraform.tfvars.enc"
+	// EncryptedTfvarsKeyName contains the name of the KMS key decrypting EncryptedTfvarsName
+	EncryptedTfvarsKeyName = "terraform.tfvars.enc.key"
+	// TerraformWrapperName is a script running terraform with decrypted variables
+	TerraformWrapperName = "terraform.sh"
+	// EncryptedVarsName is the Cloud KMS ciphertext of variables of the expanded
+	// blueprint, the name of the key is written next to it with ".key" suffix
+	EncryptedVarsName = "expanded_blueprint.vars.enc"
+	// EncryptedVarValue replaces values of encrypted variables in the expanded blueprint
+	EncryptedVarValue = "ENCRYPTED"
+
+	terraformWrapperTemplate = "terraform-wrapper.sh.tmpl"
+)
+
+func kmsService() (*cloudkms.Service, error) {
+	s, err := apiclient.New(context.Background(), cloudkms.NewService)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Cloud KMS client: %w", err)
+	}
+	return s, nil
+}
+
+// kmsEncrypt and kmsDecrypt call Cloud KMS, replaced in tests
+var (
+	kmsEncrypt = func(key string, plaintext []byte) ([]byte, error) {
+		s, err := kmsService()
+		if err != nil {
+			return nil, err
+		}
+		req := &cloudkms.EncryptRequest{Plaintext: base64.StdEncoding.EncodeToString(plaintext)}
+		resp, err := s.Projects.Locations.KeyRings.CryptoKeys.Encrypt(key, req).Do()
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt with Cloud KMS key %s: %w", key, err)
+		}
+		return base64.StdEncoding.DecodeString(resp.Ciphertext)
+	}
+
+	kmsDecrypt = func(key string, ciphertext []byte) ([]byte, error) {
+		s, err := kmsService()
+		if err != nil {
+			return nil, err
+		}
+		req := &cloudkms.DecryptRequest{Ciphertext: base64.StdEncoding.EncodeToString(ciphertext)}
+		resp, err := s.Projects.Locations.KeyRings.CryptoKeys.Decrypt(key, req).Do()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt with Cloud KMS key %s: %w", key, err)
+		}
+		return base64.StdEncoding.DecodeString(resp.Plaintext)
+	}
+)
+
+// writeEncryptedTfvars encrypts variables with the key and writes the ciphertext
+// and the name of the key into the directory
+func writeEncryptedTfvars(vars map[string]cty.Value, dst string, key string) error {
+	return writeEncryptedVars(vars, filepath.Join(dst, EncryptedTfvarsName), key)
+}
+
+// writeEncryptedVars encrypts variables with the key and writes the ciphertext
+// to the path and the name of the key to the path with ".key" suffix
+func writeEncryptedVars(vars map[string]cty.Value, path string, key string) error {
+	plaintext := hclAttributes(vars).Bytes()
+	ciphertext, err := kmsEncrypt(key, plaintext)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, ciphertext, 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(path+".key", []byte(key+"\n"), 0644)
+}
+
+// writeTerraformWrapper writes the script running terraform with decrypted variables
+func writeTerraformWrapper(dst string) error {
+	path := filepath.Join(dst, TerraformWrapperName)
+	dio := deploymentio.GetDeploymentioLocal()
+	if err := dio.CopyFromFS(templatesFS, terraformWrapperTemplate, path); err != nil {
+		return err
+	}
+	return os.Chmod(path, 0755)
+}
+
+// DecryptTfvars decrypts encrypted variables of the Terraform group into a temporary
+// file readable only by the current user. It returns the path of the file, or an empty
+// string if the group has no encrypted variables, and a function removing the file.
+func DecryptTfvars(groupDir string) (string, func(), error) {
+	return decryptVars(filepath.Join(groupDir, EncryptedTfvarsName))
+}
+
+// DecryptBlueprintVars restores values of variables of the expanded blueprint read
+// from the artifacts directory, that were replaced with EncryptedVarValue
+func DecryptBlueprintVars(bp *config.Blueprint, artDir string) error {
+	varFile, remove, err := decryptVars(filepath.Join(artDir, EncryptedVarsName))
+	if err != nil || varFile == "" {
+		return err
+	}
+	defer remove()
+	vars, err := modulereader.ReadHclAttributes(varFile)
+	if err != nil {
+		return err
+	}
+	for k, v := range vars {
+		bp.Vars = bp.Vars.With(k, v)
+	}
+	return nil
+}
+
+// decryptVars decrypts variables written by writeEncryptedVars, see DecryptTfvars
+func decryptVars(path string) (string, func(), error) {
+	noop := func() {}
+	ciphertext, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", noop, nil
+	}
+	if err != nil {
+		return "", noop, err
+	}
+	key, err := os.ReadFile(path + ".key")
+	if err != nil {
+		return "", noop, fmt.Errorf("failed to read name of the key of %s: %w", filepath.Base(path), err)
+	}
+	plaintext, err := kmsDecrypt(strings.TrimSpace(string(key)), ciphertext)
+	if err != nil {
+		return "", noop, err
+	}
+
+	f, err := os.CreateTemp("", "ghpc-*.tfvars") // created with 0600 permissions
+	if err != nil {
+		return "", noop, err
+	}
+	remove := func() { os.Remove(f.Name()) }
+	if _, err := f.Write(plaintext); err != nil {
+		f.Close()
+		remove()
+		return "", noop, err
+	}
+	if err := f.Close(); err != nil {
+		remove()
+		return "", noop, err
+	}
+	return f.Name(), remove, nil
+}
+
+// redactEncryptedVars replaces values of variables selected for encryption with
+// EncryptedVarValue and returns the original values
+func redactEncryptedVars(bp *config.Blueprint) map[string]cty.Value {
+	secret := map[string]cty.Value{}
+	for _, k := range bp.Vars.Keys() {
+		if bp.TfvarsEncryption.Encrypts(k) {
+			secret[k] = bp.Vars.Get(k)
+			bp.Vars = bp.Vars.With(k, cty.StringVal(EncryptedVarValue))
+		}
+	}
+	return secret
+}
+
+// splitEncryptedVars splits variables into ones written in plain text and ones to be encrypted
+func splitEncryptedVars(vars map[string]cty.Value, enc config.TfvarsEncryption) (map[string]cty.Value, map[string]cty.Value) {
+	plain, secret := map[string]cty.Value{}, map[string]cty.Value{}
+	for k, v := range vars {
+		if enc.Encrypts(k) {
+			secret[k] = v
+		} else {
+			plain[k] = v
+		}
+	}
+	return plain, secret
+}
@@ -23,6 +23,10 @@ import (
 
 // WriteHclAttributes writes tfvars/pkvars.hcl files
 func WriteHclAttributes(vars map[string]cty.Value, dst string) error {
+	return writeHclFile(dst, hclAttributes(vars))
+}
+
+func hclAttributes(vars map[string]cty.Value) *hclwrite.File {
 	hclFile := hclwrite.NewEmptyFile()
 	hclBody := hclFile.Body()
 	for _, k := range orderKeys(vars) {
@@ -30,5 +34,5 @@ func WriteHclAttributes(vars map[string]cty.Value, dst string) error {
 		toks := config.TokensForValue(vars[k])
 		hclBody.SetAttributeRaw(k, toks)
 	}
-	return writeHclFile(dst, hclFile)
+	return hclFile
 }
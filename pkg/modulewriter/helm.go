@@ -0,0 +1,96 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modulewriter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/deploymentio"
+	"hpc-toolkit/pkg/modulereader"
+	"hpc-toolkit/pkg/sourcereader"
+)
+
+// Helm chart modules are released by a Terraform module generated by ghpc
+// into every deployment group that contains them.
+const (
+	helmReleaseTemplate = "helm-release.tf.tmpl"
+	helmReleaseSource   = "./modules/helm-release"
+)
+
+// helmLocalChartSource returns location of local chart within deployment group
+func helmLocalChartSource(mod config.Module) (string, error) {
+	abs, err := filepath.Abs(mod.Source)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path for %#v: %v", mod.Source, err)
+	}
+	return fmt.Sprintf("./charts/%s-%s", filepath.Base(mod.Source), shortHash(abs)), nil
+}
+
+// helmReleaseAttributes returns settings of the helm module augmented with
+// attributes of the generated helm-release module derived from the chart source
+func helmReleaseAttributes(mod config.Module) (map[string]cty.Value, error) {
+	chart, repo, err := modulereader.HelmChart(mod.Source)
+	if err != nil {
+		return nil, err
+	}
+	if sourcereader.IsLocalPath(mod.Source) {
+		if chart, err = helmLocalChartSource(mod); err != nil {
+			return nil, err
+		}
+	}
+
+	attrs := mod.Settings.Items()
+	attrs["chart"] = cty.StringVal(chart)
+	if repo != "" {
+		attrs["repository"] = cty.StringVal(repo)
+	}
+	if !mod.Settings.Has("release_name") {
+		attrs["release_name"] = cty.StringVal(string(mod.ID))
+	}
+	return attrs, nil
+}
+
+// copyHelmSources writes the helm-release module and copies local chart of the module
+func copyHelmSources(gPath string, mod config.Module) error {
+	dst := filepath.Join(gPath, helmReleaseSource)
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	dio := deploymentio.GetDeploymentioLocal()
+	if err := dio.CopyFromFS(templatesFS, helmReleaseTemplate, filepath.Join(dst, "main.tf")); err != nil {
+		return err
+	}
+
+	if !sourcereader.IsLocalPath(mod.Source) {
+		return nil // will be downloaded by helm
+	}
+	chart, err := helmLocalChartSource(mod)
+	if err != nil {
+		return err
+	}
+	chartDst := filepath.Join(gPath, chart)
+	if _, err := os.Stat(chartDst); err == nil {
+		return nil
+	}
+	if err := sourcereader.Factory(mod.Source).GetModule(mod.Source, chartDst); err != nil {
+		return fmt.Errorf("failed to get helm chart from %s to %s: %w", mod.Source, chartDst, err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modulewriter
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const historyDirName = "history"
+
+// archivedArtifacts are artifacts describing the deployment that are kept in history
+var archivedArtifacts = []string{
+	ExpandedBlueprintName, EncryptedVarsName, EncryptedVarsName + ".key", VendoredManifestName}
+
+// HistoryDir returns directory with artifacts of previous versions of the deployment.
+// Unlike the artifacts directory, it is not cleaned up when the deployment is re-created.
+func HistoryDir(deplDir string) string {
+	return filepath.Join(HiddenGhpcDir(deplDir), historyDirName)
+}
+
+// ArchiveDir returns sub-directory of the history directory for the archive made at time `t`.
+func ArchiveDir(deplDir string, t time.Time) string {
+	return filepath.Join(HistoryDir(deplDir), t.UTC().Format("20060102T150405Z"))
+}
+
+// ArchiveArtifacts copies the expanded blueprint, its encrypted variables and module
+// checksums of the current deployment into ArchiveDir. Returns path to the archive.
+func ArchiveArtifacts(deplDir string, artDir string, t time.Time) (string, error) {
+	dst := ArchiveDir(deplDir, t)
+	if err := os.MkdirAll(dst, 0700); err != nil {
+		return "", err
+	}
+	for _, name := range archivedArtifacts {
+		b, err := os.ReadFile(filepath.Join(artDir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue // older deployments may lack some of artifacts
+		}
+		if err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(filepath.Join(dst, name), b, 0644); err != nil {
+			return "", fmt.Errorf("failed to archive %s: %w", name, err)
+		}
+	}
+	return dst, nil
+}
@@ -0,0 +1,282 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modulewriter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/exp/slices"
+)
+
+const (
+	// journalName is the name of the journal of promotion of the staged deployment,
+	// it is written to the staging directory once the deployment is completely staged
+	journalName = ".ghpc-journal.json"
+	// writeInProgressMarker is kept in the artifacts directory while the deployment
+	// is being promoted, so other commands do not use a partially written deployment
+	writeInProgressMarker = "WRITE_IN_PROGRESS"
+)
+
+// Operations of the promotion journal
+const (
+	opMkdir    = "mkdir"
+	opRemove   = "remove"
+	opRename   = "rename"
+	opTouch    = "touch"
+	opFinalize = "finalize"
+)
+
+// journalOp is an idempotent step of the promotion. Paths are relative to the parent
+// of the deployment directory, which contains both deployment and staging directories.
+type journalOp struct {
+	Op   string `json:"op"`
+	Path string `json:"path,omitempty"`
+	Src  string `json:"src,omitempty"` // source of rename, Path is the destination
+}
+
+type journal struct {
+	Next int         `json:"next"` // index of the first operation that is not done
+	Ops  []journalOp `json:"ops"`
+}
+
+// stagingDir returns the directory the deployment is staged in before promotion,
+// it is a sibling of the deployment directory to be on the same file system.
+func stagingDir(deploymentDir string) (string, error) {
+	abs, err := filepath.Abs(deploymentDir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(abs), fmt.Sprintf(".%s.ghpc-staging", filepath.Base(abs))), nil
+}
+
+func stagedFilesDir(deploymentDir string) string {
+	// StagingDir is relative to group folders ("../.ghpc/staged")
+	return filepath.Join(deploymentDir, "any_group_dir", config.StagingDir)
+}
+
+func dirExists(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
+
+func markWriteInProgress(artifactsDir string) error {
+	return os.WriteFile(filepath.Join(artifactsDir, writeInProgressMarker), []byte{}, 0644)
+}
+
+func interruptedWriteError(deploymentDir string) error {
+	return config.HintError{
+		Err:  fmt.Errorf("writing of deployment folder %q was interrupted", deploymentDir),
+		Hint: "re-run `ghpc create` with --resume to complete it"}
+}
+
+// CheckWriteCompleted returns an error if the deployment with the artifacts directory
+// is being written or its writing was interrupted
+func CheckWriteCompleted(artifactsDir string) error {
+	if _, err := os.Stat(filepath.Join(artifactsDir, writeInProgressMarker)); err == nil {
+		return interruptedWriteError(filepath.Dir(filepath.Dir(filepath.Clean(artifactsDir))))
+	}
+	return nil
+}
+
+func checkNoPendingWrite(deploymentDir string) error {
+	staging, err := stagingDir(deploymentDir)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(staging, journalName)); err == nil {
+		return interruptedWriteError(deploymentDir)
+	}
+	return nil
+}
+
+// planPromotion returns operations moving the staged deployment into the deployment
+// directory. Directories of the existing deployment are moved to previous_deployment_groups,
+// except for `keep` groups.
+func planPromotion(deploymentDir string, staging string, bp config.Blueprint, keep []config.GroupName) (journal, error) {
+	abs, err := filepath.Abs(deploymentDir)
+	if err != nil {
+		return journal{}, err
+	}
+	depl, stg := filepath.Base(abs), filepath.Base(staging)
+	ghpc := filepath.Join(depl, HiddenGhpcDirName)
+	prev := filepath.Join(ghpc, prevGroupDirName)
+	artifacts := filepath.Join(ghpc, ArtifactsDirName)
+
+	ops := []journalOp{{Op: opMkdir, Path: depl}}
+	if dirExists(ArtifactsDir(deploymentDir)) {
+		ops = append(ops, journalOp{Op: opTouch, Path: filepath.Join(artifacts, writeInProgressMarker)})
+	}
+	ops = append(ops,
+		journalOp{Op: opMkdir, Path: ghpc},
+		journalOp{Op: opRemove, Path: prev},
+		journalOp{Op: opMkdir, Path: prev})
+
+	kept := map[string]bool{}
+	entries, err := os.ReadDir(abs)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return journal{}, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() || e.Name() == HiddenGhpcDirName {
+			continue
+		}
+		if slices.Contains(keep, config.GroupName(e.Name())) {
+			kept[e.Name()] = true
+			continue
+		}
+		ops = append(ops, journalOp{Op: opRename, Src: filepath.Join(depl, e.Name()), Path: filepath.Join(prev, e.Name())})
+	}
+
+	ops = append(ops, journalOp{Op: opRename,
+		Src: filepath.Join(stg, HiddenGhpcDirName, ArtifactsDirName), Path: artifacts})
+	if dirExists(stagedFilesDir(staging)) {
+		rel, err := filepath.Rel(staging, stagedFilesDir(staging))
+		if err != nil {
+			return journal{}, err
+		}
+		ops = append(ops, journalOp{Op: opRename, Src: filepath.Join(stg, rel), Path: filepath.Join(depl, rel)})
+	}
+	for _, g := range bp.Groups {
+		if !kept[string(g.Name)] {
+			ops = append(ops, journalOp{Op: opRename, Src: filepath.Join(stg, string(g.Name)), Path: filepath.Join(depl, string(g.Name))})
+		}
+	}
+	ops = append(ops, journalOp{Op: opRename,
+		Src: filepath.Join(stg, filepath.Base(InstructionsPath(""))), Path: filepath.Join(depl, filepath.Base(InstructionsPath("")))})
+	if _, err := os.Stat(KueueManifestsPath(staging)); err == nil {
+		ops = append(ops, journalOp{Op: opRename, Src: filepath.Join(stg, KueueManifestsName), Path: filepath.Join(depl, KueueManifestsName)})
+	} else { // node pools were removed from the blueprint
+		ops = append(ops, journalOp{Op: opRemove, Path: filepath.Join(depl, KueueManifestsName)})
+	}
+	if _, err := os.Stat(filepath.Join(abs, ".gitignore")); errors.Is(err, os.ErrNotExist) {
+		ops = append(ops, journalOp{Op: opRename, Src: filepath.Join(stg, ".gitignore"), Path: filepath.Join(depl, ".gitignore")})
+	}
+
+	ops = append(ops,
+		journalOp{Op: opFinalize, Path: depl},
+		journalOp{Op: opRemove, Path: filepath.Join(artifacts, writeInProgressMarker)})
+	return journal{Ops: ops}, nil
+}
+
+func saveJournal(staging string, j journal) error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write and rename, so the journal is never partially written
+	tmp := filepath.Join(staging, journalName+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(staging, journalName))
+}
+
+func loadJournal(staging string) (journal, error) {
+	var j journal
+	data, err := os.ReadFile(filepath.Join(staging, journalName))
+	if err != nil {
+		return j, err
+	}
+	if err := json.Unmarshal(data, &j); err != nil {
+		return j, fmt.Errorf("failed to parse journal %s: %w", filepath.Join(staging, journalName), err)
+	}
+	return j, nil
+}
+
+// apply performs the operation, it's safe to repeat an operation that is already done
+func (op journalOp) apply(parent string, bp *config.Blueprint) error {
+	path := filepath.Join(parent, op.Path)
+	switch op.Op {
+	case opMkdir:
+		return os.MkdirAll(path, 0755)
+	case opRemove:
+		return os.RemoveAll(path)
+	case opTouch:
+		return os.WriteFile(path, []byte{}, 0644)
+	case opRename:
+		src := filepath.Join(parent, op.Src)
+		if _, err := os.Lstat(src); errors.Is(err, os.ErrNotExist) {
+			if _, err := os.Lstat(path); err == nil {
+				return nil // already moved
+			}
+			return fmt.Errorf("neither %s nor %s exist", src, path)
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		return os.Rename(src, path)
+	case opFinalize:
+		if bp == nil { // resumed write, use the blueprint of the promoted deployment
+			loaded, _, err := config.NewBlueprint(filepath.Join(ArtifactsDir(path), ExpandedBlueprintName))
+			if err != nil {
+				return err
+			}
+			if err := DecryptBlueprintVars(&loaded, ArtifactsDir(path)); err != nil {
+				return err
+			}
+			if err := loaded.Materialize(); err != nil {
+				return err
+			}
+			bp = &loaded
+		}
+		return finalizeDeployment(path, *bp)
+	default:
+		return fmt.Errorf("unknown journal operation %q", op.Op)
+	}
+}
+
+// promote performs operations of the journal that are not done yet, and removes
+// the staging directory. The blueprint is nil if the write is resumed.
+func promote(deploymentDir string, bp *config.Blueprint) error {
+	staging, err := stagingDir(deploymentDir)
+	if err != nil {
+		return err
+	}
+	j, err := loadJournal(staging)
+	if err != nil {
+		return err
+	}
+	parent := filepath.Dir(staging)
+	for ; j.Next < len(j.Ops); j.Next++ {
+		if err := j.Ops[j.Next].apply(parent, bp); err != nil {
+			return config.HintError{
+				Err:  fmt.Errorf("writing of deployment folder %q failed: %w", deploymentDir, err),
+				Hint: "resolve the error and re-run `ghpc create` with --resume to complete it"}
+		}
+		if err := saveJournal(staging, j); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(staging)
+}
+
+// ResumeWrite completes writing of the deployment directory that was interrupted
+// after the deployment was staged. Returns false if there is nothing to resume,
+// a partially staged deployment is removed in this case.
+func ResumeWrite(deploymentDir string) (bool, error) {
+	staging, err := stagingDir(deploymentDir)
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(filepath.Join(staging, journalName)); errors.Is(err, os.ErrNotExist) {
+		return false, os.RemoveAll(staging)
+	}
+	return true, promote(deploymentDir, nil)
+}
@@ -0,0 +1,387 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modulewriter
+
+import (
+	"bytes"
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/logging"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/gocty"
+	"gopkg.in/yaml.v3"
+)
+
+// KueueManifestsName is the name of Kueue manifests generated from GKE node pools,
+// written to the root of the deployment folder.
+const KueueManifestsName = "kueue-manifests.yaml"
+
+const (
+	kueueAPIVersion  = "kueue.x-k8s.io/v1beta1"
+	kueueNamespace   = "default"
+	gkeNodePoolLabel = "cloud.google.com/gke-nodepool"
+	gkeSpotLabel     = "cloud.google.com/gke-spot"
+	gkeGPULabel      = "cloud.google.com/gke-accelerator"
+	gpuResource      = "nvidia.com/gpu"
+)
+
+// defaults of the gke-node-pool module
+const (
+	nodePoolDefaultMachineType = "c2-standard-60"
+	nodePoolDefaultMaxNodes    = 1000
+)
+
+var (
+	// machineCPUsRe matches number of vCPUs of predefined and custom machine types,
+	// e.g. "c2-standard-60", "n2-custom-8-16384", "c3-standard-8-lssd" and "a2-highgpu-2g"
+	machineCPUsRe  = regexp.MustCompile(`^([a-z0-9]+(?:-[a-z]+)*?)-(?:custom-)?(\d+)(g?)(?:-\d+|-lssd)?$`)
+	kueueNameBadRe = regexp.MustCompile(`[^a-z0-9-]+`)
+	// cpusPerGPU are vCPUs per GPU of accelerator optimized machine types, which are named by number of GPUs
+	cpusPerGPU = map[string]int{"a2-highgpu": 12, "a2-megagpu": 6, "a2-ultragpu": 12, "a3-highgpu": 26, "a3-megagpu": 26, "a3-edgegpu": 26}
+	// nodePoolDefaultTaint is toleration of the default taint of the gke-node-pool module
+	nodePoolDefaultTaint = kueueToleration{Key: "user-workload", Operator: "Equal", Value: "true", Effect: "NoSchedule"}
+	// taintEffects translates effects of GKE taints into Kubernetes ones
+	taintEffects = map[string]string{"NO_SCHEDULE": "NoSchedule", "PREFER_NO_SCHEDULE": "PreferNoSchedule", "NO_EXECUTE": "NoExecute"}
+)
+
+// KueueManifestsPath returns the path to the Kueue manifests of a deployment
+func KueueManifestsPath(deploymentDir string) string {
+	return filepath.Join(deploymentDir, KueueManifestsName)
+}
+
+type kueueMeta struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+type kueueToleration struct {
+	Key      string `yaml:"key"`
+	Operator string `yaml:"operator"`
+	Value    string `yaml:"value,omitempty"`
+	Effect   string `yaml:"effect,omitempty"`
+}
+
+type kueueObject struct {
+	APIVersion string    `yaml:"apiVersion"`
+	Kind       string    `yaml:"kind"`
+	Metadata   kueueMeta `yaml:"metadata"`
+	Spec       any       `yaml:"spec"`
+}
+
+type resourceFlavorSpec struct {
+	NodeLabels  map[string]string `yaml:"nodeLabels"`
+	Tolerations []kueueToleration `yaml:"tolerations,omitempty"`
+}
+
+type resourceQuota struct {
+	Name         string `yaml:"name"`
+	NominalQuota int    `yaml:"nominalQuota"`
+}
+
+type flavorQuotas struct {
+	Name      string          `yaml:"name"`
+	Resources []resourceQuota `yaml:"resources"`
+}
+
+type resourceGroup struct {
+	CoveredResources []string       `yaml:"coveredResources"`
+	Flavors          []flavorQuotas `yaml:"flavors"`
+}
+
+type clusterQueueSpec struct {
+	NamespaceSelector map[string]string `yaml:"namespaceSelector"`
+	ResourceGroups    []resourceGroup   `yaml:"resourceGroups"`
+}
+
+type localQueueSpec struct {
+	ClusterQueue string `yaml:"clusterQueue"`
+}
+
+// kueueFlavor is a Kueue ResourceFlavor derived from a gke-node-pool module
+type kueueFlavor struct {
+	name        string
+	nodePool    string
+	spot        bool
+	gpuType     string
+	cpus        int // total vCPUs of the node pool at maximal size
+	gpus        int // total GPUs of the node pool at maximal size
+	tolerations []kueueToleration
+}
+
+func isGKENodePool(mod config.Module) bool {
+	return mod.Kind == config.TerraformKind && strings.Contains(mod.Source, "gke-node-pool")
+}
+
+// kueueName turns the string into a valid name of Kubernetes object
+func kueueName(s string) string {
+	n := strings.Trim(kueueNameBadRe.ReplaceAllString(strings.ToLower(s), "-"), "-")
+	if len(n) > 63 {
+		n = strings.TrimRight(n[:63], "-")
+	}
+	return n
+}
+
+// machineCPUs returns number of vCPUs of the machine type, returns false if it is not known
+func machineCPUs(mt string) (int, bool) {
+	m := machineCPUsRe.FindStringSubmatch(mt)
+	if m == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(m[2])
+	if err != nil || n == 0 {
+		return 0, false
+	}
+	if m[3] == "" {
+		return n, true
+	}
+	if c, ok := cpusPerGPU[m[1]]; ok {
+		return n * c, true
+	}
+	return 0, false
+}
+
+// evalNodePoolSetting returns value of the setting, returns false if it is not set
+// or can not be evaluated before deployment
+func evalNodePoolSetting(bp config.Blueprint, mod config.Module, name string) (cty.Value, bool) {
+	if !mod.Settings.Has(name) {
+		return cty.NilVal, false
+	}
+	v, err := bp.Eval(mod.Settings.Get(name))
+	if err != nil || !v.IsWhollyKnown() || v.IsNull() {
+		return cty.NilVal, false
+	}
+	return v, true
+}
+
+func evalNodePoolInt(bp config.Blueprint, mod config.Module, name string) (int, bool) {
+	v, ok := evalNodePoolSetting(bp, mod, name)
+	if !ok {
+		return 0, false
+	}
+	var n int
+	if err := gocty.FromCtyValue(v, &n); err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+func evalNodePoolString(bp config.Blueprint, mod config.Module, name string) (string, bool) {
+	v, ok := evalNodePoolSetting(bp, mod, name)
+	if !ok || v.Type() != cty.String {
+		return "", false
+	}
+	return v.AsString(), true
+}
+
+// nodePoolTolerations returns tolerations of taints of the node pool
+func nodePoolTolerations(bp config.Blueprint, mod config.Module) ([]kueueToleration, error) {
+	if !mod.Settings.Has("taints") {
+		return []kueueToleration{nodePoolDefaultTaint}, nil
+	}
+	v, ok := evalNodePoolSetting(bp, mod, "taints")
+	if !ok {
+		return nil, fmt.Errorf("taints are not known before deployment")
+	}
+	if !v.CanIterateElements() {
+		return nil, fmt.Errorf("taints must be a list")
+	}
+	res := []kueueToleration{}
+	for it := v.ElementIterator(); it.Next(); {
+		_, tv := it.Element()
+		var t struct {
+			Key    string `cty:"key"`
+			Value  string `cty:"value"`
+			Effect string `cty:"effect"`
+		}
+		if err := gocty.FromCtyValue(tv, &t); err != nil {
+			return nil, fmt.Errorf("invalid taint: %w", err)
+		}
+		res = append(res, kueueToleration{Key: t.Key, Operator: "Equal", Value: t.Value, Effect: taintEffects[t.Effect]})
+	}
+	return res, nil
+}
+
+// nodePoolFlavor returns Kueue flavor of the gke-node-pool module
+func nodePoolFlavor(bp config.Blueprint, mod config.Module) (kueueFlavor, error) {
+	mt := nodePoolDefaultMachineType
+	if mod.Settings.Has("machine_type") {
+		var ok bool
+		if mt, ok = evalNodePoolString(bp, mod, "machine_type"); !ok {
+			return kueueFlavor{}, fmt.Errorf("machine_type is not known before deployment")
+		}
+	}
+	name := mt
+	if mod.Settings.Has("name") {
+		var ok bool
+		if name, ok = evalNodePoolString(bp, mod, "name"); !ok {
+			return kueueFlavor{}, fmt.Errorf("name is not known before deployment")
+		}
+	}
+
+	nodes := nodePoolDefaultMaxNodes
+	for _, s := range []string{"static_node_count", "autoscaling_total_max_nodes", "total_max_nodes"} {
+		if n, ok := evalNodePoolInt(bp, mod, s); ok {
+			nodes = n
+			break
+		}
+	}
+	cpus, ok := machineCPUs(mt)
+	if !ok {
+		return kueueFlavor{}, fmt.Errorf("number of vCPUs of machine type %q is not known", mt)
+	}
+
+	f := kueueFlavor{name: kueueName(name), nodePool: name, cpus: cpus * nodes}
+	if v, ok := evalNodePoolSetting(bp, mod, "spot"); ok && v.Type() == cty.Bool {
+		f.spot = v.True()
+	}
+	if v, ok := evalNodePoolSetting(bp, mod, "guest_accelerator"); ok && v.CanIterateElements() && v.LengthInt() > 0 {
+		ga := v.Index(cty.NumberIntVal(0))
+		if !ga.Type().IsObjectType() || !ga.Type().HasAttribute("type") || !ga.Type().HasAttribute("count") {
+			return kueueFlavor{}, fmt.Errorf("guest_accelerator must have type and count")
+		}
+		var count int
+		if err := gocty.FromCtyValue(ga.GetAttr("count"), &count); err != nil {
+			return kueueFlavor{}, fmt.Errorf("invalid count of guest_accelerator: %w", err)
+		}
+		if err := gocty.FromCtyValue(ga.GetAttr("type"), &f.gpuType); err != nil {
+			return kueueFlavor{}, fmt.Errorf("invalid type of guest_accelerator: %w", err)
+		}
+		f.gpus = count * nodes
+	}
+	tols, err := nodePoolTolerations(bp, mod)
+	if err != nil {
+		return kueueFlavor{}, err
+	}
+	f.tolerations = tols
+	return f, nil
+}
+
+// kueueFlavors returns flavors of all gke-node-pool modules of the blueprint. Spot
+// flavors come first, so Kueue prefers cheaper nodes and falls back to on-demand ones.
+// Node pools that are not known before deployment are skipped with a warning.
+func kueueFlavors(bp config.Blueprint) []kueueFlavor {
+	flavors := []kueueFlavor{}
+	seen := map[string]bool{}
+	bp.WalkModulesSafe(func(_ config.ModulePath, mod *config.Module) {
+		if !isGKENodePool(*mod) {
+			return
+		}
+		f, err := nodePoolFlavor(bp, *mod)
+		if err != nil {
+			logging.Warn(logging.Warning{Source: "kueue", Location: fmt.Sprintf("module %s", mod.ID),
+				Message: fmt.Sprintf("no Kueue flavor is generated: %v", err)})
+			return
+		}
+		if seen[f.name] {
+			logging.Warn(logging.Warning{Source: "kueue", Location: fmt.Sprintf("module %s", mod.ID),
+				Message: fmt.Sprintf("no Kueue flavor is generated: flavor %q is already generated", f.name)})
+			return
+		}
+		seen[f.name] = true
+		flavors = append(flavors, f)
+	})
+	sort.SliceStable(flavors, func(i, j int) bool { return flavors[i].spot && !flavors[j].spot })
+	return flavors
+}
+
+// kueueObjects returns ResourceFlavors of the node pools, a ClusterQueue with quotas
+// of all node pools and a LocalQueue submitting to it
+func kueueObjects(bp config.Blueprint, flavors []kueueFlavor) []kueueObject {
+	queue := kueueName(bp.DeploymentName())
+	hasGPU := false
+	for _, f := range flavors {
+		hasGPU = hasGPU || f.gpus > 0
+	}
+	covered := []string{"cpu"}
+	if hasGPU {
+		covered = append(covered, gpuResource)
+	}
+
+	objs := []kueueObject{}
+	quotas := []flavorQuotas{}
+	for _, f := range flavors {
+		labels := map[string]string{gkeNodePoolLabel: f.nodePool}
+		if f.spot {
+			labels[gkeSpotLabel] = "true"
+		}
+		if f.gpuType != "" {
+			labels[gkeGPULabel] = f.gpuType
+		}
+		objs = append(objs, kueueObject{
+			APIVersion: kueueAPIVersion,
+			Kind:       "ResourceFlavor",
+			Metadata:   kueueMeta{Name: f.name},
+			Spec:       resourceFlavorSpec{NodeLabels: labels, Tolerations: f.tolerations}})
+
+		q := flavorQuotas{Name: f.name, Resources: []resourceQuota{{Name: "cpu", NominalQuota: f.cpus}}}
+		if hasGPU {
+			q.Resources = append(q.Resources, resourceQuota{Name: gpuResource, NominalQuota: f.gpus})
+		}
+		quotas = append(quotas, q)
+	}
+
+	return append(objs,
+		kueueObject{
+			APIVersion: kueueAPIVersion,
+			Kind:       "ClusterQueue",
+			Metadata:   kueueMeta{Name: queue},
+			Spec: clusterQueueSpec{
+				NamespaceSelector: map[string]string{}, // match all namespaces
+				ResourceGroups:    []resourceGroup{{CoveredResources: covered, Flavors: quotas}}}},
+		kueueObject{
+			APIVersion: kueueAPIVersion,
+			Kind:       "LocalQueue",
+			Metadata:   kueueMeta{Name: queue, Namespace: kueueNamespace},
+			Spec:       localQueueSpec{ClusterQueue: queue}})
+}
+
+// writeKueueManifests writes Kueue manifests into the directory if the blueprint
+// has GKE node pools, does nothing otherwise
+func writeKueueManifests(dir string, bp config.Blueprint) error {
+	flavors := kueueFlavors(bp)
+	if len(flavors) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, "# Kueue manifests generated by ghpc from GKE node pools of the blueprint, apply")
+	fmt.Fprintln(&buf, "# them once Kueue is installed in the cluster with `kubectl apply --server-side -f`")
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	for _, o := range kueueObjects(bp, flavors) {
+		if err := enc.Encode(o); err != nil {
+			return err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(KueueManifestsPath(dir), buf.Bytes(), 0644)
+}
+
+func writeKueueInstructions(w io.Writer, deploymentDir string) {
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Kueue manifests of GKE node pools were written to %s\n", KueueManifestsPath(deploymentDir))
+	fmt.Fprintln(w, "Once Kueue is installed in the cluster, apply them with:")
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "kubectl apply --server-side -f %s\n", KueueManifestsPath(deploymentDir))
+}
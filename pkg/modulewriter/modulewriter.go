@@ -60,7 +60,6 @@ type ModuleWriter interface {
 		bp config.Blueprint,
 		grpIdx int,
 		groupPath string,
-		instructionsFile io.Writer,
 	) error
 	restoreState(deploymentDir string) error
 	kind() config.ModuleKind
@@ -69,6 +68,7 @@ type ModuleWriter interface {
 var kinds = map[config.ModuleKind]ModuleWriter{
 	config.TerraformKind: new(TFWriter),
 	config.PackerKind:    new(PackerWriter),
+	config.AnsibleKind:   new(AnsibleWriter),
 }
 
 //go:embed *.tmpl
@@ -76,6 +76,36 @@ var templatesFS embed.FS
 
 // WriteDeployment writes a deployment directory using modules defined the environment blueprint.
 func WriteDeployment(bp config.Blueprint, deploymentDir string) error {
+	return WriteDeploymentKeepingGroups(bp, deploymentDir, nil)
+}
+
+// WriteDeploymentKeepingGroups writes a deployment directory like WriteDeployment,
+// but directories of `keep` groups of the existing deployment are left as they are.
+// Groups that are not in the existing deployment are written.
+//
+// The deployment is written to a staging directory next to the deployment directory
+// first, and then promoted to the deployment directory following a journal, so an
+// interrupted write can be completed with ResumeWrite.
+func WriteDeploymentKeepingGroups(bp config.Blueprint, deploymentDir string, keep []config.GroupName) error {
+	if err := checkNoPendingWrite(deploymentDir); err != nil {
+		return err
+	}
+	if _, err := os.Stat(deploymentDir); err == nil {
+		// Confirm we have a previously written deployment dir before overwriting.
+		if _, err := os.Stat(HiddenGhpcDir(deploymentDir)); os.IsNotExist(err) {
+			return fmt.Errorf("while trying to update the deployment directory at %s, the '.ghpc/' dir could not be found", deploymentDir)
+		}
+	}
+
+	staging, err := stagingDir(deploymentDir)
+	if err != nil {
+		return err
+	}
+	// remove leftovers of a write interrupted before the deployment was completely staged
+	if err := os.RemoveAll(staging); err != nil {
+		return err
+	}
+
 	expanded := bp.Clone() // clone to avoid modifying the original blueprint
 
 	// TODO: probably not a right place to do "materialize". Consider bubbling it up.
@@ -83,33 +113,67 @@ func WriteDeployment(bp config.Blueprint, deploymentDir string) error {
 		return err
 	}
 
-	if err := prepDepDir(deploymentDir); err != nil {
+	if err := stageDeployment(bp, expanded, staging, deploymentDir); err != nil {
+		os.RemoveAll(staging)
+		return err
+	}
+	j, err := planPromotion(deploymentDir, staging, bp, keep)
+	if err != nil {
+		os.RemoveAll(staging)
 		return err
 	}
+	if err := saveJournal(staging, j); err != nil {
+		os.RemoveAll(staging)
+		return err
+	}
+	return promote(deploymentDir, &bp)
+}
 
-	if err := stageFiles(bp, deploymentDir); err != nil {
+// stageDeployment writes the deployment into the staging directory, paths in
+// instructions refer to the deployment directory
+func stageDeployment(bp config.Blueprint, expanded config.Blueprint, staging string, deploymentDir string) error {
+	if err := prepDepDir(staging); err != nil {
+		return err
+	}
+	if err := markWriteInProgress(ArtifactsDir(staging)); err != nil {
 		return err
 	}
 
-	instructions, err := os.Create(InstructionsPath(deploymentDir))
-	if err != nil {
+	// keep previously staged files, see stageFile
+	if prev := stagedFilesDir(deploymentDir); dirExists(prev) {
+		if err := copy.Copy(prev, stagedFilesDir(staging)); err != nil {
+			return err
+		}
+	}
+	if err := stageFiles(bp, staging); err != nil {
 		return err
 	}
-	defer instructions.Close()
-	fmt.Fprintln(instructions, "Advanced Deployment Instructions")
-	fmt.Fprintln(instructions, "================================")
 
 	for ig := range bp.Groups {
-		if err := writeGroup(deploymentDir, bp, ig, instructions); err != nil {
+		if err := writeGroup(staging, bp, ig); err != nil {
 			return err
 		}
 	}
 
-	writeDestroyInstructions(instructions, bp, deploymentDir)
-
-	if err := writeExpandedBlueprint(deploymentDir, expanded); err != nil {
+	if err := writeKueueManifests(staging, bp); err != nil {
+		return fmt.Errorf("failed to write %s: %w", KueueManifestsName, err)
+	}
+	if err := writeInstructions(staging, bp, deploymentDir); err != nil {
 		return err
 	}
+	return writeExpandedBlueprint(staging, expanded)
+}
+
+// finalizeDeployment writes artifacts describing the promoted deployment and restores
+// Terraform state of the previous deployment
+func finalizeDeployment(deploymentDir string, bp config.Blueprint) error {
+	if err := writeVendoredManifest(deploymentDir, bp); err != nil {
+		return fmt.Errorf("failed to record checksums of modules: %w", err)
+	}
+
+	if err := writeArtifactsManifest(deploymentDir, bp); err != nil {
+		return fmt.Errorf("failed to write %s: %w", ArtifactsManifestName, err)
+	}
 
 	for _, writer := range kinds {
 		if err := writer.restoreState(deploymentDir); err != nil {
@@ -119,6 +183,60 @@ func WriteDeployment(bp config.Blueprint, deploymentDir string) error {
 	return nil
 }
 
+// writeInstructions writes instructions.txt into the directory, paths in
+// instructions refer to the deployment directory
+func writeInstructions(dir string, bp config.Blueprint, deploymentDir string) error {
+	instructions, err := os.Create(InstructionsPath(dir))
+	if err != nil {
+		return err
+	}
+	defer instructions.Close()
+	fmt.Fprintln(instructions, "Advanced Deployment Instructions")
+	fmt.Fprintln(instructions, "================================")
+	if w := devModulesWarning(); w != "" {
+		fmt.Fprintln(instructions)
+		fmt.Fprint(instructions, w)
+	}
+
+	for ig := range bp.Groups {
+		if err := writeGroupInstructions(instructions, bp, ig, deploymentDir); err != nil {
+			return err
+		}
+	}
+
+	if _, err := os.Stat(KueueManifestsPath(dir)); err == nil {
+		writeKueueInstructions(instructions, deploymentDir)
+	}
+	writeDestroyInstructions(instructions, bp, deploymentDir)
+	return nil
+}
+
+func writeGroupInstructions(w io.Writer, bp config.Blueprint, gIdx int, deploymentDir string) error {
+	g := bp.Groups[gIdx]
+	gPath := filepath.Join(deploymentDir, string(g.Name))
+	switch g.Kind() {
+	case config.TerraformKind:
+		multiGroupDeployment := len(bp.Groups) > 1
+		printImportInputs := multiGroupDeployment && gIdx > 0
+		printExportOutputs := multiGroupDeployment && gIdx < len(bp.Groups)-1
+		writeTerraformInstructions(w, gPath, g.Name, printExportOutputs, printImportInputs, bp.TfvarsEncryption.Enabled())
+	case config.PackerKind, config.AnsibleKind:
+		mod := g.Modules[0] // packer and ansible groups only have one module
+		ds, err := DeploymentSource(mod)
+		if err != nil {
+			return err
+		}
+		if g.Kind() == config.PackerKind {
+			printPackerInstructions(w, gPath, ds, hasIntergroupSettings(bp, mod))
+		} else {
+			printAnsibleInstructions(w, gPath, ds, mod.ID, hasIntergroupSettings(bp, mod))
+		}
+	default:
+		return fmt.Errorf("invalid kind in deployment group %q, got %q", g.Name, g.Kind())
+	}
+	return nil
+}
+
 func stageFiles(bp config.Blueprint, deplPath string) error {
 	staged := bp.StagedFiles()
 	if len(staged) == 0 {
@@ -169,13 +287,13 @@ func stageFile(deplPath string, f config.StagedFile) error {
 	if !srcExists && dstExists {
 		// We implement this relaxation for cases where user does not have access to the original blueprint,
 		// and does re-creation using expanded blueprint.
-		logging.Error("WARNING: file %s does not exists, proceeding by using previously staged copy", f.AbsSrc)
+		logging.Warnf("ghpc create", "file %s does not exists, proceeding by using previously staged copy", f.AbsSrc)
 		return nil
 	}
 	return copy.Copy(f.AbsSrc, dst)
 }
 
-func writeGroup(deplPath string, bp config.Blueprint, gIdx int, instructions io.Writer) error {
+func writeGroup(deplPath string, bp config.Blueprint, gIdx int) error {
 	g := bp.Groups[gIdx]
 	gPath, err := createGroupDir(deplPath, g)
 	if err != nil {
@@ -191,7 +309,7 @@ func writeGroup(deplPath string, bp config.Blueprint, gIdx int, instructions io.
 		return fmt.Errorf("invalid kind in deployment group %q, got %q", g.Name, g.Kind())
 	}
 
-	if err := writer.writeGroup(bp, gIdx, gPath, instructions); err != nil {
+	if err := writer.writeGroup(bp, gIdx, gPath); err != nil {
 		return fmt.Errorf("error writing deployment group %s: %w", g.Name, err)
 	}
 	return nil
@@ -217,9 +335,13 @@ func createGroupDir(deplPath string, g config.Group) (string, error) {
 // Rules are following:
 //   - remote source
 //     = terraform => <mod.Source>
-//     = packer    => <mod.ID>/<package_subdir>
-//   - packer
+//     = packer, ansible => <mod.ID>/<package_subdir>
+//   - packer, ansible
 //     => <mod.ID>
+//   - helm
+//     => ./modules/helm-release
+//   - script
+//     => ./modules/script-<mod.ID>
 //   - embedded (source starts with "modules" or "community/modules")
 //     => ./modules/embedded/<mod.Source>
 //   - other
@@ -228,8 +350,12 @@ func DeploymentSource(mod config.Module) (string, error) {
 	switch mod.Kind {
 	case config.TerraformKind:
 		return tfDeploymentSource(mod)
-	case config.PackerKind:
-		return packerDeploymentSource(mod), nil
+	case config.PackerKind, config.AnsibleKind:
+		return standaloneDeploymentSource(mod), nil
+	case config.HelmKind:
+		return helmReleaseSource, nil
+	case config.ScriptKind:
+		return scriptModuleSource(mod), nil
 	default:
 		return "", fmt.Errorf("unexpected module kind %#v", mod.Kind)
 	}
@@ -252,7 +378,7 @@ func tfDeploymentSource(mod config.Module) (string, error) {
 	}
 }
 
-func packerDeploymentSource(mod config.Module) string {
+func standaloneDeploymentSource(mod config.Module) string {
 	if sourcereader.IsRemotePath(mod.Source) {
 		_, subDir := getter.SourceDirSubdir(mod.Source)
 		return filepath.Join(string(mod.ID), subDir)
@@ -270,6 +396,14 @@ func copyEmbeddedModules(base string) error {
 	r := sourcereader.EmbeddedSourceReader{}
 	for _, src := range []string{"modules", "community/modules"} {
 		dst := filepath.Join(base, "modules/embedded", src)
+		if dev, ok, err := devEmbeddedSource(src); err != nil {
+			return err
+		} else if ok {
+			if err := linkModule(dev, dst); err != nil {
+				return err
+			}
+			continue
+		}
 		if err := os.MkdirAll(dst, 0755); err != nil {
 			return err
 		}
@@ -285,6 +419,18 @@ func copyGroupSources(gPath string, g config.Group) error {
 	var copyEmbedded = false
 	for iMod := range g.Modules {
 		mod := &g.Modules[iMod]
+		if mod.Kind == config.HelmKind {
+			if err := copyHelmSources(gPath, *mod); err != nil {
+				return err
+			}
+			continue
+		}
+		if mod.Kind == config.ScriptKind {
+			if err := writeScriptModule(gPath, *mod); err != nil {
+				return err
+			}
+			continue
+		}
 		deplSource, err := DeploymentSource(*mod)
 		if err != nil {
 			return err
@@ -304,7 +450,7 @@ func copyGroupSources(gPath string, g config.Group) error {
 		/* Copy source files */
 		var src, dst string
 
-		if sourcereader.IsRemotePath(mod.Source) && mod.Kind == config.PackerKind {
+		if sourcereader.IsRemotePath(mod.Source) && mod.Kind.IsStandalone() {
 			src, _ = getter.SourceDirSubdir(mod.Source)
 			dst = filepath.Join(gPath, string(mod.ID))
 		} else {
@@ -314,6 +460,15 @@ func copyGroupSources(gPath string, g config.Group) error {
 		if _, err := os.Stat(dst); err == nil {
 			continue
 		}
+		// standalone modules are always copied, files are generated into their directories
+		if dev, ok, err := devModuleSource(src); err != nil {
+			return err
+		} else if ok && !mod.Kind.IsStandalone() {
+			if err := linkModule(dev, dst); err != nil {
+				return err
+			}
+			continue
+		}
 		reader := sourcereader.Factory(src)
 		if err := reader.GetModule(src, dst); err != nil {
 			return fmt.Errorf("failed to get module from %s to %s: %w", src, dst, err)
@@ -406,7 +561,15 @@ func prepArtifactsDir(artifactsDir string) error {
 	return err
 }
 
+// writeExpandedBlueprint writes the expanded blueprint, values of variables selected
+// by `tfvars_encryption` are written encrypted to EncryptedVarsName instead
 func writeExpandedBlueprint(depDir string, bp config.Blueprint) error {
+	if secret := redactEncryptedVars(&bp); len(secret) > 0 {
+		path := filepath.Join(ArtifactsDir(depDir), EncryptedVarsName)
+		if err := writeEncryptedVars(secret, path, bp.TfvarsEncryption.KmsKey); err != nil {
+			return err
+		}
+	}
 	return bp.Export(filepath.Join(ArtifactsDir(depDir), ExpandedBlueprintName))
 }
 
@@ -17,14 +17,19 @@ limitations under the License.
 package modulewriter
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"hpc-toolkit/pkg/config"
 	"hpc-toolkit/pkg/deploymentio"
 	"hpc-toolkit/pkg/modulereader"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/hashicorp/hcl/v2/ext/typeexpr"
@@ -78,13 +83,20 @@ func (s *zeroSuite) TestPrepDepDir(c *C) {
 func (s *zeroSuite) TestPrepDepDir_OverwriteRealDep(c *C) {
 	// Test with a real deployment previously written
 	bp := config.Blueprint{
-		Vars:   config.Dict{}.With("deployment_name", cty.StringVal("test_prep_dir")),
-		Groups: []config.Group{{Name: "ozon"}},
+		Vars: config.Dict{}.With("deployment_name", cty.StringVal("test_prep_dir")),
+		Groups: []config.Group{{
+			Name: "ozon",
+			Modules: []config.Module{{
+				Source: "some/path",
+				ID:     "whole",
+				Kind:   config.TerraformKind,
+			}},
+		}},
 	}
 	depDir := filepath.Join(c.MkDir(), "test_prep_dir")
 
 	// writes a full deployment w/ actual resource groups
-	WriteDeployment(bp, depDir)
+	c.Assert(WriteDeployment(bp, depDir), IsNil)
 
 	// confirm existence of resource groups (beyond .ghpc dir)
 	files, _ := os.ReadDir(depDir)
@@ -100,7 +112,7 @@ func (s *zeroSuite) TestPrepDepDir_OverwriteRealDep(c *C) {
 	c.Check(len(files1) > 0, Equals, true)
 
 	files2, _ := os.ReadDir(depDir)
-	c.Check(files2, HasLen, 3) // .ghpc, .gitignore, and instructions file
+	c.Check(files2, HasLen, 4) // .ghpc, .gitignore, instructions and artifacts manifest
 }
 
 // modulewriter.go
@@ -285,6 +297,27 @@ func (s *zeroSuite) TestWriteMain(c *C) {
 		c.Assert(err, IsNil)
 		c.Assert(exists, Equals, true)
 	}
+
+	{ // Test with destroy protection
+		protected := mods[0]
+		protected.DestroyProtection = true
+		err := writeMain([]config.Module{protected}, noBe, testMainDir)
+		c.Assert(err, IsNil)
+		b, err := os.ReadFile(mainFilePath)
+		c.Assert(err, IsNil)
+		c.Check(string(b), Matches, `(?s).*
+resource "terraform_data" "destroy_protection_test_module" {
+  depends_on = \[module.test_module\]
+
+  lifecycle {
+    prevent_destroy = true
+  }
+}
+`)
+		c.Check(DestroyProtectionAddress("test_module"), Equals, "terraform_data.destroy_protection_test_module")
+		c.Check(terraformVersion([]config.Module{protected}), Equals, ">= 1.4")
+		c.Check(terraformVersion(mods), Equals, ">= 1.2")
+	}
 }
 
 func (s *zeroSuite) TestWriteOutputs(c *C) {
@@ -379,6 +412,18 @@ func (s *zeroSuite) TestGetProviders(c *C) {
 				{alias: "google", source: "hashicorp/google", version: "~> 4.84.0", config: allSet},
 				{alias: "google-beta", source: "hashicorp/google-beta", version: "~> 4.84.0", config: allSet}})
 	}
+
+	{ // impersonation
+		impersonate := config.NewDict(map[string]cty.Value{
+			"impersonate_service_account": cty.StringVal("tf@prj.iam.gserviceaccount.com"),
+		})
+		c.Check(
+			getProviders(config.Blueprint{
+				CredentialsPolicy: config.CredentialsPolicy{ImpersonateServiceAccount: "tf@prj.iam.gserviceaccount.com"},
+			}), DeepEquals, []provider{
+				{alias: "google", source: "hashicorp/google", version: "~> 4.84.0", config: impersonate},
+				{alias: "google-beta", source: "hashicorp/google-beta", version: "~> 4.84.0", config: impersonate}})
+	}
 }
 
 func (s *zeroSuite) TestWriteProviders(c *C) {
@@ -418,6 +463,8 @@ func (s *zeroSuite) TestKind(c *C) {
 	c.Assert(tfw.kind(), Equals, config.TerraformKind)
 	pkrw := PackerWriter{}
 	c.Assert(pkrw.kind(), Equals, config.PackerKind)
+	answ := AnsibleWriter{}
+	c.Assert(answ.kind(), Equals, config.AnsibleKind)
 }
 
 func (s *zeroSuite) TestWriteDeploymentGroup_PackerWriter(c *C) {
@@ -451,11 +498,148 @@ func (s *zeroSuite) TestWriteDeploymentGroup_PackerWriter(c *C) {
 	if err := deploymentio.CreateDirectory(moduleDir); err != nil {
 		c.Fatal(err)
 	}
+	c.Assert(testWriter.writeGroup(bp, 1, dir), IsNil)
+	_, err := os.Stat(filepath.Join(moduleDir, packerAutoVarFilename))
+	c.Assert(err, IsNil)
+}
+
+func (s *zeroSuite) TestWriteDeploymentGroup_AnsibleWriter(c *C) {
+	otherMod := config.Module{ID: "tortoise"}
+	mod := config.Module{
+		Kind: config.AnsibleKind,
+		ID:   "hare",
+		Settings: config.NewDict(map[string]cty.Value{
+			"zebra":  cty.StringVal("checker"),                                      // const
+			"salmon": config.GlobalRef("golf").AsValue(),                            // var
+			"bear":   config.Reference{Module: otherMod.ID, Name: "rome"}.AsValue(), // IGC
+		}),
+	}
+	bp := config.Blueprint{
+		Vars: config.NewDict(map[string]cty.Value{"golf": cty.NumberIntVal(17)}),
+		Groups: []config.Group{
+			{Name: "bread", Modules: []config.Module{otherMod}},
+			{Name: "green", Modules: []config.Module{mod}},
+		},
+	}
+
+	dir := c.MkDir()
+	moduleDir := filepath.Join(dir, string(mod.ID))
+	c.Assert(os.Mkdir(moduleDir, 0755), IsNil)
+	c.Assert(AnsibleWriter{}.writeGroup(bp, 1, dir), IsNil)
+	vars, err := os.ReadFile(filepath.Join(moduleDir, ansibleExtraVarsFilename))
+	c.Assert(err, IsNil)
+	c.Check(string(vars), Equals, "{\n  \"salmon\": 17,\n  \"zebra\": \"checker\"\n}")
+	inv, err := os.ReadFile(filepath.Join(moduleDir, AnsibleInventoryFilename))
+	c.Assert(err, IsNil)
+	c.Check(string(inv), Matches, `(?s).*localhost:.*ansible_connection: local.*`)
+
 	instructions := new(strings.Builder)
+	c.Assert(writeGroupInstructions(instructions, bp, 1, "depl"), IsNil)
+	c.Check(instructions.String(), Matches,
+		`(?s).*ghpc import-inputs .*ansible-playbook -i inventory.yaml -e @defaults.extra-vars.json -e @hare_inputs.extra-vars.json playbook.yml.*`)
+}
 
-	c.Assert(testWriter.writeGroup(bp, 1, dir, instructions), IsNil)
-	_, err := os.Stat(filepath.Join(moduleDir, packerAutoVarFilename))
+func (s *zeroSuite) TestWriteAnsibleVars(c *C) {
+	dir := c.MkDir()
+	{ // list of hosts
+		vars := map[string]cty.Value{
+			"inventory": cty.TupleVal([]cty.Value{cty.StringVal("10.0.0.2")}),
+			"x":         cty.True}
+		c.Assert(WriteAnsibleVars(vars, dir, "x.json"), IsNil)
+		inv, err := os.ReadFile(filepath.Join(dir, AnsibleInventoryFilename))
+		c.Assert(err, IsNil)
+		c.Check(string(inv), Equals, "all:\n    hosts:\n        10.0.0.2: null\n")
+		got, err := os.ReadFile(filepath.Join(dir, "x.json"))
+		c.Assert(err, IsNil)
+		c.Check(string(got), Equals, "{\n  \"x\": true\n}")
+	}
+
+	{ // groups of hosts
+		vars := map[string]cty.Value{
+			"inventory": cty.ObjectVal(map[string]cty.Value{
+				"login": cty.TupleVal([]cty.Value{cty.StringVal("l0")})})}
+		c.Assert(WriteAnsibleVars(vars, dir, "x.json"), IsNil)
+		inv, err := os.ReadFile(filepath.Join(dir, AnsibleInventoryFilename))
+		c.Assert(err, IsNil)
+		c.Check(string(inv), Equals, "all:\n    children:\n        login:\n            hosts:\n                l0: null\n")
+	}
+
+	{ // bad inventory
+		vars := map[string]cty.Value{"inventory": cty.True}
+		c.Check(WriteAnsibleVars(vars, dir, "x.json"), ErrorMatches, `"inventory" setting of ansible module must be .*`)
+	}
+}
+
+func (s *zeroSuite) TestHelmReleaseAttributes(c *C) {
+	{ // chart in repository, release name defaults to module ID
+		m := config.Module{
+			Kind:     config.HelmKind,
+			ID:       "dcgm",
+			Source:   "https://nvidia.github.io/dcgm-exporter/helm-charts//dcgm-exporter",
+			Settings: config.NewDict(map[string]cty.Value{"namespace": cty.StringVal("gpu")})}
+		got, err := helmReleaseAttributes(m)
+		c.Assert(err, IsNil)
+		c.Check(got, DeepEquals, map[string]cty.Value{
+			"namespace":    cty.StringVal("gpu"),
+			"chart":        cty.StringVal("dcgm-exporter"),
+			"repository":   cty.StringVal("https://nvidia.github.io/dcgm-exporter/helm-charts"),
+			"release_name": cty.StringVal("dcgm")})
+	}
+	{ // local chart, explicit release name
+		m := config.Module{
+			Kind:     config.HelmKind,
+			ID:       "mine",
+			Source:   "./charts/mine",
+			Settings: config.NewDict(map[string]cty.Value{"release_name": cty.StringVal("yours")})}
+		got, err := helmReleaseAttributes(m)
+		c.Assert(err, IsNil)
+		c.Check(got["chart"].AsString(), Matches, `^\./charts/mine-\w\w\w\w$`)
+		c.Check(got["release_name"], DeepEquals, cty.StringVal("yours"))
+	}
+}
+
+func (s *zeroSuite) TestCopyHelmSources(c *C) {
+	chart := c.MkDir()
+	c.Assert(os.WriteFile(filepath.Join(chart, "Chart.yaml"), []byte("name: mine\n"), 0644), IsNil)
+	m := config.Module{Kind: config.HelmKind, ID: "mine", Source: chart}
+
+	gPath := c.MkDir()
+	c.Assert(copyHelmSources(gPath, m), IsNil)
+	_, err := os.Stat(filepath.Join(gPath, "modules/helm-release/main.tf"))
+	c.Check(err, IsNil)
+	dst, err := helmLocalChartSource(m)
 	c.Assert(err, IsNil)
+	_, err = os.Stat(filepath.Join(gPath, dst, "Chart.yaml"))
+	c.Check(err, IsNil)
+}
+
+func (s *zeroSuite) TestRenderScriptModule(c *C) {
+	mod := config.Module{ID: "feed", Kind: config.ScriptKind, Source: "./scripts/feed.py"}
+	info := modulereader.ModuleInfo{Inputs: []modulereader.VarInfo{
+		{Name: "animal", Type: cty.String, Description: "Script variable animal", Required: true},
+		{Name: "menu", Type: cty.List(cty.String), Description: "Script variable menu", Default: []interface{}{"hay"}},
+	}}
+
+	got, err := renderScriptModule(mod, info)
+	c.Assert(err, IsNil)
+	tf := string(got)
+	c.Check(tf, Matches, `(?s).*variable "animal" {\s*description = "Script variable animal"\s*type\s*= string\s*}.*`)
+	c.Check(tf, Matches, `(?s).*variable "menu" {.*type\s*= list\(string\)\s*default\s*= \["hay"\].*`)
+	c.Check(tf, Matches, `(?s).*file\("\${path.module}/feed.py"\).*`)
+	c.Check(tf, Matches, `(?s).*"#!/usr/bin/env python3".*json.loads.*`)
+	c.Check(tf, Matches, `(?s).*destination = "feed.py".*`)
+
+	mod.Source = "./scripts/feed.ps1"
+	got, err = renderScriptModule(mod, info)
+	c.Assert(err, IsNil)
+	tf = string(got)
+	c.Check(tf, Matches, `(?s).*format\("\$%s = .*ConvertFrom-Json", k, base64encode\(jsonencode\(v\)\)\).*`)
+	c.Check(tf, Matches, `(?s).*output "windows_startup_ps1" {.*`)
+	c.Check(tf, Not(Matches), `(?s).*(shebang|output "runners").*`)
+
+	mod.Source = "./scripts/feed.rb"
+	_, err = renderScriptModule(mod, info)
+	c.Check(err, NotNil)
 }
 
 func (s *zeroSuite) TestWritePackerAutoVars(c *C) {
@@ -500,6 +684,24 @@ func (s *zeroSuite) TestDeploymentSource(c *C) {
 		c.Check(err, IsNil)
 		c.Check(s, Equals, "image-id/modules/packer/custom-image")
 	}
+	{ // ansible
+		m := config.Module{Kind: config.AnsibleKind, Source: "./playbooks/setup", ID: "setup-id"}
+		s, err := DeploymentSource(m)
+		c.Check(err, IsNil)
+		c.Check(s, Equals, "setup-id")
+	}
+	{ // helm
+		m := config.Module{Kind: config.HelmKind, Source: "oci://registry.k8s.io/kueue/charts/kueue", ID: "kueue"}
+		s, err := DeploymentSource(m)
+		c.Check(err, IsNil)
+		c.Check(s, Equals, "./modules/helm-release")
+	}
+	{ // script
+		m := config.Module{Kind: config.ScriptKind, Source: "./scripts/setup.sh", ID: "setup"}
+		s, err := DeploymentSource(m)
+		c.Check(err, IsNil)
+		c.Check(s, Equals, "./modules/script-setup")
+	}
 	{ // embedded core
 		m := config.Module{Kind: config.TerraformKind, Source: "modules/x/y"}
 		s, err := DeploymentSource(m)
@@ -640,3 +842,545 @@ func (s *zeroSuite) TestStageFile(c *C) {
 	}
 
 }
+
+func (s *zeroSuite) TestDevModules(c *C) {
+	defer func() { DevModulesDir = "" }()
+	dev := c.MkDir()
+	inside := filepath.Join(dev, "modules", "lime")
+	outside := filepath.Join(c.MkDir(), "lemon")
+	for _, d := range []string{inside, outside} {
+		c.Assert(os.MkdirAll(d, 0755), IsNil)
+		c.Assert(os.WriteFile(filepath.Join(d, "main.tf"), []byte("# tf"), 0644), IsNil)
+	}
+
+	{ // off
+		_, ok, err := devModuleSource(inside)
+		c.Check(err, IsNil)
+		c.Check(ok, Equals, false)
+		c.Check(devModulesWarning(), Equals, "")
+	}
+
+	DevModulesDir = dev
+	c.Check(devModulesWarning(), Matches, "(?s)# WARNING: this deployment was created with --dev-modules .*")
+
+	{ // module in dev directory is symlinked
+		g := config.Group{Name: "green", Modules: []config.Module{
+			{ID: "lime", Kind: config.TerraformKind, Source: inside},
+			{ID: "lemon", Kind: config.TerraformKind, Source: outside}}}
+		pg := config.Group{Name: "image", Modules: []config.Module{
+			{ID: "lime", Kind: config.PackerKind, Source: inside}}}
+		gPath := c.MkDir()
+		c.Assert(copyGroupSources(gPath, g), IsNil)
+
+		limeSrc, _ := tfDeploymentSource(g.Modules[0])
+		fi, err := os.Lstat(filepath.Join(gPath, limeSrc))
+		c.Assert(err, IsNil)
+		c.Check(fi.Mode()&os.ModeSymlink != 0, Equals, true)
+		tgt, err := os.Readlink(filepath.Join(gPath, limeSrc))
+		c.Assert(err, IsNil)
+		c.Check(tgt, Equals, inside)
+
+		lemonSrc, _ := tfDeploymentSource(g.Modules[1])
+		fi, err = os.Lstat(filepath.Join(gPath, lemonSrc))
+		c.Assert(err, IsNil)
+		c.Check(fi.IsDir(), Equals, true) // copied
+
+		// generated files of Packer and Ansible modules must not land in the dev directory
+		pgPath := c.MkDir()
+		c.Assert(copyGroupSources(pgPath, pg), IsNil)
+		packerSrc, err := DeploymentSource(pg.Modules[0])
+		c.Assert(err, IsNil)
+		fi, err = os.Lstat(filepath.Join(pgPath, packerSrc))
+		c.Assert(err, IsNil)
+		c.Check(fi.Mode()&os.ModeSymlink == 0 && fi.IsDir(), Equals, true) // copied
+	}
+
+	{ // embedded modules are symlinked if dev directory has them
+		base := c.MkDir()
+		_, ok, err := devEmbeddedSource("community/modules")
+		c.Check(err, IsNil)
+		c.Check(ok, Equals, false)
+
+		src, ok, err := devEmbeddedSource("modules")
+		c.Assert(err, IsNil)
+		c.Check(ok, Equals, true)
+		c.Assert(linkModule(src, filepath.Join(base, "modules/embedded/modules")), IsNil)
+		_, err = os.Stat(filepath.Join(base, "modules/embedded/modules/lime/main.tf"))
+		c.Check(err, IsNil)
+	}
+
+	{ // banner is added to generated files
+		p := filepath.Join(c.MkDir(), "main.tf")
+		c.Assert(writeHclFile(p, hclwrite.NewEmptyFile()), IsNil)
+		b, err := os.ReadFile(p)
+		c.Assert(err, IsNil)
+		c.Check(string(b), Matches, "(?s).*# WARNING: this deployment was created with --dev-modules.*")
+	}
+}
+
+func (s *zeroSuite) TestDiffVendoredModules(c *C) {
+	src := filepath.Join(c.MkDir(), "lime")
+	c.Assert(os.MkdirAll(src, 0755), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(src, "main.tf"), []byte("# main"), 0644), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(src, "outputs.tf"), []byte("# outputs"), 0644), IsNil)
+
+	g := config.Group{Name: "green", Modules: []config.Module{
+		{ID: "lime", Kind: config.TerraformKind, Source: src},
+		{ID: "remote", Kind: config.TerraformKind, Source: "github.com/org/repo//mod"}}}
+	bp := config.Blueprint{Groups: []config.Group{g}}
+	depl := c.MkDir()
+	artDir := ArtifactsDir(depl)
+	c.Assert(os.MkdirAll(artDir, 0755), IsNil)
+	c.Assert(copyGroupSources(filepath.Join(depl, "green"), g), IsNil)
+
+	vms, err := VendoredModules(bp)
+	c.Assert(err, IsNil)
+	c.Assert(vms, HasLen, 1) // remote module is not vendored
+	dir := filepath.Join(depl, filepath.FromSlash(vms[0].Dir))
+
+	{ // no checksums recorded, no differences
+		diffs, err := DiffVendoredModules(depl, artDir, bp)
+		c.Assert(err, IsNil)
+		c.Check(diffs, DeepEquals, []VendorDiff{{Module: vms[0], Modified: nil, Outdated: []string{}}})
+	}
+
+	c.Assert(writeVendoredManifest(depl, bp), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(src, "main.tf"), []byte("# new main"), 0644), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(dir, "outputs.tf"), []byte("# my outputs"), 0644), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(dir, packerAutoVarFilename), []byte("# generated"), 0644), IsNil)
+
+	{ // outdated and locally modified
+		diffs, err := DiffVendoredModules(depl, artDir, bp)
+		c.Assert(err, IsNil)
+		c.Check(diffs, DeepEquals, []VendorDiff{{
+			Module:   vms[0],
+			Recorded: true,
+			Modified: []string{"outputs.tf"},
+			Outdated: []string{"main.tf"}}})
+	}
+
+	{ // no checksums recorded, all differences are reported as outdated
+		c.Assert(os.Remove(filepath.Join(artDir, VendoredManifestName)), IsNil)
+		diffs, err := DiffVendoredModules(depl, artDir, bp)
+		c.Assert(err, IsNil)
+		c.Check(diffs[0].Recorded, Equals, false)
+		c.Check(diffs[0].Outdated, DeepEquals, []string{"main.tf", "outputs.tf"})
+	}
+
+	{ // source is not available
+		c.Assert(os.RemoveAll(src), IsNil)
+		diffs, err := DiffVendoredModules(depl, artDir, bp)
+		c.Assert(err, IsNil)
+		c.Check(diffs[0].Err, ErrorMatches, "module source .* is not available: .*")
+	}
+}
+
+func (s *zeroSuite) TestArchiveArtifacts(c *C) {
+	depl := c.MkDir()
+	artDir := ArtifactsDir(depl)
+	c.Assert(os.MkdirAll(artDir, 0755), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(artDir, ExpandedBlueprintName), []byte("blueprint_name: lime"), 0644), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(artDir, "green_outputs.tfvars"), []byte("x = 1"), 0644), IsNil)
+
+	t := time.Date(2024, 3, 14, 15, 9, 26, 0, time.UTC)
+	archive, err := ArchiveArtifacts(depl, artDir, t)
+	c.Assert(err, IsNil)
+	c.Check(archive, Equals, filepath.Join(HistoryDir(depl), "20240314T150926Z"))
+
+	got, err := os.ReadFile(filepath.Join(archive, ExpandedBlueprintName))
+	c.Assert(err, IsNil)
+	c.Check(string(got), Equals, "blueprint_name: lime")
+	// missing artifacts and outputs are not archived
+	for _, name := range []string{VendoredManifestName, "green_outputs.tfvars"} {
+		_, err := os.Stat(filepath.Join(archive, name))
+		c.Check(os.IsNotExist(err), Equals, true)
+	}
+
+	// history survives re-creation of the artifacts directory
+	c.Assert(prepArtifactsDir(artDir), IsNil)
+	_, err = os.Stat(filepath.Join(archive, ExpandedBlueprintName))
+	c.Check(err, IsNil)
+}
+
+func (s *zeroSuite) TestRestoreBackendInit(c *C) {
+	depl := c.MkDir()
+	c.Assert(os.MkdirAll(filepath.Join(depl, "green"), 0755), IsNil)
+
+	// nothing to restore
+	c.Check(RestoreBackendInit(depl, "green"), IsNil)
+	_, err := os.Stat(filepath.Join(depl, "green", BackendInitFile))
+	c.Check(os.IsNotExist(err), Equals, true)
+
+	prev := filepath.Join(PreviousGroupDir(depl, "green"), BackendInitFile)
+	c.Assert(os.MkdirAll(filepath.Dir(prev), 0755), IsNil)
+	c.Assert(os.WriteFile(prev, []byte(`{"backend": {"type": "gcs"}}`), 0644), IsNil)
+	c.Check(RestoreBackendInit(depl, "green"), IsNil)
+	got, err := os.ReadFile(filepath.Join(depl, "green", BackendInitFile))
+	c.Assert(err, IsNil)
+	c.Check(string(got), Equals, `{"backend": {"type": "gcs"}}`)
+}
+
+func (s *zeroSuite) TestArtifactsManifest(c *C) {
+	mod := func(id config.ModuleID) config.Module {
+		return config.Module{Source: "some/path", ID: id, Kind: config.TerraformKind}
+	}
+	bp := config.Blueprint{
+		GhpcVersion: "v1.2.3",
+		Vars:        config.Dict{}.With("deployment_name", cty.StringVal("green")),
+		Groups: []config.Group{
+			{Name: "ozon", Modules: []config.Module{mod("whole")}},
+			{Name: "zinc", Modules: []config.Module{mod("half")}},
+		},
+	}
+	dir := filepath.Join(c.MkDir(), "depl")
+	c.Assert(WriteDeployment(bp, dir), IsNil)
+
+	data, err := os.ReadFile(ArtifactsManifestPath(dir))
+	c.Assert(err, IsNil)
+	var m ArtifactsManifest
+	c.Assert(json.Unmarshal(data, &m), IsNil)
+
+	c.Check(m.Version, Equals, artifactsManifestVersion)
+	c.Check(m.DeploymentName, Equals, "green")
+	c.Check(m.GhpcVersion, Equals, "v1.2.3")
+	c.Check(m.Groups, DeepEquals, []GroupArtifacts{
+		{Name: "ozon", Kind: "terraform", Dir: "ozon", Commands: []ArtifactCommand{
+			{Dir: "ozon", Args: []string{"terraform", "init"}},
+			{Dir: "ozon", Args: []string{"terraform", "validate"}},
+			{Dir: "ozon", Args: []string{"terraform", "apply"}},
+			{Dir: ".", Args: []string{"ghpc", "export-outputs", "ozon"}},
+		}},
+		{Name: "zinc", Kind: "terraform", Dir: "zinc", Commands: []ArtifactCommand{
+			{Dir: ".", Args: []string{"ghpc", "import-inputs", "zinc"}},
+			{Dir: "zinc", Args: []string{"terraform", "init"}},
+			{Dir: "zinc", Args: []string{"terraform", "validate"}},
+			{Dir: "zinc", Args: []string{"terraform", "apply"}},
+		}},
+	})
+
+	files := map[string]ArtifactFile{}
+	for _, f := range m.Files {
+		files[f.Path] = f
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "ozon", "main.tf"))
+	c.Assert(err, IsNil)
+	c.Check(files["ozon/main.tf"], DeepEquals, ArtifactFile{
+		Path: "ozon/main.tf", Group: "ozon", SHA256: fmt.Sprintf("%x", sha256.Sum256(content))})
+	c.Check(files["instructions.txt"].Group, Equals, config.GroupName(""))
+	c.Check(files[".ghpc/artifacts/expanded_blueprint.yaml"].SHA256, Not(Equals), "")
+
+	// state, previous groups and the manifest itself are not listed
+	c.Assert(os.WriteFile(filepath.Join(dir, "ozon", "terraform.tfstate"), []byte("{}"), 0644), IsNil)
+	c.Assert(WriteDeployment(bp, dir), IsNil)
+	got, err := NewArtifactsManifest(dir, bp)
+	c.Assert(err, IsNil)
+	for _, f := range got.Files {
+		c.Check(strings.HasSuffix(f.Path, ".tfstate"), Equals, false, Commentf(f.Path))
+		c.Check(strings.HasPrefix(f.Path, ".ghpc/"+prevGroupDirName), Equals, false, Commentf(f.Path))
+		c.Check(f.Path, Not(Equals), ArtifactsManifestName)
+	}
+}
+
+func (s *zeroSuite) TestVerifyDeployment(c *C) {
+	mod := func(id config.ModuleID) config.Module {
+		return config.Module{Source: "some/path", ID: id, Kind: config.TerraformKind}
+	}
+	bp := config.Blueprint{
+		Vars: config.Dict{}.With("deployment_name", cty.StringVal("green")),
+		Groups: []config.Group{
+			{Name: "ozon", Modules: []config.Module{mod("whole")}},
+			{Name: "zinc", Modules: []config.Module{mod("half")}},
+		},
+	}
+	dir := filepath.Join(c.MkDir(), "depl")
+	_, err := VerifyDeployment(dir)
+	c.Check(err, ErrorMatches, ".*has no artifacts.json.*")
+
+	c.Assert(WriteDeployment(bp, dir), IsNil)
+	changes, err := VerifyDeployment(dir)
+	c.Assert(err, IsNil)
+	c.Check(changes, HasLen, 0)
+
+	// files written by deployment are not reported
+	for _, f := range []string{"ozon/.terraform.lock.hcl", "zinc/zinc_inputs.auto.tfvars", ".ghpc/artifacts/ozon_outputs.tfvars",
+		"ozon/terraform.tfstate", "ozon/.terraform/modules.json"} {
+		p := filepath.Join(dir, filepath.FromSlash(f))
+		c.Assert(os.MkdirAll(filepath.Dir(p), 0755), IsNil)
+		c.Assert(os.WriteFile(p, []byte("{}"), 0644), IsNil)
+	}
+	c.Assert(os.WriteFile(filepath.Join(dir, "ozon", "main.tf"), []byte("# edited"), 0644), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(dir, "zinc", "extra.tf"), []byte("# added"), 0644), IsNil)
+	c.Assert(os.Remove(filepath.Join(dir, "zinc", "versions.tf")), IsNil)
+
+	changes, err = VerifyDeployment(dir)
+	c.Assert(err, IsNil)
+	c.Check(changes, DeepEquals, []FileChange{
+		{Path: "ozon/main.tf", Group: "ozon", Change: FileModified},
+		{Path: "zinc/extra.tf", Group: "zinc", Change: FileAdded},
+		{Path: "zinc/versions.tf", Group: "zinc", Change: FileMissing},
+	})
+}
+
+func (s *zeroSuite) TestWriteDeploymentKeepingGroups(c *C) {
+	mod := config.Module{Source: "some/path", ID: "whole", Kind: config.TerraformKind}
+	bp := config.Blueprint{
+		Vars: config.Dict{}.With("deployment_name", cty.StringVal("green")),
+		Groups: []config.Group{
+			{Name: "ozon", Modules: []config.Module{mod}},
+			{Name: "zinc", Modules: []config.Module{mod}},
+		},
+	}
+	dir := filepath.Join(c.MkDir(), "depl")
+	c.Assert(WriteDeployment(bp.Clone(), dir), IsNil)
+	for _, g := range []string{"ozon", "zinc"} {
+		c.Assert(os.WriteFile(filepath.Join(dir, g, "main.tf"), []byte("# edited"), 0644), IsNil)
+		c.Assert(os.MkdirAll(filepath.Join(dir, g, ".terraform"), 0755), IsNil)
+	}
+
+	c.Assert(WriteDeploymentKeepingGroups(bp.Clone(), dir, []config.GroupName{"ozon", "new"}), IsNil)
+
+	// kept group is untouched
+	got, err := os.ReadFile(filepath.Join(dir, "ozon", "main.tf"))
+	c.Assert(err, IsNil)
+	c.Check(string(got), Equals, "# edited")
+	_, err = os.Stat(filepath.Join(dir, "ozon", ".terraform"))
+	c.Check(err, IsNil)
+
+	// other group is re-written
+	got, err = os.ReadFile(filepath.Join(dir, "zinc", "main.tf"))
+	c.Assert(err, IsNil)
+	c.Check(string(got), Not(Equals), "# edited")
+	_, err = os.Stat(filepath.Join(dir, "zinc", ".terraform"))
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
+func (s *zeroSuite) TestResumeWrite(c *C) {
+	bp := config.Blueprint{
+		Vars: config.Dict{}.With("deployment_name", cty.StringVal("green")),
+		Groups: []config.Group{{
+			Name:    "ozon",
+			Modules: []config.Module{{Source: "some/path", ID: "whole", Kind: config.TerraformKind}},
+		}},
+	}
+	dir := filepath.Join(c.MkDir(), "depl")
+	c.Assert(WriteDeployment(bp, dir), IsNil)
+	c.Check(CheckWriteCompleted(ArtifactsDir(dir)), IsNil)
+
+	{ // nothing to resume
+		resumed, err := ResumeWrite(dir)
+		c.Check(err, IsNil)
+		c.Check(resumed, Equals, false)
+	}
+
+	// interrupt re-write after old groups were moved away
+	staging, err := stagingDir(dir)
+	c.Assert(err, IsNil)
+	mat := bp.Clone()
+	c.Assert(mat.Materialize(), IsNil)
+	c.Assert(stageDeployment(mat, bp, staging, dir), IsNil)
+	j, err := planPromotion(dir, staging, mat, nil)
+	c.Assert(err, IsNil)
+	for j.Ops[j.Next].Src != filepath.Join(filepath.Base(staging), HiddenGhpcDirName, ArtifactsDirName) {
+		c.Assert(j.Ops[j.Next].apply(filepath.Dir(staging), &mat), IsNil)
+		j.Next++
+	}
+	c.Assert(saveJournal(staging, j), IsNil)
+
+	c.Check(dirExists(filepath.Join(dir, "ozon")), Equals, false)
+	c.Check(CheckWriteCompleted(ArtifactsDir(dir)), NotNil)
+	c.Check(WriteDeployment(bp, dir), ErrorMatches, ".*was interrupted.*")
+
+	resumed, err := ResumeWrite(dir)
+	c.Assert(err, IsNil)
+	c.Check(resumed, Equals, true)
+	c.Check(CheckWriteCompleted(ArtifactsDir(dir)), IsNil)
+	c.Check(dirExists(filepath.Join(dir, "ozon")), Equals, true)
+	c.Check(dirExists(filepath.Join(dir, HiddenGhpcDirName, prevGroupDirName, "ozon")), Equals, true)
+	c.Check(dirExists(staging), Equals, false)
+	_, err = os.Stat(ArtifactsManifestPath(dir))
+	c.Check(err, IsNil)
+
+	// overwriting after resume succeeds
+	c.Check(WriteDeployment(bp, dir), IsNil)
+}
+
+func (s *zeroSuite) TestMachineCPUs(c *C) {
+	for mt, want := range map[string]int{
+		"c2-standard-60": 60, "n2-custom-8-16384": 8, "c3-standard-8-lssd": 8,
+		"a2-highgpu-2g": 24, "a2-megagpu-16g": 96, "a3-highgpu-8g": 208,
+		"e2-medium": 0, "x9-weirdgpu-2g": 0} {
+		got, ok := machineCPUs(mt)
+		c.Check(got, Equals, want, Commentf(mt))
+		c.Check(ok, Equals, want > 0, Commentf(mt))
+	}
+}
+
+func (s *zeroSuite) TestKueueManifests(c *C) {
+	pool := func(id config.ModuleID, settings map[string]cty.Value) config.Module {
+		return config.Module{ID: id, Kind: config.TerraformKind, Source: "community/modules/compute/gke-node-pool", Settings: config.NewDict(settings)}
+	}
+	bp := config.Blueprint{
+		Vars: config.Dict{}.With("deployment_name", cty.StringVal("Green_01")),
+		Groups: []config.Group{{Name: "ozon", Modules: []config.Module{
+			pool("cpu", map[string]cty.Value{"static_node_count": cty.NumberIntVal(2)}),
+			pool("gpu", map[string]cty.Value{
+				"name":                        cty.StringVal("a2_spot"),
+				"machine_type":                cty.StringVal("a2-highgpu-2g"),
+				"spot":                        cty.True,
+				"autoscaling_total_max_nodes": cty.NumberIntVal(3),
+				"taints": cty.TupleVal([]cty.Value{cty.ObjectVal(map[string]cty.Value{
+					"key":    cty.StringVal("nvidia.com/gpu"),
+					"value":  cty.StringVal("present"),
+					"effect": cty.StringVal("NO_SCHEDULE")})}),
+				"guest_accelerator": cty.TupleVal([]cty.Value{cty.ObjectVal(map[string]cty.Value{
+					"type":  cty.StringVal("nvidia-tesla-a100"),
+					"count": cty.NumberIntVal(2)})})}),
+			pool("unknown", map[string]cty.Value{
+				"machine_type": config.MustParseExpression(`module.other.machine_type`).AsValue()}),
+			{ID: "vm", Kind: config.TerraformKind, Source: "modules/compute/vm-instance"},
+		}}},
+	}
+
+	c.Check(kueueFlavors(bp), DeepEquals, []kueueFlavor{
+		{name: "a2-spot", nodePool: "a2_spot", spot: true, gpuType: "nvidia-tesla-a100", cpus: 72, gpus: 6,
+			tolerations: []kueueToleration{{Key: "nvidia.com/gpu", Operator: "Equal", Value: "present", Effect: "NoSchedule"}}},
+		{name: "c2-standard-60", nodePool: "c2-standard-60", cpus: 120, tolerations: []kueueToleration{nodePoolDefaultTaint}},
+	})
+
+	dir := c.MkDir()
+	c.Assert(writeKueueManifests(dir, bp), IsNil)
+	got, err := os.ReadFile(KueueManifestsPath(dir))
+	c.Assert(err, IsNil)
+	c.Check(string(got), Matches, `(?s).*kind: ResourceFlavor.*cloud.google.com/gke-spot: "true".*`)
+	c.Check(string(got), Matches, `(?s).*kind: ClusterQueue\s+metadata:\s+name: green-01.*- cpu\s+- nvidia.com/gpu.*`)
+	c.Check(string(got), Matches, `(?s).*kind: LocalQueue\s+metadata:\s+name: green-01\s+namespace: default\s+spec:\s+clusterQueue: green-01.*`)
+
+	{ // no node pools, no manifests
+		noPools := config.Blueprint{Groups: []config.Group{{Name: "ozon", Modules: bp.Groups[0].Modules[3:]}}}
+		dir := c.MkDir()
+		c.Assert(writeKueueManifests(dir, noPools), IsNil)
+		_, err := os.Stat(KueueManifestsPath(dir))
+		c.Check(os.IsNotExist(err), Equals, true)
+	}
+}
+
+func (s *zeroSuite) TestWriteDeploymentRemovesKueueManifests(c *C) {
+	bp := config.Blueprint{
+		Vars: config.Dict{}.With("deployment_name", cty.StringVal("green")),
+		Groups: []config.Group{{Name: "ozon", Modules: []config.Module{
+			{Source: "some/path", ID: "whole", Kind: config.TerraformKind}}}},
+	}
+	dir := filepath.Join(c.MkDir(), "depl")
+	c.Assert(WriteDeployment(bp.Clone(), dir), IsNil)
+	c.Assert(os.WriteFile(KueueManifestsPath(dir), []byte("# stale"), 0644), IsNil)
+
+	c.Assert(WriteDeployment(bp.Clone(), dir), IsNil)
+	_, err := os.Stat(KueueManifestsPath(dir))
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
+func (s *zeroSuite) TestTfvarsEncryption(c *C) {
+	// reversible stand-ins of Cloud KMS
+	defer func(e, d func(string, []byte) ([]byte, error)) { kmsEncrypt, kmsDecrypt = e, d }(kmsEncrypt, kmsDecrypt)
+	kmsEncrypt = func(key string, p []byte) ([]byte, error) {
+		return []byte(key + ":" + base64.StdEncoding.EncodeToString(p)), nil
+	}
+	kmsDecrypt = func(key string, ct []byte) ([]byte, error) {
+		return base64.StdEncoding.DecodeString(strings.TrimPrefix(string(ct), key+":"))
+	}
+	key := "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+	vars := map[string]cty.Value{
+		"project_id":  cty.StringVal("alpine"),
+		"db_password": cty.StringVal("hunter2")}
+
+	{ // selected variables are encrypted
+		dir := c.MkDir()
+		c.Assert(writeTfvars(vars, dir, config.TfvarsEncryption{KmsKey: key, Keys: []string{"db_password"}}), IsNil)
+		plain, err := os.ReadFile(filepath.Join(dir, "terraform.tfvars"))
+		c.Assert(err, IsNil)
+		c.Check(string(plain), Matches, `(?s).*project_id += "alpine".*`)
+		c.Check(string(plain), Not(Matches), `(?s).*hunter2.*`)
+
+		st, err := os.Stat(filepath.Join(dir, TerraformWrapperName))
+		c.Assert(err, IsNil)
+		c.Check(st.Mode().Perm()&0100, Equals, fs.FileMode(0100))
+
+		varFile, remove, err := DecryptTfvars(dir)
+		c.Assert(err, IsNil)
+		got, err := os.ReadFile(varFile)
+		c.Assert(err, IsNil)
+		c.Check(string(got), Matches, `(?s).*db_password += "hunter2".*`)
+		c.Check(string(got), Not(Matches), `(?s).*alpine.*`)
+		remove()
+		_, err = os.Stat(varFile)
+		c.Check(os.IsNotExist(err), Equals, true)
+	}
+
+	{ // no encryption
+		dir := c.MkDir()
+		c.Assert(writeTfvars(vars, dir, config.TfvarsEncryption{}), IsNil)
+		for _, f := range []string{EncryptedTfvarsName, EncryptedTfvarsKeyName, TerraformWrapperName} {
+			_, err := os.Stat(filepath.Join(dir, f))
+			c.Check(os.IsNotExist(err), Equals, true)
+		}
+		varFile, _, err := DecryptTfvars(dir)
+		c.Check(err, IsNil)
+		c.Check(varFile, Equals, "")
+	}
+}
+
+func (s *zeroSuite) TestEncryptedVarsNotInPlaintext(c *C) {
+	// reversible stand-ins of Cloud KMS
+	defer func(e, d func(string, []byte) ([]byte, error)) { kmsEncrypt, kmsDecrypt = e, d }(kmsEncrypt, kmsDecrypt)
+	kmsEncrypt = func(key string, p []byte) ([]byte, error) {
+		return []byte(key + ":" + base64.StdEncoding.EncodeToString(p)), nil
+	}
+	kmsDecrypt = func(key string, ct []byte) ([]byte, error) {
+		return base64.StdEncoding.DecodeString(strings.TrimPrefix(string(ct), key+":"))
+	}
+	bp := config.Blueprint{
+		Vars: config.NewDict(map[string]cty.Value{
+			"deployment_name": cty.StringVal("green"),
+			"project_id":      cty.StringVal("alpine-secret-project"),
+			"db_password":     cty.StringVal("hunter2-secret-password")}),
+		TfvarsEncryption: config.TfvarsEncryption{
+			KmsKey: "projects/p/locations/global/keyRings/r/cryptoKeys/k",
+			Keys:   []string{"project_id", "db_password"}},
+		Groups: []config.Group{{
+			Name: "ozon",
+			Modules: []config.Module{{
+				Source: "some/path",
+				ID:     "whole",
+				Kind:   config.TerraformKind,
+				Settings: config.NewDict(map[string]cty.Value{
+					"project":  config.GlobalRef("project_id").AsValue(),
+					"password": config.GlobalRef("db_password").AsValue()}),
+			}},
+		}},
+	}
+	dir := filepath.Join(c.MkDir(), "green")
+	c.Assert(WriteDeployment(bp.Clone(), dir), IsNil)
+	_, err := ArchiveArtifacts(dir, ArtifactsDir(dir), time.Now())
+	c.Assert(err, IsNil)
+
+	files := 0
+	c.Assert(filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		files++
+		c.Check(string(b), Not(Matches), `(?s).*-secret-.*`, Commentf(p))
+		return nil
+	}), IsNil)
+	c.Check(files > 5, Equals, true)
+
+	loaded, _, err := config.NewBlueprint(filepath.Join(ArtifactsDir(dir), ExpandedBlueprintName))
+	c.Assert(err, IsNil)
+	c.Check(loaded.Vars.Get("db_password"), DeepEquals, cty.StringVal(EncryptedVarValue))
+	c.Assert(DecryptBlueprintVars(&loaded, ArtifactsDir(dir)), IsNil)
+	c.Check(loaded.Vars.Items(), DeepEquals, bp.Vars.Items())
+}
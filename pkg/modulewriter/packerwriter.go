@@ -50,23 +50,28 @@ func writePackerAutovars(vars map[string]cty.Value, dst string) error {
 	return WriteHclAttributes(vars, filepath.Join(dst, packerAutoVarFilename))
 }
 
+// evalSettingsWithoutIgc evaluates settings of the module that do not refer to
+// other deployment groups, such settings are evaluated by `ghpc import-inputs`.
+func evalSettingsWithoutIgc(bp config.Blueprint, mod config.Module) (config.Dict, error) {
+	pure := map[string]cty.Value{}
+	for setting, v := range mod.Settings.Items() {
+		if len(config.FindIntergroupReferences(v, mod, bp)) == 0 {
+			pure[setting] = v
+		}
+	}
+	return bp.EvalDict(config.NewDict(pure))
+}
+
 // writeGroup writes any needed files to the top and module levels
 // of the blueprint
 func (w PackerWriter) writeGroup(
 	bp config.Blueprint,
 	grpIdx int,
 	groupPath string,
-	instructionsFile io.Writer,
 ) error {
 	mod := bp.Groups[grpIdx].Modules[0] // packer groups only have one module
 
-	pure := map[string]cty.Value{}
-	for setting, v := range mod.Settings.Items() {
-		if len(config.FindIntergroupReferences(v, mod, bp)) == 0 {
-			pure[setting] = v
-		}
-	}
-	av, err := bp.EvalDict(config.NewDict(pure))
+	av, err := evalSettingsWithoutIgc(bp, mod)
 	if err != nil {
 		return err
 	}
@@ -76,13 +81,7 @@ func (w PackerWriter) writeGroup(
 		return err
 	}
 	modPath := filepath.Join(groupPath, ds)
-	if err = writePackerAutovars(av.Items(), modPath); err != nil {
-		return err
-	}
-	hasIgc := len(pure) < len(mod.Settings.Items())
-	printPackerInstructions(instructionsFile, groupPath, ds, hasIgc)
-
-	return nil
+	return writePackerAutovars(av.Items(), modPath)
 }
 
 func (w PackerWriter) restoreState(deploymentDir string) error {
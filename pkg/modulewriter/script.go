@@ -0,0 +1,133 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modulewriter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	ctyJson "github.com/zclconf/go-cty/cty/json"
+
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/modulereader"
+)
+
+// Script modules are rendered into startup-script runners by a Terraform
+// module generated by ghpc for every script module.
+const scriptRunnerTemplate = "script-runner.tf.tmpl"
+
+func scriptModuleSource(mod config.Module) string {
+	return fmt.Sprintf("./modules/script-%s", mod.ID)
+}
+
+type scriptVar struct {
+	Name        string
+	Description string
+	Type        string
+	Default     string // HCL literal, empty if variable is required
+}
+
+// hclLiteral renders value decoded from YAML as HCL literal
+func hclLiteral(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	ty, err := ctyJson.ImpliedType(data)
+	if err != nil {
+		return "", err
+	}
+	val, err := ctyJson.Unmarshal(data, ty)
+	if err != nil {
+		return "", err
+	}
+	return string(hclwrite.TokensForValue(val).Bytes()), nil
+}
+
+// renderScriptModule renders main.tf of the Terraform module of the script module
+func renderScriptModule(mod config.Module, info modulereader.ModuleInfo) ([]byte, error) {
+	lang, err := modulereader.ScriptLanguage(mod.Source)
+	if err != nil {
+		return nil, err
+	}
+	shebang, ext := "#!/bin/bash", ".sh"
+	switch lang {
+	case "python":
+		shebang, ext = "#!/usr/bin/env python3", ".py"
+	case "powershell":
+		shebang, ext = "", ".ps1" // Windows runs startup scripts by metadata key, not by shebang
+	}
+
+	vars := []scriptVar{}
+	for _, in := range info.Inputs {
+		v := scriptVar{
+			Name:        in.Name,
+			Description: string(hclwrite.TokensForValue(cty.StringVal(in.Description)).Bytes()),
+			Type:        typeexpr.TypeString(in.Type),
+		}
+		if !in.Required {
+			if v.Default, err = hclLiteral(in.Default); err != nil {
+				return nil, fmt.Errorf("failed to render default of variable %q: %w", in.Name, err)
+			}
+		}
+		vars = append(vars, v)
+	}
+
+	tmpl, err := template.ParseFS(templatesFS, scriptRunnerTemplate)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, map[string]interface{}{
+		"Source":      mod.Source,
+		"File":        filepath.Base(mod.Source),
+		"Language":    lang,
+		"Shebang":     shebang,
+		"Destination": string(mod.ID) + ext,
+		"Vars":        vars,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hclwrite.Format(buf.Bytes()), nil
+}
+
+// writeScriptModule writes the Terraform module of the script module and copies the script
+func writeScriptModule(gPath string, mod config.Module) error {
+	dst := filepath.Join(gPath, scriptModuleSource(mod))
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	script, err := modulereader.ReadScript(mod.Source)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dst, filepath.Base(mod.Source)), script, 0644); err != nil {
+		return err
+	}
+
+	main, err := renderScriptModule(mod, mod.InfoOrDie())
+	if err != nil {
+		return fmt.Errorf("failed to render module of script %s: %w", mod.Source, err)
+	}
+	return os.WriteFile(filepath.Join(dst, "main.tf"), main, 0644)
+}
@@ -17,6 +17,7 @@
 package modulewriter
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -24,6 +25,7 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/ext/typeexpr"
 	"github.com/hashicorp/hcl/v2/hclwrite"
 	"github.com/zclconf/go-cty/cty"
@@ -37,6 +39,8 @@ import (
 const (
 	tfStateFileName       = "terraform.tfstate"
 	tfStateBackupFileName = "terraform.tfstate.backup"
+	// BackendInitFile records the backend the group was initialized with by `terraform init`
+	BackendInitFile = ".terraform/terraform.tfstate"
 )
 
 // TFWriter writes terraform to the blueprint folder
@@ -48,7 +52,7 @@ func writeHclFile(path string, hclFile *hclwrite.File) error {
 		return fmt.Errorf("error writing %q: %v", path, err)
 	}
 	defer f.Close()
-	if _, err := f.WriteString(license); err != nil {
+	if _, err := f.WriteString(license + devModulesWarning()); err != nil {
 		return fmt.Errorf("error writing %q: %v", path, err)
 	}
 	if _, err := f.Write(hclwrite.Format(hclFile.Bytes())); err != nil {
@@ -95,8 +99,23 @@ func writeOutputs(
 	return writeHclFile(filepath.Join(dst, "outputs.tf"), hclFile)
 }
 
-func writeTfvars(vars map[string]cty.Value, dst string) error {
-	return WriteHclAttributes(vars, filepath.Join(dst, "terraform.tfvars"))
+// writeTfvars writes terraform.tfvars, variables selected by the encryption
+// policy are encrypted and can be passed to terraform by the wrapper script
+func writeTfvars(vars map[string]cty.Value, dst string, enc config.TfvarsEncryption) error {
+	plain, secret := splitEncryptedVars(vars, enc)
+	if err := WriteHclAttributes(plain, filepath.Join(dst, "terraform.tfvars")); err != nil {
+		return err
+	}
+	if !enc.Enabled() {
+		return nil
+	}
+	if err := writeTerraformWrapper(dst); err != nil {
+		return err
+	}
+	if len(secret) == 0 {
+		return nil
+	}
+	return writeEncryptedTfvars(secret, dst, enc.KmsKey)
 }
 
 func relaxVarType(t cty.Type) cty.Type {
@@ -176,16 +195,64 @@ func writeMain(
 		}
 		moduleBody.SetAttributeValue("source", cty.StringVal(ds))
 
+		attrs := mod.Settings.Items()
+		if mod.Kind == config.HelmKind {
+			if attrs, err = helmReleaseAttributes(mod); err != nil {
+				return err
+			}
+		}
+
 		// For each Setting
-		for _, setting := range orderKeys(mod.Settings.Items()) {
-			value := mod.Settings.Get(setting)
-			moduleBody.SetAttributeRaw(setting, config.TokensForValue(value))
+		for _, setting := range orderKeys(attrs) {
+			moduleBody.SetAttributeRaw(setting, config.TokensForValue(attrs[setting]))
+		}
+	}
+
+	for _, mod := range modules {
+		if mod.DestroyProtection {
+			hclBody.AppendNewline()
+			writeDestroyProtection(hclBody, mod.ID)
 		}
 	}
 
 	return writeHclFile(filepath.Join(dst, "main.tf"), hclFile)
 }
 
+// DestroyProtectionAddress returns address of the resource that guards resources
+// of the module against destruction
+func DestroyProtectionAddress(id config.ModuleID) string {
+	return fmt.Sprintf("%s.%s", destroyProtectionType, destroyProtectionName(id))
+}
+
+const destroyProtectionType = "terraform_data"
+
+func destroyProtectionName(id config.ModuleID) string {
+	return "destroy_protection_" + string(id)
+}
+
+// writeDestroyProtection writes a resource that can not be destroyed and depends on
+// the module. Terraform does not support `lifecycle` of modules, but any plan to
+// destroy the module, including targeted one, includes its dependents and fails.
+func writeDestroyProtection(body *hclwrite.Body, id config.ModuleID) {
+	rb := body.AppendNewBlock("resource", []string{destroyProtectionType, destroyProtectionName(id)}).Body()
+	rb.SetAttributeRaw("depends_on", hclwrite.TokensForTuple([]hclwrite.Tokens{
+		hclwrite.TokensForTraversal(hcl.Traversal{hcl.TraverseRoot{Name: "module"}, hcl.TraverseAttr{Name: string(id)}})}))
+	rb.AppendNewline()
+	lb := rb.AppendNewBlock("lifecycle", []string{}).Body()
+	lb.SetAttributeValue("prevent_destroy", cty.True)
+}
+
+// terraformVersion returns required version of Terraform for the modules,
+// `terraform_data` of destroy protection requires Terraform 1.4
+func terraformVersion(modules []config.Module) string {
+	for _, m := range modules {
+		if m.DestroyProtection {
+			return ">= 1.4"
+		}
+	}
+	return ">= 1.2"
+}
+
 type provider struct {
 	alias   string
 	source  string
@@ -203,6 +270,9 @@ func getProviders(bp config.Blueprint) []provider {
 			gglConf = gglConf.With(s, config.GlobalRef(v).AsValue())
 		}
 	}
+	if sa := bp.CredentialsPolicy.ImpersonateServiceAccount; sa != "" {
+		gglConf = gglConf.With("impersonate_service_account", cty.StringVal(sa))
+	}
 
 	return []provider{
 		{"google", "hashicorp/google", "~> 4.84.0", gglConf},
@@ -225,12 +295,12 @@ func writeProviders(providers []provider, dst string) error {
 	return writeHclFile(filepath.Join(dst, "providers.tf"), hclFile)
 }
 
-func writeVersions(providers []provider, dst string) error {
+func writeVersions(providers []provider, version string, dst string) error {
 	f := hclwrite.NewEmptyFile()
 	body := f.Body()
 	body.AppendNewline()
 	tfb := body.AppendNewBlock("terraform", []string{}).Body()
-	tfb.SetAttributeValue("required_version", cty.StringVal(">= 1.2"))
+	tfb.SetAttributeValue("required_version", cty.StringVal(version))
 	tfb.AppendNewline()
 
 	pb := tfb.AppendNewBlock("required_providers", []string{}).Body()
@@ -244,7 +314,7 @@ func writeVersions(providers []provider, dst string) error {
 	return writeHclFile(filepath.Join(dst, "versions.tf"), f)
 }
 
-func writeTerraformInstructions(w io.Writer, grpPath string, n config.GroupName, printExportOutputs bool, printImportInputs bool) {
+func writeTerraformInstructions(w io.Writer, grpPath string, n config.GroupName, printExportOutputs bool, printImportInputs bool, encrypted bool) {
 	fmt.Fprintln(w)
 	fmt.Fprintf(w, "Terraform group '%s' was successfully created in directory %s\n", n, grpPath)
 	fmt.Fprintln(w, "To deploy, run the following commands:")
@@ -252,9 +322,13 @@ func writeTerraformInstructions(w io.Writer, grpPath string, n config.GroupName,
 	if printImportInputs {
 		fmt.Fprintf(w, "ghpc import-inputs %s\n", grpPath)
 	}
-	fmt.Fprintf(w, "terraform -chdir=%s init\n", grpPath)
-	fmt.Fprintf(w, "terraform -chdir=%s validate\n", grpPath)
-	fmt.Fprintf(w, "terraform -chdir=%s apply\n", grpPath)
+	tf := fmt.Sprintf("terraform -chdir=%s", grpPath)
+	if encrypted { // variables are decrypted by the wrapper
+		tf = filepath.Join(grpPath, TerraformWrapperName)
+	}
+	fmt.Fprintf(w, "%s init\n", tf)
+	fmt.Fprintf(w, "%s validate\n", tf)
+	fmt.Fprintf(w, "%s apply\n", tf)
 	if printExportOutputs {
 		fmt.Fprintf(w, "ghpc export-outputs %s\n", grpPath)
 	}
@@ -265,7 +339,6 @@ func (w TFWriter) writeGroup(
 	bp config.Blueprint,
 	groupIndex int,
 	groupPath string,
-	instructions io.Writer,
 ) error {
 	g := bp.Groups[groupIndex]
 	deploymentVars := getUsedDeploymentVars(g, bp)
@@ -296,7 +369,7 @@ func (w TFWriter) writeGroup(
 	}
 
 	// Write terraform.tfvars file
-	if err := writeTfvars(deploymentVars, groupPath); err != nil {
+	if err := writeTfvars(deploymentVars, groupPath, bp.TfvarsEncryption); err != nil {
 		return fmt.Errorf("error writing terraform.tfvars file for deployment group %s: %w", g.Name, err)
 	}
 
@@ -307,16 +380,9 @@ func (w TFWriter) writeGroup(
 	}
 
 	// Write versions.tf file
-	if err := writeVersions(providers, groupPath); err != nil {
+	if err := writeVersions(providers, terraformVersion(g.Modules), groupPath); err != nil {
 		return fmt.Errorf("error writing versions.tf file for deployment group %s: %v", g.Name, err)
 	}
-
-	multiGroupDeployment := len(bp.Groups) > 1
-	printImportInputs := multiGroupDeployment && groupIndex > 0
-	printExportOutputs := multiGroupDeployment && groupIndex < len(bp.Groups)-1
-
-	writeTerraformInstructions(instructions, groupPath, g.Name, printExportOutputs, printImportInputs)
-
 	return nil
 }
 
@@ -346,6 +412,31 @@ func (w TFWriter) restoreState(deploymentDir string) error {
 	return nil
 }
 
+// PreviousGroupDir returns location of the group directory of the previous deployment,
+// it is moved there when the deployment directory is re-written.
+func PreviousGroupDir(deploymentDir string, group config.GroupName) string {
+	return filepath.Join(HiddenGhpcDir(deploymentDir), prevGroupDirName, string(group))
+}
+
+// RestoreBackendInit copies record of the backend the group was initialized with from
+// the previous deployment, so `terraform init -migrate-state` can find the state to migrate.
+// Does nothing if the previous deployment was not initialized or used the local backend.
+func RestoreBackendInit(deploymentDir string, group config.GroupName) error {
+	src := filepath.Join(PreviousGroupDir(deploymentDir, group), BackendInitFile)
+	b, err := os.ReadFile(src)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	dst := filepath.Join(deploymentDir, string(group), BackendInitFile)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, b, 0644)
+}
+
 func orderKeys[T any](settings map[string]T) []string {
 	keys := make([]string, 0, len(settings))
 	for k := range settings {
@@ -0,0 +1,183 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modulewriter
+
+import (
+	"errors"
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/sourcereader"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// VendoredManifestName is the name of the artifact with checksums of module
+// sources copied into the deployment folder, see `ghpc vendor diff`.
+const VendoredManifestName = "vendored_modules.sha256"
+
+// VendoredModule is a module which source code is copied into the deployment folder.
+type VendoredModule struct {
+	Group  config.GroupName
+	ID     config.ModuleID
+	Source string
+	Dir    string // relative to the deployment folder, slash-separated
+}
+
+// VendoredModules returns modules with embedded or local sources that are copied
+// into the deployment folder. Modules with remote sources are not included.
+func VendoredModules(bp config.Blueprint) ([]VendoredModule, error) {
+	res := []VendoredModule{}
+	for _, g := range bp.Groups {
+		for _, mod := range g.Modules {
+			if mod.Kind == config.HelmKind || mod.Kind == config.ScriptKind || sourcereader.IsRemotePath(mod.Source) {
+				continue
+			}
+			ds, err := DeploymentSource(mod)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, VendoredModule{
+				Group:  g.Name,
+				ID:     mod.ID,
+				Source: mod.Source,
+				Dir:    path.Join(string(g.Name), filepath.ToSlash(ds)),
+			})
+		}
+	}
+	return res, nil
+}
+
+// isGeneratedFile tests whether the file in the module directory is written by ghpc
+// or by deployment, rather than copied from the module source.
+func isGeneratedFile(rel string, id config.ModuleID) bool {
+	switch rel {
+	case packerAutoVarFilename, "packer-manifest.json", AnsibleInventoryFilename, AnsibleInputsFilename(id):
+		return true
+	}
+	return rel == ".git" || strings.HasPrefix(rel, ".git/")
+}
+
+// dirManifest computes checksums of the module files in the directory
+func dirManifest(dir string, id config.ModuleID) (sourcereader.Manifest, error) {
+	bfs, ok := os.DirFS(dir).(sourcereader.BaseFS)
+	if !ok { // shouldn't happen
+		return nil, fmt.Errorf("unable to read directory %s", dir)
+	}
+	m, err := sourcereader.NewManifest(bfs)
+	if err != nil {
+		return nil, err
+	}
+	for p := range m {
+		if isGeneratedFile(p, id) {
+			delete(m, p)
+		}
+	}
+	return m, nil
+}
+
+// sourceManifest computes checksums of the current module source
+func sourceManifest(vm VendoredModule) (sourcereader.Manifest, error) {
+	if sourcereader.IsEmbeddedPath(vm.Source) {
+		m, err := sourcereader.EmbeddedManifest()
+		if err != nil {
+			return nil, err
+		}
+		return m.Sub(vm.Source), nil
+	}
+	if _, err := os.Stat(vm.Source); err != nil {
+		return nil, fmt.Errorf("module source %s is not available: %w", vm.Source, err)
+	}
+	return dirManifest(vm.Source, vm.ID)
+}
+
+// writeVendoredManifest records checksums of module sources copied into the deployment
+func writeVendoredManifest(deplDir string, bp config.Blueprint) error {
+	vms, err := VendoredModules(bp)
+	if err != nil {
+		return err
+	}
+	all := sourcereader.Manifest{}
+	for _, vm := range vms {
+		m, err := dirManifest(filepath.Join(deplDir, filepath.FromSlash(vm.Dir)), vm.ID)
+		if err != nil {
+			return err
+		}
+		for p, sum := range m {
+			all[path.Join(vm.Dir, p)] = sum
+		}
+	}
+	return os.WriteFile(filepath.Join(ArtifactsDir(deplDir), VendoredManifestName), []byte(all.String()), 0644)
+}
+
+// VendorDiff describes divergence of the module code in the deployment folder from its source.
+type VendorDiff struct {
+	Module VendoredModule
+	// Recorded is false if the deployment was created without checksums of the copied
+	// module code, in this case local modifications can not be told from changes of
+	// the source and all differences are reported as Outdated.
+	Recorded bool
+	Modified []string // files changed in the deployment folder since it was created
+	Outdated []string // files changed in the module source since the deployment was created
+	Err      error    // the source is not available
+}
+
+// DiffVendoredModules compares module code copied into the deployment folder with
+// the current module sources and with checksums recorded in the artifacts directory
+// when the deployment was created.
+func DiffVendoredModules(deplDir string, artDir string, bp config.Blueprint) ([]VendorDiff, error) {
+	vms, err := VendoredModules(bp)
+	if err != nil {
+		return nil, err
+	}
+
+	var recorded sourcereader.Manifest
+	b, err := os.ReadFile(filepath.Join(artDir, VendoredManifestName))
+	switch {
+	case err == nil:
+		if recorded, err = sourcereader.ParseManifest(string(b)); err != nil {
+			return nil, err
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	}
+
+	res := []VendorDiff{}
+	for _, vm := range vms {
+		d := VendorDiff{Module: vm, Recorded: recorded != nil}
+		cur, err := dirManifest(filepath.Join(deplDir, filepath.FromSlash(vm.Dir)), vm.ID)
+		if err != nil {
+			return nil, err
+		}
+		src, err := sourceManifest(vm)
+		if err != nil {
+			d.Err = err
+		}
+
+		if d.Recorded {
+			rec := recorded.Sub(vm.Dir)
+			d.Modified = rec.Diff(cur)
+			if d.Err == nil {
+				d.Outdated = rec.Diff(src)
+			}
+		} else if d.Err == nil {
+			d.Outdated = cur.Diff(src)
+		}
+		res = append(res, d)
+	}
+	return res, nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modulewriter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// Kinds of differences of the deployment folder from its artifacts manifest
+const (
+	FileModified = "modified"
+	FileMissing  = "missing"
+	FileAdded    = "added"
+)
+
+// FileChange is a file of the deployment folder that differs from the artifacts manifest
+type FileChange struct {
+	Path   string // relative to the deployment folder, slash-separated
+	Group  config.GroupName
+	Change string
+}
+
+// isDeploymentOutput tests whether the file is written by deploying the deployment
+// groups, e.g. by `ghpc import-inputs` or `terraform init`, rather than by `ghpc create`
+func isDeploymentOutput(rel string) bool {
+	base := path.Base(rel)
+	switch {
+	case base == ".terraform.lock.hcl" || base == "packer-manifest.json":
+		return true
+	case strings.HasSuffix(base, "_inputs.auto.tfvars") || strings.HasSuffix(base, "_inputs.auto.pkrvars.hcl"):
+		return true
+	case strings.HasSuffix(base, "_inputs.extra-vars.json"):
+		return true
+	case path.Dir(rel) == path.Join(HiddenGhpcDirName, ArtifactsDirName) && strings.HasSuffix(base, "_outputs.tfvars"):
+		return true
+	}
+	return false
+}
+
+// ReadArtifactsManifest reads the artifacts manifest of the deployment folder
+func ReadArtifactsManifest(deplDir string) (ArtifactsManifest, error) {
+	var m ArtifactsManifest
+	data, err := os.ReadFile(ArtifactsManifestPath(deplDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, config.HintError{
+			Hint: "re-create the deployment folder with `ghpc create` to record checksums of its files",
+			Err:  fmt.Errorf("deployment folder %s has no %s", deplDir, ArtifactsManifestName)}
+	}
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("malformed %s: %w", ArtifactsManifestName, err)
+	}
+	if m.Version != artifactsManifestVersion {
+		return m, fmt.Errorf("%s of version %d is not supported, expected version %d", ArtifactsManifestName, m.Version, artifactsManifestVersion)
+	}
+	return m, nil
+}
+
+// VerifyDeployment compares files of the deployment folder, including module code copied
+// into it, with checksums recorded in the artifacts manifest when it was created. Files
+// written by deployment, Terraform state and previous deployment groups are not compared.
+// Returns changes sorted by path.
+func VerifyDeployment(deplDir string) ([]FileChange, error) {
+	m, err := ReadArtifactsManifest(deplDir)
+	if err != nil {
+		return nil, err
+	}
+	groups := []config.GroupName{}
+	for _, g := range m.Groups {
+		groups = append(groups, g.Name)
+	}
+	cur, err := artifactFiles(deplDir, groups)
+	if err != nil {
+		return nil, err
+	}
+
+	recorded := map[string]ArtifactFile{}
+	for _, f := range m.Files {
+		recorded[f.Path] = f
+	}
+	res := []FileChange{}
+	for _, f := range cur {
+		r, ok := recorded[f.Path]
+		delete(recorded, f.Path)
+		switch {
+		case isDeploymentOutput(f.Path):
+		case !ok:
+			res = append(res, FileChange{Path: f.Path, Group: f.Group, Change: FileAdded})
+		case r.SHA256 != f.SHA256 || r.Link != f.Link:
+			res = append(res, FileChange{Path: f.Path, Group: f.Group, Change: FileModified})
+		}
+	}
+	for _, f := range recorded {
+		if !isDeploymentOutput(f.Path) {
+			res = append(res, FileChange{Path: f.Path, Group: f.Group, Change: FileMissing})
+		}
+	}
+	slices.SortFunc(res, func(a, b FileChange) int { return strings.Compare(a.Path, b.Path) })
+	return res, nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package profile measures time spent in phases of ghpc commands
+package profile
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime/pprof"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Phases of ghpc commands
+const (
+	Parsing    = "parsing"
+	ModuleInfo = "module info"
+	Expansion  = "expansion"
+	Validation = "validation"
+	Writing    = "writing"
+)
+
+type entry struct {
+	phase string
+	name  string
+	dur   time.Duration
+}
+
+var (
+	mu      sync.Mutex
+	enabled bool
+	entries []entry
+	order   = []string{Parsing, ModuleInfo, Expansion, Validation, Writing}
+)
+
+// Enable turns on collection of timings
+func Enable() {
+	mu.Lock()
+	defer mu.Unlock()
+	enabled = true
+}
+
+// Enabled returns true if collection of timings is turned on
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return enabled
+}
+
+// Start begins measuring time spent in the named step of the phase,
+// call the returned function to stop the measurement.
+// Usage: `defer profile.Start(profile.Parsing, path)()`
+func Start(phase string, name string) func() {
+	if !Enabled() {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		entries = append(entries, entry{phase, name, time.Since(start)})
+	}
+}
+
+// Step is time spent in the named step of the phase
+type Step struct {
+	Phase    string
+	Name     string
+	Duration time.Duration
+}
+
+// Steps returns collected timings in order of measurement
+func Steps() []Step {
+	mu.Lock()
+	defer mu.Unlock()
+	res := make([]Step, len(entries))
+	for i, e := range entries {
+		res[i] = Step{e.phase, e.name, e.dur}
+	}
+	return res
+}
+
+// Reset discards collected timings and disables collection
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	enabled, entries = false, nil
+}
+
+// Report writes collected timings grouped by phase, slowest steps first.
+// NOTE: module info is retrieved during expansion, so phases overlap.
+func Report(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+	byPhase := map[string][]entry{}
+	for _, e := range entries {
+		byPhase[e.phase] = append(byPhase[e.phase], e)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PHASE\tSTEP\tTIME")
+	for _, p := range order {
+		es := byPhase[p]
+		if len(es) == 0 {
+			continue
+		}
+		sort.SliceStable(es, func(i, j int) bool { return es[i].dur > es[j].dur })
+		var sum time.Duration
+		for _, e := range es {
+			sum += e.dur
+		}
+		fmt.Fprintf(tw, "%s\t(total)\t%s\n", p, sum.Round(time.Millisecond))
+		if len(es) > 1 || es[0].name != "" {
+			for _, e := range es {
+				fmt.Fprintf(tw, "\t%s\t%s\n", e.name, e.dur.Round(time.Millisecond))
+			}
+		}
+	}
+	tw.Flush()
+}
+
+// StartCPUProfile writes pprof CPU profile to the file until the returned function is called
+func StartCPUProfile(path string) (func() error, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to start CPU profile: %w", err)
+	}
+	return func() error {
+		pprof.StopCPUProfile()
+		return f.Close()
+	}, nil
+}
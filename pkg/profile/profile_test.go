@@ -0,0 +1,65 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type MySuite struct{}
+
+var _ = Suite(&MySuite{})
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+func (s *MySuite) TestDisabled(c *C) {
+	Reset()
+	Start(Parsing, "bp.yaml")()
+	c.Check(entries, HasLen, 0)
+}
+
+func (s *MySuite) TestReport(c *C) {
+	Reset()
+	Enable()
+	defer Reset()
+
+	Start(Parsing, "bp.yaml")()
+	Start(Validation, "test_fast")()
+	Start(Validation, "test_slow")()
+	Start(Expansion, "")()
+	// make durations deterministic
+	for i := range entries {
+		entries[i].dur = time.Duration(i+1) * time.Second
+	}
+
+	c.Check(Steps()[1], Equals, Step{Validation, "test_fast", 2 * time.Second})
+
+	var b bytes.Buffer
+	Report(&b)
+	c.Check(b.String(), Equals, ""+
+		"PHASE       STEP       TIME\n"+
+		"parsing     (total)    1s\n"+
+		"            bp.yaml    1s\n"+
+		"expansion   (total)    4s\n"+
+		"validation  (total)    5s\n"+
+		"            test_slow  3s\n"+
+		"            test_fast  2s\n")
+}
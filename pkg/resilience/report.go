@@ -0,0 +1,266 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package resilience analyzes how clusters created from a blueprint behave under
+// zonal outages, host maintenance and Spot VM preemption
+package resilience
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"path"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/slices"
+)
+
+// Category of a finding
+type Category string
+
+// Categories of findings
+const (
+	SinglePointOfFailure Category = "single-point-of-failure"
+	HostMaintenance      Category = "host-maintenance"
+	SpotPreemption       Category = "spot-preemption"
+)
+
+// Severity of a finding
+type Severity string
+
+// Severities of findings, from highest
+const (
+	High   Severity = "high"
+	Medium Severity = "medium"
+	Low    Severity = "low"
+)
+
+// Finding is a resilience characteristic of a module
+type Finding struct {
+	Module         config.ModuleID `json:"module"`
+	Category       Category        `json:"category"`
+	Severity       Severity        `json:"severity"`
+	Description    string          `json:"description"`
+	Recommendation string          `json:"recommendation"`
+}
+
+// Report lists findings of a blueprint
+type Report struct {
+	Blueprint string    `json:"blueprint"`
+	Findings  []Finding `json:"findings"`
+}
+
+// role of a module in the cluster, derived from its source
+type role int
+
+const (
+	otherRole role = iota
+	controllerRole
+	loginRole
+	partitionRole
+	filestoreRole
+	nfsServerRole
+)
+
+func moduleRole(m config.Module) role {
+	base := path.Base(m.Source)
+	switch {
+	case strings.Contains(base, "controller") || base == "htcondor-central-manager" || base == "pbspro-server":
+		return controllerRole
+	case strings.Contains(base, "login") || base == "htcondor-access-point":
+		return loginRole
+	case strings.Contains(base, "partition"):
+		return partitionRole
+	case base == "filestore":
+		return filestoreRole
+	case base == "nfs-server":
+		return nfsServerRole
+	}
+	return otherRole
+}
+
+// zonalFilestoreTiers are Filestore tiers without regional availability
+var zonalFilestoreTiers = []string{"BASIC_HDD", "BASIC_SSD", "HIGH_SCALE_SSD", "ZONAL", "STANDARD", "PREMIUM"}
+
+// gpuFamilies are machine families with attached GPUs, their instances can not live migrate
+var gpuFamilies = []string{"a2", "a3", "g2"}
+
+func eval(bp config.Blueprint, m config.Module, name string) (cty.Value, bool) {
+	if !m.Settings.Has(name) {
+		return cty.NilVal, false
+	}
+	v, err := bp.Eval(m.Settings.Get(name))
+	if err != nil || !v.IsWhollyKnown() || v.IsNull() {
+		return cty.NilVal, false
+	}
+	return v, true
+}
+
+func stringSetting(bp config.Blueprint, m config.Module, name string) string {
+	if v, ok := eval(bp, m, name); ok && v.Type() == cty.String {
+		return v.AsString()
+	}
+	return ""
+}
+
+func boolSetting(bp config.Blueprint, m config.Module, name string) bool {
+	v, ok := eval(bp, m, name)
+	return ok && v.Type() == cty.Bool && v.True()
+}
+
+// zoneOf returns the zone of the module, or a description if it is not known
+func zoneOf(bp config.Blueprint, m config.Module) string {
+	if z := stringSetting(bp, m, "zone"); z != "" {
+		return z
+	}
+	return "of the deployment"
+}
+
+// isSpot returns true if instances of the module are Spot or preemptible VMs
+func isSpot(bp config.Blueprint, m config.Module) bool {
+	return boolSetting(bp, m, "enable_spot_vm") || boolSetting(bp, m, "preemptible") ||
+		stringSetting(bp, m, "provisioning_model") == "SPOT"
+}
+
+// hasGPUs returns true if instances of the module have GPUs attached
+func hasGPUs(bp config.Blueprint, m config.Module) bool {
+	if v, ok := eval(bp, m, "guest_accelerator"); ok && v.CanIterateElements() && v.LengthInt() > 0 {
+		return true
+	}
+	family, _, _ := strings.Cut(stringSetting(bp, m, "machine_type"), "-")
+	return slices.Contains(gpuFamilies, family)
+}
+
+func singlePointsOfFailure(bp config.Blueprint, m config.Module) []Finding {
+	switch moduleRole(m) {
+	case controllerRole:
+		return []Finding{{
+			Module: m.ID, Category: SinglePointOfFailure, Severity: High,
+			Description: fmt.Sprintf("the scheduler controller is a single VM in zone %s, no jobs can be submitted "+
+				"or scheduled while it or its zone is unavailable", zoneOf(bp, m)),
+			Recommendation: "keep controller state on storage that outlives the VM, schedule snapshots of its disks and " +
+				"document how to recreate it; running jobs on compute nodes are not affected by a controller restart",
+		}}
+	case filestoreRole:
+		tier := stringSetting(bp, m, "filestore_tier")
+		if !slices.Contains(zonalFilestoreTiers, tier) {
+			return nil
+		}
+		return []Finding{{
+			Module: m.ID, Category: SinglePointOfFailure, Severity: High,
+			Description: fmt.Sprintf("Filestore instance of tier %s is zonal in zone %s, its data is unavailable "+
+				"while the zone is unavailable", tier, zoneOf(bp, m)),
+			Recommendation: "use the ENTERPRISE tier for regional availability, or schedule Filestore backups " +
+				"to restore the share in another zone",
+		}}
+	case nfsServerRole:
+		return []Finding{{
+			Module: m.ID, Category: SinglePointOfFailure, Severity: High,
+			Description: fmt.Sprintf("NFS server is a single VM in zone %s, mounts hang while it is unavailable", zoneOf(bp, m)),
+			Recommendation: "use a Filestore instance of ENTERPRISE tier for shared storage that must survive " +
+				"failures of a VM or a zone",
+		}}
+	}
+	return nil
+}
+
+func hostMaintenance(bp config.Blueprint, m config.Module) []Finding {
+	if !m.Settings.Has("machine_type") && !m.Settings.Has("on_host_maintenance") {
+		return nil
+	}
+	var reason string
+	switch {
+	case stringSetting(bp, m, "on_host_maintenance") == "TERMINATE":
+		reason = "on_host_maintenance is TERMINATE"
+	case hasGPUs(bp, m):
+		reason = "instances with GPUs can not live migrate"
+	default:
+		return nil
+	}
+	f := Finding{Module: m.ID, Category: HostMaintenance, Severity: Low,
+		Description: fmt.Sprintf("instances are stopped during host maintenance events, %s; jobs running on them are interrupted", reason),
+		Recommendation: "checkpoint long-running jobs and let the scheduler requeue interrupted jobs; " +
+			"monitor upcoming maintenance with the maintenance event metadata",
+	}
+	if r := moduleRole(m); r == controllerRole || r == loginRole {
+		f.Severity = Medium
+		f.Description = fmt.Sprintf("instances are stopped during host maintenance events, %s", reason)
+		f.Recommendation = "set on_host_maintenance to MIGRATE so the VM is live migrated instead of stopped"
+	}
+	return []Finding{f}
+}
+
+func spotPreemption(bp config.Blueprint, m config.Module, spot map[config.ModuleID]bool) []Finding {
+	r := moduleRole(m)
+	switch {
+	case r == partitionRole:
+		used, spotUsed := []string{}, []string{}
+		for _, id := range m.Use {
+			if _, isNodes := spot[id]; !isNodes {
+				continue
+			}
+			used = append(used, string(id))
+			if spot[id] {
+				spotUsed = append(spotUsed, fmt.Sprintf("%q", id))
+			}
+		}
+		if len(spotUsed) == 0 {
+			return nil
+		}
+		sev := Medium
+		if len(spotUsed) == len(used) {
+			sev = High
+		}
+		return []Finding{{
+			Module: m.ID, Category: SpotPreemption, Severity: sev,
+			Description: fmt.Sprintf("%d of %d node groups of the partition use Spot VMs (%s), their nodes can be "+
+				"preempted at any time with 30 seconds notice", len(spotUsed), len(used), strings.Join(spotUsed, ", ")),
+			Recommendation: "run jobs that can be requeued or checkpoint often; add a partition of on-demand nodes " +
+				"for jobs that must not be interrupted",
+		}}
+	case (r == controllerRole || r == loginRole) && isSpot(bp, m):
+		return []Finding{{
+			Module: m.ID, Category: SpotPreemption, Severity: High,
+			Description:    "the VM is a Spot VM and can be preempted at any time, the cluster is unusable while it is stopped",
+			Recommendation: "do not use Spot VMs for controllers and login nodes",
+		}}
+	}
+	return nil
+}
+
+// Analyze reports resilience characteristics of the expanded blueprint: single points
+// of failure, behavior under host maintenance and exposure to Spot preemption.
+// Settings not set in the blueprint are only taken into account if defaults of
+// modules are resolved, see config.Blueprint.ResolveDefaults.
+func Analyze(bp config.Blueprint) Report {
+	// node groups by ID, true if they use Spot VMs
+	spot := map[config.ModuleID]bool{}
+	bp.WalkModulesSafe(func(_ config.ModulePath, m *config.Module) {
+		if m.Settings.Has("machine_type") && moduleRole(*m) == otherRole {
+			spot[m.ID] = isSpot(bp, *m)
+		}
+	})
+
+	findings := []Finding{}
+	bp.WalkModulesSafe(func(_ config.ModulePath, m *config.Module) {
+		findings = append(findings, singlePointsOfFailure(bp, *m)...)
+		findings = append(findings, hostMaintenance(bp, *m)...)
+		findings = append(findings, spotPreemption(bp, *m, spot)...)
+	})
+	severities := []Severity{High, Medium, Low}
+	slices.SortStableFunc(findings, func(a, b Finding) int {
+		return slices.Index(severities, a.Severity) - slices.Index(severities, b.Severity)
+	})
+	return Report{Blueprint: bp.BlueprintName, Findings: findings}
+}
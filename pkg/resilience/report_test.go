@@ -0,0 +1,88 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resilience
+
+import (
+	"hpc-toolkit/pkg/config"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+	. "gopkg.in/check.v1"
+)
+
+type MySuite struct{}
+
+var _ = Suite(&MySuite{})
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+func mod(id config.ModuleID, source string, settings map[string]cty.Value, use ...config.ModuleID) config.Module {
+	return config.Module{ID: id, Source: source, Kind: config.TerraformKind, Settings: config.NewDict(settings), Use: use}
+}
+
+func summary(r Report) [][3]string {
+	res := [][3]string{}
+	for _, f := range r.Findings {
+		res = append(res, [3]string{string(f.Module), string(f.Category), string(f.Severity)})
+	}
+	return res
+}
+
+func (s *MySuite) TestAnalyze(c *C) {
+	bp := config.Blueprint{BlueprintName: "bp", Groups: []config.Group{{Name: "g", Modules: []config.Module{
+		mod("homefs", "modules/file-system/filestore", map[string]cty.Value{
+			"filestore_tier": cty.StringVal("BASIC_SSD"), "zone": cty.StringVal("us-central1-a")}),
+		mod("regionalfs", "modules/file-system/filestore", map[string]cty.Value{
+			"filestore_tier": cty.StringVal("ENTERPRISE")}),
+		mod("spot_nodes", "community/modules/compute/schedmd-slurm-gcp-v6-nodeset", map[string]cty.Value{
+			"machine_type": cty.StringVal("c2-standard-60"), "enable_spot_vm": cty.True,
+			"on_host_maintenance": cty.StringVal("TERMINATE")}),
+		mod("gpu_nodes", "community/modules/compute/schedmd-slurm-gcp-v6-nodeset", map[string]cty.Value{
+			"machine_type": cty.StringVal("a2-highgpu-1g"), "on_host_maintenance": cty.StringVal("MIGRATE")}),
+		mod("mixed", "community/modules/compute/schedmd-slurm-gcp-v6-partition", nil, "spot_nodes", "gpu_nodes"),
+		mod("all_spot", "community/modules/compute/schedmd-slurm-gcp-v6-partition", nil, "spot_nodes", "homefs"),
+		mod("login", "community/modules/scheduler/schedmd-slurm-gcp-v6-login", map[string]cty.Value{
+			"machine_type": cty.StringVal("n2-standard-4"), "on_host_maintenance": cty.StringVal("MIGRATE")}),
+		mod("controller", "community/modules/scheduler/schedmd-slurm-gcp-v6-controller", map[string]cty.Value{
+			"machine_type": cty.StringVal("c2-standard-4"), "preemptible": cty.True,
+			"on_host_maintenance": cty.StringVal("TERMINATE")}),
+	}}}}
+
+	r := Analyze(bp)
+	c.Check(r.Blueprint, Equals, "bp")
+	c.Check(summary(r), DeepEquals, [][3]string{
+		{"homefs", "single-point-of-failure", "high"},
+		{"all_spot", "spot-preemption", "high"},
+		{"controller", "single-point-of-failure", "high"},
+		{"controller", "spot-preemption", "high"},
+		{"mixed", "spot-preemption", "medium"},
+		{"controller", "host-maintenance", "medium"},
+		{"spot_nodes", "host-maintenance", "low"},
+		{"gpu_nodes", "host-maintenance", "low"},
+	})
+	c.Check(r.Findings[0].Description, Matches, ".*BASIC_SSD is zonal in zone us-central1-a.*")
+	c.Check(r.Findings[4].Description, Matches, `1 of 2 node groups of the partition use Spot VMs \("spot_nodes"\).*`)
+	c.Check(r.Findings[7].Description, Matches, ".*instances with GPUs can not live migrate.*")
+}
+
+func (s *MySuite) TestAnalyzeNoFindings(c *C) {
+	bp := config.Blueprint{Groups: []config.Group{{Name: "g", Modules: []config.Module{
+		mod("network", "modules/network/vpc", nil),
+		mod("vm", "modules/compute/vm-instance", map[string]cty.Value{"machine_type": cty.StringVal("n2-standard-2")}),
+	}}}}
+	c.Check(Analyze(bp).Findings, HasLen, 0)
+}
@@ -0,0 +1,42 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shell
+
+import (
+	"os"
+	"os/exec"
+)
+
+// ConfigureAnsible errors if ansible-playbook is not in the user PATH
+func ConfigureAnsible() error {
+	_, err := exec.LookPath("ansible-playbook")
+	if err != nil {
+		return &TfError{
+			help: "must have a copy of ansible installed in PATH (obtain at https://docs.ansible.com/ansible/latest/installation_guide/)",
+			err:  err,
+		}
+	}
+	return nil
+}
+
+// ExecAnsiblePlaybook runs ansible-playbook with arguments in the given working
+// directory, output of the playbook is printed to stdout/stderr
+func ExecAnsiblePlaybook(workingDir string, args ...string) error {
+	cmd := exec.Command("ansible-playbook", args...)
+	cmd.Dir = workingDir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
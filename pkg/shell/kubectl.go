@@ -0,0 +1,54 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shell
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ConfigureKubectl errors if kubectl is not in the user PATH
+func ConfigureKubectl() error {
+	_, err := exec.LookPath("kubectl")
+	if err != nil {
+		return &TfError{
+			help: "must have a copy of kubectl installed in PATH (obtain at https://kubernetes.io/docs/tasks/tools/)",
+			err:  err,
+		}
+	}
+	return nil
+}
+
+// KubectlContext returns the current context of kubectl
+func KubectlContext() (string, error) {
+	out, err := exec.Command("kubectl", "config", "current-context").Output()
+	if err != nil {
+		return "", &TfError{
+			help: "kubectl has no current context, fetch credentials of the cluster with `gcloud container clusters get-credentials`",
+			err:  err,
+		}
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// ApplyKubernetesManifests applies manifests of the file to the cluster of the current
+// context of kubectl, output of kubectl is printed to stdout/stderr
+func ApplyKubernetesManifests(path string) error {
+	cmd := exec.Command("kubectl", "apply", "--server-side", "-f", path)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
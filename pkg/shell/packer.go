@@ -18,12 +18,34 @@ package shell
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hpc-toolkit/pkg/apiclient"
 	"io"
+	"io/fs"
+	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"sync"
+
+	"golang.org/x/exp/slices"
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
 )
 
+// PackerImageHashLabel is the label of images that records hash of inputs of
+// the Packer module that built the image
+const PackerImageHashLabel = "ghpc_inputs_hash"
+
+// packerManifestName is the manifest written by Packer builds, it is not an input
+const packerManifestName = "packer-manifest.json"
+
 // ConfigurePacker errors if packer is not in the user PATH
 func ConfigurePacker() error {
 	_, err := exec.LookPath("packer")
@@ -86,3 +108,99 @@ func ExecPackerCmd(workingDir string, printToScreen bool, args ...string) error
 	}
 	return nil
 }
+
+func hashFile(h hash.Hash, name string, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(h, "%s\x00%d\x00", filepath.ToSlash(name), len(b))
+	h.Write(b)
+	return nil
+}
+
+// PackerInputsHash returns hash of inputs of the Packer module in moduleDir: all
+// files of the module, including variable values, local files referenced by
+// settings of the module, e.g. shell scripts, and the self-link of the source
+// image resolved from its family, if any. Paths that are not regular files
+// are ignored, relative paths are resolved against moduleDir as Packer does.
+func PackerInputsHash(moduleDir string, refs []string, sourceImage string) (string, error) {
+	h := sha256.New()
+	err := filepath.WalkDir(moduleDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || d.Name() == packerManifestName {
+			return err
+		}
+		rel, err := filepath.Rel(moduleDir, p)
+		if err != nil {
+			return err
+		}
+		return hashFile(h, rel, p)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	refs = slices.Clone(refs)
+	slices.Sort(refs)
+	for _, r := range slices.Compact(refs) {
+		p := r
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(moduleDir, p)
+		}
+		if fi, err := os.Stat(p); err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		if err := hashFile(h, r, p); err != nil {
+			return "", err
+		}
+	}
+	if sourceImage != "" {
+		fmt.Fprintf(h, "source_image\x00%s\x00", sourceImage)
+	}
+	// label values are limited to 63 characters
+	return hex.EncodeToString(h.Sum(nil))[:32], nil
+}
+
+// ResolveImageFamily returns self-link of the image that the family resolves to in
+// the first of the projects that has the family, as Packer looks up source images
+func ResolveImageFamily(projects []string, family string) (string, error) {
+	s, err := apiclient.New(context.Background(), compute.NewService)
+	if err != nil {
+		return "", err
+	}
+	for _, p := range projects {
+		img, err := s.Images.GetFromFamily(p, family).Fields("selfLink").Do()
+		var gerr *googleapi.Error
+		if errors.As(err, &gerr) && gerr.Code == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve image family %s in project %s: %w", family, p, err)
+		}
+		return img.SelfLink, nil
+	}
+	return "", fmt.Errorf("image family %s not found in projects %s", family, strings.Join(projects, ", "))
+}
+
+// FindCachedImage returns name of the image that the image family resolves to if
+// it was built from inputs with the hash, returns empty string otherwise.
+// Only the latest image of the family is considered, so that groups using the
+// family are deployed with the image.
+func FindCachedImage(projectID string, family string, hash string) (string, error) {
+	s, err := apiclient.New(context.Background(), compute.NewService)
+	if err != nil {
+		return "", err
+	}
+	img, err := s.Images.GetFromFamily(projectID, family).Do()
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) && gerr.Code == http.StatusNotFound {
+		return "", nil // family has no images yet
+	}
+	if err != nil {
+		return "", err
+	}
+	if img.Labels[PackerImageHashLabel] != hash {
+		return "", nil
+	}
+	return img.Name, nil
+}
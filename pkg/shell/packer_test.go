@@ -20,6 +20,8 @@ import (
 	"errors"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 
 	. "gopkg.in/check.v1"
 )
@@ -51,3 +53,48 @@ func (s *MySuite) TestPacker(c *C) {
 	err = ExecPackerCmd(".", false)
 	c.Assert(err, NotNil)
 }
+
+func (s *MySuite) TestPackerInputsHash(c *C) {
+	dir := c.MkDir()
+	write := func(name string, content string) {
+		c.Assert(os.WriteFile(filepath.Join(dir, name), []byte(content), 0644), IsNil)
+	}
+	write("image.pkr.hcl", `source "googlecompute" "image" {}`)
+	write("defaults.auto.pkrvars.hcl", `source_image_family = "hpc-rocky-linux-8"`)
+	script := filepath.Join(c.MkDir(), "install.sh")
+	c.Assert(os.WriteFile(script, []byte("dnf install -y gcc"), 0644), IsNil)
+	refs := []string{script, "hpc-rocky-linux-8"}
+	src := "https://www.googleapis.com/compute/v1/projects/cloud-hpc-image-public/global/images/hpc-rocky-linux-8-v20240126"
+
+	h, err := PackerInputsHash(dir, refs, src)
+	c.Assert(err, IsNil)
+	c.Check(h, HasLen, 32)
+
+	{ // manifest and order of references do not change the hash
+		write(packerManifestName, `{"builds": []}`)
+		got, err := PackerInputsHash(dir, []string{"hpc-rocky-linux-8", script, script}, src)
+		c.Check(err, IsNil)
+		c.Check(got, Equals, h)
+	}
+
+	{ // referenced script changes the hash
+		c.Assert(os.WriteFile(script, []byte("dnf install -y clang"), 0644), IsNil)
+		got, err := PackerInputsHash(dir, refs, src)
+		c.Check(err, IsNil)
+		c.Check(got, Not(Equals), h)
+		h = got
+	}
+
+	{ // new image of the source family changes the hash
+		got, err := PackerInputsHash(dir, refs, strings.Replace(src, "v20240126", "v20240312", 1))
+		c.Check(err, IsNil)
+		c.Check(got, Not(Equals), h)
+	}
+
+	{ // variable values change the hash
+		write("defaults.auto.pkrvars.hcl", `source_image_family = "hpc-rocky-linux-9"`)
+		got, err := PackerInputsHash(dir, refs, src)
+		c.Check(err, IsNil)
+		c.Check(got, Not(Equals), h)
+	}
+}
@@ -0,0 +1,137 @@
+/**
+ * Copyright 2024 Google LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package shell
+
+import (
+	"fmt"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// ProtectedLabel is the label of resources that plans may not delete or replace
+// when the no-protected-deletion rule is enabled
+const ProtectedLabel = "protected"
+
+// PlanPolicy lists rules that Terraform plans must satisfy before they are applied.
+// Rules are checked against the plan, so they also cover drift and defaults of
+// providers that are not visible in the blueprint.
+type PlanPolicy struct {
+	// deny deletion or replacement of resources labeled with ProtectedLabel
+	NoProtectedDeletion bool
+	// deny creation of resources with external IP addresses
+	NoPublicIP bool
+}
+
+var planPolicyRules = map[string]func(*PlanPolicy){
+	"no-protected-deletion": func(p *PlanPolicy) { p.NoProtectedDeletion = true },
+	"no-public-ip":          func(p *PlanPolicy) { p.NoPublicIP = true },
+}
+
+// PlanPolicyRules returns names of rules accepted by ParsePlanPolicy
+func PlanPolicyRules() []string {
+	names := maps.Keys(planPolicyRules)
+	slices.Sort(names)
+	return names
+}
+
+// ParsePlanPolicy returns the policy enabling the named rules
+func ParsePlanPolicy(rules []string) (PlanPolicy, error) {
+	p := PlanPolicy{}
+	for _, r := range rules {
+		enable, ok := planPolicyRules[r]
+		if !ok {
+			return PlanPolicy{}, fmt.Errorf("unknown plan policy rule %q, must be one of %s", r, strings.Join(PlanPolicyRules(), ", "))
+		}
+		enable(&p)
+	}
+	return p, nil
+}
+
+// Enabled returns true if any rule of the policy is enabled
+func (p PlanPolicy) Enabled() bool {
+	return p.NoProtectedDeletion || p.NoPublicIP
+}
+
+// instanceTypes are resources that attach external IP addresses by `access_config`
+// of their network interfaces
+var instanceTypes = []string{
+	"google_compute_instance",
+	"google_compute_instance_from_template",
+	"google_compute_instance_template",
+	"google_compute_region_instance_template",
+}
+
+func attrsOf(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
+
+func isProtected(values map[string]interface{}) bool {
+	for _, attr := range []string{"labels", "effective_labels"} {
+		if v, ok := attrsOf(values[attr])[ProtectedLabel]; ok && v != "false" {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPublicIP returns true if the resource of the type has an external IP address
+func hasPublicIP(typ string, values map[string]interface{}) bool {
+	if values == nil {
+		return false
+	}
+	switch {
+	case slices.Contains(instanceTypes, typ):
+		nics, _ := values["network_interface"].([]interface{})
+		for _, nic := range nics {
+			for _, attr := range []string{"access_config", "ipv6_access_config"} {
+				if cfgs, _ := attrsOf(nic)[attr].([]interface{}); len(cfgs) > 0 {
+					return true
+				}
+			}
+		}
+	case typ == "google_compute_address" || typ == "google_compute_global_address":
+		t, _ := values["address_type"].(string)
+		return t == "" || t == "EXTERNAL" // addresses are external by default
+	}
+	return false
+}
+
+// CheckPlanPolicy returns an error listing changes of the plan that violate the policy
+func CheckPlanPolicy(plan *tfjson.Plan, p PlanPolicy) error {
+	violations := []string{}
+	for _, rc := range plan.ResourceChanges {
+		if rc.Change == nil || rc.Mode != tfjson.ManagedResourceMode {
+			continue
+		}
+		before, after := attrsOf(rc.Change.Before), attrsOf(rc.Change.After)
+		deletes := rc.Change.Actions.Delete() || rc.Change.Actions.Replace()
+		if p.NoProtectedDeletion && deletes && isProtected(before) {
+			violations = append(violations, fmt.Sprintf("  %s would be deleted, it is labeled %q", rc.Address, ProtectedLabel))
+		}
+		if p.NoPublicIP && !rc.Change.Actions.Delete() && hasPublicIP(rc.Type, after) && !hasPublicIP(rc.Type, before) {
+			violations = append(violations, fmt.Sprintf("  %s would have an external IP address", rc.Address))
+		}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	return fmt.Errorf("the plan violates the plan policy:\n%s", strings.Join(violations, "\n"))
+}
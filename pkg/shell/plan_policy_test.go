@@ -0,0 +1,85 @@
+/**
+ * Copyright 2024 Google LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package shell
+
+import (
+	tfjson "github.com/hashicorp/terraform-json"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestParsePlanPolicy(c *C) {
+	p, err := ParsePlanPolicy(nil)
+	c.Check(err, IsNil)
+	c.Check(p.Enabled(), Equals, false)
+
+	p, err = ParsePlanPolicy([]string{"no-public-ip", "no-protected-deletion"})
+	c.Check(err, IsNil)
+	c.Check(p, DeepEquals, PlanPolicy{NoProtectedDeletion: true, NoPublicIP: true})
+
+	_, err = ParsePlanPolicy([]string{"no-deletion"})
+	c.Check(err, ErrorMatches, `unknown plan policy rule "no-deletion", must be one of no-protected-deletion, no-public-ip`)
+}
+
+func (s *MySuite) TestCheckPlanPolicy(c *C) {
+	change := func(typ string, actions tfjson.Actions, before, after interface{}) *tfjson.ResourceChange {
+		return &tfjson.ResourceChange{
+			Address: "module.x." + typ + ".this",
+			Mode:    tfjson.ManagedResourceMode,
+			Type:    typ,
+			Change:  &tfjson.Change{Actions: actions, Before: before, After: after}}
+	}
+	labels := func(v string) map[string]interface{} {
+		return map[string]interface{}{"labels": map[string]interface{}{ProtectedLabel: v}}
+	}
+	nic := func(accessConfigs ...interface{}) map[string]interface{} {
+		return map[string]interface{}{"network_interface": []interface{}{
+			map[string]interface{}{"access_config": accessConfigs}}}
+	}
+	create := tfjson.Actions{tfjson.ActionCreate}
+	del := tfjson.Actions{tfjson.ActionDelete}
+	replace := tfjson.Actions{tfjson.ActionDelete, tfjson.ActionCreate}
+	all := PlanPolicy{NoProtectedDeletion: true, NoPublicIP: true}
+
+	{ // OK
+		plan := &tfjson.Plan{ResourceChanges: []*tfjson.ResourceChange{
+			change("google_storage_bucket", del, labels("false"), nil),
+			change("google_storage_bucket", del, map[string]interface{}{}, nil),
+			change("google_compute_instance", create, nil, nic()),
+			change("google_compute_address", create, nil, map[string]interface{}{"address_type": "INTERNAL"}),
+			// external IP is kept
+			change("google_compute_instance", tfjson.Actions{tfjson.ActionUpdate}, nic(map[string]interface{}{}), nic(map[string]interface{}{})),
+		}}
+		c.Check(CheckPlanPolicy(plan, all), IsNil)
+	}
+
+	{ // FAIL
+		plan := &tfjson.Plan{ResourceChanges: []*tfjson.ResourceChange{
+			change("google_filestore_instance", del, labels("true"), nil),
+			change("google_compute_disk", replace, labels(""), map[string]interface{}{}),
+			change("google_compute_instance_template", create, nil, nic(map[string]interface{}{})),
+			change("google_compute_address", create, nil, map[string]interface{}{"address_type": nil}),
+		}}
+		c.Check(CheckPlanPolicy(plan, all), ErrorMatches, `the plan violates the plan policy:
+  module.x.google_filestore_instance.this would be deleted, it is labeled "protected"
+  module.x.google_compute_disk.this would be deleted, it is labeled "protected"
+  module.x.google_compute_instance_template.this would have an external IP address
+  module.x.google_compute_address.this would have an external IP address`)
+
+		c.Check(CheckPlanPolicy(plan, PlanPolicy{NoPublicIP: true}), ErrorMatches, `(?s).*instance_template.*compute_address.*`)
+		c.Check(CheckPlanPolicy(plan, PlanPolicy{}), IsNil)
+	}
+}
@@ -0,0 +1,188 @@
+/**
+ * Copyright 2024 Google LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slices"
+	"gopkg.in/yaml.v3"
+)
+
+// deployScheduleFile is the file of the artifacts directory with deployment groups
+// that a scheduled deployment has not deployed yet
+const deployScheduleFile = "deploy_schedule.yaml"
+
+var windowRe = regexp.MustCompile(`^(?:([A-Za-z,]+)\s+)?(\d{1,2}):(\d{2})-(\d{1,2}):(\d{2})$`)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Window is a recurring window of time, in the local time zone
+type Window struct {
+	Days  []time.Weekday // days the window starts on, every day if empty
+	Start int            // minutes since midnight
+	End   int            // minutes since midnight, the window ends next day if End is before Start
+}
+
+func parseClock(h string, m string) (int, error) {
+	hh, _ := strconv.Atoi(h)
+	mm, _ := strconv.Atoi(m)
+	if hh > 23 || mm > 59 {
+		return 0, fmt.Errorf("invalid time %s:%s", h, m)
+	}
+	return hh*60 + mm, nil
+}
+
+// ParseWindow parses a window of the form "[DAYS ]HH:MM-HH:MM", where DAYS is a
+// comma-separated list of days the window starts on, e.g. "Sat,Sun 01:00-05:00"
+func ParseWindow(s string) (Window, error) {
+	m := windowRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return Window{}, fmt.Errorf("invalid time window %q, must be [DAYS ]HH:MM-HH:MM, e.g. \"Sat,Sun 01:00-05:00\"", s)
+	}
+	w := Window{}
+	if m[1] != "" {
+		for _, d := range strings.Split(m[1], ",") {
+			wd, ok := weekdays[strings.ToLower(d)]
+			if !ok {
+				return Window{}, fmt.Errorf("invalid day %q of time window %q, must be one of Mon, Tue, Wed, Thu, Fri, Sat, Sun", d, s)
+			}
+			w.Days = append(w.Days, wd)
+		}
+	}
+	var err error
+	if w.Start, err = parseClock(m[2], m[3]); err != nil {
+		return Window{}, err
+	}
+	if w.End, err = parseClock(m[4], m[5]); err != nil {
+		return Window{}, err
+	}
+	if w.Start == w.End {
+		return Window{}, fmt.Errorf("time window %q is empty", s)
+	}
+	return w, nil
+}
+
+// Next returns t if it is within the window, otherwise the time the window opens next
+func (w Window) Next(t time.Time) time.Time {
+	length := w.End - w.Start
+	if length < 0 {
+		length += 24 * 60
+	}
+	// start with window of the previous day, that may extend past midnight
+	for d := -1; d <= 7; d++ {
+		start := time.Date(t.Year(), t.Month(), t.Day()+d, w.Start/60, w.Start%60, 0, 0, t.Location())
+		if len(w.Days) > 0 && !slices.Contains(w.Days, start.Weekday()) {
+			continue
+		}
+		if start.Add(time.Duration(length) * time.Minute).After(t) {
+			if start.After(t) {
+				return start
+			}
+			return t
+		}
+	}
+	panic("unreachable: window opens at least once a week")
+}
+
+// ScheduledGroup is a deployment group that a scheduled deployment has not deployed yet
+type ScheduledGroup struct {
+	Group  config.GroupName `yaml:"group"`
+	Window string           `yaml:"window,omitempty"` // empty if the group is not deferred
+}
+
+// DeploySchedule is the plan of a deployment that defers deployment groups to time windows
+type DeploySchedule struct {
+	Created time.Time        `yaml:"created"`
+	Groups  []ScheduledGroup `yaml:"groups"` // in order of deployment
+}
+
+// Next returns the index of the first group that can be deployed at t: its window,
+// if any, is open and no group whose outputs it uses is pending. Otherwise it returns
+// -1 and the time a window of a group that is not waiting for other groups opens next.
+func (s DeploySchedule) Next(t time.Time, upstream map[config.GroupName][]config.GroupName) (int, time.Time, error) {
+	pending := map[config.GroupName]bool{}
+	for _, g := range s.Groups {
+		pending[g.Group] = true
+	}
+	var next time.Time
+	for i, g := range s.Groups {
+		if slices.ContainsFunc(upstream[g.Group], func(u config.GroupName) bool { return pending[u] }) {
+			continue
+		}
+		if g.Window == "" {
+			return i, t, nil
+		}
+		w, err := ParseWindow(g.Window)
+		if err != nil {
+			return -1, time.Time{}, fmt.Errorf("deployment group %s: %w", g.Group, err)
+		}
+		at := w.Next(t)
+		if !at.After(t) {
+			return i, t, nil
+		}
+		if next.IsZero() || at.Before(next) {
+			next = at
+		}
+	}
+	return -1, next, nil
+}
+
+// ReadDeploySchedule returns the schedule persisted in the artifacts directory,
+// the schedule has no groups if there is no scheduled deployment
+func ReadDeploySchedule(artifactsDir string) (DeploySchedule, error) {
+	s := DeploySchedule{}
+	data, err := os.ReadFile(filepath.Join(artifactsDir, deployScheduleFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("failed to parse schedule of deployment %s: %w", filepath.Join(artifactsDir, deployScheduleFile), err)
+	}
+	return s, nil
+}
+
+// WriteDeploySchedule persists the schedule in the artifacts directory, so that
+// an interrupted deployment can be resumed, the file is removed if no group is pending
+func WriteDeploySchedule(artifactsDir string, s DeploySchedule) error {
+	path := filepath.Join(artifactsDir, deployScheduleFile)
+	if len(s.Groups) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,105 @@
+/**
+ * Copyright 2024 Google LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package shell
+
+import (
+	"hpc-toolkit/pkg/config"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestParseWindow(c *C) {
+	w, err := ParseWindow("Sat,sun 01:00-05:30")
+	c.Check(err, IsNil)
+	c.Check(w, DeepEquals, Window{Days: []time.Weekday{time.Saturday, time.Sunday}, Start: 60, End: 330})
+
+	w, err = ParseWindow("22:00-2:00")
+	c.Check(err, IsNil)
+	c.Check(w, DeepEquals, Window{Start: 22 * 60, End: 120})
+
+	for _, bad := range []string{"", "01:00", "Sat", "Caturday 01:00-02:00", "24:00-01:00", "01:60-02:00", "03:00-03:00"} {
+		_, err := ParseWindow(bad)
+		c.Check(err, NotNil, Commentf("%q", bad))
+	}
+}
+
+func (s *MySuite) TestWindowNext(c *C) {
+	at := func(d int, h int, m int) time.Time { // October 2024 starts on Tuesday
+		return time.Date(2024, 10, d, h, m, 0, 0, time.UTC)
+	}
+	daily, _ := ParseWindow("01:00-05:00")
+	c.Check(daily.Next(at(1, 0, 30)), Equals, at(1, 1, 0))
+	c.Check(daily.Next(at(1, 2, 0)), Equals, at(1, 2, 0)) // open
+	c.Check(daily.Next(at(1, 5, 0)), Equals, at(2, 1, 0))
+
+	overnight, _ := ParseWindow("Fri 22:00-02:00")
+	c.Check(overnight.Next(at(1, 12, 0)), Equals, at(4, 22, 0))
+	c.Check(overnight.Next(at(5, 1, 0)), Equals, at(5, 1, 0)) // opened on Friday
+	c.Check(overnight.Next(at(5, 3, 0)), Equals, at(11, 22, 0))
+}
+
+func (s *MySuite) TestDeployScheduleNext(c *C) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	sched := DeploySchedule{Groups: []ScheduledGroup{
+		{Group: "gpu", Window: "01:00-05:00"},
+		{Group: "login"},
+		{Group: "cpu", Window: "11:00-13:00"},
+		{Group: "late", Window: "20:00-21:00"},
+	}}
+	upstream := map[config.GroupName][]config.GroupName{"login": {"gpu"}, "late": {"net"}}
+
+	i, _, err := sched.Next(now, upstream)
+	c.Check(err, IsNil)
+	c.Check(i, Equals, 2) // gpu window is closed, login waits for gpu
+
+	sched.Groups = []ScheduledGroup{sched.Groups[0], sched.Groups[1], sched.Groups[3]}
+	i, at, err := sched.Next(now, upstream)
+	c.Check(err, IsNil)
+	c.Check(i, Equals, -1)
+	c.Check(at, Equals, time.Date(2024, 10, 1, 20, 0, 0, 0, time.UTC))
+
+	sched.Groups = sched.Groups[1:2] // gpu is deployed
+	i, _, err = sched.Next(now, upstream)
+	c.Check(err, IsNil)
+	c.Check(i, Equals, 0)
+
+	_, _, err = DeploySchedule{Groups: []ScheduledGroup{{Group: "g", Window: "never"}}}.Next(now, nil)
+	c.Check(err, ErrorMatches, `deployment group g: invalid time window.*`)
+}
+
+func (s *MySuite) TestDeploySchedulePersisted(c *C) {
+	dir := c.MkDir()
+	got, err := ReadDeploySchedule(dir)
+	c.Check(err, IsNil)
+	c.Check(got.Groups, HasLen, 0)
+
+	sched := DeploySchedule{
+		Created: time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC),
+		Groups:  []ScheduledGroup{{Group: "gpu", Window: "Sat 01:00-05:00"}, {Group: "login"}}}
+	c.Assert(WriteDeploySchedule(dir, sched), IsNil)
+	got, err = ReadDeploySchedule(dir)
+	c.Check(err, IsNil)
+	c.Check(got, DeepEquals, sched)
+
+	c.Assert(WriteDeploySchedule(dir, DeploySchedule{}), IsNil)
+	_, err = os.Stat(filepath.Join(dir, deployScheduleFile))
+	c.Check(os.IsNotExist(err), Equals, true)
+	c.Check(WriteDeploySchedule(dir, DeploySchedule{}), IsNil) // no schedule to remove
+}
@@ -0,0 +1,188 @@
+/**
+ * Copyright 2024 Google LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hpc-toolkit/pkg/apiclient"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/logging"
+	"net"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// StartupRoles are values of `ghpc_role` label of instances
+// which startup is awaited by default
+var StartupRoles = []string{"scheduler", "login"}
+
+const startupPollInterval = 10 * time.Second
+const startupExcerptLines = 20
+
+var startupStartedRe = regexp.MustCompile(`Starting startup scripts`)
+var startupFinishedRe = regexp.MustCompile(`startup-script exit status (\d+)`)
+var startupFailedRe = regexp.MustCompile(`Script.*failed with error:`)
+
+type startupStatus int
+
+const (
+	startupRunning startupStatus = iota
+	startupSucceeded
+	startupFailed
+)
+
+// lastStartupRun returns serial port output of the last run of startup scripts,
+// earlier runs are from boots before a reboot
+func lastStartupRun(serial string) string {
+	m := startupStartedRe.FindAllStringIndex(serial, -1)
+	if m == nil {
+		return serial
+	}
+	return serial[m[len(m)-1][0]:]
+}
+
+// parseStartupStatus inspects serial port output of an instance
+// for completion markers of the last run of the startup script
+func parseStartupStatus(serial string) startupStatus {
+	serial = lastStartupRun(serial)
+	if startupFailedRe.MatchString(serial) {
+		return startupFailed
+	}
+	m := startupFinishedRe.FindAllStringSubmatch(serial, -1)
+	if m == nil {
+		return startupRunning
+	}
+	if m[len(m)-1][1] != "0" {
+		return startupFailed
+	}
+	return startupSucceeded
+}
+
+// startupExcerpt returns last lines of serial port output related to startup script
+func startupExcerpt(serial string) string {
+	lines := []string{}
+	for _, l := range strings.Split(serial, "\n") {
+		if strings.Contains(l, "startup-script") || strings.Contains(l, "startup_script") {
+			lines = append(lines, l)
+		}
+	}
+	if len(lines) > startupExcerptLines {
+		lines = lines[len(lines)-startupExcerptLines:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// isTransientError returns true if the request may succeed when repeated
+func isTransientError(err error) bool {
+	var herr *googleapi.Error
+	if errors.As(err, &herr) {
+		return herr.Code == http.StatusTooManyRequests || herr.Code >= http.StatusInternalServerError
+	}
+	var nerr net.Error
+	return errors.As(err, &nerr)
+}
+
+func serialCmd(projectID string, zone string, name string) string {
+	return fmt.Sprintf("gcloud compute instances get-serial-port-output %s --port 1 --zone %s --project %s", name, zone, projectID)
+}
+
+// WaitForStartup polls serial port output of deployment instances with given roles
+// until their startup scripts are finished or the timeout is reached
+func WaitForStartup(projectID string, deploymentName string, roles []string, timeout time.Duration) error {
+	ctx := context.Background()
+	s, err := apiclient.New(ctx, compute.NewService)
+	if err != nil {
+		return err
+	}
+
+	type instance struct{ name, zone string }
+	pending := []instance{}
+	filter := fmt.Sprintf("labels.ghpc_deployment = %q", deploymentName)
+	err = s.Instances.AggregatedList(projectID).Filter(filter).Pages(ctx, func(l *compute.InstanceAggregatedList) error {
+		for _, scoped := range l.Items {
+			for _, inst := range scoped.Instances {
+				for _, r := range roles {
+					if inst.Labels["ghpc_role"] == r {
+						pending = append(pending, instance{inst.Name, path.Base(inst.Zone)})
+					}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list instances of deployment %q: %w", deploymentName, err)
+	}
+	if len(pending) == 0 {
+		return config.HintError{
+			Hint: fmt.Sprintf("only instances labeled with ghpc_role %s, e.g. Slurm controllers and login nodes, are awaited", strings.Join(roles, " or ")),
+			Err:  fmt.Errorf("no instances of deployment %q to wait for startup of", deploymentName)}
+	}
+
+	deadline := time.Now().Add(timeout)
+	for len(pending) > 0 {
+		still := []instance{}
+		var lastErr error // of this poll, transient errors are retried until the deadline
+		for _, i := range pending {
+			out, err := s.Instances.GetSerialPortOutput(projectID, i.zone, i.name).Port(1).Do()
+			if err != nil && !isTransientError(err) {
+				return fmt.Errorf("failed to get serial port output of %s: %w", i.name, err)
+			}
+			if err != nil {
+				lastErr = fmt.Errorf("failed to get serial port output of %s: %w", i.name, err)
+				logging.Info("%s, retrying", lastErr)
+				still = append(still, i)
+				continue
+			}
+			switch parseStartupStatus(out.Contents) {
+			case startupSucceeded:
+				logging.Info("startup-script of %s finished successfully", i.name)
+			case startupFailed:
+				return fmt.Errorf("startup-script of %s finished with errors:\n%s\nTo inspect the startup script output, please run:\n%s",
+					i.name, startupExcerpt(out.Contents), serialCmd(projectID, i.zone, i.name))
+			default:
+				still = append(still, i)
+			}
+		}
+		pending = still
+		if len(pending) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			cmds := make([]string, len(pending))
+			for j, i := range pending {
+				cmds[j] = serialCmd(projectID, i.zone, i.name)
+			}
+			if lastErr != nil {
+				logging.Error("last error: %s", lastErr)
+			}
+			return fmt.Errorf("startup-script timed out after %s, to inspect the startup script output, please run:\n%s",
+				timeout, strings.Join(cmds, "\n"))
+		}
+		logging.Info("waiting for startup-script to finish on %d instance(s)", len(pending))
+		time.Sleep(startupPollInterval)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+/**
+ * Copyright 2024 Google LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestParseStartupStatus(c *C) {
+	c.Check(parseStartupStatus(""), Equals, startupRunning)
+	c.Check(parseStartupStatus("google_metadata_script_runner: Starting startup scripts"), Equals, startupRunning)
+	c.Check(parseStartupStatus("startup-script exit status 0"), Equals, startupSucceeded)
+	c.Check(parseStartupStatus("startup-script exit status 1"), Equals, startupFailed)
+	c.Check(parseStartupStatus("startup-script exit status 1\nstartup-script exit status 0"), Equals, startupSucceeded)
+	c.Check(parseStartupStatus("Script \"startup-script\" failed with error: exit status 1"), Equals, startupFailed)
+
+	// only the last run, after a reboot, is evaluated
+	c.Check(parseStartupStatus("Starting startup scripts\nstartup-script exit status 0\nreboot\nStarting startup scripts"), Equals, startupRunning)
+	c.Check(parseStartupStatus("Starting startup scripts\nScript \"startup-script\" failed with error: exit status 1\n"+
+		"Starting startup scripts\nstartup-script exit status 0"), Equals, startupSucceeded)
+}
+
+func (s *MySuite) TestIsTransientError(c *C) {
+	c.Check(isTransientError(&googleapi.Error{Code: 503}), Equals, true)
+	c.Check(isTransientError(fmt.Errorf("wrapped: %w", &googleapi.Error{Code: 429})), Equals, true)
+	c.Check(isTransientError(&url.Error{Op: "Get", Err: &net.DNSError{IsTimeout: true}}), Equals, true)
+	c.Check(isTransientError(&googleapi.Error{Code: 404}), Equals, false)
+	c.Check(isTransientError(errors.New("boom")), Equals, false)
+}
+
+func (s *MySuite) TestStartupExcerpt(c *C) {
+	lines := []string{"kernel: boot"}
+	for i := 0; i < 30; i++ {
+		lines = append(lines, fmt.Sprintf("startup-script: line %d", i))
+	}
+	got := strings.Split(startupExcerpt(strings.Join(lines, "\n")), "\n")
+	c.Check(got, HasLen, startupExcerptLines)
+	c.Check(got[len(got)-1], Equals, "startup-script: line 29")
+}
@@ -34,6 +34,7 @@ import (
 	"github.com/hashicorp/terraform-exec/tfexec"
 	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/gocty"
+	"golang.org/x/exp/slices"
 )
 
 // ApplyBehavior abstracts behaviors for making changes to cloud infrastructure
@@ -178,15 +179,25 @@ func helpOnPlanError(msgs []JsonMessage) string {
 }
 
 func planModule(tf *tfexec.Terraform, path string, destroy bool) (bool, error) {
-	outOpt := tfexec.Out(path)
+	// pass variables encrypted with `tfvars_encryption`, the plan file is applied without them
+	varFile, removeVarFile, err := modulewriter.DecryptTfvars(tf.WorkingDir())
+	if err != nil {
+		return false, &TfError{fmt.Sprintf("failed to decrypt variables of deployment group %s", tf.WorkingDir()), err}
+	}
+	defer removeVarFile()
+	opts := []tfexec.PlanOption{tfexec.Destroy(destroy)}
+	if varFile != "" {
+		opts = append(opts, tfexec.VarFile(varFile))
+	}
+
 	var jsonOut strings.Builder
-	wantsChange, err := tf.PlanJSON(context.Background(), &jsonOut, outOpt, tfexec.Destroy(destroy))
+	wantsChange, err := tf.PlanJSON(context.Background(), &jsonOut, append(opts, tfexec.Out(path))...)
 	if err != nil {
 		// Invoke `Plan` to get human-readable error.
 		// TODO: implement rendering to avoid double-call.
 		// Note planned deprecration of Plan in favor of JSON-only format
 		// https://github.com/hashicorp/terraform-exec/blob/1b7714111a94813e92936051fb3014fec81218d5/tfexec/plan.go#L128-L129
-		_, plainError := tf.Plan(context.Background(), tfexec.Destroy(destroy))
+		_, plainError := tf.Plan(context.Background(), opts...)
 		if plainError == nil { // shouldn't happen
 			plainError = err // fallback to original error (simple `exit status 1`)
 		}
@@ -206,27 +217,56 @@ func promptForApply(tf *tfexec.Terraform, path string, b ApplyBehavior) bool {
 	case AutomaticApply:
 		return true
 	case PromptBeforeApply:
-		plan, err := tf.ShowPlanFileRaw(context.Background(), path)
+		changes, err := describePlan(tf, path)
 		if err != nil {
 			return false
 		}
+		return ApplyChangesChoice(changes)
+	default:
+		return false
+	}
+}
 
-		re := regexp.MustCompile(`Plan: .*\n`)
-		summary := re.FindString(plan)
+func describePlan(tf *tfexec.Terraform, path string) (ProposedChanges, error) {
+	plan, err := tf.ShowPlanFileRaw(context.Background(), path)
+	if err != nil {
+		return ProposedChanges{}, err
+	}
 
-		if summary == "" {
-			summary = fmt.Sprintf("Please review full proposed changes for deployment group %s", tf.WorkingDir())
-		}
+	re := regexp.MustCompile(`Plan: .*\n`)
+	summary := re.FindString(plan)
 
-		changes := ProposedChanges{
-			Summary: summary,
-			Full:    plan,
-		}
+	if summary == "" {
+		summary = fmt.Sprintf("Please review full proposed changes for deployment group %s", tf.WorkingDir())
+	}
 
-		return ApplyChangesChoice(changes)
-	default:
-		return false
+	return ProposedChanges{
+		Summary: summary,
+		Full:    plan,
+	}, nil
+}
+
+// PlanChanges initializes the deployment group and plans changes to cloud
+// infrastructure without applying them; returns false if no changes are required
+func PlanChanges(tf *tfexec.Terraform) (ProposedChanges, bool, error) {
+	if err := initModule(tf); err != nil {
+		return ProposedChanges{}, false, err
+	}
+
+	f, err := os.CreateTemp("", "plan-")
+	if err != nil {
+		return ProposedChanges{}, false, err
+	}
+	defer os.Remove(f.Name())
+	wantsChange, err := planModule(tf, f.Name(), false)
+	if err != nil {
+		return ProposedChanges{}, false, err
+	}
+	if !wantsChange {
+		return ProposedChanges{Summary: "No changes."}, false, nil
 	}
+	c, err := describePlan(tf, f.Name())
+	return c, true, err
 }
 
 func applyPlanConsoleOutput(tf *tfexec.Terraform, path string) error {
@@ -242,10 +282,24 @@ func applyPlanConsoleOutput(tf *tfexec.Terraform, path string) error {
 	return nil
 }
 
+// checkPlanFile checks the plan file against rules of the policy
+func checkPlanFile(tf *tfexec.Terraform, path string, policy PlanPolicy) error {
+	plan, err := tf.ShowPlanFile(context.Background(), path)
+	if err != nil {
+		return &TfError{fmt.Sprintf("failed to read plan of deployment group %s", tf.WorkingDir()), err}
+	}
+	if err := CheckPlanPolicy(plan, policy); err != nil {
+		return &TfError{fmt.Sprintf("changes of deployment group %s are not applied; "+
+			"change the blueprint or resources, or deploy without --plan-policy", tf.WorkingDir()), err}
+	}
+	return nil
+}
+
 // generate a Terraform plan to apply or destroy a module
 // recall "destroy" is just an alias for "apply -destroy"!
-// apply the plan automatically or after prompting the user
-func applyOrDestroy(tf *tfexec.Terraform, b ApplyBehavior, destroy bool) error {
+// the plan is checked against the policy, then applied automatically or
+// after prompting the user
+func applyOrDestroy(tf *tfexec.Terraform, b ApplyBehavior, destroy bool, policy PlanPolicy) error {
 	action := "adding or changing"
 	pastTense := "applied"
 	if destroy {
@@ -272,6 +326,11 @@ func applyOrDestroy(tf *tfexec.Terraform, b ApplyBehavior, destroy bool) error {
 	var apply bool
 	if wantsChange {
 		logging.Info("Deployment group %s requires %s cloud infrastructure", tf.WorkingDir(), action)
+		if b != NeverApply && policy.Enabled() {
+			if err := checkPlanFile(tf, f.Name(), policy); err != nil {
+				return err
+			}
+		}
 		apply = b == AutomaticApply || promptForApply(tf, f.Name(), b)
 	} else {
 		logging.Info("Cloud infrastructure in deployment group %s is already %s", tf.WorkingDir(), pastTense)
@@ -288,8 +347,8 @@ func applyOrDestroy(tf *tfexec.Terraform, b ApplyBehavior, destroy bool) error {
 	return nil
 }
 
-func getOutputs(tf *tfexec.Terraform, b ApplyBehavior) (map[string]cty.Value, error) {
-	err := applyOrDestroy(tf, b, false)
+func getOutputs(tf *tfexec.Terraform, b ApplyBehavior, policy PlanPolicy) (map[string]cty.Value, error) {
+	err := applyOrDestroy(tf, b, false, policy)
 	if err != nil {
 		return nil, err
 	}
@@ -305,13 +364,18 @@ func outputsFile(artifactsDir string, group config.GroupName) string {
 	return filepath.Join(artifactsDir, fmt.Sprintf("%s_outputs.tfvars", string(group)))
 }
 
+// ReadOutputs reads outputs of the deployment group exported by ExportOutputs
+func ReadOutputs(artifactsDir string, group config.GroupName) (map[string]cty.Value, error) {
+	return modulereader.ReadHclAttributes(outputsFile(artifactsDir, group))
+}
+
 // ExportOutputs will run terraform output and capture data needed for
 // subsequent deployment groups
-func ExportOutputs(tf *tfexec.Terraform, artifactsDir string, applyBehavior ApplyBehavior) error {
+func ExportOutputs(tf *tfexec.Terraform, artifactsDir string, applyBehavior ApplyBehavior, policy PlanPolicy) error {
 	thisGroup := config.GroupName(filepath.Base(tf.WorkingDir()))
 	filepath := outputsFile(artifactsDir, thisGroup)
 
-	outputValues, err := getOutputs(tf, applyBehavior)
+	outputValues, err := getOutputs(tf, applyBehavior, policy)
 	if err != nil {
 		return err
 	}
@@ -388,15 +452,15 @@ func ImportInputs(groupDir string, artifactsDir string, bp config.Blueprint) err
 	case config.TerraformKind:
 		outFile = fmt.Sprintf("%s_inputs.auto.tfvars", g.Name)
 		toImport = inputs // import all
-	case config.PackerKind:
-		// Packer groups are enforced to have length 1
+	case config.PackerKind, config.AnsibleKind:
+		// Packer and Ansible groups are enforced to have length 1
 		mod := g.Modules[0]
 		modPath, err := modulewriter.DeploymentSource(mod)
 		if err != nil {
 			return err
 		}
 
-		// evaluate Packer settings that contain intergroup references in the
+		// evaluate settings that contain intergroup references in the
 		// context of deployment variables and intergroup output values
 		intergroupSettings := map[string]cty.Value{}
 		for setting, value := range mod.Settings.Items() {
@@ -422,6 +486,12 @@ func ImportInputs(groupDir string, artifactsDir string, bp config.Blueprint) err
 			return err
 		}
 
+		if g.Kind() == config.AnsibleKind {
+			modDir := filepath.Join(groupDir, modPath)
+			logging.Info("Writing outputs for deployment group %s to directory %s", g.Name, modDir)
+			return modulewriter.WriteAnsibleVars(evaluatedSettings.Items(), modDir, modulewriter.AnsibleInputsFilename(mod.ID))
+		}
+
 		outFile = filepath.Join(modPath, fmt.Sprintf("%s_inputs.auto.pkrvars.hcl", mod.ID))
 		toImport = evaluatedSettings.Items()
 	default:
@@ -433,7 +503,153 @@ func ImportInputs(groupDir string, artifactsDir string, bp config.Blueprint) err
 	return modulewriter.WriteHclAttributes(toImport, outPath)
 }
 
+// PullState returns the state of the deployment group from its configured backend
+// and the number of resources in it
+func PullState(tf *tfexec.Terraform) (string, int, error) {
+	state, err := tf.StatePull(context.Background())
+	if err != nil {
+		return "", 0, &TfError{
+			help: fmt.Sprintf("reading state of deployment group %s failed; make sure it was initialized with \"terraform init\"", tf.WorkingDir()),
+			err:  err,
+		}
+	}
+	n, err := stateResourceCount(state)
+	return state, n, err
+}
+
+func stateResourceCount(state string) (int, error) {
+	if strings.TrimSpace(state) == "" {
+		return 0, nil // no state yet
+	}
+	var s struct {
+		Resources []json.RawMessage `json:"resources"`
+	}
+	if err := json.Unmarshal([]byte(state), &s); err != nil {
+		return 0, fmt.Errorf("failed to parse terraform state: %w", err)
+	}
+	return len(s.Resources), nil
+}
+
+// StateResource is an instance of a managed resource in Terraform state
+type StateResource struct {
+	Module   string          // path of the module, e.g. "module.network.module.vpc"
+	ModuleID config.ModuleID // blueprint module the resource belongs to, empty for resources of the root module
+	Type     string
+	Name     string // name of the resource with instance key, e.g. `subnet["primary"]`
+	Created  string // creation time recorded by the provider, empty if unknown
+}
+
+// Address returns Terraform address of the resource instance
+func (r StateResource) Address() string {
+	if r.Module == "" {
+		return fmt.Sprintf("%s.%s", r.Type, r.Name)
+	}
+	return fmt.Sprintf("%s.%s.%s", r.Module, r.Type, r.Name)
+}
+
+// creationAttributes are attributes in which providers record creation time of resources
+var creationAttributes = []string{"creation_timestamp", "create_time", "time_created"}
+
+func parseStateResources(state string) ([]StateResource, error) {
+	res := []StateResource{}
+	if strings.TrimSpace(state) == "" {
+		return res, nil // no state yet
+	}
+	var s struct {
+		Resources []struct {
+			Module    string `json:"module"`
+			Mode      string `json:"mode"`
+			Type      string `json:"type"`
+			Name      string `json:"name"`
+			Instances []struct {
+				IndexKey   interface{}            `json:"index_key"`
+				Attributes map[string]interface{} `json:"attributes"`
+			} `json:"instances"`
+		} `json:"resources"`
+	}
+	if err := json.Unmarshal([]byte(state), &s); err != nil {
+		return nil, fmt.Errorf("failed to parse terraform state: %w", err)
+	}
+
+	for _, r := range s.Resources {
+		if r.Mode != "managed" {
+			continue // data sources are not infrastructure
+		}
+		var id config.ModuleID
+		if top, _, _ := strings.Cut(r.Module, ".module."); strings.HasPrefix(top, "module.") {
+			top, _, _ = strings.Cut(strings.TrimPrefix(top, "module."), "[")
+			id = config.ModuleID(top)
+		}
+		for _, inst := range r.Instances {
+			sr := StateResource{Module: r.Module, ModuleID: id, Type: r.Type, Name: r.Name}
+			switch k := inst.IndexKey.(type) {
+			case float64:
+				sr.Name += fmt.Sprintf("[%d]", int(k))
+			case string:
+				sr.Name += fmt.Sprintf("[%q]", k)
+			}
+			for _, a := range creationAttributes {
+				if v, ok := inst.Attributes[a].(string); ok && v != "" {
+					sr.Created = v
+					break
+				}
+			}
+			res = append(res, sr)
+		}
+	}
+	return res, nil
+}
+
+// ListStateResources returns managed resources in the state of the deployment group,
+// the group is initialized if needed
+func ListStateResources(tf *tfexec.Terraform) ([]StateResource, error) {
+	if err := initModule(tf); err != nil {
+		return nil, err
+	}
+	state, _, err := PullState(tf)
+	if err != nil {
+		return nil, err
+	}
+	return parseStateResources(state)
+}
+
+// RemoveFromState removes resources with the addresses from the state of the deployment
+// group without destroying them, addresses that are not in the state are ignored
+func RemoveFromState(tf *tfexec.Terraform, addresses []string) error {
+	rs, err := ListStateResources(tf)
+	if err != nil {
+		return err
+	}
+	for _, r := range rs {
+		if !slices.Contains(addresses, r.Address()) {
+			continue
+		}
+		logging.Info("Removing %s from state of deployment group %s", r.Address(), tf.WorkingDir())
+		if err := tf.StateRm(context.Background(), r.Address()); err != nil {
+			return &TfError{
+				help: fmt.Sprintf("removing %s from state of deployment group %s failed", r.Address(), tf.WorkingDir()),
+				err:  err,
+			}
+		}
+	}
+	return nil
+}
+
+// MigrateState initializes the deployment group with its new backend, copying the state
+// from the backend it was previously initialized with (`terraform init -migrate-state -force-copy`)
+func MigrateState(tf *tfexec.Terraform) error {
+	logging.Info("Migrating state of deployment group %s", tf.WorkingDir())
+	// -force-copy implies -migrate-state
+	if err := tf.Init(context.Background(), tfexec.ForceCopy(true)); err != nil {
+		return &TfError{
+			help: fmt.Sprintf("migration of state of deployment group %s failed; manually resolve errors below", tf.WorkingDir()),
+			err:  err,
+		}
+	}
+	return nil
+}
+
 // Destroy destroys all infrastructure in the module working directory
 func Destroy(tf *tfexec.Terraform, b ApplyBehavior) error {
-	return applyOrDestroy(tf, b, true)
+	return applyOrDestroy(tf, b, true, PlanPolicy{})
 }
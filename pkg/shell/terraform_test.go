@@ -54,3 +54,49 @@ func (s *MySuite) TestFindTerraform(c *C) {
 	var tfe *TfError
 	c.Assert(errors.As(err, &tfe), Equals, true)
 }
+
+func (s *MySuite) TestStateResourceCount(c *C) {
+	n, err := stateResourceCount("")
+	c.Check(err, IsNil)
+	c.Check(n, Equals, 0)
+
+	n, err = stateResourceCount(`{"version": 4, "resources": [{"type": "google_compute_network"}, {"type": "google_compute_subnetwork"}]}`)
+	c.Check(err, IsNil)
+	c.Check(n, Equals, 2)
+
+	_, err = stateResourceCount("not a state")
+	c.Check(err, ErrorMatches, "failed to parse terraform state: .*")
+}
+
+func (s *MySuite) TestParseStateResources(c *C) {
+	got, err := parseStateResources("")
+	c.Check(err, IsNil)
+	c.Check(got, DeepEquals, []StateResource{})
+
+	state := `{"version": 4, "resources": [
+	  {"module": "module.network1.module.vpc", "mode": "managed", "type": "google_compute_network", "name": "network",
+	   "instances": [{"attributes": {"name": "net"}}]},
+	  {"module": "module.network1.module.vpc", "mode": "managed", "type": "google_compute_subnetwork", "name": "subnet",
+	   "instances": [{"index_key": "primary", "attributes": {"creation_timestamp": "2024-03-14T15:09:26.535-07:00"}}]},
+	  {"module": "module.homefs", "mode": "managed", "type": "google_filestore_instance", "name": "filestore",
+	   "instances": [{"index_key": 0, "attributes": {"create_time": "2024-03-14T22:10:00Z"}}]},
+	  {"module": "module.homefs", "mode": "data", "type": "google_compute_network", "name": "net",
+	   "instances": [{"attributes": {}}]},
+	  {"mode": "managed", "type": "terraform_data", "name": "x", "instances": [{"attributes": {}}]}
+	]}`
+	got, err = parseStateResources(state)
+	c.Assert(err, IsNil)
+	c.Check(got, DeepEquals, []StateResource{
+		{Module: "module.network1.module.vpc", ModuleID: "network1", Type: "google_compute_network", Name: "network"},
+		{Module: "module.network1.module.vpc", ModuleID: "network1", Type: "google_compute_subnetwork", Name: `subnet["primary"]`,
+			Created: "2024-03-14T15:09:26.535-07:00"},
+		{Module: "module.homefs", ModuleID: "homefs", Type: "google_filestore_instance", Name: "filestore[0]",
+			Created: "2024-03-14T22:10:00Z"},
+		{Type: "terraform_data", Name: "x"},
+	})
+	c.Check(got[1].Address(), Equals, `module.network1.module.vpc.google_compute_subnetwork.subnet["primary"]`)
+	c.Check(got[3].Address(), Equals, "terraform_data.x")
+
+	_, err = parseStateResources("not a state")
+	c.Check(err, ErrorMatches, "failed to parse terraform state: .*")
+}
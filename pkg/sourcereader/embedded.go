@@ -97,6 +97,10 @@ func (r EmbeddedSourceReader) GetModule(modPath string, copyPath string) error {
 		return fmt.Errorf("source is not valid: %s", modPath)
 	}
 
+	if err := VerifyEmbeddedModules(); err != nil {
+		return err
+	}
+
 	modDir, err := copyFSToTempDir(ModuleFS, modPath)
 	defer os.RemoveAll(modDir)
 	if err != nil {
@@ -105,7 +109,10 @@ func (r EmbeddedSourceReader) GetModule(modPath string, copyPath string) error {
 		return err
 	}
 
-	return copyFromPath(modDir, copyPath)
+	if err := copyFromPath(modDir, copyPath); err != nil {
+		return err
+	}
+	return verifyEmbeddedCopy(modPath, copyPath)
 }
 
 // CopyDir copies embedded directory to destination path
@@ -113,5 +120,11 @@ func (r EmbeddedSourceReader) CopyDir(src string, dst string) error {
 	if ModuleFS == nil {
 		return fmt.Errorf("embedded file system is not initialized")
 	}
-	return copyDir(ModuleFS, src, dst)
+	if err := VerifyEmbeddedModules(); err != nil {
+		return err
+	}
+	if err := copyDir(ModuleFS, src, dst); err != nil {
+		return err
+	}
+	return verifyEmbeddedCopy(src, dst)
 }
@@ -0,0 +1,173 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sourcereader
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ModulesDigest is the digest of the embedded module library computed at build time
+// (see Makefile), it is empty if the binary was not built with make.
+// The digest is SHA-256 of `sha256sum` output for all embedded files sorted by path.
+var ModulesDigest string
+
+// Manifest maps paths of files in the embedded module library to their SHA-256 checksums.
+type Manifest map[string]string
+
+// NewManifest computes checksums of all files in the file system.
+func NewManifest(bfs BaseFS) (Manifest, error) {
+	m := Manifest{}
+	err := fs.WalkDir(bfs, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := bfs.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		m[p] = fmt.Sprintf("%x", sha256.Sum256(content))
+		return nil
+	})
+	return m, err
+}
+
+// String renders the manifest in `sha256sum` format, sorted by path.
+func (m Manifest) String() string {
+	paths := make([]string, 0, len(m))
+	for p := range m {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var sb strings.Builder
+	for _, p := range paths {
+		fmt.Fprintf(&sb, "%s  %s\n", m[p], p)
+	}
+	return sb.String()
+}
+
+// Digest returns SHA-256 of the manifest rendered in `sha256sum` format.
+func (m Manifest) Digest() string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(m.String())))
+}
+
+// ParseManifest parses manifest in `sha256sum` format.
+func ParseManifest(s string) (Manifest, error) {
+	m := Manifest{}
+	for i, ln := range strings.Split(s, "\n") {
+		if ln == "" {
+			continue
+		}
+		sum, p, ok := strings.Cut(ln, "  ")
+		if !ok || len(sum) != 2*sha256.Size || p == "" {
+			return nil, fmt.Errorf("malformed checksum at line %d: %q", i+1, ln)
+		}
+		m[p] = sum
+	}
+	return m, nil
+}
+
+// Sub returns manifest of files in the directory, with paths relative to it.
+func (m Manifest) Sub(dir string) Manifest {
+	prefix := path.Clean(dir) + "/"
+	sub := Manifest{}
+	for p, sum := range m {
+		if strings.HasPrefix(p, prefix) {
+			sub[strings.TrimPrefix(p, prefix)] = sum
+		}
+	}
+	return sub
+}
+
+// Diff returns sorted paths of files that differ or exist only in one of manifests.
+func (m Manifest) Diff(o Manifest) []string {
+	diff := []string{}
+	for p, sum := range m {
+		if o[p] != sum {
+			diff = append(diff, p)
+		}
+	}
+	for p := range o {
+		if _, ok := m[p]; !ok {
+			diff = append(diff, p)
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+var (
+	embeddedManifestOnce sync.Once
+	embeddedManifest     Manifest
+	embeddedManifestErr  error
+)
+
+// EmbeddedManifest returns manifest of the embedded module library, it's computed once.
+func EmbeddedManifest() (Manifest, error) {
+	embeddedManifestOnce.Do(func() {
+		if ModuleFS == nil {
+			embeddedManifestErr = fmt.Errorf("embedded file system is not initialized")
+			return
+		}
+		embeddedManifest, embeddedManifestErr = NewManifest(ModuleFS)
+	})
+	return embeddedManifest, embeddedManifestErr
+}
+
+// VerifyEmbeddedModules checks that the embedded module library matches the digest
+// computed at build time. Does nothing if the binary was built without the digest.
+func VerifyEmbeddedModules() error {
+	if ModulesDigest == "" {
+		return nil
+	}
+	m, err := EmbeddedManifest()
+	if err != nil {
+		return err
+	}
+	if got := m.Digest(); got != ModulesDigest {
+		return fmt.Errorf("embedded module library is corrupted or was modified: digest is %s, binary was built with %s", got, ModulesDigest)
+	}
+	return nil
+}
+
+// verifyEmbeddedCopy checks that files copied from the embedded directory have the same checksums.
+func verifyEmbeddedCopy(src string, dst string) error {
+	m, err := EmbeddedManifest()
+	if err != nil {
+		return err
+	}
+	return verifyCopy(m, src, dst)
+}
+
+func verifyCopy(m Manifest, src string, dst string) error {
+	for rel, sum := range m.Sub(src) {
+		content, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(rel)))
+		if err != nil {
+			return fmt.Errorf("failed to verify copy of embedded %s: %w", path.Join(src, rel), err)
+		}
+		if got := fmt.Sprintf("%x", sha256.Sum256(content)); got != sum {
+			return fmt.Errorf("copy of embedded %s to %s is corrupted", path.Join(src, rel), dst)
+		}
+	}
+	return nil
+}
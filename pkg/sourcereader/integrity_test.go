@@ -0,0 +1,94 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sourcereader
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *zeroSuite) TestManifestDigest(c *C) {
+	m := Manifest{
+		"modules/b/main.tf":   "bbb",
+		"modules/a-c/main.tf": "ccc",
+		"modules/a/main.tf":   "aaa",
+	}
+	// same as `sha256sum` output sorted by path, then hashed
+	want := fmt.Sprintf("%x", sha256.Sum256([]byte(
+		"ccc  modules/a-c/main.tf\naaa  modules/a/main.tf\nbbb  modules/b/main.tf\n")))
+	c.Check(m.Digest(), Equals, want)
+}
+
+func (s *zeroSuite) TestNewManifest(c *C) {
+	m, err := NewManifest(testEmbeddedFS)
+	c.Assert(err, IsNil)
+	content, err := testEmbeddedFS.ReadFile("modules/network/vpc/main.tf")
+	c.Assert(err, IsNil)
+	c.Check(m["modules/network/vpc/main.tf"], Equals, fmt.Sprintf("%x", sha256.Sum256(content)))
+}
+
+func (s *embeddedSuite) TestVerifyEmbeddedModules(c *C) {
+	defer func(d string) { ModulesDigest = d }(ModulesDigest)
+	m, err := EmbeddedManifest()
+	c.Assert(err, IsNil)
+
+	ModulesDigest = "" // built without digest
+	c.Check(VerifyEmbeddedModules(), IsNil)
+
+	ModulesDigest = m.Digest()
+	c.Check(VerifyEmbeddedModules(), IsNil)
+
+	ModulesDigest = "tampered"
+	c.Check(VerifyEmbeddedModules(), ErrorMatches, ".*corrupted or was modified.*")
+	c.Check(s.r.CopyDir("modules/network", c.MkDir()), ErrorMatches, ".*corrupted or was modified.*")
+}
+
+func (s *embeddedSuite) TestVerifyCopy(c *C) {
+	dst := c.MkDir()
+	c.Assert(s.r.CopyDir("modules/network", dst), IsNil)
+	m, err := EmbeddedManifest()
+	c.Assert(err, IsNil)
+	c.Check(verifyCopy(m, "modules/network", dst), IsNil)
+
+	c.Assert(os.WriteFile(filepath.Join(dst, "vpc/main.tf"), []byte("#"), 0644), IsNil)
+	c.Check(verifyCopy(m, "modules/network", dst), ErrorMatches, ".*modules/network/vpc/main.tf.*corrupted")
+
+	c.Assert(os.Remove(filepath.Join(dst, "vpc/main.tf")), IsNil)
+	c.Check(verifyCopy(m, "modules/network", dst), ErrorMatches, "failed to verify copy .*")
+}
+
+func (s *zeroSuite) TestParseManifest(c *C) {
+	sum := fmt.Sprintf("%x", sha256.Sum256([]byte("lime")))
+	m := Manifest{"modules/a/main.tf": sum, "modules/a/b/c.tf": sum, "other/d.tf": sum}
+	got, err := ParseManifest(m.String())
+	c.Assert(err, IsNil)
+	c.Check(got, DeepEquals, m)
+
+	c.Check(m.Sub("modules/a"), DeepEquals, Manifest{"main.tf": sum, "b/c.tf": sum})
+
+	_, err = ParseManifest("deadbeef  modules/a/main.tf\n")
+	c.Check(err, ErrorMatches, "malformed checksum at line 1: .*")
+}
+
+func (s *zeroSuite) TestManifestDiff(c *C) {
+	a := Manifest{"same": "1", "changed": "2", "removed": "3"}
+	b := Manifest{"same": "1", "changed": "22", "added": "4"}
+	c.Check(a.Diff(b), DeepEquals, []string{"added", "changed", "removed"})
+	c.Check(a.Diff(a), DeepEquals, []string{})
+}
@@ -0,0 +1,256 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package support
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// formats of placeholders by kind of the replaced value
+var placeholderFormats = map[string]string{
+	"project": "example-project-%d",
+	"bucket":  "example-bucket-%d",
+	"domain":  "domain%d.example",
+	"user":    "user%d",
+}
+
+// keys whose values, and elements of their values, are anonymized by kind
+var anonymizedKeyRes = map[string]*regexp.Regexp{
+	"project": regexp.MustCompile(`(?i)project(_id)?$`),
+	"bucket":  regexp.MustCompile(`(?i)bucket(_name)?$`),
+	"domain":  regexp.MustCompile(`(?i)(domain|dns_name|dns_record_name|hostname|fqdn)$`),
+}
+
+var (
+	projectTextRe = regexp.MustCompile(`projects/([a-z][-a-z0-9]{4,28}[a-z0-9])\b`)
+	bucketTextRe  = regexp.MustCompile(`gs://([a-z0-9][-a-z0-9_.]*[a-z0-9])`)
+	emailTextRe   = regexp.MustCompile(`[A-Za-z0-9._%+-]+@((?:[A-Za-z0-9-]+\.)+[A-Za-z]{2,})`)
+	// service accounts created in a project, e.g. sa@my-project.iam.gserviceaccount.com
+	serviceAccountDomainRe = regexp.MustCompile(`^([a-z][-a-z0-9]{4,28}[a-z0-9])\.iam\.gserviceaccount\.com$`)
+)
+
+// publicDomains do not identify users and are kept, as are their subdomains
+var publicDomains = []string{
+	"example", "example.com", "gmail.com", "google.com", "googleapis.com", "gserviceaccount.com",
+	"github.com", "gcr.io", "pkg.dev", "internal",
+}
+
+func isPublicDomain(d string) bool {
+	d = strings.ToLower(d)
+	for _, p := range publicDomains {
+		if d == p || strings.HasSuffix(d, "."+p) {
+			return true
+		}
+	}
+	return false
+}
+
+// anonymizer collects identifying values and assigns them placeholders, numbered
+// in order of first occurrence
+type anonymizer struct {
+	placeholders map[string]string // by original value
+	counts       map[string]int    // number of placeholders by kind
+	emails       map[string]string // domains of collected email addresses
+}
+
+func newAnonymizer() *anonymizer {
+	return &anonymizer{placeholders: map[string]string{}, counts: map[string]int{}, emails: map[string]string{}}
+}
+
+func (a *anonymizer) add(kind string, v string) {
+	if v == "" || strings.Contains(v, "$(") || strings.Contains(v, "((") {
+		return // references and expressions are not identifying
+	}
+	if _, ok := a.placeholders[v]; ok {
+		return
+	}
+	a.counts[kind]++
+	a.placeholders[v] = fmt.Sprintf(placeholderFormats[kind], a.counts[kind])
+}
+
+func (a *anonymizer) collectText(s string) {
+	for _, m := range projectTextRe.FindAllStringSubmatch(s, -1) {
+		a.add("project", m[1])
+	}
+	for _, m := range bucketTextRe.FindAllStringSubmatch(s, -1) {
+		a.add("bucket", m[1])
+	}
+	for _, m := range emailTextRe.FindAllStringSubmatch(s, -1) {
+		email, domain := m[0], m[1]
+		if sa := serviceAccountDomainRe.FindStringSubmatch(domain); sa != nil {
+			a.add("project", sa[1])
+		} else if !isPublicDomain(domain) {
+			a.add("domain", domain)
+		}
+		if _, ok := a.emails[email]; !ok {
+			a.emails[email] = domain
+			a.add("user", email)
+		}
+	}
+}
+
+func (a *anonymizer) collectKind(kind string, n *yaml.Node) {
+	if n.Kind != yaml.ScalarNode {
+		for _, c := range n.Content {
+			a.collectKind(kind, c)
+		}
+		return
+	}
+	v := n.Value
+	if kind == "domain" {
+		v = strings.TrimSuffix(v, ".")
+		if !strings.Contains(v, ".") || isPublicDomain(v) {
+			return
+		}
+	}
+	a.add(kind, v)
+}
+
+func (a *anonymizer) collect(n *yaml.Node) {
+	for _, c := range []string{n.HeadComment, n.LineComment, n.FootComment} {
+		a.collectText(c)
+	}
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			a.collect(k)
+			for _, kind := range []string{"project", "bucket", "domain"} {
+				if anonymizedKeyRes[kind].MatchString(k.Value) {
+					a.collectKind(kind, v)
+				}
+			}
+			a.collect(v)
+		}
+	case yaml.ScalarNode:
+		a.collectText(n.Value)
+	default:
+		for _, c := range n.Content {
+			a.collect(c)
+		}
+	}
+}
+
+// isWordByte tests whether the byte may be part of an identifier, replaced values
+// must not be surrounded by such bytes
+func isWordByte(b byte) bool {
+	return b == '-' || b == '_' || ('0' <= b && b <= '9') || ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z')
+}
+
+func replaceWord(s string, old string, new string) string {
+	var sb strings.Builder
+	for {
+		i := strings.Index(s, old)
+		if i < 0 {
+			sb.WriteString(s)
+			return sb.String()
+		}
+		j := i + len(old)
+		if (i > 0 && isWordByte(s[i-1])) || (j < len(s) && isWordByte(s[j])) {
+			sb.WriteString(s[:i+1])
+			s = s[i+1:]
+			continue
+		}
+		sb.WriteString(s[:i])
+		sb.WriteString(new)
+		s = s[j:]
+	}
+}
+
+// finalize completes placeholders of email addresses with placeholders of their
+// domains and returns original values, longest first
+func (a *anonymizer) finalize() []string {
+	values := []string{}
+	for v := range a.placeholders {
+		if _, ok := a.emails[v]; !ok {
+			values = append(values, v)
+		}
+	}
+	sortLongestFirst(values)
+	for email, domain := range a.emails {
+		a.placeholders[email] += "@" + a.replaceAll(domain, values)
+	}
+	values = values[:0]
+	for v := range a.placeholders {
+		values = append(values, v)
+	}
+	sortLongestFirst(values)
+	return values
+}
+
+func sortLongestFirst(values []string) {
+	sort.Slice(values, func(i, j int) bool {
+		if len(values[i]) != len(values[j]) {
+			return len(values[i]) > len(values[j])
+		}
+		return values[i] < values[j]
+	})
+}
+
+// replaceAll replaces values in s with their placeholders, values are replaced
+// longest first, so that e.g. an email address is replaced before its domain
+func (a *anonymizer) replaceAll(s string, values []string) string {
+	for _, v := range values {
+		if strings.Contains(s, v) {
+			s = replaceWord(s, v, a.placeholders[v])
+		}
+	}
+	return s
+}
+
+func (a *anonymizer) replace(n *yaml.Node, values []string) {
+	n.HeadComment = a.replaceAll(n.HeadComment, values)
+	n.LineComment = a.replaceAll(n.LineComment, values)
+	n.FootComment = a.replaceAll(n.FootComment, values)
+	if n.Kind == yaml.ScalarNode {
+		n.Value = a.replaceAll(n.Value, values)
+	}
+	for _, c := range n.Content {
+		a.replace(c, values)
+	}
+}
+
+// AnonymizeYaml replaces project IDs, bucket names, domains and email addresses
+// with placeholders, such as `example-project-1`, and redacts secrets as RedactYaml
+// does. The same value is replaced by the same placeholder throughout the document,
+// so that the structure and references of a blueprint are preserved. Values are
+// found by names of settings (e.g. `project_id`, `bucket`, `dns_name`) and by
+// patterns (e.g. `projects/<project>/` and `gs://<bucket>`) anywhere in the
+// document, including comments. Anonymization is best-effort.
+func AnonymizeYaml(data []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	redactNode(&doc)
+
+	a := newAnonymizer()
+	a.collect(&doc)
+	a.replace(&doc, a.finalize())
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
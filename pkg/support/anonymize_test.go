@@ -0,0 +1,95 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package support
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestReplaceWord(c *C) {
+	c.Check(replaceWord("acme acme-dev acme.com xacme acme", "acme", "p"), Equals, "p acme-dev p.com xacme p")
+	c.Check(replaceWord("", "acme", "p"), Equals, "")
+}
+
+func (s *MySuite) TestAnonymizeYaml(c *C) {
+	in := `blueprint_name: acme-hpc
+vars:
+  project_id: acme-prod # owned by hpc-admins@acme.com
+  deployment_name: acme-hpc
+  region: us-central1
+  db_password: hunter2
+terraform_backend_defaults:
+  type: gcs
+  configuration:
+    bucket: acme-tf-state
+deployment_groups:
+- group: primary
+  modules:
+  - id: net
+    source: modules/network/pre-existing-vpc
+    settings:
+      project_id: acme-host
+      network_name: default
+  - id: vm
+    source: modules/compute/vm-instance
+    settings:
+      project_id: $(vars.project_id)
+      subnetwork_self_link: projects/acme-host/regions/us-central1/subnetworks/default
+      service_account_email: hpc-sa@acme-prod.iam.gserviceaccount.com
+      startup_script: gsutil cp gs://acme-scripts/setup.sh - | bash
+  - id: lb
+    source: community/modules/network/login-load-balancer
+    settings:
+      dns_record_name: login.hpc.acme.com.
+      dns_zone_name: acme-zone
+`
+	want := `blueprint_name: acme-hpc
+vars:
+  project_id: example-project-1 # owned by user1@domain1.example
+  deployment_name: acme-hpc
+  region: us-central1
+  db_password: REDACTED
+terraform_backend_defaults:
+  type: gcs
+  configuration:
+    bucket: example-bucket-1
+deployment_groups:
+  - group: primary
+    modules:
+      - id: net
+        source: modules/network/pre-existing-vpc
+        settings:
+          project_id: example-project-2
+          network_name: default
+      - id: vm
+        source: modules/compute/vm-instance
+        settings:
+          project_id: $(vars.project_id)
+          subnetwork_self_link: projects/example-project-2/regions/us-central1/subnetworks/default
+          service_account_email: user2@example-project-1.iam.gserviceaccount.com
+          startup_script: gsutil cp gs://example-bucket-2/setup.sh - | bash
+      - id: lb
+        source: community/modules/network/login-load-balancer
+        settings:
+          dns_record_name: domain2.example.
+          dns_zone_name: acme-zone
+`
+	got, err := AnonymizeYaml([]byte(in))
+	c.Assert(err, IsNil)
+	c.Check(string(got), Equals, want)
+
+	_, err = AnonymizeYaml([]byte("a: [b"))
+	c.Check(err, NotNil)
+}
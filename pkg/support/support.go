@@ -0,0 +1,135 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package support collects redacted information about a deployment for bug reports
+package support
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Redacted replaces values that may contain secrets
+const Redacted = "REDACTED"
+
+// secretKeyRe matches names of settings and variables that may hold secrets
+var secretKeyRe = regexp.MustCompile(`(?i)(password|passwd|secret|token|private_key|api_key|credential|access_key)`)
+
+// secretTextRes match secrets in free-form text, such as logs. The first group
+// of the expression is kept, the rest is replaced.
+var secretTextRes = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)((?:password|passwd|secret|token|private_key|api_key|access_key)\w*["']?\s*[:=]\s*["']?)[^\s"',}]+`),
+	regexp.MustCompile(`()ya29\.[0-9A-Za-z_\-.]+`), // OAuth access tokens
+	regexp.MustCompile(`(?s)(-----BEGIN [A-Z ]*PRIVATE KEY-----).*?-----END [A-Z ]*PRIVATE KEY-----`),
+}
+
+// IsSecretKey tests whether the name of a setting or variable suggests it holds a secret
+func IsSecretKey(name string) bool {
+	return secretKeyRe.MatchString(name)
+}
+
+// RedactText replaces secrets in free-form text
+func RedactText(s string) string {
+	for _, re := range secretTextRes {
+		s = re.ReplaceAllString(s, "${1}"+Redacted)
+	}
+	return s
+}
+
+// RedactYaml replaces values of mapping keys that may hold secrets, comments and
+// layout of the document are preserved. Scalars are redacted as free-form text as well.
+func RedactYaml(data []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	redactNode(&doc)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func redactNode(n *yaml.Node) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			if IsSecretKey(k.Value) && !(v.Kind == yaml.ScalarNode && v.Tag == "!!null") {
+				*v = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: Redacted, LineComment: v.LineComment}
+				continue
+			}
+			redactNode(v)
+		}
+	case yaml.ScalarNode:
+		n.Value = RedactText(n.Value)
+	default:
+		for _, c := range n.Content {
+			redactNode(c)
+		}
+	}
+}
+
+// Tail returns at most `limit` last bytes of data, cut at a line boundary
+func Tail(data []byte, limit int) []byte {
+	if len(data) <= limit {
+		return data
+	}
+	data = data[len(data)-limit:]
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		data = data[i+1:]
+	}
+	return data
+}
+
+// File is a file of the support bundle
+type File struct {
+	Name    string // slash-separated path within the bundle
+	Content []byte
+}
+
+// WriteBundle writes files into a gzipped tarball, under the `root` directory
+func WriteBundle(w io.Writer, root string, files []File, modTime time.Time) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name:    fmt.Sprintf("%s/%s", root, f.Name),
+			Mode:    0644,
+			Size:    int64(len(f.Content)),
+			ModTime: modTime,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.Content); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
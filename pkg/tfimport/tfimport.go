@@ -0,0 +1,211 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tfimport converts existing Terraform root modules into blueprints
+package tfimport
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// GroupName is a name of the single deployment group of imported blueprint
+const GroupName = "primary"
+
+// Issue is a Terraform construct that could not be (fully) converted into a blueprint
+type Issue struct {
+	Range hcl.Range
+	Msg   string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s:%d: %s", i.Range.Filename, i.Range.Start.Line, i.Msg)
+}
+
+// metaArgs are module block arguments that have no blueprint equivalent
+var metaArgs = map[string]bool{
+	"count":      true,
+	"for_each":   true,
+	"depends_on": true,
+	"providers":  true,
+}
+
+type importer struct {
+	dir    string
+	files  map[string][]byte
+	issues []Issue
+}
+
+func (im *importer) flag(r hcl.Range, format string, a ...any) {
+	im.issues = append(im.issues, Issue{Range: r, Msg: fmt.Sprintf(format, a...)})
+}
+
+// Import parses Terraform root module in the directory and builds a best-effort
+// blueprint out of it. Constructs that can not be converted are returned as issues.
+func Import(dir string) (config.Blueprint, []Issue, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil {
+		return config.Blueprint{}, nil, err
+	}
+	if len(paths) == 0 {
+		return config.Blueprint{}, nil, fmt.Errorf("no Terraform files found in %q", dir)
+	}
+	sort.Strings(paths)
+
+	im := importer{dir: dir, files: map[string][]byte{}}
+	parser := hclparse.NewParser()
+	vars := config.Dict{}
+	mods := []config.Module{}
+	for _, p := range paths {
+		f, diags := parser.ParseHCLFile(p)
+		if diags.HasErrors() {
+			return config.Blueprint{}, nil, diags
+		}
+		im.files[p] = f.Bytes
+		body := f.Body.(*hclsyntax.Body)
+		for name, a := range body.Attributes {
+			im.flag(a.SrcRange, "top-level attribute %q is not supported", name)
+		}
+		for _, b := range body.Blocks {
+			switch b.Type {
+			case "variable":
+				vars = im.importVariable(b, vars)
+			case "module":
+				if m, ok := im.importModule(b); ok {
+					mods = append(mods, m)
+				}
+			case "terraform":
+				// backend and provider requirements are configured by the toolkit
+			default:
+				im.flag(b.DefRange(), "%s %s is not supported, consider moving it into a module",
+					b.Type, strings.Join(b.Labels, "."))
+			}
+		}
+	}
+
+	name := filepath.Base(filepath.Clean(dir))
+	if abs, err := filepath.Abs(dir); err == nil {
+		name = filepath.Base(abs)
+	}
+	if !vars.Has("deployment_name") {
+		vars = vars.With("deployment_name", cty.StringVal(name))
+	}
+	sort.Slice(mods, func(i, j int) bool { return mods[i].ID < mods[j].ID })
+
+	bp := config.Blueprint{
+		BlueprintName: name,
+		Vars:          vars,
+		Groups:        []config.Group{{Name: GroupName, Modules: mods}},
+	}
+	sort.SliceStable(im.issues, func(i, j int) bool {
+		a, b := im.issues[i].Range, im.issues[j].Range
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Start.Line < b.Start.Line
+	})
+	return bp, im.issues, nil
+}
+
+func (im *importer) importVariable(b *hclsyntax.Block, vars config.Dict) config.Dict {
+	name := b.Labels[0]
+	def, ok := b.Body.Attributes["default"]
+	if !ok {
+		im.flag(b.DefRange(), "variable %q has no default, set its value in the blueprint", name)
+		return vars.With(name, cty.NullVal(cty.DynamicPseudoType))
+	}
+	v, diags := def.Expr.Value(nil)
+	if diags.HasErrors() {
+		im.flag(def.SrcRange, "default of variable %q is not a constant", name)
+		return vars.With(name, cty.NullVal(cty.DynamicPseudoType))
+	}
+	return vars.With(name, v)
+}
+
+func (im *importer) importModule(b *hclsyntax.Block) (config.Module, bool) {
+	id := b.Labels[0]
+	src, ok := b.Body.Attributes["source"]
+	if !ok {
+		im.flag(b.DefRange(), "module %q has no source", id)
+		return config.Module{}, false
+	}
+	sv, diags := src.Expr.Value(nil)
+	if diags.HasErrors() || sv.Type() != cty.String || sv.IsNull() {
+		im.flag(src.SrcRange, "source of module %q is not a constant string", id)
+		return config.Module{}, false
+	}
+	source := sv.AsString()
+	if strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../") {
+		// local sources are relative to the Terraform directory
+		source = filepath.ToSlash(filepath.Join(im.dir, source))
+		if !filepath.IsAbs(source) && !strings.HasPrefix(source, "../") {
+			source = "./" + source
+		}
+	}
+
+	for _, blk := range b.Body.Blocks {
+		im.flag(blk.DefRange(), "block %q in module %q is not supported", blk.Type, id)
+	}
+
+	settings := config.Dict{}
+	for name, a := range b.Body.Attributes {
+		switch {
+		case name == "source":
+			continue
+		case name == "version":
+			im.flag(a.SrcRange, "version of module %q is ignored, pin version in the source instead", id)
+			continue
+		case metaArgs[name]:
+			im.flag(a.SrcRange, "meta-argument %q of module %q is not supported", name, id)
+			continue
+		}
+		v, err := im.convertExpr(a.Expr)
+		if err != nil {
+			im.flag(a.SrcRange, "setting %q of module %q is not converted: %s", name, id, err)
+			continue
+		}
+		settings = settings.With(name, v)
+	}
+
+	return config.Module{
+		ID:       config.ModuleID(id),
+		Source:   source,
+		Kind:     config.TerraformKind,
+		Settings: settings,
+	}, true
+}
+
+// convertExpr converts HCL expression into a constant value or a blueprint expression
+func (im *importer) convertExpr(e hclsyntax.Expression) (cty.Value, error) {
+	if len(e.Variables()) == 0 {
+		if v, diags := e.Value(nil); !diags.HasErrors() {
+			return v, nil
+		}
+	}
+	r := e.Range()
+	text := string(r.SliceBytes(im.files[r.Filename]))
+	exp, err := config.ParseExpression(text)
+	if err != nil {
+		return cty.NilVal, fmt.Errorf("only references to variables and module outputs are supported")
+	}
+	return exp.AsValue(), nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tfimport
+
+import (
+	"hpc-toolkit/pkg/config"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+	. "gopkg.in/check.v1"
+)
+
+type MySuite struct{}
+
+var _ = Suite(&MySuite{})
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+const mainTf = `
+terraform {
+  backend "gcs" {}
+}
+
+variable "project_id" {
+  type = string
+}
+
+variable "region" {
+  default = "us-central1"
+}
+
+module "network" {
+  source     = "github.com/GoogleCloudPlatform/hpc-toolkit//modules/network/vpc"
+  project_id = var.project_id
+  region     = var.region
+  mtu        = 8896
+}
+
+module "homefs" {
+  source      = "./modules/fs"
+  count       = 2
+  network_id  = module.network.network_id
+  labels      = local.labels
+  local_mount = "/home"
+}
+
+resource "google_compute_address" "ip" {
+  name = "ip"
+}
+`
+
+func (s *MySuite) TestImport(c *C) {
+	dir := filepath.Join(c.MkDir(), "legacy")
+	c.Assert(os.Mkdir(dir, 0755), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(dir, "main.tf"), []byte(mainTf), 0644), IsNil)
+
+	bp, issues, err := Import(dir)
+	c.Assert(err, IsNil)
+
+	c.Check(bp.BlueprintName, Equals, "legacy")
+	c.Check(bp.Vars.Items(), DeepEquals, map[string]cty.Value{
+		"project_id":      cty.NullVal(cty.DynamicPseudoType),
+		"region":          cty.StringVal("us-central1"),
+		"deployment_name": cty.StringVal("legacy"),
+	})
+
+	c.Assert(bp.Groups, HasLen, 1)
+	mods := bp.Groups[0].Modules
+	c.Assert(mods, HasLen, 2)
+
+	fs, net := mods[0], mods[1]
+	c.Check(net.ID, Equals, config.ModuleID("network"))
+	c.Check(net.Source, Equals, "github.com/GoogleCloudPlatform/hpc-toolkit//modules/network/vpc")
+	c.Check(net.Settings.Get("project_id"), DeepEquals, config.GlobalRef("project_id").AsValue())
+	c.Check(net.Settings.Get("region"), DeepEquals, config.GlobalRef("region").AsValue())
+	c.Check(net.Settings.Get("mtu").Equals(cty.NumberIntVal(8896)).True(), Equals, true)
+
+	c.Check(fs.ID, Equals, config.ModuleID("homefs"))
+	c.Check(fs.Source, Equals, filepath.ToSlash(filepath.Join(dir, "modules/fs")))
+	c.Check(fs.Settings.Items(), DeepEquals, map[string]cty.Value{
+		"network_id":  config.ModuleRef("network", "network_id").AsValue(),
+		"local_mount": cty.StringVal("/home"),
+	})
+
+	lines := []int{}
+	for _, i := range issues {
+		lines = append(lines, i.Range.Start.Line)
+	}
+	c.Check(lines, DeepEquals, []int{
+		6,  // project_id has no default
+		23, // count
+		25, // local.labels
+		29, // resource
+	})
+}
+
+func (s *MySuite) TestImportNoFiles(c *C) {
+	_, _, err := Import(c.MkDir())
+	c.Check(err, NotNil)
+}
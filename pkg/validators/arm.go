@@ -0,0 +1,243 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/maps"
+)
+
+// CPU architectures
+const (
+	archX86 = "x86_64"
+	archArm = "arm64"
+)
+
+var (
+	// armMachinePrefixes are machine families with Arm CPUs
+	armMachinePrefixes = []string{"t2a-", "c4a-"}
+
+	// publicImageProjects publish x86 images unless family is marked as Arm
+	publicImageProjects = []string{
+		"cloud-hpc-image-public", "schedmd-slurm-public", "deeplearning-platform-release",
+		"debian-cloud", "rocky-linux-cloud", "rocky-linux-accelerator-cloud", "ubuntu-os-cloud",
+		"ubuntu-os-accelerator-images", "centos-cloud", "rhel-cloud", "cos-cloud",
+		"windows-cloud", "windows-sql-cloud"}
+
+	armImageRe = regexp.MustCompile(`(?i)(arm64|aarch64)`)
+	x86ImageRe = regexp.MustCompile(`(?i)(amd64|x86_64|x86-64)`)
+
+	spackTargetRe = regexp.MustCompile(`target=([A-Za-z0-9_]+)`)
+	// armSpackTargets are Spack microarchitectures of Arm CPUs available on Google Cloud
+	armSpackTargets = []string{"aarch64", "armv8.1a", "armv8.2a", "armv8.4a", "armv9.0a", "neoverse_n1", "neoverse_v1", "neoverse_v2"}
+	// genericSpackTargets are Spack targets that do not imply an architecture
+	genericSpackTargets = []string{"native", "default_target"}
+)
+
+func isArmMachineType(mt string) bool {
+	for _, p := range armMachinePrefixes {
+		if strings.HasPrefix(mt, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func machineArch(mt string) string {
+	if isArmMachineType(mt) {
+		return archArm
+	}
+	return archX86
+}
+
+// imageArch returns architecture of the image family, returns false if it is not known
+func imageArch(family string, project string) (string, bool) {
+	if armImageRe.MatchString(family) {
+		return archArm, true
+	}
+	for _, p := range publicImageProjects {
+		if p == project {
+			return archX86, true
+		}
+	}
+	return "", false
+}
+
+// spackTargetArch returns architecture of the Spack target, returns false if it is generic
+func spackTargetArch(target string) (string, bool) {
+	for _, g := range genericSpackTargets {
+		if target == g {
+			return "", false
+		}
+	}
+	for _, a := range armSpackTargets {
+		if target == a {
+			return archArm, true
+		}
+	}
+	return archX86, true
+}
+
+// containerArch returns architecture of the container image based on its tag
+func containerArch(image string) (string, bool) {
+	switch {
+	case armImageRe.MatchString(image):
+		return archArm, true
+	case x86ImageRe.MatchString(image):
+		return archX86, true
+	}
+	return "", false
+}
+
+// knownStrings returns all strings in settings of the module that can be evaluated
+func knownStrings(bp config.Blueprint, m config.Module) []string {
+	res := []string{}
+	for _, k := range m.Settings.Keys() {
+		v, err := bp.Eval(m.Settings.Get(k))
+		if err != nil {
+			continue // refers to outputs of other modules
+		}
+		cty.Walk(v, func(_ cty.Path, v cty.Value) (bool, error) {
+			if v.IsKnown() && !v.IsNull() && v.Type() == cty.String {
+				res = append(res, v.AsString())
+			}
+			return true, nil
+		})
+	}
+	return res
+}
+
+// moduleDependencies returns modules the module refers to, directly or transitively
+func moduleDependencies(bp config.Blueprint, m config.Module) []config.Module {
+	seen := map[config.ModuleID]bool{m.ID: true}
+	res := []config.Module{}
+	queue := []config.Module{m}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for r := range config.ValueReferences(cur.Settings.AsObject()) {
+			if r.GlobalVar || seen[r.Module] {
+				continue
+			}
+			seen[r.Module] = true
+			if dep, err := bp.Module(r.Module); err == nil {
+				res = append(res, *dep)
+				queue = append(queue, *dep)
+			}
+		}
+	}
+	return res
+}
+
+// softwareArchs returns architectures required by Spack targets and container images
+// configured by the module and modules it depends on, keyed by description of the source
+func softwareArchs(bp config.Blueprint, m config.Module) map[string]string {
+	res := map[string]string{}
+	for _, d := range append([]config.Module{m}, moduleDependencies(bp, m)...) {
+		if strings.Contains(d.Source, "spack-") {
+			for _, s := range knownStrings(bp, d) {
+				for _, t := range spackTargetRe.FindAllStringSubmatch(s, -1) {
+					if a, ok := spackTargetArch(t[1]); ok {
+						res[fmt.Sprintf("Spack target %q of module %q", t[1], d.ID)] = a
+					}
+				}
+			}
+		}
+		for _, setting := range []string{"docker_image", "container_image"} {
+			if img, ok := evalStringSetting(bp, d, setting); ok {
+				if a, ok := containerArch(img); ok {
+					res[fmt.Sprintf("container image %q of module %q", img, d.ID)] = a
+				}
+			}
+		}
+	}
+	return res
+}
+
+func checkModuleArch(bp config.Blueprint, p config.ModulePath, m config.Module) error {
+	mt, ok := evalStringSetting(bp, m, "machine_type")
+	if !ok {
+		return nil
+	}
+	arch := machineArch(mt)
+	errs := config.Errors{}
+	if family, project, ok := moduleImage(bp, m); ok {
+		if ia, ok := imageArch(family, project); ok && ia != arch {
+			errs.At(p.Settings, config.HintError{
+				Hint: fmt.Sprintf("use an %s image family, e.g. %q", arch, map[string]string{archArm: "rocky-linux-8-optimized-gcp-arm64", archX86: "hpc-rocky-linux-8"}[arch]),
+				Err:  fmt.Errorf("image family %q of module %q is built for %s, but machine type %q is %s", family, m.ID, ia, mt, arch)})
+		}
+	}
+
+	sw := softwareArchs(bp, m)
+	srcs := maps.Keys(sw)
+	sort.Strings(srcs)
+	for _, s := range srcs {
+		if sw[s] != arch {
+			errs.At(p.Settings.Dot("machine_type"), fmt.Errorf("%s is built for %s, but machine type %q of module %q is %s", s, sw[s], mt, m.ID, arch))
+		}
+	}
+	return errs.OrNil()
+}
+
+// checkPartitionArch checks that nodes of the partition have the same architecture
+func checkPartitionArch(bp config.Blueprint, p config.ModulePath, m config.Module) error {
+	archs := map[string][]string{}
+	seen := map[config.ModuleID]bool{}
+	for r := range config.ValueReferences(m.Settings.AsObject()) {
+		if r.GlobalVar || seen[r.Module] {
+			continue
+		}
+		seen[r.Module] = true
+		dep, err := bp.Module(r.Module)
+		if err != nil {
+			continue
+		}
+		if mt, ok := evalStringSetting(bp, *dep, "machine_type"); ok {
+			a := machineArch(mt)
+			archs[a] = append(archs[a], fmt.Sprintf("%q", dep.ID))
+		}
+	}
+	if len(archs) < 2 {
+		return nil
+	}
+	for _, ids := range archs {
+		sort.Strings(ids)
+	}
+	return config.BpError{Path: p, Err: config.HintError{
+		Hint: fmt.Sprintf("if mixing architectures is intentional, add %q to `skip_validators` of module %q with a justification", testArmCompatibleName, m.ID),
+		Err: fmt.Errorf("partition module %q mixes Arm nodes of %s with x86 nodes of %s, jobs may run on either architecture",
+			m.ID, strings.Join(archs[archArm], ", "), strings.Join(archs[archX86], ", "))}}
+}
+
+func testArmCompatible(bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{}); err != nil {
+		return err
+	}
+	errs := config.Errors{}
+	bp.WalkModulesSafe(func(p config.ModulePath, m *config.Module) {
+		errs.Add(checkModuleArch(bp, p, *m))
+		if strings.Contains(m.Source, "partition") {
+			errs.Add(checkPartitionArch(bp, p, *m))
+		}
+	})
+	return errs.OrNil()
+}
@@ -0,0 +1,92 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"hpc-toolkit/pkg/config"
+
+	"github.com/zclconf/go-cty/cty"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestArmCompatible(c *C) {
+	image := func(family string, project string) cty.Value {
+		return cty.ObjectVal(map[string]cty.Value{
+			"family":  cty.StringVal(family),
+			"project": cty.StringVal(project)})
+	}
+	ref := func(s string) cty.Value { return config.MustParseExpression(s).AsValue() }
+	nodeset := "community/modules/compute/schedmd-slurm-gcp-v6-nodeset"
+	check := func(ms ...config.Module) error {
+		bp := config.Blueprint{Groups: []config.Group{{Name: "g", Modules: ms}}}
+		return testArmCompatible(bp, config.Dict{})
+	}
+
+	{ // OK: Arm machine with Arm image, Spack target and container
+		c.Check(check(
+			newModule("spack", "community/modules/scripts/spack-setup", map[string]cty.Value{
+				"packages": cty.TupleVal([]cty.Value{cty.StringVal("gromacs target=neoverse_n1")})}),
+			newModule("startup", "modules/scripts/startup-script", map[string]cty.Value{
+				"runners": ref("module.spack.spack_runner")}),
+			newModule("arm", nodeset, map[string]cty.Value{
+				"machine_type":   cty.StringVal("t2a-standard-4"),
+				"instance_image": image("rocky-linux-8-optimized-gcp-arm64", "rocky-linux-cloud"),
+				"startup_script": ref("module.startup.startup_script"),
+				"docker_image":   cty.StringVal("ghcr.io/org/app:1.0-arm64")})), IsNil)
+	}
+
+	{ // OK: image of private project is not known
+		c.Check(check(newModule("arm", nodeset, map[string]cty.Value{
+			"machine_type":   cty.StringVal("c4a-standard-8"),
+			"instance_image": image("my-image", "my-project")})), IsNil)
+	}
+
+	{ // FAIL: x86 image on Arm machine
+		c.Check(check(newModule("arm", nodeset, map[string]cty.Value{
+			"machine_type":   cty.StringVal("t2a-standard-4"),
+			"instance_image": image("hpc-rocky-linux-8", "cloud-hpc-image-public")})),
+			ErrorMatches, `.*image family "hpc-rocky-linux-8" of module "arm" is built for x86_64, but machine type "t2a-standard-4" is arm64.*`)
+	}
+
+	{ // FAIL: Arm image on x86 machine
+		c.Check(check(newModule("x86", nodeset, map[string]cty.Value{
+			"machine_type":   cty.StringVal("c2-standard-60"),
+			"instance_image": image("debian-12-arm64", "debian-cloud")})),
+			ErrorMatches, `.*is built for arm64, but machine type "c2-standard-60" is x86_64.*`)
+	}
+
+	{ // FAIL: x86 Spack target used through startup script, amd64 container
+		err := check(
+			newModule("spack", "community/modules/scripts/spack-execute", map[string]cty.Value{
+				"commands": cty.StringVal("spack install gcc@11.3.0 target=x86_64")}),
+			newModule("startup", "modules/scripts/startup-script", map[string]cty.Value{
+				"runners": ref("module.spack.spack_runner")}),
+			newModule("arm", "modules/compute/vm-instance", map[string]cty.Value{
+				"machine_type":   cty.StringVal("t2a-standard-4"),
+				"startup_script": ref("module.startup.startup_script"),
+				"docker_image":   cty.StringVal("docker.io/org/app:amd64")}))
+		c.Check(err, ErrorMatches, `(?s).*Spack target "x86_64" of module "spack" is built for x86_64, but machine type "t2a-standard-4" of module "arm" is arm64.*`)
+		c.Check(err, ErrorMatches, `(?s).*container image "docker.io/org/app:amd64" of module "arm" is built for x86_64.*`)
+	}
+
+	{ // FAIL: mixed partition
+		err := check(
+			newModule("arm", nodeset, map[string]cty.Value{"machine_type": cty.StringVal("t2a-standard-4")}),
+			newModule("x86", nodeset, map[string]cty.Value{"machine_type": cty.StringVal("c2-standard-60")}),
+			newModule("part", "community/modules/compute/schedmd-slurm-gcp-v6-partition", map[string]cty.Value{
+				"nodeset": ref(`flatten([module.arm.nodeset, module.x86.nodeset])`)}))
+		c.Check(err, ErrorMatches, `.*partition module "part" mixes Arm nodes of "arm" with x86 nodes of "x86".*`)
+	}
+}
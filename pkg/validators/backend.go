@@ -0,0 +1,117 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hpc-toolkit/pkg/apiclient"
+	"hpc-toolkit/pkg/config"
+	"net/http"
+
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/slices"
+	"google.golang.org/api/googleapi"
+	storage "google.golang.org/api/storage/v1"
+)
+
+// stateObjectPermission is the permission Terraform needs to write state to a GCS bucket
+const stateObjectPermission = "storage.objects.create"
+
+// backendBucket is a GCS bucket used as Terraform backend, with the path of its setting
+type backendBucket struct {
+	name string
+	path config.Path
+}
+
+// gcsBackendBuckets returns buckets of GCS backends of deployment groups, groups
+// inherit `terraform_backend_defaults` on expansion. Buckets that are not known
+// before deployment are not returned.
+func gcsBackendBuckets(bp config.Blueprint) []backendBucket {
+	res := []backendBucket{}
+	for ig, g := range bp.Groups {
+		be := g.TerraformBackend
+		if be.Type != "gcs" || !be.Configuration.Has("bucket") {
+			continue
+		}
+		v, err := bp.Eval(be.Configuration.Get("bucket"))
+		if err != nil || !v.IsKnown() || v.IsNull() || v.Type() != cty.String {
+			continue
+		}
+		res = append(res, backendBucket{
+			name: v.AsString(),
+			path: config.Root.Groups.At(ig).Backend.Configuration.Dot("bucket")})
+	}
+	return res
+}
+
+// checkBucketPermissions reports a bucket the credentials can not write state to
+func checkBucketPermissions(bucket string, granted []string) error {
+	if slices.Contains(granted, stateObjectPermission) {
+		return nil
+	}
+	return config.HintError{
+		Hint: fmt.Sprintf("grant roles/storage.objectAdmin on the bucket with `gcloud storage buckets add-iam-policy-binding gs://%s`", bucket),
+		Err:  fmt.Errorf("credentials in use lack permission %s in backend bucket %q, state can not be initialized", stateObjectPermission, bucket)}
+}
+
+// bucketAccessError describes failure to get the bucket
+func bucketAccessError(bucket string, err error) error {
+	var herr *googleapi.Error
+	if errors.As(err, &herr) && herr.Code == http.StatusNotFound {
+		return config.HintError{
+			Hint: fmt.Sprintf("create the bucket with `gcloud storage buckets create gs://%s --project PROJECT_ID`", bucket),
+			Err:  fmt.Errorf("backend bucket %q does not exist", bucket)}
+	}
+	if errors.As(err, &herr) && herr.Code == http.StatusForbidden {
+		return config.HintError{
+			Hint: "grant roles/storage.admin on the bucket or its project to the credentials in use",
+			Err:  fmt.Errorf("backend bucket %q is not accessible with the credentials in use", bucket)}
+	}
+	return fmt.Errorf("failed to get backend bucket %q: %w", bucket, err)
+}
+
+func testBackendBucket(ctx context.Context, bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{}); err != nil {
+		return err
+	}
+	buckets := gcsBackendBuckets(bp)
+	if len(buckets) == 0 {
+		return nil
+	}
+
+	s, err := apiclient.New(ctx, storage.NewService)
+	if err != nil {
+		return handleClientError(err)
+	}
+	checked := map[string]error{}
+	errs := config.Errors{}
+	for _, b := range buckets {
+		if cerr, ok := checked[b.name]; ok {
+			errs.At(b.path, cerr)
+			continue
+		}
+		if _, err := s.Buckets.Get(b.name).Do(); err != nil {
+			checked[b.name] = bucketAccessError(b.name, err)
+		} else if resp, err := s.Buckets.TestIamPermissions(b.name, []string{stateObjectPermission}).Do(); err != nil {
+			checked[b.name] = fmt.Errorf("failed to test permissions in backend bucket %q: %w", b.name, err)
+		} else {
+			checked[b.name] = checkBucketPermissions(b.name, resp.Permissions)
+		}
+		errs.At(b.path, checked[b.name])
+	}
+	return errs.OrNil()
+}
@@ -0,0 +1,59 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"errors"
+	"hpc-toolkit/pkg/config"
+	"net/http"
+
+	"github.com/zclconf/go-cty/cty"
+	"google.golang.org/api/googleapi"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestGcsBackendBuckets(c *C) {
+	gcs := func(bucket cty.Value) config.TerraformBackend {
+		return config.TerraformBackend{Type: "gcs", Configuration: config.Dict{}.With("bucket", bucket)}
+	}
+	bp := config.Blueprint{
+		Vars: config.Dict{}.With("state_bucket", cty.StringVal("vars-bucket")),
+		Groups: []config.Group{
+			{Name: "a", TerraformBackend: gcs(cty.StringVal("literal-bucket"))},
+			{Name: "b", TerraformBackend: config.TerraformBackend{Type: "local"}},
+			{Name: "c", TerraformBackend: gcs(config.GlobalRef("state_bucket").AsValue())},
+			{Name: "d", TerraformBackend: config.TerraformBackend{Type: "gcs"}},
+		}}
+
+	c.Check(gcsBackendBuckets(bp), DeepEquals, []backendBucket{
+		{"literal-bucket", config.Root.Groups.At(0).Backend.Configuration.Dot("bucket")},
+		{"vars-bucket", config.Root.Groups.At(2).Backend.Configuration.Dot("bucket")},
+	})
+}
+
+func (s *MySuite) TestCheckBucketPermissions(c *C) {
+	c.Check(checkBucketPermissions("b", []string{"storage.objects.create"}), IsNil)
+	c.Check(checkBucketPermissions("b", nil), ErrorMatches,
+		`credentials in use lack permission storage.objects.create in backend bucket "b".* - grant .*`)
+}
+
+func (s *MySuite) TestBucketAccessError(c *C) {
+	c.Check(bucketAccessError("b", &googleapi.Error{Code: http.StatusNotFound}), ErrorMatches,
+		`backend bucket "b" does not exist - create the bucket .*`)
+	c.Check(bucketAccessError("b", &googleapi.Error{Code: http.StatusForbidden}), ErrorMatches,
+		`backend bucket "b" is not accessible .*`)
+	c.Check(bucketAccessError("b", errors.New("boom")), ErrorMatches,
+		`failed to get backend bucket "b": boom`)
+}
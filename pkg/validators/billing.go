@@ -0,0 +1,71 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hpc-toolkit/pkg/apiclient"
+	"hpc-toolkit/pkg/config"
+
+	cloudbilling "google.golang.org/api/cloudbilling/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// checkBillingInfo reports a project without an active billing account
+func checkBillingInfo(projectID string, info *cloudbilling.ProjectBillingInfo) error {
+	if info.BillingEnabled {
+		return nil
+	}
+	hint := fmt.Sprintf("link a billing account with `gcloud billing projects link %s --billing-account=ACCOUNT_ID` "+
+		"or at https://console.cloud.google.com/billing/linkedaccount?project=%s", projectID, projectID)
+	if info.BillingAccountName != "" {
+		return config.HintError{
+			Hint: hint,
+			Err:  fmt.Errorf("billing account %s linked to project %s is closed or suspended", info.BillingAccountName, projectID)}
+	}
+	return config.HintError{
+		Hint: hint,
+		Err:  fmt.Errorf("project %s has no billing account linked, resources can not be created in it", projectID)}
+}
+
+func testBillingEnabled(ctx context.Context, bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{"project_id"}); err != nil {
+		return err
+	}
+	m, err := inputsAsStrings(inputs)
+	if err != nil {
+		return err
+	}
+	pid := m["project_id"]
+
+	s, err := apiclient.New(ctx, cloudbilling.NewService, option.WithQuotaProject(pid))
+	if err != nil {
+		return handleClientError(err)
+	}
+	info, err := s.Projects.GetBillingInfo("projects/" + pid).Do()
+	if err != nil {
+		var herr *googleapi.Error
+		if errors.As(err, &herr) {
+			if reason, _ := getErrorReason(*herr); reason == "SERVICE_DISABLED" {
+				return newDisabledServiceError("Cloud Billing API", "cloudbilling.googleapis.com", pid)
+			}
+		}
+		return fmt.Errorf("failed to get billing information of project %s: %w", pid, err)
+	}
+	return checkBillingInfo(pid, info)
+}
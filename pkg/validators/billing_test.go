@@ -0,0 +1,30 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	cloudbilling "google.golang.org/api/cloudbilling/v1"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestCheckBillingInfo(c *C) {
+	c.Check(checkBillingInfo("prj", &cloudbilling.ProjectBillingInfo{
+		BillingEnabled: true, BillingAccountName: "billingAccounts/0X0X0X"}), IsNil)
+
+	c.Check(checkBillingInfo("prj", &cloudbilling.ProjectBillingInfo{}),
+		ErrorMatches, "project prj has no billing account linked.* - link a billing account.*")
+	c.Check(checkBillingInfo("prj", &cloudbilling.ProjectBillingInfo{BillingAccountName: "billingAccounts/0X0X0X"}),
+		ErrorMatches, "billing account billingAccounts/0X0X0X linked to project prj is closed or suspended - .*")
+}
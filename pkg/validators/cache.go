@@ -0,0 +1,119 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// NoCache disables the on-disk cache of API lookups, set by `--no-cache`
+var NoCache bool
+
+// cacheTTL is how long results of API lookups are reused
+const cacheTTL = time.Hour
+
+// lookupCache is an on-disk cache of API lookups shared by runs of ghpc. Only
+// successful lookups are cached, so that fixed problems are noticed on the next run.
+type lookupCache struct {
+	dir string
+	ttl time.Duration
+	now func() time.Time
+}
+
+type cacheEntry struct {
+	Key     string          `json:"key"`
+	Expires time.Time       `json:"expires"`
+	Value   json.RawMessage `json:"value"`
+}
+
+// defaultCache returns the cache in ~/.ghpc/cache, nil if it is disabled
+func defaultCache() *lookupCache {
+	if NoCache {
+		return nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	return &lookupCache{dir: filepath.Join(home, ".ghpc", "cache", "validators"), ttl: cacheTTL, now: time.Now}
+}
+
+func (c *lookupCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// get reads the cached value of the key into v, returns false if there is no fresh value
+func (c *lookupCache) get(key string, v any) bool {
+	if c == nil {
+		return false
+	}
+	b, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return false
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(b, &e); err != nil || e.Key != key || !c.now().Before(e.Expires) {
+		return false
+	}
+	return json.Unmarshal(e.Value, v) == nil
+}
+
+// put caches the value of the key, failures are ignored as the cache is best-effort
+func (c *lookupCache) put(key string, v any) {
+	if c == nil {
+		return
+	}
+	value, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	b, err := json.Marshal(cacheEntry{Key: key, Expires: c.now().Add(c.ttl), Value: value})
+	if err != nil || os.MkdirAll(c.dir, 0700) != nil {
+		return
+	}
+	// write and rename, so that concurrent runs never read partially written entries
+	f, err := os.CreateTemp(c.dir, "entry-")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err != nil || cerr != nil {
+		os.Remove(f.Name())
+		return
+	}
+	if os.Rename(f.Name(), c.path(key)) != nil {
+		os.Remove(f.Name())
+	}
+}
+
+// cachedLookup returns the cached result of the lookup if it is fresh, otherwise
+// performs the lookup and caches its result if it succeeded
+func cachedLookup[T any](c *lookupCache, key string, lookup func() (T, error)) (T, error) {
+	var v T
+	if c.get(key, &v) {
+		return v, nil
+	}
+	v, err := lookup()
+	if err == nil {
+		c.put(key, v)
+	}
+	return v, err
+}
@@ -0,0 +1,93 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestLookupCache(c *C) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	lc := &lookupCache{dir: c.MkDir(), ttl: time.Hour, now: func() time.Time { return now }}
+
+	var got string
+	c.Check(lc.get("a", &got), Equals, false)
+
+	lc.put("a", "zebra")
+	c.Check(lc.get("a", &got), Equals, true)
+	c.Check(got, Equals, "zebra")
+	c.Check(lc.get("b", &got), Equals, false)
+
+	{ // entries of other keys are not used
+		b, err := os.ReadFile(lc.path("a"))
+		c.Assert(err, IsNil)
+		c.Assert(os.WriteFile(lc.path("b"), b, 0600), IsNil)
+		c.Check(lc.get("b", &got), Equals, false)
+	}
+
+	now = now.Add(time.Hour)
+	c.Check(lc.get("a", &got), Equals, false) // expired
+
+	{ // nil cache is disabled
+		var nc *lookupCache
+		nc.put("a", "zebra")
+		c.Check(nc.get("a", &got), Equals, false)
+	}
+}
+
+func (s *MySuite) TestCachedLookup(c *C) {
+	lc := &lookupCache{dir: c.MkDir(), ttl: time.Hour, now: time.Now}
+	calls := 0
+	lookup := func(err error) func() (int, error) {
+		return func() (int, error) {
+			calls++
+			return 42, err
+		}
+	}
+
+	{ // failures are not cached
+		_, err := cachedLookup(lc, "k", lookup(errors.New("bad")))
+		c.Check(err, NotNil)
+		_, err = cachedLookup(lc, "k", lookup(errors.New("bad")))
+		c.Check(err, NotNil)
+		c.Check(calls, Equals, 2)
+	}
+
+	{ // successes are
+		v, err := cachedLookup(lc, "k", lookup(nil))
+		c.Check(err, IsNil)
+		c.Check(v, Equals, 42)
+		v, err = cachedLookup(lc, "k", lookup(errors.New("bad")))
+		c.Check(err, IsNil)
+		c.Check(v, Equals, 42)
+		c.Check(calls, Equals, 3)
+	}
+
+	{ // no cache
+		_, err := cachedLookup(nil, "k", lookup(nil))
+		c.Check(err, IsNil)
+		c.Check(calls, Equals, 4)
+	}
+}
+
+func (s *MySuite) TestDefaultCache(c *C) {
+	defer func(v bool) { NoCache = v }(NoCache)
+	NoCache = true
+	c.Check(defaultCache(), IsNil)
+}
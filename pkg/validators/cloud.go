@@ -18,14 +18,19 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"hpc-toolkit/pkg/apiclient"
 	"hpc-toolkit/pkg/config"
 	"strings"
 
+	"github.com/zclconf/go-cty/cty"
 	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 	compute "google.golang.org/api/compute/v1"
+	file "google.golang.org/api/file/v1"
 	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 	serviceusage "google.golang.org/api/serviceusage/v1"
+	storage "google.golang.org/api/storage/v1"
 )
 
 func getErrorReason(err googleapi.Error) (string, map[string]interface{}) {
@@ -35,15 +40,24 @@ func getErrorReason(err googleapi.Error) (string, map[string]interface{}) {
 			continue
 		}
 		if reason, ok := m["reason"].(string); ok {
-			return reason, m["metadata"].(map[string]interface{})
+			metadata, _ := m["metadata"].(map[string]interface{})
+			return reason, metadata
 		}
 	}
 	return "", nil
 }
 
+// serviceUsageBatchSize is the maximal number of services in a BatchGet request
+const serviceUsageBatchSize = 20
+
+func enableServiceHint(title string, name string, pid string) string {
+	return fmt.Sprintf("%s can be enabled with `gcloud services enable %s --project=%s` or at https://console.cloud.google.com/apis/library/%s?project=%s",
+		title, name, pid, name, pid)
+}
+
 func newDisabledServiceError(title string, name string, pid string) error {
 	return config.HintError{
-		Hint: fmt.Sprintf("%s can be enabled at https://console.cloud.google.com/apis/library/%s?project=%s", title, name, pid),
+		Hint: enableServiceHint(title, name, pid),
 		Err:  fmt.Errorf("%s service is disabled in project %s", title, pid)}
 }
 
@@ -72,89 +86,122 @@ func handleServiceUsageError(err error, pid string) error {
 }
 
 // TestApisEnabled tests whether APIs are enabled in given project
-func TestApisEnabled(projectID string, requiredAPIs []string) error {
+func TestApisEnabled(ctx context.Context, projectID string, requiredAPIs []string) error {
+	required := map[string][]config.ModuleID{}
+	for _, api := range requiredAPIs {
+		required[api] = nil
+	}
+	return testServicesEnabled(ctx, projectID, required)
+}
+
+// testServicesEnabled tests whether services are enabled in given project,
+// required is a map from services to modules that require them
+func testServicesEnabled(ctx context.Context, projectID string, required map[string][]config.ModuleID) error {
 	// can return immediately if there are 0 APIs to test
-	if len(requiredAPIs) == 0 {
+	if len(required) == 0 {
 		return nil
 	}
 
-	ctx := context.Background()
-
-	s, err := serviceusage.NewService(ctx, option.WithQuotaProject(projectID))
+	s, err := apiclient.New(ctx, serviceusage.NewService, option.WithQuotaProject(projectID))
 	if err != nil {
 		return handleClientError(err)
 	}
 
 	prefix := "projects/" + projectID
-	var serviceNames []string
-	for _, api := range requiredAPIs {
-		serviceNames = append(serviceNames, prefix+"/services/"+api)
-	}
+	apis := maps.Keys(required)
+	slices.Sort(apis)
+	services := []*serviceusage.GoogleApiServiceusageV1Service{}
+	for len(apis) > 0 {
+		batch := apis[:min(len(apis), serviceUsageBatchSize)]
+		apis = apis[len(batch):]
 
-	resp, err := s.Services.BatchGet(prefix).Names(serviceNames...).Do()
-	if err != nil {
-		return handleServiceUsageError(err, projectID)
+		var serviceNames []string
+		for _, api := range batch {
+			serviceNames = append(serviceNames, prefix+"/services/"+api)
+		}
+		resp, err := s.Services.BatchGet(prefix).Names(serviceNames...).Do()
+		if err != nil {
+			return handleServiceUsageError(err, projectID)
+		}
+		services = append(services, resp.Services...)
 	}
+	return checkServicesEnabled(projectID, required, services)
+}
+
+// checkServicesEnabled reports disabled services along with modules that require them
+func checkServicesEnabled(projectID string, required map[string][]config.ModuleID, services []*serviceusage.GoogleApiServiceusageV1Service) error {
 	errs := config.Errors{}
-	for _, service := range resp.Services {
-		if service.State == "DISABLED" {
-			errs.Add(newDisabledServiceError(service.Config.Title, service.Config.Name, projectID))
+	for _, service := range services {
+		if service.State != "DISABLED" {
+			continue
+		}
+		title, name := service.Config.Title, service.Config.Name
+		err := fmt.Errorf("%s service is disabled in project %s", title, projectID)
+		if ids := required[name]; len(ids) > 0 {
+			quoted := []string{}
+			for _, id := range ids {
+				quoted = append(quoted, fmt.Sprintf("%q", id))
+			}
+			err = fmt.Errorf("%s service is disabled in project %s, it is required by modules %s", title, projectID, strings.Join(quoted, ", "))
 		}
+		errs.Add(config.HintError{Hint: enableServiceHint(title, name, projectID), Err: err})
 	}
 	return errs.OrNil()
 }
 
 // TestProjectExists whether projectID exists / is accessible with credentials
-func TestProjectExists(projectID string) error {
-	ctx := context.Background()
-	s, err := compute.NewService(ctx)
-	if err != nil {
-		err = handleClientError(err)
-		return err
-	}
-	_, err = s.Projects.Get(projectID).Fields().Do()
-	if err != nil {
-		if strings.Contains(err.Error(), "Compute Engine API has not been used in project") {
-			return newDisabledServiceError("Compute Engine API", "compute.googleapis.com", projectID)
+func TestProjectExists(ctx context.Context, projectID string) error {
+	_, err := cachedLookup(defaultCache(), "compute/projects/"+projectID, func() (bool, error) {
+		s, err := apiclient.New(ctx, compute.NewService)
+		if err != nil {
+			return false, handleClientError(err)
 		}
-		return projectError(projectID)
-	}
-
-	return nil
+		_, err = s.Projects.Get(projectID).Fields().Do()
+		if err != nil {
+			if strings.Contains(err.Error(), "Compute Engine API has not been used in project") {
+				return false, newDisabledServiceError("Compute Engine API", "compute.googleapis.com", projectID)
+			}
+			return false, projectError(projectID)
+		}
+		return true, nil
+	})
+	return err
 }
 
-func getRegion(projectID string, region string) (*compute.Region, error) {
-	ctx := context.Background()
-	s, err := compute.NewService(ctx)
-	if err != nil {
-		err = handleClientError(err)
-		return nil, err
-	}
-	return s.Regions.Get(projectID, region).Do()
+func getRegion(ctx context.Context, projectID string, region string) (*compute.Region, error) {
+	key := fmt.Sprintf("compute/projects/%s/regions/%s", projectID, region)
+	return cachedLookup(defaultCache(), key, func() (*compute.Region, error) {
+		s, err := apiclient.New(ctx, compute.NewService)
+		if err != nil {
+			return nil, handleClientError(err)
+		}
+		return s.Regions.Get(projectID, region).Fields("name", "selfLink").Do()
+	})
 }
 
 // TestRegionExists whether region exists / is accessible with credentials
-func TestRegionExists(projectID string, region string) error {
-	_, err := getRegion(projectID, region)
+func TestRegionExists(ctx context.Context, projectID string, region string) error {
+	_, err := getRegion(ctx, projectID, region)
 	if err != nil {
 		return fmt.Errorf(regionError, region, projectID)
 	}
 	return nil
 }
 
-func getZone(projectID string, zone string) (*compute.Zone, error) {
-	ctx := context.Background()
-	s, err := compute.NewService(ctx)
-	if err != nil {
-		err = handleClientError(err)
-		return nil, err
-	}
-	return s.Zones.Get(projectID, zone).Do()
+func getZone(ctx context.Context, projectID string, zone string) (*compute.Zone, error) {
+	key := fmt.Sprintf("compute/projects/%s/zones/%s", projectID, zone)
+	return cachedLookup(defaultCache(), key, func() (*compute.Zone, error) {
+		s, err := apiclient.New(ctx, compute.NewService)
+		if err != nil {
+			return nil, handleClientError(err)
+		}
+		return s.Zones.Get(projectID, zone).Fields("name", "region").Do()
+	})
 }
 
 // TestZoneExists whether zone exists / is accessible with credentials
-func TestZoneExists(projectID string, zone string) error {
-	_, err := getZone(projectID, zone)
+func TestZoneExists(ctx context.Context, projectID string, zone string) error {
+	_, err := getZone(ctx, projectID, zone)
 	if err != nil {
 		return fmt.Errorf(zoneError, zone, projectID)
 	}
@@ -162,12 +209,12 @@ func TestZoneExists(projectID string, zone string) error {
 }
 
 // TestZoneInRegion whether zone is in region
-func TestZoneInRegion(projectID string, zone string, region string) error {
-	regionObject, err := getRegion(projectID, region)
+func TestZoneInRegion(ctx context.Context, projectID string, zone string, region string) error {
+	regionObject, err := getRegion(ctx, projectID, region)
 	if err != nil {
 		return fmt.Errorf(regionError, region, projectID)
 	}
-	zoneObject, err := getZone(projectID, zone)
+	zoneObject, err := getZone(ctx, projectID, zone)
 	if err != nil {
 		return fmt.Errorf(zoneError, zone, projectID)
 	}
@@ -179,7 +226,170 @@ func TestZoneInRegion(projectID string, zone string, region string) error {
 	return nil
 }
 
-func testApisEnabled(bp config.Blueprint, inputs config.Dict) error {
+// TestMachineTypeExists whether machine type is available in zone / is accessible with credentials
+func TestMachineTypeExists(ctx context.Context, projectID string, zone string, machineType string) error {
+	key := fmt.Sprintf("compute/projects/%s/zones/%s/machineTypes/%s", projectID, zone, machineType)
+	_, err := cachedLookup(defaultCache(), key, func() (bool, error) {
+		s, err := apiclient.New(ctx, compute.NewService)
+		if err != nil {
+			return false, handleClientError(err)
+		}
+		if _, err := s.MachineTypes.Get(projectID, zone, machineType).Fields().Do(); err != nil {
+			return false, config.HintError{
+				Hint: fmt.Sprintf("list available machine types with `gcloud compute machine-types list --zones %s --project %s`", zone, projectID),
+				Err:  fmt.Errorf(machineTypeError, machineType, zone, projectID)}
+		}
+		return true, nil
+	})
+	return err
+}
+
+// TestGpuAvailable whether accelerator type is available in zone and count of
+// accelerators can be attached to an instance
+func TestGpuAvailable(ctx context.Context, projectID string, zone string, acceleratorType string, count int64) error {
+	s, err := apiclient.New(ctx, compute.NewService)
+	if err != nil {
+		return handleClientError(err)
+	}
+	at, err := s.AcceleratorTypes.Get(projectID, zone, acceleratorType).Do()
+	if err != nil {
+		return config.HintError{
+			Hint: fmt.Sprintf("list available accelerator types with `gcloud compute accelerator-types list --filter zone:%s --project %s`", zone, projectID),
+			Err:  fmt.Errorf(acceleratorError, acceleratorType, zone, projectID)}
+	}
+	if count > at.MaximumCardsPerInstance {
+		return fmt.Errorf("at most %d accelerators of type %s can be attached to an instance, got %d", at.MaximumCardsPerInstance, acceleratorType, count)
+	}
+	return nil
+}
+
+// deploymentLabelLister calls found with labels of resources of the project that may
+// be labeled with the deployment name
+type deploymentLabelLister func(ctx context.Context, projectID string, deploymentName string, found func(map[string]string)) error
+
+func listInstanceLabels(ctx context.Context, projectID string, deploymentName string, found func(map[string]string)) error {
+	s, err := apiclient.New(ctx, compute.NewService)
+	if err != nil {
+		return err
+	}
+	filter := fmt.Sprintf("labels.ghpc_deployment = %q", deploymentName)
+	return s.Instances.AggregatedList(projectID).Filter(filter).Pages(ctx, func(l *compute.InstanceAggregatedList) error {
+		for _, scoped := range l.Items {
+			for _, inst := range scoped.Instances {
+				found(inst.Labels)
+			}
+		}
+		return nil
+	})
+}
+
+func listInstanceTemplateLabels(ctx context.Context, projectID string, _ string, found func(map[string]string)) error {
+	s, err := apiclient.New(ctx, compute.NewService)
+	if err != nil {
+		return err
+	}
+	// labels of instances created from templates can not be filtered on
+	return s.InstanceTemplates.AggregatedList(projectID).Pages(ctx, func(l *compute.InstanceTemplateAggregatedList) error {
+		for _, scoped := range l.Items {
+			for _, t := range scoped.InstanceTemplates {
+				if t.Properties != nil {
+					found(t.Properties.Labels)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func listFilestoreLabels(ctx context.Context, projectID string, deploymentName string, found func(map[string]string)) error {
+	s, err := apiclient.New(ctx, file.NewService)
+	if err != nil {
+		return err
+	}
+	parent := fmt.Sprintf("projects/%s/locations/-", projectID)
+	filter := fmt.Sprintf("labels.ghpc_deployment = %q", deploymentName)
+	return s.Projects.Locations.Instances.List(parent).Filter(filter).Pages(ctx, func(l *file.ListInstancesResponse) error {
+		for _, i := range l.Instances {
+			found(i.Labels)
+		}
+		return nil
+	})
+}
+
+func listBucketLabels(ctx context.Context, projectID string, _ string, found func(map[string]string)) error {
+	s, err := apiclient.New(ctx, storage.NewService)
+	if err != nil {
+		return err
+	}
+	return s.Buckets.List(projectID).Fields("items(labels)", "nextPageToken").Pages(ctx, func(l *storage.Buckets) error {
+		for _, b := range l.Items {
+			found(b.Labels)
+		}
+		return nil
+	})
+}
+
+// isServiceDisabled returns true if the error is caused by a disabled service, its
+// resources do not exist then
+func isServiceDisabled(err error) bool {
+	var herr *googleapi.Error
+	if !errors.As(err, &herr) {
+		return false
+	}
+	if reason, _ := getErrorReason(*herr); reason == "SERVICE_DISABLED" {
+		return true
+	}
+	return slices.ContainsFunc(herr.Errors, func(e googleapi.ErrorItem) bool { return e.Reason == "accessNotConfigured" })
+}
+
+// labeledResources lists labels of resources of a kind
+type labeledResources struct {
+	kind string
+	list deploymentLabelLister
+}
+
+var deploymentResources = []labeledResources{
+	{"instances", listInstanceLabels},
+	{"instance templates", listInstanceTemplateLabels},
+	{"Filestore instances", listFilestoreLabels},
+	{"buckets", listBucketLabels},
+}
+
+// TestDeploymentNotInUse whether deployment name is already used in the project
+// by instances, instance templates, Filestore instances or buckets created from
+// a different blueprint
+func TestDeploymentNotInUse(ctx context.Context, projectID string, deploymentName string, blueprintName string) error {
+	return checkDeploymentNotInUse(ctx, projectID, deploymentName, blueprintName, deploymentResources)
+}
+
+func checkDeploymentNotInUse(ctx context.Context, projectID string, deploymentName string, blueprintName string, resources []labeledResources) error {
+	others := map[string]bool{}
+	found := func(labels map[string]string) {
+		if labels["ghpc_deployment"] != deploymentName {
+			return
+		}
+		if bpn := labels["ghpc_blueprint"]; bpn != blueprintName {
+			others[bpn] = true
+		}
+	}
+	for _, l := range resources {
+		err := l.list(ctx, projectID, deploymentName, found)
+		if err != nil && !isServiceDisabled(err) {
+			return fmt.Errorf("failed to list %s of project %s: %w", l.kind, projectID, handleClientError(err))
+		}
+	}
+	if len(others) > 0 {
+		bps := maps.Keys(others)
+		slices.Sort(bps)
+		return config.HintError{
+			Hint: "choose a different deployment_name",
+			Err: fmt.Errorf("deployment %q already exists in project %s and was created from blueprint(s) %q",
+				deploymentName, projectID, bps)}
+	}
+	return nil
+}
+
+func testApisEnabled(ctx context.Context, bp config.Blueprint, inputs config.Dict) error {
 	if err := checkInputs(inputs, []string{"project_id"}); err != nil {
 		return err
 	}
@@ -187,17 +397,19 @@ func testApisEnabled(bp config.Blueprint, inputs config.Dict) error {
 	if err != nil {
 		return err
 	}
-	apis := map[string]bool{}
+	required := map[string][]config.ModuleID{}
 	bp.WalkModulesSafe(func(_ config.ModulePath, m *config.Module) {
 		services := m.InfoOrDie().Metadata.Spec.Requirements.Services
 		for _, api := range services {
-			apis[api] = true
+			if !slices.Contains(required[api], m.ID) {
+				required[api] = append(required[api], m.ID)
+			}
 		}
 	})
-	return TestApisEnabled(m["project_id"], maps.Keys(apis))
+	return testServicesEnabled(ctx, m["project_id"], required)
 }
 
-func testProjectExists(bp config.Blueprint, inputs config.Dict) error {
+func testProjectExists(ctx context.Context, bp config.Blueprint, inputs config.Dict) error {
 	if err := checkInputs(inputs, []string{"project_id"}); err != nil {
 		return err
 	}
@@ -205,10 +417,10 @@ func testProjectExists(bp config.Blueprint, inputs config.Dict) error {
 	if err != nil {
 		return err
 	}
-	return TestProjectExists(m["project_id"])
+	return TestProjectExists(ctx, m["project_id"])
 }
 
-func testRegionExists(bp config.Blueprint, inputs config.Dict) error {
+func testRegionExists(ctx context.Context, bp config.Blueprint, inputs config.Dict) error {
 	if err := checkInputs(inputs, []string{"project_id", "region"}); err != nil {
 		return err
 	}
@@ -216,10 +428,10 @@ func testRegionExists(bp config.Blueprint, inputs config.Dict) error {
 	if err != nil {
 		return err
 	}
-	return TestRegionExists(m["project_id"], m["region"])
+	return TestRegionExists(ctx, m["project_id"], m["region"])
 }
 
-func testZoneExists(bp config.Blueprint, inputs config.Dict) error {
+func testZoneExists(ctx context.Context, bp config.Blueprint, inputs config.Dict) error {
 	if err := checkInputs(inputs, []string{"project_id", "zone"}); err != nil {
 		return err
 	}
@@ -227,10 +439,10 @@ func testZoneExists(bp config.Blueprint, inputs config.Dict) error {
 	if err != nil {
 		return err
 	}
-	return TestZoneExists(m["project_id"], m["zone"])
+	return TestZoneExists(ctx, m["project_id"], m["zone"])
 }
 
-func testZoneInRegion(bp config.Blueprint, inputs config.Dict) error {
+func testZoneInRegion(ctx context.Context, bp config.Blueprint, inputs config.Dict) error {
 	if err := checkInputs(inputs, []string{"project_id", "region", "zone"}); err != nil {
 		return err
 	}
@@ -238,5 +450,113 @@ func testZoneInRegion(bp config.Blueprint, inputs config.Dict) error {
 	if err != nil {
 		return err
 	}
-	return TestZoneInRegion(m["project_id"], m["zone"], m["region"])
+	return TestZoneInRegion(ctx, m["project_id"], m["zone"], m["region"])
+}
+
+func testMachineTypeExists(ctx context.Context, bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{"project_id", "zone"}); err != nil {
+		return err
+	}
+	m, err := inputsAsStrings(inputs)
+	if err != nil {
+		return err
+	}
+
+	type key struct{ zone, machineType string }
+	checked := map[key]error{}
+	errs := config.Errors{}
+	bp.WalkModulesSafe(func(p config.ModulePath, mod *config.Module) {
+		mt, ok := evalStringSetting(bp, *mod, "machine_type")
+		if !ok || mt == "" {
+			return
+		}
+		zone := m["zone"]
+		if z, ok := evalStringSetting(bp, *mod, "zone"); ok && z != "" {
+			zone = z // module is placed in a zone other than the deployment one
+		}
+		k := key{zone, mt}
+		if _, ok := checked[k]; !ok {
+			checked[k] = TestMachineTypeExists(ctx, m["project_id"], zone, mt)
+		}
+		errs.At(p.Settings.Dot("machine_type"), checked[k])
+	})
+	return errs.OrNil()
+}
+
+// accelerator is an element of `guest_accelerator` setting
+type accelerator struct {
+	typ   string
+	count int64
+}
+
+// moduleAccelerators returns accelerators of the module that are known before
+// deployment, keyed by index of the element of `guest_accelerator` setting
+func moduleAccelerators(bp config.Blueprint, m config.Module) map[int]accelerator {
+	res := map[int]accelerator{}
+	v, ok := evalSetting(bp, m, "guest_accelerator", cty.NullVal(cty.DynamicPseudoType))
+	if !ok || v.IsNull() || !v.CanIterateElements() {
+		return res
+	}
+	i := 0
+	for it := v.ElementIterator(); it.Next(); i++ {
+		_, ga := it.Element()
+		if ga.IsNull() || !ga.Type().IsObjectType() || !ga.Type().HasAttribute("type") || !ga.Type().HasAttribute("count") {
+			continue
+		}
+		t, c := ga.GetAttr("type"), ga.GetAttr("count")
+		if t.IsNull() || t.Type() != cty.String || c.IsNull() || c.Type() != cty.Number {
+			continue
+		}
+		n, _ := c.AsBigFloat().Int64()
+		res[i] = accelerator{t.AsString(), n}
+	}
+	return res
+}
+
+func testGpuAvailable(ctx context.Context, bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{"project_id", "zone"}); err != nil {
+		return err
+	}
+	m, err := inputsAsStrings(inputs)
+	if err != nil {
+		return err
+	}
+
+	type key struct {
+		zone string
+		acc  accelerator
+	}
+	checked := map[key]error{}
+	errs := config.Errors{}
+	bp.WalkModulesSafe(func(p config.ModulePath, mod *config.Module) {
+		accs := moduleAccelerators(bp, *mod)
+		if len(accs) == 0 {
+			return
+		}
+		zone := m["zone"]
+		if z, ok := evalStringSetting(bp, *mod, "zone"); ok && z != "" {
+			zone = z // module is placed in a zone other than the deployment one
+		}
+		idx := maps.Keys(accs)
+		slices.Sort(idx)
+		for _, i := range idx {
+			k := key{zone, accs[i]}
+			if _, ok := checked[k]; !ok {
+				checked[k] = TestGpuAvailable(ctx, m["project_id"], zone, k.acc.typ, k.acc.count)
+			}
+			errs.At(p.Settings.Dot("guest_accelerator").Cty(cty.Path{}.IndexInt(i)), checked[k])
+		}
+	})
+	return errs.OrNil()
+}
+
+func testDeploymentNotInUse(ctx context.Context, bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{"project_id", "deployment_name"}); err != nil {
+		return err
+	}
+	m, err := inputsAsStrings(inputs)
+	if err != nil {
+		return err
+	}
+	return TestDeploymentNotInUse(ctx, m["project_id"], m["deployment_name"], bp.BlueprintName)
 }
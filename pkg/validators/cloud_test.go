@@ -0,0 +1,90 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"context"
+	"hpc-toolkit/pkg/config"
+
+	"google.golang.org/api/googleapi"
+	serviceusage "google.golang.org/api/serviceusage/v1"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestCheckServicesEnabled(c *C) {
+	service := func(name string, title string, state string) *serviceusage.GoogleApiServiceusageV1Service {
+		return &serviceusage.GoogleApiServiceusageV1Service{
+			State:  state,
+			Config: &serviceusage.GoogleApiServiceusageV1ServiceConfig{Name: name, Title: title}}
+	}
+	compute := service("compute.googleapis.com", "Compute Engine API", "ENABLED")
+	file := service("file.googleapis.com", "Cloud Filestore API", "DISABLED")
+	container := service("container.googleapis.com", "Kubernetes Engine API", "DISABLED")
+
+	{ // OK: all enabled
+		c.Check(checkServicesEnabled("pid", nil, []*serviceusage.GoogleApiServiceusageV1Service{compute}), IsNil)
+	}
+
+	{ // FAIL: disabled services with modules that require them
+		err := checkServicesEnabled("pid", map[string][]config.ModuleID{
+			"file.googleapis.com": {"homefs", "appsfs"},
+		}, []*serviceusage.GoogleApiServiceusageV1Service{compute, file, container})
+		c.Check(err, ErrorMatches, `(?s).*Cloud Filestore API service is disabled in project pid, it is required by modules "homefs", "appsfs".*`+
+			"gcloud services enable file.googleapis.com --project=pid.*")
+		c.Check(err, ErrorMatches, `(?s).*Kubernetes Engine API service is disabled in project pid.*gcloud services enable container.googleapis.com --project=pid.*`)
+	}
+}
+
+func (s *MySuite) TestCheckDeploymentNotInUse(c *C) {
+	labeled := func(labels ...map[string]string) deploymentLabelLister {
+		return func(_ context.Context, _ string, _ string, found func(map[string]string)) error {
+			for _, l := range labels {
+				found(l)
+			}
+			return nil
+		}
+	}
+	failing := func(err error) deploymentLabelLister {
+		return func(context.Context, string, string, func(map[string]string)) error { return err }
+	}
+	own := map[string]string{"ghpc_deployment": "golf", "ghpc_blueprint": "hpc-slurm"}
+	check := func(rs ...labeledResources) error {
+		return checkDeploymentNotInUse(context.Background(), "pid", "golf", "hpc-slurm", rs)
+	}
+
+	{ // OK: resources of the same blueprint or other deployments
+		c.Check(check(
+			labeledResources{"instances", labeled(own)},
+			labeledResources{"buckets", labeled(map[string]string{"ghpc_deployment": "other", "ghpc_blueprint": "ml"}, nil)}), IsNil)
+	}
+
+	{ // FAIL: any kind of resource of another blueprint
+		err := check(
+			labeledResources{"instances", labeled(own)},
+			labeledResources{"Filestore instances", labeled(map[string]string{"ghpc_deployment": "golf", "ghpc_blueprint": "ml"})})
+		c.Check(err, ErrorMatches, `.*deployment "golf" already exists in project pid and was created from blueprint\(s\) \["ml"\].*`)
+	}
+
+	{ // OK: disabled service has no resources
+		disabled := &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "accessNotConfigured"}}}
+		c.Check(check(labeledResources{"buckets", failing(disabled)}), IsNil)
+	}
+
+	{ // FAIL: list errors are reported as such
+		denied := &googleapi.Error{Code: 403, Message: "Required 'file.instances.list' permission"}
+		err := check(labeledResources{"Filestore instances", failing(denied)})
+		c.Check(err, ErrorMatches, `failed to list Filestore instances of project pid: .*file.instances.list.*`)
+	}
+}
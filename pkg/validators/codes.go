@@ -0,0 +1,234 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"errors"
+	"fmt"
+	"hpc-toolkit/pkg/config"
+)
+
+// Codes of validator errors, see config.ErrorCode
+const (
+	CodeMisconfigured  config.ErrorCode = "GHPC2000"
+	CodeNoCredentials  config.ErrorCode = "GHPC2001"
+	CodeTimeout        config.ErrorCode = "GHPC2043"
+	CodeUnknownFailure config.ErrorCode = "GHPC2099"
+)
+
+// validatorCodes maps validators to codes of their failures
+var validatorCodes = map[string]config.ErrorCode{
+	testProjectExistsName:             "GHPC2002",
+	testApisEnabledName:               "GHPC2003",
+	testRegionExistsName:              "GHPC2004",
+	testZoneExistsName:                "GHPC2005",
+	testZoneInRegionName:              "GHPC2006",
+	testModuleNotUsedName:             "GHPC2007",
+	testDeploymentVariableNotUsedName: "GHPC2008",
+	testResourceNamesUniqueName:       "GHPC2009",
+	testDeploymentNotInUseName:        "GHPC2010",
+	testResourceReferencesName:        "GHPC2011",
+	testGpuImageCompatibleName:        "GHPC2012",
+	testGpuNetworkingName:             "GHPC2014",
+	testFirewallRulesName:             "GHPC2015",
+	testHybridSlurmName:               "GHPC2016",
+	testWindowsImageName:              "GHPC2017",
+	testArmCompatibleName:             "GHPC2018",
+	testMachineTypeExistsName:         "GHPC2019",
+	testGpuAvailableName:              "GHPC2020",
+	testQuotaSufficientName:           "GHPC2021",
+	testPermissionsGrantedName:        "GHPC2022",
+	testImageExistsName:               "GHPC2023",
+	testNetworkExistsName:             "GHPC2024",
+	testFileSystemMountsName:          "GHPC2025",
+	testSubnetworkExistsName:          "GHPC2026",
+	testImageFreshName:                "GHPC2027",
+	testReservationExistsName:         "GHPC2028",
+	testBillingEnabledName:            "GHPC2029",
+	testOrgPoliciesName:               "GHPC2030",
+	testBackendBucketName:             "GHPC2031",
+	testLabelsValidName:               "GHPC2032",
+	testExternalResourcesExistName:    "GHPC2033",
+	testSpotAvailabilityName:          "GHPC2034",
+	testSSHKeysName:                   "GHPC2035",
+	testPrivateGoogleAccessName:       "GHPC2036",
+	testToolkitCompatibleName:         "GHPC2037",
+	testSlurmTopologyName:             "GHPC2038",
+	testModuleRegionsConsistentName:   "GHPC2039",
+	testPackerBuildName:               "GHPC2040",
+	testDiskTypesAvailableName:        "GHPC2041",
+	testSecretsAccessibleName:         "GHPC2042",
+}
+
+// Code returns code of the validator failure
+func (e ValidatorError) Code() config.ErrorCode {
+	if errors.Is(e.Err, errTimedOut) {
+		return CodeTimeout
+	}
+	if c, ok := validatorCodes[e.Validator]; ok {
+		return c
+	}
+	return CodeUnknownFailure
+}
+
+// ErrorCodes returns documentation of codes of validator errors
+func ErrorCodes() []config.ErrorCodeInfo {
+	see := func(name string) string {
+		return fmt.Sprintf(" See `%s` in docs/blueprint-validation.md.", name)
+	}
+	doc := func(code config.ErrorCode, title string, explanation string) config.ErrorCodeInfo {
+		return config.ErrorCodeInfo{Code: code, Title: title, Explanation: explanation}
+	}
+	return []config.ErrorCodeInfo{
+		doc(CodeMisconfigured, "Validator is misconfigured",
+			"A validator is unknown, its inputs can not be evaluated, a required input is missing "+
+				"or an unexpected input is provided. Check the `validators` block of the blueprint."),
+		doc(CodeNoCredentials, "No application default credentials",
+			"Validators that call Google Cloud APIs require application default credentials. "+
+				"Without them, these validators are skipped with a warning. "+
+				"Run `gcloud auth application-default login`, or use `--offline` to skip them deliberately."),
+		doc(validatorCodes[testProjectExistsName], "Project is not accessible",
+			"The project does not exist or the active credentials can not access it."+see(testProjectExistsName)),
+		doc(validatorCodes[testApisEnabledName], "Required APIs are not enabled",
+			"A service required by modules of the blueprint is disabled in the project."+see(testApisEnabledName)),
+		doc(validatorCodes[testRegionExistsName], "Region is not available",
+			"The region does not exist or is not accessible within the project."+see(testRegionExistsName)),
+		doc(validatorCodes[testZoneExistsName], "Zone is not available",
+			"The zone does not exist or is not accessible within the project."+see(testZoneExistsName)),
+		doc(validatorCodes[testZoneInRegionName], "Zone is not in region",
+			"The zone is not a part of the region, usually only one of them was changed."+see(testZoneInRegionName)),
+		doc(validatorCodes[testModuleNotUsedName], "Used module is not used",
+			"A module is listed in `use`, but none of its outputs match settings of the module."+see(testModuleNotUsedName)),
+		doc(validatorCodes[testDeploymentVariableNotUsedName], "Deployment variable is not used",
+			"A deployment variable is not used by any module."+see(testDeploymentVariableNotUsedName)),
+		doc(validatorCodes[testResourceNamesUniqueName], "Resource names collide",
+			"Two modules of the same source would create resources with the same names."+see(testResourceNamesUniqueName)),
+		doc(validatorCodes[testDeploymentNotInUseName], "Deployment name is in use",
+			"The deployment name is already used in the project by resources created from a different blueprint."+
+				see(testDeploymentNotInUseName)),
+		doc(validatorCodes[testResourceReferencesName], "Referenced resource is not accessible",
+			"A module setting refers to a network, subnetwork or image that is malformed, does not exist "+
+				"or is not accessible."+see(testResourceReferencesName)),
+		doc(validatorCodes[testGpuImageCompatibleName], "GPU and image are not compatible",
+			"The image family of a module with GPUs provides a CUDA version that does not support the GPU "+
+				"generation or is older than required by a configured container image."+see(testGpuImageCompatibleName)),
+		doc(validatorCodes[testGpuNetworkingName], "GPU networking prerequisites are not met",
+			"A module with an A3 machine type has a wrong number or type of network interfaces, attaches "+
+				"two interfaces to the same network, disables gVNIC or uses an image without required drivers."+see(testGpuNetworkingName)),
+		doc(validatorCodes[testFirewallRulesName], "Firewall rules block required traffic or are too broad",
+			"Firewall rules created by the blueprint would block traffic required by its modules, such as Slurm daemons, "+
+				"NFS or SSH through IAP, or admit traffic from any address."+see(testFirewallRulesName)),
+		doc(validatorCodes[testHybridSlurmName], "Hybrid Slurm settings are invalid",
+			"A hybrid Slurm module has a malformed on-premise controller address, port or munge key mount, its cloud "+
+				"nodes can not resolve or reach the controller, or cloud subnetworks overlap with its address."+see(testHybridSlurmName)),
+		doc(validatorCodes[testWindowsImageName], "Module is not compatible with Windows image",
+			"A module with a Windows image uses an unsupported image family, runs Slurm, has Linux startup scripts, "+
+				"an Arm machine type or a boot disk smaller than the image."+see(testWindowsImageName)),
+		doc(validatorCodes[testArmCompatibleName], "CPU architectures do not match",
+			"The image, Spack targets or container images of a module are built for a CPU architecture other than "+
+				"its machine type, or a partition mixes Arm and x86 nodes."+see(testArmCompatibleName)),
+		doc(validatorCodes[testMachineTypeExistsName], "Machine type is not available",
+			"The machine type of a module does not exist in its zone, or is not accessible."+see(testMachineTypeExistsName)),
+		doc(validatorCodes[testGpuAvailableName], "GPU is not available",
+			"The accelerator type attached by `guest_accelerator` of a module is not offered in its zone, or more "+
+				"accelerators are requested than can be attached to an instance."+see(testGpuAvailableName)),
+		doc(validatorCodes[testQuotaSufficientName], "Quota is not sufficient",
+			"The vCPUs, GPUs or persistent disks of instances created by the blueprint would exceed "+
+				"regional quotas of the project."+see(testQuotaSufficientName)),
+		doc(validatorCodes[testPermissionsGrantedName], "Permissions are not granted",
+			"The active credentials lack IAM permissions in the project that modules of the blueprint "+
+				"require to create their resources."+see(testPermissionsGrantedName)),
+		doc(validatorCodes[testImageExistsName], "Image does not exist",
+			"The image or image family used by `instance_image` of a module, or the source image of a Packer "+
+				"module, does not exist or is not accessible."+see(testImageExistsName)),
+		doc(validatorCodes[testNetworkExistsName], "Network does not exist",
+			"The pre-existing VPC network referenced by `network_name` of a pre-existing-vpc module or by "+
+				"`network_self_link` of a module does not exist or is not accessible."+see(testNetworkExistsName)),
+		doc(validatorCodes[testFileSystemMountsName], "Inconsistent file system mounts",
+			"A `network_storage` entry does not refer to a file system module of the blueprint, two file systems "+
+				"are mounted at the same mount point, or `fs_type` does not match the file system."+see(testFileSystemMountsName)),
+		doc(validatorCodes[testSubnetworkExistsName], "Subnetwork does not exist or is in another region",
+			"The pre-existing subnetwork used by a module does not exist or is not accessible, or it is in "+
+				"a different region than the module attached to it."+see(testSubnetworkExistsName)),
+		doc(validatorCodes[testImageFreshName], "Image is obsolete",
+			"The image used by a module, or the image its family resolves to, is obsolete or deleted and can not "+
+				"be used to create instances. Deprecated and old images are reported as warnings."+see(testImageFreshName)),
+		doc(validatorCodes[testReservationExistsName], "Reservation does not exist or does not match",
+			"The reservation set by `reservation_name` of a module does not exist in its zone, is not a specific "+
+				"reservation, or reserves a different machine type or accelerators."+see(testReservationExistsName)),
+		doc(validatorCodes[testBillingEnabledName], "Billing is not enabled",
+			"The project has no billing account linked, or its billing account is closed. Terraform would "+
+				"fail with permission errors when creating resources."+see(testBillingEnabledName)),
+		doc(validatorCodes[testOrgPoliciesName], "Blueprint conflicts with org policies",
+			"Settings of modules violate effective org policies of the project, e.g. VMs with external IP "+
+				"addresses, VMs without Shielded VM or images of untrusted projects. The error lists the "+
+				"offending modules."+see(testOrgPoliciesName)),
+		doc(validatorCodes[testBackendBucketName], "Terraform backend bucket is not usable",
+			"The GCS bucket of `terraform_backend_defaults` or of a group backend does not exist, is not "+
+				"accessible, or the credentials in use can not create objects in it. Terraform would fail to "+
+				"initialize state after the deployment folder is written."+see(testBackendBucketName)),
+		doc(validatorCodes[testLabelsValidName], "Invalid labels or deployment name",
+			"Labels of a module, including labels inherited from `vars.labels`, violate GCP label constraints, "+
+				"or `deployment_name` can not prefix resource names. Every module using them would fail at apply "+
+				"time."+see(testLabelsValidName)),
+		doc(validatorCodes[testExternalResourcesExistName], "External resource does not exist",
+			"A Filestore instance or service account declared in `external_resources` does not exist or is not "+
+				"accessible, or `server_ip` and `remote_mount` of a Filestore instance do not match the instance. "+
+				"External networks are checked by `test_network_exists`."+see(testExternalResourcesExistName)),
+		doc(validatorCodes[testSpotAvailabilityName], "Spot capacity advisory",
+			"The validator only prints warnings for modules requesting Spot VMs of a machine family with "+
+				"historically poor Spot availability in their zone, and suggests alternative machine families and "+
+				"zones. It fails only if it is misconfigured."+see(testSpotAvailabilityName)),
+		doc(validatorCodes[testSSHKeysName], "Malformed SSH keys",
+			"The `ssh-keys` entry of `metadata` of a module has a line that is not of form `USERNAME:KEY` or a "+
+				"key that is not a valid public key. Keys that are ignored because OS Login is enabled are "+
+				"reported as warnings."+see(testSSHKeysName)),
+		doc(validatorCodes[testPrivateGoogleAccessName], "No route to Google APIs",
+			"A module creates VMs without external IP addresses in a pre-existing subnetwork that has neither "+
+				"Private Google Access enabled nor a Cloud NAT gateway. The VMs can not reach Google APIs or package "+
+				"repositories and their startup scripts hang. Modules downloading software from outside of Google "+
+				"through subnetworks without Cloud NAT are reported as warnings."+see(testPrivateGoogleAccessName)),
+		doc(validatorCodes[testToolkitCompatibleName], "Module incompatible with ghpc",
+			"A module of the toolkit repository is pinned to a release of another major version than the ghpc "+
+				"binary, or to a release known to be incompatible with it. Modules of newer releases are reported "+
+				"as warnings, as features of their metadata may be ignored."+see(testToolkitCompatibleName)),
+		doc(validatorCodes[testSlurmTopologyName], "Slurm modules are not connected",
+			"A Slurm partition module has no nodesets, a nodeset module is not part of any partition, or a "+
+				"partition or login module is not used by the controller. Its nodes would not be part of the "+
+				"cluster."+see(testSlurmTopologyName)),
+		doc(validatorCodes[testModuleRegionsConsistentName], "Module outside of region of used resources",
+			"The zone or region of a module differs from the region of a network or Filestore module it uses, or "+
+				"of the subnetwork of its `subnetwork_self_link`. Instances can not be attached to subnetworks of "+
+				"other regions."+see(testModuleRegionsConsistentName)),
+		doc(validatorCodes[testPackerBuildName], "Image build would fail",
+			"The disk of a Packer image build is smaller than its source image, or the build VM has no external IP "+
+				"address and its subnetwork has no Cloud NAT, so software can not be downloaded. Disks that may be too "+
+				"small for the software installed during the build are reported as warnings."+see(testPackerBuildName)),
+		doc(validatorCodes[testDiskTypesAvailableName], "Disk type is not available",
+			"A disk type of a module is not available in its zone, or a disk type or the number of local SSDs "+
+				"is not supported by the machine type of the module."+see(testDiskTypesAvailableName)),
+		doc(validatorCodes[testSecretsAccessibleName], "Secret is not accessible",
+			"A Secret Manager secret referred to by a module, by resource name or by a `gcloud secrets versions "+
+				"access` command of a script, does not exist, its version is not enabled, or the credentials in use "+
+				"lack roles/secretmanager.secretAccessor on it."+see(testSecretsAccessibleName)),
+		doc(CodeTimeout, "Validator timed out",
+			"A validator did not finish within its `timeout` or the `--validator-timeout` default, e.g. due to a slow "+
+				"or unreliable network. Set `retries` to run it again, or increase the timeout. "+
+				"See [timeouts and retries](blueprint-validation.md#timeouts-and-retries)."),
+		doc(CodeUnknownFailure, "Validator failed",
+			"A validator without a dedicated code failed, see the error message for details. "+
+				"Findings of [custom validators](blueprint-validation.md#custom-validators) are reported with this code."),
+	}
+}
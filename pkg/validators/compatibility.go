@@ -0,0 +1,156 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	_ "embed"
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/logging"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	"golang.org/x/exp/slices"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed toolkit_compatibility.yaml
+var toolkitCompatibilityYaml []byte
+
+// incompatibility is a known incompatible combination of toolkit modules and ghpc
+type incompatibility struct {
+	Modules         []string
+	ModuleVersions  string `yaml:"module_versions"`
+	ToolkitVersions string `yaml:"toolkit_versions"`
+	Description     string
+}
+
+// compatibilityTable is the table of incompatibilities shipped in toolkit_compatibility.yaml
+type compatibilityTable struct {
+	Incompatible []incompatibility
+}
+
+func loadCompatibilityTable() (compatibilityTable, error) {
+	var t compatibilityTable
+	if err := yaml.Unmarshal(toolkitCompatibilityYaml, &t); err != nil {
+		return t, fmt.Errorf("malformed toolkit compatibility table: %w", err)
+	}
+	for _, in := range t.Incompatible {
+		for _, c := range []string{in.ModuleVersions, in.ToolkitVersions} {
+			if _, err := version.NewConstraint(c); err != nil {
+				return t, fmt.Errorf("malformed toolkit compatibility table, invalid constraint %q: %w", c, err)
+			}
+		}
+	}
+	return t, nil
+}
+
+// find returns the first incompatibility of the module
+func (t compatibilityTable) find(path string, mv *version.Version, tv *version.Version) (incompatibility, bool) {
+	for _, in := range t.Incompatible {
+		if len(in.Modules) > 0 && !slices.Contains(in.Modules, path) {
+			continue
+		}
+		mc, _ := version.NewConstraint(in.ModuleVersions) // checked by loadCompatibilityTable
+		tc, _ := version.NewConstraint(in.ToolkitVersions)
+		if mc.Check(mv) && tc.Check(tv) {
+			return in, true
+		}
+	}
+	return incompatibility{}, false
+}
+
+// toolkitSourceRe matches sources of modules of the toolkit repository pinned to a ref
+var toolkitSourceRe = regexp.MustCompile(`^(?:git::)?(?:https://)?github\.com/GoogleCloudPlatform/hpc-toolkit(?:\.git)?//([^?]+)\?(?:.*&)?ref=([^&]+)`)
+
+// toolkitModuleVersion returns the path of a module of the toolkit repository and
+// the release it is pinned to; branches and commits are not releases
+func toolkitModuleVersion(source string) (string, *version.Version, bool) {
+	m := toolkitSourceRe.FindStringSubmatch(source)
+	if m == nil || !strings.HasPrefix(m[2], "v") {
+		return "", nil, false
+	}
+	v, err := version.NewVersion(m[2])
+	if err != nil {
+		return "", nil, false
+	}
+	return strings.Trim(m[1], "/"), v, true
+}
+
+// minor returns major and minor version segments of v
+func minor(v *version.Version) (int, int) {
+	s := v.Segments()
+	return s[0], s[1]
+}
+
+// checkToolkitCompatibility reports modules of the toolkit repository pinned to a
+// release that are incompatible with toolkit version tv: of another major version,
+// or listed in the table. Returns warnings for modules of releases newer than tv,
+// as metadata of remote modules is not read, e.g. their validators and naming inputs.
+func checkToolkitCompatibility(bp config.Blueprint, tv *version.Version, t compatibilityTable) ([]string, error) {
+	warnings := []string{}
+	errs := config.Errors{}
+	tMajor, tMinor := minor(tv)
+	bp.WalkModulesSafe(func(p config.ModulePath, m *config.Module) {
+		path, v, ok := toolkitModuleVersion(m.Source)
+		if !ok {
+			return
+		}
+		major, mnr := minor(v)
+		if major != tMajor {
+			errs.At(p.Source, config.HintError{
+				Hint: fmt.Sprintf("use modules and a ghpc binary of the same major version, e.g. ref=v%d.%d.0 with ghpc %s",
+					tMajor, tMinor, tv.Original()),
+				Err: fmt.Errorf("module %q of toolkit version %s is incompatible with ghpc version %s", m.ID, v.Original(), tv.Original())})
+			return
+		}
+		if in, ok := t.find(path, v, tv); ok {
+			errs.At(p.Source, config.HintError{
+				Hint: fmt.Sprintf("pin the module to a release that is not %s, or use a ghpc binary that is not %s",
+					in.ModuleVersions, in.ToolkitVersions),
+				Err: fmt.Errorf("module %q of toolkit version %s is incompatible with ghpc version %s: %s",
+					m.ID, v.Original(), tv.Original(), in.Description)})
+			return
+		}
+		if mnr > tMinor {
+			warnings = append(warnings, fmt.Sprintf("module %q of toolkit version %s is newer than ghpc version %s, "+
+				"features of its metadata may be ignored; upgrade ghpc", m.ID, v.Original(), tv.Original()))
+		}
+	})
+	return warnings, errs.OrNil()
+}
+
+func testToolkitCompatible(bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{}); err != nil {
+		return err
+	}
+	if config.ToolkitVersion == "" {
+		return nil
+	}
+	tv, err := version.NewVersion(config.ToolkitVersion)
+	if err != nil {
+		return nil // development builds are not checked
+	}
+	t, err := loadCompatibilityTable()
+	if err != nil {
+		return err
+	}
+	warnings, err := checkToolkitCompatibility(bp, tv, t)
+	for _, w := range warnings {
+		logging.Warnf(testToolkitCompatibleName, "%s", w)
+	}
+	return err
+}
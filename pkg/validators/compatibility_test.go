@@ -0,0 +1,84 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"hpc-toolkit/pkg/config"
+
+	"github.com/hashicorp/go-version"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestLoadCompatibilityTable(c *C) {
+	_, err := loadCompatibilityTable()
+	c.Check(err, IsNil)
+}
+
+func (s *MySuite) TestToolkitModuleVersion(c *C) {
+	check := func(source string, path string, v string) {
+		p, ver, ok := toolkitModuleVersion(source)
+		c.Assert(ok, Equals, true, Commentf("%s", source))
+		c.Check(p, Equals, path)
+		c.Check(ver.Original(), Equals, v)
+	}
+	check("github.com/GoogleCloudPlatform/hpc-toolkit//modules/compute/vm-instance?ref=v1.30.0",
+		"modules/compute/vm-instance", "v1.30.0")
+	check("git::https://github.com/GoogleCloudPlatform/hpc-toolkit.git//community/modules/compute/gke-node-pool?depth=1&ref=v1.28.1",
+		"community/modules/compute/gke-node-pool", "v1.28.1")
+
+	for _, source := range []string{
+		"modules/compute/vm-instance",
+		"./modules/compute/vm-instance",
+		"github.com/GoogleCloudPlatform/hpc-toolkit//modules/compute/vm-instance",
+		"github.com/GoogleCloudPlatform/hpc-toolkit//modules/compute/vm-instance?ref=develop",
+		"github.com/GoogleCloudPlatform/hpc-toolkit//modules/compute/vm-instance?ref=1234abc",
+		"github.com/example/hpc-toolkit//modules/compute/vm-instance?ref=v1.30.0",
+	} {
+		_, _, ok := toolkitModuleVersion(source)
+		c.Check(ok, Equals, false, Commentf("%s", source))
+	}
+}
+
+func (s *MySuite) TestCheckToolkitCompatibility(c *C) {
+	src := func(path string, ref string) string {
+		return "github.com/GoogleCloudPlatform/hpc-toolkit//" + path + "?ref=" + ref
+	}
+	bp := config.Blueprint{Groups: []config.Group{{Name: "g", Modules: []config.Module{
+		{ID: "embedded", Source: "modules/compute/vm-instance"},
+		{ID: "same", Source: src("modules/compute/vm-instance", "v1.30.2")},
+		{ID: "older", Source: src("community/modules/compute/gke-node-pool", "v1.28.0")},
+		{ID: "newer", Source: src("modules/network/vpc", "v1.31.0")},
+		{ID: "branch", Source: src("modules/network/vpc", "develop")},
+	}}}}
+	tv := version.Must(version.NewVersion("v1.30.0"))
+
+	warnings, err := checkToolkitCompatibility(bp, tv, compatibilityTable{})
+	c.Check(err, IsNil)
+	c.Check(warnings, DeepEquals, []string{
+		`module "newer" of toolkit version v1.31.0 is newer than ghpc version v1.30.0, features of its metadata may be ignored; upgrade ghpc`})
+
+	table := compatibilityTable{Incompatible: []incompatibility{{
+		Modules:         []string{"community/modules/compute/gke-node-pool"},
+		ModuleVersions:  "< 1.29",
+		ToolkitVersions: ">= 1.30",
+		Description:     "renamed settings",
+	}}}
+	_, err = checkToolkitCompatibility(bp, tv, table)
+	c.Check(err, ErrorMatches, `.*modules\[2\].source: module "older" of toolkit version v1.28.0 is incompatible with ghpc version v1.30.0: renamed settings.*`)
+
+	bp.Groups[0].Modules = append(bp.Groups[0].Modules, config.Module{ID: "old", Source: src("modules/network/vpc", "v0.9.0")})
+	_, err = checkToolkitCompatibility(bp, tv, compatibilityTable{})
+	c.Check(err, ErrorMatches, `.*modules\[5\].source: module "old" of toolkit version v0.9.0 is incompatible with ghpc version v1.30.0.*`)
+}
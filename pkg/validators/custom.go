@@ -0,0 +1,123 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/logging"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	ctyJson "github.com/zclconf/go-cty/cty/json"
+)
+
+// CustomValidatorBlueprintEnv is the environment variable with the path of the
+// expanded blueprint passed to custom validators
+const CustomValidatorBlueprintEnv = "GHPC_BLUEPRINT"
+
+// AllowCustom runs executables of custom validators, set by `--allow-custom-validators`.
+// Otherwise custom validators are skipped with a warning.
+var AllowCustom bool
+
+// customFindings splits output of a custom validator into findings, one per non-empty line
+func customFindings(out []byte) []string {
+	res := []string{}
+	for _, l := range strings.Split(string(out), "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			res = append(res, l)
+		}
+	}
+	return res
+}
+
+// runCustomValidator runs the executable of a custom validator with inputs as a JSON
+// object on standard input, and the expanded blueprint in a YAML file named by
+// GHPC_BLUEPRINT. The validator fails if the executable exits with non-zero code,
+// lines it prints to standard output are findings: errors of a failing validator,
+// warnings of a succeeding one.
+func runCustomValidator(ctx context.Context, bp config.Blueprint, command []string, inputs config.Dict) ([]string, error) {
+	in, err := ctyJson.SimpleJSONValue{Value: inputs.AsObject()}.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal inputs: %w", err)
+	}
+	dir, err := os.MkdirTemp("", "ghpc-validator-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	bpFile := filepath.Join(dir, "expanded_blueprint.yaml")
+	if err := bp.Export(bpFile); err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.WaitDelay = time.Second // do not wait for children of the killed executable holding its output
+	cmd.Env = append(os.Environ(), CustomValidatorBlueprintEnv+"="+bpFile)
+	cmd.Stdin = bytes.NewReader(in)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+
+	var eerr *exec.ExitError
+	switch {
+	case err == nil:
+		return customFindings(out), nil
+	case !errors.As(err, &eerr):
+		return nil, config.CodedError{Code: CodeMisconfigured, Err: fmt.Errorf("failed to run %s: %w", command[0], err)}
+	}
+	findings := customFindings(out)
+	if len(findings) == 0 { // report why the executable failed
+		msg := fmt.Sprintf("%s exited with code %d", command[0], eerr.ExitCode())
+		if s := strings.TrimSpace(stderr.String()); s != "" {
+			msg += ": " + s
+		}
+		findings = []string{msg}
+	}
+	errs := config.Errors{}
+	for _, f := range findings {
+		errs.Add(errors.New(f))
+	}
+	return nil, errs.OrNil()
+}
+
+// warnCustomSkipped notifies that custom validators were skipped as they were not allowed
+func warnCustomSkipped(skipped []string) {
+	if len(skipped) == 0 {
+		return
+	}
+	logging.Warn(logging.Warning{
+		Source:  "validation",
+		Message: fmt.Sprintf("custom validators were skipped: %s", strings.Join(skipped, ", ")),
+		Hint:    "custom validators run executables named by the blueprint, use --allow-custom-validators to run them",
+	})
+}
+
+// customValidator returns implementation of the named custom validator running the command
+func customValidator(name string, command []string) validatorFunc {
+	return func(ctx context.Context, bp config.Blueprint, inputs config.Dict) error {
+		warnings, err := runCustomValidator(ctx, bp, command, inputs)
+		for _, w := range warnings {
+			logging.Warnf(name, "%s", w)
+		}
+		return err
+	}
+}
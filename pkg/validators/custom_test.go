@@ -0,0 +1,111 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"context"
+	"errors"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/logging"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/zclconf/go-cty/cty"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestRunCustomValidator(c *C) {
+	script := filepath.Join(c.MkDir(), "check.sh")
+	// fails with inputs as findings unless `pass` is set, warns about name of the blueprint
+	c.Assert(os.WriteFile(script, []byte(`#!/bin/sh
+in=$(cat)
+name=$(grep blueprint_name "$GHPC_BLUEPRINT")
+case "$in" in
+*pass*) echo "$name"; exit 0 ;;
+*silent*) echo "no output" >&2; exit 3 ;;
+*hang*) sleep 30 ;;
+*) echo "$in"; echo; echo "second"; exit 1 ;;
+esac
+`), 0755), IsNil)
+
+	defer func(a bool) { AllowCustom = a }(AllowCustom)
+	AllowCustom = true
+	bp := config.Blueprint{BlueprintName: "zebra"}
+	in := func(k string) config.Dict {
+		return config.NewDict(map[string]cty.Value{k: cty.True})
+	}
+
+	{ // success, output lines are warnings
+		w, err := runCustomValidator(context.Background(), bp, []string{script}, in("pass"))
+		c.Check(err, IsNil)
+		c.Check(w, DeepEquals, []string{"blueprint_name: zebra"})
+	}
+
+	{ // failure, output lines are errors
+		_, err := runCustomValidator(context.Background(), bp, []string{script}, in("bad"))
+		c.Check(err, DeepEquals, config.Errors{Errors: []error{
+			errors.New(`{"bad":true}`), errors.New("second")}})
+	}
+
+	{ // failure without output reports exit code and stderr
+		_, err := runCustomValidator(context.Background(), bp, []string{script}, in("silent"))
+		c.Check(err, ErrorMatches, `.*check.sh exited with code 3: no output`)
+	}
+
+	{ // executable is missing
+		_, err := runCustomValidator(context.Background(), bp, []string{"./no/such/validator"}, in("pass"))
+		c.Check(err, ErrorMatches, `failed to run ./no/such/validator: .*`)
+	}
+
+	{ // hung executable is killed when the validator times out
+		bp := bp
+		bp.Validators = []config.Validator{{Validator: "site_policy", Command: []string{script}, Inputs: in("hang"), Timeout: "100ms"}}
+		start := time.Now()
+		err := Execute(bp)
+		var ve ValidatorError
+		c.Assert(errors.As(err, &ve), Equals, true)
+		c.Check(ve.Code(), Equals, CodeTimeout)
+		c.Check(time.Since(start) < 10*time.Second, Equals, true)
+	}
+
+	{ // modules can skip custom validators
+		bp := bp
+		bp.Validators = []config.Validator{{Validator: "site_policy", Command: []string{script}, Inputs: in("pass")}}
+		bp.Groups = []config.Group{{Name: "g", Modules: []config.Module{{
+			ID: "a", Source: "./skip/x", Kind: config.TerraformKind, SkipValidators: []string{"site_policy"}}}}}
+		c.Check(Execute(bp), IsNil)
+	}
+
+	{ // name collides with built-in validator
+		bp := bp
+		bp.Validators = []config.Validator{{Validator: testZoneExistsName, Command: []string{script}}}
+		c.Check(Execute(bp), ErrorMatches, `.*custom validator "test_zone_exists" has the name of a built-in or registered validator.*`)
+	}
+
+	{ // executables are not run unless allowed
+		AllowCustom = false
+		logging.ResetWarnings()
+		defer logging.ResetWarnings()
+		bp := bp
+		bp.Validators = []config.Validator{{Validator: "site_policy", Command: []string{script}, Inputs: in("bad")}}
+		c.Check(Execute(bp), IsNil)
+		c.Check(logging.Warnings(), DeepEquals, []logging.Warning{{
+			Source:  "validation",
+			Message: "custom validators were skipped: site_policy",
+			Hint:    "custom validators run executables named by the blueprint, use --allow-custom-validators to run them",
+		}})
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"hpc-toolkit/pkg/apiclient"
+	"hpc-toolkit/pkg/config"
+	"regexp"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/slices"
+	compute "google.golang.org/api/compute/v1"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed disk_compatibility.yaml
+var diskCompatibilityYaml []byte
+
+// localSSDDiskType is the disk type of local SSDs in `additional_disks`
+const localSSDDiskType = "local-ssd"
+
+// localSSDSettings are settings holding numbers of local SSDs attached to instances
+var localSSDSettings = []string{"local_ssd_count", "local_ssd_count_ephemeral_storage", "local_ssd_count_nvme_block"}
+
+// diskSupport is disk support of machine types matching the pattern
+type diskSupport struct {
+	Pattern     string
+	DiskTypes   []string `yaml:"disk_types"`
+	LocalSSDs   []int64  `yaml:"local_ssds"`
+	NoLocalSSDs bool     `yaml:"no_local_ssds"`
+	re          *regexp.Regexp
+}
+
+// diskCompatibility is the table of disk support shipped in disk_compatibility.yaml
+type diskCompatibility struct {
+	MachineTypes []diskSupport `yaml:"machine_types"`
+}
+
+func loadDiskCompatibility() (diskCompatibility, error) {
+	var t diskCompatibility
+	if err := yaml.Unmarshal(diskCompatibilityYaml, &t); err != nil {
+		return t, fmt.Errorf("malformed disk compatibility table: %w", err)
+	}
+	for i, s := range t.MachineTypes {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return t, fmt.Errorf("malformed disk compatibility table: %w", err)
+		}
+		t.MachineTypes[i].re = re
+	}
+	return t, nil
+}
+
+// support returns disk support of the machine type, or false if it is not known
+func (t diskCompatibility) support(machineType string) (diskSupport, bool) {
+	for _, s := range t.MachineTypes {
+		if s.re.MatchString(machineType) {
+			return s, true
+		}
+	}
+	return diskSupport{}, false
+}
+
+// diskUse is a disk type requested by a setting of a module
+type diskUse struct {
+	path config.Path
+	typ  string
+	// the disk type is the default of `disk_type` of the module
+	implicit bool
+}
+
+// moduleDisks returns disk types of boot and additional disks of the module, and the
+// number of local SSDs attached to its instances with the path of the setting
+func moduleDisks(bp config.Blueprint, p config.ModulePath, m config.Module) ([]diskUse, int64, config.Path) {
+	disks := []diskUse{}
+	if dt, ok := evalStringSetting(bp, m, "disk_type"); ok && dt != "" {
+		disks = append(disks, diskUse{path: p.Settings.Dot("disk_type"), typ: dt})
+	} else if !m.Settings.Has("disk_type") && m.Settings.Has("machine_type") {
+		if dt, ok := defaultDiskType(m); ok {
+			disks = append(disks, diskUse{path: p.Settings.Dot("machine_type"), typ: dt, implicit: true})
+		}
+	}
+
+	var ssds int64
+	var ssdPath config.Path
+	for _, s := range localSSDSettings {
+		if n, ok := evalNumberSetting(bp, m, s); ok && n > 0 {
+			ssds += int64(n)
+			if ssdPath == nil {
+				ssdPath = p.Settings.Dot(s)
+			}
+		}
+	}
+
+	ad, ok := evalSetting(bp, m, "additional_disks", cty.NilVal)
+	if !ok || ad == cty.NilVal || ad.IsNull() || !ad.CanIterateElements() {
+		return disks, ssds, ssdPath
+	}
+	for i, it := 0, ad.ElementIterator(); it.Next(); i++ {
+		_, d := it.Element()
+		if d.IsNull() || !d.Type().IsObjectType() || !d.Type().HasAttribute("disk_type") {
+			continue
+		}
+		dt := d.GetAttr("disk_type")
+		if dt.IsNull() || dt.Type() != cty.String {
+			continue
+		}
+		dp := p.Settings.Dot("additional_disks").Cty(cty.Path{}.IndexInt(i).GetAttr("disk_type"))
+		if dt.AsString() == localSSDDiskType {
+			ssds++
+			if ssdPath == nil {
+				ssdPath = dp
+			}
+			continue
+		}
+		disks = append(disks, diskUse{path: dp, typ: dt.AsString()})
+	}
+	return disks, ssds, ssdPath
+}
+
+// defaultDiskType returns the default of `disk_type` of the module
+func defaultDiskType(m config.Module) (string, bool) {
+	for _, in := range m.InfoOrDie().Inputs {
+		if in.Name == "disk_type" {
+			s, ok := in.Default.(string)
+			return s, ok && s != ""
+		}
+	}
+	return "", false
+}
+
+// checkDiskTypes checks that disk types requested by modules are available in their
+// zones and that disk types and local SSDs are supported by their machine types
+func checkDiskTypes(bp config.Blueprint, projectID string, defaultZone string, t diskCompatibility, exists func(zone string, diskType string) bool) error {
+	type key struct{ zone, diskType string }
+	checked := map[key]bool{}
+	errs := config.Errors{}
+	bp.WalkModulesSafe(func(p config.ModulePath, m *config.Module) {
+		disks, ssds, ssdPath := moduleDisks(bp, p, *m)
+		if len(disks) == 0 && ssds == 0 {
+			return
+		}
+		zone := defaultZone
+		if z, ok := evalStringSetting(bp, *m, "zone"); ok && z != "" {
+			zone = z // module is placed in a zone other than the deployment one
+		}
+		mt, _ := evalStringSetting(bp, *m, "machine_type")
+		sup, known := t.support(mt)
+
+		for _, d := range disks {
+			k := key{zone, d.typ}
+			if _, ok := checked[k]; !ok {
+				checked[k] = exists(zone, d.typ)
+			}
+			if !checked[k] {
+				errs.At(d.path, config.HintError{
+					Hint: fmt.Sprintf("list available disk types with `gcloud compute disk-types list --zones %s --project %s`", zone, projectID),
+					Err:  fmt.Errorf("disk type %q of module %q is not available in zone %s", d.typ, m.ID, zone)})
+				continue
+			}
+			if !known || len(sup.DiskTypes) == 0 || slices.Contains(sup.DiskTypes, d.typ) {
+				continue
+			}
+			desc := fmt.Sprintf("disk type %q", d.typ)
+			if d.implicit {
+				desc += ", the default of `disk_type`"
+			}
+			errs.At(d.path, config.HintError{
+				Hint: fmt.Sprintf("set `disk_type` to one of %s", strings.Join(sup.DiskTypes, ", ")),
+				Err:  fmt.Errorf("machine type %s of module %q does not support %s", mt, m.ID, desc)})
+		}
+
+		if ssds == 0 || !known {
+			return
+		}
+		if sup.NoLocalSSDs {
+			errs.At(ssdPath, config.HintError{
+				Hint: "remove the local SSDs, or use a machine type that supports local SSDs",
+				Err:  fmt.Errorf("machine type %s of module %q does not support attaching local SSDs", mt, m.ID)})
+		} else if len(sup.LocalSSDs) > 0 && !slices.Contains(sup.LocalSSDs, ssds) {
+			counts := []string{}
+			for _, c := range sup.LocalSSDs {
+				counts = append(counts, fmt.Sprint(c))
+			}
+			errs.At(ssdPath, config.HintError{
+				Hint: fmt.Sprintf("attach %s local SSDs", strings.Join(counts, ", ")),
+				Err:  fmt.Errorf("%d local SSDs can not be attached to machine type %s of module %q", ssds, mt, m.ID)})
+		}
+	})
+	return errs.OrNil()
+}
+
+func testDiskTypesAvailable(ctx context.Context, bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{"project_id", "zone"}); err != nil {
+		return err
+	}
+	m, err := inputsAsStrings(inputs)
+	if err != nil {
+		return err
+	}
+	t, err := loadDiskCompatibility()
+	if err != nil {
+		return err
+	}
+	s, err := apiclient.New(ctx, compute.NewService)
+	if err != nil {
+		return handleClientError(err)
+	}
+	return checkDiskTypes(bp, m["project_id"], m["zone"], t, func(zone string, diskType string) bool {
+		_, err := s.DiskTypes.Get(m["project_id"], zone, diskType).Fields("name").Do()
+		return err == nil
+	})
+}
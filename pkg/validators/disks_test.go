@@ -0,0 +1,74 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/modulereader"
+	"regexp"
+
+	"github.com/zclconf/go-cty/cty"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestLoadDiskCompatibility(c *C) {
+	t, err := loadDiskCompatibility()
+	c.Assert(err, IsNil)
+	for mt, want := range map[string]bool{"c3-standard-88": true, "c3-standard-88-lssd": false, "n2-standard-8": false, "x9-mega-1": false} {
+		sup, _ := t.support(mt)
+		c.Check(sup.NoLocalSSDs, Equals, want, Commentf("machine type %s", mt))
+	}
+	_, ok := t.support("x9-mega-1")
+	c.Check(ok, Equals, false)
+}
+
+func (s *MySuite) TestCheckDiskTypes(c *C) {
+	modulereader.SetModuleInfo("./disks/vm", "terraform", modulereader.ModuleInfo{
+		Inputs: []modulereader.VarInfo{{Name: "disk_type", Type: cty.String, Default: "pd-standard"}}})
+	t := diskCompatibility{MachineTypes: []diskSupport{
+		{Pattern: "^c4-", DiskTypes: []string{"hyperdisk-balanced"}, NoLocalSSDs: true},
+		{Pattern: "^n2-", DiskTypes: []string{"pd-standard", "pd-ssd", "pd-extreme"}, LocalSSDs: []int64{1, 2, 4}},
+	}}
+	for i := range t.MachineTypes {
+		t.MachineTypes[i].re = regexp.MustCompile(t.MachineTypes[i].Pattern)
+	}
+	exists := func(zone string, diskType string) bool {
+		return diskType != "pd-extreme" || zone != "us-central1-a"
+	}
+	disk := func(typ string) cty.Value {
+		return cty.ObjectVal(map[string]cty.Value{"disk_type": cty.StringVal(typ), "disk_size_gb": cty.NumberIntVal(100)})
+	}
+	bp := config.Blueprint{Groups: []config.Group{{Modules: []config.Module{
+		newModule("ok", "./disks/vm", map[string]cty.Value{
+			"machine_type":     cty.StringVal("n2-standard-8"),
+			"disk_type":        cty.StringVal("pd-ssd"),
+			"additional_disks": cty.TupleVal([]cty.Value{disk("local-ssd"), disk("local-ssd"), disk("pd-standard")})}),
+		newModule("unknown", "./disks/vm", map[string]cty.Value{"machine_type": cty.StringVal("x9-mega-1"), "local_ssd_count": cty.NumberIntVal(3)}),
+		newModule("extreme", "./disks/vm", map[string]cty.Value{"machine_type": cty.StringVal("n2-standard-8"), "disk_type": cty.StringVal("pd-extreme")}),
+		newModule("extreme_b", "./disks/vm", map[string]cty.Value{
+			"machine_type": cty.StringVal("n2-standard-8"),
+			"disk_type":    cty.StringVal("pd-extreme"),
+			"zone":         cty.StringVal("us-central1-b")}),
+		newModule("c4", "./disks/vm", map[string]cty.Value{"machine_type": cty.StringVal("c4-standard-8"), "local_ssd_count": cty.NumberIntVal(1)}),
+		newModule("ssds", "./disks/vm", map[string]cty.Value{"machine_type": cty.StringVal("n2-standard-8"), "local_ssd_count": cty.NumberIntVal(3)}),
+	}}}}
+
+	err := checkDiskTypes(bp, "prj", "us-central1-a", t, exists)
+	c.Check(err, ErrorMatches, `(?s)4 errors.*`+
+		`modules\[2\].settings.disk_type: disk type "pd-extreme" of module "extreme" is not available in zone us-central1-a.*`+
+		`modules\[4\].settings.machine_type: machine type c4-standard-8 of module "c4" does not support disk type "pd-standard", the default of .disk_type..*`+
+		`modules\[4\].settings.local_ssd_count: machine type c4-standard-8 of module "c4" does not support attaching local SSDs.*`+
+		`modules\[5\].settings.local_ssd_count: 3 local SSDs can not be attached to machine type n2-standard-8 of module "ssds".*`)
+}
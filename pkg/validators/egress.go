@@ -0,0 +1,304 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"context"
+	"fmt"
+	"hpc-toolkit/pkg/apiclient"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/logging"
+	"net"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+	compute "google.golang.org/api/compute/v1"
+)
+
+// privateIPsOnly returns true if the module creates VMs and all its settings that
+// control external IP addresses, set or defaulted, disable them
+func privateIPsOnly(bp config.Blueprint, m config.Module) bool {
+	found := false
+	for s, public := range publicIPSettings {
+		if v, ok := evalBoolSettingOrDefault(bp, m, s); ok {
+			if v == public {
+				return false
+			}
+			found = true
+		}
+	}
+	return found
+}
+
+// egressLookups query networking configuration of Compute Engine
+type egressLookups struct {
+	// subnetwork returns the subnetwork, or false if it can not be read
+	subnetwork func(r subnetworkRef) (*compute.Subnetwork, bool)
+	// routers returns Cloud Routers of the region
+	routers func(project string, region string) ([]*compute.Router, error)
+}
+
+func newEgressLookups(ctx context.Context, s *compute.Service) egressLookups {
+	return egressLookups{
+		subnetwork: func(r subnetworkRef) (*compute.Subnetwork, bool) {
+			sn, err := s.Subnetworks.Get(r.project, r.region, r.name).Fields("name", "network", "privateIpGoogleAccess").Do()
+			return sn, err == nil
+		},
+		routers: func(project string, region string) ([]*compute.Router, error) {
+			routers := []*compute.Router{}
+			err := s.Routers.List(project, region).Pages(ctx, func(l *compute.RouterList) error {
+				routers = append(routers, l.Items...)
+				return nil
+			})
+			return routers, err
+		},
+	}
+}
+
+// natCovers returns true if the Cloud NAT gateway translates addresses of the subnetwork
+func natCovers(nat *compute.RouterNat, subnet *compute.Subnetwork) bool {
+	switch nat.SourceSubnetworkIpRangesToNat {
+	case "ALL_SUBNETWORKS_ALL_IP_RANGES", "ALL_SUBNETWORKS_ALL_PRIMARY_IP_RANGES":
+		return true
+	case "LIST_OF_SUBNETWORKS":
+		return slices.ContainsFunc(nat.Subnetworks, func(s *compute.RouterNatSubnetworkToNat) bool {
+			return path.Base(s.Name) == subnet.Name
+		})
+	}
+	return false
+}
+
+// hasCloudNat returns true if a Cloud NAT gateway of the network of the subnetwork
+// translates its addresses
+func hasCloudNat(routers []*compute.Router, subnet *compute.Subnetwork) bool {
+	for _, r := range routers {
+		if path.Base(r.Network) != path.Base(subnet.Network) {
+			continue
+		}
+		for _, nat := range r.Nats {
+			if natCovers(nat, subnet) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// googleHosts are domains of Google APIs and registries reachable with Private Google Access
+var googleHosts = []string{"googleapis.com", "gcr.io", "pkg.dev", "google.internal"}
+
+var (
+	urlHostRe = regexp.MustCompile(`https?://([A-Za-z0-9.-]+)`)
+	// package managers downloading from repositories outside of Google
+	packageInstallRe = regexp.MustCompile(`\b(apt-get|apt|yum|dnf|zypper|pip3?|conda|npm)\s+(-\S+\s+)*install\b`)
+	// container images of registries outside of Google
+	externalImageRe = regexp.MustCompile(`\b(docker\.io|ghcr\.io|quay\.io|nvcr\.io)/[^\s"']+`)
+	proxyRe         = regexp.MustCompile(`(?i)\bhttps?_proxy\s*=`)
+)
+
+// internetSources are modules downloading software from outside of Google
+var internetSources = map[string]string{
+	"scripts/spack-setup":    "Spack",
+	"scripts/spack-execute":  "Spack packages",
+	"scripts/ramble-setup":   "Ramble",
+	"scripts/ramble-execute": "Ramble applications",
+}
+
+// isGoogleHost returns true if the host is reachable with Private Google Access, or is
+// not a public host name, e.g. an IP address or a host of the network
+func isGoogleHost(host string) bool {
+	if net.ParseIP(host) != nil || !strings.Contains(host, ".") {
+		return true
+	}
+	return slices.ContainsFunc(googleHosts, func(d string) bool { return host == d || strings.HasSuffix(host, "."+d) })
+}
+
+// internetDownloads returns descriptions of software the module and modules it depends
+// on download from outside of Google, and whether they configure an HTTP proxy
+func internetDownloads(bp config.Blueprint, m config.Module) ([]string, bool) {
+	found := map[string]bool{}
+	proxy := false
+	for _, d := range append([]config.Module{m}, moduleDependencies(bp, m)...) {
+		for src, desc := range internetSources {
+			if strings.HasSuffix(d.Source, src) {
+				found[fmt.Sprintf("%s of module %q", desc, d.ID)] = true
+			}
+		}
+		for _, str := range knownStrings(bp, d) {
+			proxy = proxy || proxyRe.MatchString(str)
+			for _, match := range packageInstallRe.FindAllStringSubmatch(str, -1) {
+				found[fmt.Sprintf("packages of `%s install`", match[1])] = true
+			}
+			for _, match := range urlHostRe.FindAllStringSubmatch(str, -1) {
+				if !isGoogleHost(match[1]) {
+					found["files of "+match[1]] = true
+				}
+			}
+			for _, img := range externalImageRe.FindAllString(str, -1) {
+				found[fmt.Sprintf("container image %s", img)] = true
+			}
+		}
+	}
+	res := maps.Keys(found)
+	slices.Sort(res)
+	return res, proxy
+}
+
+// isVpcWithoutNat returns true if the module is a vpc module with Cloud NAT disabled
+func isVpcWithoutNat(bp config.Blueprint, m config.Module) bool {
+	if !strings.HasSuffix(m.Source, "network/vpc") {
+		return false
+	}
+	ips, ok := evalSetting(bp, m, "ips_per_nat", cty.NumberIntVal(2))
+	return ok && ips.Type() == cty.Number && ips.AsBigFloat().Sign() == 0
+}
+
+// egressUsers are modules creating VMs without external IP addresses in a subnetwork
+type egressUsers struct {
+	path config.Path
+	ids  []config.ModuleID
+}
+
+// checkPrivateGoogleAccess reports pre-existing subnetworks used by modules creating
+// VMs without external IP addresses, that have neither Private Google Access nor
+// Cloud NAT. Subnetworks created by the vpc module have both by default. Returns
+// warnings for modules downloading software from outside of Google through
+// subnetworks without Cloud NAT, that Private Google Access does not reach.
+func checkPrivateGoogleAccess(bp config.Blueprint, defaultProject string, lookup egressLookups) ([]string, error) {
+	// subnetworks of pre-existing-vpc modules by module ID
+	vpcs := map[config.ModuleID]subnetworkRef{}
+	bp.WalkModulesSafe(func(p config.ModulePath, m *config.Module) {
+		if !isPreExistingVpc(*m) {
+			return
+		}
+		if r, _, ok := moduleSubnetworkRef(bp, p, *m, defaultProject); ok {
+			vpcs[m.ID] = r
+		}
+	})
+
+	users := map[subnetworkRef]*egressUsers{}
+	order := []subnetworkRef{}
+	// users of networks created by vpc modules without Cloud NAT
+	unNatted := map[config.ModuleID][]config.ModuleID{}
+	bp.WalkModulesSafe(func(p config.ModulePath, m *config.Module) {
+		if !m.Settings.Has("subnetwork_self_link") || !privateIPsOnly(bp, *m) {
+			return
+		}
+		var r subnetworkRef
+		if ref, ok := literalSubnetwork(bp, *m); ok {
+			r = subnetworkRef{project: ref.Project, region: ref.Region, name: ref.Name}
+		} else {
+			found := false
+			for ref := range config.ValueReferences(m.Settings.Get("subnetwork_self_link")) {
+				if ref.GlobalVar {
+					continue
+				}
+				if vr, ok := vpcs[ref.Module]; ok {
+					r, found = vr, true
+				} else if dep, err := bp.Module(ref.Module); err == nil && isVpcWithoutNat(bp, *dep) {
+					unNatted[dep.ID] = append(unNatted[dep.ID], m.ID)
+				}
+			}
+			if !found {
+				return
+			}
+		}
+		if _, ok := users[r]; !ok {
+			order = append(order, r)
+			users[r] = &egressUsers{path: p.Settings.Dot("subnetwork_self_link")}
+		}
+		users[r].ids = append(users[r].ids, m.ID)
+	})
+
+	warnings := []string{}
+	// warnAbout warns about modules downloading software through the network without Cloud NAT
+	warnAbout := func(ids []config.ModuleID, network string) {
+		for _, id := range ids {
+			m, _ := bp.Module(id)
+			downloads, proxy := internetDownloads(bp, *m)
+			if len(downloads) == 0 || proxy {
+				continue
+			}
+			warnings = append(warnings, fmt.Sprintf("module %q creates VMs without external IP addresses in %s, which has no "+
+				"Cloud NAT; Private Google Access only reaches Google APIs, such as Cloud Storage and Artifact Registry, so "+
+				"downloading %s would fail; create a Cloud NAT gateway, or set `http_proxy` and `https_proxy` in startup "+
+				"scripts", id, network, strings.Join(downloads, ", ")))
+		}
+	}
+	vpcIDs := maps.Keys(unNatted)
+	slices.Sort(vpcIDs)
+	for _, vpc := range vpcIDs {
+		warnAbout(unNatted[vpc], fmt.Sprintf("the network of module %q", vpc))
+	}
+
+	errs := config.Errors{}
+	for _, r := range order {
+		subnet, ok := lookup.subnetwork(r)
+		if !ok {
+			continue // missing subnetworks are reported by test_subnetwork_exists
+		}
+		routers, err := lookup.routers(r.project, r.region)
+		if err != nil {
+			errs.Add(fmt.Errorf("failed to list Cloud Routers of region %s of project %s: %w", r.region, r.project, err))
+			continue
+		}
+		if hasCloudNat(routers, subnet) {
+			continue
+		}
+		u := users[r]
+		if subnet.PrivateIpGoogleAccess {
+			warnAbout(u.ids, fmt.Sprintf("subnetwork %q of project %s", r.name, r.project))
+			continue
+		}
+		// VMs reach neither Google APIs nor the internet, unless all of them use a proxy
+		if !slices.ContainsFunc(u.ids, func(id config.ModuleID) bool {
+			m, _ := bp.Module(id)
+			_, proxy := internetDownloads(bp, *m)
+			return !proxy
+		}) {
+			continue
+		}
+		errs.At(u.path, config.HintError{
+			Hint: fmt.Sprintf("enable Private Google Access with `gcloud compute networks subnets update %s --project %s "+
+				"--region %s --enable-private-ip-google-access`, or create a Cloud NAT gateway for the subnetwork", r.name, r.project, r.region),
+			Err: fmt.Errorf("modules %s create VMs without external IP addresses in subnetwork %q of project %s, which has "+
+				"neither Private Google Access nor Cloud NAT; the VMs can not reach Google APIs or package repositories "+
+				"and startup scripts would hang", quotedIDs(u.ids), r.name, r.project)})
+	}
+	return warnings, errs.OrNil()
+}
+
+func testPrivateGoogleAccess(ctx context.Context, bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{"project_id"}); err != nil {
+		return err
+	}
+	m, err := inputsAsStrings(inputs)
+	if err != nil {
+		return err
+	}
+	s, err := apiclient.New(ctx, compute.NewService)
+	if err != nil {
+		return handleClientError(err)
+	}
+	warnings, err := checkPrivateGoogleAccess(bp, m["project_id"], newEgressLookups(ctx, s))
+	for _, w := range warnings {
+		logging.Warnf(testPrivateGoogleAccessName, "%s", w)
+	}
+	return err
+}
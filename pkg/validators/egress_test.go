@@ -0,0 +1,164 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/modulereader"
+
+	"github.com/zclconf/go-cty/cty"
+	compute "google.golang.org/api/compute/v1"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestNatCovers(c *C) {
+	subnet := &compute.Subnetwork{Name: "s", Network: "projects/p/global/networks/n"}
+	c.Check(natCovers(&compute.RouterNat{SourceSubnetworkIpRangesToNat: "ALL_SUBNETWORKS_ALL_IP_RANGES"}, subnet), Equals, true)
+	c.Check(natCovers(&compute.RouterNat{
+		SourceSubnetworkIpRangesToNat: "LIST_OF_SUBNETWORKS",
+		Subnetworks:                   []*compute.RouterNatSubnetworkToNat{{Name: "https://www.googleapis.com/compute/v1/projects/p/regions/r/subnetworks/s"}},
+	}, subnet), Equals, true)
+	c.Check(natCovers(&compute.RouterNat{
+		SourceSubnetworkIpRangesToNat: "LIST_OF_SUBNETWORKS",
+		Subnetworks:                   []*compute.RouterNatSubnetworkToNat{{Name: "projects/p/regions/r/subnetworks/other"}},
+	}, subnet), Equals, false)
+
+	nat := &compute.Router{Network: "https://www.googleapis.com/compute/v1/projects/p/global/networks/n",
+		Nats: []*compute.RouterNat{{SourceSubnetworkIpRangesToNat: "ALL_SUBNETWORKS_ALL_PRIMARY_IP_RANGES"}}}
+	c.Check(hasCloudNat([]*compute.Router{nat}, subnet), Equals, true)
+	c.Check(hasCloudNat([]*compute.Router{{Network: "projects/p/global/networks/other", Nats: nat.Nats}}, subnet), Equals, false)
+}
+
+func (s *MySuite) TestCheckPrivateGoogleAccess(c *C) {
+	modulereader.SetModuleInfo("./egress/vm", "terraform", modulereader.ModuleInfo{
+		Inputs: []modulereader.VarInfo{{Name: "disable_public_ips", Type: cty.Bool, Default: false}}})
+	modulereader.SetModuleInfo("./egress/nodeset", "terraform", modulereader.ModuleInfo{
+		Inputs: []modulereader.VarInfo{{Name: "enable_public_ips", Type: cty.Bool, Default: false}}})
+	vpcSubnet := config.ModuleRef("net", "subnetwork_self_link").AsValue()
+	bp := config.Blueprint{Groups: []config.Group{{Name: "g", Modules: []config.Module{
+		newModule("net", "modules/network/pre-existing-vpc", map[string]cty.Value{
+			"network_name": cty.StringVal("hpc-net"),
+			"region":       cty.StringVal("us-central1")}),
+		newModule("public", "./egress/vm", map[string]cty.Value{"subnetwork_self_link": vpcSubnet}),
+		newModule("private", "./egress/vm", map[string]cty.Value{
+			"subnetwork_self_link": vpcSubnet,
+			"disable_public_ips":   cty.True}),
+		newModule("nodeset", "./egress/nodeset", map[string]cty.Value{"subnetwork_self_link": vpcSubnet}),
+		newModule("literal", "./egress/nodeset", map[string]cty.Value{
+			"subnetwork_self_link": cty.StringVal("projects/host/regions/europe-west4/subnetworks/shared")}),
+	}}}}
+
+	pga := map[string]bool{}
+	routers := []*compute.Router{}
+	lookup := egressLookups{
+		subnetwork: func(r subnetworkRef) (*compute.Subnetwork, bool) {
+			return &compute.Subnetwork{Name: r.name, Network: "projects/" + r.project + "/global/networks/n",
+				PrivateIpGoogleAccess: pga[r.name]}, true
+		},
+		routers: func(project string, region string) ([]*compute.Router, error) {
+			return routers, nil
+		},
+	}
+
+	_, err := checkPrivateGoogleAccess(bp, "prj", lookup)
+	c.Check(err, ErrorMatches, `(?s)2 errors.*`+
+		`modules\[2\].settings.subnetwork_self_link: modules "private", "nodeset" create VMs without external IP addresses in subnetwork "hpc-net" of project prj.*`+
+		`modules\[4\].settings.subnetwork_self_link: modules "literal" .* subnetwork "shared" of project host.*`)
+
+	pga["hpc-net"] = true
+	routers = []*compute.Router{{Network: "projects/host/global/networks/n", Nats: []*compute.RouterNat{
+		{SourceSubnetworkIpRangesToNat: "LIST_OF_SUBNETWORKS",
+			Subnetworks: []*compute.RouterNatSubnetworkToNat{{Name: "projects/host/regions/europe-west4/subnetworks/shared"}}}}}}
+	_, err = checkPrivateGoogleAccess(bp, "prj", lookup)
+	c.Check(err, IsNil)
+}
+
+func (s *MySuite) TestInternetDownloads(c *C) {
+	script := func(content string) cty.Value {
+		return cty.TupleVal([]cty.Value{cty.ObjectVal(map[string]cty.Value{"content": cty.StringVal(content)})})
+	}
+	bp := config.Blueprint{Groups: []config.Group{{Name: "g", Modules: []config.Module{
+		newModule("spack", "community/modules/scripts/spack-setup", nil),
+		newModule("script", "modules/scripts/startup-script", map[string]cty.Value{
+			"runners": script("curl -O https://storage.googleapis.com/b/o && curl http://10.0.0.2/x && " +
+				"curl https://github.com/x/y && sudo apt-get -y install jq && docker pull docker.io/library/ubuntu:22.04")}),
+		newModule("vm", "./egress/vm", map[string]cty.Value{
+			"startup_script": config.ModuleRef("script", "startup_script").AsValue(),
+			"spack":          config.ModuleRef("spack", "spack_path").AsValue()}),
+		newModule("proxied", "./egress/vm", map[string]cty.Value{
+			"startup_script": cty.StringVal("export https_proxy=http://proxy.corp.example.com:3128\npip install numpy")}),
+		newModule("google", "./egress/vm", map[string]cty.Value{
+			"startup_script": cty.StringVal("gsutil cp gs://b/o . && docker pull us-docker.pkg.dev/p/r/i")}),
+	}}}}
+
+	downloads, proxy := internetDownloads(bp, bp.Groups[0].Modules[2])
+	c.Check(downloads, DeepEquals, []string{
+		`Spack of module "spack"`,
+		"container image docker.io/library/ubuntu:22.04",
+		"files of github.com",
+		"packages of `apt-get install`",
+	})
+	c.Check(proxy, Equals, false)
+
+	downloads, proxy = internetDownloads(bp, bp.Groups[0].Modules[3])
+	c.Check(downloads, DeepEquals, []string{"files of proxy.corp.example.com", "packages of `pip install`"})
+	c.Check(proxy, Equals, true)
+
+	downloads, _ = internetDownloads(bp, bp.Groups[0].Modules[4])
+	c.Check(downloads, HasLen, 0)
+}
+
+func (s *MySuite) TestCheckPrivateGoogleAccessWarnings(c *C) {
+	modulereader.SetModuleInfo("./egress/private-vm", "terraform", modulereader.ModuleInfo{
+		Inputs: []modulereader.VarInfo{{Name: "disable_public_ips", Type: cty.Bool, Default: true}}})
+	install := cty.StringVal("dnf install -y htop")
+	bp := config.Blueprint{Groups: []config.Group{{Name: "g", Modules: []config.Module{
+		newModule("vpc", "modules/network/vpc", map[string]cty.Value{"ips_per_nat": cty.NumberIntVal(0)}),
+		newModule("shared", "modules/network/pre-existing-vpc", map[string]cty.Value{
+			"network_name": cty.StringVal("hpc-net"),
+			"region":       cty.StringVal("us-central1")}),
+		newModule("a", "./egress/private-vm", map[string]cty.Value{
+			"subnetwork_self_link": config.ModuleRef("vpc", "subnetwork_self_link").AsValue(),
+			"startup_script":       install}),
+		newModule("b", "./egress/private-vm", map[string]cty.Value{
+			"subnetwork_self_link": config.ModuleRef("shared", "subnetwork_self_link").AsValue(),
+			"startup_script":       install}),
+		newModule("c", "./egress/private-vm", map[string]cty.Value{
+			"subnetwork_self_link": config.ModuleRef("shared", "subnetwork_self_link").AsValue()}),
+	}}}}
+
+	pga := true
+	lookup := egressLookups{
+		subnetwork: func(r subnetworkRef) (*compute.Subnetwork, bool) {
+			return &compute.Subnetwork{Name: r.name, Network: "projects/p/global/networks/n", PrivateIpGoogleAccess: pga}, true
+		},
+		routers: func(project string, region string) ([]*compute.Router, error) { return nil, nil },
+	}
+
+	warnings, err := checkPrivateGoogleAccess(bp, "prj", lookup)
+	c.Check(err, IsNil)
+	c.Check(warnings, DeepEquals, []string{
+		`module "a" creates VMs without external IP addresses in the network of module "vpc", which has no Cloud NAT; ` +
+			"Private Google Access only reaches Google APIs, such as Cloud Storage and Artifact Registry, so downloading " +
+			"packages of `dnf install` would fail; create a Cloud NAT gateway, or set `http_proxy` and `https_proxy` in startup scripts",
+		`module "b" creates VMs without external IP addresses in subnetwork "hpc-net" of project prj, which has no Cloud NAT; ` +
+			"Private Google Access only reaches Google APIs, such as Cloud Storage and Artifact Registry, so downloading " +
+			"packages of `dnf install` would fail; create a Cloud NAT gateway, or set `http_proxy` and `https_proxy` in startup scripts",
+	})
+
+	pga = false
+	_, err = checkPrivateGoogleAccess(bp, "prj", lookup)
+	c.Check(err, ErrorMatches, `.*modules "b", "c" create VMs without external IP addresses in subnetwork "hpc-net".*`)
+}
@@ -0,0 +1,145 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"context"
+	"fmt"
+	"hpc-toolkit/pkg/apiclient"
+	"hpc-toolkit/pkg/config"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/slices"
+	file "google.golang.org/api/file/v1"
+	iam "google.golang.org/api/iam/v1"
+)
+
+// filestoreInstance is an existing Filestore instance, its file shares and IP addresses
+type filestoreInstance struct {
+	shares []string
+	ips    []string
+}
+
+// externalLookups look up external resources, return false if the resource does
+// not exist or can not be accessed
+type externalLookups struct {
+	filestore      func(project, location, name string) (filestoreInstance, bool)
+	serviceAccount func(email string) bool
+}
+
+// externalString evaluates a setting of the external resource, returns false if
+// it is not set or not known before deployment
+func externalString(bp config.Blueprint, r config.ExternalResource, name string) (string, bool) {
+	if !r.Settings.Has(name) {
+		return "", false
+	}
+	v, err := bp.Eval(r.Settings.Get(name))
+	if err != nil || !v.IsKnown() || v.IsNull() || v.Type() != cty.String {
+		return "", false
+	}
+	return v.AsString(), true
+}
+
+func checkExternalFilestore(bp config.Blueprint, i int, project string, lookup externalLookups) error {
+	r, sp := bp.ExternalResources[i], config.Root.External.At(i).Settings
+	if pv, ok := externalString(bp, r, "project_id"); ok {
+		project = pv
+	}
+	name, nok := externalString(bp, r, "name")
+	location, lok := externalString(bp, r, "location")
+	if !nok || !lok || project == "" {
+		return nil
+	}
+	errs := config.Errors{}
+	fi, ok := lookup.filestore(project, location, name)
+	if !ok {
+		return errs.At(sp.Dot("name"), config.HintError{
+			Hint: fmt.Sprintf("list instances with `gcloud filestore instances list --project %s`", project),
+			Err: fmt.Errorf("filestore instance %q does not exist in location %s of project %s or your credentials do not have permission to access it",
+				name, location, project)}).OrNil()
+	}
+
+	if ip, ok := externalString(bp, r, "server_ip"); ok && !slices.Contains(fi.ips, ip) {
+		errs.At(sp.Dot("server_ip"), fmt.Errorf("server_ip %s is not an IP address of filestore instance %q, its addresses are: %s",
+			ip, name, strings.Join(fi.ips, ", ")))
+	}
+	if rm, ok := externalString(bp, r, "remote_mount"); ok && !slices.Contains(fi.shares, strings.TrimPrefix(rm, "/")) {
+		errs.At(sp.Dot("remote_mount"), fmt.Errorf("remote_mount %s is not a file share of filestore instance %q, its file shares are: %s",
+			rm, name, strings.Join(fi.shares, ", ")))
+	}
+	return errs.OrNil()
+}
+
+// checkExternalResources reports external resources of the blueprint that do not
+// exist. Networks are checked by test_network_exists and test_subnetwork_exists,
+// which cover modules that external networks are expanded to.
+func checkExternalResources(bp config.Blueprint, defaultProject string, lookup externalLookups) error {
+	errs := config.Errors{}
+	for i, r := range bp.ExternalResources {
+		p := config.Root.External.At(i)
+		switch r.Type {
+		case config.ExternalFilestore:
+			errs.Add(checkExternalFilestore(bp, i, defaultProject, lookup))
+		case config.ExternalServiceAccount:
+			email, ok := externalString(bp, r, "email")
+			if ok && !lookup.serviceAccount(email) {
+				errs.At(p.Settings.Dot("email"), config.HintError{
+					Hint: "list service accounts with `gcloud iam service-accounts list --project PROJECT`",
+					Err:  fmt.Errorf("service account %q does not exist or your credentials do not have permission to access it", email)})
+			}
+		}
+	}
+	return errs.OrNil()
+}
+
+func testExternalResourcesExist(ctx context.Context, bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{"project_id"}); err != nil {
+		return err
+	}
+	m, err := inputsAsStrings(inputs)
+	if err != nil {
+		return err
+	}
+	fs, err := apiclient.New(ctx, file.NewService)
+	if err != nil {
+		return handleClientError(err)
+	}
+	is, err := apiclient.New(ctx, iam.NewService)
+	if err != nil {
+		return handleClientError(err)
+	}
+	return checkExternalResources(bp, m["project_id"], externalLookups{
+		filestore: func(project, location, name string) (filestoreInstance, bool) {
+			inst, err := fs.Projects.Locations.Instances.Get(
+				fmt.Sprintf("projects/%s/locations/%s/instances/%s", project, location, name)).Do()
+			if err != nil {
+				return filestoreInstance{}, false
+			}
+			fi := filestoreInstance{}
+			for _, s := range inst.FileShares {
+				fi.shares = append(fi.shares, s.Name)
+			}
+			for _, n := range inst.Networks {
+				fi.ips = append(fi.ips, n.IpAddresses...)
+			}
+			return fi, true
+		},
+		serviceAccount: func(email string) bool {
+			_, err := is.Projects.ServiceAccounts.Get("projects/-/serviceAccounts/" + email).Fields("email").Do()
+			return err == nil
+		},
+	})
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"hpc-toolkit/pkg/config"
+
+	"github.com/zclconf/go-cty/cty"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestCheckExternalResources(c *C) {
+	str := cty.StringVal
+	fs := func(ip string, share string) config.ExternalResource {
+		return config.ExternalResource{ID: "homefs", Type: config.ExternalFilestore, Settings: config.NewDict(map[string]cty.Value{
+			"name": str("home"), "location": str("us-central1-a"), "server_ip": str(ip),
+			"remote_mount": str(share), "local_mount": str("/home")})}
+	}
+	sa := config.ExternalResource{ID: "compute_sa", Type: config.ExternalServiceAccount,
+		Settings: config.NewDict(map[string]cty.Value{"email": str("compute@prj.iam.gserviceaccount.com")})}
+	vpc := config.ExternalResource{ID: "net", Type: config.ExternalVpc,
+		Settings: config.NewDict(map[string]cty.Value{"network_name": str("shared")})}
+
+	lookups := externalLookups{
+		filestore: func(project, location, name string) (filestoreInstance, bool) {
+			if project != "prj" || location != "us-central1-a" || name != "home" {
+				return filestoreInstance{}, false
+			}
+			return filestoreInstance{shares: []string{"nfsshare"}, ips: []string{"10.0.0.2"}}, true
+		},
+		serviceAccount: func(email string) bool { return email == "compute@prj.iam.gserviceaccount.com" },
+	}
+	bp := func(rs ...config.ExternalResource) config.Blueprint {
+		return config.Blueprint{ExternalResources: rs}
+	}
+
+	{ // OK: resources exist, networks are not checked
+		c.Check(checkExternalResources(bp(fs("10.0.0.2", "/nfsshare"), sa, vpc), "prj", lookups), IsNil)
+	}
+
+	{ // FAIL: resources do not exist
+		c.Check(checkExternalResources(bp(fs("10.0.0.2", "/nfsshare")), "other", lookups),
+			ErrorMatches, `(?s).*filestore instance "home" does not exist in location us-central1-a of project other.*`)
+		other := sa
+		other.Settings = config.NewDict(map[string]cty.Value{"email": str("other@prj.iam.gserviceaccount.com")})
+		c.Check(checkExternalResources(bp(other), "prj", lookups),
+			ErrorMatches, `(?s).*service account "other@prj.iam.gserviceaccount.com" does not exist.*`)
+	}
+
+	{ // FAIL: instance does not match settings
+		err := checkExternalResources(bp(fs("10.0.0.3", "/home")), "prj", lookups)
+		c.Check(err, ErrorMatches, `(?s).*server_ip 10.0.0.3 is not an IP address of filestore instance "home".*`)
+		c.Check(err, ErrorMatches, `(?s).*remote_mount /home is not a file share of filestore instance "home", its file shares are: nfsshare.*`)
+	}
+}
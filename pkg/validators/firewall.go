@@ -0,0 +1,342 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// iapRange is the range of addresses of Identity-Aware Proxy TCP forwarding
+const iapRange = "35.235.240.0/20"
+
+// fwAllow is an `allow` block of a firewall rule, empty ports allow all ports
+type fwAllow struct {
+	protocol string
+	ports    []string
+}
+
+// fwRule is an ingress firewall rule created by a module of the blueprint
+type fwRule struct {
+	path    config.Path
+	name    string
+	sources []string
+	allow   []fwAllow
+}
+
+func (a fwAllow) allows(protocol string, port int) bool {
+	if p := strings.ToLower(a.protocol); p != protocol && p != "all" {
+		return false
+	}
+	if len(a.ports) == 0 {
+		return true
+	}
+	for _, r := range a.ports {
+		lo, hi, _ := strings.Cut(r, "-")
+		if hi == "" {
+			hi = lo
+		}
+		l, errL := strconv.Atoi(lo)
+		h, errH := strconv.Atoi(hi)
+		if errL == nil && errH == nil && l <= port && port <= h {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsFrom tests whether the rule allows traffic to the port from all of the range,
+// an empty range stands for any source
+func (r fwRule) allowsFrom(protocol string, port int, from string) bool {
+	allowed := false
+	for _, a := range r.allow {
+		allowed = allowed || a.allows(protocol, port)
+	}
+	if !allowed || from == "" {
+		return allowed
+	}
+	_, want, err := net.ParseCIDR(from)
+	if err != nil {
+		return false
+	}
+	for _, s := range r.sources {
+		if _, src, err := net.ParseCIDR(s); err == nil && src.Contains(want.IP) {
+			ones, _ := src.Mask.Size()
+			wantOnes, _ := want.Mask.Size()
+			if ones <= wantOnes {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isOpenToInternet tests whether the rule admits traffic from any address, other than ICMP
+func (r fwRule) isOpenToInternet() bool {
+	open := false
+	for _, s := range r.sources {
+		open = open || s == "0.0.0.0/0" || s == "::/0"
+	}
+	if !open {
+		return false
+	}
+	for _, a := range r.allow {
+		if strings.ToLower(a.protocol) != "icmp" {
+			return true
+		}
+	}
+	return false
+}
+
+// ctyStrings converts a list of strings set in blueprint
+func ctyStrings(v cty.Value) ([]string, error) {
+	if v.IsNull() {
+		return nil, nil
+	}
+	l, err := convert.Convert(v, cty.List(cty.String))
+	if err != nil {
+		return nil, err
+	}
+	res := []string{}
+	for _, e := range l.AsValueSlice() {
+		if e.IsNull() {
+			return nil, fmt.Errorf("null element")
+		}
+		res = append(res, e.AsString())
+	}
+	return res, nil
+}
+
+// fwRequirement is a traffic required by modules of the blueprint
+type fwRequirement struct {
+	module   config.ModuleID
+	what     string
+	protocol string
+	ports    []int
+	from     string // empty for traffic within the network
+}
+
+func moduleFwRequirements(m config.Module) []fwRequirement {
+	src := m.Source
+	req := func(what string, ports []int, from string) fwRequirement {
+		return fwRequirement{module: m.ID, what: what, protocol: "tcp", ports: ports, from: from}
+	}
+	switch {
+	case strings.Contains(src, "schedmd-slurm"):
+		res := []fwRequirement{req("Slurm daemons", []int{6817, 6818, 6819}, "")}
+		if strings.Contains(src, "login") {
+			res = append(res, req("SSH from IAP", []int{22}, iapRange))
+		}
+		return res
+	case strings.HasSuffix(src, "file-system/nfs-server"):
+		return []fwRequirement{req("NFS", []int{111, 2049}, "")}
+	case strings.HasSuffix(src, "compute/vm-instance"):
+		return []fwRequirement{req("SSH from IAP", []int{22}, iapRange)}
+	}
+	return nil
+}
+
+// evalSetting returns the setting of the module, or the default if it is not set.
+// Returns false if the value is not known.
+func evalSetting(bp config.Blueprint, m config.Module, name string, def cty.Value) (cty.Value, bool) {
+	if !m.Settings.Has(name) {
+		return def, true
+	}
+	v, err := bp.Eval(m.Settings.Get(name))
+	if err != nil || !v.IsWhollyKnown() {
+		return cty.NilVal, false
+	}
+	return v, true
+}
+
+// decodeRules decodes a list of firewall rules set in blueprint, only ingress rules are returned.
+// Sources are read from `sourcesAttr` attribute, directions from `direction` if it is present,
+// `at` returns path of the i-th rule.
+func decodeRules(v cty.Value, at func(i int) config.Path, sourcesAttr string) ([]fwRule, bool) {
+	if v.IsNull() || !v.CanIterateElements() {
+		return nil, v.IsNull()
+	}
+	rules := []fwRule{}
+	for it := v.ElementIterator(); it.Next(); {
+		k, e := it.Element()
+		if e.IsNull() || !e.Type().IsObjectType() {
+			return nil, false
+		}
+		attr := func(name string) cty.Value {
+			if e.Type().HasAttribute(name) {
+				return e.GetAttr(name)
+			}
+			return cty.NullVal(cty.DynamicPseudoType)
+		}
+		if d := attr("direction"); !d.IsNull() && d.Type() == cty.String && strings.ToUpper(d.AsString()) != "INGRESS" {
+			continue
+		}
+		if d := attr("disabled"); !d.IsNull() && d.Type() == cty.Bool && d.True() {
+			continue
+		}
+		i, _ := k.AsBigFloat().Int64()
+		r := fwRule{path: at(int(i)), name: at(int(i)).String()}
+		if n := attr("name"); !n.IsNull() && n.Type() == cty.String {
+			r.name = n.AsString()
+		}
+		var err error
+		if r.sources, err = ctyStrings(attr(sourcesAttr)); err != nil {
+			return nil, false
+		}
+		if a := attr("allow"); !a.IsNull() {
+			if err := decodeAllow(a, &r.allow); err != nil {
+				return nil, false
+			}
+		}
+		rules = append(rules, r)
+	}
+	return rules, true
+}
+
+func decodeAllow(v cty.Value, allow *[]fwAllow) error {
+	for it := v.ElementIterator(); it.Next(); {
+		_, e := it.Element()
+		if e.IsNull() || !e.Type().IsObjectType() || !e.Type().HasAttribute("protocol") {
+			return fmt.Errorf("malformed allow block")
+		}
+		proto := e.GetAttr("protocol")
+		if proto.IsNull() || proto.Type() != cty.String {
+			return fmt.Errorf("malformed protocol")
+		}
+		a := fwAllow{protocol: proto.AsString()}
+		if e.Type().HasAttribute("ports") {
+			var err error
+			if a.ports, err = ctyStrings(e.GetAttr("ports")); err != nil {
+				return err
+			}
+		}
+		*allow = append(*allow, a)
+	}
+	return nil
+}
+
+// vpcRules returns ingress rules created by the vpc module, including ones
+// created with dedicated settings, such as `enable_internal_traffic`
+func vpcRules(bp config.Blueprint, p config.ModulePath, m config.Module) ([]fwRule, bool) {
+	internal, okI := evalSetting(bp, m, "enable_internal_traffic", cty.True)
+	iapSsh, okS := evalSetting(bp, m, "enable_iap_ssh_ingress", cty.True)
+	extraIap, okE := evalSetting(bp, m, "extra_iap_ports", cty.ListValEmpty(cty.String))
+	sshRanges, okR := evalSetting(bp, m, "allowed_ssh_ip_ranges", cty.ListValEmpty(cty.String))
+	custom, okC := evalSetting(bp, m, "firewall_rules", cty.NullVal(cty.DynamicPseudoType))
+	if !(okI && okS && okE && okR && okC) {
+		return nil, false
+	}
+
+	at := func(i int) config.Path { return p.Settings.Dot("firewall_rules").Cty(cty.Path{}.IndexInt(i)) }
+	rules, ok := decodeRules(custom, at, "ranges")
+	if !ok {
+		return nil, false
+	}
+	if internal.Type() == cty.Bool && internal.True() {
+		rules = append(rules, fwRule{path: p.Settings.Dot("enable_internal_traffic"), name: "internal traffic",
+			allow: []fwAllow{{protocol: "tcp"}, {protocol: "udp"}, {protocol: "icmp"}}})
+	}
+	iapPorts, err := ctyStrings(extraIap)
+	if err != nil {
+		return nil, false
+	}
+	if iapSsh.Type() == cty.Bool && iapSsh.True() {
+		iapPorts = append(iapPorts, "22")
+	}
+	if len(iapPorts) > 0 {
+		rules = append(rules, fwRule{path: p.Settings.Dot("enable_iap_ssh_ingress"), name: "IAP ingress",
+			sources: []string{iapRange}, allow: []fwAllow{{protocol: "tcp", ports: iapPorts}}})
+	}
+	ssh := fwRule{path: p.Settings.Dot("allowed_ssh_ip_ranges"), name: "SSH ingress",
+		allow: []fwAllow{{protocol: "tcp", ports: []string{"22"}}}}
+	if ssh.sources, err = ctyStrings(sshRanges); err != nil {
+		return nil, false
+	}
+	if len(ssh.sources) > 0 {
+		rules = append(rules, ssh)
+	}
+	return rules, true
+}
+
+func testFirewallRules(bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{}); err != nil {
+		return err
+	}
+
+	rules := []fwRule{}
+	vpcs := []config.ModulePath{}
+	known := true
+	reqs := []fwRequirement{}
+	bp.WalkModulesSafe(func(p config.ModulePath, m *config.Module) {
+		reqs = append(reqs, moduleFwRequirements(*m)...)
+		switch {
+		case strings.HasSuffix(m.Source, "network/vpc"):
+			vpcs = append(vpcs, p)
+			rs, ok := vpcRules(bp, p, *m)
+			known = known && ok
+			rules = append(rules, rs...)
+		case strings.HasSuffix(m.Source, "network/firewall-rules"):
+			v, ok := evalSetting(bp, *m, "ingress_rules", cty.NullVal(cty.DynamicPseudoType))
+			if !ok {
+				known = false
+				return
+			}
+			at := func(i int) config.Path { return p.Settings.Dot("ingress_rules").Cty(cty.Path{}.IndexInt(i)) }
+			rs, ok := decodeRules(v, at, "source_ranges")
+			known = known && ok
+			rules = append(rules, rs...)
+		}
+	})
+
+	errs := config.Errors{}
+	for _, r := range rules {
+		if r.isOpenToInternet() {
+			errs.At(r.path, config.HintError{
+				Hint: "restrict source ranges to addresses that need access, e.g. use IAP for SSH",
+				Err:  fmt.Errorf("firewall rule %q admits traffic from any address (0.0.0.0/0)", r.name)})
+		}
+	}
+
+	// firewall rules of pre-existing networks are not known
+	if len(vpcs) == 0 || !known {
+		return errs.OrNil()
+	}
+	for _, req := range reqs {
+		for _, port := range req.ports {
+			allowed := false
+			for _, r := range rules {
+				allowed = allowed || r.allowsFrom(req.protocol, port, req.from)
+			}
+			if allowed {
+				continue
+			}
+			hint := "allow traffic within the network with `enable_internal_traffic: true` or a firewall rule"
+			if req.from == iapRange {
+				hint = "allow SSH through IAP with `enable_iap_ssh_ingress: true` or a firewall rule"
+			}
+			errs.At(vpcs[0], config.HintError{
+				Hint: hint,
+				Err:  fmt.Errorf("%s traffic of module %q would be blocked by firewall, no rule allows %s port %d", req.what, req.module, req.protocol, port)})
+			break // report one port per requirement
+		}
+	}
+	return errs.OrNil()
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"hpc-toolkit/pkg/config"
+
+	"github.com/zclconf/go-cty/cty"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestFirewallRules(c *C) {
+	rule := func(name string, source string, ports ...string) cty.Value {
+		ps := []cty.Value{}
+		for _, p := range ports {
+			ps = append(ps, cty.StringVal(p))
+		}
+		return cty.ObjectVal(map[string]cty.Value{
+			"name":          cty.StringVal(name),
+			"source_ranges": cty.TupleVal([]cty.Value{cty.StringVal(source)}),
+			"allow": cty.TupleVal([]cty.Value{cty.ObjectVal(map[string]cty.Value{
+				"protocol": cty.StringVal("tcp"),
+				"ports":    cty.TupleVal(ps)})})})
+	}
+	check := func(ms ...config.Module) error {
+		bp := config.Blueprint{Groups: []config.Group{{Name: "g", Modules: ms}}}
+		return testFirewallRules(bp, config.Dict{})
+	}
+	controller := newModule("ctrl", "community/modules/scheduler/schedmd-slurm-gcp-v6-controller", nil)
+	login := newModule("login", "community/modules/scheduler/schedmd-slurm-gcp-v6-login", nil)
+	vm := newModule("vm", "modules/compute/vm-instance", nil)
+
+	{ // OK: VPC with default settings
+		c.Check(check(newModule("net", "modules/network/vpc", nil), controller, login, vm), IsNil)
+	}
+
+	{ // OK: pre-existing network, rules are not known
+		c.Check(check(newModule("net", "modules/network/pre-existing-vpc", nil), controller, vm), IsNil)
+	}
+
+	{ // OK: internal traffic is allowed by firewall-rules module
+		c.Check(check(
+			newModule("net", "modules/network/vpc", map[string]cty.Value{"enable_internal_traffic": cty.False}),
+			newModule("fw", "modules/network/firewall-rules", map[string]cty.Value{
+				"ingress_rules": cty.TupleVal([]cty.Value{rule("slurm", "10.0.0.0/8", "6817-6819")})}),
+			controller), IsNil)
+	}
+
+	{ // FAIL: internal traffic is disabled
+		c.Check(check(
+			newModule("net", "modules/network/vpc", map[string]cty.Value{"enable_internal_traffic": cty.False}),
+			controller),
+			ErrorMatches, `.*Slurm daemons traffic of module "ctrl" would be blocked by firewall, no rule allows tcp port 6817.*`)
+	}
+
+	{ // FAIL: SSH from IAP is disabled
+		c.Check(check(
+			newModule("net", "modules/network/vpc", map[string]cty.Value{"enable_iap_ssh_ingress": cty.False}),
+			vm),
+			ErrorMatches, `.*SSH from IAP traffic of module "vm" would be blocked.*`)
+	}
+
+	{ // FAIL: rule is open to the internet
+		c.Check(check(
+			newModule("fw", "modules/network/firewall-rules", map[string]cty.Value{
+				"ingress_rules": cty.TupleVal([]cty.Value{rule("ssh", "0.0.0.0/0", "22")})}),
+			vm),
+			ErrorMatches, `.*firewall rule "ssh" admits traffic from any address.*`)
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	_ "embed"
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/logging"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"golang.org/x/exp/slices"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed gpu_compatibility.yaml
+var gpuCompatibilityYaml []byte
+
+type gpuGeneration struct {
+	Generation   string
+	Accelerators []string
+	MachineTypes []string `yaml:"machine_types"`
+	MinCuda      string   `yaml:"min_cuda"`
+}
+
+type gpuImage struct {
+	Family      string
+	Cuda        string
+	Driver      string
+	NoDriver    bool `yaml:"no_driver"`
+	Description string
+}
+
+// gpuNetworking are networking prerequisites of a machine type, see test_gpu_networking
+type gpuNetworking struct {
+	MachineType       string `yaml:"machine_type"`
+	Description       string
+	HostNics          int      `yaml:"host_nics"`
+	GpuNics           int      `yaml:"gpu_nics"`
+	GpuNicType        string   `yaml:"gpu_nic_type"`
+	UnsupportedImages []string `yaml:"unsupported_images"`
+}
+
+// gpuCompatibility is the compatibility table shipped in gpu_compatibility.yaml
+type gpuCompatibility struct {
+	Gpus       []gpuGeneration
+	Drivers    map[string]string
+	Images     []gpuImage
+	Networking []gpuNetworking
+}
+
+func loadGpuCompatibility() (gpuCompatibility, error) {
+	var t gpuCompatibility
+	if err := yaml.Unmarshal(gpuCompatibilityYaml, &t); err != nil {
+		return t, fmt.Errorf("malformed GPU compatibility table: %w", err)
+	}
+	return t, nil
+}
+
+// generations returns GPU generations attached to instances created by the module,
+// as set by `guest_accelerator` and `machine_type` settings.
+func (t gpuCompatibility) generations(bp config.Blueprint, m config.Module) []gpuGeneration {
+	types := []string{}
+	if m.Settings.Has("guest_accelerator") {
+		if ga, err := bp.Eval(m.Settings.Get("guest_accelerator")); err == nil {
+			cty.Walk(ga, func(cp cty.Path, v cty.Value) (bool, error) {
+				if len(cp) == 0 || !v.IsKnown() || v.IsNull() || v.Type() != cty.String {
+					return true, nil
+				}
+				if s, ok := cp[len(cp)-1].(cty.GetAttrStep); ok && s.Name == "type" {
+					types = append(types, v.AsString())
+				}
+				return true, nil
+			})
+		}
+	}
+	machineType, _ := evalStringSetting(bp, m, "machine_type")
+
+	res := []gpuGeneration{}
+	for _, g := range t.Gpus {
+		attached := slices.ContainsFunc(types, func(s string) bool { return slices.Contains(g.Accelerators, s) })
+		for _, p := range g.MachineTypes {
+			attached = attached || (machineType != "" && strings.HasPrefix(machineType, p))
+		}
+		if attached {
+			res = append(res, g)
+		}
+	}
+	return res
+}
+
+// imageCuda returns the row of the image family with resolved CUDA and driver versions,
+// returns false if the family is not in the table
+func (t gpuCompatibility) imageCuda(family string) (gpuImage, bool, error) {
+	for _, im := range t.Images {
+		re, err := regexp.Compile(im.Family)
+		if err != nil {
+			return gpuImage{}, false, fmt.Errorf("malformed GPU compatibility table, family %q: %w", im.Family, err)
+		}
+		mt := re.FindStringSubmatch(family)
+		if mt == nil {
+			continue
+		}
+		major, minor := re.SubexpIndex("major"), re.SubexpIndex("minor")
+		if major >= 0 && minor >= 0 {
+			im.Cuda = fmt.Sprintf("%s.%s", mt[major], mt[minor])
+		}
+		if im.Driver == "" && !im.NoDriver {
+			im.Driver = t.Drivers[im.Cuda]
+		}
+		return im, im.Cuda != "" || im.NoDriver, nil
+	}
+	return gpuImage{}, false, nil
+}
+
+var containerCudaRe = regexp.MustCompile(`cuda[^0-9.]?([0-9]+)\.([0-9]+)`)
+
+// containerCuda returns CUDA version required by the container image, as
+// indicated by its name or tag, e.g. nvidia/cuda:12.2.0-base-ubuntu22.04
+func containerCuda(image string) (string, bool) {
+	mt := containerCudaRe.FindStringSubmatch(strings.ToLower(image))
+	if mt == nil {
+		return "", false
+	}
+	return fmt.Sprintf("%s.%s", mt[1], mt[2]), true
+}
+
+// evalStringSetting returns value of the setting if it is set and evaluates to a string
+func evalStringSetting(bp config.Blueprint, m config.Module, name string) (string, bool) {
+	if !m.Settings.Has(name) {
+		return "", false
+	}
+	v, err := bp.Eval(m.Settings.Get(name))
+	if err != nil || !v.IsKnown() || v.IsNull() || v.Type() != cty.String {
+		return "", false
+	}
+	return v.AsString(), true
+}
+
+// isEnabledSetting tests whether the setting is set to true, a non-empty string or a positive number
+func isEnabledSetting(bp config.Blueprint, m config.Module, name string) bool {
+	if !m.Settings.Has(name) {
+		return false
+	}
+	v, err := bp.Eval(m.Settings.Get(name))
+	if err != nil || !v.IsKnown() || v.IsNull() {
+		return false
+	}
+	switch v.Type() {
+	case cty.Bool:
+		return v.True()
+	case cty.String:
+		return v.AsString() != ""
+	case cty.Number:
+		return v.AsBigFloat().Sign() > 0
+	}
+	return false
+}
+
+// imageFamily returns family of the `instance_image` setting
+func imageFamily(bp config.Blueprint, m config.Module) (string, bool) {
+	if !m.Settings.Has("instance_image") {
+		return "", false
+	}
+	v, err := bp.Eval(m.Settings.Get("instance_image"))
+	if err != nil || !v.IsWhollyKnown() || v.IsNull() {
+		return "", false
+	}
+	if v, err = convert.Convert(v, cty.Map(cty.String)); err != nil {
+		return "", false
+	}
+	f, ok := v.AsValueMap()["family"]
+	if !ok || f.IsNull() {
+		return "", false
+	}
+	return f.AsString(), true
+}
+
+func versionLess(a string, b string) bool {
+	va, errA := version.NewVersion(a)
+	vb, errB := version.NewVersion(b)
+	if errA != nil || errB != nil {
+		return false // can not compare, do not report
+	}
+	return va.LessThan(vb)
+}
+
+func testGpuImageCompatible(bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{}); err != nil {
+		return err
+	}
+	t, err := loadGpuCompatibility()
+	if err != nil {
+		return err
+	}
+
+	errs := config.Errors{}
+	bp.WalkModulesSafe(func(p config.ModulePath, m *config.Module) {
+		gens := t.generations(bp, *m)
+		family, ok := imageFamily(bp, *m)
+		if len(gens) == 0 || !ok {
+			return
+		}
+		im, known, err := t.imageCuda(family)
+		if err != nil {
+			errs.Add(err)
+			return
+		}
+		if !known {
+			return // image is not in the table
+		}
+		ip := p.Settings.Dot("instance_image")
+		if im.NoDriver {
+			logging.Warn(logging.Warning{
+				Source:   "validation",
+				Location: fmt.Sprintf("module %s", m.ID),
+				Message:  fmt.Sprintf("image family %q of module %q does not provide an NVIDIA driver for its GPUs", family, m.ID),
+				Hint:     "install the driver, e.g. with a startup script, or use an image family that provides it",
+			})
+			return
+		}
+		cuda := im.Cuda
+
+		for _, g := range gens {
+			if versionLess(cuda, g.MinCuda) {
+				errs.At(ip, config.HintError{
+					Hint: fmt.Sprintf("use an image family with CUDA %s or newer", g.MinCuda),
+					Err: fmt.Errorf("image family %q of module %q provides CUDA %s, but %s GPUs require CUDA %s or newer",
+						family, m.ID, cuda, g.Generation, g.MinCuda)})
+			}
+		}
+
+		keys := m.Settings.Keys()
+		slices.Sort(keys)
+		for _, k := range keys {
+			if !strings.HasSuffix(k, "docker_image") && !strings.HasSuffix(k, "container_image") {
+				continue
+			}
+			image, ok := evalStringSetting(bp, *m, k)
+			if !ok {
+				continue
+			}
+			req, ok := containerCuda(image)
+			if !ok {
+				continue
+			}
+			hint := "use an image family with a newer CUDA version or an older container image"
+			driver, ok := t.Drivers[req]
+			if ok {
+				hint = fmt.Sprintf("use an image family with NVIDIA driver %s or newer, or an older container image", driver)
+			}
+			// containers bring their CUDA runtime, the driver of the image is what matters
+			satisfied := !versionLess(cuda, req)
+			if ok && im.Driver != "" {
+				satisfied = !versionLess(im.Driver, driver)
+			}
+			if satisfied {
+				continue
+			}
+			provides := fmt.Sprintf("CUDA %s", cuda)
+			if im.Driver != "" {
+				provides += fmt.Sprintf(" with NVIDIA driver %s", im.Driver)
+			}
+			errs.At(p.Settings.Dot(k), config.HintError{
+				Hint: hint,
+				Err: fmt.Errorf("container image %q of module %q requires CUDA %s, but image family %q provides %s",
+					image, m.ID, req, family, provides)})
+		}
+	})
+	return errs.OrNil()
+}
@@ -0,0 +1,192 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"regexp"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+const gvnic = "GVNIC"
+
+// nicSettings are settings listing network interfaces of VMs, and whether the
+// primary interface is included in the list
+var nicSettings = []struct {
+	name        string
+	withPrimary bool
+}{
+	{"additional_networks", false}, // Slurm node groups and nodesets
+	{"network_interfaces", true},   // vm-instance
+}
+
+// gpuNic is a network interface set in the blueprint, with unknown or unset fields empty
+type gpuNic struct {
+	nicType string
+	network string // subnetwork, or network if subnetwork is not set
+}
+
+func evalNics(v cty.Value) ([]gpuNic, bool) {
+	if !v.IsKnown() || v.IsNull() || !v.CanIterateElements() {
+		return nil, false
+	}
+	nics := []gpuNic{}
+	for it := v.ElementIterator(); it.Next(); {
+		_, e := it.Element()
+		if !e.IsKnown() || e.IsNull() || !(e.Type().IsObjectType() || e.Type().IsMapType()) {
+			return nil, false
+		}
+		attr := func(name string) string {
+			var a cty.Value
+			switch {
+			case e.Type().IsObjectType() && e.Type().HasAttribute(name):
+				a = e.GetAttr(name)
+			case e.Type().IsMapType() && e.HasIndex(cty.StringVal(name)).True():
+				a = e.Index(cty.StringVal(name))
+			default:
+				return ""
+			}
+			if !a.IsKnown() || a.IsNull() || a.Type() != cty.String {
+				return ""
+			}
+			return a.AsString()
+		}
+		n := gpuNic{nicType: strings.ToUpper(attr("nic_type")), network: attr("subnetwork")}
+		if n.network == "" {
+			n.network = attr("network")
+		}
+		nics = append(nics, n)
+	}
+	return nics, true
+}
+
+func (t gpuCompatibility) networking(machineType string) (gpuNetworking, bool) {
+	for _, n := range t.Networking {
+		if n.MachineType == machineType {
+			return n, true
+		}
+	}
+	return gpuNetworking{}, false
+}
+
+// checkNics validates network interfaces of the module against prerequisites of the machine type
+func checkNics(errs *config.Errors, p config.ModulePath, m config.Module, req gpuNetworking, bp config.Blueprint) {
+	total := req.HostNics + req.GpuNics
+	allowed := gvnic
+	if req.GpuNicType != gvnic {
+		allowed = fmt.Sprintf("%s or %s", gvnic, req.GpuNicType)
+	}
+	hint := fmt.Sprintf("%s requires %d gVNIC interface(s) and %d %s interfaces for GPU networking, each in a distinct VPC network",
+		req.Description, req.HostNics, req.GpuNics, req.GpuNicType)
+
+	for _, s := range nicSettings {
+		if !m.Settings.Has(s.name) {
+			continue
+		}
+		sp := p.Settings.Dot(s.name)
+		v, err := bp.Eval(m.Settings.Get(s.name))
+		if err != nil {
+			continue
+		}
+		nics, ok := evalNics(v)
+		if !ok {
+			continue // set by a module output, can not be checked
+		}
+		got := len(nics)
+		if !s.withPrimary {
+			got++
+		}
+		if got != total {
+			errs.At(sp, config.HintError{Hint: hint,
+				Err: fmt.Errorf("machine type %s of module %q requires %d network interfaces, got %d", req.MachineType, m.ID, total, got)})
+		}
+
+		gpuNics, seen := 0, map[string]int{}
+		for i, n := range nics {
+			np := sp.Cty(cty.Path{}.IndexInt(i))
+			switch {
+			case n.nicType == req.GpuNicType:
+				gpuNics++
+			case n.nicType != gvnic:
+				errs.At(np, config.HintError{Hint: hint,
+					Err: fmt.Errorf("nic_type of network interface %d of module %q must be %s, got %q", i, m.ID, allowed, n.nicType)})
+			}
+			if n.network == "" {
+				continue
+			}
+			if j, ok := seen[n.network]; ok {
+				errs.At(np, config.HintError{Hint: hint,
+					Err: fmt.Errorf("network interfaces %d and %d of module %q are attached to the same network %q", j, i, m.ID, n.network)})
+			}
+			seen[n.network] = i
+		}
+		if req.GpuNicType != gvnic && gpuNics != req.GpuNics && got == total {
+			errs.At(sp, config.HintError{Hint: hint,
+				Err: fmt.Errorf("machine type %s of module %q requires %d %s interfaces, got %d", req.MachineType, m.ID, req.GpuNics, req.GpuNicType, gpuNics)})
+		}
+	}
+}
+
+func testGpuNetworking(bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{}); err != nil {
+		return err
+	}
+	t, err := loadGpuCompatibility()
+	if err != nil {
+		return err
+	}
+
+	errs := config.Errors{}
+	bp.WalkModulesSafe(func(p config.ModulePath, m *config.Module) {
+		machineType, ok := evalStringSetting(bp, *m, "machine_type")
+		if !ok {
+			return
+		}
+		req, ok := t.networking(machineType)
+		if !ok {
+			return
+		}
+
+		checkNics(&errs, p, *m, req, bp)
+
+		if tier, ok := evalStringSetting(bp, *m, "bandwidth_tier"); ok && tier != "gvnic_enabled" && tier != "tier_1_enabled" {
+			errs.At(p.Settings.Dot("bandwidth_tier"), config.HintError{
+				Hint: "set bandwidth_tier to gvnic_enabled or tier_1_enabled",
+				Err:  fmt.Errorf("machine type %s of module %q requires gVNIC, but bandwidth_tier is %q", machineType, m.ID, tier)})
+		}
+
+		family, ok := imageFamily(bp, *m)
+		if !ok {
+			return
+		}
+		for _, u := range req.UnsupportedImages {
+			re, err := regexp.Compile(u)
+			if err != nil {
+				errs.Add(fmt.Errorf("malformed GPU compatibility table, image %q: %w", u, err))
+				return
+			}
+			if re.MatchString(family) {
+				errs.At(p.Settings.Dot("instance_image"), config.HintError{
+					Hint: fmt.Sprintf("%s requires an image with drivers for %s NICs, e.g. a Deep Learning VM or Ubuntu 22.04 image", req.Description, req.GpuNicType),
+					Err:  fmt.Errorf("image family %q of module %q does not support networking of machine type %s", family, m.ID, machineType)})
+				return
+			}
+		}
+	})
+	return errs.OrNil()
+}
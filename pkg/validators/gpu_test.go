@@ -0,0 +1,267 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/logging"
+	"regexp"
+
+	"github.com/zclconf/go-cty/cty"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestGpuCompatibilityTable(c *C) {
+	t, err := loadGpuCompatibility()
+	c.Assert(err, IsNil)
+	for _, g := range t.Gpus {
+		_, ok := t.Drivers[g.MinCuda]
+		c.Check(ok, Equals, true, Commentf("no driver for CUDA %s of %s", g.MinCuda, g.Generation))
+	}
+	for _, im := range t.Images {
+		_, err := regexp.Compile(im.Family)
+		c.Check(err, IsNil, Commentf(im.Family))
+		if im.Driver != "" {
+			c.Check(versionLess(im.Driver, t.Drivers[im.Cuda]), Equals, false, Commentf(im.Family))
+		}
+	}
+
+	// image families of example blueprints
+	for family, want := range map[string]gpuImage{
+		"common-cu121-debian-11":          {Cuda: "12.1", Driver: "530.30.02"},
+		"common-cu118-debian-11":          {Cuda: "11.8", Driver: "520.61.05"},
+		"slurm-gcp-6-4-hpc-rocky-linux-8": {Cuda: "12.1", Driver: "530.30.02"},
+		"slurm-gcp-6-4-debian-11":         {Cuda: "12.1", Driver: "530.30.02"},
+		"slurm-gcp-6-4-ubuntu-2004-lts":   {Cuda: "12.1", Driver: "530.30.02"},
+		"slurm-gcp-5-10-hpc-centos-7":     {Cuda: "12.1", Driver: "530.30.02"},
+		"slurm-gcp-5-10-debian-11":        {Cuda: "12.1", Driver: "530.30.02"},
+		"slurm-gcp-5-10-ubuntu-2004-lts":  {Cuda: "12.1", Driver: "530.30.02"},
+		"ml-slurm":                        {Cuda: "12.1", Driver: "530.30.02"},
+		"hpc-rocky-linux-8":               {NoDriver: true},
+	} {
+		im, known, err := t.imageCuda(family)
+		c.Check(err, IsNil)
+		c.Check(known, Equals, true, Commentf(family))
+		c.Check([]any{im.Cuda, im.Driver, im.NoDriver}, DeepEquals, []any{want.Cuda, want.Driver, want.NoDriver}, Commentf(family))
+	}
+	for _, f := range []string{"rocky-linux-8", "my-custom-slurm", "slurm-dlvm", "slurm-gcp-5-9-debian-11"} {
+		_, known, err := t.imageCuda(f)
+		c.Check(err, IsNil)
+		c.Check(known, Equals, false, Commentf(f))
+	}
+
+	for _, n := range t.Networking {
+		for _, u := range n.UnsupportedImages {
+			_, err := regexp.Compile(u)
+			c.Check(err, IsNil, Commentf("image %q of %s", u, n.MachineType))
+		}
+		c.Check(n.HostNics > 0 && n.GpuNics > 0, Equals, true, Commentf(n.MachineType))
+	}
+}
+
+func (s *MySuite) TestContainerCuda(c *C) {
+	for image, want := range map[string]string{
+		"nvcr.io/nvidia/cuda:12.2.0-base-ubuntu22.04":   "12.2",
+		"pytorch/pytorch:2.1.0-cuda12.1-cudnn8-runtime": "12.1",
+		"us-docker.pkg.dev/p/r/trainer:CUDA11.8":        "11.8",
+		"nvcr.io/nvidia/pytorch:24.01-py3":              "",
+	} {
+		got, ok := containerCuda(image)
+		c.Check(ok, Equals, want != "", Commentf(image))
+		c.Check(got, Equals, want, Commentf(image))
+	}
+}
+
+func (s *MySuite) TestGpuImageCompatible(c *C) {
+	image := func(family string) cty.Value {
+		return cty.ObjectVal(map[string]cty.Value{
+			"family":  cty.StringVal(family),
+			"project": cty.StringVal("deeplearning-platform-release")})
+	}
+	accel := func(t string) cty.Value {
+		return cty.ListVal([]cty.Value{cty.ObjectVal(map[string]cty.Value{
+			"type": cty.StringVal(t), "count": cty.NumberIntVal(1)})})
+	}
+	check := func(settings map[string]cty.Value) error {
+		bp := config.Blueprint{Groups: []config.Group{{Name: "g", Modules: []config.Module{
+			{ID: "gpu", Settings: config.NewDict(settings)}}}}}
+		return testGpuImageCompatible(bp, config.Dict{})
+	}
+
+	{ // OK: A100 with CUDA 11.3
+		c.Check(check(map[string]cty.Value{
+			"machine_type":   cty.StringVal("a2-highgpu-1g"),
+			"instance_image": image("common-cu113-debian-11")}), IsNil)
+	}
+
+	{ // FAIL: H100 with CUDA 11.3
+		c.Check(check(map[string]cty.Value{
+			"machine_type":   cty.StringVal("a3-highgpu-8g"),
+			"instance_image": image("common-cu113-debian-11")}),
+			ErrorMatches, `.*provides CUDA 11.3, but Hopper GPUs require CUDA 11.8 or newer .*`)
+	}
+
+	{ // FAIL: L4 attached as accelerator
+		c.Check(check(map[string]cty.Value{
+			"guest_accelerator": accel("nvidia-l4"),
+			"instance_image":    image("common-cu113-debian-11")}),
+			ErrorMatches, `.*Ada Lovelace GPUs require CUDA 11.8 or newer .*`)
+	}
+
+	{ // OK: no GPUs or unknown image
+		c.Check(check(map[string]cty.Value{
+			"machine_type":   cty.StringVal("n2-standard-2"),
+			"instance_image": image("common-cu113-debian-11")}), IsNil)
+		c.Check(check(map[string]cty.Value{
+			"machine_type":   cty.StringVal("a3-highgpu-8g"),
+			"instance_image": image("my-custom-slurm")}), IsNil)
+	}
+
+	{ // OK: Slurm images provide CUDA 12.1
+		c.Check(check(map[string]cty.Value{
+			"machine_type":   cty.StringVal("a3-highgpu-8g"),
+			"instance_image": image("slurm-gcp-6-4-hpc-rocky-linux-8")}), IsNil)
+		c.Check(check(map[string]cty.Value{
+			"guest_accelerator": accel("nvidia-l4"),
+			"instance_image":    image("ml-slurm"),
+			"docker_image":      cty.StringVal("nvcr.io/nvidia/cuda:12.1.0-base-ubuntu22.04")}), IsNil)
+	}
+
+	{ // FAIL: container requires newer driver than the Slurm image provides
+		err := check(map[string]cty.Value{
+			"machine_type":   cty.StringVal("a2-highgpu-1g"),
+			"instance_image": image("slurm-gcp-5-10-debian-11"),
+			"docker_image":   cty.StringVal("nvcr.io/nvidia/cuda:12.4.1-base-ubuntu22.04")})
+		c.Check(err, ErrorMatches, `(?s).*provides CUDA 12.1 with NVIDIA driver 530.30.02.*driver 550.54.14 or newer.*`)
+	}
+
+	{ // WARN: HPC VM image has no driver
+		logging.ResetWarnings()
+		defer logging.ResetWarnings()
+		c.Check(check(map[string]cty.Value{
+			"machine_type":   cty.StringVal("g2-standard-4"),
+			"instance_image": image("hpc-rocky-linux-8")}), IsNil)
+		c.Check(logging.Warnings(), HasLen, 1)
+	}
+
+	{ // FAIL: container requires newer CUDA
+		err := check(map[string]cty.Value{
+			"guest_accelerator": accel("nvidia-tesla-t4"),
+			"instance_image":    image("common-cu118-debian-11"),
+			"docker_image":      cty.StringVal("nvcr.io/nvidia/cuda:12.2.0-base-ubuntu22.04")})
+		c.Check(err, ErrorMatches, `.*requires CUDA 12.2, but image family "common-cu118-debian-11" provides CUDA 11.8 .*`)
+		c.Check(err, ErrorMatches, `(?s).*driver 535.54.03 or newer.*`)
+	}
+}
+
+func (s *MySuite) TestGpuNetworking(c *C) {
+	nic := func(subnet string, nicType string) cty.Value {
+		return cty.ObjectVal(map[string]cty.Value{
+			"subnetwork": cty.StringVal(subnet),
+			"nic_type":   cty.StringVal(nicType)})
+	}
+	nics := func(n int, nicType string) cty.Value {
+		vs := []cty.Value{}
+		for i := 0; i < n; i++ {
+			vs = append(vs, nic(fmt.Sprintf("gpunet%d", i), nicType))
+		}
+		return cty.TupleVal(vs)
+	}
+	check := func(settings map[string]cty.Value) error {
+		bp := config.Blueprint{Groups: []config.Group{{Name: "g", Modules: []config.Module{
+			{ID: "ng", Settings: config.NewDict(settings)}}}}}
+		return testGpuNetworking(bp, config.Dict{})
+	}
+
+	{ // OK: A3 High with 4 additional networks
+		c.Check(check(map[string]cty.Value{
+			"machine_type":        cty.StringVal("a3-highgpu-8g"),
+			"bandwidth_tier":      cty.StringVal("gvnic_enabled"),
+			"additional_networks": nics(4, "GVNIC")}), IsNil)
+	}
+
+	{ // OK: not an A3 machine type
+		c.Check(check(map[string]cty.Value{
+			"machine_type":        cty.StringVal("a3-highgpu-1g"),
+			"additional_networks": nics(1, "VIRTIO_NET")}), IsNil)
+	}
+
+	{ // OK: network interfaces are set by a module output
+		c.Check(check(map[string]cty.Value{
+			"machine_type":        cty.StringVal("a3-megagpu-8g"),
+			"additional_networks": config.MustParseExpression(`module.net.additional_networks`).AsValue()}), IsNil)
+	}
+
+	{ // FAIL: A3 Mega with 4 additional networks
+		c.Check(check(map[string]cty.Value{
+			"machine_type":        cty.StringVal("a3-megagpu-8g"),
+			"additional_networks": nics(4, "GVNIC")}),
+			ErrorMatches, `.*requires 9 network interfaces, got 5.*`)
+	}
+
+	{ // FAIL: vm-instance interfaces include primary, VIRTIO_NET and shared network
+		vs := nics(5, "GVNIC").AsValueSlice()
+		vs[2] = nic("gpunet2", "VIRTIO_NET")
+		vs[3] = nic("gpunet0", "GVNIC")
+		err := check(map[string]cty.Value{
+			"machine_type":       cty.StringVal("a3-highgpu-8g"),
+			"network_interfaces": cty.TupleVal(vs)})
+		c.Check(err, ErrorMatches, `(?s).*nic_type of network interface 2 of module "ng" must be GVNIC, got "VIRTIO_NET".*`)
+		c.Check(err, ErrorMatches, `(?s).*network interfaces 0 and 3 of module "ng" are attached to the same network "gpunet0".*`)
+	}
+
+	{ // FAIL: A3 Ultra without RDMA interfaces
+		c.Check(check(map[string]cty.Value{
+			"machine_type":        cty.StringVal("a3-ultragpu-8g"),
+			"additional_networks": nics(9, "GVNIC")}),
+			ErrorMatches, `.*requires 8 MRDMA interfaces, got 0.*`)
+	}
+
+	{ // FAIL: gVNIC is disabled and image lacks drivers
+		err := check(map[string]cty.Value{
+			"machine_type":   cty.StringVal("a3-highgpu-8g"),
+			"bandwidth_tier": cty.StringVal("not_enabled"),
+			"instance_image": cty.ObjectVal(map[string]cty.Value{
+				"family":  cty.StringVal("hpc-centos-7"),
+				"project": cty.StringVal("cloud-hpc-image-public")})})
+		c.Check(err, ErrorMatches, `(?s).*requires gVNIC, but bandwidth_tier is "not_enabled".*`)
+		c.Check(err, ErrorMatches, `(?s).*image family "hpc-centos-7" of module "ng" does not support networking.*`)
+	}
+}
+
+func (s *MySuite) TestModuleAccelerators(c *C) {
+	ga := func(typ string, count int64) cty.Value {
+		return cty.ObjectVal(map[string]cty.Value{
+			"type":  cty.StringVal(typ),
+			"count": cty.NumberIntVal(count)})
+	}
+	check := func(settings map[string]cty.Value) map[int]accelerator {
+		m := config.Module{ID: "m", Settings: config.NewDict(settings)}
+		bp := config.Blueprint{Groups: []config.Group{{Name: "g", Modules: []config.Module{m}}}}
+		return moduleAccelerators(bp, m)
+	}
+
+	c.Check(check(nil), DeepEquals, map[int]accelerator{})
+	c.Check(check(map[string]cty.Value{
+		"guest_accelerator": cty.TupleVal([]cty.Value{
+			ga("nvidia-l4", 1),
+			cty.ObjectVal(map[string]cty.Value{"type": cty.StringVal("nvidia-t4")}),
+			ga("nvidia-tesla-a100", 16)})}),
+		DeepEquals, map[int]accelerator{0: {"nvidia-l4", 1}, 2: {"nvidia-tesla-a100", 16}})
+	c.Check(check(map[string]cty.Value{
+		"guest_accelerator": config.MustParseExpression(`module.gpu.guest_accelerator`).AsValue()}),
+		DeepEquals, map[int]accelerator{})
+}
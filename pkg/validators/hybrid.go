@@ -0,0 +1,214 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"net"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// defaultNetworkRange is the default `network_address_range` of the vpc module
+const defaultNetworkRange = "10.0.0.0/9"
+
+// hostnameRe matches host names that consist of RFC 1123 labels
+var hostnameRe = regexp.MustCompile(`^(?i)[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)*\.?$`)
+
+func isHybridSlurm(m config.Module) bool {
+	return strings.Contains(m.Source, "schedmd-slurm-gcp-v5-hybrid")
+}
+
+// isValidPort tests whether s is a port or a range of ports, e.g. "6820-6830"
+func isValidPort(s string) bool {
+	lo, hi, isRange := strings.Cut(s, "-")
+	l, errL := strconv.Atoi(lo)
+	if errL != nil || l < 1 || l > 65535 {
+		return false
+	}
+	if !isRange {
+		return true
+	}
+	h, errH := strconv.Atoi(hi)
+	return errH == nil && l <= h && h <= 65535
+}
+
+// vpcRanges returns address ranges of subnetworks created by the vpc module.
+// Returns false if they are not known.
+func vpcRanges(bp config.Blueprint, m config.Module) ([]string, bool) {
+	subnets, ok := evalSetting(bp, m, "subnetworks", cty.NullVal(cty.DynamicPseudoType))
+	if !ok {
+		return nil, false
+	}
+	ranges := []string{}
+	if !subnets.IsNull() && subnets.CanIterateElements() {
+		for it := subnets.ElementIterator(); it.Next(); {
+			_, s := it.Element()
+			if s.IsNull() || !s.Type().IsObjectType() || !s.Type().HasAttribute("subnet_ip") {
+				continue
+			}
+			if ip := s.GetAttr("subnet_ip"); !ip.IsNull() && ip.Type() == cty.String {
+				ranges = append(ranges, ip.AsString())
+			}
+		}
+	}
+	if len(ranges) > 0 {
+		return ranges, true
+	}
+	// subnetworks are carved out of the network range
+	r, ok := evalSetting(bp, m, "network_address_range", cty.StringVal(defaultNetworkRange))
+	if !ok || r.IsNull() || r.Type() != cty.String {
+		return nil, false
+	}
+	return []string{r.AsString()}, true
+}
+
+// checkHybridController checks format of the on-premise controller address of the hybrid module
+func checkHybridController(bp config.Blueprint, p config.ModulePath, m config.Module, hasDNS bool) (net.IP, error) {
+	errs := config.Errors{}
+	host, hostKnown := evalStringSetting(bp, m, "slurm_control_host")
+	if hostKnown && (!hostnameRe.MatchString(host) || net.ParseIP(host) != nil) {
+		errs.At(p.Settings.Dot("slurm_control_host"), config.HintError{
+			Hint: "set it to the name returned by `hostname -s` on the on-premise controller, and its IP address to `slurm_control_addr`",
+			Err:  fmt.Errorf("slurm_control_host of module %q must be a host name, got %q", m.ID, host)})
+	}
+
+	var ip net.IP
+	if addr, ok := evalStringSetting(bp, m, "slurm_control_addr"); ok {
+		if ip = net.ParseIP(addr); ip == nil && !hostnameRe.MatchString(addr) {
+			errs.At(p.Settings.Dot("slurm_control_addr"), fmt.Errorf(
+				"slurm_control_addr of module %q must be an IP address or a host name, got %q", m.ID, addr))
+		}
+		if ip != nil && (ip.IsLoopback() || ip.IsUnspecified()) {
+			errs.At(p.Settings.Dot("slurm_control_addr"), fmt.Errorf(
+				"slurm_control_addr of module %q must be an address reachable from Google Cloud, got %q", m.ID, addr))
+		}
+	} else if !m.Settings.Has("slurm_control_addr") && hostKnown && !hasDNS {
+		errs.At(p.Settings.Dot("slurm_control_host"), config.HintError{
+			Hint: "set `slurm_control_addr` to the IP address of the controller, or configure DNS forwarding (e.g. with Cloud DNS) to on-premise name servers",
+			Err:  fmt.Errorf("cloud nodes of module %q must resolve controller host name %q, but slurm_control_addr is not set and the blueprint configures no DNS", m.ID, host)})
+	}
+
+	if port, ok := evalStringSetting(bp, m, "slurm_control_host_port"); ok && !isValidPort(port) {
+		errs.At(p.Settings.Dot("slurm_control_host_port"), fmt.Errorf(
+			"slurm_control_host_port of module %q must be a port number or a range of ports, got %q", m.ID, port))
+	}
+	return ip, errs.OrNil()
+}
+
+// checkMungeMount checks that cloud nodes can acquire the munge key of the on-premise cluster
+func checkMungeMount(bp config.Blueprint, p config.ModulePath, m config.Module) error {
+	v, ok := evalSetting(bp, m, "munge_mount", cty.NullVal(cty.DynamicPseudoType))
+	if !ok || v.IsNull() || !v.Type().IsObjectType() {
+		return nil
+	}
+	mp := p.Settings.Dot("munge_mount")
+	attr := func(name string) (string, bool) {
+		if !v.Type().HasAttribute(name) {
+			return "", false
+		}
+		a := v.GetAttr(name)
+		if a.IsNull() || a.Type() != cty.String {
+			return "", false
+		}
+		return a.AsString(), true
+	}
+
+	errs := config.Errors{}
+	if ip, ok := attr("server_ip"); ok && net.ParseIP(ip) == nil && !hostnameRe.MatchString(ip) {
+		errs.At(mp.Cty(cty.GetAttrPath("server_ip")), fmt.Errorf("munge_mount.server_ip of module %q must be an IP address or a host name, got %q", m.ID, ip))
+	}
+	if rm, ok := attr("remote_mount"); !ok || !path.IsAbs(rm) {
+		errs.At(mp.Cty(cty.GetAttrPath("remote_mount")), config.HintError{
+			Hint: "set it to the directory of the on-premise controller that contains munge.key, e.g. \"/etc/munge/\"",
+			Err:  fmt.Errorf("munge_mount.remote_mount of module %q must be an absolute path, got %q", m.ID, rm)})
+	}
+	if fs, ok := attr("fs_type"); ok && fs != "nfs" && fs != "cifs" && fs != "lustre" && fs != "gcsfuse" {
+		errs.At(mp.Cty(cty.GetAttrPath("fs_type")), fmt.Errorf("munge_mount.fs_type of module %q must be one of nfs, cifs, lustre or gcsfuse, got %q", m.ID, fs))
+	}
+	return errs.OrNil()
+}
+
+func testHybridSlurm(bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{}); err != nil {
+		return err
+	}
+
+	type modAt struct {
+		p config.ModulePath
+		m config.Module
+	}
+	hybrids, vpcs := []modAt{}, []modAt{}
+	networks := 0
+	hasVPN, hasDNS := false, false
+	bp.WalkModulesSafe(func(p config.ModulePath, m *config.Module) {
+		src := strings.ToLower(m.Source)
+		switch {
+		case isHybridSlurm(*m):
+			hybrids = append(hybrids, modAt{p, *m})
+		case strings.HasSuffix(src, "network/vpc"):
+			networks++
+			vpcs = append(vpcs, modAt{p, *m})
+		case strings.HasSuffix(src, "network/pre-existing-vpc"):
+			networks++
+		}
+		hasVPN = hasVPN || strings.Contains(src, "vpn") || strings.Contains(src, "interconnect")
+		hasDNS = hasDNS || strings.Contains(src, "dns")
+	})
+	if len(hybrids) == 0 {
+		return nil
+	}
+
+	errs := config.Errors{}
+	for _, h := range hybrids {
+		p, m := h.p, h.m
+		ip, err := checkHybridController(bp, p, m, hasDNS)
+		errs.Add(err)
+		errs.Add(checkMungeMount(bp, p, m))
+
+		if networks == 0 {
+			errs.At(p, config.HintError{
+				Hint: "add a `modules/network/pre-existing-vpc` module for the network connected to the on-premise cluster",
+				Err:  fmt.Errorf("hybrid module %q requires a network connected to the on-premise cluster, but the blueprint has no network module", m.ID)})
+		}
+		if len(vpcs) > 0 && !hasVPN {
+			errs.At(vpcs[0].p, config.HintError{
+				Hint: "use `modules/network/pre-existing-vpc` for a network connected to the on-premise cluster, or add a VPN or Interconnect module",
+				Err:  fmt.Errorf("network created by module %q has no route to the on-premise controller of hybrid module %q", vpcs[0].m.ID, m.ID)})
+		}
+		if ip == nil {
+			continue
+		}
+		for _, v := range vpcs {
+			ranges, ok := vpcRanges(bp, v.m)
+			if !ok {
+				continue
+			}
+			for _, r := range ranges {
+				if _, cidr, err := net.ParseCIDR(r); err == nil && cidr.Contains(ip) {
+					errs.At(v.p, config.HintError{
+						Hint: "choose address ranges of cloud subnetworks that do not overlap with the on-premise network",
+						Err:  fmt.Errorf("on-premise controller address %s of module %q is within range %s of network module %q", ip, m.ID, r, v.m.ID)})
+				}
+			}
+		}
+	}
+	return errs.OrNil()
+}
@@ -0,0 +1,102 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"hpc-toolkit/pkg/config"
+
+	"github.com/zclconf/go-cty/cty"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestIsValidPort(c *C) {
+	for port, want := range map[string]bool{
+		"6817": true, "6820-6830": true, "0": false, "70000": false, "6830-6820": false, "slurm": false} {
+		c.Check(isValidPort(port), Equals, want, Commentf(port))
+	}
+}
+
+func (s *MySuite) TestHybridSlurm(c *C) {
+	hybrid := func(settings map[string]cty.Value) config.Module {
+		return newModule("hybrid", "community/modules/scheduler/schedmd-slurm-gcp-v5-hybrid", settings)
+	}
+	ctrl := map[string]cty.Value{
+		"slurm_control_host": cty.StringVal("ctrl"),
+		"slurm_control_addr": cty.StringVal("192.168.1.10")}
+	with := func(kv map[string]cty.Value) map[string]cty.Value {
+		res := map[string]cty.Value{}
+		for k, v := range ctrl {
+			res[k] = v
+		}
+		for k, v := range kv {
+			res[k] = v
+		}
+		return res
+	}
+	net := newModule("net", "modules/network/pre-existing-vpc", nil)
+	check := func(ms ...config.Module) error {
+		bp := config.Blueprint{Groups: []config.Group{{Name: "g", Modules: ms}}}
+		return testHybridSlurm(bp, config.Dict{})
+	}
+
+	{ // OK: no hybrid module
+		c.Check(check(newModule("vpc", "modules/network/vpc", nil)), IsNil)
+	}
+
+	{ // OK: pre-existing network and controller address
+		c.Check(check(net, hybrid(ctrl)), IsNil)
+	}
+
+	{ // OK: new network, VPN and controller outside of the network range
+		c.Check(check(
+			newModule("vpc", "modules/network/vpc", nil),
+			newModule("vpn", "github.com/terraform-google-modules/terraform-google-vpn//modules/vpn_ha", nil),
+			hybrid(ctrl)), IsNil)
+	}
+
+	{ // FAIL: malformed settings
+		err := check(net, hybrid(map[string]cty.Value{
+			"slurm_control_host":      cty.StringVal("10.1.1.1"),
+			"slurm_control_addr":      cty.StringVal("ctrl_addr!"),
+			"slurm_control_host_port": cty.StringVal("slurmctld"),
+			"munge_mount": cty.ObjectVal(map[string]cty.Value{
+				"server_ip":     cty.NullVal(cty.String),
+				"remote_mount":  cty.StringVal("etc/munge"),
+				"fs_type":       cty.StringVal("nfs"),
+				"mount_options": cty.StringVal("")})}))
+		c.Check(err, ErrorMatches, `(?s).*slurm_control_host of module "hybrid" must be a host name, got "10.1.1.1".*`)
+		c.Check(err, ErrorMatches, `(?s).*slurm_control_addr of module "hybrid" must be an IP address or a host name.*`)
+		c.Check(err, ErrorMatches, `(?s).*slurm_control_host_port of module "hybrid" must be a port number.*`)
+		c.Check(err, ErrorMatches, `(?s).*remote_mount of module "hybrid" must be an absolute path, got "etc/munge".*`)
+	}
+
+	{ // FAIL: controller host name can not be resolved
+		c.Check(check(net, hybrid(map[string]cty.Value{"slurm_control_host": cty.StringVal("ctrl")})),
+			ErrorMatches, `.*must resolve controller host name "ctrl".*`)
+		c.Check(check(net, newModule("dns", "github.com/org/modules//dns-forwarding", nil),
+			hybrid(map[string]cty.Value{"slurm_control_host": cty.StringVal("ctrl")})), IsNil)
+	}
+
+	{ // FAIL: no network
+		c.Check(check(hybrid(ctrl)), ErrorMatches, `.*blueprint has no network module.*`)
+	}
+
+	{ // FAIL: new network without VPN, overlapping controller address
+		err := check(newModule("vpc", "modules/network/vpc", nil), hybrid(with(map[string]cty.Value{
+			"slurm_control_addr": cty.StringVal("10.0.0.5")})))
+		c.Check(err, ErrorMatches, `(?s).*network created by module "vpc" has no route to the on-premise controller.*`)
+		c.Check(err, ErrorMatches, `(?s).*address 10.0.0.5 of module "hybrid" is within range 10.0.0.0/9 of network module "vpc".*`)
+	}
+}
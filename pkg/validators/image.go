@@ -0,0 +1,270 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"context"
+	"fmt"
+	"hpc-toolkit/pkg/apiclient"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/logging"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	compute "google.golang.org/api/compute/v1"
+)
+
+// imageRef is an image used by a module, either by family or by name
+type imageRef struct {
+	project string
+	family  string
+	name    string
+}
+
+func (r imageRef) String() string {
+	if r.family != "" {
+		return fmt.Sprintf("image family %q in project %s", r.family, r.project)
+	}
+	return fmt.Sprintf("image %q in project %s", r.name, r.project)
+}
+
+// imageResolver returns an error if the image does not exist or is not accessible
+type imageResolver func(r imageRef) error
+
+// moduleImageRef returns the image used by the module, with the setting it is
+// configured by: `instance_image` of VMs or source image of Packer modules.
+// Images without project are looked up in defaultProject.
+func moduleImageRef(bp config.Blueprint, m config.Module, defaultProject string) (imageRef, string, bool) {
+	if v, ok := evalSetting(bp, m, "instance_image", cty.NullVal(cty.DynamicPseudoType)); ok && !v.IsNull() {
+		v, err := convert.Convert(v, cty.Map(cty.String))
+		if err != nil {
+			return imageRef{}, "", false
+		}
+		r := imageRef{project: defaultProject}
+		for k, f := range map[string]*string{"project": &r.project, "family": &r.family, "name": &r.name} {
+			if s, ok := v.AsValueMap()[k]; ok && !s.IsNull() {
+				*f = s.AsString()
+			}
+		}
+		return r, "instance_image", r.family != "" || r.name != ""
+	}
+
+	if m.Kind != config.PackerKind {
+		return imageRef{}, "", false
+	}
+	r := imageRef{project: defaultProject}
+	if v, ok := evalSetting(bp, m, "source_image_project_id", cty.NullVal(cty.List(cty.String))); ok {
+		if ps, err := ctyStrings(v); err == nil && len(ps) > 0 {
+			r.project = ps[0]
+		}
+	}
+	if name, ok := evalStringSetting(bp, m, "source_image"); ok && name != "" {
+		r.name = name
+		return r, "source_image", true
+	}
+	if family, ok := evalStringSetting(bp, m, "source_image_family"); ok && family != "" {
+		r.family = family
+		return r, "source_image_family", true
+	}
+	return imageRef{}, "", false
+}
+
+// builtImages returns images built by Packer modules of the blueprint, these
+// do not exist until the Packer group is deployed
+func builtImages(bp config.Blueprint, defaultProject string) map[imageRef]bool {
+	res := map[imageRef]bool{}
+	bp.WalkModulesSafe(func(_ config.ModulePath, m *config.Module) {
+		if m.Kind != config.PackerKind {
+			return
+		}
+		project := defaultProject
+		if p, ok := evalStringSetting(bp, *m, "project_id"); ok {
+			project = p
+		}
+		if family, ok := evalStringSetting(bp, *m, "image_family"); ok && family != "" {
+			res[imageRef{project: project, family: family}] = true
+		} else if bp.Vars.Has("deployment_name") { // default of custom-image module
+			res[imageRef{project: project, family: bp.DeploymentName()}] = true
+		}
+		if name, ok := evalStringSetting(bp, *m, "image_name"); ok && name != "" {
+			res[imageRef{project: project, name: name}] = true
+		}
+	})
+	return res
+}
+
+func checkImagesExist(bp config.Blueprint, defaultProject string, deferBuilt bool, resolve imageResolver) error {
+	built := builtImages(bp, defaultProject)
+	checked := map[imageRef]error{}
+	errs := config.Errors{}
+	bp.WalkModulesSafe(func(p config.ModulePath, m *config.Module) {
+		r, setting, ok := moduleImageRef(bp, *m, defaultProject)
+		if !ok {
+			return
+		}
+		if deferBuilt && built[r] {
+			logging.Info("%s of module %q is built by a Packer group of the blueprint, it is not validated", r, m.ID)
+			return
+		}
+		if _, ok := checked[r]; !ok {
+			checked[r] = resolve(r)
+		}
+		errs.At(p.Settings.Dot(setting), checked[r])
+	})
+	return errs.OrNil()
+}
+
+func testImageExists(ctx context.Context, bp config.Blueprint, inputs config.Dict) error {
+	required := []string{"project_id"}
+	if inputs.Has("defer_built_images") {
+		required = append(required, "defer_built_images")
+	}
+	if err := checkInputs(inputs, required); err != nil {
+		return err
+	}
+	m, err := inputsAsStrings(inputs)
+	if err != nil {
+		return err
+	}
+	deferBuilt := m["defer_built_images"] != "false"
+
+	s, err := apiclient.New(ctx, compute.NewService)
+	if err != nil {
+		return handleClientError(err)
+	}
+	return checkImagesExist(bp, m["project_id"], deferBuilt, func(r imageRef) error {
+		var err error
+		if r.family != "" {
+			_, err = s.Images.GetFromFamily(r.project, r.family).Fields().Do()
+		} else {
+			_, err = s.Images.Get(r.project, r.name).Fields().Do()
+		}
+		if err == nil {
+			return nil
+		}
+		return config.HintError{
+			Hint: "check the image with `gcloud compute images list --project " + r.project + "`, " +
+				"images built by Packer groups of other blueprints must be built before this blueprint is created",
+			Err: fmt.Errorf("%s does not exist or your credentials do not have permission to access it", r)}
+	})
+}
+
+// defaultMaxImageAgeDays is age of images after which test_image_fresh warns
+const defaultMaxImageAgeDays = 180
+
+// imageFreshness checks the image resolved for the reference, latest is the newest image
+// of its family, if known. Obsolete and deleted images can not be used and return an
+// error, deprecated images and images older than maxAge return a warning.
+func imageFreshness(r imageRef, img *compute.Image, latest *compute.Image, maxAge time.Duration, now time.Time) (string, error) {
+	suggest := ""
+	switch {
+	case img.Deprecated != nil && img.Deprecated.Replacement != "":
+		suggest = fmt.Sprintf("use replacement %s", path.Base(img.Deprecated.Replacement))
+	case latest != nil && latest.Name != img.Name:
+		suggest = fmt.Sprintf("use the newest image %s of family %q", latest.Name, img.Family)
+	}
+
+	if img.Deprecated != nil {
+		switch img.Deprecated.State {
+		case "OBSOLETE", "DELETED":
+			err := fmt.Errorf("%s resolves to image %s, which is %s", r, img.Name, strings.ToLower(img.Deprecated.State))
+			if suggest == "" {
+				return "", err
+			}
+			return "", config.HintError{Hint: suggest, Err: err}
+		case "DEPRECATED":
+			return joinSuggestion(fmt.Sprintf("%s resolves to image %s, which is deprecated", r, img.Name), suggest), nil
+		}
+	}
+
+	created, err := time.Parse(time.RFC3339, img.CreationTimestamp)
+	if err != nil || now.Sub(created) <= maxAge {
+		return "", nil
+	}
+	msg := fmt.Sprintf("%s resolves to image %s, created %d days ago", r, img.Name, int(now.Sub(created).Hours()/24))
+	if r.family != "" && suggest == "" {
+		suggest = "the image family is no longer updated, consider a family of a newer OS release"
+	}
+	return joinSuggestion(msg, suggest), nil
+}
+
+func joinSuggestion(msg string, suggest string) string {
+	if suggest == "" {
+		return msg
+	}
+	return msg + "; " + suggest
+}
+
+func testImageFresh(ctx context.Context, bp config.Blueprint, inputs config.Dict) error {
+	required := []string{"project_id"}
+	if inputs.Has("max_age_days") {
+		required = append(required, "max_age_days")
+	}
+	if err := checkInputs(inputs, required); err != nil {
+		return err
+	}
+	m, err := inputsAsStrings(inputs)
+	if err != nil {
+		return err
+	}
+	days := defaultMaxImageAgeDays
+	if s, ok := m["max_age_days"]; ok {
+		if days, err = strconv.Atoi(s); err != nil || days < 0 {
+			return config.CodedError{Code: CodeMisconfigured, Err: fmt.Errorf("max_age_days must be a non-negative integer, got %q", s)}
+		}
+	}
+	maxAge := time.Duration(days) * 24 * time.Hour
+
+	s, err := apiclient.New(ctx, compute.NewService)
+	if err != nil {
+		return handleClientError(err)
+	}
+	// images built by the blueprint are new, images that do not exist are reported by test_image_exists
+	built := builtImages(bp, m["project_id"])
+	checked := map[imageRef]error{}
+	errs := config.Errors{}
+	bp.WalkModulesSafe(func(p config.ModulePath, mod *config.Module) {
+		r, setting, ok := moduleImageRef(bp, *mod, m["project_id"])
+		if !ok || built[r] {
+			return
+		}
+		if _, ok := checked[r]; ok {
+			errs.At(p.Settings.Dot(setting), checked[r])
+			return
+		}
+		var img, latest *compute.Image
+		if r.family != "" {
+			img, err = s.Images.GetFromFamily(r.project, r.family).Do()
+			latest = img
+		} else if img, err = s.Images.Get(r.project, r.name).Do(); err == nil && img.Family != "" {
+			latest, _ = s.Images.GetFromFamily(r.project, img.Family).Do()
+		}
+		if err != nil {
+			checked[r] = nil
+			return
+		}
+		warning, ferr := imageFreshness(r, img, latest, maxAge, time.Now())
+		if warning != "" {
+			logging.Warn(logging.Warning{Source: testImageFreshName, Location: fmt.Sprintf("module %s", mod.ID), Message: warning})
+		}
+		checked[r] = ferr
+		errs.At(p.Settings.Dot(setting), ferr)
+	})
+	return errs.OrNil()
+}
@@ -0,0 +1,120 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"errors"
+	"hpc-toolkit/pkg/config"
+	"time"
+
+	"github.com/zclconf/go-cty/cty"
+	compute "google.golang.org/api/compute/v1"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestCheckImagesExist(c *C) {
+	image := func(kv ...string) cty.Value {
+		m := map[string]cty.Value{}
+		for i := 0; i < len(kv); i += 2 {
+			m[kv[i]] = cty.StringVal(kv[i+1])
+		}
+		return cty.ObjectVal(m)
+	}
+	bp := config.Blueprint{Groups: []config.Group{
+		{Name: "packer", Modules: []config.Module{
+			{ID: "builder", Kind: config.PackerKind, Settings: config.NewDict(map[string]cty.Value{
+				"project_id":              cty.StringVal("prj"),
+				"image_family":            cty.StringVal("built"),
+				"source_image_family":     cty.StringVal("hpc-rocky-linux-8"),
+				"source_image_project_id": cty.TupleVal([]cty.Value{cty.StringVal("cloud-hpc-image-public")})})}}},
+		{Name: "cluster", Modules: []config.Module{
+			{ID: "vm_built", Kind: config.TerraformKind, Settings: config.NewDict(map[string]cty.Value{
+				"instance_image": image("family", "built", "project", "prj")})},
+			{ID: "vm_default_project", Kind: config.TerraformKind, Settings: config.NewDict(map[string]cty.Value{
+				"instance_image": image("name", "my-image")})},
+			{ID: "vm_missing", Kind: config.TerraformKind, Settings: config.NewDict(map[string]cty.Value{
+				"instance_image": image("family", "missing", "project", "other")})},
+			{ID: "script", Kind: config.TerraformKind}}}}}
+
+	var checked []imageRef
+	resolve := func(r imageRef) error {
+		checked = append(checked, r)
+		if r.family == "missing" {
+			return errors.New("not found")
+		}
+		return nil
+	}
+
+	{ // images built by the blueprint are deferred
+		checked = nil
+		err := checkImagesExist(bp, "prj", true, resolve)
+		c.Check(err, ErrorMatches, ".*modules\\[2\\].settings.instance_image: not found")
+		c.Check(checked, DeepEquals, []imageRef{
+			{project: "cloud-hpc-image-public", family: "hpc-rocky-linux-8"},
+			{project: "prj", name: "my-image"},
+			{project: "other", family: "missing"},
+		})
+	}
+
+	{ // deferral is disabled
+		checked = nil
+		c.Check(checkImagesExist(bp, "prj", false, resolve), NotNil)
+		c.Check(checked, HasLen, 4)
+		c.Check(checked[1], DeepEquals, imageRef{project: "prj", family: "built"})
+	}
+}
+
+func (s *MySuite) TestImageFreshness(c *C) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	maxAge := 180 * 24 * time.Hour
+	family := imageRef{project: "cloud-hpc-image-public", family: "hpc-rocky-linux-8"}
+	byName := imageRef{project: "cloud-hpc-image-public", name: "hpc-rocky-linux-8-v20230101"}
+	image := func(name string, created string, state string, replacement string) *compute.Image {
+		img := &compute.Image{Name: name, Family: "hpc-rocky-linux-8", CreationTimestamp: created}
+		if state != "" {
+			img.Deprecated = &compute.DeprecationStatus{State: state, Replacement: replacement}
+		}
+		return img
+	}
+	newest := image("hpc-rocky-linux-8-v20240515", "2024-05-15T00:00:00.000-07:00", "", "")
+
+	{ // OK: recent image
+		w, err := imageFreshness(family, newest, newest, maxAge, now)
+		c.Check(w, Equals, "")
+		c.Check(err, IsNil)
+	}
+
+	{ // WARNING: deprecated image, newest image of the family is suggested
+		img := image("hpc-rocky-linux-8-v20240101", "2024-01-01T00:00:00.000-07:00", "DEPRECATED", "")
+		w, err := imageFreshness(byName, img, newest, maxAge, now)
+		c.Check(err, IsNil)
+		c.Check(w, Equals, `image "hpc-rocky-linux-8-v20230101" in project cloud-hpc-image-public resolves to image hpc-rocky-linux-8-v20240101, `+
+			`which is deprecated; use the newest image hpc-rocky-linux-8-v20240515 of family "hpc-rocky-linux-8"`)
+	}
+
+	{ // WARNING: old image of a family that is no longer updated
+		img := image("hpc-centos-7-v20230101", "2023-01-01T00:00:00.000-07:00", "", "")
+		w, err := imageFreshness(family, img, img, maxAge, now)
+		c.Check(err, IsNil)
+		c.Check(w, Matches, `.*created 516 days ago; the image family is no longer updated.*`)
+	}
+
+	{ // FAIL: obsolete image with replacement
+		img := image("old", "2023-01-01T00:00:00.000-07:00", "OBSOLETE",
+			"https://www.googleapis.com/compute/v1/projects/cloud-hpc-image-public/global/images/hpc-rocky-linux-8-v20240515")
+		_, err := imageFreshness(byName, img, nil, maxAge, now)
+		c.Check(err, ErrorMatches, `.*resolves to image old, which is obsolete - use replacement hpc-rocky-linux-8-v20240515`)
+	}
+}
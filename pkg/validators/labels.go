@@ -0,0 +1,101 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"regexp"
+
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// resourceNamePrefixRe matches deployment names that can prefix names of GCP resources
+var resourceNamePrefixRe = regexp.MustCompile(`^[a-z]([-a-z0-9]*[a-z0-9])?$`)
+
+const labelKeyHint = "label keys must begin with a lowercase letter, can only contain lowercase letters, numeric characters, " +
+	"underscores and dashes, and must be between 1 and 63 characters long"
+
+const labelValueHint = "label values can only contain lowercase letters, numeric characters, underscores and dashes, " +
+	"and must be at most 63 characters long"
+
+// checkDeploymentNameAsPrefix checks that resources named after the deployment have valid names
+func checkDeploymentNameAsPrefix(name string) error {
+	if resourceNamePrefixRe.MatchString(name) {
+		return nil
+	}
+	return config.HintError{
+		Hint: "deployment_name must begin with a lowercase letter, can only contain lowercase letters, numeric characters " +
+			"and dashes, and can not end with a dash",
+		Err: fmt.Errorf("deployment_name %q is not a valid prefix of resource names, modules naming resources after it fail to apply", name)}
+}
+
+// checkModuleLabels checks number, keys and values of labels of the module, labels
+// that are not known before deployment are not checked
+func checkModuleLabels(p config.ModulePath, id config.ModuleID, labels cty.Value) error {
+	if labels.IsNull() || !labels.IsWhollyKnown() || !(labels.Type().IsObjectType() || labels.Type().IsMapType()) {
+		return nil
+	}
+	lp := p.Settings.Dot("labels")
+	errs := config.Errors{}
+	vals := labels.AsValueMap()
+	if len(vals) > config.MaxLabels {
+		errs.At(lp, config.HintError{
+			Hint: fmt.Sprintf("remove labels from vars.labels or from the module, resources can have at most %d labels", config.MaxLabels),
+			Err:  fmt.Errorf("module %q has %d labels, more than %d", id, len(vals), config.MaxLabels)})
+	}
+	keys := maps.Keys(vals)
+	slices.Sort(keys)
+	for _, k := range keys {
+		vp := lp.Cty(cty.Path{}.IndexString(k))
+		if !config.IsValidLabelName(k) {
+			errs.At(vp, config.HintError{Hint: labelKeyHint, Err: fmt.Errorf("module %q has invalid label key %q", id, k)})
+		}
+		v := vals[k]
+		if v.IsNull() || v.Type() != cty.String {
+			errs.At(vp, fmt.Errorf("label %q of module %q must be a string", k, id))
+			continue
+		}
+		if !config.IsValidLabelValue(v.AsString()) {
+			errs.At(vp, config.HintError{Hint: labelValueHint, Err: fmt.Errorf("module %q has invalid value %q of label %q", id, v.AsString(), k)})
+		}
+	}
+	return errs.OrNil()
+}
+
+func testLabelsValid(bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{}); err != nil {
+		return err
+	}
+	errs := config.Errors{}
+	if bp.Vars.Has("deployment_name") {
+		if v, err := bp.Eval(config.GlobalRef("deployment_name").AsValue()); err == nil && v.IsKnown() && !v.IsNull() && v.Type() == cty.String {
+			errs.At(config.Root.Vars.Dot("deployment_name"), checkDeploymentNameAsPrefix(v.AsString()))
+		}
+	}
+	bp.WalkModulesSafe(func(p config.ModulePath, m *config.Module) {
+		if !m.Settings.Has("labels") {
+			return
+		}
+		v, err := bp.Eval(m.Settings.Get("labels"))
+		if err != nil {
+			return
+		}
+		errs.Add(checkModuleLabels(p, m.ID, v))
+	})
+	return errs.OrNil()
+}
@@ -0,0 +1,60 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/config"
+
+	"github.com/zclconf/go-cty/cty"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestCheckDeploymentNameAsPrefix(c *C) {
+	for _, n := range []string{"hpc", "hpc-small-2", "a"} {
+		c.Check(checkDeploymentNameAsPrefix(n), IsNil, Commentf("%s", n))
+	}
+	for _, n := range []string{"2hpc", "hpc_small", "hpc-", "_hpc"} {
+		c.Check(checkDeploymentNameAsPrefix(n), ErrorMatches, fmt.Sprintf(`deployment_name %q is not a valid prefix .*`, n))
+	}
+}
+
+func (s *MySuite) TestCheckModuleLabels(c *C) {
+	p := config.Root.Groups.At(0).Modules.At(0)
+	labels := func(kv ...string) cty.Value {
+		m := map[string]cty.Value{}
+		for i := 0; i < len(kv); i += 2 {
+			m[kv[i]] = cty.StringVal(kv[i+1])
+		}
+		return cty.ObjectVal(m)
+	}
+
+	c.Check(checkModuleLabels(p, "vm", labels("ghpc_module", "vm", "team", "hpc-1")), IsNil)
+	c.Check(checkModuleLabels(p, "vm", cty.NullVal(cty.Map(cty.String))), IsNil)
+	c.Check(checkModuleLabels(p, "vm", cty.UnknownVal(cty.Map(cty.String))), IsNil)
+
+	c.Check(checkModuleLabels(p, "vm", labels("Team", "hpc")), ErrorMatches,
+		`.*labels.Team: module "vm" has invalid label key "Team" - .*`)
+	c.Check(checkModuleLabels(p, "vm", labels("team", "HPC")), ErrorMatches,
+		`.*labels.team: module "vm" has invalid value "HPC" of label "team" - .*`)
+	c.Check(checkModuleLabels(p, "vm", cty.ObjectVal(map[string]cty.Value{"n": cty.NumberIntVal(1)})), ErrorMatches,
+		`.*label "n" of module "vm" must be a string`)
+
+	many := []string{}
+	for i := 0; i <= config.MaxLabels; i++ {
+		many = append(many, fmt.Sprintf("l%d", i), "v")
+	}
+	c.Check(checkModuleLabels(p, "vm", labels(many...)), ErrorMatches, `.*module "vm" has 65 labels, more than 64 - .*`)
+}
@@ -0,0 +1,245 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"path"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// fileSystemModule describes network_storage output by a file system module
+type fileSystemModule struct {
+	source       string // suffix of the module source
+	mountSetting string // setting of the local mount point(s)
+	defaultMount string
+	fsType       string // empty if it is set by `fs_type` setting
+}
+
+var fileSystemModules = []fileSystemModule{
+	{"file-system/filestore", "local_mount", "/shared", "nfs"},
+	{"file-system/pre-existing-network-storage", "local_mount", "/mnt", ""},
+	{"file-system/cloud-storage-bucket", "local_mount", "/mnt", "gcsfuse"},
+	{"file-system/nfs-server", "local_mounts", "/data", "nfs"},
+	{"file-system/DDN-EXAScaler", "local_mount", "/shared", "lustre"},
+}
+
+// knownFsTypes are fs_type values supported by mount scripts of the Toolkit
+var knownFsTypes = []string{"nfs", "lustre", "gcsfuse", "daos"}
+
+// fsMount is a file system mounted by a module
+type fsMount struct {
+	local  string
+	fsType string
+	from   string // description of the source, e.g. `module "homefs"`
+}
+
+func fileSystemModuleOf(m config.Module) (fileSystemModule, bool) {
+	for _, f := range fileSystemModules {
+		if strings.HasSuffix(m.Source, f.source) {
+			return f, true
+		}
+	}
+	return fileSystemModule{}, false
+}
+
+// fileSystemMounts returns mounts of network_storage output by the file system module,
+// returns false if the module is not a known file system module or its settings
+// can not be evaluated before deployment
+func fileSystemMounts(bp config.Blueprint, m config.Module) ([]fsMount, bool) {
+	f, ok := fileSystemModuleOf(m)
+	if !ok {
+		return nil, false
+	}
+	fsType := f.fsType
+	if fsType == "" {
+		fsType = "nfs"
+		if m.Settings.Has("fs_type") {
+			if fsType, ok = evalStringSetting(bp, m, "fs_type"); !ok {
+				return nil, false
+			}
+		}
+	}
+	locals := []string{f.defaultMount}
+	if m.Settings.Has(f.mountSetting) {
+		v, ok := evalSetting(bp, m, f.mountSetting, cty.NilVal)
+		if !ok || v.IsNull() {
+			return nil, false
+		}
+		if v.Type() == cty.String {
+			locals = []string{v.AsString()}
+		} else if locals, ok = stringsOf(v); !ok {
+			return nil, false
+		}
+	}
+	res := []fsMount{}
+	for _, l := range locals {
+		res = append(res, fsMount{local: l, fsType: fsType, from: fmt.Sprintf("module %q", m.ID)})
+	}
+	return res, true
+}
+
+func stringsOf(v cty.Value) ([]string, bool) {
+	ss, err := ctyStrings(v)
+	return ss, err == nil
+}
+
+// checkFileSystemModule checks mount points and fs_type of the file system module
+func checkFileSystemModule(bp config.Blueprint, p config.ModulePath, m config.Module) error {
+	f, ok := fileSystemModuleOf(m)
+	if !ok {
+		return nil
+	}
+	errs := config.Errors{}
+	if mounts, ok := fileSystemMounts(bp, m); ok {
+		for _, mt := range mounts {
+			if !path.IsAbs(mt.local) {
+				errs.At(p.Settings.Dot(f.mountSetting), fmt.Errorf("mount point of module %q must be an absolute path, got %q", m.ID, mt.local))
+			}
+		}
+	}
+	if f.fsType != "" {
+		return errs.OrNil()
+	}
+
+	fsType, ok := evalStringSetting(bp, m, "fs_type")
+	if !ok {
+		fsType = "nfs"
+	}
+	if !slices.Contains(knownFsTypes, fsType) {
+		errs.At(p.Settings.Dot("fs_type"), fmt.Errorf("fs_type of module %q must be one of %s, got %q", m.ID, strings.Join(knownFsTypes, ", "), fsType))
+		return errs.OrNil()
+	}
+	remote, _ := evalStringSetting(bp, m, "remote_mount")
+	isBucket := strings.HasPrefix(remote, "gs://")
+	switch {
+	case fsType == "gcsfuse" && path.IsAbs(remote):
+		errs.At(p.Settings.Dot("remote_mount"), config.HintError{
+			Hint: "remote_mount of a gcsfuse file system is the name of the Cloud Storage bucket",
+			Err:  fmt.Errorf("module %q mounts %q with fs_type gcsfuse, but remote_mount is a path", m.ID, remote)})
+	case fsType != "gcsfuse" && isBucket:
+		at := p.Settings.Dot("remote_mount")
+		if m.Settings.Has("fs_type") {
+			at = p.Settings.Dot("fs_type")
+		}
+		errs.At(at, config.HintError{
+			Hint: "set fs_type to gcsfuse to mount Cloud Storage buckets",
+			Err:  fmt.Errorf("module %q mounts Cloud Storage bucket %q with fs_type %s", m.ID, remote, fsType)})
+	}
+	return errs.OrNil()
+}
+
+// storageMounts returns mounts of network_storage setting of the module. References to
+// network_storage of file system modules are resolved to mounts of these modules, other
+// references are ignored. Literal entries are returned with paths of entries, as they do
+// not refer to file systems of the blueprint.
+func storageMounts(bp config.Blueprint, p config.ModulePath, m config.Module) ([]fsMount, []config.Path) {
+	v := m.Settings.Get("network_storage")
+	mounts, literals := []fsMount{}, []config.Path{}
+	seen := map[config.ModuleID]bool{}
+	for _, r := range sortedReferences(v) {
+		if r.GlobalVar || r.Name != "network_storage" || seen[r.Module] {
+			continue
+		}
+		seen[r.Module] = true
+		if fs, err := bp.Module(r.Module); err == nil {
+			if ms, ok := fileSystemMounts(bp, *fs); ok {
+				mounts = append(mounts, ms...)
+			}
+		}
+	}
+
+	if _, is := config.IsExpressionValue(v); is || v.IsNull() || !(v.Type().IsTupleType() || v.Type().IsListType()) {
+		return mounts, literals
+	}
+	for i, e := range v.AsValueSlice() {
+		if _, is := config.IsExpressionValue(e); is {
+			continue
+		}
+		ep := p.Settings.Dot("network_storage").Cty(cty.IndexIntPath(i))
+		literals = append(literals, ep)
+		ev, err := bp.Eval(e)
+		if err != nil || !ev.IsWhollyKnown() || ev.IsNull() || !ev.Type().IsObjectType() {
+			continue
+		}
+		attr := func(name string) string {
+			if !ev.Type().HasAttribute(name) || ev.GetAttr(name).IsNull() || ev.GetAttr(name).Type() != cty.String {
+				return ""
+			}
+			return ev.GetAttr(name).AsString()
+		}
+		mounts = append(mounts, fsMount{local: attr("local_mount"), fsType: attr("fs_type"), from: fmt.Sprintf("network_storage[%d]", i)})
+	}
+	return mounts, literals
+}
+
+func sortedReferences(v cty.Value) []config.Reference {
+	refs := maps.Keys(config.ValueReferences(v))
+	slices.SortFunc(refs, func(a, b config.Reference) int {
+		return strings.Compare(string(a.Module)+"."+a.Name, string(b.Module)+"."+b.Name)
+	})
+	return refs
+}
+
+// checkStorageMounts checks that network_storage of the module refers to file systems of
+// the blueprint and that mount points of file systems do not collide
+func checkStorageMounts(bp config.Blueprint, p config.ModulePath, m config.Module) error {
+	if !m.Settings.Has("network_storage") {
+		return nil
+	}
+	mounts, literals := storageMounts(bp, p, m)
+	errs := config.Errors{}
+	for _, lp := range literals {
+		errs.At(lp, config.HintError{
+			Hint: "declare existing file systems with a pre-existing-network-storage module and add it to `use` of the module",
+			Err:  fmt.Errorf("network_storage entry of module %q does not refer to a file system of the blueprint", m.ID)})
+	}
+
+	at := map[string]fsMount{}
+	for _, mt := range mounts {
+		if mt.fsType != "" && !slices.Contains(knownFsTypes, mt.fsType) {
+			errs.At(p.Settings.Dot("network_storage"), fmt.Errorf("%s of module %q has fs_type %q, must be one of %s",
+				mt.from, m.ID, mt.fsType, strings.Join(knownFsTypes, ", ")))
+		}
+		if mt.local == "" {
+			continue
+		}
+		if prev, ok := at[path.Clean(mt.local)]; ok {
+			errs.At(p.Settings.Dot("network_storage"), config.HintError{
+				Hint: "set distinct `local_mount` of the file systems",
+				Err:  fmt.Errorf("module %q mounts %s and %s at the same mount point %s", m.ID, prev.from, mt.from, mt.local)})
+			continue
+		}
+		at[path.Clean(mt.local)] = mt
+	}
+	return errs.OrNil()
+}
+
+func testFileSystemMounts(bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{}); err != nil {
+		return err
+	}
+	errs := config.Errors{}
+	bp.WalkModulesSafe(func(p config.ModulePath, m *config.Module) {
+		errs.Add(checkFileSystemModule(bp, p, *m))
+		errs.Add(checkStorageMounts(bp, p, *m))
+	})
+	return errs.OrNil()
+}
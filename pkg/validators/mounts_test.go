@@ -0,0 +1,89 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"hpc-toolkit/pkg/config"
+
+	"github.com/zclconf/go-cty/cty"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestFileSystemMounts(c *C) {
+	storage := func(ids ...config.ModuleID) cty.Value {
+		refs := []cty.Value{}
+		for _, id := range ids {
+			refs = append(refs, config.ModuleRef(id, "network_storage").AsValue())
+		}
+		return config.FunctionCallExpression("flatten", cty.TupleVal(refs)).AsValue()
+	}
+	check := func(mods ...config.Module) error {
+		bp := config.Blueprint{Groups: []config.Group{{Name: "g", Modules: mods}}}
+		return testFileSystemMounts(bp, config.Dict{})
+	}
+	homefs := newModule("homefs", "modules/file-system/filestore", map[string]cty.Value{"local_mount": cty.StringVal("/home")})
+	appsfs := newModule("appsfs", "modules/file-system/pre-existing-network-storage", map[string]cty.Value{
+		"server_ip":    cty.StringVal("10.0.0.2"),
+		"remote_mount": cty.StringVal("/apps"),
+		"local_mount":  cty.StringVal("/apps")})
+	bucket := newModule("bucket", "community/modules/file-system/cloud-storage-bucket", nil) // mounted at /mnt
+	vm := func(settings map[string]cty.Value) config.Module {
+		return newModule("vm", "modules/compute/vm-instance", settings)
+	}
+
+	{ // OK
+		c.Check(check(homefs, appsfs, bucket, vm(map[string]cty.Value{
+			"network_storage": storage("homefs", "appsfs", "bucket")})), IsNil)
+	}
+
+	{ // FAIL: mount points collide
+		apps2 := newModule("apps2", "modules/file-system/filestore", map[string]cty.Value{"local_mount": cty.StringVal("/apps/")})
+		err := check(appsfs, apps2, vm(map[string]cty.Value{"network_storage": storage("appsfs", "apps2")}))
+		c.Check(err, ErrorMatches, `.*module "vm" mounts module "apps2" and module "appsfs" at the same mount point /apps.*`)
+	}
+
+	{ // FAIL: literal entry is not a file system of the blueprint
+		err := check(homefs, vm(map[string]cty.Value{"network_storage": cty.TupleVal([]cty.Value{
+			config.ModuleRef("homefs", "network_storage").AsValue(),
+			cty.ObjectVal(map[string]cty.Value{
+				"local_mount": cty.StringVal("/home"),
+				"fs_type":     cty.StringVal("nfs")}),
+		})}))
+		c.Check(err, ErrorMatches, `(?s).*network_storage\[1\]: network_storage entry of module "vm" does not refer to a file system.*same mount point /home.*`)
+	}
+
+	{ // FAIL: fs_type does not match the file system
+		gcs := newModule("gcs", "modules/file-system/pre-existing-network-storage", map[string]cty.Value{
+			"remote_mount": cty.StringVal("gs://my-bucket"),
+			"local_mount":  cty.StringVal("/data")})
+		c.Check(check(gcs), ErrorMatches, `.*settings.remote_mount: module "gcs" mounts Cloud Storage bucket "gs://my-bucket" with fs_type nfs - .*`)
+
+		fuse := newModule("fuse", "modules/file-system/pre-existing-network-storage", map[string]cty.Value{
+			"fs_type":      cty.StringVal("gcsfuse"),
+			"remote_mount": cty.StringVal("/export"),
+			"local_mount":  cty.StringVal("/data")})
+		c.Check(check(fuse), ErrorMatches, `.*settings.remote_mount: module "fuse" mounts "/export" with fs_type gcsfuse, but remote_mount is a path - .*`)
+
+		xfs := newModule("xfs", "modules/file-system/pre-existing-network-storage", map[string]cty.Value{
+			"fs_type":      cty.StringVal("xfs"),
+			"remote_mount": cty.StringVal("/export")})
+		c.Check(check(xfs), ErrorMatches, `.*fs_type of module "xfs" must be one of nfs, lustre, gcsfuse, daos, got "xfs"`)
+	}
+
+	{ // FAIL: relative mount point
+		rel := newModule("rel", "modules/file-system/filestore", map[string]cty.Value{"local_mount": cty.StringVal("shared")})
+		c.Check(check(rel), ErrorMatches, `.*mount point of module "rel" must be an absolute path, got "shared"`)
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"context"
+	"fmt"
+	"hpc-toolkit/pkg/apiclient"
+	"hpc-toolkit/pkg/config"
+	"strings"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+// networkRef is a pre-existing VPC network used by a module
+type networkRef struct {
+	project string
+	name    string
+}
+
+// isPreExistingVpc returns true if the module looks up an existing network
+func isPreExistingVpc(m config.Module) bool {
+	return strings.HasSuffix(m.Source, "network/pre-existing-vpc")
+}
+
+// moduleNetworkRef returns the pre-existing network used by the module and the path
+// it is configured at: `network_name` of pre-existing-vpc, which is looked up in
+// `project_id` of the module (the host project of Shared VPC), or `network_self_link`
+// of any module. Network of pre-existing-vpc is "default" if `network_name` is not set.
+func moduleNetworkRef(bp config.Blueprint, p config.ModulePath, m config.Module, defaultProject string) (networkRef, config.Path, bool) {
+	if isPreExistingVpc(m) {
+		r := networkRef{project: defaultProject, name: "default"}
+		if project, ok := evalStringSetting(bp, m, "project_id"); ok && project != "" {
+			r.project = project
+		}
+		if !m.Settings.Has("network_name") {
+			return r, p.Source, true
+		}
+		name, ok := evalStringSetting(bp, m, "network_name")
+		if !ok || name == "" {
+			return networkRef{}, nil, false
+		}
+		r.name = name
+		return r, p.Settings.Dot("network_name"), true
+	}
+
+	link, ok := evalStringSetting(bp, m, "network_self_link")
+	if !ok || !looksLikeResourceRef(link) {
+		return networkRef{}, nil, false
+	}
+	ref, err := ParseResourceRef(link)
+	if err != nil || ref.Kind != "networks" {
+		return networkRef{}, nil, false // malformed references are reported by test_resource_references
+	}
+	return networkRef{project: ref.Project, name: ref.Name}, p.Settings.Dot("network_self_link"), true
+}
+
+func networkError(r networkRef) error {
+	return config.HintError{
+		Hint: fmt.Sprintf("list networks with `gcloud compute networks list --project %s`; "+
+			"for Shared VPC set `project_id` of the module to the host project", r.project),
+		Err: fmt.Errorf("network %q does not exist in project %s or your credentials do not have permission to access it", r.name, r.project)}
+}
+
+// checkNetworksExist reports networks used by modules for which exists returns false
+func checkNetworksExist(bp config.Blueprint, defaultProject string, exists func(networkRef) bool) error {
+	checked := map[networkRef]bool{}
+	errs := config.Errors{}
+	bp.WalkModulesSafe(func(p config.ModulePath, m *config.Module) {
+		r, path, ok := moduleNetworkRef(bp, p, *m, defaultProject)
+		if !ok {
+			return
+		}
+		if _, ok := checked[r]; !ok {
+			checked[r] = exists(r)
+		}
+		if !checked[r] {
+			errs.At(path, networkError(r))
+		}
+	})
+	return errs.OrNil()
+}
+
+// subnetworkRef is a pre-existing subnetwork used by a module
+type subnetworkRef struct {
+	project string
+	region  string
+	name    string
+}
+
+// moduleSubnetworkRef returns the pre-existing subnetwork used by the module and the path
+// it is configured at: subnetwork of pre-existing-vpc, which defaults to the network of
+// the same name, or `subnetwork_self_link` of any module
+func moduleSubnetworkRef(bp config.Blueprint, p config.ModulePath, m config.Module, defaultProject string) (subnetworkRef, config.Path, bool) {
+	if isPreExistingVpc(m) {
+		net, _, ok := moduleNetworkRef(bp, p, m, defaultProject)
+		region, rok := evalStringSetting(bp, m, "region")
+		if !ok || !rok {
+			return subnetworkRef{}, nil, false
+		}
+		r := subnetworkRef{project: net.project, region: region, name: net.name}
+		if !m.Settings.Has("subnetwork_name") {
+			return r, p.Settings.Dot("region"), true
+		}
+		name, ok := evalStringSetting(bp, m, "subnetwork_name")
+		if !ok || name == "" {
+			return subnetworkRef{}, nil, false
+		}
+		r.name = name
+		return r, p.Settings.Dot("subnetwork_name"), true
+	}
+
+	ref, ok := literalSubnetwork(bp, m)
+	if !ok {
+		return subnetworkRef{}, nil, false
+	}
+	return subnetworkRef{project: ref.Project, region: ref.Region, name: ref.Name}, p.Settings.Dot("subnetwork_self_link"), true
+}
+
+// literalSubnetwork returns the subnetwork of `subnetwork_self_link` setting if it is
+// known before deployment
+func literalSubnetwork(bp config.Blueprint, m config.Module) (ResourceRef, bool) {
+	link, ok := evalStringSetting(bp, m, "subnetwork_self_link")
+	if !ok || !looksLikeResourceRef(link) {
+		return ResourceRef{}, false
+	}
+	ref, err := ParseResourceRef(link)
+	if err != nil || ref.Kind != "subnetworks" {
+		return ResourceRef{}, false // malformed references are reported by test_resource_references
+	}
+	return ref, true
+}
+
+// checkSubnetworks reports subnetworks used by modules for which exists returns false
+func checkSubnetworks(bp config.Blueprint, defaultProject string, exists func(subnetworkRef) bool) error {
+	checked := map[subnetworkRef]bool{}
+	errs := config.Errors{}
+	bp.WalkModulesSafe(func(p config.ModulePath, m *config.Module) {
+		if r, path, ok := moduleSubnetworkRef(bp, p, *m, defaultProject); ok {
+			if _, ok := checked[r]; !ok {
+				checked[r] = exists(r)
+			}
+			if !checked[r] {
+				errs.At(path, config.HintError{
+					Hint: fmt.Sprintf("list subnetworks with `gcloud compute networks subnets list --project %s --regions %s`", r.project, r.region),
+					Err: fmt.Errorf("subnetwork %q does not exist in region %s of project %s or your credentials do not have permission to access it",
+						r.name, r.region, r.project)})
+			}
+		}
+	})
+	return errs.OrNil()
+}
+
+func testSubnetworkExists(ctx context.Context, bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{"project_id"}); err != nil {
+		return err
+	}
+	m, err := inputsAsStrings(inputs)
+	if err != nil {
+		return err
+	}
+	s, err := apiclient.New(ctx, compute.NewService)
+	if err != nil {
+		return handleClientError(err)
+	}
+	return checkSubnetworks(bp, m["project_id"], func(r subnetworkRef) bool {
+		_, err := s.Subnetworks.Get(r.project, r.region, r.name).Fields().Do()
+		return err == nil
+	})
+}
+
+func testNetworkExists(ctx context.Context, bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{"project_id"}); err != nil {
+		return err
+	}
+	m, err := inputsAsStrings(inputs)
+	if err != nil {
+		return err
+	}
+	s, err := apiclient.New(ctx, compute.NewService)
+	if err != nil {
+		return handleClientError(err)
+	}
+	return checkNetworksExist(bp, m["project_id"], func(r networkRef) bool {
+		_, err := s.Networks.Get(r.project, r.name).Fields().Do()
+		return err == nil
+	})
+}
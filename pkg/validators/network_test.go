@@ -0,0 +1,84 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"hpc-toolkit/pkg/config"
+
+	"github.com/zclconf/go-cty/cty"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestCheckNetworksExist(c *C) {
+	vpc := "modules/network/pre-existing-vpc"
+	bp := config.Blueprint{Groups: []config.Group{{Name: "g", Modules: []config.Module{
+		newModule("default_net", vpc, nil),
+		newModule("shared_vpc", vpc, map[string]cty.Value{
+			"project_id":   cty.StringVal("host"),
+			"network_name": cty.StringVal("shared-net")}),
+		newModule("typo", vpc, map[string]cty.Value{"network_name": cty.StringVal("hcp-net")}),
+		newModule("vm", "modules/compute/vm-instance", map[string]cty.Value{
+			"network_self_link": cty.StringVal("https://www.googleapis.com/compute/v1/projects/host/global/networks/shared-net")}),
+		newModule("vm_subnet", "modules/compute/vm-instance", map[string]cty.Value{
+			"network_self_link": cty.StringVal("projects/host/regions/r/subnetworks/s")}),
+	}}}}
+
+	checked := []networkRef{}
+	exists := func(r networkRef) bool {
+		checked = append(checked, r)
+		return r.name != "hcp-net"
+	}
+	err := checkNetworksExist(bp, "prj", exists)
+	c.Check(err, ErrorMatches, `.*modules\[2\].settings.network_name: network "hcp-net" does not exist in project prj.*`)
+	c.Check(checked, DeepEquals, []networkRef{ // every network is checked once
+		{project: "prj", name: "default"},
+		{project: "host", name: "shared-net"},
+		{project: "prj", name: "hcp-net"},
+	})
+}
+
+func (s *MySuite) TestCheckSubnetworks(c *C) {
+	vpc := "modules/network/pre-existing-vpc"
+	vm := func(id config.ModuleID, zone string, subnet cty.Value) config.Module {
+		return newModule(id, "modules/compute/vm-instance", map[string]cty.Value{
+			"zone":                 cty.StringVal(zone),
+			"subnetwork_self_link": subnet})
+	}
+	bp := config.Blueprint{Groups: []config.Group{{Name: "g", Modules: []config.Module{
+		newModule("net", vpc, map[string]cty.Value{
+			"network_name": cty.StringVal("hpc-net"),
+			"region":       cty.StringVal("us-central1")}),
+		newModule("typo", vpc, map[string]cty.Value{
+			"project_id":      cty.StringVal("host"),
+			"subnetwork_name": cty.StringVal("hcp-subnet"),
+			"region":          cty.StringVal("europe-west4")}),
+		vm("ok", "us-central1-a", config.ModuleRef("net", "subnetwork_self_link").AsValue()),
+		vm("far", "us-east1-b", config.ModuleRef("net", "subnetwork_self_link").AsValue()),
+		vm("literal", "us-central1-c", cty.StringVal("projects/host/regions/europe-west4/subnetworks/s")),
+	}}}}
+
+	checked := []subnetworkRef{}
+	exists := func(r subnetworkRef) bool {
+		checked = append(checked, r)
+		return r.name != "hcp-subnet"
+	}
+	err := checkSubnetworks(bp, "prj", exists)
+	c.Check(err, ErrorMatches, `.*modules\[1\].settings.subnetwork_name: subnetwork "hcp-subnet" does not exist in region europe-west4 of project host.*`)
+	c.Check(checked, DeepEquals, []subnetworkRef{
+		{project: "prj", region: "us-central1", name: "hpc-net"}, // defaults to the network name
+		{project: "host", region: "europe-west4", name: "hcp-subnet"},
+		{project: "host", region: "europe-west4", name: "s"},
+	})
+}
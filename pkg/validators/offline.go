@@ -0,0 +1,67 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hpc-toolkit/pkg/apiclient"
+	"hpc-toolkit/pkg/logging"
+	"strings"
+)
+
+// Offline skips validators that call Google Cloud APIs, set by `--offline`
+var Offline bool
+
+// hasCredentials reports whether application default credentials are available,
+// replaced in tests
+var hasCredentials = func() bool {
+	_, err := apiclient.Options(context.Background())
+	return err == nil || !errors.Is(handleClientError(err), ErrNoDefaultCredentials)
+}
+
+// cloudValidators returns names of built-in validators that call Google Cloud APIs
+func cloudValidators() map[string]bool {
+	cloud := map[string]bool{
+		testProjectExistsName:      true,
+		testResourceReferencesName: true,
+		testBackendBucketName:      true,
+	}
+	// all validators that depend on other validators call APIs
+	for name := range dependencies() {
+		cloud[name] = true
+	}
+	return cloud
+}
+
+// warnOffline notifies that validators calling Google Cloud APIs were skipped
+func warnOffline(skipped []string) {
+	if len(skipped) == 0 {
+		return
+	}
+	w := logging.Warning{
+		Source:  "validation",
+		Message: fmt.Sprintf("validators that call Google Cloud APIs were skipped: %s", strings.Join(skipped, ", ")),
+	}
+	if Offline {
+		w.Message = "running offline, " + w.Message
+	} else {
+		w.Code = string(CodeNoCredentials)
+		w.Message = "application default credentials were not found, " + w.Message
+		w.Hint = credentialsHint
+	}
+	logging.Warn(w)
+}
@@ -0,0 +1,72 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"errors"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/logging"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestOffline(c *C) {
+	defer func(o bool, h func() bool) { Offline, hasCredentials = o, h }(Offline, hasCredentials)
+	defer config.UnregisterValidator("test_always_fails")
+	c.Assert(config.RegisterValidator("test_always_fails", func(config.Blueprint, config.Dict) error {
+		return errors.New("failed")
+	}, nil), IsNil)
+
+	lookups := 0
+	creds := false
+	hasCredentials = func() bool { lookups++; return creds }
+	run := func(vs ...string) error {
+		logging.ResetWarnings()
+		bp := config.Blueprint{}
+		for _, v := range vs {
+			bp.Validators = append(bp.Validators, config.Validator{Validator: v, Skip: v == testZoneExistsName})
+		}
+		return Execute(bp)
+	}
+
+	{ // credentials are not looked up without validators calling APIs
+		c.Check(run("test_always_fails"), ErrorMatches, `(?s).*failed.*`)
+		c.Check(lookups, Equals, 0)
+		c.Check(logging.Warnings(), HasLen, 0)
+	}
+
+	{ // without credentials, validators calling APIs are skipped with a notice
+		err := run(testProjectExistsName, testRegionExistsName, testZoneExistsName, testRegionExistsName, "test_always_fails")
+		c.Check(err, ErrorMatches, `(?s).*failed.*`) // other validators still run
+		c.Check(lookups, Equals, 1)                  // validators set to skip are not listed
+		c.Check(logging.Warnings(), DeepEquals, []logging.Warning{{
+			Source:  "validation",
+			Code:    string(CodeNoCredentials),
+			Message: "application default credentials were not found, validators that call Google Cloud APIs were skipped: test_project_exists, test_region_exists",
+			Hint:    credentialsHint,
+		}})
+	}
+
+	{ // --offline skips them regardless of credentials
+		creds, Offline, lookups = true, true, 0
+		c.Check(run(testBackendBucketName), IsNil)
+		c.Check(lookups, Equals, 0)
+		c.Check(logging.Warnings(), DeepEquals, []logging.Warning{{
+			Source:  "validation",
+			Message: "running offline, validators that call Google Cloud APIs were skipped: test_backend_bucket",
+		}})
+	}
+	logging.ResetWarnings()
+}
@@ -0,0 +1,206 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hpc-toolkit/pkg/apiclient"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/logging"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+	crm "google.golang.org/api/cloudresourcemanager/v1"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	vmExternalIPAccessConstraint   = "constraints/compute.vmExternalIpAccess"
+	requireShieldedVMConstraint    = "constraints/compute.requireShieldedVm"
+	trustedImageProjectsConstraint = "constraints/compute.trustedImageProjects"
+)
+
+// orgPolicyConstraints are constraints checked by test_org_policies
+var orgPolicyConstraints = []string{
+	vmExternalIPAccessConstraint,
+	requireShieldedVMConstraint,
+	trustedImageProjectsConstraint,
+}
+
+// orgPolicies are effective org policies of a project by constraint
+type orgPolicies map[string]*crm.OrgPolicy
+
+// publicIPSettings are settings of modules that control external IP addresses,
+// mapped to the value that enables them
+var publicIPSettings = map[string]bool{
+	"enable_public_ips":             true,
+	"disable_public_ips":            false,
+	"disable_controller_public_ips": false,
+	"disable_login_public_ips":      false,
+	"omit_external_ip":              false,
+}
+
+// evalBoolSettingOrDefault returns the boolean setting of the module, or the
+// default of the module input if it is not set
+func evalBoolSettingOrDefault(bp config.Blueprint, m config.Module, name string) (bool, bool) {
+	if m.Settings.Has(name) {
+		v, ok := evalSetting(bp, m, name, cty.NilVal)
+		if !ok || v.IsNull() || v.Type() != cty.Bool {
+			return false, false
+		}
+		return v.True(), true
+	}
+	for _, in := range m.InfoOrDie().Inputs {
+		if in.Name == name {
+			b, ok := in.Default.(bool)
+			return b, ok
+		}
+	}
+	return false, false
+}
+
+// enforced returns true if the boolean constraint is enforced
+func (ps orgPolicies) enforced(constraint string) bool {
+	p := ps[constraint]
+	return p != nil && p.BooleanPolicy != nil && p.BooleanPolicy.Enforced
+}
+
+// allows returns true if the list constraint allows the value
+func (ps orgPolicies) allows(constraint string, value string) bool {
+	p := ps[constraint]
+	if p == nil || p.ListPolicy == nil {
+		return true
+	}
+	lp := p.ListPolicy
+	switch lp.AllValues {
+	case "ALLOW":
+		return true
+	case "DENY":
+		return false
+	}
+	trim := func(vs []string) []string {
+		res := []string{}
+		for _, v := range vs {
+			res = append(res, strings.TrimPrefix(v, "is:"))
+		}
+		return res
+	}
+	if slices.Contains(trim(lp.DeniedValues), value) {
+		return false
+	}
+	return len(lp.AllowedValues) == 0 || slices.Contains(trim(lp.AllowedValues), value)
+}
+
+// restricted returns true if the list constraint does not allow all values
+func (ps orgPolicies) restricted(constraint string) bool {
+	p := ps[constraint]
+	if p == nil || p.ListPolicy == nil || p.ListPolicy.AllValues == "ALLOW" {
+		return false
+	}
+	return p.ListPolicy.AllValues == "DENY" || len(p.ListPolicy.AllowedValues) > 0
+}
+
+func quotedIDs(ids []config.ModuleID) string {
+	quoted := []string{}
+	for _, id := range ids {
+		quoted = append(quoted, fmt.Sprintf("%q", id))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// checkOrgPolicies reports modules of the blueprint whose settings violate effective
+// org policies of the project. Images are looked up in projectID if modules do not
+// set their project.
+func checkOrgPolicies(bp config.Blueprint, projectID string, ps orgPolicies) error {
+	publicIP, unshielded := []config.ModuleID{}, []config.ModuleID{}
+	untrusted := map[string][]config.ModuleID{}
+	bp.WalkModulesSafe(func(_ config.ModulePath, m *config.Module) {
+		for s, public := range publicIPSettings {
+			if v, ok := evalBoolSettingOrDefault(bp, *m, s); ok && v == public && !slices.Contains(publicIP, m.ID) {
+				publicIP = append(publicIP, m.ID)
+			}
+		}
+		if v, ok := evalBoolSettingOrDefault(bp, *m, "enable_shielded_vm"); ok && !v {
+			unshielded = append(unshielded, m.ID)
+		}
+		if r, _, ok := moduleImageRef(bp, *m, projectID); ok && !ps.allows(trustedImageProjectsConstraint, "projects/"+r.project) {
+			untrusted[r.project] = append(untrusted[r.project], m.ID)
+		}
+	})
+	slices.Sort(publicIP)
+
+	errs := config.Errors{}
+	if len(publicIP) > 0 && ps.restricted(vmExternalIPAccessConstraint) {
+		msg := fmt.Sprintf("org policy %s of project %s restricts external IP addresses of VMs, but modules %s create VMs with external IP addresses",
+			vmExternalIPAccessConstraint, projectID, quotedIDs(publicIP))
+		if ps[vmExternalIPAccessConstraint].ListPolicy.AllValues == "DENY" {
+			errs.Add(config.HintError{
+				Hint: "disable external IP addresses of the modules, e.g. set `disable_public_ips: true` or `enable_public_ips: false`, and use Cloud NAT for egress",
+				Err:  errors.New(msg)})
+		} else { // names of VMs are not known before deployment
+			logging.Warnf(testOrgPoliciesName, "%s, creating them fails unless they are allowed by name", msg)
+		}
+	}
+	if len(unshielded) > 0 && ps.enforced(requireShieldedVMConstraint) {
+		errs.Add(config.HintError{
+			Hint: "set `enable_shielded_vm: true` and use images that support Shielded VM",
+			Err: fmt.Errorf("org policy %s is enforced in project %s, but modules %s create VMs without Shielded VM",
+				requireShieldedVMConstraint, projectID, quotedIDs(unshielded))})
+	}
+	projects := maps.Keys(untrusted)
+	slices.Sort(projects)
+	for _, p := range projects {
+		errs.Add(config.HintError{
+			Hint: fmt.Sprintf("use images of trusted projects or ask your organization administrator to add projects/%s to the policy", p),
+			Err: fmt.Errorf("org policy %s of project %s does not trust images of project %s, used by modules %s",
+				trustedImageProjectsConstraint, projectID, p, quotedIDs(untrusted[p]))})
+	}
+	return errs.OrNil()
+}
+
+func testOrgPolicies(ctx context.Context, bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{"project_id"}); err != nil {
+		return err
+	}
+	m, err := inputsAsStrings(inputs)
+	if err != nil {
+		return err
+	}
+	pid := m["project_id"]
+
+	s, err := apiclient.New(ctx, crm.NewService)
+	if err != nil {
+		return handleClientError(err)
+	}
+	ps := orgPolicies{}
+	for _, c := range orgPolicyConstraints {
+		p, err := s.Projects.GetEffectiveOrgPolicy("projects/"+pid, &crm.GetEffectiveOrgPolicyRequest{Constraint: c}).Do()
+		if err != nil {
+			var herr *googleapi.Error
+			if errors.As(err, &herr) {
+				if reason, _ := getErrorReason(*herr); reason == "SERVICE_DISABLED" {
+					return newDisabledServiceError("Cloud Resource Manager API", "cloudresourcemanager.googleapis.com", pid)
+				}
+			}
+			return fmt.Errorf("failed to get effective org policy %s of project %s: %w", c, pid, err)
+		}
+		ps[c] = p
+	}
+	return checkOrgPolicies(bp, pid, ps)
+}
@@ -0,0 +1,87 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/modulereader"
+
+	"github.com/zclconf/go-cty/cty"
+	crm "google.golang.org/api/cloudresourcemanager/v1"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestOrgPoliciesAllows(c *C) {
+	list := func(lp crm.ListPolicy) orgPolicies {
+		return orgPolicies{trustedImageProjectsConstraint: {ListPolicy: &lp}}
+	}
+	c.Check(orgPolicies{}.allows(trustedImageProjectsConstraint, "projects/a"), Equals, true)
+	c.Check(list(crm.ListPolicy{AllValues: "ALLOW"}).allows(trustedImageProjectsConstraint, "projects/a"), Equals, true)
+	c.Check(list(crm.ListPolicy{AllValues: "DENY"}).allows(trustedImageProjectsConstraint, "projects/a"), Equals, false)
+
+	allowed := list(crm.ListPolicy{AllowedValues: []string{"is:projects/a", "projects/b"}})
+	c.Check(allowed.allows(trustedImageProjectsConstraint, "projects/a"), Equals, true)
+	c.Check(allowed.allows(trustedImageProjectsConstraint, "projects/b"), Equals, true)
+	c.Check(allowed.allows(trustedImageProjectsConstraint, "projects/c"), Equals, false)
+	c.Check(allowed.restricted(trustedImageProjectsConstraint), Equals, true)
+
+	denied := list(crm.ListPolicy{DeniedValues: []string{"projects/a"}})
+	c.Check(denied.allows(trustedImageProjectsConstraint, "projects/a"), Equals, false)
+	c.Check(denied.allows(trustedImageProjectsConstraint, "projects/b"), Equals, true)
+	c.Check(denied.restricted(trustedImageProjectsConstraint), Equals, false)
+}
+
+func (s *MySuite) TestCheckOrgPolicies(c *C) {
+	modulereader.SetModuleInfo("./orgpolicy/vm", "terraform", modulereader.ModuleInfo{
+		Inputs: []modulereader.VarInfo{
+			{Name: "disable_public_ips", Type: cty.Bool, Default: false},
+			{Name: "enable_shielded_vm", Type: cty.Bool, Default: false},
+		}})
+	modulereader.SetModuleInfo("./orgpolicy/script", "terraform", modulereader.ModuleInfo{})
+	bp := config.Blueprint{Groups: []config.Group{{Name: "g", Modules: []config.Module{
+		newModule("public", "./orgpolicy/vm", map[string]cty.Value{
+			"instance_image": cty.ObjectVal(map[string]cty.Value{
+				"family": cty.StringVal("hpc-rocky-linux-8"), "project": cty.StringVal("cloud-hpc-image-public")})}),
+		newModule("private", "./orgpolicy/vm", map[string]cty.Value{
+			"disable_public_ips": cty.True,
+			"enable_shielded_vm": cty.True,
+			"instance_image":     cty.ObjectVal(map[string]cty.Value{"family": cty.StringVal("mine")})}),
+		newModule("script", "./orgpolicy/script", nil)}}}}
+
+	c.Check(checkOrgPolicies(bp, "prj", orgPolicies{}), IsNil)
+
+	c.Check(checkOrgPolicies(bp, "prj", orgPolicies{
+		vmExternalIPAccessConstraint: {ListPolicy: &crm.ListPolicy{AllValues: "DENY"}},
+	}), ErrorMatches, `org policy constraints/compute.vmExternalIpAccess of project prj restricts .* modules "public" create .* - .*`)
+
+	// VMs allowed by name are only warned about
+	c.Check(checkOrgPolicies(bp, "prj", orgPolicies{
+		vmExternalIPAccessConstraint: {ListPolicy: &crm.ListPolicy{AllowedValues: []string{"projects/prj/zones/z/instances/vm"}}},
+	}), IsNil)
+
+	c.Check(checkOrgPolicies(bp, "prj", orgPolicies{
+		requireShieldedVMConstraint: {BooleanPolicy: &crm.BooleanPolicy{Enforced: true}},
+	}), ErrorMatches, `org policy constraints/compute.requireShieldedVm is enforced in project prj, but modules "public" create VMs without Shielded VM - .*`)
+	c.Check(checkOrgPolicies(bp, "prj", orgPolicies{
+		requireShieldedVMConstraint: {BooleanPolicy: &crm.BooleanPolicy{}},
+	}), IsNil)
+
+	c.Check(checkOrgPolicies(bp, "prj", orgPolicies{
+		trustedImageProjectsConstraint: {ListPolicy: &crm.ListPolicy{AllowedValues: []string{"projects/prj"}}},
+	}), ErrorMatches, `.* does not trust images of project cloud-hpc-image-public, used by modules "public" - .*`)
+	c.Check(checkOrgPolicies(bp, "prj", orgPolicies{
+		trustedImageProjectsConstraint: {ListPolicy: &crm.ListPolicy{AllowedValues: []string{"projects/cloud-hpc-image-public"}}},
+	}), ErrorMatches, `.* does not trust images of project prj, used by modules "private" - .*`)
+}
@@ -0,0 +1,279 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"context"
+	"fmt"
+	"hpc-toolkit/pkg/apiclient"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/logging"
+	"sort"
+	"strings"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+// Rough estimates of disk space in GB taken by software installed during image builds,
+// on top of the source image. Spack builds packages from source and keeps build caches.
+var softwareDiskGB = map[string]int{
+	"scripts/spack-setup":    10,
+	"scripts/spack-execute":  20,
+	"scripts/ramble-setup":   2,
+	"scripts/ramble-execute": 5,
+}
+
+// ansibleDiskGB is disk space taken by Ansible and its collections
+const ansibleDiskGB = 2
+
+// packerScriptSettings are settings of the custom-image module that run software
+// installation during the build
+var packerScriptSettings = []string{"startup_script", "startup_script_file", "shell_scripts", "ansible_playbooks"}
+
+// packerLookups query source images and networking of image builds
+type packerLookups struct {
+	// imageSize returns size of the image in GB, or false if it can not be read
+	imageSize func(r imageRef) (int64, bool)
+	egress    egressLookups
+}
+
+func hasPackerModules(bp config.Blueprint) bool {
+	found := false
+	bp.WalkModulesSafe(func(_ config.ModulePath, m *config.Module) {
+		found = found || m.Kind == config.PackerKind
+	})
+	return found
+}
+
+// softwareStack returns estimated disk space in GB taken by software installed by
+// the modules the Packer module depends on, with descriptions of the software
+func softwareStack(bp config.Blueprint, m config.Module) (int, []string) {
+	total, descs := 0, []string{}
+	ansible := false
+	for _, d := range moduleDependencies(bp, m) {
+		for src, gb := range softwareDiskGB {
+			if strings.HasSuffix(d.Source, src) {
+				total += gb
+				descs = append(descs, fmt.Sprintf("module %q (%d GB)", d.ID, gb))
+			}
+		}
+		if !strings.HasSuffix(d.Source, "scripts/startup-script") {
+			continue
+		}
+		if b, ok := evalBoolSettingOrDefault(bp, d, "install_ansible"); ok && b {
+			ansible = true
+		}
+		for _, s := range knownStrings(bp, d) {
+			ansible = ansible || s == "ansible-local"
+		}
+	}
+	if m.Settings.Has("ansible_playbooks") {
+		ansible = true
+	}
+	if ansible {
+		total += ansibleDiskGB
+		descs = append(descs, fmt.Sprintf("Ansible (%d GB)", ansibleDiskGB))
+	}
+	sort.Strings(descs)
+	return total, descs
+}
+
+// checkPackerDisk checks that the disk of the image build holds the source image and
+// the software installed during the build. A disk smaller than the source image fails
+// the build, a disk that may be too small for the software is reported as a warning.
+func checkPackerDisk(bp config.Blueprint, p config.ModulePath, m config.Module, defaultProject string, lookup packerLookups) (string, error) {
+	r, _, ok := moduleImageRef(bp, m, defaultProject)
+	if !ok {
+		return "", nil
+	}
+	imageGB, ok := lookup.imageSize(r)
+	if !ok {
+		return "", nil // reported by test_image_exists
+	}
+	diskGB := imageGB // disk of the size of the source image by default
+	if m.Settings.Has("disk_size") {
+		f, ok := evalNumberSetting(bp, m, "disk_size")
+		if !ok {
+			return "", nil
+		}
+		diskGB = int64(f)
+	}
+	if diskGB < imageGB {
+		return "", config.BpError{Path: p.Settings.Dot("disk_size"), Err: config.HintError{
+			Hint: fmt.Sprintf("set `disk_size` to at least %d", imageGB),
+			Err:  fmt.Errorf("disk_size %d GB of Packer module %q is smaller than %s of %d GB", diskGB, m.ID, r, imageGB)}}
+	}
+
+	stackGB, descs := softwareStack(bp, m)
+	if stackGB == 0 || diskGB >= imageGB+int64(stackGB) {
+		return "", nil
+	}
+	return fmt.Sprintf("disk of %d GB of Packer module %q may be too small: %s takes %d GB and the software installed "+
+		"during the build takes about %d GB more (%s); set `disk_size` to at least %d to avoid running out of space "+
+		"late in the build", diskGB, m.ID, r, imageGB, stackGB, strings.Join(descs, ", "), imageGB+int64(stackGB)), nil
+}
+
+// packerSubnetwork returns the subnetwork of the image build, or the ID of the vpc
+// module of the blueprint creating it. Returns false if the subnetwork is not known.
+func packerSubnetwork(bp config.Blueprint, m config.Module, defaultProject string, vpcs map[config.ModuleID]subnetworkRef) (subnetworkRef, config.ModuleID, bool) {
+	for ref := range config.ValueReferences(m.Settings.Get("subnetwork_name")) {
+		if ref.GlobalVar {
+			continue
+		}
+		if r, ok := vpcs[ref.Module]; ok {
+			return r, "", true
+		}
+		if dep, err := bp.Module(ref.Module); err == nil && strings.HasSuffix(dep.Source, "network/vpc") {
+			return subnetworkRef{}, dep.ID, true
+		}
+		return subnetworkRef{}, "", false
+	}
+
+	name, ok := evalStringSetting(bp, m, "subnetwork_name")
+	if !ok || name == "" {
+		return subnetworkRef{}, "", false
+	}
+	zone, ok := evalStringSetting(bp, m, "zone")
+	if !ok {
+		return subnetworkRef{}, "", false
+	}
+	region, ok := zoneRegion(zone)
+	if !ok {
+		return subnetworkRef{}, "", false
+	}
+	project := defaultProject
+	if prj, ok := evalStringSetting(bp, m, "project_id"); ok {
+		project = prj
+	}
+	if prj, ok := evalStringSetting(bp, m, "network_project_id"); ok && prj != "" {
+		project = prj
+	}
+	return subnetworkRef{project: project, region: region, name: name}, "", true
+}
+
+// checkPackerEgress checks that image builds without external IP address, that install
+// software, have internet access through Cloud NAT
+func checkPackerEgress(bp config.Blueprint, p config.ModulePath, m config.Module, defaultProject string,
+	vpcs map[config.ModuleID]subnetworkRef, lookup egressLookups) error {
+	if omit, ok := evalBoolSettingOrDefault(bp, m, "omit_external_ip"); !ok || !omit {
+		return nil
+	}
+	runsScripts := false
+	for _, s := range packerScriptSettings {
+		runsScripts = runsScripts || m.Settings.Has(s)
+	}
+	if !runsScripts {
+		return nil
+	}
+
+	r, vpc, ok := packerSubnetwork(bp, m, defaultProject, vpcs)
+	if !ok {
+		return nil
+	}
+	noNat := func(network string, hint string) error {
+		return config.BpError{Path: p.Settings.Dot("omit_external_ip"), Err: config.HintError{
+			Hint: hint,
+			Err: fmt.Errorf("Packer module %q builds the image on a VM without external IP address, but %s has no "+
+				"Cloud NAT; downloading software fails after the build times out", m.ID, network)}}
+	}
+	if vpc != "" {
+		if dep, _ := bp.Module(vpc); isVpcWithoutNat(bp, *dep) {
+			return noNat(fmt.Sprintf("the network of module %q", vpc),
+				fmt.Sprintf("set `ips_per_nat` of module %q to at least 1, or set `omit_external_ip: false`", vpc))
+		}
+		return nil
+	}
+
+	subnet, ok := lookup.subnetwork(r)
+	if !ok {
+		return nil // reported by test_subnetwork_exists
+	}
+	routers, err := lookup.routers(r.project, r.region)
+	if err != nil {
+		return fmt.Errorf("failed to list Cloud Routers of region %s of project %s: %w", r.region, r.project, err)
+	}
+	if hasCloudNat(routers, subnet) {
+		return nil
+	}
+	return noNat(fmt.Sprintf("subnetwork %q of project %s", r.name, r.project),
+		"create a Cloud NAT gateway for the subnetwork, or set `omit_external_ip: false`; Private Google Access "+
+			"only reaches Google APIs")
+}
+
+// checkPackerBuilds checks disks and internet access of image builds of Packer modules,
+// returns warnings for disks that may be too small
+func checkPackerBuilds(bp config.Blueprint, defaultProject string, lookup packerLookups) ([]string, error) {
+	vpcs := map[config.ModuleID]subnetworkRef{}
+	bp.WalkModulesSafe(func(p config.ModulePath, m *config.Module) {
+		if !isPreExistingVpc(*m) {
+			return
+		}
+		if r, _, ok := moduleSubnetworkRef(bp, p, *m, defaultProject); ok {
+			vpcs[m.ID] = r
+		}
+	})
+
+	warnings := []string{}
+	errs := config.Errors{}
+	bp.WalkModulesSafe(func(p config.ModulePath, m *config.Module) {
+		if m.Kind != config.PackerKind {
+			return
+		}
+		w, err := checkPackerDisk(bp, p, *m, defaultProject, lookup)
+		if w != "" {
+			warnings = append(warnings, w)
+		}
+		errs.Add(err)
+		errs.Add(checkPackerEgress(bp, p, *m, defaultProject, vpcs, lookup.egress))
+	})
+	return warnings, errs.OrNil()
+}
+
+func testPackerBuild(ctx context.Context, bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{"project_id"}); err != nil {
+		return err
+	}
+	m, err := inputsAsStrings(inputs)
+	if err != nil {
+		return err
+	}
+	if !hasPackerModules(bp) {
+		return nil
+	}
+	s, err := apiclient.New(ctx, compute.NewService)
+	if err != nil {
+		return handleClientError(err)
+	}
+	warnings, err := checkPackerBuilds(bp, m["project_id"], packerLookups{
+		imageSize: func(r imageRef) (int64, bool) {
+			var img *compute.Image
+			var err error
+			if r.family != "" {
+				img, err = s.Images.GetFromFamily(r.project, r.family).Fields("diskSizeGb").Do()
+			} else {
+				img, err = s.Images.Get(r.project, r.name).Fields("diskSizeGb").Do()
+			}
+			if err != nil {
+				return 0, false
+			}
+			return img.DiskSizeGb, true
+		},
+		egress: newEgressLookups(ctx, s),
+	})
+	for _, w := range warnings {
+		logging.Warnf(testPackerBuildName, "%s", w)
+	}
+	return err
+}
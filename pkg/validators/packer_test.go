@@ -0,0 +1,94 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/modulereader"
+
+	"github.com/zclconf/go-cty/cty"
+	compute "google.golang.org/api/compute/v1"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestCheckPackerBuilds(c *C) {
+	modulereader.SetModuleInfo("./packer/image", "packer", modulereader.ModuleInfo{
+		Inputs: []modulereader.VarInfo{{Name: "omit_external_ip", Type: cty.Bool, Default: true}}})
+	modulereader.SetModuleInfo("./packer/scripts/spack-execute", "terraform", modulereader.ModuleInfo{})
+	modulereader.SetModuleInfo("./packer/scripts/startup-script", "terraform", modulereader.ModuleInfo{
+		Inputs: []modulereader.VarInfo{{Name: "install_ansible", Type: cty.Bool, Default: false}}})
+
+	withSource := func(settings map[string]cty.Value) map[string]cty.Value {
+		settings["source_image_project_id"] = cty.ListVal([]cty.Value{cty.StringVal("public")})
+		settings["source_image_family"] = cty.StringVal("hpc")
+		settings["zone"] = cty.StringVal("us-central1-a")
+		return settings
+	}
+	script := config.ModuleRef("scripts", "startup_script").AsValue()
+	bp := config.Blueprint{Groups: []config.Group{
+		{Name: "primary", Modules: []config.Module{
+			newModule("net", "modules/network/vpc", map[string]cty.Value{"ips_per_nat": cty.NumberIntVal(0)}),
+			newModule("shared", "modules/network/pre-existing-vpc", map[string]cty.Value{
+				"project_id":   cty.StringVal("host"),
+				"network_name": cty.StringVal("shared"),
+				"region":       cty.StringVal("us-central1")}),
+			newModule("spack", "./packer/scripts/spack-execute", nil),
+			newModule("scripts", "./packer/scripts/startup-script", map[string]cty.Value{
+				"runners": config.ModuleRef("spack", "spack_runner").AsValue()}),
+		}},
+		{Name: "packer", Modules: []config.Module{
+			newPackerModule("small", "./packer/image", withSource(map[string]cty.Value{"disk_size": cty.NumberIntVal(20)})),
+			newPackerModule("tight", "./packer/image", withSource(map[string]cty.Value{
+				"disk_size":       cty.NumberIntVal(50),
+				"startup_script":  script,
+				"subnetwork_name": config.ModuleRef("net", "subnetwork_name").AsValue()})),
+			newPackerModule("private", "./packer/image", withSource(map[string]cty.Value{
+				"disk_size":       cty.NumberIntVal(100),
+				"startup_script":  script,
+				"subnetwork_name": config.ModuleRef("shared", "subnetwork_name").AsValue()})),
+			newPackerModule("public", "./packer/image", withSource(map[string]cty.Value{
+				"startup_script":   script,
+				"omit_external_ip": cty.False,
+				"subnetwork_name":  cty.StringVal("other")})),
+		}},
+	}}
+
+	routers := []*compute.Router{}
+	lookup := packerLookups{
+		imageSize: func(r imageRef) (int64, bool) { return 30, r.project == "public" && r.family == "hpc" },
+		egress: egressLookups{
+			subnetwork: func(r subnetworkRef) (*compute.Subnetwork, bool) {
+				return &compute.Subnetwork{Name: r.name, Network: "projects/" + r.project + "/global/networks/" + r.name}, true
+			},
+			routers: func(project string, region string) ([]*compute.Router, error) { return routers, nil },
+		},
+	}
+
+	warnings, err := checkPackerBuilds(bp, "prj", lookup)
+	c.Check(warnings, DeepEquals, []string{
+		`disk of 30 GB of Packer module "public" may be too small: image family "hpc" in project public takes 30 GB and the ` +
+			`software installed during the build takes about 20 GB more (module "spack" (20 GB)); set ` + "`disk_size`" +
+			` to at least 50 to avoid running out of space late in the build`,
+	})
+	c.Check(err, ErrorMatches, `(?s)3 errors.*`+
+		`groups\[1\].modules\[0\].settings.disk_size: disk_size 20 GB of Packer module "small" is smaller than image family "hpc" in project public of 30 GB.*`+
+		`groups\[1\].modules\[1\].settings.omit_external_ip: Packer module "tight" .* but the network of module "net" has no Cloud NAT.*`+
+		`groups\[1\].modules\[2\].settings.omit_external_ip: Packer module "private" .* but subnetwork "shared" of project host has no Cloud NAT.*`)
+
+	routers = []*compute.Router{{Network: "projects/host/global/networks/shared",
+		Nats: []*compute.RouterNat{{SourceSubnetworkIpRangesToNat: "ALL_SUBNETWORKS_ALL_IP_RANGES"}}}}
+	_, err = checkPackerBuilds(bp, "prj", lookup)
+	c.Check(err, ErrorMatches, `(?s)2 errors.*"small".*"tight".*`)
+}
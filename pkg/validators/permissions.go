@@ -0,0 +1,104 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"context"
+	"fmt"
+	"hpc-toolkit/pkg/apiclient"
+	"hpc-toolkit/pkg/config"
+	"strings"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+	crm "google.golang.org/api/cloudresourcemanager/v1"
+)
+
+// testIamPermissionsBatchSize is the maximal number of permissions in a testIamPermissions request
+const testIamPermissionsBatchSize = 100
+
+// requiredPermissions returns IAM permissions declared in metadata of modules,
+// mapped to modules that require them
+func requiredPermissions(bp config.Blueprint) map[string][]config.ModuleID {
+	res := map[string][]config.ModuleID{}
+	bp.WalkModulesSafe(func(_ config.ModulePath, m *config.Module) {
+		for _, p := range m.InfoOrDie().Metadata.Ghpc.Permissions {
+			if !slices.Contains(res[p], m.ID) {
+				res[p] = append(res[p], m.ID)
+			}
+		}
+	})
+	return res
+}
+
+// checkPermissions reports required permissions that are not granted
+func checkPermissions(projectID string, required map[string][]config.ModuleID, granted []string) error {
+	missing := []string{}
+	for _, p := range maps.Keys(required) {
+		if !slices.Contains(granted, p) {
+			missing = append(missing, p)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	slices.Sort(missing)
+
+	lines := []string{}
+	for _, p := range missing {
+		quoted := []string{}
+		for _, id := range required[p] {
+			quoted = append(quoted, fmt.Sprintf("%q", id))
+		}
+		lines = append(lines, fmt.Sprintf("  %s, required by modules %s", p, strings.Join(quoted, ", ")))
+	}
+	return config.HintError{
+		Hint: fmt.Sprintf("grant roles with these permissions at https://console.cloud.google.com/iam-admin/iam?project=%s, "+
+			"or run `ghpc create` with credentials that have them", projectID),
+		Err: fmt.Errorf("credentials in use lack permissions in project %s:\n%s", projectID, strings.Join(lines, "\n"))}
+}
+
+func testPermissionsGranted(ctx context.Context, bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{"project_id"}); err != nil {
+		return err
+	}
+	m, err := inputsAsStrings(inputs)
+	if err != nil {
+		return err
+	}
+	required := requiredPermissions(bp)
+	if len(required) == 0 {
+		return nil
+	}
+
+	s, err := apiclient.New(ctx, crm.NewService)
+	if err != nil {
+		return handleClientError(err)
+	}
+
+	perms := maps.Keys(required)
+	slices.Sort(perms)
+	granted := []string{}
+	for len(perms) > 0 {
+		batch := perms[:min(len(perms), testIamPermissionsBatchSize)]
+		perms = perms[len(batch):]
+		resp, err := s.Projects.TestIamPermissions(m["project_id"], &crm.TestIamPermissionsRequest{Permissions: batch}).Do()
+		if err != nil {
+			return fmt.Errorf("failed to test permissions in project %s: %w", m["project_id"], err)
+		}
+		granted = append(granted, resp.Permissions...)
+	}
+	return checkPermissions(m["project_id"], required, granted)
+}
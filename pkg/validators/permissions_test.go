@@ -0,0 +1,57 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/modulereader"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestRequiredPermissions(c *C) {
+	setInfo := func(source string, perms ...string) {
+		modulereader.SetModuleInfo(source, "terraform", modulereader.ModuleInfo{
+			Metadata: modulereader.Metadata{Ghpc: modulereader.MetadataGhpc{Permissions: perms}}})
+	}
+	setInfo("./perms/vm", "compute.instances.create", "compute.disks.create")
+	setInfo("./perms/fs", "file.instances.create")
+	setInfo("./perms/none")
+	bp := config.Blueprint{Groups: []config.Group{{Name: "g", Modules: []config.Module{
+		newModule("login", "./perms/vm", nil), newModule("homefs", "./perms/fs", nil), newModule("compute", "./perms/vm", nil), newModule("script", "./perms/none", nil)}}}}
+
+	c.Check(requiredPermissions(bp), DeepEquals, map[string][]config.ModuleID{
+		"compute.instances.create": {"login", "compute"},
+		"compute.disks.create":     {"login", "compute"},
+		"file.instances.create":    {"homefs"},
+	})
+}
+
+func (s *MySuite) TestCheckPermissions(c *C) {
+	required := map[string][]config.ModuleID{
+		"compute.instances.create": {"login", "compute"},
+		"file.instances.create":    {"homefs"},
+	}
+
+	{ // OK: all granted
+		c.Check(checkPermissions("pid", required, []string{"file.instances.create", "compute.instances.create"}), IsNil)
+	}
+
+	{ // FAIL: missing permissions are listed with modules
+		err := checkPermissions("pid", required, []string{"compute.instances.create"})
+		c.Check(err, ErrorMatches, `(?s)credentials in use lack permissions in project pid:\n`+
+			`  file.instances.create, required by modules "homefs".*iam-admin/iam\?project=pid.*`)
+	}
+}
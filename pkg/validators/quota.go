@@ -0,0 +1,226 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"context"
+	"fmt"
+	"hpc-toolkit/pkg/apiclient"
+	"hpc-toolkit/pkg/config"
+	"sort"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+	compute "google.golang.org/api/compute/v1"
+)
+
+// instanceCountSettings are settings of number of instances created by modules, e.g. by
+// vm-instance, Slurm nodesets and GKE node pools. The first group of settings that is set
+// determines the count, values of the group are summed
+var instanceCountSettings = [][]string{
+	{"instance_count"},
+	{"node_count_static", "node_count_dynamic_max"},
+	{"static_node_count"},
+	{"autoscaling_total_max_nodes", "total_max_nodes"},
+}
+
+// diskQuotaMetrics are quota metrics of persistent disk types
+var diskQuotaMetrics = map[string]string{
+	"pd-standard": "DISKS_TOTAL_GB",
+	"pd-balanced": "SSD_TOTAL_GB",
+	"pd-ssd":      "SSD_TOTAL_GB",
+	"pd-extreme":  "SSD_TOTAL_GB",
+}
+
+// quotaUse is usage of a regional quota metric by instances of a module
+type quotaUse struct {
+	metric string
+	amount float64
+	module config.ModuleID
+}
+
+// machineTypeInfo returns machine type of the zone, returns false if it is not known
+type machineTypeInfo func(zone string, machineType string) (*compute.MachineType, bool)
+
+func evalNumberSetting(bp config.Blueprint, m config.Module, name string) (float64, bool) {
+	v, ok := evalSetting(bp, m, name, cty.NullVal(cty.Number))
+	if !ok || v.IsNull() || v.Type() != cty.Number {
+		return 0, false
+	}
+	f, _ := v.AsBigFloat().Float64()
+	return f, true
+}
+
+// instanceCount returns maximal number of instances created by the module, settings
+// that are not set are not counted, modules without count settings create one instance
+func instanceCount(bp config.Blueprint, m config.Module) float64 {
+	for _, group := range instanceCountSettings {
+		sum, found := 0.0, false
+		for _, s := range group {
+			if n, ok := evalNumberSetting(bp, m, s); ok {
+				sum, found = sum+n, true
+			}
+		}
+		if found {
+			return sum
+		}
+	}
+	return 1
+}
+
+// isSpot returns true if instances of the module are Spot or preemptible VMs,
+// which use separate quotas
+func isSpot(bp config.Blueprint, m config.Module) bool {
+	for _, s := range []string{"spot", "preemptible", "enable_spot_vm"} {
+		if isEnabledSetting(bp, m, s) {
+			return true
+		}
+	}
+	pm, _ := evalStringSetting(bp, m, "provisioning_model")
+	return pm == "SPOT"
+}
+
+// cpuQuotaMetric returns quota metric of vCPUs of the machine type, machine families
+// without a dedicated quota use the generic "CPUS" quota
+func cpuQuotaMetric(machineType string, spot bool, regional map[string]bool) string {
+	if spot {
+		return "PREEMPTIBLE_CPUS"
+	}
+	family := strings.ToUpper(strings.SplitN(machineType, "-", 2)[0])
+	if m := family + "_CPUS"; regional[m] {
+		return m
+	}
+	return "CPUS"
+}
+
+// gpuQuotaMetric returns quota metric of the accelerator type, e.g. "nvidia-tesla-a100"
+// uses "NVIDIA_A100_GPUS" and "nvidia-a100-80gb" uses "NVIDIA_A100_80GB_GPUS"
+func gpuQuotaMetric(acceleratorType string, spot bool) string {
+	name := strings.ToUpper(strings.ReplaceAll(strings.Replace(acceleratorType, "-tesla-", "-", 1), "-", "_"))
+	m := name + "_GPUS"
+	if spot {
+		m = "PREEMPTIBLE_" + m
+	}
+	return m
+}
+
+// moduleQuotaUses returns expected usage of regional quotas by instances of the module,
+// only settings known before deployment are counted
+func moduleQuotaUses(bp config.Blueprint, m config.Module, zone string, mtInfo machineTypeInfo, regional map[string]bool) []quotaUse {
+	count := instanceCount(bp, m)
+	if count <= 0 {
+		return nil
+	}
+	spot := isSpot(bp, m)
+	uses := []quotaUse{}
+
+	if mt, ok := evalStringSetting(bp, m, "machine_type"); ok && mt != "" {
+		if z, ok := evalStringSetting(bp, m, "zone"); ok && z != "" {
+			zone = z
+		}
+		if info, ok := mtInfo(zone, mt); ok {
+			uses = append(uses, quotaUse{cpuQuotaMetric(mt, spot, regional), float64(info.GuestCpus) * count, m.ID})
+			for _, a := range info.Accelerators { // accelerator-optimized machine types
+				uses = append(uses, quotaUse{gpuQuotaMetric(a.GuestAcceleratorType, spot), float64(a.GuestAcceleratorCount) * count, m.ID})
+			}
+		}
+	}
+
+	accs := moduleAccelerators(bp, m)
+	idx := maps.Keys(accs)
+	slices.Sort(idx)
+	for _, i := range idx {
+		uses = append(uses, quotaUse{gpuQuotaMetric(accs[i].typ, spot), float64(accs[i].count) * count, m.ID})
+	}
+
+	for _, s := range []string{"disk_size_gb", "disk_size"} {
+		size, ok := evalNumberSetting(bp, m, s)
+		if !ok {
+			continue
+		}
+		dt, _ := evalStringSetting(bp, m, "disk_type")
+		if metric, ok := diskQuotaMetrics[dt]; ok {
+			uses = append(uses, quotaUse{metric, size * count, m.ID})
+		}
+		break
+	}
+	return uses
+}
+
+// checkQuotas reports quota metrics which usage would exceed the limit, usage of
+// metrics that are not regional quotas of the project is not checked
+func checkQuotas(projectID string, region string, uses []quotaUse, quotas []*compute.Quota) error {
+	need := map[string]float64{}
+	users := map[string][]string{}
+	for _, u := range uses {
+		need[u.metric] += u.amount
+		if id := string(u.module); !slices.Contains(users[u.metric], id) {
+			users[u.metric] = append(users[u.metric], id)
+		}
+	}
+
+	sort.Slice(quotas, func(i, j int) bool { return quotas[i].Metric < quotas[j].Metric })
+	errs := config.Errors{}
+	for _, q := range quotas {
+		n, ok := need[q.Metric]
+		if !ok || q.Usage+n <= q.Limit {
+			continue
+		}
+		r := newQuotaIncreaseRequest(projectID, region, q.Metric, q.Limit, q.Usage, n, users[q.Metric])
+		errs.Add(config.HintError{Hint: "request a quota increase at " + r.URL, Err: QuotaError{r}})
+	}
+	return errs.OrNil()
+}
+
+func testQuotaSufficient(ctx context.Context, bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{"project_id", "region", "zone"}); err != nil {
+		return err
+	}
+	m, err := inputsAsStrings(inputs)
+	if err != nil {
+		return err
+	}
+	s, err := apiclient.New(ctx, compute.NewService)
+	if err != nil {
+		return handleClientError(err)
+	}
+	region, err := s.Regions.Get(m["project_id"], m["region"]).Do()
+	if err != nil {
+		return fmt.Errorf(regionError, m["region"], m["project_id"])
+	}
+	regional := map[string]bool{}
+	for _, q := range region.Quotas {
+		regional[q.Metric] = true
+	}
+
+	type key struct{ zone, machineType string }
+	cache := map[key]*compute.MachineType{}
+	mtInfo := func(zone string, mt string) (*compute.MachineType, bool) {
+		k := key{zone, mt}
+		if _, ok := cache[k]; !ok {
+			// unavailable machine types are reported by test_machine_type_exists
+			cache[k], _ = s.MachineTypes.Get(m["project_id"], zone, mt).Do()
+		}
+		return cache[k], cache[k] != nil
+	}
+
+	uses := []quotaUse{}
+	bp.WalkModulesSafe(func(_ config.ModulePath, mod *config.Module) {
+		uses = append(uses, moduleQuotaUses(bp, *mod, m["zone"], mtInfo, regional)...)
+	})
+	return checkQuotas(m["project_id"], m["region"], uses, region.Quotas)
+}
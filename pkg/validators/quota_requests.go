@@ -0,0 +1,103 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"errors"
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"net/url"
+	"strings"
+)
+
+// QuotaIncreaseRequest is an increase of a regional Compute Engine quota of the
+// project that the deployment needs
+type QuotaIncreaseRequest struct {
+	Project       string   `json:"project"`
+	Region        string   `json:"region"`
+	Metric        string   `json:"metric"`       // as reported by Compute Engine API, e.g. C2_CPUS
+	QuotaMetric   string   `json:"quota_metric"` // as used by Cloud Quotas API, e.g. compute.googleapis.com/c2_cpus
+	CurrentLimit  float64  `json:"current_limit"`
+	CurrentUsage  float64  `json:"current_usage"`
+	Required      float64  `json:"required"`       // usage added by the deployment
+	RequiredLimit float64  `json:"required_limit"` // lowest limit that fits the deployment
+	Modules       []string `json:"modules"`
+	URL           string   `json:"url"` // quotas page of the Cloud Console filtered to the metric and region
+}
+
+// newQuotaIncreaseRequest returns request for the quota that is short of usage required by modules
+func newQuotaIncreaseRequest(project string, region string, metric string, limit float64, usage float64, required float64, modules []string) QuotaIncreaseRequest {
+	qm := quotaMetricName(metric)
+	q := url.Values{}
+	q.Set("project", project)
+	q.Set("service", "compute.googleapis.com")
+	q.Set("metric", qm)
+	q.Set("location", region)
+	return QuotaIncreaseRequest{
+		Project:       project,
+		Region:        region,
+		Metric:        metric,
+		QuotaMetric:   qm,
+		CurrentLimit:  limit,
+		CurrentUsage:  usage,
+		Required:      required,
+		RequiredLimit: usage + required,
+		Modules:       modules,
+		URL:           "https://console.cloud.google.com/iam-admin/quotas?" + q.Encode(),
+	}
+}
+
+// quotaMetricName returns name of the Compute Engine quota metric used by Service Usage
+// and Cloud Quotas APIs, e.g. SSD_TOTAL_GB is compute.googleapis.com/ssd_total_storage
+func quotaMetricName(metric string) string {
+	m := strings.ToLower(metric)
+	if s, ok := strings.CutSuffix(m, "_total_gb"); ok {
+		m = s + "_total_storage"
+	}
+	return "compute.googleapis.com/" + m
+}
+
+// QuotaError is a failure of a validator for a quota that the deployment would exceed
+type QuotaError struct {
+	Request QuotaIncreaseRequest
+}
+
+func (e QuotaError) Error() string {
+	r := e.Request
+	quoted := []string{}
+	for _, id := range r.Modules {
+		quoted = append(quoted, fmt.Sprintf("%q", id))
+	}
+	return fmt.Sprintf("deployment requires %g of %s quota in region %s, but only %g of %g is available; required by modules %s",
+		r.Required, r.Metric, r.Region, r.CurrentLimit-r.CurrentUsage, r.CurrentLimit, strings.Join(quoted, ", "))
+}
+
+// QuotaIncreaseRequests returns quota increases needed by the deployment, as reported
+// by failures of validators among the errors returned by Execute
+func QuotaIncreaseRequests(err error) []QuotaIncreaseRequest {
+	var multi config.Errors // does not unwrap to its findings
+	if errors.As(err, &multi) {
+		res := []QuotaIncreaseRequest{}
+		for _, e := range multi.Errors {
+			res = append(res, QuotaIncreaseRequests(e)...)
+		}
+		return res
+	}
+	var qe QuotaError
+	if errors.As(err, &qe) {
+		return []QuotaIncreaseRequest{qe.Request}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"errors"
+	"hpc-toolkit/pkg/config"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestQuotaIncreaseRequests(c *C) {
+	cpus := newQuotaIncreaseRequest("p", "us-central1", "C2_CPUS", 500, 100, 480, []string{"a", "b"})
+	c.Check(cpus.RequiredLimit, Equals, 580.0)
+	c.Check(cpus.QuotaMetric, Equals, "compute.googleapis.com/c2_cpus")
+	c.Check(cpus.URL, Equals, "https://console.cloud.google.com/iam-admin/quotas?"+
+		"location=us-central1&metric=compute.googleapis.com%2Fc2_cpus&project=p&service=compute.googleapis.com")
+	c.Check(QuotaError{cpus}, ErrorMatches,
+		`deployment requires 480 of C2_CPUS quota in region us-central1, but only 400 of 500 is available; required by modules "a", "b"`)
+
+	ssd := newQuotaIncreaseRequest("p", "us-central1", "SSD_TOTAL_GB", 1000, 0, 2000, []string{"b"})
+	c.Check(ssd.QuotaMetric, Equals, "compute.googleapis.com/ssd_total_storage")
+
+	errs := config.Errors{}
+	errs.Add(config.HintError{Hint: "request an increase", Err: QuotaError{cpus}})
+	errs.Add(errors.New("other"))
+	errs.Add(QuotaError{ssd})
+	c.Check(QuotaIncreaseRequests(errs.OrNil()), DeepEquals, []QuotaIncreaseRequest{cpus, ssd})
+	c.Check(QuotaIncreaseRequests(ValidatorError{Validator: "v", Err: QuotaError{ssd}}), DeepEquals, []QuotaIncreaseRequest{ssd})
+	c.Check(QuotaIncreaseRequests(errors.New("other")), IsNil)
+}
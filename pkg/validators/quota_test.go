@@ -0,0 +1,94 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"hpc-toolkit/pkg/config"
+
+	"github.com/zclconf/go-cty/cty"
+	compute "google.golang.org/api/compute/v1"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestQuotaMetrics(c *C) {
+	regional := map[string]bool{"CPUS": true, "C2_CPUS": true}
+	c.Check(cpuQuotaMetric("c2-standard-60", false, regional), Equals, "C2_CPUS")
+	c.Check(cpuQuotaMetric("n1-standard-8", false, regional), Equals, "CPUS")
+	c.Check(cpuQuotaMetric("c2-standard-60", true, regional), Equals, "PREEMPTIBLE_CPUS")
+
+	c.Check(gpuQuotaMetric("nvidia-tesla-a100", false), Equals, "NVIDIA_A100_GPUS")
+	c.Check(gpuQuotaMetric("nvidia-a100-80gb", false), Equals, "NVIDIA_A100_80GB_GPUS")
+	c.Check(gpuQuotaMetric("nvidia-l4", true), Equals, "PREEMPTIBLE_NVIDIA_L4_GPUS")
+}
+
+func (s *MySuite) TestModuleQuotaUses(c *C) {
+	mtInfo := func(zone string, mt string) (*compute.MachineType, bool) {
+		switch mt {
+		case "c2-standard-60":
+			return &compute.MachineType{GuestCpus: 60}, true
+		case "a2-highgpu-2g":
+			return &compute.MachineType{GuestCpus: 24, Accelerators: []*compute.MachineTypeAccelerators{
+				{GuestAcceleratorType: "nvidia-tesla-a100", GuestAcceleratorCount: 2}}}, true
+		}
+		return nil, false
+	}
+	regional := map[string]bool{"CPUS": true, "C2_CPUS": true, "A2_CPUS": true}
+	uses := func(settings map[string]cty.Value) []quotaUse {
+		m := config.Module{ID: "m", Settings: config.NewDict(settings)}
+		bp := config.Blueprint{Groups: []config.Group{{Name: "g", Modules: []config.Module{m}}}}
+		return moduleQuotaUses(bp, m, "us-central1-a", mtInfo, regional)
+	}
+
+	c.Check(uses(map[string]cty.Value{
+		"machine_type":           cty.StringVal("c2-standard-60"),
+		"node_count_static":      cty.NumberIntVal(2),
+		"node_count_dynamic_max": cty.NumberIntVal(8),
+		"disk_size_gb":           cty.NumberIntVal(100),
+		"disk_type":              cty.StringVal("pd-ssd")}),
+		DeepEquals, []quotaUse{{"C2_CPUS", 600, "m"}, {"SSD_TOTAL_GB", 1000, "m"}})
+
+	c.Check(uses(map[string]cty.Value{
+		"machine_type": cty.StringVal("a2-highgpu-2g"),
+		"spot":         cty.True}),
+		DeepEquals, []quotaUse{{"PREEMPTIBLE_CPUS", 24, "m"}, {"PREEMPTIBLE_NVIDIA_A100_GPUS", 2, "m"}})
+
+	c.Check(uses(map[string]cty.Value{
+		"machine_type":   cty.StringVal("n1-standard-8"), // not known
+		"instance_count": cty.NumberIntVal(4),
+		"guest_accelerator": cty.TupleVal([]cty.Value{cty.ObjectVal(map[string]cty.Value{
+			"type": cty.StringVal("nvidia-tesla-t4"), "count": cty.NumberIntVal(1)})})}),
+		DeepEquals, []quotaUse{{"NVIDIA_T4_GPUS", 4, "m"}})
+
+	c.Check(uses(map[string]cty.Value{"instance_count": cty.NumberIntVal(0), "machine_type": cty.StringVal("c2-standard-60")}), IsNil)
+}
+
+func (s *MySuite) TestCheckQuotas(c *C) {
+	quotas := []*compute.Quota{
+		{Metric: "C2_CPUS", Limit: 500, Usage: 100},
+		{Metric: "SSD_TOTAL_GB", Limit: 10000, Usage: 0}}
+
+	c.Check(checkQuotas("p", "r", []quotaUse{
+		{"C2_CPUS", 300, "a"}, {"SSD_TOTAL_GB", 1000, "a"}, {"NOT_A_QUOTA", 1e9, "a"}}, quotas), IsNil)
+
+	c.Check(checkQuotas("p", "r", []quotaUse{
+		{"C2_CPUS", 300, "a"}, {"C2_CPUS", 120, "b"}, {"C2_CPUS", 60, "b"}}, quotas),
+		ErrorMatches, `.*deployment requires 480 of C2_CPUS quota in region r, but only 400 of 500 is available; required by modules "a", "b".*`)
+
+	err := checkQuotas("p", "r", []quotaUse{{"C2_CPUS", 600, "a"}, {"SSD_TOTAL_GB", 20000, "b"}}, quotas)
+	c.Check(QuotaIncreaseRequests(ValidatorError{Validator: testQuotaSufficientName, Err: err}), DeepEquals, []QuotaIncreaseRequest{
+		newQuotaIncreaseRequest("p", "r", "C2_CPUS", 500, 100, 600, []string{"a"}),
+		newQuotaIncreaseRequest("p", "r", "SSD_TOTAL_GB", 10000, 0, 20000, []string{"b"}),
+	})
+}
@@ -0,0 +1,130 @@
+// Copyright 2024 "Google LLC"
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"context"
+	"fmt"
+	"hpc-toolkit/pkg/apiclient"
+	"hpc-toolkit/pkg/config"
+	"regexp"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/slices"
+	compute "google.golang.org/api/compute/v1"
+)
+
+// ResourceRef is a reference to a Compute Engine resource,
+// possibly located in a different project.
+type ResourceRef struct {
+	Project string
+	Region  string // empty for global resources
+	Kind    string // "networks", "subnetworks", "images" or "family"
+	Name    string
+}
+
+const computeURLPrefix = "https://www.googleapis.com/compute/v1/"
+
+var resourceRefPatterns = map[string]*regexp.Regexp{
+	"networks":    regexp.MustCompile(`^projects/([^/]+)/global/networks/([^/]+)$`),
+	"subnetworks": regexp.MustCompile(`^projects/([^/]+)/regions/([^/]+)/subnetworks/([^/]+)$`),
+	"images":      regexp.MustCompile(`^projects/([^/]+)/global/images/([^/]+)$`),
+	"family":      regexp.MustCompile(`^projects/([^/]+)/global/images/family/([^/]+)$`),
+}
+
+var resourceRefPrefix = regexp.MustCompile(`^projects/[^/]*/(global/(networks|images)|regions/[^/]*/subnetworks)(/|$)`)
+
+// looksLikeResourceRef returns true if string is intended to be a reference
+// to one of supported resource kinds
+func looksLikeResourceRef(s string) bool {
+	return resourceRefPrefix.MatchString(strings.TrimPrefix(s, computeURLPrefix))
+}
+
+// ParseResourceRef parses a resource reference in either a self-link
+// or a relative ("projects/...") form.
+func ParseResourceRef(s string) (ResourceRef, error) {
+	rel := strings.TrimPrefix(s, computeURLPrefix)
+	for kind, re := range resourceRefPatterns {
+		m := re.FindStringSubmatch(rel)
+		if m == nil {
+			continue
+		}
+		if kind == "subnetworks" {
+			return ResourceRef{Project: m[1], Region: m[2], Kind: kind, Name: m[3]}, nil
+		}
+		return ResourceRef{Project: m[1], Kind: kind, Name: m[2]}, nil
+	}
+	return ResourceRef{}, config.HintError{
+		Hint: "supported formats are projects/PROJECT/global/networks/NAME, projects/PROJECT/regions/REGION/subnetworks/NAME, " +
+			"projects/PROJECT/global/images/NAME and projects/PROJECT/global/images/family/FAMILY",
+		Err: fmt.Errorf("malformed resource reference %q", s)}
+}
+
+// TestResourceRefAccessible whether referenced resource exists / is accessible with credentials
+func TestResourceRefAccessible(ctx context.Context, r ResourceRef) error {
+	s, err := apiclient.New(ctx, compute.NewService)
+	if err != nil {
+		return handleClientError(err)
+	}
+
+	switch r.Kind {
+	case "networks":
+		_, err = s.Networks.Get(r.Project, r.Name).Fields().Do()
+	case "subnetworks":
+		_, err = s.Subnetworks.Get(r.Project, r.Region, r.Name).Fields().Do()
+	case "images":
+		_, err = s.Images.Get(r.Project, r.Name).Fields().Do()
+	case "family":
+		_, err = s.Images.GetFromFamily(r.Project, r.Name).Fields().Do()
+	default:
+		return fmt.Errorf("unsupported resource kind %q", r.Kind)
+	}
+	if err != nil {
+		return fmt.Errorf("%s %q in project %s does not exist or your credentials do not have permission to access it", r.Kind, r.Name, r.Project)
+	}
+	return nil
+}
+
+func testResourceReferences(ctx context.Context, bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{}); err != nil {
+		return err
+	}
+	errs := config.Errors{}
+	bp.WalkModulesSafe(func(p config.ModulePath, m *config.Module) {
+		keys := m.Settings.Keys()
+		slices.Sort(keys) // report findings in order of their paths
+		for _, k := range keys {
+			ev, err := bp.Eval(m.Settings.Get(k))
+			if err != nil {
+				continue // can not inspect module outputs and unsupported functions
+			}
+			cty.Walk(ev, func(cp cty.Path, v cty.Value) (bool, error) {
+				if v.IsNull() || !v.IsKnown() || v.Type() != cty.String || !looksLikeResourceRef(v.AsString()) {
+					return true, nil
+				}
+				sp := p.Settings.Dot(k).Cty(cp)
+				r, err := ParseResourceRef(v.AsString())
+				if err != nil {
+					errs.At(sp, err)
+					return true, nil
+				}
+				errs.At(sp, TestResourceRefAccessible(ctx, r))
+				return true, nil
+			})
+		}
+	})
+	return errs.OrNil()
+}
@@ -0,0 +1,149 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// isRegionalModule tests whether the module creates or refers to regional network or
+// Filestore resources, that modules using it must be placed in the region of
+func isRegionalModule(m config.Module) bool {
+	return isPreExistingVpc(m) || strings.HasSuffix(m.Source, "network/vpc") ||
+		strings.HasSuffix(m.Source, "file-system/filestore")
+}
+
+// zoneRegion returns region of the zone, or false if it is not a zone name
+func zoneRegion(zone string) (string, bool) {
+	if strings.Count(zone, "-") != 2 {
+		return "", false
+	}
+	return zone[:strings.LastIndex(zone, "-")], true
+}
+
+// moduleRegion returns region of resources of the module, set by `region` setting or
+// derived from `zone`
+func moduleRegion(bp config.Blueprint, m config.Module) (string, bool) {
+	if r, ok := evalStringSetting(bp, m, "region"); ok && r != "" {
+		return r, true
+	}
+	if z, ok := evalStringSetting(bp, m, "zone"); ok {
+		return zoneRegion(z)
+	}
+	return "", false
+}
+
+// placement is a zone or region a module places its resources in
+type placement struct {
+	path   config.Path
+	desc   string // e.g. `zone us-central1-a`
+	region string
+}
+
+// modulePlacements returns regions of resources of the module, by `zone`, elements
+// of `zones` or, if neither is known, by `region`
+func modulePlacements(bp config.Blueprint, p config.ModulePath, m config.Module) []placement {
+	if z, ok := evalStringSetting(bp, m, "zone"); ok {
+		if r, ok := zoneRegion(z); ok {
+			return []placement{{p.Settings.Dot("zone"), "zone " + z, r}}
+		}
+	}
+	res := []placement{}
+	if zs, ok := evalSetting(bp, m, "zones", cty.NilVal); ok && zs != cty.NilVal && !zs.IsNull() && zs.CanIterateElements() {
+		for it := zs.ElementIterator(); it.Next(); {
+			_, z := it.Element()
+			if z.Type() != cty.String {
+				continue
+			}
+			if r, ok := zoneRegion(z.AsString()); ok {
+				res = append(res, placement{p.Settings.Dot("zones"), "zone " + z.AsString(), r})
+			}
+		}
+	}
+	if len(res) > 0 {
+		return res
+	}
+	if r, ok := evalStringSetting(bp, m, "region"); ok && r != "" {
+		return []placement{{p.Settings.Dot("region"), "region " + r, r}}
+	}
+	return nil
+}
+
+// regionalUse is a regional resource used by a module
+type regionalUse struct {
+	region string
+	desc   string // e.g. `module "network"`
+}
+
+// regionalUses returns network and Filestore modules referred to by the module, and
+// the subnetwork of a literal `subnetwork_self_link`
+func regionalUses(bp config.Blueprint, m config.Module) []regionalUse {
+	res := []regionalUse{}
+	if ref, ok := literalSubnetwork(bp, m); ok {
+		res = append(res, regionalUse{ref.Region, fmt.Sprintf("subnetwork %q", ref.Name)})
+	}
+	seen := map[config.ModuleID]bool{}
+	for _, r := range sortedReferences(m.Settings.AsObject()) {
+		if r.GlobalVar || seen[r.Module] {
+			continue
+		}
+		seen[r.Module] = true
+		dep, err := bp.Module(r.Module)
+		if err != nil || !isRegionalModule(*dep) {
+			continue
+		}
+		if region, ok := moduleRegion(bp, *dep); ok {
+			res = append(res, regionalUse{region, fmt.Sprintf("module %q", dep.ID)})
+		}
+	}
+	return res
+}
+
+// checkModuleRegions reports modules placed outside of the region of network and
+// Filestore modules they use, across all deployment groups
+func checkModuleRegions(bp config.Blueprint) error {
+	errs := config.Errors{}
+	bp.WalkModulesSafe(func(p config.ModulePath, m *config.Module) {
+		if isRegionalModule(*m) {
+			return
+		}
+		uses := regionalUses(bp, *m)
+		if len(uses) == 0 {
+			return
+		}
+		for _, pl := range modulePlacements(bp, p, *m) {
+			for _, u := range uses {
+				if u.region == pl.region {
+					continue
+				}
+				errs.At(pl.path, config.HintError{
+					Hint: fmt.Sprintf("place module %q in region %s, or use resources of region %s", m.ID, u.region, pl.region),
+					Err:  fmt.Errorf("%s of module %q is not in region %s of %s", pl.desc, m.ID, u.region, u.desc)})
+			}
+		}
+	})
+	return errs.OrNil()
+}
+
+func testModuleRegionsConsistent(bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{}); err != nil {
+		return err
+	}
+	return checkModuleRegions(bp)
+}
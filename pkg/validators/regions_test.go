@@ -0,0 +1,69 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"hpc-toolkit/pkg/config"
+
+	"github.com/zclconf/go-cty/cty"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestZoneRegion(c *C) {
+	r, ok := zoneRegion("us-central1-a")
+	c.Check(ok, Equals, true)
+	c.Check(r, Equals, "us-central1")
+
+	_, ok = zoneRegion("us-central1")
+	c.Check(ok, Equals, false)
+}
+
+func (s *MySuite) TestCheckModuleRegions(c *C) {
+	subnet := config.ModuleRef("net", "subnetwork_self_link").AsValue()
+	fs := config.ModuleRef("fs", "network_storage").AsValue()
+	bp := config.Blueprint{Groups: []config.Group{
+		{Name: "primary", Modules: []config.Module{
+			newModule("net", "modules/network/vpc", map[string]cty.Value{"region": cty.StringVal("us-central1")}),
+			newModule("fs", "modules/file-system/filestore", map[string]cty.Value{
+				"zone":       cty.StringVal("us-east1-b"),
+				"network_id": config.ModuleRef("net", "network_id").AsValue()}),
+			newModule("ok", "modules/compute/vm-instance", map[string]cty.Value{
+				"zone":                 cty.StringVal("us-central1-a"),
+				"subnetwork_self_link": subnet}),
+		}},
+		{Name: "compute", Modules: []config.Module{
+			newModule("far", "modules/compute/vm-instance", map[string]cty.Value{
+				"zone":                 cty.StringVal("us-west1-b"),
+				"subnetwork_self_link": subnet,
+				"network_storage":      cty.TupleVal([]cty.Value{fs})}),
+			newModule("zones", "community/modules/compute/schedmd-slurm-gcp-v6-nodeset", map[string]cty.Value{
+				"zones":                cty.ListVal([]cty.Value{cty.StringVal("us-central1-a"), cty.StringVal("us-west1-a")}),
+				"subnetwork_self_link": subnet}),
+			newModule("literal", "modules/compute/vm-instance", map[string]cty.Value{
+				"region":               cty.StringVal("us-central1"),
+				"subnetwork_self_link": cty.StringVal("projects/host/regions/europe-west4/subnetworks/s")}),
+			newModule("unknown", "modules/compute/vm-instance", map[string]cty.Value{
+				"zone":                 config.ModuleRef("ok", "zone").AsValue(),
+				"subnetwork_self_link": subnet}),
+		}},
+	}}
+
+	err := checkModuleRegions(bp)
+	c.Check(err, ErrorMatches, `(?s)4 errors.*`+
+		`groups\[1\].modules\[0\].settings.zone: zone us-west1-b of module "far" is not in region us-east1 of module "fs".*`+
+		`groups\[1\].modules\[0\].settings.zone: zone us-west1-b of module "far" is not in region us-central1 of module "net".*`+
+		`groups\[1\].modules\[1\].settings.zones: zone us-west1-a of module "zones" is not in region us-central1 of module "net".*`+
+		`groups\[1\].modules\[2\].settings.region: region us-central1 of module "literal" is not in region europe-west4 of subnetwork "s".*`)
+}
@@ -0,0 +1,110 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"errors"
+	"hpc-toolkit/pkg/config"
+
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/slices"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestRegisteredValidators(c *C) {
+	defer config.UnregisterValidator("test_org_naming")
+	c.Assert(config.RegisterValidator("test_org_naming", func(bp config.Blueprint, in config.Dict) error {
+		if p := in.Get("prefix").AsString(); p != "acme" {
+			return errors.New("deployment name must start with acme")
+		}
+		return nil
+	}, []string{"prefix"}), IsNil)
+
+	use := func(inputs map[string]cty.Value) config.Blueprint {
+		return config.Blueprint{Validators: []config.Validator{{Validator: "test_org_naming", Inputs: config.NewDict(inputs)}}}
+	}
+	c.Check(Execute(use(map[string]cty.Value{"prefix": cty.StringVal("acme")})), IsNil)
+	c.Check(Execute(use(map[string]cty.Value{"prefix": cty.StringVal("emca")})), ErrorMatches, `(?s).*must start with acme.*`)
+	c.Check(Execute(use(nil)), ErrorMatches, `(?s).*a required input "prefix" was not provided.*`)
+
+	i := slices.IndexFunc(Available(), func(v ValidatorInfo) bool { return v.Name == "test_org_naming" })
+	c.Assert(i >= 0, Equals, true)
+	c.Check(Available()[i], DeepEquals, ValidatorInfo{Name: "test_org_naming", Registered: true, RequiredInputs: []string{"prefix"}})
+
+	j := slices.IndexFunc(Available(), func(v ValidatorInfo) bool { return v.Name == testZoneExistsName })
+	c.Assert(j >= 0, Equals, true)
+	c.Check(Available()[j], DeepEquals, ValidatorInfo{Name: testZoneExistsName, Dependencies: []string{testProjectExistsName}})
+
+	{ // names of built-in validators can not be registered
+		defer config.UnregisterValidator(testZoneExistsName)
+		c.Assert(config.RegisterValidator(testZoneExistsName, func(config.Blueprint, config.Dict) error { return nil }, nil), IsNil)
+		c.Check(Execute(config.Blueprint{}), ErrorMatches, `registered validator "test_zone_exists" has the name of a built-in validator`)
+	}
+}
+
+func (s *MySuite) TestValidatorSeverity(c *C) {
+	defer config.UnregisterValidator("test_always_fails")
+	c.Assert(config.RegisterValidator("test_always_fails", func(config.Blueprint, config.Dict) error {
+		return errors.New("failed")
+	}, nil), IsNil)
+	run := func(level int, severity string) (error, error) {
+		bp := config.Blueprint{ValidationLevel: level, Validators: []config.Validator{
+			{Validator: "test_always_fails", Severity: severity}}}
+		return SplitWarnings(Execute(bp), level)
+	}
+
+	{ // validation level of the blueprint by default
+		err, warnings := run(config.ValidationError, "")
+		c.Check(err, DeepEquals, ValidatorError{Validator: "test_always_fails", Err: errors.New("failed"), Level: config.ValidationError})
+		c.Check(warnings, IsNil)
+
+		err, warnings = run(config.ValidationWarning, "")
+		c.Check(err, IsNil)
+		c.Check(warnings, ErrorMatches, `(?s).*"test_always_fails" failed.*`)
+	}
+
+	{ // demoted to warning
+		err, warnings := run(config.ValidationError, "WARNING")
+		c.Check(err, IsNil)
+		c.Check(warnings, DeepEquals, ValidatorError{Validator: "test_always_fails", Err: errors.New("failed"), Level: config.ValidationWarning})
+	}
+
+	{ // kept as error
+		err, warnings := run(config.ValidationWarning, "ERROR")
+		c.Check(err, NotNil)
+		c.Check(warnings, IsNil)
+	}
+
+	{ // ignored
+		err, warnings := run(config.ValidationError, "IGNORE")
+		c.Check(err, IsNil)
+		c.Check(warnings, IsNil)
+	}
+
+	{ // invalid severity
+		err, _ := run(config.ValidationError, "FATAL")
+		c.Check(err, ErrorMatches, `.*invalid validation level "FATAL".*`)
+		var be config.BpError
+		c.Assert(errors.As(err, &be), Equals, true)
+		c.Check(be.Path.String(), Equals, config.Root.Validators.At(0).Severity.String())
+	}
+
+	{ // other errors follow the validation level
+		err := errors.New("unknown validator")
+		e, w := SplitWarnings(config.Errors{Errors: []error{err, ValidatorError{Validator: "v", Err: err}}}, config.ValidationWarning)
+		c.Check(e, DeepEquals, ValidatorError{Validator: "v", Err: err})
+		c.Check(w, Equals, err)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"context"
+	"fmt"
+	"hpc-toolkit/pkg/apiclient"
+	"hpc-toolkit/pkg/config"
+	"path"
+	"regexp"
+	"strings"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+	compute "google.golang.org/api/compute/v1"
+)
+
+// reservationRef is a specific reservation consumed by a module
+type reservationRef struct {
+	project string
+	zone    string
+	name    string
+}
+
+func (r reservationRef) String() string {
+	return fmt.Sprintf("reservation %q in zone %s in project %s", r.name, r.zone, r.project)
+}
+
+// sharedReservationRe matches reservations shared from other projects
+var sharedReservationRe = regexp.MustCompile(`^projects/([^/]+)/reservations/([^/]+)$`)
+
+// moduleReservationRef returns the reservation set by `reservation_name` of the module.
+// Reservations are looked up in the project and zone of the module, or in defaultProject
+// and defaultZone if the module does not set them.
+func moduleReservationRef(bp config.Blueprint, m config.Module, defaultProject string, defaultZone string) (reservationRef, bool) {
+	name, ok := evalStringSetting(bp, m, "reservation_name")
+	if !ok || name == "" {
+		return reservationRef{}, false
+	}
+	r := reservationRef{project: defaultProject, zone: defaultZone, name: name}
+	if p, ok := evalStringSetting(bp, m, "project_id"); ok && p != "" {
+		r.project = p
+	}
+	if z, ok := evalStringSetting(bp, m, "zone"); ok && z != "" {
+		r.zone = z
+	}
+	if match := sharedReservationRe.FindStringSubmatch(name); match != nil {
+		r.project, r.name = match[1], match[2]
+	}
+	return r, true
+}
+
+// checkReservation checks that the reservation can be consumed by instances of the module:
+// it must be a specific reservation of the same machine type and accelerators
+func checkReservation(r reservationRef, res *compute.Reservation, machineType string, accs []accelerator) error {
+	if !res.SpecificReservationRequired {
+		return config.HintError{
+			Hint: "create the reservation with `--require-specific-reservation`",
+			Err:  fmt.Errorf("%s is consumed automatically by any matching instance, modules can only use SPECIFIC reservations", r)}
+	}
+	if res.SpecificReservation == nil || res.SpecificReservation.InstanceProperties == nil {
+		return nil
+	}
+	props := res.SpecificReservation.InstanceProperties
+	if machineType != "" && props.MachineType != "" && path.Base(props.MachineType) != machineType {
+		return config.HintError{
+			Hint: fmt.Sprintf("set machine_type to %q", path.Base(props.MachineType)),
+			Err:  fmt.Errorf("%s reserves machine type %s, but the module uses %s", r, path.Base(props.MachineType), machineType)}
+	}
+	reserved := map[string]int64{}
+	for _, ga := range props.GuestAccelerators {
+		reserved[path.Base(ga.AcceleratorType)] += ga.AcceleratorCount
+	}
+	for _, a := range accs {
+		if reserved[a.typ] == a.count {
+			continue
+		}
+		have := []string{}
+		for _, t := range maps.Keys(reserved) {
+			have = append(have, fmt.Sprintf("%d x %s", reserved[t], t))
+		}
+		slices.Sort(have)
+		if len(have) == 0 {
+			have = append(have, "no accelerators")
+		}
+		return fmt.Errorf("%s reserves %s, but the module attaches %d x %s", r, strings.Join(have, ", "), a.count, a.typ)
+	}
+	return nil
+}
+
+// moduleAcceleratorList returns accelerators of the module in order of `guest_accelerator`
+func moduleAcceleratorList(bp config.Blueprint, m config.Module) []accelerator {
+	accs := moduleAccelerators(bp, m)
+	idx := maps.Keys(accs)
+	slices.Sort(idx)
+	res := []accelerator{}
+	for _, i := range idx {
+		res = append(res, accs[i])
+	}
+	return res
+}
+
+func testReservationExists(ctx context.Context, bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{"project_id", "zone"}); err != nil {
+		return err
+	}
+	m, err := inputsAsStrings(inputs)
+	if err != nil {
+		return err
+	}
+
+	type use struct {
+		path config.ModulePath
+		mod  config.Module
+		ref  reservationRef
+	}
+	uses := []use{}
+	bp.WalkModulesSafe(func(p config.ModulePath, mod *config.Module) {
+		if r, ok := moduleReservationRef(bp, *mod, m["project_id"], m["zone"]); ok {
+			uses = append(uses, use{p, *mod, r})
+		}
+	})
+	if len(uses) == 0 {
+		return nil
+	}
+
+	s, err := apiclient.New(ctx, compute.NewService)
+	if err != nil {
+		return handleClientError(err)
+	}
+	reservations := map[reservationRef]*compute.Reservation{}
+	errs := config.Errors{}
+	for _, u := range uses {
+		res, ok := reservations[u.ref]
+		if !ok {
+			if res, err = s.Reservations.Get(u.ref.project, u.ref.zone, u.ref.name).Do(); err != nil {
+				res = nil
+			}
+			reservations[u.ref] = res
+		}
+		at := u.path.Settings.Dot("reservation_name")
+		if res == nil {
+			errs.At(at, config.HintError{
+				Hint: fmt.Sprintf("list reservations with `gcloud compute reservations list --project %s`", u.ref.project),
+				Err:  fmt.Errorf("%s does not exist or your credentials do not have permission to access it", u.ref)})
+			continue
+		}
+		mt, _ := evalStringSetting(bp, u.mod, "machine_type")
+		errs.At(at, checkReservation(u.ref, res, mt, moduleAcceleratorList(bp, u.mod)))
+	}
+	return errs.OrNil()
+}
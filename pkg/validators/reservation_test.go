@@ -0,0 +1,77 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"hpc-toolkit/pkg/config"
+
+	"github.com/zclconf/go-cty/cty"
+	compute "google.golang.org/api/compute/v1"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestModuleReservationRef(c *C) {
+	bp := config.Blueprint{}
+	mod := func(kv ...string) config.Module {
+		m := map[string]cty.Value{}
+		for i := 0; i < len(kv); i += 2 {
+			m[kv[i]] = cty.StringVal(kv[i+1])
+		}
+		return newModule("nodeset", "", m)
+	}
+
+	_, ok := moduleReservationRef(bp, mod(), "prj", "zone-a")
+	c.Check(ok, Equals, false)
+	_, ok = moduleReservationRef(bp, mod("reservation_name", ""), "prj", "zone-a")
+	c.Check(ok, Equals, false)
+
+	r, ok := moduleReservationRef(bp, mod("reservation_name", "res"), "prj", "zone-a")
+	c.Check(ok, Equals, true)
+	c.Check(r, DeepEquals, reservationRef{project: "prj", zone: "zone-a", name: "res"})
+
+	r, _ = moduleReservationRef(bp, mod("reservation_name", "res", "zone", "zone-b", "project_id", "own"), "prj", "zone-a")
+	c.Check(r, DeepEquals, reservationRef{project: "own", zone: "zone-b", name: "res"})
+
+	r, _ = moduleReservationRef(bp, mod("reservation_name", "projects/shared/reservations/res"), "prj", "zone-a")
+	c.Check(r, DeepEquals, reservationRef{project: "shared", zone: "zone-a", name: "res"})
+}
+
+func (s *MySuite) TestCheckReservation(c *C) {
+	r := reservationRef{project: "prj", zone: "zone-a", name: "res"}
+	res := func(specific bool, mt string, accs ...*compute.AcceleratorConfig) *compute.Reservation {
+		return &compute.Reservation{
+			SpecificReservationRequired: specific,
+			SpecificReservation: &compute.AllocationSpecificSKUReservation{
+				InstanceProperties: &compute.AllocationSpecificSKUAllocationReservedInstanceProperties{
+					MachineType:       mt,
+					GuestAccelerators: accs,
+				}}}
+	}
+	l4 := &compute.AcceleratorConfig{AcceleratorType: "nvidia-l4", AcceleratorCount: 2}
+
+	c.Check(checkReservation(r, res(true, "g2-standard-24", l4), "g2-standard-24", nil), IsNil)
+	c.Check(checkReservation(r, res(true, "g2-standard-24", l4), "", nil), IsNil)
+	c.Check(checkReservation(r, res(true, "n2-standard-8"), "n2-standard-8", []accelerator{}), IsNil)
+	c.Check(checkReservation(r, &compute.Reservation{SpecificReservationRequired: true}, "c2-standard-60", nil), IsNil)
+
+	c.Check(checkReservation(r, res(false, "n2-standard-8"), "n2-standard-8", nil),
+		ErrorMatches, ".*consumed automatically.*")
+	c.Check(checkReservation(r, res(true, "n2-standard-8"), "c2-standard-60", nil),
+		ErrorMatches, ".*reserves machine type n2-standard-8, but the module uses c2-standard-60 - .*")
+	c.Check(checkReservation(r, res(true, "n1-standard-8", l4), "n1-standard-8", []accelerator{{"nvidia-l4", 1}}),
+		ErrorMatches, ".*reserves 2 x nvidia-l4, but the module attaches 1 x nvidia-l4")
+	c.Check(checkReservation(r, res(true, "n1-standard-8"), "n1-standard-8", []accelerator{{"nvidia-tesla-t4", 1}}),
+		ErrorMatches, ".*reserves no accelerators, but the module attaches 1 x nvidia-tesla-t4")
+}
@@ -0,0 +1,205 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hpc-toolkit/pkg/apiclient"
+	"hpc-toolkit/pkg/config"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/slices"
+	"google.golang.org/api/googleapi"
+	secretmanager "google.golang.org/api/secretmanager/v1"
+)
+
+// secretAccessPermission is the permission of roles/secretmanager.secretAccessor to read secrets
+const secretAccessPermission = "secretmanager.versions.access"
+
+var (
+	secretRefRe = regexp.MustCompile(`^projects/([^/]+)/secrets/([^/]+)(?:/versions/([^/]+))?$`)
+	// secrets read by startup scripts
+	gcloudSecretRe = regexp.MustCompile(`gcloud\s+secrets\s+versions\s+access\s+(\S+)\s+--secret[=\s]+([\w-]+)([^\n;|&]*)`)
+	projectFlagRe  = regexp.MustCompile(`--project[=\s]+([\w:.-]+)`)
+)
+
+// secretRef is a reference to a Secret Manager secret, or to a version of it
+type secretRef struct {
+	project string
+	name    string
+	version string // empty if the version is not referred to
+}
+
+func (r secretRef) String() string {
+	s := fmt.Sprintf("secret %q of project %s", r.name, r.project)
+	if r.version != "" && r.version != "latest" {
+		s = fmt.Sprintf("version %s of %s", r.version, s)
+	}
+	return s
+}
+
+func (r secretRef) resource() string {
+	return fmt.Sprintf("projects/%s/secrets/%s", r.project, r.name)
+}
+
+// secretRefs returns secrets the string refers to, by resource name or by
+// `gcloud secrets versions access` commands. Secrets of commands without
+// `--project` flag are looked up in defaultProject.
+func secretRefs(s string, defaultProject string) []secretRef {
+	if m := secretRefRe.FindStringSubmatch(s); m != nil {
+		return []secretRef{{project: m[1], name: m[2], version: m[3]}}
+	}
+	res := []secretRef{}
+	for _, m := range gcloudSecretRe.FindAllStringSubmatch(s, -1) {
+		r := secretRef{project: defaultProject, name: m[2], version: m[1]}
+		if p := projectFlagRe.FindStringSubmatch(m[3]); p != nil {
+			r.project = p[1]
+		}
+		if strings.Contains(r.version, "$") {
+			continue // set by the script
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+// secretLookups query Secret Manager
+type secretLookups struct {
+	// granted returns permissions the credentials in use have on the secret
+	granted func(r secretRef) ([]string, error)
+	// versionState returns state of the secret version, e.g. "ENABLED"
+	versionState func(r secretRef) (string, error)
+}
+
+// checkSecret checks that the secret exists and the credentials in use can access it
+func checkSecret(r secretRef, lookup secretLookups) error {
+	granted, err := lookup.granted(r)
+	var herr *googleapi.Error
+	switch {
+	case errors.As(err, &herr) && herr.Code == http.StatusNotFound:
+		return config.HintError{
+			Hint: fmt.Sprintf("create the secret with `gcloud secrets create %s --project %s --data-file FILE`", r.name, r.project),
+			Err:  fmt.Errorf("secret %q of project %s does not exist", r.name, r.project)}
+	case err != nil:
+		return fmt.Errorf("failed to test permissions on secret %q of project %s: %w", r.name, r.project, err)
+	case !slices.Contains(granted, secretAccessPermission):
+		return config.HintError{
+			Hint: fmt.Sprintf("grant roles/secretmanager.secretAccessor with `gcloud secrets add-iam-policy-binding %s --project %s "+
+				"--member MEMBER --role roles/secretmanager.secretAccessor`", r.name, r.project),
+			Err: fmt.Errorf("credentials in use lack permission %s on %s", secretAccessPermission, r)}
+	}
+
+	if r.version == "" || r.version == "latest" {
+		return nil
+	}
+	state, err := lookup.versionState(r)
+	if errors.As(err, &herr) && herr.Code == http.StatusNotFound {
+		return config.HintError{
+			Hint: fmt.Sprintf("list versions with `gcloud secrets versions list %s --project %s`", r.name, r.project),
+			Err:  fmt.Errorf("%s does not exist", r)}
+	}
+	if err != nil || state == "ENABLED" {
+		return nil // reading versions requires more than access to them
+	}
+	return config.HintError{
+		Hint: fmt.Sprintf("enable the version with `gcloud secrets versions enable %s --secret %s --project %s`, or refer to another version",
+			r.version, r.name, r.project),
+		Err: fmt.Errorf("%s is %s", r, strings.ToLower(state))}
+}
+
+// secretUse is a secret referred to by a module setting
+type secretUse struct {
+	path config.Path
+	ref  secretRef
+}
+
+// secretUses returns secrets referred to by settings of modules
+func secretUses(bp config.Blueprint, defaultProject string) []secretUse {
+	res := []secretUse{}
+	bp.WalkModulesSafe(func(p config.ModulePath, m *config.Module) {
+		keys := m.Settings.Keys()
+		slices.Sort(keys)
+		for _, k := range keys {
+			ev, err := bp.Eval(m.Settings.Get(k))
+			if err != nil {
+				continue // can not inspect module outputs and unsupported functions
+			}
+			cty.Walk(ev, func(cp cty.Path, v cty.Value) (bool, error) {
+				if v.IsNull() || !v.IsKnown() || v.Type() != cty.String {
+					return true, nil
+				}
+				for _, r := range secretRefs(v.AsString(), defaultProject) {
+					res = append(res, secretUse{p.Settings.Dot(k).Cty(cp), r})
+				}
+				return true, nil
+			})
+		}
+	})
+	return res
+}
+
+// checkSecrets reports secrets that do not exist or can not be accessed with the
+// credentials in use
+func checkSecrets(uses []secretUse, lookup secretLookups) error {
+	checked := map[secretRef]error{}
+	errs := config.Errors{}
+	for _, u := range uses {
+		if _, ok := checked[u.ref]; !ok {
+			checked[u.ref] = checkSecret(u.ref, lookup)
+		}
+		errs.At(u.path, checked[u.ref])
+	}
+	return errs.OrNil()
+}
+
+func testSecretsAccessible(ctx context.Context, bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{"project_id"}); err != nil {
+		return err
+	}
+	m, err := inputsAsStrings(inputs)
+	if err != nil {
+		return err
+	}
+	uses := secretUses(bp, m["project_id"])
+	if len(uses) == 0 {
+		return nil
+	}
+	s, err := apiclient.New(ctx, secretmanager.NewService)
+	if err != nil {
+		return handleClientError(err)
+	}
+	return checkSecrets(uses, secretLookups{
+		granted: func(r secretRef) ([]string, error) {
+			resp, err := s.Projects.Secrets.TestIamPermissions(r.resource(), &secretmanager.TestIamPermissionsRequest{
+				Permissions: []string{secretAccessPermission}}).Do()
+			if err != nil {
+				return nil, err
+			}
+			return resp.Permissions, nil
+		},
+		versionState: func(r secretRef) (string, error) {
+			v, err := s.Projects.Secrets.Versions.Get(r.resource() + "/versions/" + r.version).Fields("state").Do()
+			if err != nil {
+				return "", err
+			}
+			return v.State, nil
+		},
+	})
+}
@@ -0,0 +1,83 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"hpc-toolkit/pkg/config"
+	"net/http"
+
+	"github.com/zclconf/go-cty/cty"
+	"google.golang.org/api/googleapi"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestSecretRefs(c *C) {
+	c.Check(secretRefs("projects/host/secrets/munge/versions/3", "prj"), DeepEquals,
+		[]secretRef{{project: "host", name: "munge", version: "3"}})
+	c.Check(secretRefs("projects/host/secrets/munge", "prj"), DeepEquals,
+		[]secretRef{{project: "host", name: "munge"}})
+	c.Check(secretRefs("#!/bin/bash\n"+
+		"PW=$(gcloud secrets versions access latest --secret=db-password)\n"+
+		"gcloud secrets versions access 2 --secret munge-key --project other > /etc/munge/munge.key\n"+
+		"gcloud secrets versions access $V --secret=skipped\n", "prj"), DeepEquals, []secretRef{
+		{project: "prj", name: "db-password", version: "latest"},
+		{project: "other", name: "munge-key", version: "2"},
+	})
+	c.Check(secretRefs("projects/host/global/networks/net", "prj"), HasLen, 0)
+}
+
+func (s *MySuite) TestCheckSecrets(c *C) {
+	script := "gcloud secrets versions access latest --secret=db-password"
+	bp := config.Blueprint{Groups: []config.Group{{Modules: []config.Module{
+		{ID: "ctrl", Settings: config.NewDict(map[string]cty.Value{
+			"munge_key": cty.StringVal("projects/prj/secrets/munge/versions/2"),
+			"runners": cty.TupleVal([]cty.Value{
+				cty.ObjectVal(map[string]cty.Value{"content": cty.StringVal(script)}),
+			}),
+		})},
+		{ID: "login", Settings: config.NewDict(map[string]cty.Value{
+			"startup_script": cty.StringVal(script),
+			"db":             cty.StringVal("projects/prj/secrets/missing"),
+			"old":            cty.StringVal("projects/prj/secrets/munge/versions/1"),
+		})},
+	}}}}
+
+	calls := 0
+	lookup := secretLookups{
+		granted: func(r secretRef) ([]string, error) {
+			calls++
+			switch r.name {
+			case "missing":
+				return nil, &googleapi.Error{Code: http.StatusNotFound}
+			case "db-password":
+				return []string{}, nil
+			}
+			return []string{secretAccessPermission}, nil
+		},
+		versionState: func(r secretRef) (string, error) {
+			if r.version == "1" {
+				return "DISABLED", nil
+			}
+			return "ENABLED", nil
+		},
+	}
+	err := checkSecrets(secretUses(bp, "prj"), lookup)
+	c.Check(err, ErrorMatches, `(?s)4 errors.*`+
+		`modules\[0\].settings.runners\[0\].content: credentials in use lack permission secretmanager.versions.access on secret "db-password" of project prj.*`+
+		`modules\[1\].settings.db: secret "missing" of project prj does not exist.*`+
+		`modules\[1\].settings.old: version 1 of secret "munge" of project prj is disabled.*`+
+		`modules\[1\].settings.startup_script: credentials in use lack permission .* "db-password".*`)
+	c.Check(calls, Equals, 4) // munge versions share the secret, but are checked separately
+}
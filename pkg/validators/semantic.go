@@ -17,7 +17,10 @@ package validators
 import (
 	"fmt"
 	"hpc-toolkit/pkg/config"
+	"strings"
 
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
 	"golang.org/x/exp/slices"
 )
 
@@ -49,3 +52,54 @@ func testDeploymentVariableNotUsed(bp config.Blueprint, inputs config.Dict) erro
 	}
 	return errs.OrNil()
 }
+
+// namingKey returns a string that uniquely identifies names of resources
+// created by the module, returns false if names can not be determined.
+func namingKey(bp config.Blueprint, m config.Module) (string, bool) {
+	inputs := m.InfoOrDie().Metadata.Ghpc.NamingInputs
+	if len(inputs) == 0 {
+		return "", false
+	}
+	parts := []string{m.Source}
+	for _, n := range inputs {
+		if !m.Settings.Has(n) {
+			parts = append(parts, "default")
+			continue
+		}
+		v, err := bp.Eval(m.Settings.Get(n))
+		if err != nil || !v.IsWhollyKnown() {
+			return "", false
+		}
+		if v.IsNull() {
+			parts = append(parts, "null")
+			continue
+		}
+		if v, err = convert.Convert(v, cty.String); err != nil {
+			return "", false
+		}
+		parts = append(parts, fmt.Sprintf("%q", v.AsString()))
+	}
+	return strings.Join(parts, "/"), true
+}
+
+func testResourceNamesUnique(bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{}); err != nil {
+		return err
+	}
+	errs := config.Errors{}
+	seen := map[string]config.ModuleID{}
+	bp.WalkModulesSafe(func(p config.ModulePath, m *config.Module) {
+		key, ok := namingKey(bp, *m)
+		if !ok {
+			return
+		}
+		if prev, ok := seen[key]; ok {
+			errs.At(p.ID, config.HintError{
+				Hint: "set distinct values for naming settings: " + strings.Join(m.InfoOrDie().Metadata.Ghpc.NamingInputs, ", "),
+				Err:  fmt.Errorf("module %q will create resources with the same names as module %q", m.ID, prev)})
+			return
+		}
+		seen[key] = m.ID
+	})
+	return errs.OrNil()
+}
@@ -0,0 +1,160 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"path"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// roles of modules in a Slurm cluster
+const (
+	slurmNodeset    = "nodeset"
+	slurmPartition  = "partition"
+	slurmController = "controller"
+	slurmLogin      = "login"
+)
+
+// slurmModule describes how a Slurm module refers to other modules of the cluster
+type slurmModule struct {
+	role string
+	// settings referring to nodesets of a partition, or to partitions of a controller
+	members []string
+	// settings of a controller referring to login nodes
+	logins []string
+}
+
+// slurmModules by name of their directory
+var slurmModules = map[string]slurmModule{
+	"schedmd-slurm-gcp-v5-node-group":        {role: slurmNodeset},
+	"schedmd-slurm-gcp-v5-partition":         {role: slurmPartition, members: []string{"node_groups"}},
+	"schedmd-slurm-gcp-v5-partition-dynamic": {role: slurmPartition}, // nodes register themselves
+	"schedmd-slurm-gcp-v5-controller":        {role: slurmController, members: []string{"partition"}},
+	"schedmd-slurm-gcp-v5-hybrid":            {role: slurmController, members: []string{"partition"}},
+	"schedmd-slurm-gcp-v6-nodeset":           {role: slurmNodeset},
+	"schedmd-slurm-gcp-v6-nodeset-tpu":       {role: slurmNodeset},
+	"schedmd-slurm-gcp-v6-partition":         {role: slurmPartition, members: []string{"nodeset", "nodeset_tpu", "nodeset_dyn"}},
+	"schedmd-slurm-gcp-v6-controller":        {role: slurmController, members: []string{"partitions"}, logins: []string{"login_nodes"}},
+	"schedmd-slurm-gcp-v6-login":             {role: slurmLogin},
+}
+
+// slurmModuleOf returns the description of the Slurm module of the source, or false
+// if the source is not a Slurm module
+func slurmModuleOf(source string) (slurmModule, bool) {
+	source, _, _ = strings.Cut(source, "?")
+	sm, ok := slurmModules[path.Base(source)]
+	return sm, ok
+}
+
+// referencedModules returns modules referred to by the settings of the module
+func referencedModules(m config.Module, settings []string) []config.ModuleID {
+	res := []config.ModuleID{}
+	for _, s := range settings {
+		if !m.Settings.Has(s) {
+			continue
+		}
+		for r := range config.ValueReferences(m.Settings.Get(s)) {
+			if !r.GlobalVar {
+				res = append(res, r.Module)
+			}
+		}
+	}
+	return res
+}
+
+// checkSlurmTopology checks that every partition has nodesets, every nodeset is
+// part of a partition and every partition and login module is used by a controller
+func checkSlurmTopology(bp config.Blueprint) error {
+	type located struct {
+		p  config.ModulePath
+		m  config.Module
+		sm slurmModule
+	}
+	byRole := map[string][]located{}
+	bp.WalkModulesSafe(func(p config.ModulePath, m *config.Module) {
+		if sm, ok := slurmModuleOf(m.Source); ok {
+			byRole[sm.role] = append(byRole[sm.role], located{p, *m, sm})
+		}
+	})
+	roles := map[config.ModuleID]string{}
+	for role, ls := range byRole {
+		for _, l := range ls {
+			roles[l.m.ID] = role
+		}
+	}
+
+	// modules used by partitions and controllers
+	used := map[config.ModuleID]bool{}
+	errs := config.Errors{}
+	for _, l := range byRole[slurmPartition] {
+		nodesets := 0
+		for _, id := range referencedModules(l.m, l.sm.members) {
+			if roles[id] == slurmNodeset {
+				used[id] = true
+				nodesets++
+			}
+		}
+		// nodesets may be set literally rather than by using nodeset modules
+		literal := slices.ContainsFunc(l.sm.members, func(s string) bool {
+			return l.m.Settings.Has(s) && len(config.ValueReferences(l.m.Settings.Get(s))) == 0
+		})
+		if len(l.sm.members) > 0 && nodesets == 0 && !literal {
+			errs.At(l.p.ID, config.HintError{
+				Hint: "add a nodeset module to `use` of the partition",
+				Err:  fmt.Errorf("partition module %q has no nodesets, Slurm would reject the partition", l.m.ID)})
+		}
+	}
+	for _, l := range byRole[slurmNodeset] {
+		if !used[l.m.ID] {
+			errs.At(l.p.ID, config.HintError{
+				Hint: fmt.Sprintf("add %q to `use` of a partition module", l.m.ID),
+				Err:  fmt.Errorf("nodeset module %q is not part of any partition, its nodes would never run jobs", l.m.ID)})
+		}
+	}
+
+	controllers := byRole[slurmController]
+	if len(controllers) == 0 {
+		return errs.OrNil() // e.g. partitions shared with a controller of another blueprint
+	}
+	for _, l := range controllers {
+		for _, id := range referencedModules(l.m, l.sm.members) {
+			used[id] = true
+		}
+		for _, id := range referencedModules(l.m, l.sm.logins) {
+			used[id] = true
+		}
+	}
+	for _, role := range []string{slurmPartition, slurmLogin} {
+		for _, l := range byRole[role] {
+			if !used[l.m.ID] {
+				errs.At(l.p.ID, config.HintError{
+					Hint: fmt.Sprintf("add %q to `use` of controller module %q", l.m.ID, controllers[0].m.ID),
+					Err:  fmt.Errorf("%s module %q is not used by any controller, it would not be part of the cluster", role, l.m.ID)})
+			}
+		}
+	}
+	return errs.OrNil()
+}
+
+func testSlurmTopology(bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{}); err != nil {
+		return err
+	}
+	return checkSlurmTopology(bp)
+}
@@ -0,0 +1,81 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"hpc-toolkit/pkg/config"
+
+	"github.com/zclconf/go-cty/cty"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestSlurmModuleOf(c *C) {
+	sm, ok := slurmModuleOf("community/modules/compute/schedmd-slurm-gcp-v6-partition")
+	c.Check(ok, Equals, true)
+	c.Check(sm.role, Equals, slurmPartition)
+
+	sm, ok = slurmModuleOf("github.com/GoogleCloudPlatform/hpc-toolkit//community/modules/compute/schedmd-slurm-gcp-v5-partition-dynamic?ref=v1.30.0")
+	c.Check(ok, Equals, true)
+	c.Check(sm.members, IsNil)
+
+	_, ok = slurmModuleOf("modules/compute/vm-instance")
+	c.Check(ok, Equals, false)
+}
+
+func (s *MySuite) TestCheckSlurmTopology(c *C) {
+	const (
+		nodesetSrc    = "community/modules/compute/schedmd-slurm-gcp-v6-nodeset"
+		partitionSrc  = "community/modules/compute/schedmd-slurm-gcp-v6-partition"
+		controllerSrc = "community/modules/scheduler/schedmd-slurm-gcp-v6-controller"
+		loginSrc      = "community/modules/scheduler/schedmd-slurm-gcp-v6-login"
+	)
+	// settings as set by `use`
+	uses := func(setting string, ids ...config.ModuleID) cty.Value {
+		refs := []cty.Value{}
+		for _, id := range ids {
+			refs = append(refs, config.ModuleRef(id, setting).AsValue())
+		}
+		return config.FunctionCallExpression("flatten", cty.TupleVal(refs)).AsValue()
+	}
+	bp := config.Blueprint{Groups: []config.Group{{Name: "g", Modules: []config.Module{
+		newModule("ns", nodesetSrc, nil),
+		newModule("part", partitionSrc, map[string]cty.Value{"nodeset": uses("nodeset", "ns")}),
+		newModule("login", loginSrc, nil),
+		newModule("ctrl", controllerSrc, map[string]cty.Value{
+			"partitions":  uses("partitions", "part"),
+			"login_nodes": uses("login_nodes", "login")}),
+	}}}}
+	c.Check(checkSlurmTopology(bp), IsNil)
+
+	bp.Groups[0].Modules = append(bp.Groups[0].Modules,
+		newModule("orphan", nodesetSrc, nil),
+		newModule("empty", partitionSrc, nil),
+		newModule("literal", partitionSrc, map[string]cty.Value{"nodeset": cty.ListVal([]cty.Value{cty.StringVal("x")})}),
+		newModule("other_login", loginSrc, nil))
+	err := checkSlurmTopology(bp)
+	c.Check(err, ErrorMatches, `(?s)5 errors.*`+
+		`partition module "empty" has no nodesets.*`+
+		`nodeset module "orphan" is not part of any partition.*`+
+		`partition module "empty" is not used by any controller.*`+
+		`partition module "literal" is not used by any controller.*`+
+		`login module "other_login" is not used by any controller.*`)
+	c.Check(err, Not(ErrorMatches), `.*"literal" has no nodesets.*`)
+
+	// without a controller partitions are not checked against it
+	bp.Groups[0].Modules = []config.Module{
+		newModule("ns", nodesetSrc, nil),
+		newModule("part", partitionSrc, map[string]cty.Value{"nodeset": uses("nodeset", "ns")})}
+	c.Check(checkSlurmTopology(bp), IsNil)
+}
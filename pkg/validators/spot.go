@@ -0,0 +1,160 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"hpc-toolkit/pkg/apiclient"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/logging"
+	"path"
+	"strings"
+
+	"golang.org/x/exp/slices"
+	compute "google.golang.org/api/compute/v1"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed spot_availability.yaml
+var spotAvailabilityYaml []byte
+
+// spotSignal is a machine family with historically poor Spot availability
+type spotSignal struct {
+	Family       string
+	Zones        []string
+	Description  string
+	Alternatives []string
+}
+
+func (s spotSignal) affects(zone string) bool {
+	return len(s.Zones) == 0 || slices.Contains(s.Zones, zone)
+}
+
+// spotAvailability is the table of Spot capacity signals shipped in spot_availability.yaml
+type spotAvailability struct {
+	Families []spotSignal
+}
+
+func loadSpotAvailability() (spotAvailability, error) {
+	var t spotAvailability
+	if err := yaml.Unmarshal(spotAvailabilityYaml, &t); err != nil {
+		return t, fmt.Errorf("malformed Spot availability table: %w", err)
+	}
+	return t, nil
+}
+
+// signal returns the capacity signal of the machine family in the zone
+func (t spotAvailability) signal(family string, zone string) (spotSignal, bool) {
+	for _, s := range t.Families {
+		if s.Family == family && s.affects(zone) {
+			return s, true
+		}
+	}
+	return spotSignal{}, false
+}
+
+// spotLookups query zone-level capacity of Compute Engine
+type spotLookups struct {
+	// zonesOf returns zones of the region
+	zonesOf func(region string) []string
+	// offers returns true if the machine type can be created in the zone
+	offers func(zone string, machineType string) bool
+}
+
+// spotAdvice returns warnings for modules requesting Spot VMs of a machine family
+// with poor Spot availability in their zone, suggesting alternative families and
+// zones of the same region that offer the machine type without such signal
+func spotAdvice(bp config.Blueprint, defaultZone string, t spotAvailability, lookup spotLookups) []string {
+	warnings := []string{}
+	bp.WalkModulesSafe(func(_ config.ModulePath, m *config.Module) {
+		if !isSpot(bp, *m) {
+			return
+		}
+		mt, ok := evalStringSetting(bp, *m, "machine_type")
+		if !ok || mt == "" {
+			return
+		}
+		zone := defaultZone
+		if z, ok := evalStringSetting(bp, *m, "zone"); ok && z != "" {
+			zone = z
+		}
+		family, _, _ := strings.Cut(path.Base(mt), "-")
+		s, ok := t.signal(family, zone)
+		if !ok {
+			return
+		}
+
+		msg := fmt.Sprintf("module %q requests Spot VMs of machine family %s in zone %s: %s", m.ID, family, zone, s.Description)
+		if len(s.Alternatives) > 0 {
+			msg += fmt.Sprintf("; consider machine families %s", strings.Join(s.Alternatives, ", "))
+		}
+		others := []string{}
+		if i := strings.LastIndex(zone, "-"); i > 0 {
+			for _, z := range lookup.zonesOf(zone[:i]) {
+				if _, poor := t.signal(family, z); z != zone && !poor && lookup.offers(z, mt) {
+					others = append(others, z)
+				}
+			}
+		}
+		if len(others) > 0 {
+			msg += fmt.Sprintf("; %s is also offered in zones %s", mt, strings.Join(others, ", "))
+		}
+		warnings = append(warnings, msg)
+	})
+	return warnings
+}
+
+func testSpotAvailability(ctx context.Context, bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{"project_id", "zone"}); err != nil {
+		return err
+	}
+	m, err := inputsAsStrings(inputs)
+	if err != nil {
+		return err
+	}
+	t, err := loadSpotAvailability()
+	if err != nil {
+		return err
+	}
+	s, err := apiclient.New(ctx, compute.NewService)
+	if err != nil {
+		return handleClientError(err)
+	}
+	lookup := spotLookups{
+		zonesOf: func(region string) []string {
+			r, err := s.Regions.Get(m["project_id"], region).Fields("zones").Do()
+			if err != nil {
+				return nil
+			}
+			zones := []string{}
+			for _, z := range r.Zones {
+				zones = append(zones, path.Base(z))
+			}
+			slices.Sort(zones)
+			return zones
+		},
+		offers: func(zone string, machineType string) bool {
+			_, err := s.MachineTypes.Get(m["project_id"], zone, machineType).Fields("name").Do()
+			return err == nil
+		},
+	}
+	// advisory only, Spot capacity changes over time and may be available on deployment
+	for _, w := range spotAdvice(bp, m["zone"], t, lookup) {
+		logging.Warnf(testSpotAvailabilityName, "%s", w)
+	}
+	return nil
+}
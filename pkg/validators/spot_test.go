@@ -0,0 +1,55 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"hpc-toolkit/pkg/config"
+
+	"github.com/zclconf/go-cty/cty"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestLoadSpotAvailability(c *C) {
+	t, err := loadSpotAvailability()
+	c.Assert(err, IsNil)
+	c.Check(len(t.Families) > 0, Equals, true)
+	for _, f := range t.Families {
+		c.Check(f.Description, Not(Equals), "", Commentf("family %s", f.Family))
+	}
+}
+
+func (s *MySuite) TestSpotAdvice(c *C) {
+	t := spotAvailability{Families: []spotSignal{
+		{Family: "a3", Description: "rarely available", Alternatives: []string{"a2"}},
+		{Family: "c3", Zones: []string{"us-central1-a"}, Description: "often preempted"},
+	}}
+	lookup := spotLookups{
+		zonesOf: func(region string) []string {
+			return []string{region + "-a", region + "-b", region + "-c"}
+		},
+		offers: func(zone string, machineType string) bool { return zone != "us-central1-c" },
+	}
+	bp := config.Blueprint{Groups: []config.Group{{Modules: []config.Module{
+		newModule("gpu", "", map[string]cty.Value{"machine_type": cty.StringVal("a3-highgpu-8g"), "enable_spot_vm": cty.True}),
+		newModule("cpu", "", map[string]cty.Value{"machine_type": cty.StringVal("c3-standard-88"), "provisioning_model": cty.StringVal("SPOT")}),
+		newModule("cpu_b", "", map[string]cty.Value{"machine_type": cty.StringVal("c3-standard-88"), "preemptible": cty.True, "zone": cty.StringVal("us-central1-b")}),
+		newModule("standard", "", map[string]cty.Value{"machine_type": cty.StringVal("a3-highgpu-8g")}),
+	}}}}
+
+	c.Check(spotAdvice(bp, "us-central1-a", t, lookup), DeepEquals, []string{
+		`module "gpu" requests Spot VMs of machine family a3 in zone us-central1-a: rarely available; consider machine families a2`,
+		`module "cpu" requests Spot VMs of machine family c3 in zone us-central1-a: often preempted; c3-standard-88 is also offered in zones us-central1-b`,
+	})
+}
@@ -0,0 +1,162 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"context"
+	"fmt"
+	"hpc-toolkit/pkg/apiclient"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/logging"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/crypto/ssh"
+	crm "google.golang.org/api/cloudresourcemanager/v1"
+	compute "google.golang.org/api/compute/v1"
+)
+
+const requireOsLoginConstraint = "constraints/compute.requireOsLogin"
+
+// sshKeysMetadataKeys are metadata keys of instance-level SSH keys, sshKeys is deprecated
+var sshKeysMetadataKeys = []string{"ssh-keys", "sshKeys"}
+
+// osLogin is how OS Login is configured for the project
+type osLogin struct {
+	// OS Login is required by org policy, instances can not disable it
+	required bool
+	// `enable-oslogin` of project metadata is TRUE
+	projectEnabled bool
+}
+
+// moduleMetadata returns the `metadata` setting of the module if it is known before deployment
+func moduleMetadata(bp config.Blueprint, m config.Module) (map[string]cty.Value, bool) {
+	v, err := bp.Eval(m.Settings.Get("metadata"))
+	if !m.Settings.Has("metadata") || err != nil || v.IsNull() || !v.IsWhollyKnown() ||
+		!(v.Type().IsObjectType() || v.Type().IsMapType()) {
+		return nil, false
+	}
+	return v.AsValueMap(), true
+}
+
+func metadataString(md map[string]cty.Value, key string) (string, bool) {
+	v, ok := md[key]
+	if !ok || v.IsNull() || v.Type() != cty.String {
+		return "", false
+	}
+	return v.AsString(), true
+}
+
+// checkSSHKeyLines checks entries of `ssh-keys` metadata, lines of form USERNAME:KEY
+func checkSSHKeyLines(id config.ModuleID, key string, value string) error {
+	errs := config.Errors{}
+	for i, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		user, pub, found := strings.Cut(line, ":")
+		if !found || user == "" || strings.ContainsAny(user, " \t") {
+			errs.Add(config.HintError{
+				Hint: "each line must be of form USERNAME:KEY, e.g. `alice:ssh-ed25519 AAAA... alice@example.com`",
+				Err:  fmt.Errorf("line %d of %s metadata of module %q does not start with a username", i+1, key, id)})
+			continue
+		}
+		if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(pub)); err != nil {
+			errs.Add(fmt.Errorf("line %d of %s metadata of module %q is not a valid public key of user %q: %v", i+1, key, id, user, err))
+		}
+	}
+	return errs.OrNil()
+}
+
+// checkSSHKeys reports malformed instance-level SSH keys of modules, and returns
+// warnings for modules which SSH keys are ignored because OS Login is enabled
+func checkSSHKeys(bp config.Blueprint, ol osLogin) ([]string, error) {
+	warnings := []string{}
+	errs := config.Errors{}
+	bp.WalkModulesSafe(func(p config.ModulePath, m *config.Module) {
+		md, ok := moduleMetadata(bp, *m)
+		if !ok {
+			return
+		}
+		keys := []string{}
+		for _, k := range sshKeysMetadataKeys {
+			if v, ok := metadataString(md, k); ok {
+				keys = append(keys, k)
+				errs.At(p.Settings.Dot("metadata"), checkSSHKeyLines(m.ID, k, v))
+			}
+		}
+		if len(keys) == 0 {
+			return
+		}
+
+		instance, set := metadataString(md, "enable-oslogin")
+		var reason string
+		switch {
+		case ol.required:
+			reason = fmt.Sprintf("OS Login is required by org policy %s", requireOsLoginConstraint)
+		case set && strings.EqualFold(instance, "TRUE"):
+			reason = "enable-oslogin is TRUE in metadata of the module"
+		case ol.projectEnabled && !(set && strings.EqualFold(instance, "FALSE")):
+			reason = "enable-oslogin is TRUE in project metadata"
+		default:
+			return
+		}
+		warnings = append(warnings, fmt.Sprintf("%s metadata of module %q is ignored, %s; grant users "+
+			"roles/compute.osLogin and manage keys with `gcloud compute os-login ssh-keys add` instead",
+			strings.Join(keys, " and "), m.ID, reason))
+	})
+	return warnings, errs.OrNil()
+}
+
+func testSSHKeys(ctx context.Context, bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{"project_id"}); err != nil {
+		return err
+	}
+	m, err := inputsAsStrings(inputs)
+	if err != nil {
+		return err
+	}
+	pid := m["project_id"]
+	cs, err := apiclient.New(ctx, compute.NewService)
+	if err != nil {
+		return handleClientError(err)
+	}
+	ol := osLogin{}
+	prj, err := cs.Projects.Get(pid).Fields("commonInstanceMetadata").Do()
+	if err != nil {
+		return fmt.Errorf("failed to get metadata of project %s: %w", pid, err)
+	}
+	if md := prj.CommonInstanceMetadata; md != nil {
+		for _, it := range md.Items {
+			if it.Key == "enable-oslogin" && it.Value != nil && strings.EqualFold(*it.Value, "TRUE") {
+				ol.projectEnabled = true
+			}
+		}
+	}
+	// org policies are checked by test_org_policies, which reports disabled API
+	if rs, err := apiclient.New(ctx, crm.NewService); err == nil {
+		p, err := rs.Projects.GetEffectiveOrgPolicy("projects/"+pid, &crm.GetEffectiveOrgPolicyRequest{Constraint: requireOsLoginConstraint}).Do()
+		if err == nil {
+			ol.required = orgPolicies{requireOsLoginConstraint: p}.enforced(requireOsLoginConstraint)
+		}
+	}
+
+	warnings, err := checkSSHKeys(bp, ol)
+	for _, w := range warnings {
+		logging.Warnf(testSSHKeysName, "%s", w)
+	}
+	return err
+}
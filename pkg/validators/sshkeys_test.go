@@ -0,0 +1,81 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"crypto/ed25519"
+	"hpc-toolkit/pkg/config"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/crypto/ssh"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestCheckSSHKeys(c *C) {
+	pub, _, err := ed25519.GenerateKey(nil)
+	c.Assert(err, IsNil)
+	sp, err := ssh.NewPublicKey(pub)
+	c.Assert(err, IsNil)
+	key := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sp))) + " alice@example.com"
+
+	mod := func(id config.ModuleID, md map[string]string) config.Module {
+		vals := map[string]cty.Value{}
+		for k, v := range md {
+			vals[k] = cty.StringVal(v)
+		}
+		return newModule(id, "", map[string]cty.Value{"metadata": cty.ObjectVal(vals)})
+	}
+	bp := func(ms ...config.Module) config.Blueprint {
+		return config.Blueprint{Groups: []config.Group{{Modules: ms}}}
+	}
+
+	{ // OK: valid keys, OS Login is not enabled or disabled for the instance
+		keys := mod("login", map[string]string{"ssh-keys": "alice:" + key + "\n\nbob:" + key + "\n"})
+		ws, err := checkSSHKeys(bp(keys, mod("vm", map[string]string{"startup-script": "echo"})), osLogin{})
+		c.Check(err, IsNil)
+		c.Check(ws, HasLen, 0)
+
+		disabled := mod("login", map[string]string{"ssh-keys": "alice:" + key, "enable-oslogin": "FALSE"})
+		ws, err = checkSSHKeys(bp(disabled), osLogin{projectEnabled: true})
+		c.Check(err, IsNil)
+		c.Check(ws, HasLen, 0)
+	}
+
+	{ // WARNING: keys are ignored
+		enabled := mod("login", map[string]string{"ssh-keys": "alice:" + key, "enable-oslogin": "TRUE"})
+		ws, err := checkSSHKeys(bp(enabled), osLogin{})
+		c.Check(err, IsNil)
+		c.Check(ws, DeepEquals, []string{`ssh-keys metadata of module "login" is ignored, enable-oslogin is TRUE in metadata ` +
+			"of the module; grant users roles/compute.osLogin and manage keys with `gcloud compute os-login ssh-keys add` instead"})
+
+		keys := mod("login", map[string]string{"sshKeys": "alice:" + key})
+		ws, _ = checkSSHKeys(bp(keys), osLogin{projectEnabled: true})
+		c.Check(ws, HasLen, 1)
+		c.Check(ws[0], Matches, `sshKeys metadata of module "login" is ignored, enable-oslogin is TRUE in project metadata.*`)
+
+		disabled := mod("login", map[string]string{"ssh-keys": "alice:" + key, "enable-oslogin": "false"})
+		ws, _ = checkSSHKeys(bp(disabled), osLogin{required: true, projectEnabled: true})
+		c.Check(ws, HasLen, 1)
+		c.Check(ws[0], Matches, `.*OS Login is required by org policy constraints/compute.requireOsLogin.*`)
+	}
+
+	{ // FAIL: malformed keys
+		_, err := checkSSHKeys(bp(mod("login", map[string]string{"ssh-keys": key})), osLogin{})
+		c.Check(err, ErrorMatches, `(?s).*line 1 of ssh-keys metadata of module "login" does not start with a username.*`)
+		_, err = checkSSHKeys(bp(mod("login", map[string]string{"ssh-keys": "alice:" + key + "\nbob:ssh-rsa AAAAnotakey"})), osLogin{})
+		c.Check(err, ErrorMatches, `(?s).*line 2 of ssh-keys metadata of module "login" is not a valid public key of user "bob".*`)
+	}
+}
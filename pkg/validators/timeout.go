@@ -0,0 +1,113 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/logging"
+	"net/http"
+	"time"
+
+	"golang.org/x/exp/slices"
+	"google.golang.org/api/googleapi"
+)
+
+// DefaultTimeout limits run time of validators that do not set `timeout`,
+// set by `--validator-timeout`, zero means no limit
+var DefaultTimeout = 5 * time.Minute
+
+// retryDelay returns delay before the retry attempt (starting with 0), replaced in tests
+var retryDelay = func(attempt int) time.Duration {
+	return min(time.Second<<attempt, 30*time.Second)
+}
+
+var errTimedOut = errors.New("timed out")
+
+func timeoutError(timeout time.Duration) error {
+	return config.HintError{
+		Hint: "set `timeout` or `retries` of the validator, or use `--validator-timeout`",
+		Err:  fmt.Errorf("%w after %s", errTimedOut, timeout)}
+}
+
+// parseTimeout parses `timeout` of the validator, empty value means the default
+func parseTimeout(s string) (time.Duration, error) {
+	if s == "" {
+		return DefaultTimeout, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err == nil && d < 0 {
+		err = errors.New("must not be negative")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout %q: %w", s, err)
+	}
+	return d, nil
+}
+
+// isTransient returns true if the validator may succeed when run again, validators
+// reporting several findings are run again if any of them is transient
+func isTransient(err error) bool {
+	var multi config.Errors // does not unwrap to its findings
+	if errors.As(err, &multi) {
+		return slices.ContainsFunc(multi.Errors, isTransient)
+	}
+	var herr *googleapi.Error
+	if errors.As(err, &herr) {
+		return herr.Code == http.StatusTooManyRequests || herr.Code >= http.StatusInternalServerError
+	}
+	return errors.Is(err, errTimedOut)
+}
+
+// runWithTimeout runs the validator with a context that is cancelled when it does not
+// finish in time. Validators that can not be cancelled (see config.RegisterValidator)
+// are given up on instead, the abandoned run is left to finish in the background.
+func runWithTimeout(run func(context.Context) error, cancellable bool, timeout time.Duration) error {
+	if timeout == 0 {
+		return run(context.Background())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if cancellable {
+		err := run(ctx)
+		if ctx.Err() == context.DeadlineExceeded { // failures of cancelled calls are not findings
+			return timeoutError(timeout)
+		}
+		return err
+	}
+	done := make(chan error, 1)
+	go func() { done <- run(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return timeoutError(timeout)
+	}
+}
+
+// runValidator runs the validator, retrying it after timeouts and transient API errors
+func runValidator(name string, run func(context.Context) error, cancellable bool, timeout time.Duration, retries int) error {
+	for attempt := 0; ; attempt++ {
+		err := runWithTimeout(run, cancellable, timeout)
+		if err == nil || attempt >= retries || !isTransient(err) {
+			return err
+		}
+		d := retryDelay(attempt)
+		logging.Info("validator %q failed with a transient error, retrying in %s: %s", name, d, err)
+		time.Sleep(d)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestParseTimeout(c *C) {
+	d, err := parseTimeout("")
+	c.Check(err, IsNil)
+	c.Check(d, Equals, DefaultTimeout)
+
+	d, err = parseTimeout("90s")
+	c.Check(err, IsNil)
+	c.Check(d, Equals, 90*time.Second)
+
+	_, err = parseTimeout("soon")
+	c.Check(err, ErrorMatches, `invalid timeout "soon".*`)
+	_, err = parseTimeout("-1s")
+	c.Check(err, ErrorMatches, `invalid timeout "-1s": must not be negative`)
+}
+
+func (s *MySuite) TestRunValidator(c *C) {
+	defer func(d func(int) time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = func(int) time.Duration { return 0 }
+
+	calls := 0
+	failing := func(errs ...error) func(context.Context) error {
+		calls = 0
+		return func(context.Context) error {
+			calls++
+			if calls <= len(errs) {
+				return errs[calls-1]
+			}
+			return nil
+		}
+	}
+	unavailable := fmt.Errorf("wrapped: %w", &googleapi.Error{Code: 503})
+
+	{ // transient errors are retried
+		c.Check(runValidator("v", failing(unavailable, &googleapi.Error{Code: 429}), true, 0, 2), IsNil)
+		c.Check(calls, Equals, 3)
+	}
+
+	{ // up to the number of retries
+		c.Check(runValidator("v", failing(unavailable, unavailable), true, 0, 1), Equals, unavailable)
+		c.Check(calls, Equals, 2)
+	}
+
+	{ // other errors are not
+		bad := errors.New("bad")
+		c.Check(runValidator("v", failing(bad), true, 0, 2), Equals, bad)
+		c.Check(runValidator("v", failing(&googleapi.Error{Code: 404}), true, 0, 2), NotNil)
+		c.Check(calls, Equals, 1)
+	}
+
+	{ // validators with several findings are retried if any of them is transient
+		errs := config.Errors{}
+		errs.At(config.Root.Vars.Dot("zone"), errors.New("bad zone"))
+		errs.At(config.Root.Vars.Dot("region"), unavailable)
+		c.Check(runValidator("v", failing(errs.OrNil()), true, 0, 2), IsNil)
+		c.Check(calls, Equals, 2)
+
+		persistent := (&config.Errors{}).Add(errors.New("bad zone")).Add(errors.New("bad region")).OrNil()
+		c.Check(runValidator("v", failing(persistent), true, 0, 2), DeepEquals, persistent)
+		c.Check(calls, Equals, 1)
+	}
+
+	{ // timeouts are retried
+		var slow atomic.Bool // only the first run after it is set is slow
+		slow.Store(true)
+		run := func(context.Context) error {
+			if slow.Swap(false) {
+				time.Sleep(time.Second)
+			}
+			return nil
+		}
+		err := runValidator("v", run, false, 10*time.Millisecond, 0)
+		c.Check(errors.Is(err, errTimedOut), Equals, true)
+		c.Check(err, ErrorMatches, `timed out after 10ms.*`)
+
+		slow.Store(true)
+		c.Check(runValidator("v", run, false, 10*time.Millisecond, 1), IsNil)
+	}
+
+	{ // cancellable validators are cancelled rather than abandoned
+		running := 0
+		run := func(ctx context.Context) error {
+			running++
+			defer func() { running-- }()
+			<-ctx.Done()
+			return errors.New("lookup failed") // failure caused by cancellation is not reported
+		}
+		err := runValidator("v", run, true, 10*time.Millisecond, 1)
+		c.Check(errors.Is(err, errTimedOut), Equals, true)
+		c.Check(running, Equals, 0)
+	}
+}
+
+func (s *MySuite) TestValidatorTimeout(c *C) {
+	defer config.UnregisterValidator("test_hangs")
+	c.Assert(config.RegisterValidator("test_hangs", func(config.Blueprint, config.Dict) error {
+		time.Sleep(time.Second)
+		return nil
+	}, nil), IsNil)
+	run := func(v config.Validator) error {
+		v.Validator = "test_hangs"
+		return Execute(config.Blueprint{Validators: []config.Validator{v}})
+	}
+
+	{ // timed out validator fails with its own code
+		err := run(config.Validator{Timeout: "10ms"})
+		var ve ValidatorError
+		c.Assert(errors.As(err, &ve), Equals, true)
+		c.Check(ve.Code(), Equals, CodeTimeout)
+		c.Check(ValidatorError{Validator: testZoneExistsName}.Code(), Equals, validatorCodes[testZoneExistsName])
+	}
+
+	{ // invalid settings
+		var be config.BpError
+		err := run(config.Validator{Timeout: "soon"})
+		c.Assert(errors.As(err, &be), Equals, true)
+		c.Check(be.Path.String(), Equals, config.Root.Validators.At(0).Timeout.String())
+
+		err = run(config.Validator{Retries: -1})
+		c.Assert(errors.As(err, &be), Equals, true)
+		c.Check(be.Path.String(), Equals, config.Root.Validators.At(0).Retries.String())
+	}
+}
@@ -15,12 +15,18 @@
 package validators
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/logging"
+	"hpc-toolkit/pkg/profile"
 	"strings"
+	"sync"
 
 	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 )
 
 func projectError(p string) error {
@@ -34,6 +40,8 @@ func projectError(p string) error {
 const regionError = "region %s is not available in project ID %s or your credentials do not have permission to access it"
 const zoneError = "zone %s is not available in project ID %s or your credentials do not have permission to access it"
 const zoneInRegionError = "zone %s is not in region %s in project ID %s or your credentials do not have permissions to access it"
+const machineTypeError = "machine type %s is not available in zone %s in project ID %s or your credentials do not have permission to access it"
+const acceleratorError = "accelerator type %s is not available in zone %s in project ID %s or your credentials do not have permission to access it"
 const unusedModuleMsg = "module %q uses module %q, but matching setting and outputs were not found. This may be because the value is set explicitly or set by a prior used module"
 const credentialsHint = "load application default credentials following instructions at https://github.com/GoogleCloudPlatform/hpc-toolkit/blob/main/README.md#supplying-cloud-credentials-to-terraform"
 
@@ -41,7 +49,7 @@ var ErrNoDefaultCredentials = errors.New("could not find application default cre
 
 func handleClientError(e error) error {
 	if strings.Contains(e.Error(), "could not find default credentials") {
-		return config.HintError{Hint: credentialsHint, Err: ErrNoDefaultCredentials}
+		return config.HintError{Hint: credentialsHint, Err: config.CodedError{Code: CodeNoCredentials, Err: ErrNoDefaultCredentials}}
 	}
 	return e
 }
@@ -54,24 +62,207 @@ const (
 	testZoneInRegionName              = "test_zone_in_region"
 	testModuleNotUsedName             = "test_module_not_used"
 	testDeploymentVariableNotUsedName = "test_deployment_variable_not_used"
+	testResourceNamesUniqueName       = "test_resource_names_unique"
+	testDeploymentNotInUseName        = "test_deployment_not_in_use"
+	testResourceReferencesName        = "test_resource_references"
+	testGpuImageCompatibleName        = "test_gpu_image_compatible"
+	testGpuNetworkingName             = "test_gpu_networking"
+	testFirewallRulesName             = "test_firewall_rules"
+	testHybridSlurmName               = "test_hybrid_slurm"
+	testWindowsImageName              = "test_windows_image"
+	testArmCompatibleName             = "test_arm_compatible"
+	testMachineTypeExistsName         = "test_machine_type_exists"
+	testGpuAvailableName              = "test_gpu_available"
+	testQuotaSufficientName           = "test_quota_sufficient"
+	testPermissionsGrantedName        = "test_permissions_granted"
+	testImageExistsName               = "test_image_exists"
+	testNetworkExistsName             = "test_network_exists"
+	testFileSystemMountsName          = "test_file_system_mounts"
+	testSubnetworkExistsName          = "test_subnetwork_exists"
+	testImageFreshName                = "test_image_fresh"
+	testReservationExistsName         = "test_reservation_exists"
+	testBillingEnabledName            = "test_billing_enabled"
+	testOrgPoliciesName               = "test_org_policies"
+	testBackendBucketName             = "test_backend_bucket"
+	testLabelsValidName               = "test_labels_valid"
+	testExternalResourcesExistName    = "test_external_resources_exist"
+	testSpotAvailabilityName          = "test_spot_availability"
+	testSSHKeysName                   = "test_ssh_keys"
+	testPrivateGoogleAccessName       = "test_private_google_access"
+	testToolkitCompatibleName         = "test_toolkit_compatible"
+	testSlurmTopologyName             = "test_slurm_topology"
+	testModuleRegionsConsistentName   = "test_module_regions_consistent"
+	testPackerBuildName               = "test_packer_build"
+	testDiskTypesAvailableName        = "test_disk_types_available"
+	testSecretsAccessibleName         = "test_secrets_accessible"
 )
 
-func implementations() map[string]func(config.Blueprint, config.Dict) error {
-	return map[string]func(config.Blueprint, config.Dict) error{
+// validatorFunc checks the blueprint, ctx is cancelled when the validator times out
+type validatorFunc func(ctx context.Context, bp config.Blueprint, inputs config.Dict) error
+
+// local adapts validators that do not call APIs, they finish promptly without
+// checking for cancellation
+func local(f func(config.Blueprint, config.Dict) error) validatorFunc {
+	return func(_ context.Context, bp config.Blueprint, inputs config.Dict) error {
+		return f(bp, inputs)
+	}
+}
+
+func builtins() map[string]validatorFunc {
+	return map[string]validatorFunc{
 		testApisEnabledName:               testApisEnabled,
 		testProjectExistsName:             testProjectExists,
 		testRegionExistsName:              testRegionExists,
 		testZoneExistsName:                testZoneExists,
 		testZoneInRegionName:              testZoneInRegion,
-		testModuleNotUsedName:             testModuleNotUsed,
-		testDeploymentVariableNotUsedName: testDeploymentVariableNotUsed,
+		testModuleNotUsedName:             local(testModuleNotUsed),
+		testDeploymentVariableNotUsedName: local(testDeploymentVariableNotUsed),
+		testResourceNamesUniqueName:       local(testResourceNamesUnique),
+		testDeploymentNotInUseName:        testDeploymentNotInUse,
+		testResourceReferencesName:        testResourceReferences,
+		testGpuImageCompatibleName:        local(testGpuImageCompatible),
+		testGpuNetworkingName:             local(testGpuNetworking),
+		testFirewallRulesName:             local(testFirewallRules),
+		testHybridSlurmName:               local(testHybridSlurm),
+		testWindowsImageName:              local(testWindowsImage),
+		testArmCompatibleName:             local(testArmCompatible),
+		testMachineTypeExistsName:         testMachineTypeExists,
+		testGpuAvailableName:              testGpuAvailable,
+		testQuotaSufficientName:           testQuotaSufficient,
+		testPermissionsGrantedName:        testPermissionsGranted,
+		testImageExistsName:               testImageExists,
+		testNetworkExistsName:             testNetworkExists,
+		testFileSystemMountsName:          local(testFileSystemMounts),
+		testSubnetworkExistsName:          testSubnetworkExists,
+		testImageFreshName:                testImageFresh,
+		testReservationExistsName:         testReservationExists,
+		testBillingEnabledName:            testBillingEnabled,
+		testOrgPoliciesName:               testOrgPolicies,
+		testBackendBucketName:             testBackendBucket,
+		testLabelsValidName:               local(testLabelsValid),
+		testExternalResourcesExistName:    testExternalResourcesExist,
+		testSpotAvailabilityName:          testSpotAvailability,
+		testSSHKeysName:                   testSSHKeys,
+		testPrivateGoogleAccessName:       testPrivateGoogleAccess,
+		testToolkitCompatibleName:         local(testToolkitCompatible),
+		testSlurmTopologyName:             local(testSlurmTopology),
+		testModuleRegionsConsistentName:   local(testModuleRegionsConsistent),
+		testPackerBuildName:               testPackerBuild,
+		testDiskTypesAvailableName:        testDiskTypesAvailable,
+		testSecretsAccessibleName:         testSecretsAccessible,
+	}
+}
+
+// implementations returns built-in validators and validators added with
+// config.RegisterValidator, built-in validators take precedence
+func implementations() map[string]validatorFunc {
+	impl := builtins()
+	for name, r := range config.RegisteredValidators() {
+		if _, ok := impl[name]; !ok {
+			impl[name] = registeredValidator(r)
+		}
+	}
+	return impl
+}
+
+func registeredValidator(r config.RegisteredValidator) validatorFunc {
+	return func(_ context.Context, bp config.Blueprint, inputs config.Dict) error {
+		if err := checkInputs(inputs, r.RequiredInputs); err != nil {
+			return err
+		}
+		return r.Func(bp, inputs)
+	}
+}
+
+// ValidatorInfo describes a validator that blueprints can use
+type ValidatorInfo struct {
+	Name           string
+	Registered     bool     // added with config.RegisterValidator
+	RequiredInputs []string // known for registered validators only
+	Dependencies   []string // validators that must succeed for the validator to run
+}
+
+// Available returns validators that blueprints can use, sorted by name
+func Available() []ValidatorInfo {
+	bi, deps := builtins(), dependencies()
+	reg := config.RegisteredValidators()
+	res := []ValidatorInfo{}
+	for name := range implementations() {
+		info := ValidatorInfo{Name: name, Dependencies: deps[name]}
+		if _, ok := bi[name]; !ok {
+			info.Registered, info.RequiredInputs = true, reg[name].RequiredInputs
+		}
+		res = append(res, info)
+	}
+	slices.SortFunc(res, func(a, b ValidatorInfo) int { return strings.Compare(a.Name, b.Name) })
+	return res
+}
+
+// dependencies returns validators that must succeed for the validator to produce meaningful
+// results, e.g. zone can not be checked in a project that does not exist
+func dependencies() map[string][]string {
+	return map[string][]string{
+		testApisEnabledName:            {testProjectExistsName},
+		testDeploymentNotInUseName:     {testProjectExistsName},
+		testRegionExistsName:           {testProjectExistsName},
+		testZoneExistsName:             {testProjectExistsName},
+		testZoneInRegionName:           {testRegionExistsName, testZoneExistsName},
+		testMachineTypeExistsName:      {testZoneExistsName},
+		testGpuAvailableName:           {testZoneExistsName},
+		testQuotaSufficientName:        {testRegionExistsName, testZoneExistsName},
+		testPermissionsGrantedName:     {testProjectExistsName},
+		testImageExistsName:            {testProjectExistsName},
+		testNetworkExistsName:          {testProjectExistsName},
+		testSubnetworkExistsName:       {testNetworkExistsName},
+		testImageFreshName:             {testImageExistsName},
+		testReservationExistsName:      {testZoneExistsName},
+		testSpotAvailabilityName:       {testZoneExistsName},
+		testBillingEnabledName:         {testProjectExistsName},
+		testOrgPoliciesName:            {testProjectExistsName},
+		testExternalResourcesExistName: {testProjectExistsName},
+		testSSHKeysName:                {testProjectExistsName},
+		testPrivateGoogleAccessName:    {testSubnetworkExistsName},
+		testPackerBuildName:            {testImageExistsName, testSubnetworkExistsName},
+		testDiskTypesAvailableName:     {testZoneExistsName},
+		testSecretsAccessibleName:      {testProjectExistsName},
 	}
 }
 
+// ordered returns indices of validators such that validators run after their
+// dependencies, the order of validators is kept otherwise
+func ordered(vs []config.Validator) []int {
+	deps := dependencies()
+	pending := map[string]int{} // number of not yet ordered validators of the name
+	for _, v := range vs {
+		pending[v.Validator]++
+	}
+	ready := func(v config.Validator) bool {
+		return !slices.ContainsFunc(deps[v.Validator], func(d string) bool { return pending[d] > 0 })
+	}
+
+	res := []int{}
+	done := make([]bool, len(vs))
+	for len(res) < len(vs) {
+		next := -1
+		for i, v := range vs {
+			if !done[i] && (ready(v) || next == -1) {
+				next = i // fallback to the first pending validator for cyclic dependencies
+				if ready(v) {
+					break
+				}
+			}
+		}
+		res, done[next] = append(res, next), true
+		pending[vs[next].Validator]--
+	}
+	return res
+}
+
 // ValidatorError is an error wrapper for errors that occurred during validation
 type ValidatorError struct {
 	Validator string
 	Err       error
+	Level     int // validation level of the validator, config.ValidationError or config.ValidationWarning
 }
 
 func (e ValidatorError) Unwrap() error {
@@ -82,6 +273,14 @@ func (e ValidatorError) Error() string {
 	return fmt.Sprintf("validator %q failed:\n%v", e.Validator, e.Err)
 }
 
+func unknownValidatorError(name string) error {
+	err := config.CodedError{Code: CodeMisconfigured, Err: fmt.Errorf("unknown validator %q", name)}
+	if r, ok := config.RenamedValidator(name); ok {
+		return config.HintError{Hint: fmt.Sprintf("the validator was renamed to %q, run `ghpc fix --apply` to update the blueprint", r), Err: err}
+	}
+	return err
+}
+
 // Execute runs all validators on the blueprint
 func Execute(bp config.Blueprint) error {
 	if bp.ValidationLevel == config.ValidationIgnore {
@@ -89,31 +288,221 @@ func Execute(bp config.Blueprint) error {
 	}
 	impl := implementations()
 	errs := config.Errors{}
-	for iv, v := range validators(bp) {
-		p := config.Root.Validators.At(iv)
+	bi := builtins()
+	reg := maps.Keys(config.RegisteredValidators())
+	slices.Sort(reg)
+	for _, name := range reg {
+		if _, ok := bi[name]; ok {
+			errs.Add(config.CodedError{Code: CodeMisconfigured,
+				Err: fmt.Errorf("registered validator %q has the name of a built-in validator", name)})
+		}
+	}
+	custom := map[string]bool{}
+	for _, v := range bp.Validators {
+		custom[v.Validator] = custom[v.Validator] || len(v.Command) > 0
+	}
+	bp.WalkModulesSafe(func(p config.ModulePath, m *config.Module) {
+		for is, name := range m.SkipValidators {
+			if _, ok := impl[name]; !ok && !custom[name] {
+				errs.At(p.SkipValidators.At(is), unknownValidatorError(name))
+			}
+		}
+	})
+
+	deps, cloud := dependencies(), cloudValidators()
+	// credentials are looked up only if there are validators calling APIs
+	offline := sync.OnceValue(func() bool { return Offline || !hasCredentials() })
+	skippedOffline, skippedCustom := []string{}, []string{}
+	failed := map[string]bool{} // validators that failed or were skipped due to failures
+	vs := validators(bp)
+	warnIneffectiveSkips(bp, vs)
+	for _, iv := range ordered(vs) {
+		v, p := vs[iv], config.Root.Validators.At(iv)
 		if v.Skip {
 			continue
 		}
+		level := bp.ValidationLevel
+		if v.Severity != "" {
+			l, err := config.ParseValidationLevel(v.Severity)
+			if err != nil {
+				errs.At(p.Severity, config.CodedError{Code: CodeMisconfigured, Err: err})
+				continue
+			}
+			level = l
+		}
+		if level == config.ValidationIgnore {
+			continue
+		}
+		if m, err := bp.Module(v.Module); err == nil && m.SkipsValidator(v.Validator) {
+			continue // declared by module that skips it
+		}
 
 		f, ok := impl[v.Validator]
+		if len(v.Command) > 0 {
+			if ok {
+				errs.At(p.Validator, config.CodedError{Code: CodeMisconfigured,
+					Err: fmt.Errorf("custom validator %q has the name of a built-in or registered validator", v.Validator)})
+				continue
+			}
+			if !AllowCustom {
+				if !slices.Contains(skippedCustom, v.Validator) {
+					skippedCustom = append(skippedCustom, v.Validator)
+				}
+				continue
+			}
+			f, ok = customValidator(v.Validator, v.Command), true
+		}
 		if !ok {
-			errs.At(p.Validator, fmt.Errorf("unknown validator %q", v.Validator))
+			errs.At(p.Validator, unknownValidatorError(v.Validator))
+			continue
+		}
+		if cloud[v.Validator] && offline() {
+			if !slices.Contains(skippedOffline, v.Validator) {
+				skippedOffline = append(skippedOffline, v.Validator)
+			}
+			continue
+		}
+
+		if i := slices.IndexFunc(deps[v.Validator], func(d string) bool { return failed[d] }); i >= 0 {
+			logging.Info("validator %q was skipped due to upstream failure of %q", v.Validator, deps[v.Validator][i])
+			failed[v.Validator] = true
 			continue
 		}
 
 		inp, err := bp.EvalDict(v.Inputs)
 		if err != nil {
-			errs.At(p.Inputs, err)
+			errs.At(p.Inputs, config.CodedError{Code: CodeMisconfigured, Err: err})
+			failed[v.Validator] = true
+			continue
+		}
+		timeout, err := parseTimeout(v.Timeout)
+		if err != nil {
+			errs.At(p.Timeout, config.CodedError{Code: CodeMisconfigured, Err: err})
+			failed[v.Validator] = true
+			continue
+		}
+		if v.Retries < 0 {
+			errs.At(p.Retries, config.CodedError{Code: CodeMisconfigured, Err: fmt.Errorf("invalid retries %d: must not be negative", v.Retries)})
+			failed[v.Validator] = true
 			continue
 		}
 
-		if err := f(bp, inp); err != nil {
-			errs.Add(ValidatorError{v.Validator, err})
-			// do not bother running further validators if project ID could not be found
-			if v.Validator == "test_project_exists" {
-				break
+		stop := profile.Start(profile.Validation, v.Validator)
+		_, builtin := bi[v.Validator]
+		cancellable := builtin || len(v.Command) > 0 // registered validators do not accept a context
+		err = runValidator(v.Validator, func(ctx context.Context) error { return f(ctx, bp, inp) }, cancellable, timeout, v.Retries)
+		err = withoutSkippedFindings(bp, v.Validator, err)
+		stop()
+		if err != nil {
+			errs.Add(ValidatorError{Validator: v.Validator, Err: err, Level: level})
+			failed[v.Validator] = true
+		}
+	}
+	warnOffline(skippedOffline)
+	warnCustomSkipped(skippedCustom)
+	return errs.OrNil()
+}
+
+// SplitWarnings splits the error returned by Execute into failures treated as errors
+// and as warnings, by severity of the validator or, for other errors, by the level
+func SplitWarnings(err error, level int) (error, error) {
+	var all []error
+	switch e := err.(type) {
+	case nil:
+		return nil, nil
+	case config.Errors:
+		all = e.Errors
+	default:
+		all = []error{err}
+	}
+	errs, warnings := config.Errors{}, config.Errors{}
+	for _, e := range all {
+		l := level
+		if ve, ok := e.(ValidatorError); ok {
+			l = ve.Level
+		}
+		if l == config.ValidationWarning {
+			warnings.Add(e)
+		} else {
+			errs.Add(e)
+		}
+	}
+	return errs.OrNil(), warnings.OrNil()
+}
+
+// projectValidators returns names of built-in validators that check the project and
+// deployment variables, their findings are never located in modules
+func projectValidators() map[string]bool {
+	return map[string]bool{
+		testApisEnabledName:               true,
+		testProjectExistsName:             true,
+		testRegionExistsName:              true,
+		testZoneExistsName:                true,
+		testZoneInRegionName:              true,
+		testDeploymentVariableNotUsedName: true,
+		testDeploymentNotInUseName:        true,
+		testBillingEnabledName:            true,
+		testPermissionsGrantedName:        true,
+		testQuotaSufficientName:           true,
+	}
+}
+
+// warnIneffectiveSkips warns about `skip_validators` of modules that have no effect:
+// validators that never report findings located in the module, unless the module declares them
+func warnIneffectiveSkips(bp config.Blueprint, vs []config.Validator) {
+	project := projectValidators()
+	bp.WalkModulesSafe(func(_ config.ModulePath, m *config.Module) {
+		for _, name := range m.SkipValidators {
+			declared := slices.ContainsFunc(vs, func(v config.Validator) bool { return v.Validator == name && v.Module == m.ID })
+			if !project[name] || declared {
+				continue
+			}
+			logging.Warn(logging.Warning{
+				Source:   "validation",
+				Location: fmt.Sprintf("module %s", m.ID),
+				Message:  fmt.Sprintf("skip_validators has no effect on %s, it does not report findings located in modules", name),
+				Hint:     fmt.Sprintf("skip %s for the whole blueprint instead", name),
+			})
+		}
+	})
+}
+
+// withoutSkippedFindings removes findings located in modules that skip the validator
+func withoutSkippedFindings(bp config.Blueprint, validator string, err error) error {
+	var findings []error
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case config.Errors:
+		findings = e.Errors
+	case *config.Errors:
+		findings = e.Errors
+	default:
+		findings = []error{err}
+	}
+
+	skipping := map[string]bool{}
+	bp.WalkModulesSafe(func(p config.ModulePath, m *config.Module) {
+		if m.SkipsValidator(validator) {
+			skipping[p.String()] = true
+		}
+	})
+	if len(skipping) == 0 {
+		return err
+	}
+
+	errs := config.Errors{}
+	for _, f := range findings {
+		var be config.BpError
+		skipped := false
+		if errors.As(f, &be) {
+			for p := be.Path; p != nil && !skipped; p = p.Parent() {
+				skipped = skipping[p.String()]
 			}
 		}
+		if !skipped {
+			errs.Add(f)
+		}
 	}
 	return errs.OrNil()
 }
@@ -122,7 +511,7 @@ func checkInputs(inputs config.Dict, required []string) error {
 	errs := config.Errors{}
 	for _, inp := range required {
 		if !inputs.Has(inp) {
-			errs.Add(fmt.Errorf("a required input %q was not provided", inp))
+			errs.Add(config.CodedError{Code: CodeMisconfigured, Err: fmt.Errorf("a required input %q was not provided", inp)})
 		}
 	}
 
@@ -133,7 +522,7 @@ func checkInputs(inputs config.Dict, required []string) error {
 	// ensure that no extra inputs were provided by comparing length
 	if len(required) != len(inputs.Items()) {
 		errStr := "only %v inputs %s should be provided"
-		return fmt.Errorf(errStr, len(required), required)
+		return config.CodedError{Code: CodeMisconfigured, Err: fmt.Errorf(errStr, len(required), required)}
 	}
 
 	return nil
@@ -144,7 +533,7 @@ func inputsAsStrings(inputs config.Dict) (map[string]string, error) {
 	ms := map[string]string{}
 	for k, v := range inputs.Items() {
 		if v.Type() != cty.String {
-			return nil, fmt.Errorf("validator inputs must be strings, %s is a %s", k, v.Type())
+			return nil, config.CodedError{Code: CodeMisconfigured, Err: fmt.Errorf("validator inputs must be strings, %s is a %s", k, v.Type())}
 		}
 		ms[k] = v.AsString()
 	}
@@ -165,11 +554,28 @@ func defaults(bp config.Blueprint) []config.Validator {
 
 	defaults := []config.Validator{
 		{Validator: testModuleNotUsedName},
-		{Validator: testDeploymentVariableNotUsedName}}
+		{Validator: testDeploymentVariableNotUsedName},
+		{Validator: testResourceNamesUniqueName},
+		{Validator: testGpuImageCompatibleName},
+		{Validator: testGpuNetworkingName},
+		{Validator: testFirewallRulesName},
+		{Validator: testHybridSlurmName},
+		{Validator: testWindowsImageName},
+		{Validator: testArmCompatibleName},
+		{Validator: testFileSystemMountsName},
+		{Validator: testLabelsValidName},
+		{Validator: testToolkitCompatibleName},
+		{Validator: testSlurmTopologyName},
+		{Validator: testModuleRegionsConsistentName}}
+
+	// the state bucket must be writable before deployment groups are initialized
+	if bp.TerraformBackendDefaults.Type == "gcs" {
+		defaults = append(defaults, config.Validator{Validator: testBackendBucketName})
+	}
 
 	// always add the project ID validator before subsequent validators that can
 	// only succeed if credentials can access the project. If the project ID
-	// validator fails, all remaining validators are not executed.
+	// validator fails, validators that depend on it are skipped.
 	if projectIDExists {
 		inputs := config.Dict{}.With("project_id", projectRef)
 		defaults = append(defaults, config.Validator{
@@ -178,10 +584,41 @@ func defaults(bp config.Blueprint) []config.Validator {
 		}, config.Validator{
 			Validator: testApisEnabledName,
 			Inputs:    inputs,
+		}, config.Validator{
+			Validator: testPermissionsGrantedName,
+			Inputs:    inputs,
+		}, config.Validator{
+			Validator: testBillingEnabledName,
+			Inputs:    inputs,
 		},
 		)
 	}
 
+	if projectIDExists {
+		defaults = append(defaults, config.Validator{
+			Validator: testDeploymentNotInUseName,
+			Inputs: config.NewDict(map[string]cty.Value{
+				"project_id":      projectRef,
+				"deployment_name": config.GlobalRef("deployment_name").AsValue(),
+			}),
+		}, config.Validator{
+			Validator: testResourceReferencesName,
+		}, config.Validator{
+			Validator: testSecretsAccessibleName,
+			Inputs:    config.Dict{}.With("project_id", projectRef),
+		})
+	}
+
+	// checks of machine types, GPUs, disks, images, networks and other resources of
+	// modules are added for modules that declare them in `requirements` metadata
+
+	if projectIDExists && len(bp.ExternalResources) > 0 {
+		defaults = append(defaults, config.Validator{
+			Validator: testExternalResourcesExistName,
+			Inputs:    config.Dict{}.With("project_id", projectRef),
+		})
+	}
+
 	if projectIDExists && regionExists {
 		defaults = append(defaults, config.Validator{
 			Validator: testRegionExistsName,
@@ -193,23 +630,28 @@ func defaults(bp config.Blueprint) []config.Validator {
 	}
 
 	if projectIDExists && zoneExists {
+		inputs := config.NewDict(map[string]cty.Value{
+			"project_id": projectRef,
+			"zone":       zoneRef,
+		})
 		defaults = append(defaults, config.Validator{
 			Validator: testZoneExistsName,
-			Inputs: config.NewDict(map[string]cty.Value{
-				"project_id": projectRef,
-				"zone":       zoneRef,
-			}),
+			Inputs:    inputs,
 		})
 	}
 
 	if projectIDExists && regionExists && zoneExists {
+		inputs := config.NewDict(map[string]cty.Value{
+			"project_id": projectRef,
+			"region":     regionRef,
+			"zone":       zoneRef,
+		})
 		defaults = append(defaults, config.Validator{
 			Validator: testZoneInRegionName,
-			Inputs: config.NewDict(map[string]cty.Value{
-				"project_id": projectRef,
-				"region":     regionRef,
-				"zone":       zoneRef,
-			}),
+			Inputs:    inputs,
+		}, config.Validator{
+			Validator: testQuotaSufficientName,
+			Inputs:    inputs,
 		})
 	}
 	return defaults
@@ -219,7 +661,9 @@ func defaults(bp config.Blueprint) []config.Validator {
 func validators(bp config.Blueprint) []config.Validator {
 	used := map[string]bool{}
 	for _, v := range bp.Validators {
-		used[v.Validator] = true
+		if v.Module == "" { // validators declared by modules do not replace defaults
+			used[v.Validator] = true
+		}
 	}
 	vs := append([]config.Validator{}, bp.Validators...) // clone
 	for _, v := range defaults(bp) {
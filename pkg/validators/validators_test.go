@@ -15,7 +15,12 @@
 package validators
 
 import (
+	"context"
+	"errors"
 	"hpc-toolkit/pkg/config"
+	"hpc-toolkit/pkg/logging"
+	"hpc-toolkit/pkg/modulereader"
+	"path/filepath"
 	"testing"
 
 	"github.com/zclconf/go-cty/cty"
@@ -31,6 +36,15 @@ func Test(t *testing.T) {
 	TestingT(t)
 }
 
+// newModule returns a Terraform module with the settings, for blueprints of validator tests
+func newModule(id config.ModuleID, source string, settings map[string]cty.Value) config.Module {
+	return config.Module{ID: id, Source: source, Kind: config.TerraformKind, Settings: config.NewDict(settings)}
+}
+
+func newPackerModule(id config.ModuleID, source string, settings map[string]cty.Value) config.Module {
+	return config.Module{ID: id, Source: source, Kind: config.PackerKind, Settings: config.NewDict(settings)}
+}
+
 func (s *MySuite) TestCheckInputs(c *C) {
 	dummy := cty.NullVal(cty.String)
 
@@ -73,6 +87,18 @@ func (s *MySuite) TestCheckInputs(c *C) {
 func (s *MySuite) TestDefaultValidators(c *C) {
 	unusedMods := config.Validator{Validator: "test_module_not_used"}
 	unusedVars := config.Validator{Validator: "test_deployment_variable_not_used"}
+	namesUnique := config.Validator{Validator: "test_resource_names_unique"}
+	gpuCompat := config.Validator{Validator: "test_gpu_image_compatible"}
+	gpuNet := config.Validator{Validator: "test_gpu_networking"}
+	fwRules := config.Validator{Validator: "test_firewall_rules"}
+	hybrid := config.Validator{Validator: "test_hybrid_slurm"}
+	windows := config.Validator{Validator: "test_windows_image"}
+	arm := config.Validator{Validator: "test_arm_compatible"}
+	mounts := config.Validator{Validator: testFileSystemMountsName}
+	labels := config.Validator{Validator: testLabelsValidName}
+	compatible := config.Validator{Validator: testToolkitCompatibleName}
+	slurm := config.Validator{Validator: testSlurmTopologyName}
+	regions := config.Validator{Validator: testModuleRegionsConsistentName}
 
 	prjInp := config.Dict{}.With("project_id", config.GlobalRef("project_id").AsValue())
 	regInp := prjInp.With("region", config.GlobalRef("region").AsValue())
@@ -83,24 +109,52 @@ func (s *MySuite) TestDefaultValidators(c *C) {
 		Validator: "test_project_exists", Inputs: prjInp}
 	apisEnabled := config.Validator{
 		Validator: "test_apis_enabled", Inputs: prjInp}
+	permsGranted := config.Validator{
+		Validator: testPermissionsGrantedName, Inputs: prjInp}
+	billingEnabled := config.Validator{
+		Validator: testBillingEnabledName, Inputs: prjInp}
+	secrets := config.Validator{
+		Validator: testSecretsAccessibleName, Inputs: prjInp}
 	regionExists := config.Validator{
 		Validator: testRegionExistsName, Inputs: regInp}
 	zoneExists := config.Validator{
 		Validator: testZoneExistsName, Inputs: zoneInp}
 	zoneInRegion := config.Validator{
 		Validator: testZoneInRegionName, Inputs: regZoneInp}
+	quotaSufficient := config.Validator{
+		Validator: testQuotaSufficientName, Inputs: regZoneInp}
+	resRefs := config.Validator{Validator: "test_resource_references"}
+	notInUse := config.Validator{
+		Validator: testDeploymentNotInUseName,
+		Inputs:    prjInp.With("deployment_name", config.GlobalRef("deployment_name").AsValue())}
 
 	{
 		bp := config.Blueprint{}
 		c.Check(defaults(bp), DeepEquals, []config.Validator{
-			unusedMods, unusedVars})
+			unusedMods, unusedVars, namesUnique, gpuCompat, gpuNet, fwRules, hybrid, windows, arm, mounts, labels, compatible, slurm, regions})
+	}
+
+	{
+		bp := config.Blueprint{TerraformBackendDefaults: config.TerraformBackend{Type: "gcs"}}
+		c.Check(defaults(bp), DeepEquals, []config.Validator{
+			unusedMods, unusedVars, namesUnique, gpuCompat, gpuNet, fwRules, hybrid, windows, arm, mounts, labels, compatible, slurm, regions,
+			{Validator: testBackendBucketName}})
 	}
 
 	{
 		bp := config.Blueprint{Vars: config.Dict{}.
 			With("project_id", cty.StringVal("f00b"))}
 		c.Check(defaults(bp), DeepEquals, []config.Validator{
-			unusedMods, unusedVars, projectExists, apisEnabled})
+			unusedMods, unusedVars, namesUnique, gpuCompat, gpuNet, fwRules, hybrid, windows, arm, mounts, labels, compatible, slurm, regions, projectExists, apisEnabled, permsGranted, billingEnabled, notInUse, resRefs, secrets})
+	}
+
+	{
+		bp := config.Blueprint{
+			Vars:              config.Dict{}.With("project_id", cty.StringVal("f00b")),
+			ExternalResources: []config.ExternalResource{{ID: "net", Type: config.ExternalVpc}}}
+		c.Check(defaults(bp), DeepEquals, []config.Validator{
+			unusedMods, unusedVars, namesUnique, gpuCompat, gpuNet, fwRules, hybrid, windows, arm, mounts, labels, compatible, slurm, regions, projectExists, apisEnabled, permsGranted, billingEnabled, notInUse, resRefs, secrets,
+			{Validator: testExternalResourcesExistName, Inputs: prjInp}})
 	}
 
 	{
@@ -109,7 +163,7 @@ func (s *MySuite) TestDefaultValidators(c *C) {
 			With("region", cty.StringVal("narnia"))}
 
 		c.Check(defaults(bp), DeepEquals, []config.Validator{
-			unusedMods, unusedVars, projectExists, apisEnabled, regionExists})
+			unusedMods, unusedVars, namesUnique, gpuCompat, gpuNet, fwRules, hybrid, windows, arm, mounts, labels, compatible, slurm, regions, projectExists, apisEnabled, permsGranted, billingEnabled, notInUse, resRefs, secrets, regionExists})
 	}
 
 	{
@@ -118,7 +172,7 @@ func (s *MySuite) TestDefaultValidators(c *C) {
 			With("zone", cty.StringVal("danger"))}
 
 		c.Check(defaults(bp), DeepEquals, []config.Validator{
-			unusedMods, unusedVars, projectExists, apisEnabled, zoneExists})
+			unusedMods, unusedVars, namesUnique, gpuCompat, gpuNet, fwRules, hybrid, windows, arm, mounts, labels, compatible, slurm, regions, projectExists, apisEnabled, permsGranted, billingEnabled, notInUse, resRefs, secrets, zoneExists})
 	}
 
 	{
@@ -128,6 +182,214 @@ func (s *MySuite) TestDefaultValidators(c *C) {
 			With("zone", cty.StringVal("danger"))}
 
 		c.Check(defaults(bp), DeepEquals, []config.Validator{
-			unusedMods, unusedVars, projectExists, apisEnabled, regionExists, zoneExists, zoneInRegion})
+			unusedMods, unusedVars, namesUnique, gpuCompat, gpuNet, fwRules, hybrid, windows, arm, mounts, labels, compatible, slurm, regions, projectExists, apisEnabled, permsGranted, billingEnabled, notInUse, resRefs, secrets, regionExists, zoneExists, zoneInRegion, quotaSufficient})
+	}
+}
+
+func (s *MySuite) TestValidatorsDeclaredByModules(c *C) {
+	own := config.Validator{Validator: "test_module_not_used", Skip: true}
+	declared := config.Validator{Validator: "test_deployment_variable_not_used", Module: "fs"}
+	bp := config.Blueprint{Validators: []config.Validator{own, declared}}
+
+	// origin of declared validators is kept in the expanded blueprint
+	path := filepath.Join(c.MkDir(), "expanded.yaml")
+	c.Assert(bp.Export(path), IsNil)
+	read, _, err := config.NewBlueprint(path)
+	c.Assert(err, IsNil)
+	c.Check(validators(read), DeepEquals, validators(bp))
+
+	c.Check(validators(bp), DeepEquals, []config.Validator{
+		own,
+		declared,
+		{Validator: "test_deployment_variable_not_used"}, // not replaced by declared validator
+		{Validator: "test_resource_names_unique"},
+		{Validator: "test_gpu_image_compatible"},
+		{Validator: "test_gpu_networking"},
+		{Validator: "test_firewall_rules"},
+		{Validator: "test_hybrid_slurm"},
+		{Validator: "test_windows_image"},
+		{Validator: "test_arm_compatible"},
+		{Validator: "test_file_system_mounts"},
+		{Validator: "test_labels_valid"},
+		{Validator: "test_toolkit_compatible"},
+		{Validator: "test_slurm_topology"},
+		{Validator: "test_module_regions_consistent"},
+	})
+}
+
+func (s *MySuite) TestModuleSkipsValidators(c *C) {
+	modulereader.SetModuleInfo("./skip/x", "terraform", modulereader.ModuleInfo{})
+	mod := func(id config.ModuleID, skip ...string) config.Module {
+		return config.Module{ID: id, Source: "./skip/x", Kind: config.TerraformKind,
+			SkipValidators: skip, SkipJustification: "known exception"}
+	}
+	bp := config.Blueprint{Groups: []config.Group{{Name: "g", Modules: []config.Module{
+		mod("a", "test_module_not_used"), mod("b")}}}}
+	pa := config.Root.Groups.At(0).Modules.At(0)
+	pb := config.Root.Groups.At(0).Modules.At(1)
+
+	{ // findings located in the skipping module are removed
+		err := config.Errors{}
+		err.At(pa.Use.At(0), errors.New("a"))
+		err.At(pb.Use.At(0), errors.New("b"))
+		got := withoutSkippedFindings(bp, "test_module_not_used", err)
+		c.Check(got, DeepEquals, config.BpError{Path: pb.Use.At(0), Err: errors.New("b")})
+		c.Check(withoutSkippedFindings(bp, "test_resource_names_unique", err), DeepEquals, err)
+		c.Check(withoutSkippedFindings(bp, "test_module_not_used", config.BpError{Path: pa.ID, Err: errors.New("a")}), IsNil)
+		c.Check(withoutSkippedFindings(bp, "test_module_not_used", nil), IsNil)
+	}
+
+	{ // findings without location are kept
+		err := errors.New("zone is not in region")
+		c.Check(withoutSkippedFindings(bp, "test_module_not_used", err), Equals, err)
+	}
+
+	{ // validators declared by the module are skipped
+		bp := bp
+		bp.Validators = []config.Validator{{Validator: "unknown_declared", Module: "a"}}
+		bp.Groups[0].Modules[0].SkipValidators = []string{"unknown_declared"}
+		err := Execute(bp)
+		c.Check(err, ErrorMatches, `.*unknown validator "unknown_declared".*`)
+		var be config.BpError
+		c.Assert(errors.As(err, &be), Equals, true)
+		c.Check(be.Path.String(), Equals, pa.SkipValidators.At(0).String()) // reported as unknown skip, not executed
+	}
+
+	{ // skipping validators that do not report findings of modules is warned about
+		logging.ResetWarnings()
+		defer logging.ResetWarnings()
+		bp := bp
+		bp.Validators = []config.Validator{{Validator: testZoneInRegionName, Skip: true}, {Validator: testRegionExistsName, Module: "b", Skip: true}}
+		bp.Groups = []config.Group{{Name: "g", Modules: []config.Module{
+			mod("a", testZoneInRegionName, testModuleNotUsedName), mod("b", testRegionExistsName)}}}
+		c.Check(Execute(bp), IsNil)
+		c.Check(logging.Warnings(), DeepEquals, []logging.Warning{{
+			Source:   "validation",
+			Location: "module a",
+			Message:  "skip_validators has no effect on test_zone_in_region, it does not report findings located in modules",
+			Hint:     "skip test_zone_in_region for the whole blueprint instead",
+		}}) // not about validators declared by the module
+	}
+}
+
+func (s *MySuite) TestValidatorDependencies(c *C) {
+	impl := implementations()
+	for v, deps := range dependencies() {
+		c.Check(impl[v], NotNil, Commentf("unknown validator %q", v))
+		for _, d := range deps {
+			c.Check(impl[d], NotNil, Commentf("unknown dependency %q of %q", d, v))
+		}
+	}
+
+	vs := []config.Validator{
+		{Validator: testZoneInRegionName},
+		{Validator: testModuleNotUsedName},
+		{Validator: testZoneExistsName},
+		{Validator: testRegionExistsName},
+		{Validator: testProjectExistsName},
+		{Validator: testZoneExistsName, Inputs: config.NewDict(map[string]cty.Value{"zone": cty.StringVal("b")})},
+	}
+	// dependencies run first, order is kept otherwise
+	c.Check(ordered(vs), DeepEquals, []int{1, 4, 2, 3, 5, 0})
+	c.Check(ordered(vs[:2]), DeepEquals, []int{0, 1}) // missing dependencies are ignored
+}
+
+func (s *MySuite) TestResourceNamesUnique(c *C) {
+	mkMod := func(id config.ModuleID, src string, settings config.Dict) config.Module {
+		m := config.Module{ID: id, Source: src, Kind: config.TerraformKind, Settings: settings}
+		modulereader.SetModuleInfo(src, "terraform", modulereader.ModuleInfo{
+			Inputs: []modulereader.VarInfo{{Name: "name", Type: cty.String}},
+			Metadata: modulereader.Metadata{
+				Ghpc: modulereader.MetadataGhpc{NamingInputs: []string{"name"}}}})
+		return m
+	}
+	named := func(n string) config.Dict {
+		return config.Dict{}.With("name", cty.StringVal(n))
+	}
+	bp := func(ms ...config.Module) config.Blueprint {
+		return config.Blueprint{Groups: []config.Group{{Name: "g", Modules: ms}}}
+	}
+
+	{ // OK: distinct names
+		c.Check(testResourceNamesUnique(bp(
+			mkMod("a", "./naming/x", named("one")),
+			mkMod("b", "./naming/x", named("two"))), config.Dict{}), IsNil)
+	}
+
+	{ // OK: same names, different sources
+		c.Check(testResourceNamesUnique(bp(
+			mkMod("a", "./naming/x", named("one")),
+			mkMod("b", "./naming/y", named("one"))), config.Dict{}), IsNil)
+	}
+
+	{ // FAIL: same names, same source
+		c.Check(testResourceNamesUnique(bp(
+			mkMod("a", "./naming/x", named("one")),
+			mkMod("b", "./naming/x", named("one"))), config.Dict{}), NotNil)
+	}
+
+	{ // FAIL: both rely on defaults
+		c.Check(testResourceNamesUnique(bp(
+			mkMod("a", "./naming/x", config.Dict{}),
+			mkMod("b", "./naming/x", config.Dict{})), config.Dict{}), NotNil)
+	}
+}
+
+func (s *MySuite) TestParseResourceRef(c *C) {
+	{ // OK: global network
+		r, err := ParseResourceRef("projects/host/global/networks/shared")
+		c.Check(err, IsNil)
+		c.Check(r, DeepEquals, ResourceRef{Project: "host", Kind: "networks", Name: "shared"})
+	}
+
+	{ // OK: subnetwork self-link
+		r, err := ParseResourceRef("https://www.googleapis.com/compute/v1/projects/host/regions/us-east4/subnetworks/primary")
+		c.Check(err, IsNil)
+		c.Check(r, DeepEquals, ResourceRef{Project: "host", Region: "us-east4", Kind: "subnetworks", Name: "primary"})
+	}
+
+	{ // OK: image family
+		r, err := ParseResourceRef("projects/images-prj/global/images/family/hpc-rocky")
+		c.Check(err, IsNil)
+		c.Check(r, DeepEquals, ResourceRef{Project: "images-prj", Kind: "family", Name: "hpc-rocky"})
+	}
+
+	{ // FAIL: missing name
+		_, err := ParseResourceRef("projects/host/global/networks/")
+		c.Check(err, ErrorMatches, ".*malformed resource reference.*")
+	}
+
+	c.Check(looksLikeResourceRef("projects/host/global/networks/"), Equals, true)
+	c.Check(looksLikeResourceRef("projects/host/secrets/pwd"), Equals, false)
+	c.Check(looksLikeResourceRef("just a string"), Equals, false)
+}
+
+func (s *MySuite) TestResourceReferencesOrder(c *C) {
+	bad := cty.StringVal("projects/host/global/networks/")
+	settings := map[string]cty.Value{}
+	for _, k := range []string{"network_self_link", "a_network", "z_network", "m_network"} {
+		settings[k] = bad
+	}
+	settings["images"] = cty.ObjectVal(map[string]cty.Value{"b": bad, "a": bad})
+	bp := config.Blueprint{Groups: []config.Group{{Name: "g", Modules: []config.Module{
+		{ID: "vm", Settings: config.NewDict(settings)}}}}}
+
+	for i := 0; i < 5; i++ { // not in map order
+		err := testResourceReferences(context.Background(), bp, config.Dict{})
+		var errs config.Errors
+		c.Assert(errors.As(err, &errs), Equals, true)
+		paths := []string{}
+		for _, e := range errs.Errors {
+			var be config.BpError
+			c.Assert(errors.As(e, &be), Equals, true)
+			paths = append(paths, be.Path.String())
+		}
+		c.Check(paths, DeepEquals, []string{
+			"deployment_groups[0].modules[0].settings.a_network",
+			"deployment_groups[0].modules[0].settings.images.a",
+			"deployment_groups[0].modules[0].settings.images.b",
+			"deployment_groups[0].modules[0].settings.m_network",
+			"deployment_groups[0].modules[0].settings.network_self_link",
+			"deployment_groups[0].modules[0].settings.z_network"})
 	}
 }
@@ -0,0 +1,127 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"fmt"
+	"hpc-toolkit/pkg/config"
+	"regexp"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// windowsMinDiskSize is the size of boot disk of public Windows Server images, in GB
+const windowsMinDiskSize = 50
+
+var (
+	windowsProjects = []string{"windows-cloud", "windows-sql-cloud"}
+
+	// windowsFamilyRe matches supported families of public Windows Server and SQL Server images
+	windowsFamilyRe = regexp.MustCompile(
+		`^(windows-(2016|2019|2022|2025)(-core)?|sql-(2017|2019|2022)-(express|web|standard|enterprise)-windows-(2016|2019|2022|2025)(-dc)?)$`)
+	// looksWindowsRe matches families that refer to Windows, supported or not
+	looksWindowsRe = regexp.MustCompile(`(^windows-|-windows-|^windows$)`)
+)
+
+// moduleImage returns family and project of the image of the module, set either by
+// `instance_image` setting or by `source_image_family` and `source_image_project_id` of Packer modules
+func moduleImage(bp config.Blueprint, m config.Module) (string, string, bool) {
+	if family, ok := imageFamily(bp, m); ok {
+		v, _ := bp.Eval(m.Settings.Get("instance_image"))
+		v, _ = convert.Convert(v, cty.Map(cty.String))
+		project := ""
+		if p, ok := v.AsValueMap()["project"]; ok && !p.IsNull() {
+			project = p.AsString()
+		}
+		return family, project, true
+	}
+	family, ok := evalStringSetting(bp, m, "source_image_family")
+	if !ok {
+		return "", "", false
+	}
+	project := ""
+	if v, ok := evalSetting(bp, m, "source_image_project_id", cty.NullVal(cty.List(cty.String))); ok {
+		if ps, err := ctyStrings(v); err == nil && len(ps) > 0 {
+			project = ps[0]
+		}
+	}
+	return family, project, true
+}
+
+func isWindowsImage(family string, project string) bool {
+	for _, p := range windowsProjects {
+		if project == p {
+			return true
+		}
+	}
+	return looksWindowsRe.MatchString(family)
+}
+
+// checkWindowsModule checks that the module with Windows image is not configured for Linux
+func checkWindowsModule(bp config.Blueprint, p config.ModulePath, m config.Module, family string) error {
+	errs := config.Errors{}
+	if !windowsFamilyRe.MatchString(family) {
+		errs.At(p.Settings, config.HintError{
+			Hint: "use a supported image family, e.g. \"windows-2022\" or \"sql-2022-standard-windows-2022\", see https://cloud.google.com/compute/docs/images/os-details#windows_server",
+			Err:  fmt.Errorf("image family %q of module %q is not a supported Windows Server image family", family, m.ID)})
+	}
+	if strings.Contains(m.Source, "schedmd-slurm") {
+		errs.At(p.Settings, fmt.Errorf("module %q runs Slurm, which requires a Linux image, got Windows image family %q", m.ID, family))
+	}
+	runners, known := evalSetting(bp, m, "runners", cty.NullVal(cty.DynamicPseudoType))
+	hasRunners := !known || (!runners.IsNull() && runners.CanIterateElements() && runners.LengthInt() > 0)
+	linuxScripts := []string{}
+	if isEnabledSetting(bp, m, "startup_script") {
+		linuxScripts = append(linuxScripts, "startup_script")
+	}
+	if hasRunners {
+		linuxScripts = append(linuxScripts, "runners")
+	}
+	for _, s := range linuxScripts {
+		errs.At(p.Settings.Dot(s), config.HintError{
+			Hint: "Windows runs only PowerShell startup scripts, pass them with `windows_startup_ps1` or a `.ps1` script module",
+			Err:  fmt.Errorf("%s of module %q will not be run by Windows image family %q", s, m.ID, family)})
+	}
+	if mt, ok := evalStringSetting(bp, m, "machine_type"); ok && isArmMachineType(mt) {
+		errs.At(p.Settings.Dot("machine_type"), fmt.Errorf("machine type %q of module %q has Arm CPUs, which do not support Windows", mt, m.ID))
+	}
+	for _, s := range []string{"disk_size_gb", "disk_size"} {
+		v, ok := evalSetting(bp, m, s, cty.NullVal(cty.Number))
+		if !ok || v.IsNull() || v.Type() != cty.Number {
+			continue
+		}
+		if size, _ := v.AsBigFloat().Int64(); size < windowsMinDiskSize {
+			errs.At(p.Settings.Dot(s), fmt.Errorf("%s of module %q must be at least %d GB for Windows images, got %d", s, m.ID, windowsMinDiskSize, size))
+		}
+	}
+	return errs.OrNil()
+}
+
+func testWindowsImage(bp config.Blueprint, inputs config.Dict) error {
+	if err := checkInputs(inputs, []string{}); err != nil {
+		return err
+	}
+	errs := config.Errors{}
+	bp.WalkModulesSafe(func(p config.ModulePath, m *config.Module) {
+		family, project, ok := moduleImage(bp, *m)
+		if !ok || !isWindowsImage(family, project) {
+			return
+		}
+		errs.Add(checkWindowsModule(bp, p, *m, family))
+	})
+	return errs.OrNil()
+}
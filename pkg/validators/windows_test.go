@@ -0,0 +1,83 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"hpc-toolkit/pkg/config"
+
+	"github.com/zclconf/go-cty/cty"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestWindowsImage(c *C) {
+	image := func(family string, project string) cty.Value {
+		return cty.ObjectVal(map[string]cty.Value{
+			"family":  cty.StringVal(family),
+			"project": cty.StringVal(project)})
+	}
+	check := func(source string, settings map[string]cty.Value) error {
+		bp := config.Blueprint{Groups: []config.Group{{Name: "g", Modules: []config.Module{
+			{ID: "win", Source: source, Settings: config.NewDict(settings)}}}}}
+		return testWindowsImage(bp, config.Dict{})
+	}
+	vm := "modules/compute/vm-instance"
+
+	{ // OK: Windows Server and SQL Server
+		c.Check(check(vm, map[string]cty.Value{
+			"instance_image": image("windows-2022", "windows-cloud"),
+			"disk_size_gb":   cty.NumberIntVal(100)}), IsNil)
+		c.Check(check(vm, map[string]cty.Value{
+			"instance_image": image("sql-2022-standard-windows-2022", "windows-sql-cloud")}), IsNil)
+		c.Check(check("modules/packer/custom-image", map[string]cty.Value{
+			"source_image_family":     cty.StringVal("windows-2019-core"),
+			"source_image_project_id": cty.TupleVal([]cty.Value{cty.StringVal("windows-cloud")})}), IsNil)
+	}
+
+	{ // OK: Linux image
+		c.Check(check(vm, map[string]cty.Value{
+			"instance_image": image("hpc-rocky-linux-8", "cloud-hpc-image-public"),
+			"startup_script": cty.StringVal("echo hello"),
+			"disk_size_gb":   cty.NumberIntVal(20)}), IsNil)
+	}
+
+	{ // FAIL: unsupported family
+		c.Check(check(vm, map[string]cty.Value{"instance_image": image("windows-2012-r2", "windows-cloud")}),
+			ErrorMatches, `.*image family "windows-2012-r2" of module "win" is not a supported Windows Server image family.*`)
+	}
+
+	{ // FAIL: Slurm with Linux startup script
+		err := check("community/modules/compute/schedmd-slurm-gcp-v6-nodeset", map[string]cty.Value{
+			"instance_image": image("windows-2022", "windows-cloud"),
+			"startup_script": cty.StringVal("#!/bin/bash")})
+		c.Check(err, ErrorMatches, `(?s).*module "win" runs Slurm, which requires a Linux image.*`)
+		c.Check(err, ErrorMatches, `(?s).*startup_script of module "win" will not be run by Windows image family "windows-2022".*`)
+	}
+
+	{ // FAIL: runners set by other modules
+		c.Check(check(vm, map[string]cty.Value{
+			"instance_image": image("windows-2022", "windows-cloud"),
+			"runners":        config.MustParseExpression(`module.setup.runners`).AsValue()}),
+			ErrorMatches, `.*runners of module "win" will not be run.*`)
+	}
+
+	{ // FAIL: Arm machine type and small disk
+		err := check(vm, map[string]cty.Value{
+			"instance_image": image("windows-2022", "windows-cloud"),
+			"machine_type":   cty.StringVal("t2a-standard-4"),
+			"disk_size_gb":   cty.NumberIntVal(30)})
+		c.Check(err, ErrorMatches, `(?s).*machine type "t2a-standard-4" of module "win" has Arm CPUs.*`)
+		c.Check(err, ErrorMatches, `(?s).*disk_size_gb of module "win" must be at least 50 GB for Windows images, got 30.*`)
+	}
+}